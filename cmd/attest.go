@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"time"
+)
+
+func NewAttestCmd() *cobra.Command {
+	var privateKeyPath *string
+	var auditorReference string
+	var allowUnknownScheme bool
+	var signerName string
+	var useAgent bool
+	var keyFingerprint string
+	var passphraseFile string
+	var sshCertificate string
+	var certValidity time.Duration
+	var specialFiles string
+	var hidden string
+	var color string
+	attestCmd := cobra.Command{
+		Use:   "attest [directory]",
+		Short: "Co-sign existing manifest files recursively",
+		Long: `Co-sign existing manifest files recursively starting from the specified directory.
+If no directory is provided, the current directory is used.
+
+Every manifest must match the current content of its directory. A new auditor
+signature is appended to each manifest while signatures of other auditors are kept,
+so several auditors can sign the same tree.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if len(*privateKeyPath) == 0 && signerName == "" && !useAgent && len(auditorReference) == 0 {
+				return fmt.Errorf("private key is required to attest manifests")
+			}
+			if err := validateCertValidity(certValidity); err != nil {
+				return err
+			}
+			specialFilesPolicy, err := scanner.ParseSpecialFilesPolicy(specialFiles)
+			if err != nil {
+				return err
+			}
+			hiddenPolicy, err := scanner.ParseHiddenPolicy(hidden)
+			if err != nil {
+				return err
+			}
+			signer, err := loadCryptoSigner(signerName, privateKeyPath, &auditorReference, passphraseFile,
+				useAgent, keyFingerprint, allowUnknownScheme)
+			if err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+
+			progress := scanner.NewProgressSource()
+			pm := ui.NewProgressMonitor(3 * time.Second)
+			pm.MonitorSourceInBackground(cmd.Context(), out, progress)
+
+			report, err := bytecheck.AttestTree(cmd.Context(), targetDir,
+				bytecheck.WithSigner(signer),
+				bytecheck.WithSpecialFiles(specialFilesPolicy),
+				bytecheck.WithHiddenPolicy(hiddenPolicy),
+				bytecheck.WithSSHCertificate(sshCertificate),
+				bytecheck.WithCertValidity(certValidity),
+				bytecheck.WithProgressSource(progress))
+			progress.Close()
+			pm.Wait()
+			if err != nil {
+				return err
+			}
+
+			pm.PrintFinalLine(out, report.Stats)
+			for _, m := range report.ManifestsWritten {
+				fmt.Fprintf(out, "manifest '%s' attested by %s\n", m, signer.Reference())
+			}
+			return nil
+		},
+	}
+	privateKeyPath = attestCmd.Flags().StringP("private-key", "", "",
+		"Path to ed25519 private key")
+	addAuditorReferenceFlags(&attestCmd, &auditorReference, &allowUnknownScheme)
+	addSignerFlag(&attestCmd, &signerName)
+	addAgentFlags(&attestCmd, &useAgent, &keyFingerprint)
+	addPassphraseFileFlag(&attestCmd, &passphraseFile)
+	addSSHCertificateFlag(&attestCmd, &sshCertificate)
+	addCertValidityFlag(&attestCmd, &certValidity)
+	addSpecialFilesFlag(&attestCmd, &specialFiles)
+	addHiddenFlag(&attestCmd, &hidden)
+	addColorFlag(&attestCmd, &color)
+	return &attestCmd
+}
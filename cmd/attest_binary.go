@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+	"strings"
+)
+
+// executablePath locates the binary checked by attest-binary, tests substitute another file
+var executablePath = verifier.ExecutablePath
+
+func NewAttestBinaryCommand() *cobra.Command {
+	var manifestPath string
+	var publicKeyPath string
+	var auditorReference string
+	var entityName string
+	var emailKeysURL string
+	var sshCAPath string
+	attestBinaryCmd := cobra.Command{
+		Use:   "attest-binary --manifest <path> (--public-key <path> | --auditor-reference <ref>)",
+		Short: "Check the bytecheck binary itself against a signed manifest",
+		Long: `Check that the running bytecheck binary is listed by a signed manifest before trusting its results,
+e.g. from an installer shipping datasets together with the binary.
+
+The binary is looked up among the entities of the manifest by its file name, or by --entity-name.
+The manifest HMAC and all its auditor signatures must be valid. A trust anchor is required, since
+valid signatures alone do not tell who signed the manifest: with --public-key, one of the
+signatures must come from that key; with --auditor-reference, from that auditor, whose key is
+then checked against its trusted source like verify does.
+
+A single line is printed, the exit code tells the outcome: 1 when the binary does not match,
+3 when the manifest is not signed as required.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if publicKeyPath != "" && auditorReference != "" {
+				return fmt.Errorf("--public-key cannot be combined with --auditor-reference")
+			}
+			if publicKeyPath == "" && auditorReference == "" {
+				return fmt.Errorf("--public-key or --auditor-reference is required to trust the signer of the manifest")
+			}
+			m, err := manifest.LoadManifest(manifestPath)
+			if err != nil {
+				return err
+			}
+			if m == nil {
+				return fmt.Errorf("%w: %s does not exist", bytecheck.ErrNoManifests, manifestPath)
+			}
+			binaryPath, err := executablePath()
+			if err != nil {
+				return err
+			}
+
+			attestation, err := verifier.AttestBinary(cmd.Context(), m, binaryPath, entityName)
+			switch {
+			case errors.Is(err, verifier.ErrBinaryMismatch):
+				return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed, Err: err}
+			case errors.Is(err, verifier.ErrAuditFailed):
+				return &bytecheck.VerificationError{Kind: bytecheck.ErrTrustFailure, Err: err}
+			case err != nil:
+				return err
+			}
+
+			var signedBy []string
+			if publicKeyPath != "" {
+				publicKey, err := signing.NewEd25519KeyReader("").ReadPublicKeyFromFile(publicKeyPath)
+				if err != nil {
+					return err
+				}
+				if signedBy, err = signersWithKey(attestation.Issuers, publicKey, publicKeyPath); err != nil {
+					return &bytecheck.VerificationError{Kind: bytecheck.ErrTrustFailure, Err: err}
+				}
+			}
+			if auditorReference != "" {
+				trustVerifier, err := newTrustVerifier(emailKeysURL, sshCAPath)
+				if err != nil {
+					return err
+				}
+				if err := checkAuditorTrusted(trustVerifier, attestation.Issuers, issuer.Reference(auditorReference)); err != nil {
+					return &bytecheck.VerificationError{Kind: bytecheck.ErrTrustFailure, Err: err}
+				}
+				signedBy = []string{auditorReference + " (trusted)"}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "ok - %s matches '%s' of %s, signed by %s\n",
+				binaryPath, attestation.Entity.Name, manifestPath, strings.Join(signedBy, ", "))
+			return nil
+		},
+	}
+	attestBinaryCmd.Flags().StringVarP(&manifestPath, "manifest", "m", "", "Path of the signed manifest listing the binary")
+	_ = attestBinaryCmd.MarkFlagRequired("manifest")
+	attestBinaryCmd.Flags().StringVarP(&publicKeyPath, "public-key", "", "",
+		"Require a signature by the ed25519 issuer key in this SSH public key file")
+	attestBinaryCmd.Flags().StringVarP(&auditorReference, "auditor-reference", "", "",
+		"Require a signature by this auditor (e.g., 'github:my-org'), trusted according to its source")
+	attestBinaryCmd.Flags().StringVarP(&entityName, "entity-name", "", "",
+		"Name of the binary among the entities of the manifest, the file name of the executable by default")
+	attestBinaryCmd.Flags().StringVarP(&emailKeysURL, "email-keys-url", "", "",
+		"URL template of the authorized keys of 'email:<address>' auditors, see verify")
+	attestBinaryCmd.Flags().StringVarP(&sshCAPath, "ssh-ca", "", "",
+		"File with the public keys of SSH certificate authorities trusted for 'sshca:<principal>' auditors")
+	return &attestBinaryCmd
+}
+
+// signersWithKey returns the references of the issuers signing with publicKey, read from keyPath
+func signersWithKey(issuers []issuer.Issuer, publicKey []byte, keyPath string) ([]string, error) {
+	var refs []string
+	for _, iss := range issuers {
+		if bytes.Equal(iss.PublicKey, publicKey) {
+			refs = append(refs, string(iss.Reference))
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("manifest is not signed by the key in %s", keyPath)
+	}
+	return refs, nil
+}
+
+// checkAuditorTrusted requires ref among the issuers and its key to be trusted by trustVerifier
+func checkAuditorTrusted(trustVerifier issuer.Verifier, issuers []issuer.Issuer, ref issuer.Reference) error {
+	for _, iss := range issuers {
+		if iss.Reference != ref {
+			continue
+		}
+		status := trustVerifier.Verify([]issuer.Issuer{iss})[ref]
+		if !status.Supported {
+			return fmt.Errorf("no trusted source supports auditor '%s'", ref)
+		}
+		if status.Error != nil {
+			return fmt.Errorf("auditor '%s' is not trusted: %w", ref, status.Error)
+		}
+		return nil
+	}
+	return fmt.Errorf("manifest is not signed by auditor '%s'", ref)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// createSignedRelease creates a release directory with a bytecheck binary standing in for the executable,
+// signed by custom:testuser, and returns the directory and the keys directory
+func createSignedRelease(t *testing.T) (string, string) {
+	releaseDir := CreateSampleStructureFromMap(t, map[string]string{"bytecheck": "\x7fELF binary", "data/a.bin": "a"})
+	keysDir := t.TempDir()
+	keyPath := filepath.Join(keysDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(keyPath, "custom:testuser")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), releaseDir))
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+keysDir+"/%s.pub")
+
+	previous := executablePath
+	t.Cleanup(func() { executablePath = previous })
+	executablePath = func() (string, error) { return filepath.Join(releaseDir, "bytecheck"), nil }
+	return releaseDir, keysDir
+}
+
+func TestAttestBinaryCmd_WithSignedManifest_mustPrintSingleLine(t *testing.T) {
+	releaseDir, keysDir := createSignedRelease(t)
+	manifestPath := filepath.Join(releaseDir, manifest.DefaultName)
+
+	output, err := ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", manifestPath, "--public-key", filepath.Join(keysDir, "testuser.pub")})
+	require.NoError(t, err)
+	assert.Equal(t, "ok - "+filepath.Join(releaseDir, "bytecheck")+" matches 'bytecheck' of "+manifestPath+
+		", signed by custom:testuser\n", output)
+
+	output, err = ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", manifestPath, "--auditor-reference", "custom:testuser"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "signed by custom:testuser (trusted)\n")
+}
+
+func TestAttestBinaryCmd_WithoutTrustAnchor_mustFail(t *testing.T) {
+	releaseDir, _ := createSignedRelease(t)
+
+	_, err := ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", filepath.Join(releaseDir, manifest.DefaultName)})
+	assert.EqualError(t, err, "--public-key or --auditor-reference is required to trust the signer of the manifest")
+}
+
+func TestAttestBinaryCmd_WithOtherSigner_mustFailTrust(t *testing.T) {
+	releaseDir, _ := createSignedRelease(t)
+	manifestPath := filepath.Join(releaseDir, manifest.DefaultName)
+	otherKey := filepath.Join(t.TempDir(), "other")
+	_, _, err := signing.GenerateKeyPair(otherKey, otherKey+".pub")
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", manifestPath, "--public-key", otherKey + ".pub"})
+	assert.EqualError(t, err, "manifest is not signed by the key in "+otherKey+".pub")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+
+	_, err = ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", manifestPath, "--auditor-reference", "github:someone-else"})
+	assert.EqualError(t, err, "manifest is not signed by auditor 'github:someone-else'")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+}
+
+func TestAttestBinaryCmd_WithModifiedBinary_mustFail(t *testing.T) {
+	releaseDir, keysDir := createSignedRelease(t)
+	require.NoError(t, os.WriteFile(filepath.Join(releaseDir, "bytecheck"), []byte("\x7fELF patched"), 0755))
+
+	_, err := ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", filepath.Join(releaseDir, manifest.DefaultName), "--public-key", filepath.Join(keysDir, "testuser.pub")})
+
+	assert.ErrorContains(t, err, "binary does not match its manifest")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+}
+
+func TestAttestBinaryCmd_WithEntityName_mustLookUpThatEntity(t *testing.T) {
+	releaseDir, keysDir := createSignedRelease(t)
+	manifestPath := filepath.Join(releaseDir, manifest.DefaultName)
+	publicKey := filepath.Join(keysDir, "testuser.pub")
+
+	_, err := ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", manifestPath, "--entity-name", "bytecheck-linux-amd64", "--public-key", publicKey})
+	assert.EqualError(t, err, "manifest has no entity named 'bytecheck-linux-amd64'")
+
+	_, err = ExecuteCommandWithCapture(t, NewAttestBinaryCommand(),
+		[]string{"--manifest", filepath.Join(releaseDir, "missing.manifest"), "--public-key", publicKey})
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+func TestAttestCmd_WithTwoAuditors_mustKeepBothSignatures(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt":        "test content",
+		"subdir/sub.txt":  "sub content",
+		"subdir/deep/a.b": "deep content",
+	})
+	keysDir := t.TempDir()
+	for _, name := range []string{"alice", "bob"} {
+		keyPath := filepath.Join(keysDir, name)
+		_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+		require.NoError(t, err)
+	}
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir,
+		"--private-key", filepath.Join(keysDir, "alice"), "--auditor-reference", "custom:alice"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewAttestCmd(), []string{"--color", "always", tempDir,
+		"--private-key", filepath.Join(keysDir, "bob"), "--auditor-reference", "custom:bob"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "attested by custom:bob")
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, "subdir", ".bytecheck.manifest"))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 2)
+	assert.Equal(t, "custom:alice", m.Auditors[0].Certificate.IssuerRef)
+	assert.Equal(t, "custom:bob", m.Auditors[1].Certificate.IssuerRef)
+
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+keysDir+"/%s.pub")
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "audited by \u001B[36mcustom:alice\u001B[0m \u001B[32m[trusted]\u001B[0m (3 manifests)")
+	assert.Contains(t, output, "audited by \u001B[36mcustom:bob\u001B[0m \u001B[32m[trusted]\u001B[0m (3 manifests)")
+	assert.Contains(t, output, "verified 3 manifest(s) (0 shallow)")
+}
+
+func TestAttestCmd_WithModifiedContent_mustRefuseToAttest(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt": "test content",
+	})
+	keyPath := filepath.Join(t.TempDir(), "key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("changed"), 0644))
+
+	_, err = ExecuteCommandWithCapture(t, NewAttestCmd(), []string{tempDir,
+		"--private-key", keyPath, "--auditor-reference", "custom:bob"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "does not match its content")
+}
@@ -1,87 +1,117 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
-	"io/fs"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func NewCleanCommand() *cobra.Command {
+	var dryRun bool
+	var force bool
+	var olderThan time.Duration
+	var manifestName string
 	cleanCmd := cobra.Command{
 		Use:   "clean [directory]",
-		Short: "Remove all manifest files recursively",
-		Long: `Remove all manifest files recursively starting from the specified directory.
+		Short: "Remove stale manifest files recursively",
+		Long: `Remove manifest files recursively starting from the specified directory.
 If no directory is provided, the current directory is used.
 
-This command will permanently delete all manifest files found in the
-directory tree. Use with caution.`,
-		Args: cobra.MaximumNArgs(1),
+Only manifests that can no longer be loaded, e.g. with an invalid HMAC, are removed
+by default. Manifests that are still valid are kept unless --force is passed.
+Use --dry-run to list the files that would be removed.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			targetDir := "."
 			if len(args) > 0 {
 				targetDir = args[0]
 			}
+			if olderThan < 0 {
+				return fmt.Errorf("invalid --older-than %s: must not be negative", olderThan)
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
 
-			count := 0
-			errors := 0
-
-			// To avoid dependency
-			manifestName := ".bytecheck.manifest"
-
-			// Use filepath.WalkDir for simpler recursive traversal
-			err := filepath.WalkDir(targetDir, func(path string, d fs.DirEntry, err error) error {
+			var removed, kept, errors int
+			err := traverse.WalkPostOrder(cmd.Context(), targetDir, func(ctx context.Context, dirPath string, err error) error {
 				if err != nil {
+					fmt.Fprintf(out, "error reading %s: %v\n", dirPath, err)
 					errors++
 					return nil // Continue despite errors
 				}
-
-				// Skip directories, only process files
-				if d.IsDir() {
+				manifestPath := filepath.Join(dirPath, manifestName)
+				modTime, err := manifest.GetModTime(manifestPath)
+				if os.IsNotExist(err) {
 					return nil
 				}
-
-				// Check if filename matches our pattern
-				filename := filepath.Base(path)
-				if filename == manifestName {
-					if removeErr := os.Remove(path); removeErr != nil {
-						fmt.Printf("Error removing %s: %v\n", path, removeErr)
-						errors++
-					} else {
-						fmt.Printf("Removed: %s\n", path)
-						count++
+				if err != nil {
+					fmt.Fprintf(out, "error reading %s: %v\n", manifestPath, err)
+					errors++
+					return nil
+				}
+				if olderThan > 0 && time.Since(modTime) < olderThan {
+					return nil
+				}
+				if !force {
+					if m, loadErr := manifest.LoadManifest(manifestPath); loadErr == nil && m != nil {
+						fmt.Fprintf(out, "kept (valid): %s\n", manifestPath)
+						kept++
+						return nil
 					}
 				}
-
+				if dryRun {
+					fmt.Fprintf(out, "would remove: %s\n", manifestPath)
+					removed++
+					return nil
+				}
+				if err := os.Remove(manifestPath); err != nil {
+					fmt.Fprintf(out, "error removing %s: %v\n", manifestPath, err)
+					errors++
+					return nil
+				}
+				fmt.Fprintf(out, "removed: %s\n", manifestPath)
+				removed++
 				return nil
 			})
 
-			// Print summary
-			fmt.Printf("\nSummary: Removed %d file%s", count, pluralize(count))
+			verb := "removed"
+			if dryRun {
+				verb = "would remove"
+			}
+			fmt.Fprintf(out, "\nsummary: %s %d file%s", verb, removed, ui.Pluralize(removed, "", "s"))
+			if kept > 0 {
+				fmt.Fprintf(out, ", kept %d valid manifest%s (use --force to remove them)", kept, ui.Pluralize(kept, "", "s"))
+			}
 			if errors > 0 {
-				fmt.Printf(", %d error%s", errors, pluralize(errors))
+				fmt.Fprintf(out, ", %d error%s", errors, ui.Pluralize(errors, "", "s"))
 			}
-			fmt.Println()
+			fmt.Fprintln(out)
 
 			if err != nil {
 				return err
 			}
-
 			if errors > 0 {
 				return fmt.Errorf("encountered %d error(s) during cleaning", errors)
 			}
-
 			return nil
 		},
 	}
+	cleanCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false,
+		"List manifest files that would be removed without removing them")
+	cleanCmd.Flags().BoolVarP(&force, "force", "", false,
+		"Also remove manifests that are still valid")
+	cleanCmd.Flags().DurationVarP(&olderThan, "older-than", "", 0,
+		"Only remove manifests last modified longer ago than this duration (e.g., 24h)")
+	addManifestNameFlag(&cleanCmd, &manifestName)
 	return &cleanCmd
 }
-
-// Simple pluralize helper
-func pluralize(count int) string {
-	if count == 1 {
-		return ""
-	}
-	return "s"
-}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanCmd_WithoutForce_mustKeepValidManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	corrupted := filepath.Join(tempDir, "sub", ".bytecheck.manifest")
+	require.NoError(t, CorruptFileByOneByte(t, corrupted, 7))
+
+	output, err := ExecuteCommandWithCapture(t, NewCleanCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "removed 1 file, kept 1 valid manifest")
+	assert.NoFileExists(t, corrupted)
+	assert.FileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+}
+
+func TestCleanCmd_WithForceAndDryRun_mustOnlyListManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewCleanCommand(), []string{tempDir, "--force", "--dry-run"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "would remove 2 files")
+	assert.FileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+	assert.FileExists(t, filepath.Join(tempDir, "sub", ".bytecheck.manifest"))
+
+	output, err = ExecuteCommandWithCapture(t, NewCleanCommand(), []string{tempDir, "--force"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "removed 2 files")
+	assert.NoFileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "sub", ".bytecheck.manifest"))
+}
+
+func TestCleanCmd_WithOlderThan_mustKeepRecentManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	old := time.Now().Add(-48 * time.Hour)
+	oldManifest := filepath.Join(tempDir, "sub", ".bytecheck.manifest")
+	require.NoError(t, os.Chtimes(oldManifest, old, old))
+
+	output, err := ExecuteCommandWithCapture(t, NewCleanCommand(), []string{tempDir, "--force", "--older-than", "24h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "removed 1 file")
+	assert.NoFileExists(t, oldManifest)
+	assert.FileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+}
+
+func TestCleanCmd_WithManifestName_mustRemoveOnlyManifestsOfThatName(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--manifest-name", "custom.manifest"})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewCleanCommand(), []string{tempDir, "--force", "--manifest-name", "custom.manifest"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "removed 2 files")
+	assert.NoFileExists(t, filepath.Join(tempDir, "sub", "custom.manifest"))
+	assert.FileExists(t, filepath.Join(tempDir, "sub", ".bytecheck.manifest"))
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletion_Scripts(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			output, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"completion", shell})
+			require.NoError(t, err)
+			assert.Contains(t, output, "bytecheck")
+		})
+	}
+}
+
+func TestCompletion_Values(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "directory argument", args: []string{"verify", ""}, want: []string{":16"}},
+		{name: "no second directory", args: []string{"generate", "dir", ""}, want: []string{":4"}},
+		{name: "second diff directory", args: []string{"diff", "a", ""}, want: []string{":16"}},
+		{name: "freshness mode", args: []string{"verify", "--freshness-mode", ""}, want: []string{"mtime", "embedded", ":4"}},
+		{name: "signer", args: []string{"generate", "--signer", ""}, want: []string{"agent", "file", "yubikey", ":4"}},
+		{name: "archive", args: []string{"verify", "--archive", ""}, want: []string{"tar", "gz", "tgz", "zip", ":8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := ExecuteCommandWithCapture(t, InitializeCommands(), append([]string{"__complete"}, tt.args...))
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, output, want+"\n")
+			}
+		})
+	}
+}
+
+func TestVersion_CommandAndFlagMatch(t *testing.T) {
+	fromCommand, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"version"})
+	require.NoError(t, err)
+	fromFlag, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"--version"})
+	require.NoError(t, err)
+
+	assert.Contains(t, fromCommand, "version: ")
+	assert.Contains(t, fromCommand, "commit: ")
+	assert.Contains(t, fromCommand, "built: ")
+	assert.Equal(t, fromCommand, fromFlag)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/config"
+)
+
+// treeConfigCommands holds the commands whose directory argument is the root of a tree, so that the config
+// of the tree applies to them, see config.TreeFileName. Verify is left out: the tree it verifies must not
+// choose the trust sources, e.g. --ssh-ca, or the manifests, e.g. --manifest-name, it is verified against.
+var treeConfigCommands = map[string]bool{"generate": true, "repair": true}
+
+// applyConfig sets the flags of cmd that were not given on the command line to the values configured for them,
+// see config.Load. Keys without a flag of that name in cmd are ignored.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	treeDir := ""
+	if treeConfigCommands[cmd.Name()] {
+		treeDir = "."
+		if len(args) > 0 {
+			treeDir = args[0]
+		}
+	}
+	cfg, err := config.Load(treeDir)
+	if err != nil {
+		return err
+	}
+	for _, setting := range cfg.Settings() {
+		flag := cmd.Flags().Lookup(setting.Key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(setting.Value); err != nil {
+			return fmt.Errorf("invalid %s '%s' from %s: %w", setting.Key, setting.Value, setting, err)
+		}
+	}
+	return nil
+}
+
+func NewConfigCommand() *cobra.Command {
+	configCmd := cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configured defaults of flags",
+		Long: `Flags of generate, verify and repair default to values configured, from lowest to highest
+precedence, in the user config (` + config.UserFileName + ` in the bytecheck directory of the user config
+directory, e.g. ~/.config/bytecheck), in ` + config.TreeFileName + ` at the root of the tree and in
+` + config.EnvPrefix + `* environment variables. Flags given on the command line always win. Verify ignores
+` + config.TreeFileName + `, so that the tree under verification cannot choose how it is verified.`,
+	}
+	configCmd.AddCommand(newConfigShowCommand())
+	return &configCmd
+}
+
+func newConfigShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [directory]",
+		Short: "Print the effective configuration and where each value comes from",
+		Long: `Print the value of every configurable key for the tree rooted at the specified directory,
+or the current one, together with the layer it comes from.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			treeDir := "."
+			if len(args) > 0 {
+				treeDir = args[0]
+			}
+			cfg, err := config.Load(treeDir)
+			if err != nil {
+				return err
+			}
+			defaults := []*cobra.Command{NewGenerateCmd(), NewVerifyCommand()}
+			for _, key := range config.Keys {
+				setting, ok := cfg.Lookup(key)
+				if !ok {
+					setting = config.Setting{Key: key, Source: config.SourceDefault}
+					for _, c := range defaults {
+						if flag := c.Flags().Lookup(key); flag != nil {
+							setting.Value = flag.DefValue
+							break
+						}
+					}
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%-20s = %-30s (%s)\n", key, setting.Value, setting)
+			}
+			return nil
+		},
+	}
+}
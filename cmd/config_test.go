@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/config"
+)
+
+// isolateConfig points the user config to an empty temporary directory and clears the environment variables
+// of every key, it returns the path of the user config
+func isolateConfig(t *testing.T) string {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, key := range config.Keys {
+		t.Setenv(config.EnvName(key), "")
+	}
+	userFile, ok := config.UserFilePath()
+	require.True(t, ok)
+	require.NoError(t, os.MkdirAll(filepath.Dir(userFile), 0755))
+	return userFile
+}
+
+func TestConfig_mustApplyLayersByPrecedence(t *testing.T) {
+	userFile := isolateConfig(t)
+
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, dir string)
+		args     []string
+		expected string
+	}{
+		{
+			name:     "default",
+			setup:    func(t *testing.T, dir string) {},
+			expected: ".bytecheck.manifest",
+		},
+		{
+			name: "user config",
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(userFile, []byte("manifest-name: user.manifest\n"), 0644))
+			},
+			expected: "user.manifest",
+		},
+		{
+			name: "tree config over user config",
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, config.TreeFileName), []byte("manifest-name: tree.manifest\n"), 0644))
+			},
+			expected: "tree.manifest",
+		},
+		{
+			name: "environment over tree config",
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, config.TreeFileName), []byte("manifest-name: tree.manifest\n"), 0644))
+				t.Setenv("BYTECHECK_MANIFEST_NAME", "env.manifest")
+			},
+			expected: "env.manifest",
+		},
+		{
+			name: "flag over environment",
+			setup: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, config.TreeFileName), []byte("manifest-name: tree.manifest\n"), 0644))
+				t.Setenv("BYTECHECK_MANIFEST_NAME", "env.manifest")
+			},
+			args:     []string{"--manifest-name", "flag.manifest"},
+			expected: "flag.manifest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := CreateSampleStructureFromMap(t, map[string]string{"a/a.txt": "a"})
+			tt.setup(t, dir)
+
+			output, err := ExecuteCommandWithCapture(t, InitializeCommands(), append([]string{"generate", dir}, tt.args...))
+			require.NoError(t, err, output)
+			assert.FileExists(t, filepath.Join(dir, tt.expected))
+			assert.FileExists(t, filepath.Join(dir, "a", tt.expected))
+
+			output, err = ExecuteCommandWithCapture(t, InitializeCommands(), []string{"verify", dir, "--manifest-name", tt.expected})
+			require.NoError(t, err, output)
+		})
+	}
+}
+
+func TestConfig_WithInvalidValue_mustFail(t *testing.T) {
+	isolateConfig(t)
+	dir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+	treeFile := filepath.Join(dir, config.TreeFileName)
+	require.NoError(t, os.WriteFile(treeFile, []byte("freshness-interval: soon\n"), 0644))
+
+	_, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"generate", dir})
+	assert.ErrorContains(t, err, "invalid freshness-interval 'soon' from tree config "+treeFile)
+
+	require.NoError(t, os.WriteFile(treeFile, []byte("manifest_name: x\n"), 0644))
+	_, err = ExecuteCommandWithCapture(t, InitializeCommands(), []string{"repair", dir})
+	assert.ErrorContains(t, err, "unknown key 'manifest_name'")
+}
+
+func TestConfig_WithTreeConfig_mustBeIgnoredByVerify(t *testing.T) {
+	isolateConfig(t)
+	dir := CreateSampleStructureFromMap(t, map[string]string{"a/a.txt": "a"})
+	output, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"generate", dir})
+	require.NoError(t, err, output)
+	// A tampered tree config must neither pick the manifests nor the trust sources verify uses
+	treeFile := filepath.Join(dir, config.TreeFileName)
+	require.NoError(t, os.WriteFile(treeFile, []byte("manifest-name: forged.manifest\nssh-ca: missing.pub\n"), 0644))
+
+	output, err = ExecuteCommandWithCapture(t, InitializeCommands(), []string{"verify", dir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err), output)
+	assert.Contains(t, output, "extra file: "+config.TreeFileName)
+}
+
+func TestConfigShow_mustPrintEffectiveValuesAndSources(t *testing.T) {
+	userFile := isolateConfig(t)
+	dir := t.TempDir()
+	treeFile := filepath.Join(dir, config.TreeFileName)
+	require.NoError(t, os.WriteFile(userFile, []byte("freshness-interval: 1h\ncolor: never\n"), 0644))
+	require.NoError(t, os.WriteFile(treeFile, []byte("freshness-interval: 24h\nssh-ca: ca.pub\n"), 0644))
+	t.Setenv("BYTECHECK_MANIFEST_NAME", "env.manifest")
+
+	output, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"config", "show", dir})
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"auditor-reference":  `\(default\)`,
+		"color":              `never\s+\(user config ` + regexp.QuoteMeta(userFile) + `\)`,
+		"email-keys-url":     `\(default\)`,
+		"freshness-interval": `24h\s+\(tree config ` + regexp.QuoteMeta(treeFile) + `\)`,
+		"manifest-name":      `env\.manifest\s+\(environment BYTECHECK_MANIFEST_NAME\)`,
+		"private-key":        `\(default\)`,
+		"ssh-ca":             regexp.QuoteMeta(filepath.Join(dir, "ca.pub")) + `\s+\(tree config ` + regexp.QuoteMeta(treeFile) + `\)`,
+	}
+	for key, value := range expected {
+		assert.Regexp(t, `(?m)^`+key+`\s+= .*`+value+`$`, output)
+	}
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/diff"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func NewDiffCommand() *cobra.Command {
+	var manifestsOnly bool
+	var jsonOutput bool
+	var color string
+	diffCmd := cobra.Command{
+		Use:   "diff <directoryA> <directoryB>",
+		Short: "Compare two manifest trees",
+		Long: `Compare two directory trees by pairing up their manifests by relative path.
+Reports added, removed and modified files and directories, including directories
+that exist only in one of the trees.
+
+By default the content of both trees is hashed. Use --manifests-only to compare the
+stored manifest files without reading any data.
+The command exits with an error when differences are found.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeDirectories(2),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			source := diff.StoredManifests(manifest.DefaultName)
+			if !manifestsOnly {
+				source = diff.ScannedManifests(scanner.New())
+			}
+
+			report, err := diff.CompareTrees(cmd.Context(), args[0], args[1], source)
+			if err != nil {
+				return err
+			}
+
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					return fmt.Errorf("failed to encode report: %w", err)
+				}
+			} else {
+				ui.PrintTreeDifferences(out, report)
+			}
+
+			if report.HasDifferences() {
+				return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed,
+					Err: fmt.Errorf("found differences in %d director%s", len(report.Directories),
+						ui.Pluralize(len(report.Directories), "y", "ies"))}
+			}
+			return nil
+		},
+	}
+	diffCmd.Flags().BoolVarP(&manifestsOnly, "manifests-only", "", false,
+		"Compare stored manifest files only, without hashing any data")
+	diffCmd.Flags().BoolVarP(&jsonOutput, "json", "", false,
+		"Print the report as JSON")
+	addColorFlag(&diffCmd, &color)
+	return &diffCmd
+}
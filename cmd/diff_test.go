@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCmd_WithIdenticalTrees_mustSucceed(t *testing.T) {
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	dirA, dirB := CreateSampleStructureFromMap(t, files), CreateSampleStructureFromMap(t, files)
+	for _, dir := range []string{dirA, dirB} {
+		_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+		require.NoError(t, err)
+	}
+
+	output, err := ExecuteCommandWithCapture(t, NewDiffCommand(), []string{dirA, dirB})
+	require.NoError(t, err)
+	assert.Contains(t, output, "no differences")
+}
+
+func TestDiffCmd_WithChangedTree_mustReportDifferencesAndFail(t *testing.T) {
+	dirA := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	dirB := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "changed", "other/c.txt": "c"})
+	for _, dir := range []string{dirA, dirB} {
+		_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+		require.NoError(t, err)
+	}
+
+	output, err := ExecuteCommandWithCapture(t, NewDiffCommand(), []string{"--color", "always", dirA, dirB, "--manifests-only"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "found differences in 3 directories")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "added directory:\u001B[0m other")
+	assert.Contains(t, output, "modified directory:\u001B[0m sub")
+	assert.Contains(t, output, "checksum mismatch:\u001B[0m b.txt")
+
+	output, err = ExecuteCommandWithCapture(t, NewDiffCommand(), []string{"--color", "always", dirA, dirB, "--json"})
+	require.Error(t, err)
+	var report struct {
+		Directories []struct {
+			Path   string `json:"path"`
+			Change string `json:"change"`
+		} `json:"directories"`
+	}
+	require.NoError(t, json.NewDecoder(strings.NewReader(output)).Decode(&report), output)
+	require.Len(t, report.Directories, 3)
+	assert.Equal(t, ".", report.Directories[0].Path)
+	assert.Equal(t, "added", report.Directories[1].Change)
+	assert.Equal(t, "modified", report.Directories[2].Change)
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/analyze"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func NewDupesCommand() *cobra.Command {
+	var rehash bool
+	var minSize string
+	var jsonOutput bool
+	var color string
+	var manifestName string
+	dupesCmd := cobra.Command{
+		Use:   "dupes [directory]",
+		Short: "Find files sharing their content",
+		Long: `Find files with identical content in the tree rooted at the specified directory,
+or the current one, by grouping them by the checksums recorded in their manifests.
+No file is read, except to stat files whose manifests predate recording sizes.
+
+Sets of duplicates are listed with the bytes removing all copies but one would save,
+largest savings first. Use --rehash to hash the current content instead of trusting
+the manifests, which also works on trees without manifests.
+
+Hard links of one file waste no space, they are recognized in manifests generated with
+--track-hardlinks and with --rehash.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			minBytes, err := parseSize(minSize)
+			if err != nil {
+				return fmt.Errorf("invalid --min-size, expected a size like 1MB")
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+
+			finder := analyze.NewDuplicateFinder(minBytes)
+			add := func(dir string, entity manifest.Entity) error {
+				finder.Add(dir, entity)
+				return nil
+			}
+			if rehash {
+				sc := scanner.New(scanner.WithManifestName(manifestName), scanner.WithAllowMissingManifests(true),
+					scanner.WithTrackHardlinks(true))
+				err = analyze.ScannedEntities(cmd.Context(), sc, targetDir, add)
+			} else {
+				// Manifests are read twice, so that only files with duplicates are held in memory
+				err = analyze.StoredEntities(cmd.Context(), targetDir, manifestName,
+					func(dir string, entity manifest.Entity) error {
+						finder.Count(entity)
+						return nil
+					})
+				if err == nil {
+					err = analyze.StoredEntities(cmd.Context(), targetDir, manifestName, add)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			report := finder.Report()
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					return fmt.Errorf("failed to encode report: %w", err)
+				}
+				return nil
+			}
+			ui.PrintDuplicates(out, report)
+			return nil
+		},
+	}
+	dupesCmd.Flags().BoolVarP(&rehash, "rehash", "", false,
+		"Hash the current content of every file instead of reading the checksums from the manifests")
+	dupesCmd.Flags().StringVarP(&minSize, "min-size", "", "",
+		"Leave out files smaller than this size (e.g., 4KB, 1MB)")
+	dupesCmd.Flags().BoolVarP(&jsonOutput, "json", "", false,
+		"Print the report as JSON")
+	addColorFlag(&dupesCmd, &color)
+	addManifestNameFlag(&dupesCmd, &manifestName)
+	return &dupesCmd
+}
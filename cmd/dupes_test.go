@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDupesCmd_mustListDuplicatesFromManifests(t *testing.T) {
+	dir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt": "shared", "sub/a-copy.txt": "shared", "sub/b.txt": "b", "unique.txt": "unique",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "2 copies of 6 B, 6 B wasted")
+	assert.Contains(t, output, "  a.txt\n  sub/a-copy.txt\n")
+	assert.Contains(t, output, "1 duplicate set, 2 of 4 files, 6 B wasted")
+
+	output, err = ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir, "--min-size", "1KB"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "ok - no duplicates among 0 files")
+
+	output, err = ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir, "--json"})
+	require.NoError(t, err)
+	var report struct {
+		Sets []struct {
+			Paths []string `json:"paths"`
+		} `json:"sets"`
+		WastedBytes int64 `json:"wastedBytes"`
+	}
+	require.NoError(t, json.NewDecoder(strings.NewReader(output)).Decode(&report), output)
+	require.Len(t, report.Sets, 1)
+	assert.Equal(t, []string{"a.txt", "sub/a-copy.txt"}, report.Sets[0].Paths)
+	assert.Equal(t, int64(6), report.WastedBytes)
+}
+
+func TestDupesCmd_WithRehash_mustIgnoreOutdatedManifests(t *testing.T) {
+	dir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "shared", "sub/a-copy.txt": "shared"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a-copy.txt"), []byte("edited"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "1 duplicate set")
+
+	output, err = ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir, "--rehash"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "ok - no duplicates among 2 files")
+}
+
+func TestDupesCmd_WithInvalidMinSize_mustFail(t *testing.T) {
+	dir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+
+	_, err := ExecuteCommandWithCapture(t, NewDupesCommand(), []string{dir, "--min-size", "lots"})
+	assert.ErrorContains(t, err, "invalid --min-size")
+}
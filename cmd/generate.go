@@ -1,37 +1,380 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
 	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/metrics"
 	"github.com/tomekjarosik/bytecheck/pkg/scanner"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
 	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func loadCryptoSigner(keyPath *string, issuerReference *string) (signer signing.Signer, err error) {
-	signer = signing.NewFakeSigner()
-	if keyPath != nil && len(*keyPath) > 0 {
-		if issuerReference == nil || len(*issuerReference) == 0 {
-			return nil, fmt.Errorf("issuer reference is required when using private key")
+// sourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH environment variable,
+// see https://reproducible-builds.org/specs/source-date-epoch/. It must be set.
+func sourceDateEpoch() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}, fmt.Errorf("--reproducible requires SOURCE_DATE_EPOCH to be set")
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH '%s': expected a non-negative number of seconds", value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// loadCryptoSigner creates the signer selected by signerName. An empty name keeps the
+// historical behaviour: a YubiKey is tried first, then a plain key file.
+// The ssh-agent is used with useAgent, or when an issuer reference is given without a key path, its key is
+// selected by keyFingerprint, see signing.NewAgentSigner.
+// Without a signer name, key path and issuer reference the signer is nil and manifests are not signed.
+// Encrypted key files are decrypted with the passphrase from passphraseFile, see signing.DefaultPassphrase.
+// The issuer reference is validated and its scheme normalized in place, see parseIssuerReference.
+func loadCryptoSigner(signerName string, keyPath *string, issuerReference *string, passphraseFile string,
+	useAgent bool, keyFingerprint string, allowUnknownScheme bool) (signer signing.Signer, err error) {
+	hasKeyPath := keyPath != nil && len(*keyPath) > 0
+	hasIssuerReference := issuerReference != nil && len(*issuerReference) > 0
+	if useAgent && signerName != "" && signerName != signing.SignerAgent {
+		return nil, fmt.Errorf("--use-agent cannot be combined with --signer %s", signerName)
+	}
+	if signerName == "" && (useAgent || (!hasKeyPath && hasIssuerReference)) {
+		signerName = signing.SignerAgent
+	}
+	if keyFingerprint != "" && signerName != signing.SignerAgent {
+		return nil, fmt.Errorf("--key-fingerprint selects a key of the ssh-agent, use it with --use-agent")
+	}
+	if signerName == "" && !hasKeyPath {
+		return nil, nil
+	}
+	if !hasIssuerReference {
+		return nil, fmt.Errorf("issuer reference is required when using private key")
+	}
+	if *issuerReference, err = parseIssuerReference(*issuerReference, allowUnknownScheme); err != nil {
+		return nil, err
+	}
+	if signerName == signing.SignerAgent {
+		keyRef := keyFingerprint
+		if keyRef == "" && hasKeyPath {
+			keyRef = *keyPath
 		}
-		signer, err = signing.NewYubiKeySigner(*keyPath, *issuerReference)
-		if err == nil {
-			return signer, nil
+		signer, err = signing.NewAgentSignerFromEnv(keyRef, *issuerReference)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s signer: %w", signerName, err)
 		}
-		signer, err = signing.NewEd25519SignerFromFile(*keyPath, *issuerReference)
+		return signer, nil
+	}
+	passphrase := signing.DefaultPassphrase(passphraseFile)
+	if signerName != "" {
+		signer, err = signing.NewSignerWithPassphrase(signerName, *keyPath, *issuerReference, passphrase)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create signer from file: %w", err)
+			return nil, fmt.Errorf("failed to create %s signer: %w", signerName, err)
 		}
+		return signer, nil
+	}
+	signer, err = signing.NewYubiKeySigner(*keyPath, *issuerReference)
+	if err == nil {
+		return signer, nil
+	}
+	signer, err = signing.NewEd25519SignerFromFileWithPassphrase(*keyPath, *issuerReference, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signer from file: %w", err)
 	}
 	return signer, nil
 }
 
+// parseIssuerReference validates the issuer reference of --auditor-reference before anything is signed with it,
+// so that a mistyped reference is not found only by verifying on another machine, see issuer.ParseReference.
+// It returns the reference with its scheme normalized. References of unknown schemes are accepted with
+// allowUnknownScheme.
+func parseIssuerReference(reference string, allowUnknownScheme bool) (string, error) {
+	scheme, identifier, err := issuer.ParseReference(reference)
+	if errors.Is(err, issuer.ErrUnknownScheme) {
+		if allowUnknownScheme {
+			err = nil
+		} else {
+			err = fmt.Errorf("%w; use --allow-unknown-scheme to sign with it anyway", err)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid --auditor-reference: %w", err)
+	}
+	return scheme + identifier, nil
+}
+
+// addAuditorReferenceFlags registers the --auditor-reference and --allow-unknown-scheme flags shared by commands
+// that sign manifests
+func addAuditorReferenceFlags(cmd *cobra.Command, auditorReference *string, allowUnknownScheme *bool) {
+	cmd.Flags().StringVarP(auditorReference, "auditor-reference", "", "",
+		fmt.Sprintf("Reference of the auditor, scheme:identifier (e.g., 'github:<username>' or 'custom:<issuer-name>')."+
+			" Known schemes are %s", strings.Join(issuer.KnownSchemes(), ", ")))
+	cmd.Flags().BoolVarP(allowUnknownScheme, "allow-unknown-scheme", "", false,
+		"Sign with an --auditor-reference whose scheme is not known, e.g. one of a trust source of the verifying side")
+}
+
+// addSignerFlag registers the --signer flag shared by commands that sign manifests
+func addSignerFlag(cmd *cobra.Command, signerName *string) {
+	cmd.Flags().StringVarP(signerName, "signer", "", "",
+		fmt.Sprintf("Signer backend, one of %v. 'agent' uses the ssh-agent at SSH_AUTH_SOCK"+
+			" and accepts a public key path, fingerprint or comment as --private-key."+
+			" Defaults to trying 'yubikey' and then 'file'", signing.RegisteredSigners()))
+	_ = cmd.RegisterFlagCompletionFunc("signer", completeValues(signing.RegisteredSigners()...))
+}
+
+// lockTree locks the tree rooted at dir against other runs writing manifests, see lock.Acquire.
+// Stale locks are only taken over with forceUnlock.
+func lockTree(dir, command string, forceUnlock bool) (*lock.Lock, error) {
+	treeLock, err := lock.Acquire(dir, command, forceUnlock)
+	var held *lock.HeldError
+	if errors.Is(err, lock.ErrLocked) && (!errors.As(err, &held) || held.Stale) {
+		return nil, fmt.Errorf("%w; use --force-unlock to take it over", err)
+	}
+	return treeLock, err
+}
+
+// addAgentFlags registers the --use-agent and --key-fingerprint flags shared by commands that sign manifests
+func addAgentFlags(cmd *cobra.Command, useAgent *bool, keyFingerprint *string) {
+	cmd.Flags().BoolVarP(useAgent, "use-agent", "", false,
+		"Sign with the ed25519 key loaded in the ssh-agent at SSH_AUTH_SOCK, like --signer agent."+
+			" Also used when --auditor-reference is given without --private-key")
+	cmd.Flags().StringVarP(keyFingerprint, "key-fingerprint", "", "",
+		"SHA256 fingerprint or comment of the ssh-agent key to sign with, required when the agent holds several")
+}
+
+// addPassphraseFileFlag registers the --passphrase-file flag shared by commands that sign manifests
+func addPassphraseFileFlag(cmd *cobra.Command, passphraseFile *string) {
+	cmd.Flags().StringVarP(passphraseFile, "passphrase-file", "", "",
+		"File whose first line is the passphrase of an encrypted --private-key."+
+			" Falls back to "+signing.PassphraseEnvVar+", then to a prompt when stdin is a terminal")
+}
+
+// addFreshnessIntervalFlag registers --freshness-interval and its deprecated alias --freshness-duration
+func addFreshnessIntervalFlag(cmd *cobra.Command, freshnessInterval *time.Duration, usage string) {
+	cmd.Flags().DurationVarP(freshnessInterval, "freshness-interval", "", 0, usage)
+	cmd.Flags().DurationVarP(freshnessInterval, "freshness-duration", "", 0, usage)
+	_ = cmd.Flags().MarkDeprecated("freshness-duration", "use --freshness-interval instead")
+}
+
+// validateFreshnessInterval rejects negative intervals, 0 disables reusing manifests
+func validateFreshnessInterval(freshnessInterval time.Duration) error {
+	if freshnessInterval < 0 {
+		return fmt.Errorf("invalid --freshness-interval %s: must not be negative, use 0 to disable reusing manifests",
+			freshnessInterval)
+	}
+	return nil
+}
+
+// addScopeFlags registers --max-depth, --only, --one-file-system and --skip-long-paths, which must be used the same
+// way by generate and verify
+func addScopeFlags(cmd *cobra.Command, maxDepth *int, only *[]string, oneFileSystem, skipLongPaths *bool) {
+	cmd.Flags().IntVarP(maxDepth, "max-depth", "", -1,
+		"Leave out directories more than this many levels below the root, as if they did not exist."+
+			" 0 processes only the root, -1 means unlimited")
+	cmd.Flags().StringArrayVarP(only, "only", "", nil,
+		"Process only subdirectories matching this path or glob, relative to the root (e.g., 'apps/web', 'logs/2024-*')."+
+			" Their parent directories are processed too, other directories keep their manifests. Can be repeated")
+	_ = cmd.RegisterFlagCompletionFunc("only", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	})
+	cmd.Flags().BoolVarP(oneFileSystem, "one-file-system", "", false,
+		"Leave out subdirectories on another file system than the root, e.g. mounted network shares."+
+			" Parent manifests record them as mountpoints. Has no effect on Windows")
+	cmd.Flags().BoolVarP(skipLongPaths, "skip-long-paths", "", false,
+		"Leave out directories whose path, or the path of their manifest, exceeds the limit of the OS instead of failing."+
+			" Each one is logged and their number is reported")
+}
+
+// addCertValidityFlag registers the --cert-validity flag shared by commands that sign manifests
+func addCertValidityFlag(cmd *cobra.Command, certValidity *time.Duration) {
+	cmd.Flags().DurationVarP(certValidity, "cert-validity", "", 0,
+		"How long the certificate of the key signing this run stays valid (e.g., 720h), verify rejects"+
+			" signatures made with an expired one. 0 (default) means it never expires")
+}
+
+// validateCertValidity rejects a negative --cert-validity
+func validateCertValidity(certValidity time.Duration) error {
+	if certValidity < 0 {
+		return fmt.Errorf("invalid --cert-validity %s: must not be negative", certValidity)
+	}
+	return nil
+}
+
+// addSSHCertificateFlag registers the --ssh-certificate flag shared by commands that sign manifests
+func addSSHCertificateFlag(cmd *cobra.Command, sshCertificate *string) {
+	cmd.Flags().StringVarP(sshCertificate, "ssh-certificate", "", "",
+		"SSH user certificate of the signing key (e.g., ~/.ssh/id_ed25519-cert.pub) recorded in every signature,"+
+			" for auditor references verified by an SSH certificate authority ('sshca:<principal>')")
+}
+
+// addSpecialFilesFlag registers --special-files, which must be used the same way by generate and verify
+func addSpecialFilesFlag(cmd *cobra.Command, specialFiles *string) {
+	cmd.Flags().StringVarP(specialFiles, "special-files", "", string(scanner.SpecialFilesRecord),
+		"How sockets, FIFOs and device nodes are handled, they are never read: 'record' lists them with"+
+			" a checksum of their type and name, 'skip' leaves them out")
+	_ = cmd.RegisterFlagCompletionFunc("special-files",
+		completeValues(string(scanner.SpecialFilesRecord), string(scanner.SpecialFilesSkip)))
+}
+
+// addHiddenFlag registers --hidden, which must be used the same way by generate and verify
+func addHiddenFlag(cmd *cobra.Command, hidden *string) {
+	cmd.Flags().StringVarP(hidden, "hidden", "", string(scanner.HiddenInclude),
+		"How files and directories whose name starts with a dot are handled: 'include' lists them like any other,"+
+			" 'exclude' leaves them out, 'warn' lists them and verify tells their differences apart")
+	_ = cmd.RegisterFlagCompletionFunc("hidden",
+		completeValues(string(scanner.HiddenInclude), string(scanner.HiddenExclude), string(scanner.HiddenWarn)))
+}
+
+// addLimitBandwidthFlag registers the --limit-bandwidth flag shared by commands that hash files
+func addLimitBandwidthFlag(cmd *cobra.Command, limitBandwidth *string) {
+	cmd.Flags().StringVarP(limitBandwidth, "limit-bandwidth", "", "",
+		"Limit the disk read bandwidth used for hashing, per second (e.g., 500KB, 50MB, 1GB)")
+}
+
+// addMetricsListenFlag registers the --metrics-listen and --metrics-linger flags shared by commands that scan trees
+func addMetricsListenFlag(cmd *cobra.Command, metricsListen *string, metricsLinger *time.Duration) {
+	cmd.Flags().StringVarP(metricsListen, "metrics-listen", "", "",
+		"Serve progress and outcome metrics in the Prometheus format at /metrics on this address"+
+			" (e.g., :9090) while the command runs")
+	cmd.Flags().DurationVarP(metricsLinger, "metrics-linger", "", 30*time.Second,
+		"With --metrics-listen, how long to keep serving the metrics once the command is done,"+
+			" until they are scraped once more")
+}
+
+// addColorFlag registers the --color flag shared by commands that print colored output
+func addColorFlag(cmd *cobra.Command, color *string) {
+	cmd.Flags().StringVarP(color, "color", "", string(ui.ColorAuto),
+		"When to color output: 'always', 'never' or 'auto', which colors output to a terminal unless NO_COLOR is set")
+	_ = cmd.RegisterFlagCompletionFunc("color",
+		completeValues(string(ui.ColorAlways), string(ui.ColorNever), string(ui.ColorAuto)))
+}
+
+// addManifestNameFlag registers the --manifest-name flag shared by generate and verify
+func addManifestNameFlag(cmd *cobra.Command, manifestName *string) {
+	cmd.Flags().StringVarP(manifestName, "manifest-name", "", manifest.DefaultName,
+		"Name of the manifest file in every directory, the same name must be used to generate and verify a tree")
+}
+
+// validateManifestName rejects names that are not plain file names
+func validateManifestName(manifestName string) error {
+	if manifestName == "" || manifestName == "." || manifestName == ".." || strings.ContainsAny(manifestName, `/\`) {
+		return fmt.Errorf("invalid --manifest-name '%s': must be a file name without a directory", manifestName)
+	}
+	return nil
+}
+
+// colorOutput wraps w with the palette selected by the value of the --color flag
+func colorOutput(w io.Writer, color string) (*ui.Output, error) {
+	mode, err := ui.ParseColorMode(color)
+	if err != nil {
+		return nil, err
+	}
+	return ui.NewOutput(w, mode), nil
+}
+
+// startMetrics returns an exporter fed with the progress of a run, serving it on addr unless addr is empty
+func startMetrics(addr string) (*metrics.Exporter, error) {
+	exporter := metrics.New()
+	if addr == "" {
+		return exporter, nil
+	}
+	if err := exporter.Listen(addr); err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+// parseBandwidth converts sizes like '50MB' or '1.5GB/s' into bytes per second using 1024-based
+// units, as printed by the progress line. An empty value means unlimited.
+func parseBandwidth(value string) (int64, error) {
+	n, err := parseSize(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid --limit-bandwidth, expected a positive size like 50MB")
+	}
+	return n, nil
+}
+
+// parseSize parses a positive size like 512K, 50MB or 1.5GB in binary units, 0 for an empty value
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40}, {"K", 1 << 10}, {"M", 1 << 20},
+		{"G", 1 << 30}, {"T", 1 << 40}, {"B", 1}}
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSuffix(value, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	// NaN fails every comparison, Inf and sizes rounding down to no byte are rejected by the bounds
+	size := number * multiplier
+	if err != nil || !(size >= 1 && size < math.MaxInt64) {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return int64(size), nil
+}
+
 func NewGenerateCmd() *cobra.Command {
 	var freshnessInterval time.Duration
+	var freshnessMode string
+	var stateFile string
+	var trackPermissions bool
+	var trackXattrs bool
+	var trackHardlinks bool
+	var jsonOutput bool
+	var metricsListen string
+	var metricsLinger time.Duration
 	var privateKeyPath *string
-	var auditorReference *string
+	var auditorReference string
+	var allowUnknownScheme bool
+	var forceUnlock bool
+	var signerName string
+	var useAgent bool
+	var keyFingerprint string
+	var passphraseFile string
+	var limitBandwidth string
+	var maxDepth int
+	var only []string
+	var oneFileSystem bool
+	var skipLongPaths bool
+	var sshCertificate string
+	var certValidity time.Duration
+	var stripSignatures bool
+	var signRootOnly bool
+	var labelPairs []string
+	var labelRootOnly bool
+	var reproducible bool
+	var specialFiles string
+	var hidden string
+	var dryRun bool
+	var check bool
+	var stdinFileList bool
+	var dirsFrom string
+	var sampleFilesOver string
+	var chunkSize string
+	var recordFiletype bool
+	var color string
+	var manifestName string
+	var otel tracing
 	generateCmd := cobra.Command{
 		Use:   "generate [directory]",
 		Short: "Generate and write manifest files recursively",
@@ -39,49 +382,329 @@ func NewGenerateCmd() *cobra.Command {
 If no directory is provided, the current directory is used.
 
 The generate command can be optimized using the --freshness-interval flag to avoid
-recalculating directories where the manifest is newer than the freshness interval.`,
-		Args:         cobra.MaximumNArgs(1),
-		SilenceUsage: true,
-		RunE: func(cmd *cobra.Command, args []string) error {
+recalculating directories where the manifest is newer than the freshness interval.
+
+With --dry-run nothing is written: every manifest is compared with the existing one
+and the numbers of new, updated and unchanged manifests are printed, with --verbose
+also every directory and the changed entries. --check does the same and fails when
+any manifest is out of date.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: traced(&otel, func(cmd *cobra.Command, args []string) error {
 			targetDir := "."
 			if len(args) > 0 {
 				targetDir = args[0]
 			}
 
-			progressCh := make(chan *scanner.Stats, 10)
-			scannerOpts := []scanner.Option{scanner.WithProgressChannel(progressCh)}
-			if freshnessInterval > 0 {
-				scannerOpts = append(scannerOpts, scanner.WithManifestFreshnessLimit(freshnessInterval))
+			if err := validateFreshnessInterval(freshnessInterval); err != nil {
+				return err
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			if err := validateCertValidity(certValidity); err != nil {
+				return err
+			}
+			mode, err := scanner.ParseFreshnessMode(freshnessMode)
+			if err != nil {
+				return err
 			}
-			signer, err := loadCryptoSigner(privateKeyPath, auditorReference)
+			specialFilesPolicy, err := scanner.ParseSpecialFilesPolicy(specialFiles)
 			if err != nil {
 				return err
 			}
-			sc := scanner.New(scannerOpts...)
-			gen := generator.New(sc, signer)
+			hiddenPolicy, err := scanner.ParseHiddenPolicy(hidden)
+			if err != nil {
+				return err
+			}
+			maxBytesPerSecond, err := parseBandwidth(limitBandwidth)
+			if err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			sampleThreshold, err := parseSize(sampleFilesOver)
+			if err != nil {
+				return fmt.Errorf("invalid --sample-files-over, expected a positive size like 1GB")
+			}
+			chunkBytes, err := parseSize(chunkSize)
+			if err != nil {
+				return fmt.Errorf("invalid --chunk-size, expected a positive size like 64MB")
+			}
+			labels, err := manifest.ParseLabels(labelPairs)
+			if err != nil {
+				return fmt.Errorf("invalid --label: %w", err)
+			}
+			if labelRootOnly && labels == nil {
+				return fmt.Errorf("--label-root-only requires --label")
+			}
+			dryRun = dryRun || check
+			if dryRun && jsonOutput {
+				return fmt.Errorf("--dry-run and --check cannot be combined with --json")
+			}
+			listed := stdinFileList || dirsFrom != ""
+			var dirPaths []string
+			if listed {
+				if stdinFileList && dirsFrom != "" {
+					return fmt.Errorf("--stdin-file-list and --dirs-from cannot be combined")
+				}
+				if dryRun || jsonOutput || len(only) > 0 {
+					return fmt.Errorf("--stdin-file-list and --dirs-from cannot be combined with --dry-run, --check, --json or --only")
+				}
+				if dirPaths, err = readDirectoryList(cmd.InOrStdin(), dirsFrom); err != nil {
+					return err
+				}
+			}
+			opts := []bytecheck.Option{
+				bytecheck.WithFreshness(freshnessInterval),
+				bytecheck.WithFreshnessMode(mode),
+				bytecheck.WithSpecialFiles(specialFilesPolicy),
+				bytecheck.WithHiddenPolicy(hiddenPolicy),
+				bytecheck.WithStateFile(stateFile),
+				bytecheck.WithTrackPermissions(trackPermissions),
+				bytecheck.WithXattrs(trackXattrs),
+				bytecheck.WithTrackHardlinks(trackHardlinks),
+				bytecheck.WithMaxBytesPerSecond(maxBytesPerSecond),
+				bytecheck.WithMaxDepth(maxDepth),
+				bytecheck.WithOneFileSystem(oneFileSystem),
+				bytecheck.WithSkipLongPaths(skipLongPaths),
+				bytecheck.WithOnly(only...),
+				bytecheck.WithSSHCertificate(sshCertificate),
+				bytecheck.WithCertValidity(certValidity),
+				bytecheck.WithStripSignatures(stripSignatures),
+				bytecheck.WithSignRootOnly(signRootOnly),
+				bytecheck.WithLabels(labels),
+				bytecheck.WithLabelRootOnly(labelRootOnly),
+				bytecheck.WithDryRun(dryRun),
+				bytecheck.WithManifestName(manifestName),
+				bytecheck.WithContentTypes(recordFiletype),
+			}
+			if sampleThreshold > 0 {
+				opts = append(opts, bytecheck.WithSampling(sampleThreshold))
+			}
+			if chunkBytes > 0 {
+				opts = append(opts, bytecheck.WithChunking(chunkBytes))
+			}
+			if reproducible {
+				if mode == scanner.FreshnessModeEmbedded {
+					return fmt.Errorf("--reproducible cannot be combined with --freshness-mode %s", mode)
+				}
+				epoch, err := sourceDateEpoch()
+				if err != nil {
+					return err
+				}
+				opts = append(opts, bytecheck.WithReproducible(epoch))
+			}
+			signer, err := loadCryptoSigner(signerName, privateKeyPath, &auditorReference, passphraseFile,
+				useAgent, keyFingerprint, allowUnknownScheme)
+			if err != nil {
+				return err
+			}
+			// A dry run writes nothing, so it cannot interleave with a run writing manifests
+			if !dryRun {
+				treeLock, err := lockTree(targetDir, "generate", forceUnlock)
+				if err != nil {
+					return err
+				}
+				defer treeLock.Release()
+			}
+			// Keep stdout clean for the JSON summary
+			progressOut := out
+			if jsonOutput {
+				progressOut = ui.NewOutput(cmd.ErrOrStderr(), ui.ColorMode(color))
+			}
+			exporter, err := startMetrics(metricsListen)
+			if err != nil {
+				return err
+			}
+			defer exporter.CloseAfterScrape(metricsLinger)
+			progress := scanner.NewProgressSource()
 			pm := ui.NewProgressMonitor(3 * time.Second)
-			pm.MonitorInBackground(cmd.Context(), cmd.OutOrStdout(), progressCh)
+			pm.MonitorSourceInBackground(cmd.Context(), progressOut, progress)
 
-			err = gen.Generate(cmd.Context(), targetDir)
-			close(progressCh)
+			opts = append(opts, otel.options()...)
+			opts = append(opts,
+				bytecheck.WithSigner(signer),
+				bytecheck.WithProgress(exporter.Update),
+				bytecheck.WithProgressSource(progress))
+			var report *bytecheck.GenerateReport
+			if listed {
+				report, err = bytecheck.RegenerateDirectories(cmd.Context(), targetDir, dirPaths, opts...)
+			} else {
+				report, err = bytecheck.GenerateTree(cmd.Context(), targetDir, opts...)
+			}
+			progress.Close()
 			pm.Wait()
 			if err != nil {
 				return err
 			}
+			otel.recordStats(report.Stats)
+			if listed {
+				if report.Directories > 0 {
+					pm.PrintFinalLine(out, report.Stats)
+				}
+				for _, skipped := range report.Skipped {
+					ui.PrintSkippedDirectory(out, skipped.Path, skipped.Reason)
+				}
+				ui.PrintRegenerateResult(out, report.Regenerated, report.AncestorsUpdated,
+					len(report.Skipped), report.RootDigest)
+				ui.PrintSignatureChanges(out, report.Signatures.Preserved, report.Signatures.Invalidated, report.Signatures.Stripped)
+				return nil
+			}
 
-			stats := gen.GetStats()
-			pm.PrintFinalLine(cmd.OutOrStdout(), stats.Stats)
-			ui.PrintWriteResult(cmd.OutOrStdout(), stats.DirsProcessed(), stats.CachedProcessed(), stats.ManifestsGenerated)
+			if jsonOutput {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				summary := ui.WriteSummary{
+					Directories:           report.Directories,
+					Cached:                report.Cached,
+					Vanished:              report.Vanished,
+					MountpointsSkipped:    report.Stats.MountpointsSkipped(),
+					DirectoriesTooLong:    report.Stats.DirectoriesTooLong(),
+					ManifestsGenerated:    report.ManifestsWritten,
+					RootDigest:            report.RootDigest,
+					Subtree:               report.Subtree,
+					SignaturesPreserved:   report.Signatures.Preserved,
+					SignaturesInvalidated: report.Signatures.Invalidated,
+					SignaturesStripped:    report.Signatures.Stripped,
+				}
+				if err := encoder.Encode(summary); err != nil {
+					return fmt.Errorf("failed to encode summary: %w", err)
+				}
+				return nil
+			}
+			pm.PrintFinalLine(out, report.Stats)
+			if dryRun {
+				// --verbose is the persistent flag of the root command, absent when generate runs on its own
+				verbose, _ := cmd.Flags().GetBool("verbose")
+				ui.PrintDryRunResult(out, report.DryRun, verbose)
+				return checkDryRun(report.DryRun, check)
+			}
+			ui.PrintWriteResult(out, report.Directories-report.Cached, report.Cached, report.Vanished, report.ManifestsWritten, report.RootDigest, report.Subtree)
+			if n := report.Stats.MountpointsSkipped(); n > 0 {
+				ui.PrintWarning(out, "%d mountpoint(s) on other file systems were left out", n)
+			}
+			if n := report.Stats.DirectoriesTooLong(); n > 0 {
+				ui.PrintWarning(out, "%d directory(s) were left out because their paths are too long", n)
+			}
+			ui.PrintSignatureChanges(out, report.Signatures.Preserved, report.Signatures.Invalidated, report.Signatures.Stripped)
 			return nil
-		},
+		}),
 	}
-	generateCmd.Flags().DurationVarP(&freshnessInterval, "freshness-interval", "", 0,
+	addFreshnessIntervalFlag(&generateCmd, &freshnessInterval,
 		"Generate will reuse recently generated manifests if they are not older than this interval,"+
-			" (e.g., 5s, 1m, 24h)")
+			" (e.g., 5s, 1m, 24h), 0 disables reusing")
+	generateCmd.Flags().StringVarP(&freshnessMode, "freshness-mode", "", string(scanner.FreshnessModeMtime),
+		"How manifest freshness is determined: 'mtime' uses the manifest file's modification time,"+
+			" 'embedded' uses the generation time and directory fingerprint stored in the manifest")
+	_ = generateCmd.RegisterFlagCompletionFunc("freshness-mode",
+		completeValues(string(scanner.FreshnessModeMtime), string(scanner.FreshnessModeEmbedded)))
+	generateCmd.Flags().StringVarP(&stateFile, "state-file", "", "",
+		"Path to a state file remembering checksums of unchanged files between runs (opt-in)")
+	generateCmd.Flags().BoolVarP(&trackPermissions, "track-permissions", "", false,
+		"Record file mode and, on Unix, owner (UID/GID) of every entry so verify reports permission changes")
+	generateCmd.Flags().BoolVarP(&trackXattrs, "xattrs", "", false,
+		"Record a digest of the extended attributes, including ACLs, of every entry so verify reports changes to them")
+	generateCmd.Flags().BoolVarP(&trackHardlinks, "track-hardlinks", "", false,
+		"Record which files are hard links of the same file so verify reports links broken since; links are hashed once either way")
+	addColorFlag(&generateCmd, &color)
+	addManifestNameFlag(&generateCmd, &manifestName)
+	generateCmd.Flags().BoolVarP(&jsonOutput, "json", "", false,
+		"Print the summary, including the root digest, as JSON")
 	privateKeyPath = generateCmd.Flags().StringP("private-key", "", "",
 		"Path to ed25519 private key")
-	auditorReference = generateCmd.Flags().StringP("auditor-reference", "", "",
-		"Reference of the auditor (e.g., 'github:<username>' or 'custom:<issuer-name>')."+
-			" Currently only 'github:' and 'custom:' schemes are supported.")
+	addAuditorReferenceFlags(&generateCmd, &auditorReference, &allowUnknownScheme)
+	addSignerFlag(&generateCmd, &signerName)
+	addAgentFlags(&generateCmd, &useAgent, &keyFingerprint)
+	addPassphraseFileFlag(&generateCmd, &passphraseFile)
+	addSSHCertificateFlag(&generateCmd, &sshCertificate)
+	addCertValidityFlag(&generateCmd, &certValidity)
+	generateCmd.Flags().BoolVarP(&forceUnlock, "force-unlock", "", false,
+		"Take over the lock of a run on the same tree whose process no longer exists, see "+lock.Name)
+	generateCmd.Flags().BoolVarP(&reproducible, "reproducible", "", false,
+		"Record the time given in seconds by SOURCE_DATE_EPOCH, which must be set, as signing time, so identical"+
+			" trees yield byte-identical manifests. When signing, the auditor sections still differ between runs."+
+			" Requires --freshness-mode mtime")
+	generateCmd.Flags().BoolVarP(&stripSignatures, "strip-signatures", "", false,
+		"Without a signing key, remove the signatures of existing manifests instead of keeping those"+
+			" of directories whose content did not change")
+	generateCmd.Flags().BoolVarP(&signRootOnly, "sign-root-only", "", false,
+		"Sign only the root manifest, which covers the subdirectories through the checksums of their manifests;"+
+			" verify reports their manifests as audited by inheritance")
+	generateCmd.Flags().StringArrayVarP(&labelPairs, "label", "", nil,
+		"Stamp a key=value label on the manifests, e.g. the pipeline or commit producing the tree;"+
+			" covered by the HMAC and signatures. Can be repeated")
+	generateCmd.Flags().BoolVarP(&labelRootOnly, "label-root-only", "", false,
+		"Stamp the labels of --label on the root manifest only")
+	addLimitBandwidthFlag(&generateCmd, &limitBandwidth)
+	addMetricsListenFlag(&generateCmd, &metricsListen, &metricsLinger)
+	addTracingFlags(&generateCmd, &otel)
+	addScopeFlags(&generateCmd, &maxDepth, &only, &oneFileSystem, &skipLongPaths)
+	addSpecialFilesFlag(&generateCmd, &specialFiles)
+	addHiddenFlag(&generateCmd, &hidden)
+	generateCmd.Flags().StringVarP(&sampleFilesOver, "sample-files-over", "", "",
+		"Also record a sample checksum, over the first and last 4MB and 16 blocks of 1MB in between, of files"+
+			" larger than this size (e.g., 1GB), which verify --sampled checks instead of reading them whole")
+	generateCmd.Flags().StringVarP(&chunkSize, "chunk-size", "", "",
+		"Also record the checksums of the chunks of this size (e.g., 64MB) of files larger than one chunk,"+
+			" so that verify reports which byte ranges of a changed file differ")
+	generateCmd.Flags().BoolVarP(&recordFiletype, "record-filetype", "", false,
+		"Also record the content type of files, classified by their first 512 bytes as they are hashed,"+
+			" so that verify tells what a changed file was and what it is now, e.g. zeroed by bit-rot")
+	generateCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false,
+		"Write nothing, report which manifests would be created, updated or left unchanged")
+	generateCmd.Flags().BoolVarP(&check, "check", "", false,
+		"Like --dry-run, but fail when any manifest would be created or updated, e.g. in CI")
+	generateCmd.Flags().BoolVarP(&stdinFileList, "stdin-file-list", "", false,
+		"Regenerate only the directories read from stdin, one path per line (e.g., from find or fd),"+
+			" and then their ancestors up to the root directory")
+	generateCmd.Flags().StringVarP(&dirsFrom, "dirs-from", "", "",
+		"Like --stdin-file-list, but read the directories from this file")
 	return &generateCmd
 }
+
+// readDirectoryList reads newline-separated directory paths from the file path, or from stdin when path is empty.
+// Empty lines are ignored.
+func readDirectoryList(stdin io.Reader, path string) ([]string, error) {
+	r := stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open directory list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var dirPaths []string
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		if line := strings.TrimSuffix(lines.Text(), "\r"); line != "" {
+			dirPaths = append(dirPaths, line)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read directory list: %w", err)
+	}
+	return dirPaths, nil
+}
+
+// checkDryRun returns an error when check is set and a dry run found manifests that are not up to date
+func checkDryRun(directories []generator.DryRunDirectory, check bool) error {
+	if !check {
+		return nil
+	}
+	outdated := 0
+	for _, dir := range directories {
+		if dir.Outcome != generator.DryRunUnchanged {
+			outdated++
+		}
+	}
+	if outdated > 0 {
+		return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed,
+			Err: fmt.Errorf("%d manifest(s) out of date, run generate to update them", outdated)}
+	}
+	return nil
+}
@@ -1,15 +1,30 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -107,7 +122,7 @@ func TestGenerateCmd_WithLongFreshnessLimitManifest(t *testing.T) {
 	assert.Contains(t, output, "processed 1 directory(s) (1 cached)")
 }
 
-func TestGenerateCmd_WithLongFreshnessLimitButCorruptedManifest(t *testing.T) {
+func TestGenerateCmd_WithLongFreshnessLimitButCorruptedManifest_mustReplaceIt(t *testing.T) {
 	tempDir := t.TempDir()
 
 	manifestPath := CreateFreshManifest(t, tempDir)
@@ -115,8 +130,31 @@ func TestGenerateCmd_WithLongFreshnessLimitButCorruptedManifest(t *testing.T) {
 	require.NoError(t, err)
 
 	cmd := NewGenerateCmd()
-	_, err = ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "1h"})
-	require.ErrorContains(t, err, "invalid HMAC")
+	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "1h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "processed 1 directory(s) (0 cached)")
+	m, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Empty(t, m.Entities)
+}
+
+func TestGenerateCmd_WithFileNamedLikeManifest_mustReplaceIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt":                            "a",
+		"restored/b.txt":                   "b",
+		"restored/" + manifest.DefaultName: "not a manifest, restored from an old backup",
+	})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--freshness-interval", "1h"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, "restored", manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Entities, 1)
+	assert.Equal(t, "b.txt", m.Entities[0].Name)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s)")
 }
 
 func TestGenerateCmd_ContextCancellation(t *testing.T) {
@@ -144,6 +182,28 @@ func TestGenerateCmd_ContextCancellation(t *testing.T) {
 	assert.Contains(t, err.Error(), "context deadline exceeded")
 }
 
+func TestGenerate_ContextCancellation_DuringLargeFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A sparse file is cheap to create but takes many seconds to hash
+	file, err := os.Create(filepath.Join(tempDir, "large.bin"))
+	require.NoError(t, err)
+	require.NoError(t, file.Truncate(64<<30))
+	require.NoError(t, file.Close())
+
+	gen := generator.New(scanner.New(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = gen.Generate(ctx, tempDir)
+	elapsed := time.Since(start)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, elapsed, time.Second)
+	assert.NoFileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+}
+
 func TestGenerateCmd_EmptyDirectory(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -283,6 +343,669 @@ func TestGenerateCmd_WithPrivateKeyAndIssuerReference_mustSignManifestWithAudito
 	manifestPath := filepath.Join(tempDir, ".bytecheck.manifest")
 	m, err := manifest.LoadManifest(manifestPath)
 	require.NoError(t, err)
-	assert.NotNil(t, m.Auditor)
-	assert.Equal(t, m.Auditor.Certificate.IssuerPublicKey, hex.EncodeToString(publicKey))
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, m.Auditors[0].Certificate.IssuerPublicKey, hex.EncodeToString(publicKey))
+}
+
+func TestGenerateCmd_WithMalformedIssuerReference_mustSuggestReference(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--private-key", keyPath,
+		"--auditor-reference", "github.com/alice"})
+	require.ErrorIs(t, err, issuer.ErrInvalidReference)
+	assert.ErrorContains(t, err, "did you mean github:alice?")
+	assert.NoFileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"), "nothing is signed with a malformed reference")
+}
+
+func TestGenerateCmd_WithIssuerReference_mustNormalizeScheme(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--private-key", keyPath,
+		"--auditor-reference", "GitHub:alice"})
+	require.NoError(t, err)
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, "github:alice", m.Auditors[0].Certificate.IssuerRef)
+}
+
+func TestGenerateCmd_WithUnknownScheme_mustRequireAllowUnknownScheme(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	args := []string{tempDir, "--private-key", keyPath, "--auditor-reference", "corp:alice"}
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), args)
+	require.ErrorIs(t, err, issuer.ErrUnknownScheme)
+	assert.ErrorContains(t, err, "--allow-unknown-scheme")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), append(args, "--allow-unknown-scheme"))
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, "corp:alice", m.Auditors[0].Certificate.IssuerRef)
+}
+
+func TestGenerateCmd_PrintsTreeTotals_AndVerifyShowsThem(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"file1.txt":              "content 1",
+		"subdir/nested/deep.txt": strings.Repeat("x", 2048),
+	})
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--json"})
+	require.NoError(t, err)
+	var summary ui.WriteSummary
+	require.NoError(t, json.Unmarshal([]byte(output), &summary))
+	assert.Equal(t, &manifest.SubtreeTotals{Files: 2, Directories: 2, Bytes: 2057}, summary.Subtree)
+
+	output, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "tree: 2 files, 2 directories, 2.0 KB\n")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "tree: 2 files, 2 directories, 2.0 KB\n")
+}
+
+func TestGenerateCmd_WithoutKeyOverSignedTree_mustPreserveSignatures(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"test.txt": "test content", "sub/a.txt": "a"})
+	keyPath := filepath.Join(tempDir, "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--private-key", keyPath, "--auditor-reference", "github:test-issuer"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "existing signatures: 2 preserved\n")
+	m, err := manifest.LoadManifest(filepath.Join(dataDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Len(t, m.Auditors, 1)
+
+	output, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--strip-signatures", "--json"})
+	require.NoError(t, err)
+	var summary ui.WriteSummary
+	require.NoError(t, json.Unmarshal([]byte(output), &summary))
+	assert.Equal(t, 2, summary.SignaturesStripped)
+	assert.Zero(t, summary.SignaturesPreserved)
+	m, err = manifest.LoadManifest(filepath.Join(dataDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, m.IsAudited())
+}
+
+func TestGenerateCmd_Reproducible_IdenticalTreesYieldIdenticalManifests(t *testing.T) {
+	files := map[string]string{"test.txt": "test content", "sub/a.txt": "a", "sub/deep/b.txt": "b"}
+	first := CreateSampleStructureFromMap(t, files)
+	second := CreateSampleStructureFromMap(t, files)
+	past := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, filepath.Walk(second, func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		return os.Chtimes(path, past, past)
+	}))
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{first, "--reproducible"})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{second, "--reproducible"})
+	require.NoError(t, err)
+
+	for _, dir := range []string{"", "sub", "sub/deep"} {
+		want, err := os.ReadFile(filepath.Join(first, dir, manifest.DefaultName))
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(second, dir, manifest.DefaultName))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), "manifest of '%s'", dir)
+		assert.True(t, strings.HasSuffix(string(got), "}\n"))
+	}
+}
+
+func TestGenerateCmd_Reproducible_RecordsSourceDateEpochAsSigningTime(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"test.txt": "test content"})
+	keyPath := filepath.Join(tempDir, "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--reproducible",
+		"--private-key", keyPath, "--auditor-reference", "github:test-issuer"})
+	require.NoError(t, err)
+
+	m, err := manifest.LoadManifest(filepath.Join(dataDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.True(t, time.Unix(1700000000, 0).Equal(m.Auditors[0].Timestamp))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir})
+	require.NoError(t, err)
+}
+
+func TestGenerateCmd_Reproducible_InvalidUsage_mustReturnError(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--reproducible", "--freshness-mode", "embedded"})
+	require.ErrorContains(t, err, "--reproducible cannot be combined with --freshness-mode embedded")
+
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--reproducible"})
+	require.ErrorContains(t, err, "--reproducible requires SOURCE_DATE_EPOCH to be set")
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--reproducible"})
+	require.ErrorContains(t, err, "invalid SOURCE_DATE_EPOCH 'yesterday'")
+}
+
+func TestGenerateCmd_PrintsRootDigest_AndVerifyChecksIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"file1.txt":              "content 1",
+		"subdir/nested/deep.txt": "deep content",
+	})
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--json"})
+	require.NoError(t, err)
+	var summary ui.WriteSummary
+	require.NoError(t, json.Unmarshal([]byte(output), &summary))
+	assert.Len(t, summary.RootDigest, 64)
+	assert.Equal(t, int64(3), summary.Directories)
+
+	output, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "root digest: "+summary.RootDigest)
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--expect-root-digest", summary.RootDigest})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--expect-root-digest", strings.Repeat("0", 64)})
+	assert.ErrorContains(t, err, "root digest mismatch")
+	// Digests are compared as the lowercase hex generate prints
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--expect-root-digest", strings.ToUpper(summary.RootDigest)})
+	assert.ErrorContains(t, err, "root digest mismatch")
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "subdir", "nested", "deep.txt"), []byte("changed"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--expect-root-digest", summary.RootDigest})
+	assert.ErrorContains(t, err, "cannot confirm root digest")
+
+	output, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	assert.NotContains(t, output, summary.RootDigest)
+}
+
+func TestGenerateCmd_ReadOnlyDirectory_mustFailWithOneClearError(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("Skipping permission test when running as root")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping this test on Windows")
+	}
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt":       "test content",
+		"subdir/sub.txt": "sub content",
+	})
+	require.NoError(t, os.Chmod(tempDir, 0555))
+	defer os.Chmod(tempDir, 0755) // Restore permissions for cleanup
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.ErrorContains(t, err, "is read-only")
+	assert.NoFileExists(t, filepath.Join(tempDir, "subdir", ".bytecheck.manifest"))
+}
+
+func TestGenerateCmd_WithDeprecatedFreshnessDurationAlias(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	CreateFreshManifest(t, tempDir)
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--freshness-duration", "1h"})
+	require.NoError(t, err)
+
+	assert.Contains(t, output, "processed 1 directory(s) (1 cached)")
+	assert.Equal(t, 1, strings.Count(output, "use --freshness-interval instead"))
+}
+
+func TestGenerateCmd_WithNegativeFreshnessInterval_mustReturnError(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--freshness-interval", "-1h"})
+	require.ErrorContains(t, err, "must not be negative")
+	assert.NoFileExists(t, filepath.Join(tempDir, ".bytecheck.manifest"))
+}
+
+func TestGenerateCmd_WithZeroFreshnessInterval_mustRegenerateManifest(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	CreateFreshManifest(t, tempDir)
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--freshness-interval", "0"})
+	require.NoError(t, err)
+
+	assert.Contains(t, output, "processed 1 directory(s) (0 cached)")
+}
+
+func TestParseBandwidth(t *testing.T) {
+	valid := map[string]int64{
+		"":         0,
+		"1024":     1024,
+		"500KB":    500 * 1024,
+		"50MB":     50 * 1024 * 1024,
+		"50mb/s":   50 * 1024 * 1024,
+		"1.5G":     1536 * 1024 * 1024,
+		" 2 MB ":   2 * 1024 * 1024,
+		"100B":     100,
+		"1TB":      1 << 40,
+		"0.5MB/s":  512 * 1024,
+		"128K/s":   128 * 1024,
+		"3GB":      3 << 30,
+		"10 KB/s":  10 * 1024,
+		"7.25KB":   7424,
+		"1048576B": 1024 * 1024,
+	}
+	for value, expected := range valid {
+		actual, err := parseBandwidth(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, actual, value)
+	}
+	for _, value := range []string{"fast", "-5MB", "0", "MB", "5XB", "Inf", "+InfMB", "NaN", "nanKB", "0.1B",
+		"-0", "1e30TB"} {
+		_, err := parseBandwidth(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestGenerateCmd_WithInvalidLimitBandwidth_mustReturnError(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--limit-bandwidth", "fast"})
+	require.ErrorContains(t, err, "invalid --limit-bandwidth")
+}
+
+func TestGenerateCmd_WithEncryptedPrivateKeyAndPassphraseFile_mustSignManifest(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	keysDir := t.TempDir()
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("secret"))
+	require.NoError(t, err)
+	keyPath := filepath.Join(keysDir, "encrypted.key")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+	passphraseFile := filepath.Join(keysDir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("secret\n"), 0600))
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--private-key", keyPath,
+		"--auditor-reference", "custom:test", "--signer", signing.SignerFile, "--passphrase-file", passphraseFile})
+	require.NoError(t, err)
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, hex.EncodeToString(privateKey.Public().(ed25519.PublicKey)), m.Auditors[0].Certificate.IssuerPublicKey)
+}
+
+func TestGenerateCmd_WithOnly_mustUpdateParentManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":         "root",
+		"apps/web/s/s.txt": "s",
+		"apps/api/a.txt":   "a",
+		"docs/d.txt":       "d",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	docsManifest, err := os.ReadFile(filepath.Join(tempDir, "docs", manifest.DefaultName))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "apps", "web", "s", "s.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "docs", "d.txt"), []byte("changed"), 0644))
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--only", "apps/web", "--json"})
+	require.NoError(t, err)
+	var summary ui.WriteSummary
+	require.NoError(t, json.Unmarshal([]byte(output), &summary))
+	assert.Equal(t, []string{
+		filepath.Join(tempDir, "apps", "web", "s"),
+		filepath.Join(tempDir, "apps", "web"),
+		filepath.Join(tempDir, "apps"),
+		tempDir,
+	}, summary.ManifestsGenerated)
+
+	// docs was left alone, so verifying only the regenerated subtree succeeds and a full verify flags docs
+	unchanged, err := os.ReadFile(filepath.Join(tempDir, "docs", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Equal(t, docsManifest, unchanged)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--only", "apps/web"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 4 manifest(s) (0 shallow)")
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "docs fail")
+	assert.NotContains(t, output, "apps")
+}
+
+func TestGenerateCmd_WithOnlyMatchingNothing_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"apps/web/w.txt": "w"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--only", "apps/wbe"})
+	assert.EqualError(t, err, "pattern 'apps/wbe' does not match any directory")
+}
+
+func TestGenerateCmd_WithMaxDepth(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":        "root",
+		"a/a.txt":         "a",
+		"a/deep/deep.txt": "deep",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--max-depth", "1"})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(tempDir, "a", manifest.DefaultName))
+	assert.NoFileExists(t, filepath.Join(tempDir, "a", "deep", manifest.DefaultName))
+
+	// Changes below the cutoff are not tracked
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a", "deep", "deep.txt"), []byte("changed"), 0644))
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--max-depth", "1"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s) (0 shallow)")
+
+	// Verifying with a different depth does not match the manifests
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.ErrorContains(t, err, "not found")
+}
+
+// manifestSnapshot returns the content and modification time of every manifest below dir
+func manifestSnapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	snapshot := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.Name() != manifest.DefaultName {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		snapshot[path] = info.ModTime().String() + "\n" + string(data)
+		return nil
+	})
+	require.NoError(t, err)
+	return snapshot
+}
+
+func TestGenerateCmd_WithDryRun_mustWriteNothing(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/x.txt": "x", "b/y.txt": "y"})
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--dry-run"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "dry run: 3 new, 0 updated, 0 unchanged manifest(s), nothing written")
+	assert.Empty(t, manifestSnapshot(t, tempDir))
+}
+
+func TestGenerateCmd_WithDryRunVerbose_mustReportChangesWithoutWriting(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/x.txt": "x", "b/y.txt": "y"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a", "x.txt"), []byte("changed"), 0644))
+	before := manifestSnapshot(t, tempDir)
+
+	output, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"generate", tempDir, "--dry-run", "--verbose", "--color", "always"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "updated manifest:"+ui.ColorReset+" "+filepath.Join(tempDir, "a"))
+	assert.Contains(t, output, "checksum mismatch:"+ui.ColorReset+" x.txt")
+	assert.Contains(t, output, "updated manifest:"+ui.ColorReset+" "+tempDir)
+	assert.Contains(t, output, "= unchanged manifest: "+filepath.Join(tempDir, "b"))
+	assert.Contains(t, output, "dry run: 0 new, 2 updated, 1 unchanged manifest(s), nothing written")
+	assert.Equal(t, before, manifestSnapshot(t, tempDir))
+}
+
+func TestGenerateCmd_WithCheck_mustFailWhenManifestsAreOutOfDate(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/x.txt": "x", "b/y.txt": "y"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--check"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "dry run: 0 new, 0 updated, 3 unchanged manifest(s)")
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "b", "z.txt"), []byte("z"), 0644))
+	before := manifestSnapshot(t, tempDir)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--check"})
+	assert.EqualError(t, err, "2 manifest(s) out of date, run generate to update them")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Equal(t, before, manifestSnapshot(t, tempDir))
+}
+
+func TestGenerateCmd_WithDryRunAndJSON_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--dry-run", "--json"})
+	assert.EqualError(t, err, "--dry-run and --check cannot be combined with --json")
+}
+
+func TestGenerateCmd_WithStdinFileList_RegeneratesListedDirectoriesAndAncestors(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt": "root", "a/x.txt": "x", "a/deep/y.txt": "y", "b/z.txt": "z",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	for _, name := range []string{"a/x.txt", "a/deep/y.txt", "b/z.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(tempDir, name), []byte("changed"), 0644))
+	}
+
+	list := strings.Join([]string{
+		filepath.Join(tempDir, "a"),
+		filepath.Join(tempDir, "b") + "\r",
+		"",
+		filepath.Join(tempDir, "..", "outside"),
+		filepath.Join(tempDir, "a"),
+		filepath.Join(tempDir, "missing"),
+		filepath.Join(tempDir, "root.txt"),
+	}, "\n")
+	cmd := NewGenerateCmd()
+	cmd.SetIn(bytes.NewBufferString(list))
+	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--stdin-file-list"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "'"+filepath.Join(tempDir, "..", "outside")+"': outside of "+tempDir+"\n")
+	assert.Contains(t, output, "'"+filepath.Join(tempDir, "a")+"': duplicate\n")
+	assert.Contains(t, output, "'"+filepath.Join(tempDir, "missing")+"': does not exist\n")
+	assert.Contains(t, output, "'"+filepath.Join(tempDir, "root.txt")+"': not a directory\n")
+	assert.Contains(t, output, "manifest '"+filepath.Join(tempDir, "a")+"' regenerated\n")
+	assert.Contains(t, output, "manifest '"+tempDir+"' updated as ancestor\n")
+	assert.Contains(t, output, "regenerated 2 directory(s), updated 1 ancestor manifest(s), skipped 4 path(s)\n")
+
+	// Subdirectories of listed directories are not rescanned
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "a/deep fail")
+	assert.Contains(t, output, "3/4 manifests valid")
+}
+
+func TestGenerateCmd_WithDirsFrom_KeepsTreeConsistent(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"a/x.txt": "x", "b/z.txt": "z"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "b", "z.txt"), []byte("changed"), 0644))
+	listPath := filepath.Join(tempDir, "dirs.txt")
+	require.NoError(t, os.WriteFile(listPath, []byte(filepath.Join(dataDir, "b")+"\n"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--dirs-from", listPath})
+	require.NoError(t, err)
+	assert.Contains(t, output, "regenerated 1 directory(s), updated 1 ancestor manifest(s), skipped 0 path(s)\n")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 3 manifest(s)")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--dirs-from", listPath, "--json"})
+	assert.ErrorContains(t, err, "cannot be combined with --dry-run, --check, --json or --only")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--dirs-from", listPath, "--stdin-file-list"})
+	assert.ErrorContains(t, err, "--stdin-file-list and --dirs-from cannot be combined")
+}
+
+func TestGenerateCmd_WithoutPrivateKey_mustUseNoSigner(t *testing.T) {
+	empty := ""
+	signer, err := loadCryptoSigner("", &empty, &empty, "", false, "", false)
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, m.IsAudited())
+}
+
+func TestGenerateCmd_WithUseAgent_mustSignWithAgentKey(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	StartTestAgent(t, agent.AddedKey{PrivateKey: privateKey, Comment: "me@example"})
+
+	for _, args := range [][]string{
+		{"--use-agent", "--auditor-reference", "custom:test"},
+		// The agent is discovered when no private key is given
+		{"--auditor-reference", "custom:test"},
+	} {
+		tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+		_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), append([]string{tempDir}, args...))
+		require.NoError(t, err, args)
+
+		m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+		require.NoError(t, err)
+		require.Len(t, m.Auditors, 1)
+		assert.Equal(t, hex.EncodeToString(publicKey), m.Auditors[0].Certificate.IssuerPublicKey)
+		assert.Equal(t, "custom:test", m.Auditors[0].Certificate.IssuerRef)
+	}
+}
+
+func TestGenerateCmd_WithUseAgent_WithSeveralKeys_mustRequireKeyFingerprint(t *testing.T) {
+	_, firstKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	secondPublicKey, secondKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	StartTestAgent(t, agent.AddedKey{PrivateKey: firstKey, Comment: "first"},
+		agent.AddedKey{PrivateKey: secondKey, Comment: "second"})
+	sshPublicKey, err := ssh.NewPublicKey(secondPublicKey)
+	require.NoError(t, err)
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--use-agent", "--auditor-reference", "custom:test"})
+	assert.ErrorContains(t, err, "ssh-agent holds 2 ed25519 or sk-ssh-ed25519 keys, select one of: ")
+	assert.ErrorContains(t, err, ssh.FingerprintSHA256(sshPublicKey)+" (second)")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--use-agent",
+		"--auditor-reference", "custom:test", "--key-fingerprint", ssh.FingerprintSHA256(sshPublicKey)})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(secondPublicKey), m.Auditors[0].Certificate.IssuerPublicKey)
+}
+
+func TestGenerateCmd_WithUseAgent_WithoutSuitableAgent_mustFailClearly(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--use-agent", "--auditor-reference", "custom:test"})
+	assert.ErrorContains(t, err, "SSH_AUTH_SOCK is not set, is ssh-agent running?")
+
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--auditor-reference", "custom:test"})
+	assert.ErrorContains(t, err, "failed to connect to ssh-agent")
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	StartTestAgent(t, agent.AddedKey{PrivateKey: ecdsaKey})
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--use-agent", "--auditor-reference", "custom:test"})
+	assert.ErrorContains(t, err, "no ed25519 or sk-ssh-ed25519 key found in ssh-agent (1 other key(s) loaded)")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--use-agent", "--signer", signing.SignerFile,
+		"--auditor-reference", "custom:test"})
+	assert.EqualError(t, err, "--use-agent cannot be combined with --signer file")
+}
+
+func TestGenerateCmd_WithLockedTree_mustFailFast(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+	held, err := lock.Acquire(tempDir, "generate", false)
+	require.NoError(t, err)
+	defer held.Release()
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--force-unlock"})
+
+	assert.ErrorContains(t, err, fmt.Sprintf("another bytecheck generate (pid %d, started 0s ago) is running on this tree", os.Getpid()))
+	assert.NoFileExists(t, filepath.Join(tempDir, manifest.DefaultName))
+	// A dry run writes nothing, it does not need the lock
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--dry-run"})
+	assert.NoError(t, err)
+}
+
+func TestGenerateCmd_WithStaleLock_mustTakeOverWithForceUnlock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stale locks are not detected on Windows")
+	}
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content"})
+	exited := exec.Command("true")
+	require.NoError(t, exited.Run())
+	lockPath := filepath.Join(tempDir, lock.Name)
+	require.NoError(t, os.WriteFile(lockPath,
+		[]byte(fmt.Sprintf(`{"pid":%d,"command":"generate","startedAt":"2020-01-01T00:00:00Z"}`, exited.Process.Pid)), 0644))
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	assert.ErrorContains(t, err, "no longer exists")
+	assert.ErrorContains(t, err, "use --force-unlock to take it over")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--force-unlock"})
+	require.NoError(t, err)
+	assert.NoFileExists(t, lockPath)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Len(t, m.Entities, 1)
+}
+
+func TestGenerateCmd_WithLabels_mustStampManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(),
+		[]string{tempDir, "--label", "pipeline=ci-42", "--label", "git.commit=0123abc"})
+	require.NoError(t, err)
+	for _, dir := range []string{tempDir, filepath.Join(tempDir, "sub")} {
+		m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"pipeline": "ci-42", "git.commit": "0123abc"}, m.Labels)
+	}
+
+	// Changed labels are reported by --check although the entries are the same
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--check", "--label", "pipeline=ci-43"})
+	assert.EqualError(t, err, "2 manifest(s) out of date, run generate to update them")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label", "pipeline=ci-43", "--label-root-only"})
+	require.NoError(t, err)
+	root, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"pipeline": "ci-43"}, root.Labels)
+	sub, err := manifest.LoadManifest(filepath.Join(tempDir, "sub", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Nil(t, sub.Labels)
+}
+
+func TestGenerateCmd_WithInvalidLabels_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label", "a=1", "--label", "a=2"})
+	assert.EqualError(t, err, "invalid --label: duplicate label key 'a'")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label", "no value"})
+	assert.ErrorContains(t, err, "expected key=value")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label-root-only"})
+	assert.EqualError(t, err, "--label-root-only requires --label")
+	assert.Equal(t, ExitRuntimeError, ExitCode(err))
 }
@@ -0,0 +1,48 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func TestVerifyCmd_WithTrackHardlinks_mustReportBrokenLink(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/data.bin": "shared content", "b/own.txt": "own"})
+	require.NoError(t, os.Link(filepath.Join(tempDir, "a", "data.bin"), filepath.Join(tempDir, "b", "data.bin")))
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{"--track-hardlinks", tempDir})
+	require.NoError(t, err)
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "verified 3 manifest(s)")
+
+	// A copy with the same content is no longer a link of the file
+	linkPath := filepath.Join(tempDir, "b", "data.bin")
+	require.NoError(t, os.Remove(linkPath))
+	require.NoError(t, os.WriteFile(linkPath, []byte("shared content"), 0644))
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "hard link broken:"+ui.ColorReset+" data.bin is no longer linked to "+filepath.Join("a", "data.bin"))
+	assert.NotContains(t, output, "checksum mismatch")
+}
+
+func TestVerifyCmd_WithoutTrackHardlinks_mustIgnoreBrokenLink(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/data.bin": "shared content"})
+	require.NoError(t, os.Link(filepath.Join(tempDir, "a", "data.bin"), filepath.Join(tempDir, "a", "link.bin")))
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	linkPath := filepath.Join(tempDir, "a", "link.bin")
+	require.NoError(t, os.Remove(linkPath))
+	require.NoError(t, os.WriteFile(linkPath, []byte("shared content"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err, output)
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"io"
+	"os"
+	"strings"
+)
+
+func NewHashCommand() *cobra.Command {
+	var checkFile string
+	hashCmd := cobra.Command{
+		Use:   "hash <file>...",
+		Short: "Print or check checksums of individual files",
+		Long: `Print SHA-256 checksums of individual files, as manifests record them for regular files,
+one "<checksum>  <path>" line per file, in the format of sha256sum.
+
+With --check, read such lines from a file ('-' for standard input) and verify each entry.
+Checksums are compared as the lowercase hex sha256sum prints.
+The command exits with an error when any file does not match or cannot be read,
+or when the list holds no properly formatted line.`,
+		SilenceUsage: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if checkFile == "" && len(args) == 0 {
+				return fmt.Errorf("requires at least 1 file or --check")
+			}
+			if checkFile != "" && len(args) > 0 {
+				return fmt.Errorf("files cannot be combined with --check")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if checkFile != "" {
+				return checkChecksums(cmd, checkFile)
+			}
+			for _, path := range args {
+				checksum, err := scanner.FileChecksum(cmd.Context(), path)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s  %s\n", checksum, path)
+			}
+			return nil
+		},
+	}
+	hashCmd.Flags().StringVarP(&checkFile, "check", "c", "",
+		"Read checksums in sha256sum format from this file and verify them")
+	return &hashCmd
+}
+
+// checkChecksums verifies every "<checksum>  <path>" line of listPath, like sha256sum --check
+func checkChecksums(cmd *cobra.Command, listPath string) error {
+	var list io.Reader = cmd.InOrStdin()
+	if listPath != "-" {
+		file, err := os.Open(listPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		list = file
+	}
+
+	var checked, failed, malformed int
+	lines := bufio.NewScanner(list)
+	for lines.Scan() {
+		line := lines.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		expected, path, ok := strings.Cut(line, " ")
+		// sha256sum separates with two spaces, or with " *" in binary mode
+		path = strings.TrimPrefix(strings.TrimPrefix(path, " "), "*")
+		if !ok || path == "" || len(expected) != 64 {
+			malformed++
+			continue
+		}
+		// Plain output keeps scripts written for sha256sum working
+		checked++
+		checksum, err := scanner.FileChecksum(cmd.Context(), path)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: FAILED open or read\n", path)
+		case !manifest.SecureEqualHex(checksum, expected):
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: FAILED\n", path)
+		default:
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: OK\n", path)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", listPath, err)
+	}
+	if err := cmd.Context().Err(); err != nil {
+		return err
+	}
+	if checked == 0 {
+		return fmt.Errorf("no properly formatted checksum lines found in %s", listPath)
+	}
+	if malformed > 0 {
+		ui.PrintWarning(ui.NewOutput(cmd.ErrOrStderr(), ui.ColorAuto), "%d line(s) are improperly formatted", malformed)
+	}
+	if failed > 0 {
+		return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed,
+			Err: fmt.Errorf("%d computed checksum(s) did NOT match", failed)}
+	}
+	return nil
+}
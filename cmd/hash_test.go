@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashCmd_mustPrintSha256sumCompatibleLines(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	fileA, fileB := filepath.Join(tempDir, "a.txt"), filepath.Join(tempDir, "sub", "b.txt")
+
+	output, err := ExecuteCommandWithCapture(t, NewHashCommand(), []string{fileA, fileB})
+	require.NoError(t, err)
+	expected := fmt.Sprintf("%x  %s\n%x  %s\n", sha256.Sum256([]byte("a")), fileA, sha256.Sum256([]byte("b")), fileB)
+	assert.Equal(t, expected, output)
+}
+
+func TestHashCmd_WithCheck_mustReportEveryEntryAndFailOnMismatch(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	fileA, fileB := filepath.Join(tempDir, "a.txt"), filepath.Join(tempDir, "b.txt")
+	listPath := filepath.Join(t.TempDir(), "SHA256SUMS")
+
+	output, err := ExecuteCommandWithCapture(t, NewHashCommand(), []string{fileA, fileB})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(listPath, []byte(output), 0644))
+
+	output, err = ExecuteCommandWithCapture(t, NewHashCommand(), []string{"--check", listPath})
+	require.NoError(t, err)
+	assert.Contains(t, output, fileA+": OK")
+	assert.Contains(t, output, fileB+": OK")
+
+	require.NoError(t, os.WriteFile(fileB, []byte("changed"), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewHashCommand(), []string{"--check", listPath})
+	require.ErrorContains(t, err, "1 computed checksum(s) did NOT match")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, fileA+": OK")
+	assert.Contains(t, output, fileB+": FAILED")
+}
+
+func TestHashCmd_WithCheckOfUpperCasedChecksum_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+	fileA := filepath.Join(tempDir, "a.txt")
+	listPath := filepath.Join(t.TempDir(), "SHA256SUMS")
+	line := fmt.Sprintf("%X  %s\n", sha256.Sum256([]byte("a")), fileA)
+	require.NoError(t, os.WriteFile(listPath, []byte(line), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewHashCommand(), []string{"--check", listPath})
+
+	require.ErrorContains(t, err, "1 computed checksum(s) did NOT match")
+	assert.Contains(t, output, fileA+": FAILED")
+}
+
+func TestHashCmd_WithCheckOfMalformedLinesOnly_mustFail(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "SHA256SUMS")
+	require.NoError(t, os.WriteFile(listPath, []byte("not a checksum line\nabc  file.txt\n"), 0644))
+
+	_, err := ExecuteCommandWithCapture(t, NewHashCommand(), []string{"--check", listPath})
+
+	require.ErrorContains(t, err, "no properly formatted checksum lines found")
+	assert.Equal(t, ExitRuntimeError, ExitCode(err))
+}
+
+func TestHashCmd_WithoutFiles_mustReturnError(t *testing.T) {
+	_, err := ExecuteCommandWithCapture(t, NewHashCommand(), []string{})
+	assert.Error(t, err)
+}
@@ -2,11 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"golang.org/x/crypto/ssh/agent"
 	"io"
 	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -218,3 +225,102 @@ func CreateSampleStructureFromMapInDir(t *testing.T, baseDir string, files map[s
 		require.NoError(t, err)
 	}
 }
+
+// softwareSKSigner mimics a YubiKey (sk-ssh-ed25519) signer without hardware.
+// It produces SSHSIG-wrapped FIDO2 signatures in the same format as `ssh-keygen -Y sign`.
+type softwareSKSigner struct {
+	privKey   ed25519.PrivateKey
+	reference string
+}
+
+func newSoftwareSKSigner(t *testing.T, reference string) *softwareSKSigner {
+	t.Helper()
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return &softwareSKSigner{privKey: privKey, reference: reference}
+}
+
+func (s *softwareSKSigner) Sign(data []byte) ([]byte, error) {
+	writeBytes := func(buf *bytes.Buffer, b []byte) {
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(b)))
+		buf.Write(b)
+	}
+	dataHash := sha512.Sum512(data)
+	payload := new(bytes.Buffer)
+	payload.WriteString("SSHSIG")
+	writeBytes(payload, []byte("file"))
+	writeBytes(payload, []byte(""))
+	writeBytes(payload, []byte("sha512"))
+	writeBytes(payload, dataHash[:])
+
+	flags, counter := byte(0x01), uint32(42)
+	appHash := sha256.Sum256([]byte("ssh:"))
+	payloadHash := sha256.Sum256(payload.Bytes())
+	message := new(bytes.Buffer)
+	message.Write(appHash[:])
+	message.WriteByte(flags)
+	_ = binary.Write(message, binary.BigEndian, counter)
+	message.Write(payloadHash[:])
+
+	skSig := new(bytes.Buffer)
+	writeBytes(skSig, []byte("sk-ssh-ed25519@openssh.com"))
+	writeBytes(skSig, ed25519.Sign(s.privKey, message.Bytes()))
+	skSig.WriteByte(flags)
+	_ = binary.Write(skSig, binary.BigEndian, counter)
+
+	pubKeyBlob := new(bytes.Buffer)
+	writeBytes(pubKeyBlob, []byte("sk-ssh-ed25519@openssh.com"))
+	writeBytes(pubKeyBlob, s.privKey.Public().(ed25519.PublicKey))
+	writeBytes(pubKeyBlob, []byte("ssh:"))
+
+	sig := new(bytes.Buffer)
+	sig.WriteString("SSHSIG")
+	_ = binary.Write(sig, binary.BigEndian, uint32(1))
+	writeBytes(sig, pubKeyBlob.Bytes())
+	writeBytes(sig, []byte("file"))
+	writeBytes(sig, []byte(""))
+	writeBytes(sig, []byte("sha512"))
+	writeBytes(sig, skSig.Bytes())
+	return sig.Bytes(), nil
+}
+
+func (s *softwareSKSigner) Algorithm() string { return signing.SignatureAlgorithmSKEd25519 }
+
+func (s *softwareSKSigner) PublicKey() (ed25519.PublicKey, error) {
+	return s.privKey.Public().(ed25519.PublicKey), nil
+}
+
+func (s *softwareSKSigner) Reference() string { return s.reference }
+
+func (s *softwareSKSigner) Close() error { return nil }
+
+// StartTestAgent serves an in-process ssh-agent holding keys on a unix socket in a temp dir and points
+// SSH_AUTH_SOCK at it for the duration of the test
+func StartTestAgent(t *testing.T, keys ...agent.AddedKey) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir with long test names
+	dir, err := os.MkdirTemp("", "agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	keyring := agent.NewKeyring()
+	for _, key := range keys {
+		require.NoError(t, keyring.Add(key))
+	}
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", socket)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+func NewKeygenCommand() *cobra.Command {
+	var outPath string
+	var comment string
+	var encrypt bool
+	var passphraseFile string
+	keygenCmd := cobra.Command{
+		Use:   "keygen --out <path>",
+		Short: "Generate an ed25519 key pair for signing manifests",
+		Long: `Generate an ed25519 key pair usable with generate --private-key, in the OpenSSH format.
+The private key is written to the --out path and the public key to the same path with a .pub suffix,
+ready to be published, e.g. on GitHub for 'github:<username>' auditors.
+Existing files are never overwritten.
+
+With --encrypt, the private key is encrypted with a passphrase read from --passphrase-file,
+the ` + signing.PassphraseEnvVar + ` environment variable or a prompt when stdin is a terminal.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publicKeyPath := outPath + ".pub"
+			// Checked before asking for a passphrase, the files are created exclusively regardless
+			for _, path := range []string{outPath, publicKeyPath} {
+				if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("%s already exists, refusing to overwrite it", path)
+				}
+			}
+			var passphrase []byte
+			if encrypt {
+				var err error
+				if passphrase, err = signing.DefaultPassphrase(passphraseFile)(); err != nil {
+					return err
+				}
+				if len(passphrase) == 0 {
+					return fmt.Errorf("--encrypt requires a non-empty passphrase")
+				}
+			}
+			privateKey, _, err := signing.GenerateEncryptedKeyPair(outPath, publicKeyPath, comment, passphrase)
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("refusing to overwrite an existing key: %w", err)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "private key: %s\npublic key: %s\n", outPath, publicKeyPath)
+			return printFingerprints(cmd, privateKey.Public().(ed25519.PublicKey))
+		},
+	}
+	keygenCmd.Flags().StringVarP(&outPath, "out", "o", "", "Path of the private key, the public key gets a .pub suffix")
+	_ = keygenCmd.MarkFlagRequired("out")
+	keygenCmd.Flags().StringVarP(&comment, "comment", "C", "", "Comment recorded with the keys, e.g. an email address")
+	keygenCmd.Flags().BoolVarP(&encrypt, "encrypt", "", false, "Encrypt the private key with a passphrase")
+	keygenCmd.Flags().StringVarP(&passphraseFile, "passphrase-file", "", "",
+		"File whose first line is the passphrase used by --encrypt."+
+			" Falls back to "+signing.PassphraseEnvVar+", then to a prompt when stdin is a terminal")
+	return &keygenCmd
+}
+
+func NewKeyCommand() *cobra.Command {
+	keyCmd := cobra.Command{
+		Use:   "key",
+		Short: "Inspect signing keys",
+	}
+	keyCmd.AddCommand(newKeyFingerprintCommand())
+	return &keyCmd
+}
+
+func newKeyFingerprintCommand() *cobra.Command {
+	var passphraseFile string
+	fingerprintCmd := cobra.Command{
+		Use:   "fingerprint <public-or-private-key>",
+		Short: "Print the fingerprints of a key as they appear in manifests",
+		Long: `Print the fingerprints of an ed25519 public or private key: the SHA256 fingerprint shown by
+ssh-keygen -l and by GitHub, the hex public key recorded as issuerPublicKey in the certificate of
+manifests signed with the key, and the SHA-256 fingerprint verify reports, e.g. for keys differing
+from a pinned one.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			publicKey, err := readPublicKey(args[0], passphraseFile)
+			if err != nil {
+				return err
+			}
+			return printFingerprints(cmd, publicKey)
+		},
+	}
+	fingerprintCmd.Flags().StringVarP(&passphraseFile, "passphrase-file", "", "",
+		"File whose first line is the passphrase of an encrypted private key."+
+			" Falls back to "+signing.PassphraseEnvVar+", then to a prompt when stdin is a terminal")
+	return &fingerprintCmd
+}
+
+// readPublicKey reads the ed25519 public key stored in path, either as a public key or as a private key
+func readPublicKey(path string, passphraseFile string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	reader := signing.NewEd25519KeyReaderWithPassphrase("", signing.DefaultPassphrase(passphraseFile))
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+		return reader.ReadPublicKeyFromBytes(data)
+	}
+	privateKey, err := reader.ReadKeyFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return privateKey.Public().(ed25519.PublicKey), nil
+}
+
+// printFingerprints prints the fingerprints of publicKey, one "<name>: <value>" line each
+func printFingerprints(cmd *cobra.Command, publicKey ed25519.PublicKey) error {
+	fingerprints, err := signing.Fingerprints(publicKey)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "fingerprint: %s\nissuer public key: %s\nkey fingerprint: %s\n",
+		fingerprints.SSH, fingerprints.PublicKey, issuer.Fingerprint(publicKey))
+	return nil
+}
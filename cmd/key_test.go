@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// fingerprintLine returns the value of the "<name>: <value>" line of output
+func fingerprintLine(t *testing.T, output, name string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(line, name+": "); ok {
+			return value
+		}
+	}
+	t.Fatalf("no %q line in output %q", name, output)
+	return ""
+}
+
+func TestKeygenCmd_WithEncrypt_mustWriteEncryptedKey(t *testing.T) {
+	keysDir := t.TempDir()
+	keyPath := filepath.Join(keysDir, "signing")
+	passphraseFile := filepath.Join(keysDir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("secret\n"), 0600))
+
+	output, err := ExecuteCommandWithCapture(t, NewKeygenCommand(),
+		[]string{"--out", keyPath, "--comment", "alice@example.com", "--encrypt", "--passphrase-file", passphraseFile})
+	require.NoError(t, err)
+	assert.Contains(t, output, "public key: "+keyPath+".pub")
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(publicKey), " alice@example.com\n"))
+
+	// The private and the public key yield the fingerprints keygen printed
+	fromPrivate, err := ExecuteCommandWithCapture(t, NewKeyCommand(),
+		[]string{"fingerprint", keyPath, "--passphrase-file", passphraseFile})
+	require.NoError(t, err)
+	fromPublic, err := ExecuteCommandWithCapture(t, NewKeyCommand(), []string{"fingerprint", keyPath + ".pub"})
+	require.NoError(t, err)
+	for _, name := range []string{"fingerprint", "issuer public key", "key fingerprint"} {
+		assert.Equal(t, fingerprintLine(t, output, name), fingerprintLine(t, fromPrivate, name), name)
+		assert.Equal(t, fingerprintLine(t, output, name), fingerprintLine(t, fromPublic, name), name)
+	}
+	assert.True(t, strings.HasPrefix(fingerprintLine(t, output, "fingerprint"), "SHA256:"))
+}
+
+func TestKeyFingerprintCmd_WithWrongPassphrase_mustFail(t *testing.T) {
+	keysDir := t.TempDir()
+	keyPath := filepath.Join(keysDir, "signing")
+	_, _, err := signing.GenerateEncryptedKeyPair(keyPath, keyPath+".pub", "", []byte("secret"))
+	require.NoError(t, err)
+	passphraseFile := filepath.Join(keysDir, "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("wrong\n"), 0600))
+
+	_, err = ExecuteCommandWithCapture(t, NewKeyCommand(), []string{"fingerprint", keyPath, "--passphrase-file", passphraseFile})
+
+	require.ErrorContains(t, err, "failed to parse SSH private key")
+}
+
+func TestKeygenCmd_WithExistingKey_mustNotOverwrite(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "signing")
+	require.NoError(t, os.WriteFile(keyPath+".pub", []byte("existing"), 0644))
+
+	_, err := ExecuteCommandWithCapture(t, NewKeygenCommand(), []string{"--out", keyPath})
+
+	require.ErrorContains(t, err, "already exists")
+	data, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(data))
+}
+
+func TestKeyFingerprintCmd_mustMatchSignedManifest(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	keyPath := filepath.Join(t.TempDir(), "signing")
+	_, err := ExecuteCommandWithCapture(t, NewKeygenCommand(), []string{"--out", keyPath})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--private-key", keyPath,
+		"--auditor-reference", "custom:test", "--signer", signing.SignerFile})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewKeyCommand(), []string{"fingerprint", keyPath + ".pub"})
+
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, m.Auditors[0].Certificate.IssuerPublicKey, fingerprintLine(t, output, "issuer public key"))
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/remote"
+	"os"
+)
+
+// openRemoteStore opens the store given by --remote, authenticating with the token of remote.TokenEnvVar
+func openRemoteStore(remoteURL string) (remote.Store, error) {
+	return remote.Open(remoteURL, remote.WithBearerToken(os.Getenv(remote.TokenEnvVar)))
+}
+
+func NewPushCommand() *cobra.Command {
+	var remoteURL string
+	var treeID string
+	var manifestName string
+	pushCmd := cobra.Command{
+		Use:   "push --remote <url> --tree-id <id> [directory]",
+		Short: "Upload the manifests of a tree to a remote store",
+		Long: `Upload the manifests of a tree to a remote store, so that verify --remote can check
+copies of the tree on other machines against them instead of trusting their local manifests.
+If no directory is provided, the current directory is used.
+
+Manifests are stored below the tree identifier, at the path of their directory, e.g.
+<url>/<tree-id>/apps/web/.bytecheck.manifest. The remote is an http(s) URL accepting PUT
+and GET requests, like WebDAV servers or S3-compatible object stores, or a local directory.
+The bearer token of HTTP requests is read from the ` + remote.TokenEnvVar + ` environment variable.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			if err := remote.ValidateTreeID(treeID); err != nil {
+				return err
+			}
+			store, err := openRemoteStore(remoteURL)
+			if err != nil {
+				return err
+			}
+			keys, err := remote.Push(cmd.Context(), store, treeID, targetDir, manifestName)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, key := range keys {
+				fmt.Fprintf(out, "manifest '%s' pushed\n", key)
+			}
+			fmt.Fprintf(out, "pushed %d manifest(s) to %s\n", len(keys), remoteURL)
+			return nil
+		},
+	}
+	pushCmd.Flags().StringVarP(&remoteURL, "remote", "", "", "URL or directory of the remote store")
+	_ = pushCmd.MarkFlagRequired("remote")
+	pushCmd.Flags().StringVarP(&treeID, "tree-id", "", "",
+		"Identifier of the tree in the remote store (e.g., 'datasets/images-2024')")
+	_ = pushCmd.MarkFlagRequired("tree-id")
+	addManifestNameFlag(&pushCmd, &manifestName)
+	return &pushCmd
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/remote"
+)
+
+// newRegistryServer serves an in-memory object store requiring the bearer token "secret"
+func newRegistryServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPushCmd_ThenVerifyWithRemote_mustUseRemoteManifests(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	server := newRegistryServer(t)
+	t.Setenv(remote.TokenEnvVar, "secret")
+	remoteArgs := []string{"--remote", server.URL, "--tree-id", "datasets/sample"}
+
+	output, err := ExecuteCommandWithCapture(t, NewPushCommand(), append([]string{tempDir}, remoteArgs...))
+	require.NoError(t, err)
+	assert.Contains(t, output, "manifest 'datasets/sample/sub/.bytecheck.manifest' pushed\n")
+	assert.Contains(t, output, "pushed 2 manifest(s) to "+server.URL+"\n")
+
+	// The local manifests are not needed
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "sub", manifest.DefaultName)))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), append([]string{tempDir}, remoteArgs...))
+	require.NoError(t, err, output)
+
+	// Nor trusted: regenerating them after a change does not hide it
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("changed"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), append([]string{tempDir}, remoteArgs...))
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "b.txt")
+}
+
+func TestPushCmd_WithInvalidRemoteArguments_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+	server := newRegistryServer(t)
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--remote", server.URL})
+	assert.EqualError(t, err, "--remote and --tree-id must be used together")
+
+	_, err = ExecuteCommandWithCapture(t, NewPushCommand(), []string{tempDir, "--remote", server.URL, "--tree-id", "a/../b"})
+	assert.EqualError(t, err, "invalid tree identifier 'a/../b': name must not be '..'")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	t.Setenv(remote.TokenEnvVar, "wrong")
+	_, err = ExecuteCommandWithCapture(t, NewPushCommand(), []string{tempDir, "--remote", server.URL, "--tree-id", "tree"})
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func NewRepairCommand() *cobra.Command {
+	var dryRun bool
+	var forceUnlock bool
+	var signerName string
+	var passphraseFile string
+	var useAgent bool
+	var keyFingerprint string
+	var color string
+	var manifestName string
+	var privateKeyPath *string
+	var auditorReference string
+	var allowUnknownScheme bool
+	var stripSignatures bool
+	repairCmd := cobra.Command{
+		Use:   "repair [directory]",
+		Short: "Regenerate the manifests of directories failing verification",
+		Long: `Verify the tree rooted at the specified directory, or the current one, and regenerate
+only the manifests that are invalid, corrupt or missing, together with the manifests of their
+ancestors, which record the new checksums. The repaired tree is then verified again.
+
+Manifests are signed when a key is given, like with generate. Without a key, repair refuses to
+regenerate signed manifests, which would lose their signatures, unless --strip-signatures is given.
+The regenerated ancestors include the root, whose signature covers the whole tree. Use --dry-run to
+list the manifests that would be written without writing any.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			opts := []bytecheck.Option{
+				bytecheck.WithManifestName(manifestName),
+				bytecheck.WithDryRun(dryRun),
+				bytecheck.WithStripSignatures(stripSignatures),
+			}
+			if !dryRun {
+				signer, err := loadCryptoSigner(signerName, privateKeyPath, &auditorReference, passphraseFile,
+					useAgent, keyFingerprint, allowUnknownScheme)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, bytecheck.WithSigner(signer))
+				treeLock, err := lockTree(targetDir, "repair", forceUnlock)
+				if err != nil {
+					return err
+				}
+				defer treeLock.Release()
+			}
+
+			report, err := bytecheck.RepairTree(cmd.Context(), targetDir, opts...)
+			if err != nil {
+				return err
+			}
+			if report.After == nil {
+				ui.PrintRepairResult(out, report.Before.Result, nil, report.Repaired, report.AncestorsUpdated, dryRun)
+				return nil
+			}
+			after := report.After.Result
+			ui.PrintRepairResult(out, report.Before.Result, after, report.Repaired, report.AncestorsUpdated, dryRun)
+			if summary := after.Summary(); summary.Invalid+summary.Unmanaged > 0 {
+				return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed, Result: after,
+					Err: fmt.Errorf("%d manifest(s) still fail verification after the repair",
+						summary.Invalid+summary.Unmanaged)}
+			}
+			return nil
+		},
+	}
+	repairCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false,
+		"List the manifests that would be regenerated without writing any")
+	repairCmd.Flags().BoolVarP(&forceUnlock, "force-unlock", "", false,
+		"Take over the lock of a run on the same tree whose process no longer exists, see "+lock.Name)
+	repairCmd.Flags().BoolVarP(&stripSignatures, "strip-signatures", "", false,
+		"Without a signing key, regenerate signed manifests anyway, removing their signatures")
+	privateKeyPath = repairCmd.Flags().StringP("private-key", "", "",
+		"Path to ed25519 private key")
+	addAuditorReferenceFlags(&repairCmd, &auditorReference, &allowUnknownScheme)
+	addSignerFlag(&repairCmd, &signerName)
+	addAgentFlags(&repairCmd, &useAgent, &keyFingerprint)
+	addPassphraseFileFlag(&repairCmd, &passphraseFile)
+	addColorFlag(&repairCmd, &color)
+	addManifestNameFlag(&repairCmd, &manifestName)
+	return &repairCmd
+}
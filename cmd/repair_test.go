@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// createDamagedTree generates a tree and then changes a file of a/b, corrupts the manifest of c and removes the one
+// of d. The root manifest no longer matches either, it records the checksums of the manifests of c and d.
+func createDamagedTree(t *testing.T) string {
+	dir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt": "root", "a/a.txt": "a", "a/b/b.txt": "b", "c/c.txt": "c", "d/d.txt": "d", "e/e.txt": "e",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "b", "b.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c", ".bytecheck.manifest"), []byte("{corrupt"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "d", ".bytecheck.manifest")))
+	return dir
+}
+
+func TestRepairCmd_mustRegenerateFailingDirectoriesAndAncestors(t *testing.T) {
+	dir := createDamagedTree(t)
+	untouched, err := os.ReadFile(filepath.Join(dir, "e", ".bytecheck.manifest"))
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewRepairCommand(), []string{dir})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "a", "b")+"' repaired")
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "c")+"' repaired")
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "d")+"' repaired")
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "a")+"' updated as ancestor")
+	assert.Contains(t, output, "manifest '"+dir+"' repaired")
+	assert.Contains(t, output, "before: 3 invalid and 1 missing manifest(s) in 6 directory(s)")
+	assert.Contains(t, output, "repaired 4 directory(s), updated 1 ancestor manifest(s)")
+	assert.Contains(t, output, "ok - after: all 6 manifest(s) verified")
+
+	after, err := os.ReadFile(filepath.Join(dir, "e", ".bytecheck.manifest"))
+	require.NoError(t, err)
+	assert.Equal(t, untouched, after, "valid directories must not be rewritten")
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dir})
+	assert.NoError(t, err)
+}
+
+func TestRepairCmd_WithDryRun_mustWriteNothing(t *testing.T) {
+	dir := createDamagedTree(t)
+
+	output, err := ExecuteCommandWithCapture(t, NewRepairCommand(), []string{dir, "--dry-run"})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "c")+"' would be repaired")
+	assert.Contains(t, output, "manifest '"+filepath.Join(dir, "a")+"' would be updated as ancestor")
+	assert.Contains(t, output, "would repair 4 directory(s) and update 1 ancestor manifest(s)")
+	_, err = os.Stat(filepath.Join(dir, "d", ".bytecheck.manifest"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dir})
+	assert.Error(t, err)
+}
+
+func TestRepairCmd_WithValidTree_mustRepairNothing(t *testing.T) {
+	dir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewRepairCommand(), []string{dir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "before: 0 invalid and 0 missing manifest(s) in 2 directory(s)")
+	assert.Contains(t, output, "ok - nothing to repair")
+}
+
+func TestRepairCmd_WithSignedTreeAndNoKey_mustRefuseUnlessStripping(t *testing.T) {
+	dir := CreateSampleStructureFromMap(t, map[string]string{"root.txt": "root", "a/a.txt": "a"})
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dir,
+		"--private-key", keyPath, "--auditor-reference", "github:test-issuer"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "a.txt"), []byte("changed"), 0644))
+	signedRoot, err := os.ReadFile(filepath.Join(dir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewRepairCommand(), []string{dir})
+	require.ErrorIs(t, err, bytecheck.ErrSignaturesRemoved)
+	assert.ErrorContains(t, err, "would remove the signatures of 2 manifest(s), including the one of "+dir)
+	after, err := os.ReadFile(filepath.Join(dir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+	assert.Equal(t, signedRoot, after, "nothing must be written")
+
+	output, err := ExecuteCommandWithCapture(t, NewRepairCommand(), []string{dir, "--strip-signatures"})
+	require.NoError(t, err, output)
+	m, err := manifest.LoadManifest(filepath.Join(dir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+	assert.Empty(t, m.Auditors)
+}
@@ -2,39 +2,131 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
+	"github.com/tomekjarosik/bytecheck/pkg/version"
 )
 
 func InitializeCommands() *cobra.Command {
+	var verbose, quiet bool
 	var rootCmd = &cobra.Command{
 		Use:   "bytecheck",
 		Short: "A tool for generating and verifying manifest files",
 		Long: `Bytecheck is a command-line tool that helps you generate and verify manifest files recursively in your project directories.
 Each manifest file contains a list of checksums for files and directories in the directory.`,
-		Version: "0.2",
+		Version: version.String(),
+		// Execute prints the error once, before exiting with the code it derives from it
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if verbose && quiet {
+				return fmt.Errorf("--verbose and --quiet cannot be used together")
+			}
+			level := slog.LevelInfo
+			if verbose {
+				level = slog.LevelDebug
+			} else if quiet {
+				level = slog.LevelWarn
+			}
+			logging.SetLogger(slog.New(slog.NewTextHandler(cmd.ErrOrStderr(), &slog.HandlerOptions{Level: level})))
+			return applyConfig(cmd, args)
+		},
 	}
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log debug events, like every manifest written")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Log only warnings and errors")
 
 	rootCmd.AddCommand(NewGenerateCmd())
+	rootCmd.AddCommand(NewAttestCmd())
+	rootCmd.AddCommand(NewAttestBinaryCommand())
+	rootCmd.AddCommand(NewSignDigestCommand())
 	rootCmd.AddCommand(NewVerifyCommand())
+	rootCmd.AddCommand(NewVerifySubtreeCommand())
+	rootCmd.AddCommand(NewRepairCommand())
+	rootCmd.AddCommand(NewWatchCommand())
 	rootCmd.AddCommand(NewCleanCommand())
+	rootCmd.AddCommand(NewPushCommand())
+	rootCmd.AddCommand(NewDiffCommand())
+	rootCmd.AddCommand(NewDupesCommand())
+	rootCmd.AddCommand(NewHashCommand())
+	rootCmd.AddCommand(NewKeygenCommand())
+	rootCmd.AddCommand(NewKeyCommand())
+	rootCmd.AddCommand(NewConfigCommand())
 	rootCmd.AddCommand(NewCmdVersion())
-	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	// --version prints the same details as the version command
+	rootCmd.SetVersionTemplate(version.Details())
 
 	return rootCmd
 }
 
+// Exit codes of the commands, scripts can tell failed verifications from runs that could not complete
+const (
+	ExitOK = 0
+	// ExitVerificationFailed means the tree does not match its manifests, see bytecheck.ErrVerificationFailed
+	ExitVerificationFailed = 1
+	// ExitNoManifests means the tree, or one of its directories, has no manifest, see bytecheck.ErrNoManifests
+	ExitNoManifests = 2
+	// ExitTrustFailure means a signature is invalid or the auditors are not trusted, see bytecheck.ErrTrustFailure
+	ExitTrustFailure = 3
+	// ExitRuntimeError means the command could not run, e.g. because of an invalid flag or an unreadable file
+	ExitRuntimeError = 4
+)
+
+// exitCodeInterrupted is the exit code of commands stopped by an interrupt, as shells report for SIGINT
+const exitCodeInterrupted = 130
+
+// ExitError makes Execute exit with Code instead of the one ExitCode derives from Err
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of a command returning err
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	// The kind of a failed verification decides, not its cause, e.g. a missing manifest breaking a chain
+	var verificationErr *bytecheck.VerificationError
+	if errors.As(err, &verificationErr) {
+		err = verificationErr.Kind
+	}
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, bytecheck.ErrNoManifests):
+		return ExitNoManifests
+	case errors.Is(err, bytecheck.ErrTrustFailure):
+		return ExitTrustFailure
+	case errors.Is(err, bytecheck.ErrVerificationFailed):
+		return ExitVerificationFailed
+	default:
+		return ExitRuntimeError
+	}
+}
+
 func Execute(rootCmd *cobra.Command) {
-	rootCmd.Version = Version
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		cancel()
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
+		os.Exit(ExitCode(err))
 	}
 }
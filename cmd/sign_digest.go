@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// detachedSignerReference stands for the issuer reference signers require, detached signatures do not record it
+const detachedSignerReference = "custom:detached"
+
+func NewSignDigestCommand() *cobra.Command {
+	var privateKeyPath *string
+	var signerName string
+	var useAgent bool
+	var keyFingerprint string
+	var passphraseFile string
+	var manifestName string
+	var outPath string
+	signDigestCmd := cobra.Command{
+		Use:   "sign-digest [directory] --out <path>",
+		Short: "Sign the root digest of a tree into a detached SSH signature",
+		Long: `Sign the digest of the root manifest of a tree, as printed by generate, into a detached signature
+in the format of 'ssh-keygen -Y sign'. If no directory is provided, the current directory is used.
+
+The signature is checked by 'verify --detached-signature <path> --allowed-signers <file> --signer-identity <principal>',
+or by OpenSSH alone:
+  echo <digest> | ssh-keygen -Y verify -f <allowed_signers> -I <principal> -n ` + signing.DigestNamespace + ` -s <path>
+Manifests are neither verified nor modified.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if len(*privateKeyPath) == 0 && signerName == "" && !useAgent {
+				return fmt.Errorf("--private-key, --use-agent or --signer is required to sign the root digest")
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
+			}
+			issuerReference := detachedSignerReference
+			signer, err := loadCryptoSigner(signerName, privateKeyPath, &issuerReference, passphraseFile,
+				useAgent, keyFingerprint, false)
+			if err != nil {
+				return err
+			}
+			signature, digest, err := bytecheck.SignRootDigest(targetDir,
+				bytecheck.WithSigner(signer),
+				bytecheck.WithManifestName(manifestName))
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(outPath, signature, 0644); err != nil {
+				return fmt.Errorf("failed to write signature: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "root digest: %s\nsignature: %s\n", digest, outPath)
+			return nil
+		},
+	}
+	privateKeyPath = signDigestCmd.Flags().StringP("private-key", "", "",
+		"Path to ed25519 private key")
+	signDigestCmd.Flags().StringVarP(&outPath, "out", "o", "", "Path of the signature file")
+	_ = signDigestCmd.MarkFlagRequired("out")
+	addSignerFlag(&signDigestCmd, &signerName)
+	addAgentFlags(&signDigestCmd, &useAgent, &keyFingerprint)
+	addPassphraseFileFlag(&signDigestCmd, &passphraseFile)
+	addManifestNameFlag(&signDigestCmd, &manifestName)
+	return &signDigestCmd
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// writeAllowedSigners generates a key pair in dir and writes an allowed_signers file trusting it for principal
+func writeAllowedSigners(t *testing.T, dir, principal string) (keyPath, allowedSignersPath string) {
+	t.Helper()
+	keyPath = filepath.Join(dir, principal)
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	publicKey, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	allowedSignersPath = filepath.Join(dir, principal+".allowed_signers")
+	require.NoError(t, os.WriteFile(allowedSignersPath, append([]byte(principal+" "), publicKey...), 0644))
+	return keyPath, allowedSignersPath
+}
+
+func TestSignDigestCmd_mustBeVerifiedByVerify(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt":       "test content",
+		"subdir/sub.txt": "sub content",
+	})
+	keysDir := t.TempDir()
+	keyPath, allowedSignersPath := writeAllowedSigners(t, keysDir, "alice@example.com")
+	signaturePath := filepath.Join(keysDir, "tree.sig")
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	digest := regexp.MustCompile(`root digest: ([0-9a-f]+)`).FindStringSubmatch(output)
+	require.Len(t, digest, 2)
+
+	output, err = ExecuteCommandWithCapture(t, NewSignDigestCommand(), []string{tempDir,
+		"--private-key", keyPath, "--out", signaturePath})
+	require.NoError(t, err)
+	assert.Contains(t, output, "root digest: "+digest[1])
+	signature, err := os.ReadFile(signaturePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(signature), "-----BEGIN SSH SIGNATURE-----")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", signaturePath, "--allowed-signers", allowedSignersPath, "--signer-identity", "alice@example.com"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "detached signature by alice@example.com [valid]")
+
+	// The key is only trusted for the principals listed with it
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", signaturePath, "--allowed-signers", allowedSignersPath, "--signer-identity", "bob@example.com"})
+	assert.ErrorIs(t, err, signing.ErrSignerNotAllowed)
+	assert.ErrorContains(t, err, "no allowed signer for identity 'bob@example.com'")
+}
+
+func TestSignDigestCmd_WithOtherKeyOrChangedTree_mustFailVerify(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt": "test content",
+	})
+	keysDir := t.TempDir()
+	keyPath, allowedSignersPath := writeAllowedSigners(t, keysDir, "alice@example.com")
+	_, otherAllowedSignersPath := writeAllowedSigners(t, keysDir, "bob@example.com")
+	signaturePath := filepath.Join(keysDir, "tree.sig")
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewSignDigestCommand(), []string{tempDir,
+		"--private-key", keyPath, "--out", signaturePath})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", signaturePath, "--allowed-signers", otherAllowedSignersPath, "--signer-identity", "bob@example.com"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "detached signature rejected")
+	assert.ErrorIs(t, err, signing.ErrSignerNotAllowed)
+	assert.Contains(t, output, "detached signature [rejected")
+
+	// A regenerated tree has another root digest, the old signature does not sign it
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "test.txt"), []byte("changed"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", signaturePath, "--allowed-signers", allowedSignersPath, "--signer-identity", "alice@example.com"})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "is invalid")
+}
+
+func TestSignDigestCmd_InvalidFlags_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt": "test content",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	_, err = ExecuteCommandWithCapture(t, NewSignDigestCommand(), []string{tempDir, "--out", "sig"})
+	assert.ErrorContains(t, err, "--private-key, --use-agent or --signer is required")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--detached-signature", "sig"})
+	assert.ErrorContains(t, err, "must be given together")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", "sig", "--allowed-signers", "allowed", "--signer-identity", "alice", "--sampled"})
+	assert.ErrorContains(t, err, "cannot be combined with --sampled")
+
+	// Fresh manifests are not rehashed, the digest would vouch for directories nobody checked
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--detached-signature", "sig", "--allowed-signers", "allowed", "--signer-identity", "alice", "--freshness-interval", "1h"})
+	assert.ErrorContains(t, err, "--freshness-interval cannot be combined with --expect-root-digest or --detached-signature")
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir,
+		"--expect-root-digest", "00", "--freshness-interval", "1h"})
+	assert.ErrorContains(t, err, "--freshness-interval cannot be combined with --expect-root-digest or --detached-signature")
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func TestGenerateCmd_WithFIFO_mustCompleteWithoutReadingIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content", "state/data": "data"})
+	require.NoError(t, syscall.Mkfifo(filepath.Join(tempDir, "state", "control"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "processed 2 directory(s)")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s)")
+}
+
+func TestVerifyCmd_WithFileReplacedByFIFO_mustReportTypeMismatch(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content", "control": "not a pipe"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "control")))
+	require.NoError(t, syscall.Mkfifo(filepath.Join(tempDir, "control"), 0644))
+
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Contains(t, output, "type mismatch:"+ui.ColorReset+" control (expected file, got fifo)")
+
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--special-files", "skip"})
+	assert.Contains(t, output, "missing file:"+ui.ColorReset+" control")
+}
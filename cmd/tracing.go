@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry/opentelemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+// defaultDirSpanThreshold is the default of --otel-dir-threshold
+const defaultDirSpanThreshold = 100 * time.Millisecond
+
+// tracing holds the --otel flags of a command and the trace of its run, nil unless it is traced
+type tracing struct {
+	enabled      bool
+	dirThreshold time.Duration
+	run          *opentelemetry.Run
+}
+
+// addTracingFlags registers the --otel flags shared by commands that scan trees
+func addTracingFlags(cmd *cobra.Command, t *tracing) {
+	cmd.Flags().BoolVarP(&t.enabled, "otel", "", false,
+		"Export a trace of the run with OpenTelemetry over OTLP/HTTP to the endpoint of "+opentelemetry.EndpointEnv+
+			" (http://localhost:4318 by default), which enables it too. The root span continues the trace of "+
+			opentelemetry.TraceParentEnv+", if set")
+	cmd.Flags().DurationVarP(&t.dirThreshold, "otel-dir-threshold", "", defaultDirSpanThreshold,
+		"Report the directories taking at least this long as spans of the trace, 0 reports every directory")
+}
+
+// traced runs runE within the root span of a trace of the run of cmd when tracing is enabled, see
+// opentelemetry.Enabled. The span records the exit code and is marked as failed when runE fails.
+func traced(t *tracing, runE func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if !opentelemetry.Enabled(t.enabled) {
+			return runE(cmd, args)
+		}
+		exporter, err := opentelemetry.NewExporter(cmd.Context())
+		if err != nil {
+			return err
+		}
+		t.run = opentelemetry.Start(cmd.Context(), "bytecheck "+cmd.Name(), exporter)
+		cmd.SetContext(t.run.Context())
+		err = runE(cmd, args)
+		t.run.SetAttributes(telemetry.Int64("bytecheck.exit_code", int64(ExitCode(err))))
+		// A collector that cannot be reached must not fail the run
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if endErr := t.run.End(ctx, err); endErr != nil {
+			logging.Logger().Warn("trace not exported", "error", endErr)
+		}
+		return err
+	}
+}
+
+// options returns the options tracing a run with the trace of t, none when it is not traced
+func (t *tracing) options() []bytecheck.Option {
+	if t.run == nil {
+		return nil
+	}
+	return []bytecheck.Option{bytecheck.WithTracer(t.run.Tracer(), t.dirThreshold)}
+}
+
+// recordStats records the bytes hashed and the cache hits of a run on its root span
+func (t *tracing) recordStats(stats *scanner.Stats) {
+	if t.run == nil || stats == nil {
+		return
+	}
+	t.run.SetAttributes(
+		telemetry.Int64(telemetry.KeyBytesHashed, stats.BytesHashed()),
+		telemetry.Int64(telemetry.KeyBytesCovered, stats.BytesCovered()),
+		telemetry.Float64(telemetry.KeyCacheHitRatio, stats.CacheHitRatio()),
+		telemetry.Int64("bytecheck.files", stats.FilesProcessed()),
+		telemetry.Int64("bytecheck.directories", stats.DirsProcessed()))
+}
+
+// recordVerifyResult records the outcome of a verification on the root span of its run
+func (t *tracing) recordVerifyResult(result *verifier.Result) {
+	if t.run == nil {
+		return
+	}
+	t.recordStats(result.Stats)
+	outcome := telemetry.OutcomeValid
+	if result.HasFailures() {
+		outcome = telemetry.OutcomeInvalid
+	}
+	summary := result.Summary()
+	t.run.SetAttributes(telemetry.String(telemetry.KeyOutcome, outcome),
+		telemetry.Int64("bytecheck.manifests.valid", int64(summary.Verified)),
+		telemetry.Int64("bytecheck.manifests.invalid", int64(summary.Invalid)))
+}
@@ -1,18 +1,108 @@
 package cmd
 
 import (
-	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/remote"
 	"github.com/tomekjarosik/bytecheck/pkg/scanner"
 	"github.com/tomekjarosik/bytecheck/pkg/ui"
 	"github.com/tomekjarosik/bytecheck/pkg/verifier"
 )
 
+// newTrustVerifier returns the default trust verifier extended with the email and SSH CA schemes when configured
+func newTrustVerifier(emailKeysURL string, sshCAPath string) (issuer.Verifier, error) {
+	var extra []issuer.Verifier
+	if emailKeysURL != "" {
+		extra = append(extra, issuer.NewEmailIssuerVerifier(emailKeysURL))
+	}
+	if sshCAPath != "" {
+		sshCAVerifier, err := issuer.NewSSHCAVerifierFromFile(sshCAPath)
+		if err != nil {
+			return nil, err
+		}
+		extra = append(extra, sshCAVerifier)
+	}
+	return bytecheck.DefaultTrustVerifier(extra...), nil
+}
+
+// parseChangedSince returns the cutoff of --changed-since: an RFC 3339 timestamp, or a duration before now
+func parseChangedSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid --changed-since %s: must be positive", value)
+		}
+		return now.Add(-d), nil
+	}
+	cutoff, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --changed-since '%s': expected an RFC 3339 timestamp"+
+			" (e.g. 2024-05-01T00:00:00Z) or a duration (e.g. 24h)", value)
+	}
+	if cutoff.After(now) {
+		return time.Time{}, fmt.Errorf("invalid --changed-since %s: must not be in the future", value)
+	}
+	return cutoff, nil
+}
+
 func NewVerifyCommand() *cobra.Command {
 	var freshnessInterval time.Duration
+	var freshnessMode string
+	var refreshTimestamps bool
+	var stateFile string
+	var expectRootDigest string
+	var detachedSignature string
+	var allowedSigners string
+	var signerIdentity string
+	var limitBandwidth string
+	var archivePath string
+	var remoteURL string
+	var treeID string
+	var fullPaths bool
+	var maxClockSkew time.Duration
+	var certExpiryWarning time.Duration
+	var maxDepth int
+	var only []string
+	var oneFileSystem bool
+	var skipLongPaths bool
+	var trustRetries int
+	var trustConcurrency int
+	var trustPolicyFile string
+	var sampled bool
+	var chunked bool
+	var fast bool
+	var changedSince string
+	var allowMissingManifests bool
+	var requiredLabelPairs []string
+	var requireSingleAuditorRun bool
+	var requireSigned bool
+	var requireTrusted bool
+	var emailKeysURL string
+	var sshCAPath string
+	var trustAnchors string
+	var specialFiles string
+	var hidden string
+	var ignoreHiddenDiffs bool
+	var reportPath string
+	var badgePath string
+	var badgeSVGPath string
+	var metricsListen string
+	var metricsLinger time.Duration
+	var color string
+	var manifestName string
+	var useTUI bool
+	var otel tracing
 	verifyCmd := cobra.Command{
 		Use:   "verify [directory]",
 		Short: "Verify manifest files recursively",
@@ -20,43 +110,377 @@ func NewVerifyCommand() *cobra.Command {
 If no directory is provided, the current directory is used.
 
 This command checks that all manifest files are up-to-date and match
-the current state of the files in each directory.`,
-		Args:         cobra.MaximumNArgs(1),
-		SilenceUsage: true,
-		RunE: func(cmd *cobra.Command, args []string) error {
+the current state of the files in each directory.
+
+With --archive, the tree stored in a tar, tar.gz or zip archive is verified
+against the manifests inside it without extracting it.
+
+With --remote and --tree-id, the tree is verified against the manifests uploaded
+by push instead of the ones stored in it.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: traced(&otel, func(cmd *cobra.Command, args []string) (runErr error) {
 			targetDir := "."
 			if len(args) > 0 {
 				targetDir = args[0]
 			}
-			progressCh := make(chan *scanner.Stats, 10)
-			scannerOpts := []scanner.Option{scanner.WithProgressChannel(progressCh)}
-			if freshnessInterval > 0 {
-				scannerOpts = append(scannerOpts, scanner.WithManifestFreshnessLimit(freshnessInterval))
+			if err := validateFreshnessInterval(freshnessInterval); err != nil {
+				return err
+			}
+			if err := validateManifestName(manifestName); err != nil {
+				return err
 			}
-
-			sc := scanner.New(scannerOpts...)
-			manifestAuditor := verifier.NewSimpleManifestAuditor()
-			auditorVerifier := issuer.NewMultiSourceVerifier(
-				issuer.NewGitHubIssuerVerifier(),
-				issuer.NewCustomURLVerifier())
-			vr := verifier.New(sc, manifestAuditor, auditorVerifier)
-			pm := ui.NewProgressMonitor(3 * time.Second)
-			pm.MonitorInBackground(cmd.Context(), cmd.OutOrStdout(), progressCh)
-			result, err := vr.Verify(cmd.Context(), targetDir)
-			close(progressCh)
-			pm.Wait()
+			if trustRetries < 1 {
+				return fmt.Errorf("invalid --trust-retries %d: must be at least 1", trustRetries)
+			}
+			if trustConcurrency < 1 {
+				return fmt.Errorf("invalid --trust-concurrency %d: must be at least 1", trustConcurrency)
+			}
+			if maxClockSkew < 0 {
+				return fmt.Errorf("invalid --max-clock-skew %s: must not be negative", maxClockSkew)
+			}
+			if certExpiryWarning < 0 {
+				return fmt.Errorf("invalid --cert-expiry-warning %s: must not be negative", certExpiryWarning)
+			}
+			if sampled && expectRootDigest != "" {
+				// Sampled files have no full checksum, the recomputed root manifest differs from the generated one
+				return fmt.Errorf("--sampled cannot be combined with --expect-root-digest")
+			}
+			if allowMissingManifests && expectRootDigest != "" {
+				// Unmanaged directories have no checksum, the recomputed root manifest differs from the generated one
+				return fmt.Errorf("--allow-missing-manifests cannot be combined with --expect-root-digest")
+			}
+			if ignoreHiddenDiffs && hidden != string(scanner.HiddenWarn) {
+				// Only trees generated with the warn policy tell hidden differences apart
+				return fmt.Errorf("--ignore-hidden-diffs requires --hidden %s", scanner.HiddenWarn)
+			}
+			if (detachedSignature == "") != (allowedSigners == "") || (detachedSignature == "") != (signerIdentity == "") {
+				return fmt.Errorf("--detached-signature, --allowed-signers and --signer-identity must be given together")
+			}
+			if detachedSignature != "" && (sampled || allowMissingManifests) {
+				// The signed root digest is only recomputed when every directory is fully checksummed
+				return fmt.Errorf("--detached-signature cannot be combined with --sampled or --allow-missing-manifests")
+			}
+			if freshnessInterval > 0 && (expectRootDigest != "" || detachedSignature != "") {
+				// Fresh manifests are reused without rehashing their directories, the root digest would vouch for them
+				return fmt.Errorf("--freshness-interval cannot be combined with --expect-root-digest or --detached-signature")
+			}
+			if archivePath != "" {
+				if len(args) > 0 {
+					return fmt.Errorf("--archive cannot be combined with a directory argument")
+				}
+				if freshnessInterval > 0 || stateFile != "" {
+					return fmt.Errorf("--archive cannot be combined with --freshness-interval or --state-file")
+				}
+			}
+			if (remoteURL == "") != (treeID == "") {
+				return fmt.Errorf("--remote and --tree-id must be used together")
+			}
+			if remoteURL != "" && (archivePath != "" || freshnessInterval > 0 || stateFile != "") {
+				return fmt.Errorf("--remote cannot be combined with --archive, --freshness-interval or --state-file")
+			}
+			cutoff, err := parseChangedSince(changedSince, time.Now())
 			if err != nil {
 				return err
 			}
+			requiredLabels, err := manifest.ParseLabels(requiredLabelPairs)
+			if err != nil {
+				return fmt.Errorf("invalid --require-label: %w", err)
+			}
+			mode, err := scanner.ParseFreshnessMode(freshnessMode)
+			if err != nil {
+				return err
+			}
+			specialFilesPolicy, err := scanner.ParseSpecialFilesPolicy(specialFiles)
+			if err != nil {
+				return err
+			}
+			hiddenPolicy, err := scanner.ParseHiddenPolicy(hidden)
+			if err != nil {
+				return err
+			}
+			trustVerifier, err := newTrustVerifier(emailKeysURL, sshCAPath)
+			if err != nil {
+				return err
+			}
+			var auditorPolicy *issuer.AuditorPolicy
+			if trustPolicyFile != "" {
+				if auditorPolicy, err = issuer.LoadAuditorPolicy(trustPolicyFile); err != nil {
+					return err
+				}
+			}
+			retryPolicy := issuer.DefaultRetryPolicy
+			retryPolicy.Attempts = trustRetries
+			maxBytesPerSecond, err := parseBandwidth(limitBandwidth)
+			if err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			browser := newBrowser(cmd, out, useTUI, targetDir, archivePath)
+			exporter, err := startMetrics(metricsListen)
+			if err != nil {
+				return err
+			}
+			defer exporter.CloseAfterScrape(metricsLinger)
+			progress := scanner.NewProgressSource()
+			pm := ui.NewProgressMonitor(3 * time.Second)
+			var progressOut io.Writer = out
+			if browser != nil {
+				// The browser shows the progress in its header instead
+				progressOut = io.Discard
+			}
+			pm.MonitorSourceInBackground(cmd.Context(), progressOut, progress)
+			// --verbose is the persistent flag of the root command, absent when verify runs on its own
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			// Failures are printed as they are found, only they are kept until the end
+			printer := ui.NewVerificationPrinter(out, fullPaths, verbose)
+			sink := printer.PrintDirectory
+			if browser != nil {
+				sink = browser.Add
+			}
+			opts := []bytecheck.Option{
+				bytecheck.WithStatusSink(sink),
+				bytecheck.WithFreshness(freshnessInterval),
+				bytecheck.WithFreshnessMode(mode),
+				bytecheck.WithRefreshTimestamps(refreshTimestamps),
+				bytecheck.WithSpecialFiles(specialFilesPolicy),
+				bytecheck.WithHiddenPolicy(hiddenPolicy),
+				bytecheck.WithIgnoreHiddenDifferences(ignoreHiddenDiffs),
+				bytecheck.WithStateFile(stateFile),
+				bytecheck.WithMaxBytesPerSecond(maxBytesPerSecond),
+				bytecheck.WithMaxClockSkew(maxClockSkew),
+				bytecheck.WithCertExpiryWarning(certExpiryWarning),
+				bytecheck.WithTrustVerifier(trustVerifier),
+				bytecheck.WithTrustAnchors(trustAnchors),
+				bytecheck.WithTrustRetryPolicy(retryPolicy),
+				bytecheck.WithTrustConcurrency(trustConcurrency),
+				bytecheck.WithAuditorPolicy(auditorPolicy),
+				bytecheck.WithSampledVerification(sampled),
+				bytecheck.WithChunkedVerification(chunked),
+				bytecheck.WithFastVerification(fast),
+				bytecheck.WithChangedSince(cutoff),
+				bytecheck.WithAllowMissingManifests(allowMissingManifests),
+				bytecheck.WithRequiredLabels(requiredLabels),
+				bytecheck.WithRequireSingleAuditorRun(requireSingleAuditorRun),
+				bytecheck.WithRequireSigned(requireSigned),
+				bytecheck.WithRequireTrusted(requireTrusted),
+				bytecheck.WithMaxDepth(maxDepth),
+				bytecheck.WithOneFileSystem(oneFileSystem),
+				bytecheck.WithSkipLongPaths(skipLongPaths),
+				bytecheck.WithOnly(only...),
+				bytecheck.WithReport(reportPath),
+				bytecheck.WithManifestName(manifestName),
+				bytecheck.WithDetachedSignature(detachedSignature, allowedSigners, signerIdentity),
+				bytecheck.WithProgress(exporter.Update),
+				bytecheck.WithProgressSource(progress),
+			}
+			opts = append(opts, otel.options()...)
+			if remoteURL != "" {
+				if err := remote.ValidateTreeID(treeID); err != nil {
+					return err
+				}
+				store, err := openRemoteStore(remoteURL)
+				if err != nil {
+					return err
+				}
+				opts = append(opts, bytecheck.WithRemoteManifests(store, treeID))
+			}
+			verify := func(ctx context.Context) (*bytecheck.VerifyReport, error) {
+				if archivePath != "" {
+					return bytecheck.VerifyArchive(ctx, archivePath, opts...)
+				}
+				return bytecheck.VerifyTree(ctx, targetDir, opts...)
+			}
+			var report *bytecheck.VerifyReport
+			if browser != nil {
+				report, err = browseVerification(cmd.Context(), browser, verify)
+			} else {
+				report, err = verify(cmd.Context())
+			}
+			progress.Close()
+			pm.Wait()
+			// The badge is published for every run that was started, failed ones and ones without a result too
+			defer func() {
+				if badgeErr := writeBadges(report, runErr, badgePath, badgeSVGPath); badgeErr != nil {
+					runErr = errors.Join(runErr, badgeErr)
+				}
+			}()
+			if report != nil && report.Result != nil {
+				// Failed runs are recorded too, they are the ones worth alerting on
+				exporter.SetVerifyResult(report.Result)
+			}
+			if err != nil && (report == nil || !report.Result.Interrupted) {
+				return suggestManifestName(err)
+			}
+			result := report.Result
+			otel.recordVerifyResult(result)
 
-			pm.PrintFinalLine(cmd.OutOrStdout(), result.Stats) // final progress line
-			ui.PrintVerificationResult(cmd.OutOrStdout(), result)
-
-			return nil
-		},
+			pm.PrintFinalLine(out, result.Stats) // final progress line
+			printer.PrintResult(result)
+			if result.Interrupted {
+				return &ExitError{Code: exitCodeInterrupted, Err: err}
+			}
+			if expectRootDigest != "" {
+				// The root digest commits to nested directories through their manifests,
+				// so it only describes the tree when every manifest matches its directory
+				if result.HasFailures() {
+					return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed, Result: result,
+						Err: fmt.Errorf("cannot confirm root digest: %d manifest(s) do not match their directories",
+							result.Summary().Invalid)}
+				}
+				if !manifest.SecureEqualHex(expectRootDigest, result.RootDigest) {
+					return &bytecheck.VerificationError{Kind: bytecheck.ErrVerificationFailed, Result: result,
+						Err: fmt.Errorf("root digest mismatch: expected %s, got %s", expectRootDigest, result.RootDigest)}
+				}
+			}
+			if result.PolicyViolated() && !result.HasFailures() {
+				return &bytecheck.VerificationError{Kind: bytecheck.ErrTrustFailure, Result: result,
+					Err: fmt.Errorf("auditor policy %s violated: %d violation(s)", trustPolicyFile, result.Policy.Violations())}
+			}
+			return report.Err()
+		}),
 	}
-	verifyCmd.Flags().DurationVarP(&freshnessInterval, "freshness-interval", "", 0,
+	addFreshnessIntervalFlag(&verifyCmd, &freshnessInterval,
 		"Verify will reuse recently generated manifests if they are not older than this interval,"+
-			" (e.g., 5s, 1m, 24h)")
+			" (e.g., 5s, 1m, 24h), 0 disables reusing")
+	verifyCmd.Flags().StringVarP(&freshnessMode, "freshness-mode", "", string(scanner.FreshnessModeMtime),
+		"How manifest freshness is determined: 'mtime' uses the manifest file's modification time,"+
+			" 'embedded' uses the generation time and directory fingerprint stored in the manifest")
+	_ = verifyCmd.RegisterFlagCompletionFunc("freshness-mode",
+		completeValues(string(scanner.FreshnessModeMtime), string(scanner.FreshnessModeEmbedded)))
+	verifyCmd.Flags().BoolVarP(&refreshTimestamps, "refresh-timestamps", "", false,
+		"Update the modification time of the manifests of valid directories, so that a later run with"+
+			" --freshness-interval and --freshness-mode mtime reuses them")
+	verifyCmd.Flags().StringVarP(&stateFile, "state-file", "", "",
+		"Path to a state file remembering checksums of unchanged files between runs (opt-in)")
+	verifyCmd.Flags().StringVarP(&expectRootDigest, "expect-root-digest", "", "",
+		"Fail unless the digest of the recomputed root manifest equals this value (lowercase hex, as printed by generate)")
+	verifyCmd.Flags().StringVarP(&detachedSignature, "detached-signature", "", "",
+		"Fail unless this SSH signature, as written by sign-digest, signs the recomputed root digest")
+	verifyCmd.Flags().StringVarP(&allowedSigners, "allowed-signers", "", "",
+		"OpenSSH allowed_signers file listing the keys trusted for --detached-signature")
+	verifyCmd.Flags().StringVarP(&signerIdentity, "signer-identity", "", "",
+		"Identity the principals of the key of --detached-signature must match, like ssh-keygen -Y verify -I")
+	addLimitBandwidthFlag(&verifyCmd, &limitBandwidth)
+	addScopeFlags(&verifyCmd, &maxDepth, &only, &oneFileSystem, &skipLongPaths)
+	addSpecialFilesFlag(&verifyCmd, &specialFiles)
+	addHiddenFlag(&verifyCmd, &hidden)
+	verifyCmd.Flags().BoolVarP(&ignoreHiddenDiffs, "ignore-hidden-diffs", "", false,
+		"Pass directories differing only in hidden entries of trees generated with --hidden warn,"+
+			" their differences are still printed")
+	addMetricsListenFlag(&verifyCmd, &metricsListen, &metricsLinger)
+	addTracingFlags(&verifyCmd, &otel)
+	verifyCmd.Flags().DurationVarP(&maxClockSkew, "max-clock-skew", "", verifier.DefaultMaxClockSkew,
+		"Warn about auditors whose signed timestamps are further in the future than this")
+	verifyCmd.Flags().DurationVarP(&certExpiryWarning, "cert-expiry-warning", "", verifier.DefaultExpiryWarning,
+		"Report auditors whose certificates expire within this window as fishy, see generate --cert-validity."+
+			" Expired certificates always fail verification")
+	verifyCmd.Flags().StringVarP(&trustPolicyFile, "trust-policy-file", "", "",
+		"JSON file with ordered rules matching auditor references by glob, e.g. 'github:my-org/*', each with an"+
+			" outcome of 'require', 'allow', 'warn' or 'deny'; denied auditors and unmet requirements fail the verification")
+	verifyCmd.Flags().IntVarP(&trustRetries, "trust-retries", "", issuer.DefaultRetryPolicy.Attempts,
+		"Attempts to fetch auditor keys when the trusted source fails temporarily (5xx, 429, timeouts),"+
+			" with exponential backoff in between, 1 disables retrying")
+	verifyCmd.Flags().IntVarP(&trustConcurrency, "trust-concurrency", "", issuer.DefaultConcurrency,
+		"Number of auditor references whose keys are fetched from trusted sources at the same time")
+	verifyCmd.Flags().StringVarP(&emailKeysURL, "email-keys-url", "", "",
+		"URL template of the authorized keys of 'email:<address>' auditors, with %s standing for the"+
+			" percent-encoded address (e.g., 'https://keys.example.com/%s/authorized_keys')")
+	verifyCmd.Flags().StringVarP(&sshCAPath, "ssh-ca", "", "",
+		"File with the public keys of SSH certificate authorities trusted for 'sshca:<principal>' auditors")
+	verifyCmd.Flags().StringVarP(&trustAnchors, "trust-anchors", "", "",
+		"File pinning auditor references to SSH public keys, one 'reference key' per line, checked before any"+
+			" other trust source. Keep it outside the verified tree, whoever can rewrite the tree could pin their own keys")
+	verifyCmd.Flags().BoolVarP(&sampled, "sampled", "", false,
+		"Check files with a sample checksum (see generate --sample-files-over) by reading only their sampled"+
+			" regions; quicker on huge files, but changes outside of the samples go unnoticed")
+	verifyCmd.Flags().BoolVarP(&chunked, "chunked", "", false,
+		"Also hash the chunks of files recorded with generate --chunk-size, to report which chunks of a changed"+
+			" file differ; each of those files is hashed twice")
+	verifyCmd.Flags().StringArrayVarP(&requiredLabelPairs, "require-label", "", nil,
+		"Fail unless the root manifest holds this key=value label (see generate --label) and is signed by a"+
+			" trusted auditor. Can be repeated")
+	verifyCmd.Flags().BoolVarP(&requireSingleAuditorRun, "require-single-auditor-run", "", false,
+		"Fail when an auditor signed the tree in more than one generate run, e.g. because a directory signed"+
+			" for another tree was spliced in; by default it is only warned about")
+	verifyCmd.Flags().BoolVarP(&requireSigned, "require-signed", "", false,
+		"Fail when a manifest is unsigned, including the subdirectories of trees generated with --sign-root-only")
+	verifyCmd.Flags().BoolVarP(&requireTrusted, "require-trusted", "", false,
+		"Fail when a manifest is unsigned or none of its auditors is trusted, e.g. unsupported or unverifiable;"+
+			" implies --require-signed")
+	verifyCmd.Flags().BoolVarP(&fast, "fast", "", false,
+		"Report files whose size differs from the manifest without reading them;"+
+			" their new checksum is not printed")
+	verifyCmd.Flags().StringVarP(&changedSince, "changed-since", "", "",
+		"Read only the files modified since this RFC 3339 timestamp or duration ago (e.g. 24h), trusting the"+
+			" checksums recorded for older files; directories in which nothing changed are verified shallowly")
+	verifyCmd.Flags().BoolVarP(&allowMissingManifests, "allow-missing-manifests", "", false,
+		"Report directories without a manifest as unmanaged instead of failing; a parent that recorded the"+
+			" checksum of the missing manifest still fails. By default verification is strict")
+	addColorFlag(&verifyCmd, &color)
+	addManifestNameFlag(&verifyCmd, &manifestName)
+	verifyCmd.Flags().BoolVarP(&fullPaths, "full-paths", "", false,
+		"Show full paths of failed directories instead of paths relative to the verified directory")
+	verifyCmd.Flags().StringVarP(&reportPath, "report", "", "",
+		"Write every difference as a line of JSON to this file, followed by a summary line,"+
+			" for remediation scripts. It is written even when verification fails")
+	verifyCmd.Flags().StringVarP(&badgePath, "badge-out", "", "",
+		"Write a shields.io style JSON status badge of the run to this file, e.g. for a dashboard."+
+			" It is written even when verification fails")
+	verifyCmd.Flags().StringVarP(&badgeSVGPath, "badge-svg-out", "", "",
+		"Write the status badge of the run as an SVG image to this file, see --badge-out")
+	verifyCmd.Flags().BoolVarP(&useTUI, "tui", "", false,
+		"Browse the results in an interactive tree updated as directories are verified; only the summary is"+
+			" printed once it is closed. Ignored when the output is not a terminal")
+	verifyCmd.Flags().StringVarP(&archivePath, "archive", "", "",
+		"Verify the tree stored in this tar, tar.gz or zip archive without extracting it")
+	_ = verifyCmd.RegisterFlagCompletionFunc("archive", completeFileExtensions("tar", "gz", "tgz", "zip"))
+	verifyCmd.Flags().StringVarP(&remoteURL, "remote", "", "",
+		"Verify against the manifests uploaded to this remote store by push, see --tree-id")
+	verifyCmd.Flags().StringVarP(&treeID, "tree-id", "", "",
+		"Identifier of the tree in the remote store given by --remote")
 	return &verifyCmd
 }
+
+// writeBadges writes the badge summarizing the run that ended with report and runErr to jsonPath and as an image
+// to svgPath, either of them may be empty, see verifier.NewBadge and verifier.NewErrorBadge
+func writeBadges(report *bytecheck.VerifyReport, runErr error, jsonPath, svgPath string) error {
+	if jsonPath == "" && svgPath == "" {
+		return nil
+	}
+	now := time.Now()
+	badge := verifier.NewErrorBadge(runErr, now)
+	if report != nil {
+		badge = verifier.NewBadge(report.Result, now)
+		// Checks of the command beyond the result, e.g. of --expect-root-digest, fail the run too
+		var failed *bytecheck.VerificationError
+		if errors.As(runErr, &failed) && badge.Color != verifier.BadgeRed {
+			badge.Message, badge.Color = "failed", verifier.BadgeRed
+		}
+	}
+	if jsonPath != "" {
+		if err := badge.WriteJSON(jsonPath); err != nil {
+			return fmt.Errorf("failed to write badge: %w", err)
+		}
+	}
+	if svgPath != "" {
+		if err := badge.WriteSVG(svgPath); err != nil {
+			return fmt.Errorf("failed to write badge: %w", err)
+		}
+	}
+	return nil
+}
+
+// suggestManifestName adds the --manifest-name to pass to the error of a verification finding a manifest
+// under another name, see verifier.ManifestNotFoundError
+func suggestManifestName(err error) error {
+	var notFound *verifier.ManifestNotFoundError
+	if errors.As(err, &notFound) && notFound.OtherName != "" {
+		return fmt.Errorf("%w — did you mean --manifest-name %s?", err, notFound.OtherName)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func NewVerifySubtreeCommand() *cobra.Command {
+	var rootManifest string
+	var subtreePath string
+	var emailKeysURL string
+	var sshCAPath string
+	var fullPaths bool
+	var color string
+	verifySubtreeCmd := cobra.Command{
+		Use:   "verify-subtree <directory> --root-manifest <path-or-dir>",
+		Short: "Verify a subdirectory of a signed tree and prove it belongs to it",
+		Long: `Verify the manifests of a subdirectory of a tree whose root manifest is signed,
+like verify, and prove that the subdirectory belongs to that tree.
+
+--root-manifest points to the root manifest, or to its directory, with the manifests of the
+ancestors of the subdirectory laid out like the tree; the directories may hold nothing else.
+Each ancestor must record the checksum of the manifest one level down, and the root manifest
+must carry a valid auditor signature. Every level of the chain is reported.
+--path gives the path of the subdirectory in the tree, it is only needed when the subdirectory
+is not inside the root directory. The command exits with an error when the chain is broken.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trustVerifier, err := newTrustVerifier(emailKeysURL, sshCAPath)
+			if err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			report, err := bytecheck.VerifySubtree(cmd.Context(), args[0], rootManifest, subtreePath,
+				bytecheck.WithTrustVerifier(trustVerifier))
+			if err != nil && (report == nil || !report.Result.Interrupted) {
+				return err
+			}
+			result := report.Result
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			ui.PrintVerificationResult(out, result, fullPaths, verbose)
+			if result.Interrupted {
+				return &ExitError{Code: exitCodeInterrupted, Err: err}
+			}
+			return report.Err()
+		},
+	}
+	verifySubtreeCmd.Flags().StringVarP(&rootManifest, "root-manifest", "", "",
+		"The signed root manifest of the tree, or its directory holding the manifests of the ancestors")
+	_ = verifySubtreeCmd.MarkFlagRequired("root-manifest")
+	verifySubtreeCmd.Flags().StringVarP(&subtreePath, "path", "", "",
+		"Path of the directory in the tree, computed when the directory is inside the root directory")
+	verifySubtreeCmd.Flags().StringVarP(&emailKeysURL, "email-keys-url", "", "",
+		"URL template of the authorized keys of 'email:<address>' auditors, see verify --email-keys-url")
+	verifySubtreeCmd.Flags().StringVarP(&sshCAPath, "ssh-ca", "", "",
+		"File with the public keys of SSH certificate authorities trusted for 'sshca:<principal>' auditors")
+	addColorFlag(&verifySubtreeCmd, &color)
+	verifySubtreeCmd.Flags().BoolVarP(&fullPaths, "full-paths", "", false,
+		"Show full paths of failed directories instead of paths relative to the verified directory")
+	return &verifySubtreeCmd
+}
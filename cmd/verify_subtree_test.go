@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// createSignedDataset creates the tree root/dataset/v3 with a root manifest signed by custom:testuser
+func createSignedDataset(t *testing.T) string {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"readme.txt":             "readme",
+		"dataset/index.txt":      "index",
+		"dataset/v3/data.bin":    "data",
+		"dataset/v3/part/x.bin":  "more data",
+		"dataset/v2/old.bin":     "old data",
+		"dataset/v2/part/y.bin":  "old part",
+		"dataset/v3/part/z.json": "{}",
+	})
+	keysDir := t.TempDir()
+	keyPath := filepath.Join(keysDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(keyPath, "custom:testuser")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), signer, generator.WithSignRootOnly(true)).Generate(context.Background(), tempDir))
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+keysDir+"/%s.pub")
+	return tempDir
+}
+
+func TestVerifySubtreeCmd_FromLeaf_mustReportIntactChain(t *testing.T) {
+	tempDir := createSignedDataset(t)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifySubtreeCommand(),
+		[]string{filepath.Join(tempDir, "dataset", "v3"), "--root-manifest", filepath.Join(tempDir, manifest.DefaultName)})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "chain of dataset/v3 to the root:")
+	assert.Contains(t, output, "level 0 <root> ok (signed)")
+	assert.Contains(t, output, "level 1 dataset ok")
+	assert.Contains(t, output, "chain intact, the subtree belongs to the signed root")
+	assert.Contains(t, output, "audited by custom:testuser [trusted] (1 manifest)")
+	assert.Contains(t, output, "2 manifest(s) audited through a signed ancestor (inherited)")
+}
+
+func TestVerifySubtreeCmd_WithMountedSubtreeAndPath_mustReportBrokenLevel(t *testing.T) {
+	tempDir := createSignedDataset(t)
+	// The subtree is mounted apart from the ancestor manifests, which come from another version
+	mounted := filepath.Join(tempDir, "dataset", "v2")
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifySubtreeCommand(),
+		[]string{mounted, "--root-manifest", tempDir, "--path", filepath.Join("dataset", "v3")})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chain of manifests broken at level 1")
+	assert.Contains(t, output, "level 0 <root> ok (signed)")
+	assert.Contains(t, output, "level 1 dataset broken: records checksum")
+	assert.Contains(t, output, "chain broken at level 1")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+}
+
+func TestVerifySubtreeCmd_WithMissingAncestor_mustReportItsLevel(t *testing.T) {
+	tempDir := createSignedDataset(t)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "dataset", manifest.DefaultName)))
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifySubtreeCommand(),
+		[]string{filepath.Join(tempDir, "dataset", "v3"), "--root-manifest", tempDir})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chain of manifests broken at level 1")
+	assert.Contains(t, err.Error(), "not found")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+}
+
+func TestVerifySubtreeCmd_WithUnsignedRoot_mustReportTrustFailure(t *testing.T) {
+	tempDir := createSignedDataset(t)
+	require.NoError(t, generator.New(scanner.New(), nil, generator.WithStripSignatures(true)).Generate(context.Background(), tempDir))
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifySubtreeCommand(),
+		[]string{filepath.Join(tempDir, "dataset", "v3"), "--root-manifest", tempDir})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chain of manifests broken at level 0")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+}
+
+func TestVerifySubtreeCmd_WithDirectoryOutsideRoot_mustRequirePath(t *testing.T) {
+	tempDir := createSignedDataset(t)
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifySubtreeCommand(),
+		[]string{t.TempDir(), "--root-manifest", tempDir})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the path of the subtree in the tree must be given")
+}
@@ -1,16 +1,34 @@
 package cmd
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
 	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"github.com/tomekjarosik/bytecheck/pkg/scanner"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+	"github.com/tomekjarosik/bytecheck/pkg/version"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -23,7 +41,7 @@ func TestVerifyCommand(t *testing.T) {
 
 	// First, generate manifests
 	sc := scanner.New()
-	gen := generator.New(sc, signing.NewFakeSigner())
+	gen := generator.New(sc, nil)
 	ctx := context.Background()
 	err := gen.Generate(ctx, tempDir)
 	if err != nil {
@@ -55,8 +73,7 @@ func TestVerifyCommandWithChangedFiles(t *testing.T) {
 
 	// Generate manifest
 	sc := scanner.New()
-	fakeSigner := signing.NewFakeSigner()
-	gen := generator.New(sc, fakeSigner)
+	gen := generator.New(sc, nil)
 	ctx := context.Background()
 	err = gen.Generate(ctx, tempDir)
 	if err != nil {
@@ -120,8 +137,7 @@ func TestVerifyCommandDefaultDirectory(t *testing.T) {
 
 	// Generate manifest
 	sc := scanner.New()
-	fakeSigner := signing.NewFakeSigner()
-	gen := generator.New(sc, fakeSigner)
+	gen := generator.New(sc, nil)
 	ctx := context.Background()
 	err = gen.Generate(ctx, ".")
 	if err != nil {
@@ -155,7 +171,7 @@ func TestVerifyCmd_WithFreshManifest_NoFreshnessLimit(t *testing.T) {
 	// Create and execute verify command without freshness limit
 	cmd := NewVerifyCommand()
 	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir})
-	require.NoError(t, err)
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
 
 	assert.Contains(t, output, "failed")
 	assert.Contains(t, output, "0/1 manifests valid")
@@ -165,19 +181,49 @@ func TestVerifyCmd_WithFreshManifest_WithFreshnessLimit(t *testing.T) {
 	tempDir := CreateSampleStructureFromMap(t, map[string]string{
 		"test.txt": "test content",
 	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	cmd := NewVerifyCommand()
+	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "1h"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s) (1 shallow)")
+	assert.Contains(t, output, "1 fresh manifest(s) verified (shallow)")
+}
 
+func TestVerifyCmd_WithTouchedForeignManifest_mustVerifyFully(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt": "test content",
+	})
+	// A valid manifest of another directory, touched to look fresh
 	CreateFreshManifest(t, tempDir)
 
-	// Ensure the manifest is fresh by touching it
-	manifestPath := filepath.Join(tempDir, ".bytecheck.manifest")
-	now := time.Now()
-	require.NoError(t, os.Chtimes(manifestPath, now, now))
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "1h"})
 
-	cmd := NewVerifyCommand()
-	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "1h"})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "0/1 manifests valid")
+}
 
+func TestVerifyCmd_WithTouchedOutdatedManifest_mustVerifyFully(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test.txt":     "test content",
+		"sub/data.bin": "data",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
 	require.NoError(t, err)
-	assert.Contains(t, output, "skipped")
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "data.bin"), []byte("tampered data"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "added.bin"), []byte("added"), 0644))
+	now := time.Now()
+	for _, dir := range []string{tempDir, filepath.Join(tempDir, "sub")} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, ".bytecheck.manifest"), now, now))
+	}
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "1h"})
+
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "sub fail")
+	assert.Contains(t, output, "added.bin")
 }
 
 func TestVerifyCmd_WithStaleManifest_WithShortFreshnessLimit(t *testing.T) {
@@ -195,7 +241,7 @@ func TestVerifyCmd_WithStaleManifest_WithShortFreshnessLimit(t *testing.T) {
 	cmd := NewVerifyCommand()
 	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "1h"})
 
-	require.NoError(t, err)
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
 	assert.Contains(t, output, "0/1 manifests valid")
 }
 
@@ -204,7 +250,8 @@ func TestVerifyCmd_WithStaleManifest_WithLongFreshnessLimit(t *testing.T) {
 		"test.txt": "test content",
 	})
 
-	CreateFreshManifest(t, tempDir)
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
 
 	manifestPath := filepath.Join(tempDir, ".bytecheck.manifest")
 	staleTime := time.Now().Add(-2 * time.Hour) // 2 hours ago
@@ -214,7 +261,7 @@ func TestVerifyCmd_WithStaleManifest_WithLongFreshnessLimit(t *testing.T) {
 	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir, "--freshness-interval", "3h"})
 
 	require.NoError(t, err)
-	assert.Contains(t, output, "verified 0 manifest(s) (1 skipped)")
+	assert.Contains(t, output, "verified 1 manifest(s) (1 shallow)")
 }
 
 func TestVerifyCmd_WithCorruptedManifest(t *testing.T) {
@@ -237,10 +284,94 @@ func TestVerifyCmd_WithCorruptedManifest(t *testing.T) {
 	require.NoError(t, os.WriteFile(manifestPath, []byte(corruptedManifest), 0644))
 
 	cmd := NewVerifyCommand()
-	_, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir})
+	output, err := ExecuteCommandWithCapture(t, cmd, []string{"--color", "always", tempDir})
 
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "HMAC")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "<root> fail"+ui.ColorReset+" (invalid manifest)")
+	assert.Contains(t, output, "invalid manifest: invalid HMAC")
+	assert.Contains(t, output, "0/1 manifests valid")
+}
+
+func TestVerifyCmd_WithBadgeOut_mustWriteBadgeEvenOnFailure(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	outDir := t.TempDir()
+	badgePath, svgPath := filepath.Join(outDir, "status.json"), filepath.Join(outDir, "status.svg")
+	readBadge := func() verifier.Badge {
+		data, err := os.ReadFile(badgePath)
+		require.NoError(t, err)
+		var badge verifier.Badge
+		require.NoError(t, json.Unmarshal(data, &badge))
+		return badge
+	}
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--badge-out", badgePath, "--badge-svg-out", svgPath})
+	require.NoError(t, err)
+	badge := readBadge()
+	assert.Equal(t, "ok (2 manifests)", badge.Message)
+	assert.Equal(t, verifier.BadgeGreen, badge.Color)
+	assert.NotEmpty(t, badge.RootDigest)
+	assert.FileExists(t, svgPath)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("changed"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--badge-out", badgePath})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	badge = readBadge()
+	assert.Equal(t, "failed (1 of 2 manifests)", badge.Message)
+	assert.Equal(t, verifier.BadgeRed, badge.Color)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("b"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--badge-out", badgePath,
+		"--expect-root-digest", strings.Repeat("0", 64)})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	badge = readBadge()
+	assert.Equal(t, "failed", badge.Message)
+	assert.Equal(t, verifier.BadgeRed, badge.Color)
+
+	empty := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{empty, "--badge-out", badgePath})
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+	badge = readBadge()
+	assert.Equal(t, "no manifests", badge.Message)
+	assert.Equal(t, verifier.BadgeRed, badge.Color)
+}
+
+func TestVerifyCmd_WithFileNamedLikeManifest_mustReportOnlyThatDirectory(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt":          "a",
+		"restored/b.txt": "b",
+		"other/c.txt":    "c",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "restored", manifest.DefaultName),
+		[]byte("not a manifest, restored from an old backup"), 0644))
+	reportPath := filepath.Join(t.TempDir(), "report.jsonl")
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--report", reportPath})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "restored fail"+ui.ColorReset+" (invalid manifest)")
+	assert.Contains(t, output, "invalid manifest: failed to parse")
+	// The parent notices that the manifest of the subdirectory changed, which follows from the failure of restored
+	assert.Contains(t, output, "(1 parent manifest changed as a consequence, --verbose lists them)")
+	assert.NotContains(t, output, "checksum mismatch:"+ui.ColorReset+" restored (directory)")
+	assert.Contains(t, output, "1/3 manifests valid")
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	report, err := verifier.ParseReport(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	require.Len(t, report.Differences, 2)
+	// Directories are verified children first
+	invalid := report.Differences[0]
+	assert.Equal(t, "restored", invalid.Directory)
+	assert.Equal(t, verifier.ReportInvalidManifest, invalid.Type)
+	assert.Contains(t, invalid.Reason, "invalid manifest: failed to parse")
+	assert.Equal(t, verifier.ReportChecksum, report.Differences[1].Type)
 }
 
 func TestVerifyCmd_WithSmallFileTree_WhenSigned_mustVerifySignature(t *testing.T) {
@@ -263,7 +394,7 @@ func TestVerifyCmd_WithSmallFileTree_WhenSigned_mustVerifySignature(t *testing.T
 	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir})
 
 	require.NoError(t, err)
-	assert.Contains(t, output, "verified 1 manifest(s) (0 skipped)")
+	assert.Contains(t, output, "verified 1 manifest(s) (0 shallow)")
 }
 
 func TestVerifyCmd_WithLargeFileTree_WhenSigned_mustVerifySignature(t *testing.T) {
@@ -306,7 +437,7 @@ func TestVerifyCmd_WithLargeFileTree_WhenSigned_mustVerifySignature(t *testing.T
 	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir})
 
 	require.NoError(t, err)
-	assert.Contains(t, output, "verified 12 manifest(s) (0 skipped)")
+	assert.Contains(t, output, "verified 12 manifest(s) (0 shallow)")
 }
 
 func TestVerifyCmd_WhenSigned_WithMultipleUnsupportedAuditors_mustShowAuditorsAsUnsupported(t *testing.T) {
@@ -367,7 +498,7 @@ func TestVerifyCmd_WhenSigned_WithMultipleUnsupportedAuditors_mustShowAuditorsAs
 
 	// Run verify on the parent directory with freshness level
 	cmd := NewVerifyCommand()
-	output, err := ExecuteCommandWithCapture(t, cmd, []string{tempDir})
+	output, err := ExecuteCommandWithCapture(t, cmd, []string{"--color", "always", tempDir})
 
 	require.NoError(t, err)
 
@@ -377,6 +508,21 @@ func TestVerifyCmd_WhenSigned_WithMultipleUnsupportedAuditors_mustShowAuditorsAs
 	assert.Contains(t, output, "audited by \u001B[36mcustom:user2\u001B[0m \u001B[33m[unsupported]\u001B[0m")
 	assert.Contains(t, output, "audited by \u001B[36mcorp:team/project\u001B[0m \u001B[33m[unsupported]\u001B[0m")
 
+	// Auditors are listed by reference, each signed one manifest
+	var auditorLines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "audited by") {
+			assert.True(t, strings.HasSuffix(line, " (1 manifest)"), line)
+			auditorLines = append(auditorLines, line)
+		}
+	}
+	require.Len(t, auditorLines, 4)
+	assert.Contains(t, auditorLines[0], "corp:team/project")
+	assert.Contains(t, auditorLines[1], "custom:toplevel")
+	assert.Contains(t, auditorLines[2], "custom:user1")
+	assert.Contains(t, auditorLines[3], "custom:user2")
+	assert.Contains(t, output, "auditors: \u001B[33m4 unsupported\u001B[0m")
+
 	// Verify all manifests were processed
 	assert.Contains(t, output, "verified 4 manifest(s)")
 }
@@ -449,7 +595,7 @@ func TestVerifyCmd_SignedWithAuditor_mustShowCorrectAuditorStatus(t *testing.T)
 			os.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
 			defer os.Unsetenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE")
 			cmd := NewVerifyCommand()
-			output, err := ExecuteCommandWithCapture(t, cmd, []string{subDir})
+			output, err := ExecuteCommandWithCapture(t, cmd, []string{"--color", "always", subDir})
 			require.NoError(t, err)
 			assert.Contains(t, output, tc.reference)
 			assert.Contains(t, output, tc.expectedStatus)
@@ -457,3 +603,1324 @@ func TestVerifyCmd_SignedWithAuditor_mustShowCorrectAuditorStatus(t *testing.T)
 
 	}
 }
+
+func TestVerifyCmd_WhenSignedWithSecurityKey_mustVerifySignature(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+	signer := newSoftwareSKSigner(t, "custom:yubikey-user")
+
+	gen := generator.New(scanner.New(), signer)
+	require.NoError(t, gen.Generate(context.Background(), tempDir))
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, ".bytecheck.manifest"))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1)
+	assert.Equal(t, signing.SignatureAlgorithmSKEd25519, m.Auditors[0].Certificate.SignatureAlgorithm)
+	assert.Equal(t, signing.SignatureAlgorithmEd25519, m.Auditors[0].Algorithm)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s) (0 shallow)")
+}
+
+func TestVerifyCmd_WithTrackedPermissions_mustReportModeChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission bits are not supported on Windows")
+	}
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"run.sh":           "#!/bin/sh",
+		"subdir/test2.txt": "test content 2",
+	})
+	scriptPath := filepath.Join(tempDir, "run.sh")
+	require.NoError(t, os.Chmod(scriptPath, 0644))
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--track-permissions"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.True(t, m.HasPermissions())
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err)
+	assert.NotContains(t, output, "mode changed")
+
+	require.NoError(t, os.Chmod(scriptPath, 0755))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "mode changed:"+ui.ColorReset+" run.sh: 0644 -> 0755")
+}
+
+func TestVerifyCmd_WithoutTrackedPermissions_mustIgnoreModeChange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix permission bits are not supported on Windows")
+	}
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"run.sh": "#!/bin/sh"})
+	scriptPath := filepath.Join(tempDir, "run.sh")
+	require.NoError(t, os.Chmod(scriptPath, 0644))
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.Chmod(scriptPath, 0755))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.NotContains(t, output, "mode changed")
+	assert.NotContains(t, output, "fail")
+}
+
+func TestVerifyCmd_WithReadOnlyTree_mustSucceed(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("Skipping permission test when running as root")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping this test on Windows")
+	}
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"test1.txt":        "test content 1",
+		"subdir/test2.txt": "test content 2",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	readOnly := []string{filepath.Join(tempDir, "subdir"), tempDir}
+	for _, dir := range readOnly {
+		require.NoError(t, os.Chmod(filepath.Join(dir, manifest.DefaultName), 0444))
+		require.NoError(t, os.Chmod(dir, 0555))
+	}
+	defer func() {
+		for _, dir := range readOnly {
+			os.Chmod(dir, 0755) // Restore permissions for cleanup
+		}
+	}()
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "ok")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--refresh-timestamps"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "ok")
+}
+
+func TestVerifyCmd_WithRefreshTimestamps_mustMakeManifestsFresh(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	manifestPath := filepath.Join(tempDir, manifest.DefaultName)
+	staleTime := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(manifestPath, staleTime, staleTime))
+
+	// Verify leaves timestamps alone by default
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "1h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s) (0 shallow)")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--refresh-timestamps"})
+	require.NoError(t, err)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "1h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s) (1 shallow)")
+}
+
+func TestVerifyCmd_WithDeprecatedFreshnessDurationAlias(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-duration", "1h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "(1 shallow)")
+	assert.Contains(t, output, "use --freshness-interval instead")
+}
+
+func TestVerifyCmd_WithNegativeFreshnessInterval_mustReturnError(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "-5m"})
+	require.ErrorContains(t, err, "must not be negative")
+}
+
+// writeArchive packs dir into a tar.gz or zip archive, depending on the extension of archivePath
+func writeArchive(t *testing.T, dir string, archivePath string) {
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer f.Close()
+	if strings.HasSuffix(archivePath, ".zip") {
+		zw := zip.NewWriter(f)
+		require.NoError(t, zw.AddFS(os.DirFS(dir)))
+		require.NoError(t, zw.Close())
+		return
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.AddFS(os.DirFS(dir)))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+}
+
+func TestVerifyCmd_WithArchive_mustVerifyWithoutExtracting(t *testing.T) {
+	for _, name := range []string{"tree.tar.gz", "tree.zip"} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := CreateSampleStructureFromMap(t, map[string]string{
+				"test1.txt":        "test content 1",
+				"subdir/test2.txt": "test content 2",
+			})
+			_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+			require.NoError(t, err)
+			archivePath := filepath.Join(t.TempDir(), name)
+			writeArchive(t, tempDir, archivePath)
+
+			output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--archive", archivePath})
+			require.NoError(t, err)
+			assert.Contains(t, output, "ok")
+			assert.NotContains(t, output, "fail")
+
+			// Tamper with the tree after the manifests were generated
+			require.NoError(t, os.WriteFile(filepath.Join(tempDir, "subdir", "test2.txt"), []byte("changed"), 0644))
+			writeArchive(t, tempDir, archivePath)
+
+			output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--archive", archivePath})
+			assert.Contains(t, output, "fail")
+		})
+	}
+}
+
+func TestVerifyCmd_WithArchiveOfDirectory_mustVerifyTheDirectory(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"release-1.0/test1.txt":        "test content 1",
+		"release-1.0/subdir/test2.txt": "test content 2",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{filepath.Join(tempDir, "release-1.0")})
+	require.NoError(t, err)
+	archivePath := filepath.Join(t.TempDir(), "release-1.0.tar.gz")
+	writeArchive(t, tempDir, archivePath)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--archive", archivePath})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s)")
+}
+
+func TestVerifyCmd_WithArchive_InvalidCombinations_mustReturnError(t *testing.T) {
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--archive", "tree.tar", t.TempDir()})
+	assert.ErrorContains(t, err, "--archive cannot be combined with a directory argument")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--archive", "tree.tar", "--freshness-interval", "1h"})
+	assert.ErrorContains(t, err, "--archive cannot be combined with --freshness-interval or --state-file")
+}
+
+func TestVerifyCmd_WithChangedFiles_mustShowRelativePaths(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":                 "root",
+		"deep/nested/dir/file.txt": "original",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "deep", "nested", "dir", "file.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "extra.txt"), []byte("extra"), 0644))
+
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Contains(t, output, filepath.Join("deep", "nested", "dir")+" fail"+ui.ColorReset+" (1 difference)")
+	assert.Contains(t, output, "<root> fail")
+	assert.NotContains(t, output, tempDir)
+	// Failures are listed as they are found, subdirectories first
+	assert.Less(t, strings.Index(output, "deep"), strings.Index(output, "<root> fail"))
+
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--full-paths"})
+	assert.Contains(t, output, filepath.Join(tempDir, "deep", "nested", "dir")+" fail")
+	assert.NotContains(t, output, "<root>")
+}
+
+func TestVerifyCmd_WithFutureAuditorTimestamp_mustReportFishy(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(privateKeyPath, "custom:testuser")
+	require.NoError(t, err)
+	// The signing time recorded with the signature is the clock of the auditor's machine
+	require.NoError(t, generator.New(scanner.New(), signer,
+		generator.WithReproducible(time.Now().Add(2*time.Hour))).Generate(context.Background(), dataDir))
+
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorYellow+"[trusted, warning: auditor timestamp is 2h0m0s in the future, check for clock skew]")
+	assert.Contains(t, output, "1 trusted")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir, "--max-clock-skew", "3h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "[trusted]")
+}
+
+func TestVerifyCmd_WithTamperedAuditorTimestamp_mustReportError(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(privateKeyPath, "custom:testuser")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), dataDir))
+
+	manifestPath := filepath.Join(dataDir, manifest.DefaultName)
+	m, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	m.Auditors[0].Timestamp = m.Auditors[0].Timestamp.Add(-24 * time.Hour)
+	require.NoError(t, m.Save(manifestPath))
+
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir})
+	assert.Contains(t, output, "auditor attributes signature is invalid")
+	assert.NotContains(t, output, "[trusted]")
+}
+
+func TestVerifyCmd_WithFutureManifestModTime_mustNotReuseManifest(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(tempDir, manifest.DefaultName), future, future))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--freshness-interval", "24h"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s) (0 shallow)")
+}
+
+func TestVerifyCmd_WithNegativeMaxClockSkew_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--max-clock-skew", "-1m"})
+	assert.EqualError(t, err, "invalid --max-clock-skew -1m0s: must not be negative")
+}
+
+func TestVerifyCmd_WithZeroTrustRetries_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--trust-retries", "0"})
+	assert.EqualError(t, err, "invalid --trust-retries 0: must be at least 1")
+}
+
+func TestVerifyCmd_WithChangedFiles_mustShowGeneratingVersion(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "original"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Equal(t, version.String(), m.GeneratedBy)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("changed"), 0644))
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Contains(t, output, "<root> fail"+ui.ColorReset+" (1 difference)\n  manifest generated by "+version.String()+"\n")
+}
+
+func TestVerifyCmd_WithResizedFile_mustReportSubtreeSizeFirst(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "original", "sub/a.txt": "a"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("much longer content"), 0644))
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Contains(t, output, "<root> fail"+ui.ColorReset+" (1 difference)\n  manifest generated by "+version.String()+"\n"+
+		"  "+ui.ColorCyan+"! subtree size changed:"+ui.ColorReset+" 9 B -> 20 B (2 -> 2 files, 1 -> 1 directories)\n"+
+		"  "+ui.ColorCyan+"! checksum mismatch:"+ui.ColorReset+" file.txt (file)\n")
+}
+
+func TestVerifyCmd_WithRotatedKey_mustNotTrustIt(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content", "sub/a.txt": "a"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir,
+		"--private-key", privateKeyPath, "--auditor-reference", "custom:testuser"})
+	require.NoError(t, err)
+
+	// Rotate the published key
+	rotatedKeyPath := filepath.Join(t.TempDir(), "rotated")
+	_, _, err = signing.GenerateKeyPair(rotatedKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "not found in trusted source]")
+}
+
+func TestVerifyCmd_WithSSHCertificateAuthority_mustTrustCertifiedAuditor(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "id_ed25519")
+	_, publicKey, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+
+	_, caPrivateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caPrivateKey)
+	require.NoError(t, err)
+	caPath := filepath.Join(tempDir, "ca.pub")
+	require.NoError(t, os.WriteFile(caPath, ssh.MarshalAuthorizedKey(ca.PublicKey()), 0644))
+	cert := &ssh.Certificate{Key: publicKey, CertType: ssh.UserCert, ValidPrincipals: []string{"alice"},
+		ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certPath := filepath.Join(tempDir, "id_ed25519-cert.pub")
+	require.NoError(t, os.WriteFile(certPath, ssh.MarshalAuthorizedKey(cert), 0644))
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir,
+		"--private-key", privateKeyPath, "--auditor-reference", "sshca:alice", "--ssh-certificate", certPath})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir, "--ssh-ca", caPath})
+	require.NoError(t, err)
+	assert.Contains(t, output, "audited by "+ui.ColorCyan+"sshca:alice"+ui.ColorReset+" "+ui.ColorGreen+"[trusted]")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "[unsupported]")
+}
+
+func TestGenerateCmd_WithSSHCertificateOfOtherKey_mustFail(t *testing.T) {
+	tempDir := t.TempDir()
+	CreateSampleStructureFromMapInDir(t, filepath.Join(tempDir, "data"), map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "id_ed25519")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	_, otherKey, err := signing.GenerateKeyPair(filepath.Join(tempDir, "other"), filepath.Join(tempDir, "other.pub"))
+	require.NoError(t, err)
+	_, caPrivateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caPrivateKey)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{Key: otherKey, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certPath := filepath.Join(tempDir, "other-cert.pub")
+	require.NoError(t, os.WriteFile(certPath, ssh.MarshalAuthorizedKey(cert), 0644))
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{filepath.Join(tempDir, "data"),
+		"--private-key", privateKeyPath, "--auditor-reference", "sshca:alice", "--ssh-certificate", certPath})
+	assert.ErrorContains(t, err, "does not certify the signer's key")
+}
+
+func TestVerifyCmd_WithReport_mustListDifferencesEvenWhenFailing(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{
+		"root.txt":          "root",
+		"ingest/a.csv":      "aaaa",
+		"ingest/b.csv":      "bbbb",
+		"ingest/keep/c.csv": "cccc",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "ingest", "a.csv"), []byte("AAAA"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dataDir, "ingest", "b.csv")))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "extra.txt"), []byte("x"), 0644))
+	reportPath := filepath.Join(tempDir, "report.ndjson")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--report", reportPath, "--expect-root-digest", "00"})
+	require.ErrorContains(t, err, "cannot confirm root digest")
+
+	file, err := os.Open(reportPath)
+	require.NoError(t, err)
+	defer file.Close()
+	report, err := verifier.ParseReport(file)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ingest/a.csv:checksum", "ingest/b.csv:missing", "./extra.txt:extra"},
+		reportKeys(report))
+	require.NotNil(t, report.Summary)
+	assert.Equal(t, verifier.ReportSummary{Root: dataDir, Found: 3, Verified: 1, Invalid: 2, Differences: 3}, *report.Summary)
+}
+
+func TestVerifyCmd_WithReport_WhenVerificationStops_mustRecordError(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"root.txt": "root", "sub/a.txt": "a"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dataDir, "sub", manifest.DefaultName)))
+	reportPath := filepath.Join(tempDir, "report.ndjson")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--report", reportPath})
+	require.Error(t, err)
+
+	data, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	report, err := verifier.ParseReport(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	require.NotNil(t, report.Summary)
+	assert.Contains(t, report.Summary.Error, "not found")
+}
+
+// reportKeys returns "directory/name:type" for every difference of report, with slash-separated directories
+func reportKeys(report *verifier.Report) []string {
+	keys := make([]string, 0, len(report.Differences))
+	for _, d := range report.Differences {
+		keys = append(keys, filepath.ToSlash(d.Directory)+"/"+d.Name+":"+d.Type)
+	}
+	return keys
+}
+
+func TestVerifyCmd_WithMetricsListenOnBusyAddress_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt": "a",
+	})
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--metrics-listen", busy.Addr().String()})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to listen for metrics on "+busy.Addr().String())
+}
+
+func TestVerifyCmd_WithMetricsListen_mustVerify(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt": "a",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--metrics-listen", "127.0.0.1:0", "--metrics-linger", "0s"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--metrics-listen", "127.0.0.1:0", "--metrics-linger", "0s"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s)")
+}
+
+func TestVerifyCmd_WithOTLPEndpoint_mustExportTraces(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt": "a",
+	})
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+	}))
+	defer collector.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--otel-dir-threshold", "0"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s)")
+	assert.Equal(t, int32(2), exports.Load(), "every run exports its trace before it returns")
+}
+
+func TestVerifyCmd_WithRootOnlySignature_mustInheritAuditAlongValidManifests(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{
+		"file.txt": "content", "sub/a.txt": "a", "sub/deep/b.txt": "b"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir,
+		"--private-key", privateKeyPath, "--auditor-reference", "custom:testuser", "--sign-root-only"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(dataDir, "sub", "deep", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, m.IsAudited())
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorGreen+"[trusted]"+ui.ColorReset+" (1 manifest)")
+	assert.Contains(t, output, "1 of 3 manifest(s) signed\n")
+	assert.Contains(t, output, "2 manifest(s) audited through a signed ancestor "+ui.ColorCyan+"(inherited)")
+
+	// A tampered file fails its directory, which no longer inherits the audit
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "sub", "deep", "b.txt"), []byte("tampered"), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "sub/deep fail")
+	assert.Contains(t, output, "1 manifest(s) audited through a signed ancestor")
+
+	// Regenerating the tampered manifest changes its checksum, which breaks the chain at its parent
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{filepath.Join(dataDir, "sub", "deep")})
+	require.NoError(t, err)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "sub fail")
+	assert.NotContains(t, output, "sub/deep fail")
+	assert.NotContains(t, output, "(inherited)")
+
+	// Regenerating every manifest up to the root drops the root signature
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir})
+	require.NoError(t, err)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "Auditors: none")
+	assert.NotContains(t, output, "(inherited)")
+}
+
+func TestVerifyCmd_WithTrustPolicyFile_mustApplyRules(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(privateKeyPath, "custom:testuser")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), dataDir))
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+
+	writePolicy := func(rules string) string {
+		path := filepath.Join(tempDir, "policy.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"rules":[`+rules+`]}`), 0644))
+		return path
+	}
+
+	policyPath := writePolicy(`{"match":"custom:test*","outcome":"require"},{"match":"*","outcome":"deny"}`)
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir, "--trust-policy-file", policyPath})
+	require.NoError(t, err)
+	assert.Contains(t, output, "[trusted]"+ui.ColorReset+" (1 manifest)\n")
+	assert.Contains(t, output, "ok"+ui.ColorReset+" - verified 1 manifest(s)")
+
+	policyPath = writePolicy(`{"match":"github:*","outcome":"allow"},{"match":"*","outcome":"warn"},{"match":"custom:*","outcome":"deny"}`)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir, "--trust-policy-file", policyPath})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorYellow+"warned by policy rule 2"+ui.ColorReset)
+
+	policyPath = writePolicy(`{"match":"github:*","outcome":"allow"},{"match":"email:*","outcome":"require"},{"match":"custom:*","outcome":"deny"}`)
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir, "--trust-policy-file", policyPath})
+	assert.EqualError(t, err, "auditor policy "+policyPath+" violated: 2 violation(s)")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+	assert.Contains(t, output, ui.ColorRed+"denied by policy rule 3"+ui.ColorReset)
+	assert.Contains(t, output, "policy rule 2 requires a trusted auditor matching 'email:*', none found")
+	assert.Contains(t, output, "failed"+ui.ColorReset+" - 2 auditor policy violations")
+
+	policyPath = writePolicy(`{"match":"custom:*","outcome":"reject"}`)
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--trust-policy-file", policyPath})
+	assert.ErrorContains(t, err, "rule 1: invalid outcome 'reject'")
+}
+
+func TestVerifyCmd_Interrupted_mustPrintPartialSummaryAndExitDistinctly(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content", "sub/a.txt": "a"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	verifyCmd := NewVerifyCommand()
+	verifyCmd.SetContext(ctx)
+	output, err := ExecuteCommandWithCapture(t, verifyCmd, []string{tempDir})
+	var exitErr *ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, exitCodeInterrupted, exitErr.Code)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Contains(t, output, "auditors: not verified")
+	assert.Contains(t, output, "(interrupted — partial results: 0 of unknown directories checked)")
+}
+
+func TestVerifyCmd_Sampled_mustCheckSampleChecksums(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"big.bin":   strings.Repeat("0123456789", 300),
+		"small.txt": "small",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--sample-files-over", "1K"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.NotNil(t, m.Sampling)
+	assert.Equal(t, int64(1024), m.Sampling.Threshold)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--sampled"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "1 large file(s) "+ui.ColorCyan+"verified (sampled)")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err)
+	assert.NotContains(t, output, "(sampled)")
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "big.bin"), []byte(strings.Repeat("0123456789", 299)+"x123456789"), 0644))
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--sampled"})
+	assert.Contains(t, output, "checksum mismatch:"+ui.ColorReset+" big.bin (file)")
+	assert.Contains(t, output, "only sampled regions were compared, verify without --sampled to check the whole file")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--sampled", "--expect-root-digest", "abc"})
+	assert.EqualError(t, err, "--sampled cannot be combined with --expect-root-digest")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--sample-files-over", "-1"})
+	assert.EqualError(t, err, "invalid --sample-files-over, expected a positive size like 1GB")
+}
+
+func TestVerifyCmd_Fast_mustReportSizeMismatchWithoutHashing(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"big.bin":   strings.Repeat("0123456789", 300),
+		"small.txt": "small",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "big.bin"), []byte(strings.Repeat("0123456789", 400)), 0644))
+	reportPath := filepath.Join(t.TempDir(), "report.jsonl")
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir, "--fast", "--report", reportPath})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "size mismatch:"+ui.ColorReset+" big.bin")
+	assert.Contains(t, output, "1 file(s) whose size changed were "+ui.ColorCyan+"not hashed (fast)")
+	assert.NotContains(t, output, "checksum mismatch")
+
+	file, err := os.Open(reportPath)
+	require.NoError(t, err)
+	defer file.Close()
+	report, err := verifier.ParseReport(file)
+	require.NoError(t, err)
+	require.Len(t, report.Differences, 1)
+	assert.Equal(t, verifier.ReportSize, report.Differences[0].Type)
+	assert.Equal(t, int64(3000), *report.Differences[0].ExpectedSize)
+	assert.Equal(t, int64(4000), *report.Differences[0].ActualSize)
+
+	// Without --fast the new checksum is printed
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "checksum mismatch:"+ui.ColorReset+" big.bin (file)")
+	assert.NotContains(t, output, "(fast)")
+}
+
+func TestVerifyCmd_WithColorFlag_mustControlANSISequences(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/x.txt": "x"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "a", "x.txt"), []byte("y"), 0644))
+
+	output, _ := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--color", "never"})
+	assert.Contains(t, output, "checksum mismatch: x.txt")
+	assert.NotContains(t, output, "\033[")
+
+	// Output to a buffer is not a terminal, so auto leaves it uncolored
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.NotContains(t, output, "\033[")
+
+	t.Setenv("NO_COLOR", "1")
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--color", "always"})
+	assert.Contains(t, output, ui.ColorCyan+"! checksum mismatch:"+ui.ColorReset+" x.txt")
+	assert.Contains(t, output, ui.ColorRed+"failed"+ui.ColorReset)
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--color", "sometimes"})
+	assert.ErrorContains(t, err, "invalid color mode 'sometimes'")
+}
+
+func TestGenerateCmd_WithColorNever_mustPrintNoANSISequences(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/x.txt": "x"})
+	output, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--color", "never"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "final:")
+	assert.NotContains(t, output, "\033[")
+
+	output, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--color", "always"})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorCyan+"final:"+ui.ColorReset)
+}
+
+func TestVerifyCmd_WithChunking_mustReportBadChunk(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"big.bin": strings.Repeat("0123456789", 1000)})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--chunk-size", "1K"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.NotNil(t, m.Entities[0].Chunking)
+	assert.Len(t, m.Entities[0].Chunking.ChunkDigests, 10)
+
+	// A single byte deep in the file, in chunk 7
+	data := []byte(strings.Repeat("0123456789", 1000))
+	data[7500] = 'x'
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "big.bin"), data, 0644))
+	reportPath := filepath.Join(t.TempDir(), "report.jsonl")
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.NotContains(t, output, "chunk(s) differ", "chunks are only hashed with --chunked")
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--chunked", "--report", reportPath})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "checksum mismatch: big.bin (file)")
+	assert.Contains(t, output, "1 chunk(s) differ, the first is chunk 7 at offset 7.0 KB (chunks of 1.0 KB)")
+
+	file, err := os.Open(reportPath)
+	require.NoError(t, err)
+	defer file.Close()
+	report, err := verifier.ParseReport(file)
+	require.NoError(t, err)
+	require.Len(t, report.Differences, 1)
+	require.NotNil(t, report.Differences[0].FirstBadChunk)
+	assert.Equal(t, 7, *report.Differences[0].FirstBadChunk)
+	assert.Equal(t, 1, report.Differences[0].BadChunkCount)
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--chunk-size", "-1"})
+	assert.EqualError(t, err, "invalid --chunk-size, expected a positive size like 64MB")
+}
+
+func TestVerifyCmd_WithChangedDirConfig_mustFailNamingTheDirectory(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"logs/" + scanner.DirConfigName: `{"exclude": ["*.log"]}`,
+		"logs/app.log":                  "noise",
+		"logs/index.txt":                "kept",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, "logs", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Len(t, m.Entities, 2)
+	assert.NotEmpty(t, m.ConfigDigest)
+
+	// Excluded files may change freely
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "logs", "app.log"), []byte("more noise"), 0644))
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "ok - verified 2 manifest(s)")
+
+	// A weakened config would hide changes, it is reported before entries are compared
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "logs", scanner.DirConfigName), []byte(`{"exclude": ["*"]}`), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, verifier.ErrConfigMismatch)
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.ErrorContains(t, err, "directory '"+filepath.Join(tempDir, "logs")+"' was generated with a different .bytecheck.config")
+}
+
+func TestVerifyCmd_WithUpperCasedConfigDigest_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"logs/" + scanner.DirConfigName: `{"exclude": ["*.log"]}`,
+		"logs/index.txt":                "kept",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	manifestPath := filepath.Join(tempDir, "logs", manifest.DefaultName)
+	m, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	m.ConfigDigest = strings.ToUpper(m.ConfigDigest)
+	require.NoError(t, m.Save(manifestPath))
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+
+	assert.ErrorIs(t, err, verifier.ErrConfigMismatch)
+}
+
+func TestVerifyCmd_WithOtherManifestName_mustSuggestIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a/b/file.txt": "content",
+		"a/file.txt":   "content",
+		"file.txt":     "content",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--manifest-name", "custom.manifest"})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, "a", "b", manifest.DefaultName))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "found a manifest named 'custom.manifest' — did you mean --manifest-name custom.manifest?")
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--manifest-name", "custom.manifest"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 3 manifest(s) (0 shallow)")
+}
+
+func TestVerifyCmd_WithInvalidManifestName_mustFail(t *testing.T) {
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{t.TempDir(), "--manifest-name", "a/b"})
+	require.ErrorContains(t, err, "invalid --manifest-name 'a/b'")
+}
+
+func TestVerifyCmd_ExitCodes(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.ErrorIs(t, err, bytecheck.ErrNoManifests)
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.Equal(t, ExitOK, ExitCode(err))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "b.txt"), []byte("changed"), 0644))
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.EqualError(t, err, "1 manifest(s) do not match their directories")
+	var verificationErr *bytecheck.VerificationError
+	require.ErrorAs(t, err, &verificationErr)
+	assert.Equal(t, 1, verificationErr.Result.Summary().Invalid)
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--trust-retries", "0"})
+	assert.Equal(t, ExitRuntimeError, ExitCode(err))
+}
+
+func TestVerifyCmd_Failing_mustLeaveTheErrorToExecute(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+
+	output, err := ExecuteCommandWithCapture(t, InitializeCommands(), []string{"verify", tempDir})
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+	assert.NotContains(t, output, "Error:")
+}
+
+func TestVerifyCmd_WithLabels_mustPrintAndRequireRootLabels(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	keysDir := t.TempDir()
+	keyPath := filepath.Join(keysDir, "alice")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+keysDir+"/%s.pub")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label", "pipeline=ci-42",
+		"--label", "dataset=v3", "--label-root-only", "--private-key", keyPath, "--auditor-reference", "custom:alice"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--require-label", "pipeline=ci-42"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "labels: dataset=v3, pipeline=ci-42\n")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(),
+		[]string{tempDir, "--require-label", "pipeline=ci-7", "--require-label", "stage=prod"})
+	assert.EqualError(t, err, "root manifest lacks required label(s): pipeline=ci-7, stage=prod")
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "missing required label(s): pipeline=ci-7, stage=prod")
+}
+
+func TestVerifyCmd_WithLabelsOfUnsignedRoot_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a.txt": "a"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--label", "pipeline=ci-42"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "labels: pipeline=ci-42\n")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--require-label", "pipeline=ci-42"})
+	assert.EqualError(t, err, "required labels are only trusted in a root manifest signed by a trusted auditor")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+	assert.Contains(t, output, "untrusted labels: the root manifest is not signed by a trusted auditor")
+}
+
+func TestVerifyCmd_WithLabelsAlteredAfterSigning_mustFailAudit(t *testing.T) {
+	tempDir := createSignedDataset(t)
+	rootPath := filepath.Join(tempDir, manifest.DefaultName)
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err)
+
+	m, err := manifest.LoadManifest(rootPath)
+	require.NoError(t, err)
+	m.Labels = map[string]string{"pipeline": "forged"}
+	// Saving recalculates the HMAC, only the signature can tell
+	require.NoError(t, m.Save(rootPath))
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.ErrorContains(t, err, "manifest audit failed")
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+}
+
+func TestVerifyCmd_WithAllowMissingManifests_mustReportUnmanagedDirectories(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"a.txt": "a", "managed/b.txt": "b", "vendor/c.txt": "c", "vendor/lib/d.txt": "d",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "vendor", manifest.DefaultName)))
+	require.NoError(t, os.Remove(filepath.Join(tempDir, "vendor", "lib", manifest.DefaultName)))
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.ErrorContains(t, err, "manifest not found")
+	assert.Equal(t, ExitNoManifests, ExitCode(err))
+
+	// The root recorded the checksum of the deleted manifest, so changes below it are not hidden
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "vendor", "c.txt"), []byte("tampered"), 0644))
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--allow-missing-manifests"})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "checksum mismatch:")
+	assert.Contains(t, output, "vendor (directory)")
+	assert.Contains(t, output, "2 directories unmanaged")
+
+	// Managed subtrees of a root without a manifest are verified on their own
+	require.NoError(t, os.Remove(filepath.Join(tempDir, manifest.DefaultName)))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--allow-missing-manifests"})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "verified 1 manifest(s)")
+	assert.Contains(t, output, "3 directories unmanaged")
+	assert.NotContains(t, output, "fail")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(),
+		[]string{tempDir, "--allow-missing-manifests", "--expect-root-digest", "00"})
+	assert.EqualError(t, err, "--allow-missing-manifests cannot be combined with --expect-root-digest")
+}
+
+func TestVerifyCmd_WithLockFile_mustIgnoreIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content", "sub/b.txt": "b"})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	held, err := lock.Acquire(tempDir, "generate", false)
+	require.NoError(t, err)
+	defer held.Release()
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s)")
+
+	// Only the root holds the lock, a file of its name below cannot hide a payload
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", lock.Name), []byte("payload"), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "extra file: "+lock.Name)
+}
+
+func TestVerifyCmd_WithExpiringCertificate_mustReportFishy(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir, "--private-key", privateKeyPath,
+		"--auditor-reference", "custom:testuser", "--cert-validity", "1h"})
+	require.NoError(t, err)
+
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorYellow+"[fishy: auditor certificate expires soon, in ")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir,
+		"--cert-expiry-warning", "30m"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "[trusted]")
+}
+
+func TestVerifyCmd_WithExpiredCertificate_mustFailAsExpired(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, _, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(privateKeyPath, "custom:testuser")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dataDir))
+
+	// Sign the manifest like generate does, with a certificate that expired an hour ago
+	issuerKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	cert := &signing.SimpleCertificate{PubKey: publicKey, IssuerPubKey: issuerKey, IssuerRef: signer.Reference(),
+		SigAlgo: signer.Algorithm(), NotBefore: time.Now().Add(-25 * time.Hour), NotAfter: time.Now().Add(-time.Hour)}
+	cert.Sig, err = signer.Sign(signing.CertificatePayload(publicKey, cert.IssuerRef, cert.NotBefore, cert.NotAfter))
+	require.NoError(t, err)
+	manifestPath := filepath.Join(dataDir, manifest.DefaultName)
+	m, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	data, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	m.SetAuditedBy(cert, ed25519.Sign(privateKey, data), signing.SignatureAlgorithmEd25519)
+	require.NoError(t, m.Save(manifestPath))
+
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", dataDir})
+	assert.ErrorIs(t, err, bytecheck.ErrTrustFailure)
+	assert.ErrorContains(t, err, "certificate(s) of 1 auditor(s) expired or not yet valid")
+	assert.Contains(t, output, ui.ColorRed+"[expired: auditor certificate expired at ")
+	assert.Contains(t, output, ui.ColorRed+"1 expired")
+}
+
+func TestVerifyCmd_WithHiddenPolicies(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"data.txt":         "data",
+		"sub/file.txt":     "file",
+		".cache/entry.tmp": "cache",
+	})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--hidden", "warn"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", ".notes.swp"), []byte("editor"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--hidden", "warn"})
+	require.Error(t, err)
+	assert.Contains(t, output, "sub fail (1 difference, only hidden entries)")
+	assert.Contains(t, output, ". hidden extra file: .notes.swp")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--hidden", "warn", "--ignore-hidden-diffs"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "sub ok (1 hidden difference ignored)")
+	assert.Contains(t, output, "1 directory differs only in hidden entries")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "was generated with hidden policy 'warn', not 'include'")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--ignore-hidden-diffs"})
+	assert.ErrorContains(t, err, "--ignore-hidden-diffs requires --hidden warn")
+
+	_, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--hidden", "skip"})
+	assert.ErrorContains(t, err, "unknown hidden policy 'skip'")
+}
+
+func TestVerifyCmd_WithHiddenExclude_mustIgnoreHiddenEntries(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"data.txt":         "data",
+		".cache/entry.tmp": "cache",
+	})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--hidden", "exclude"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, ".cache", "entry.tmp"), []byte("changed"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, ".ipynb_checkpoints"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, ".DS_Store"), []byte("finder"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--hidden", "exclude"})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s)")
+}
+
+func TestVerifyCmd_WithTUI_mustFallBackWithoutTerminal(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"data.txt":     "data",
+		"sub/file.txt": "file",
+	})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "file.txt"), []byte("changed"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--tui"})
+	require.Error(t, err)
+	assert.Contains(t, output, "--tui needs a terminal, printing the results instead")
+	assert.Contains(t, output, "checksum mismatch")
+}
+
+func TestVerifyCmd_WithRecordedFiletype_mustExplainZeroedFiles(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"page.html": "<!DOCTYPE html><html><body>hello</body></html>",
+	})
+
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--record-filetype"})
+	require.NoError(t, err)
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Entities, 1)
+	assert.Equal(t, "text/html; charset=utf-8", m.Entities[0].ContentType)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.NoError(t, err, output)
+
+	page := filepath.Join(tempDir, "page.html")
+	info, err := os.Stat(page)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(page, make([]byte, info.Size()), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir})
+	require.Error(t, err)
+	assert.Contains(t, output, "content:  was text/html; charset=utf-8, now application/octet-stream (all zeros)")
+	assert.Contains(t, output, "likely bit-rot/truncation")
+}
+
+func TestVerifyCmd_WithTrustAnchors_mustPinAuditorKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	dataDir := filepath.Join(tempDir, "data")
+	CreateSampleStructureFromMapInDir(t, dataDir, map[string]string{"file.txt": "content"})
+	privateKeyPath := filepath.Join(tempDir, "testuser")
+	_, publicKey, err := signing.GenerateKeyPair(privateKeyPath, privateKeyPath+".pub")
+	require.NoError(t, err)
+	_, otherKey, err := signing.GenerateKeyPair(filepath.Join(t.TempDir(), "other"), filepath.Join(t.TempDir(), "other.pub"))
+	require.NoError(t, err)
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+tempDir+"/%s.pub")
+	_, err = ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{dataDir,
+		"--private-key", privateKeyPath, "--auditor-reference", "custom:testuser"})
+	require.NoError(t, err)
+
+	pinned := filepath.Join(tempDir, "pinned.trust")
+	require.NoError(t, os.WriteFile(pinned, append([]byte("custom:testuser "), ssh.MarshalAuthorizedKey(publicKey)...), 0644))
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--trust-anchors", pinned})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "[trusted (pinned)]")
+
+	// Pins are never read from the tree, whoever rewrites it could pin their own keys
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, ".bytecheck.trust"),
+		append([]byte("custom:testuser "), ssh.MarshalAuthorizedKey(otherKey)...), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir})
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "extra file: .bytecheck.trust")
+	assert.NotContains(t, output, "pinned")
+	require.NoError(t, os.Remove(filepath.Join(dataDir, ".bytecheck.trust")))
+
+	// A pin overrides the trust source, which still publishes the signing key
+	mismatch := filepath.Join(tempDir, "mismatch.trust")
+	require.NoError(t, os.WriteFile(mismatch, append([]byte("custom:testuser "), ssh.MarshalAuthorizedKey(otherKey)...), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--trust-anchors", mismatch})
+	assert.ErrorContains(t, err, "key(s) of 1 auditor(s) differ from the keys pinned by the trust anchors")
+	assert.Contains(t, output, "public key differs from the key pinned by the trust anchors: issuer 'custom:testuser'")
+
+	// References without a pin are verified as usual
+	unrelated := filepath.Join(tempDir, "unrelated.trust")
+	require.NoError(t, os.WriteFile(unrelated, append([]byte("custom:someone "), ssh.MarshalAuthorizedKey(otherKey)...), 0644))
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{dataDir, "--trust-anchors", unrelated})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "custom:testuser [trusted] (1 manifest)")
+}
+
+func TestParseChangedSince(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr string
+	}{
+		{"", time.Time{}, ""},
+		{"24h", now.Add(-24 * time.Hour), ""},
+		{"2024-05-01T00:00:00Z", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"0s", time.Time{}, "must be positive"},
+		{"-1h", time.Time{}, "must be positive"},
+		{"2024-06-01T00:00:00Z", time.Time{}, "must not be in the future"},
+		{"yesterday", time.Time{}, "expected an RFC 3339 timestamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseChangedSince(tt.value, now)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s", got)
+		})
+	}
+}
+
+// createAgedTree generates the manifests of a tree whose files were last modified two days ago
+func createAgedTree(t *testing.T) string {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"old.txt":   "old content",
+		"sub/a.txt": "a",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	past := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"old.txt", "sub/a.txt"} {
+		require.NoError(t, os.Chtimes(filepath.Join(tempDir, name), past, past))
+	}
+	return tempDir
+}
+
+func TestVerifyCmd_WithChangedSince_mustVerifyUnchangedDirectoriesShallowly(t *testing.T) {
+	tempDir := createAgedTree(t)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--changed-since", "24h"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 2 manifest(s) (2 shallow)")
+	assert.Contains(t, output, "2 directories unchanged since the cutoff verified (shallow)")
+	assert.Contains(t, output, "2 file(s) unchanged since the cutoff not hashed (changed-since)")
+	assert.NotContains(t, output, "fresh manifest(s)")
+}
+
+func TestVerifyCmd_WithChangedSince_mustHashRecentlyModifiedFiles(t *testing.T) {
+	tempDir := createAgedTree(t)
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "old.txt"), []byte("new content"), 0644))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--changed-since", "24h"})
+
+	assert.Equal(t, ExitVerificationFailed, ExitCode(err))
+	assert.Contains(t, output, "1/2 manifests valid")
+	assert.Contains(t, output, "old.txt")
+	assert.Contains(t, output, "1 directory unchanged since the cutoff verified (shallow)")
+	assert.Contains(t, output, "1 file(s) unchanged since the cutoff not hashed (changed-since)")
+}
+
+func TestVerifyCmd_WithChangedSince_WithFreshnessInterval_mustReuseFreshManifestsFirst(t *testing.T) {
+	tempDir := createAgedTree(t)
+
+	// The manifests were generated just now, they are fresh before their files are checked for changes
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(),
+		[]string{tempDir, "--changed-since", "24h", "--freshness-interval", "1h"})
+
+	require.NoError(t, err)
+	assert.Contains(t, output, "2 fresh manifest(s) verified (shallow)")
+	assert.NotContains(t, output, "unchanged since the cutoff")
+}
+
+func TestVerifyCmd_WithInvalidChangedSince_mustFail(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"test.txt": "test content"})
+
+	_, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{tempDir, "--changed-since", "last week"})
+
+	assert.ErrorContains(t, err, "invalid --changed-since 'last week'")
+}
+
+func TestVerifyCmd_WithSplicedDirectory_mustWarnUnlessSingleAuditorRunRequired(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"a/file.txt": "a"})
+	otherDir := CreateSampleStructureFromMap(t, map[string]string{"c/file.txt": "c"})
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer := signing.NewEd25519Signer(privateKey, "custom:alice")
+
+	// A directory signed for another tree by the same auditor is moved in, and kept by a run reusing fresh manifests
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), otherDir))
+	require.NoError(t, os.Rename(filepath.Join(otherDir, "c"), filepath.Join(tempDir, "c")))
+	sc := scanner.New(scanner.WithManifestFreshnessLimit(time.Hour))
+	require.NoError(t, generator.New(sc, signer).Generate(context.Background(), tempDir))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, ui.ColorYellow+"! custom:alice signed this tree in 2 runs"+ui.ColorReset)
+	assert.Regexp(t, `run 1, key sha256:[0-9a-f]{64}, signed .+: c\n`, output)
+	assert.Regexp(t, `run 2, key sha256:[0-9a-f]{64}, signed .+: <root>, a\n`, output)
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(),
+		[]string{"--color", "always", "--require-single-auditor-run", tempDir})
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+	assert.ErrorContains(t, err, "1 auditor(s) signed the tree in more than one run")
+	assert.Contains(t, output, ui.ColorRed+"! custom:alice signed this tree in 2 runs"+ui.ColorReset)
+	assert.Contains(t, output, "failed"+ui.ColorReset+" - 1 auditor signed the tree in more than one run")
+}
+
+func TestVerifyCmd_WithMixedSignatures_mustSummarizeSigningAndRequireIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"trusted/file.txt": "trusted", "stranger/file.txt": "stranger", "plain/file.txt": "plain"})
+	keysDir := t.TempDir()
+	t.Setenv("BYTECHECK_CUSTOM_AUDITOR_VERIFIER_URL_TEMPLATE", "file://"+keysDir+"/%s.pub")
+	_, _, err := signing.GenerateKeyPair(filepath.Join(keysDir, "alice"), filepath.Join(keysDir, "alice.pub"))
+	require.NoError(t, err)
+	alice, err := signing.NewEd25519SignerFromFile(filepath.Join(keysDir, "alice"), "custom:alice")
+	require.NoError(t, err)
+	// The key of bob is not published, so his signatures cannot be trusted
+	_, bobKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	bob := signing.NewEd25519Signer(bobKey, "custom:bob")
+
+	require.NoError(t, generator.New(scanner.New(), alice).Generate(context.Background(), filepath.Join(tempDir, "trusted")))
+	require.NoError(t, generator.New(scanner.New(), bob).Generate(context.Background(), filepath.Join(tempDir, "stranger")))
+	fresh := scanner.New(scanner.WithManifestFreshnessLimit(time.Hour))
+	require.NoError(t, generator.New(fresh, nil).Generate(context.Background(), tempDir))
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "signatures: 1 signed & trusted, "+ui.ColorYellow+"1 signed but not verifiable"+
+		ui.ColorReset+" (trust errors/unsupported), 2 unsigned")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", "--require-signed", tempDir})
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+	assert.ErrorContains(t, err, "2 manifest(s) are unsigned")
+	assert.Contains(t, output, "failed"+ui.ColorReset+" - 2 manifests are unsigned")
+	assert.Contains(t, output, ui.ColorRed+"2 unsigned"+ui.ColorReset)
+
+	// Once every manifest is signed, only the ones of bob keep failing when trust is required
+	require.NoError(t, generator.New(scanner.New(), alice).Generate(context.Background(), filepath.Join(tempDir, "plain")))
+	require.NoError(t, os.Remove(filepath.Join(tempDir, manifest.DefaultName)))
+	require.NoError(t, generator.New(fresh, alice).Generate(context.Background(), tempDir))
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--require-signed", tempDir})
+	require.NoError(t, err, output)
+	assert.Contains(t, output, "signatures: 3 signed & trusted, 1 signed but not verifiable (trust errors/unsupported), 0 unsigned")
+
+	output, err = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", "--require-trusted", tempDir})
+	assert.Equal(t, ExitTrustFailure, ExitCode(err))
+	assert.ErrorContains(t, err, "1 signed manifest(s) have no trusted auditor")
+	assert.Contains(t, output, "failed"+ui.ColorReset+" - 1 signed manifest has no trusted auditor")
+	assert.Contains(t, output, ui.ColorRed+"1 signed but not verifiable"+ui.ColorReset)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"github.com/tomekjarosik/bytecheck/pkg/ui/tui"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+// newBrowser returns the browser of the verification requested by --tui, nil when it was not requested or when
+// the command does not run in a terminal, results are then printed as usual
+func newBrowser(cmd *cobra.Command, out *ui.Output, useTUI bool, targetDir, archivePath string) *tui.Browser {
+	if !useTUI {
+		return nil
+	}
+	stdout, ok := cmd.OutOrStdout().(*os.File)
+	if !ok || !tui.IsTerminal(stdout) || !tui.IsTerminal(os.Stdin) {
+		ui.PrintWarning(out, "--tui needs a terminal, printing the results instead")
+		return nil
+	}
+	root := targetDir
+	if archivePath != "" {
+		root = archivePath
+	}
+	browser := tui.NewBrowser(root)
+	browser.Palette = out.Palette
+	return browser
+}
+
+// browseVerification runs verify while its results are browsed in the terminal. Closing the browser
+// before verification is over interrupts it.
+func browseVerification(ctx context.Context, browser *tui.Browser,
+	verify func(ctx context.Context) (*bytecheck.VerifyReport, error)) (*bytecheck.VerifyReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type outcome struct {
+		report *bytecheck.VerifyReport
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		report, err := verify(ctx)
+		var result *verifier.Result
+		if report != nil {
+			result = report.Result
+		}
+		browser.Finish(result, err)
+		done <- outcome{report, err}
+	}()
+	browseErr := tui.Run(ctx, os.Stdin, os.Stdout, browser)
+	cancel()
+	o := <-done
+	if browseErr != nil && o.err == nil {
+		return o.report, browseErr
+	}
+	return o.report, o.err
+}
@@ -0,0 +1,308 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+const (
+	watchModeGenerate = "generate"
+	watchModeVerify   = "verify"
+)
+
+func NewWatchCommand() *cobra.Command {
+	var mode string
+	var quietPeriod time.Duration
+	var freshnessMode string
+	var specialFiles string
+	var hidden string
+	var trackPermissions bool
+	var trackXattrs bool
+	var trackHardlinks bool
+	var fullPaths bool
+	var color string
+	watchCmd := cobra.Command{
+		Use:   "watch [directory]",
+		Short: "Keep manifests up to date, or verify them, while files change",
+		Long: `Watch the specified directory, or the current one, for file system changes.
+
+The whole tree is processed once at start. Afterwards, once no change was seen
+for the quiet period, only the directories containing changes and their ancestors
+are processed again: with --mode generate their manifests are updated, with
+--mode verify they are checked. Press Ctrl+C to stop.`,
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeDirectories(1),
+		SilenceUsage:      true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			targetDir := "."
+			if len(args) > 0 {
+				targetDir = args[0]
+			}
+			if mode != watchModeGenerate && mode != watchModeVerify {
+				return fmt.Errorf("invalid --mode '%s': must be '%s' or '%s'", mode, watchModeGenerate, watchModeVerify)
+			}
+			if quietPeriod <= 0 {
+				return fmt.Errorf("invalid --quiet-period %s: must be positive", quietPeriod)
+			}
+			freshness, err := scanner.ParseFreshnessMode(freshnessMode)
+			if err != nil {
+				return err
+			}
+			specialFilesPolicy, err := scanner.ParseSpecialFilesPolicy(specialFiles)
+			if err != nil {
+				return err
+			}
+			hiddenPolicy, err := scanner.ParseHiddenPolicy(hidden)
+			if err != nil {
+				return err
+			}
+			out, err := colorOutput(cmd.OutOrStdout(), color)
+			if err != nil {
+				return err
+			}
+			// --verbose is the persistent flag of the root command, absent when watch runs on its own
+			verbose, _ := cmd.Flags().GetBool("verbose")
+			w := &treeWatcher{
+				out:       out,
+				root:      targetDir,
+				mode:      mode,
+				fullPaths: fullPaths,
+				verbose:   verbose,
+				opts: []bytecheck.Option{
+					bytecheck.WithFreshnessMode(freshness),
+					bytecheck.WithSpecialFiles(specialFilesPolicy),
+					bytecheck.WithHiddenPolicy(hiddenPolicy),
+					bytecheck.WithTrackPermissions(trackPermissions),
+					bytecheck.WithXattrs(trackXattrs),
+					bytecheck.WithTrackHardlinks(trackHardlinks),
+				},
+			}
+			if mode == watchModeVerify {
+				trustVerifier, err := newTrustVerifier("", "")
+				if err != nil {
+					return err
+				}
+				w.opts = append(w.opts, bytecheck.WithTrustVerifier(trustVerifier))
+			}
+			return w.run(cmd.Context(), quietPeriod)
+		},
+	}
+	watchCmd.Flags().StringVarP(&mode, "mode", "", watchModeGenerate,
+		"What to do on changes: 'generate' updates the affected manifests, 'verify' checks them")
+	_ = watchCmd.RegisterFlagCompletionFunc("mode", completeValues(watchModeGenerate, watchModeVerify))
+	watchCmd.Flags().DurationVarP(&quietPeriod, "quiet-period", "", 2*time.Second,
+		"Process changes once none was seen for this long, so bursts of writes are handled together")
+	watchCmd.Flags().StringVarP(&freshnessMode, "freshness-mode", "", string(scanner.FreshnessModeMtime),
+		"How manifest freshness is determined, see generate")
+	_ = watchCmd.RegisterFlagCompletionFunc("freshness-mode",
+		completeValues(string(scanner.FreshnessModeMtime), string(scanner.FreshnessModeEmbedded)))
+	addSpecialFilesFlag(&watchCmd, &specialFiles)
+	addHiddenFlag(&watchCmd, &hidden)
+	watchCmd.Flags().BoolVarP(&trackPermissions, "track-permissions", "", false,
+		"Also record mode and owner of files and directories in generate mode, see generate")
+	watchCmd.Flags().BoolVarP(&trackXattrs, "xattrs", "", false,
+		"Also record extended attributes of files and directories in generate mode, see generate")
+	watchCmd.Flags().BoolVarP(&trackHardlinks, "track-hardlinks", "", false,
+		"Also record which files are hard links of the same file in generate mode, see generate")
+	watchCmd.Flags().BoolVarP(&fullPaths, "full-paths", "", false,
+		"Show full paths of failed directories in verify mode")
+	addColorFlag(&watchCmd, &color)
+	return &watchCmd
+}
+
+// treeWatcher processes the changes of a tree reported by fsnotify
+type treeWatcher struct {
+	out       io.Writer
+	root      string
+	mode      string
+	fullPaths bool
+	verbose   bool
+	opts      []bytecheck.Option
+	watcher   *fsnotify.Watcher
+	// pending holds the paths changed since the last run
+	pending map[string]struct{}
+	totals  watchTotals
+}
+
+// watchTotals accumulates the statistics of all runs since the watch started
+type watchTotals struct {
+	runs        int
+	directories int64
+	files       int64
+	bytes       int64
+}
+
+func (t *watchTotals) add(stats *scanner.Stats) {
+	t.runs++
+	if stats == nil {
+		return
+	}
+	t.directories += stats.DirsProcessed()
+	t.files += stats.FilesProcessed()
+	t.bytes += stats.BytesHashed()
+}
+
+// run processes the whole tree once, then the changes seen within each quiet period until ctx is done
+func (w *treeWatcher) run(ctx context.Context, quietPeriod time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching: %w", err)
+	}
+	defer watcher.Close()
+	w.watcher = watcher
+	w.pending = make(map[string]struct{})
+	// Directories are watched before the initial run, so changes made during it are not missed
+	if err := w.watchTree(w.root); err != nil {
+		return err
+	}
+	if err := w.process(ctx, nil); err != nil {
+		return ignoreCancellation(ctx, err)
+	}
+	fmt.Fprintf(w.out, "watching %s for changes, press Ctrl+C to stop\n", w.root)
+
+	quiet := time.NewTimer(quietPeriod)
+	quiet.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if w.record(event) {
+				quiet.Reset(quietPeriod)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Changes were lost, only processing the whole tree is safe
+				w.pending[w.root] = struct{}{}
+				quiet.Reset(quietPeriod)
+			}
+			ui.PrintWarning(w.out, "watch error: %v", err)
+		case <-quiet.C:
+			changed := make([]string, 0, len(w.pending))
+			for changedPath := range w.pending {
+				changed = append(changed, changedPath)
+			}
+			sort.Strings(changed)
+			clear(w.pending)
+			if err := w.process(ctx, changed); err != nil {
+				return ignoreCancellation(ctx, err)
+			}
+		}
+	}
+}
+
+// record remembers the path of event and reports whether it needs processing.
+// Manifests are left out, they change whenever the watcher writes or verifies them.
+func (w *treeWatcher) record(event fsnotify.Event) bool {
+	if filepath.Base(event.Name) == manifest.DefaultName {
+		return false
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			if err := w.watchTree(event.Name); err != nil {
+				ui.PrintWarning(w.out, "%v", err)
+			}
+		}
+	}
+	w.pending[event.Name] = struct{}{}
+	return true
+}
+
+// watchTree adds dir and all directories below it to the watcher.
+// Directories that vanish meanwhile are skipped, their parent reports the deletion.
+func (w *treeWatcher) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path != w.root {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if err := w.watcher.Add(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to watch '%s': %w", path, err)
+		}
+		return nil
+	})
+}
+
+// process runs generate or verify for the changed paths, for the whole tree if there are none,
+// and prints the result followed by the totals since the watch started
+func (w *treeWatcher) process(ctx context.Context, changed []string) error {
+	if len(changed) > 0 {
+		fmt.Fprintf(w.out, "\n%d path(s) changed\n", len(changed))
+	}
+	var stats *scanner.Stats
+	if w.mode == watchModeGenerate {
+		var report *bytecheck.GenerateReport
+		var err error
+		if changed == nil {
+			report, err = bytecheck.GenerateTree(ctx, w.root, w.opts...)
+		} else {
+			report, err = bytecheck.RegeneratePath(ctx, w.root, changed, w.opts...)
+		}
+		if err != nil {
+			return err
+		}
+		stats = report.Stats
+		if report.Directories == 0 {
+			fmt.Fprintln(w.out, "no manifest affected")
+		} else {
+			ui.PrintWriteResult(w.out, report.Directories-report.Cached, report.Cached, report.Vanished,
+				report.ManifestsWritten, report.RootDigest, report.Subtree)
+			ui.PrintSignatureChanges(w.out, report.Signatures.Preserved, report.Signatures.Invalidated, report.Signatures.Stripped)
+		}
+	} else {
+		var report *bytecheck.VerifyReport
+		var err error
+		if changed == nil {
+			report, err = bytecheck.VerifyTree(ctx, w.root, w.opts...)
+		} else {
+			report, err = bytecheck.VerifyPath(ctx, w.root, changed, w.opts...)
+		}
+		if err != nil {
+			// A single failed run, e.g. a manifest removed by hand, must not end the watch
+			if ctx.Err() != nil {
+				return err
+			}
+			ui.PrintError(w.out, "verification failed: %v", err)
+		} else {
+			stats = report.Stats
+			ui.PrintVerificationResult(w.out, report.Result, w.fullPaths, w.verbose)
+		}
+	}
+	w.totals.add(stats)
+	ui.PrintWatchTotals(w.out, w.totals.runs, w.totals.directories, w.totals.files, w.totals.bytes)
+	return nil
+}
+
+// ignoreCancellation returns nil when err is caused by ctx being done, e.g. by Ctrl+C
+func ignoreCancellation(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// startWatch runs the watch command with args until the test ends, and returns a function
+// that stops it and returns its output
+func startWatch(t *testing.T, args []string) func() string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := NewWatchCommand()
+	cmd.SetContext(ctx)
+	done := make(chan struct{})
+	var output string
+	var err error
+	go func() {
+		defer close(done)
+		output, err = ExecuteCommandWithCapture(t, cmd, args)
+	}()
+	stop := func() string {
+		cancel()
+		<-done
+		require.NoError(t, err)
+		return output
+	}
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return stop
+}
+
+// requireTreeMatches waits until every manifest below dir matches its directory
+func requireTreeMatches(t *testing.T, dir string) {
+	t.Helper()
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		report, err := bytecheck.VerifyTree(context.Background(), dir)
+		if !assert.NoError(c, err) {
+			return
+		}
+		assert.False(c, report.HasFailures())
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestWatchCmd_GenerateMode_UpdatesManifestsOnChanges(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":          "root",
+		"ingest/day1/a.csv": "a",
+		"archive/old.csv":   "old",
+	})
+	stop := startWatch(t, []string{tempDir, "--quiet-period", "50ms"})
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(tempDir, manifest.DefaultName))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	requireTreeMatches(t, tempDir)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "ingest", "day1", "b.csv"), []byte("b"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "ingest", "day2", "raw"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "ingest", "day2", "raw", "c.csv"), []byte("c"), 0644))
+	require.NoError(t, os.RemoveAll(filepath.Join(tempDir, "archive")))
+	requireTreeMatches(t, tempDir)
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, "ingest", "day2", "raw", manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Entities, 1)
+	assert.Equal(t, "c.csv", m.Entities[0].Name)
+
+	output := stop()
+	assert.Contains(t, output, "watching "+tempDir+" for changes")
+	assert.Contains(t, output, "path(s) changed")
+	assert.Contains(t, output, "since start: ")
+}
+
+func TestWatchCmd_GenerateMode_mustNotBeTriggeredByItsOwnWrites(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":  "root",
+		"sub/a.txt": "a",
+	})
+	stop := startWatch(t, []string{tempDir, "--quiet-period", "50ms"})
+	requireTreeMatches(t, tempDir)
+	// Several quiet periods pass, any file written into the tree by the run would be processed meanwhile
+	time.Sleep(300 * time.Millisecond)
+
+	output := stop()
+	assert.NotContains(t, output, "path(s) changed")
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"root.txt", "sub", manifest.DefaultName}, names)
+}
+
+func TestWatchCmd_VerifyMode_ReportsChangedDirectories(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{
+		"root.txt":  "root",
+		"sub/a.txt": "a",
+	})
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir})
+	require.NoError(t, err)
+	stop := startWatch(t, []string{tempDir, "--mode", "verify", "--quiet-period", "50ms"})
+	// Wait for the initial verification, it refreshes the manifest timestamps
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "sub", "a.txt"), []byte("b"), 0644))
+	time.Sleep(500 * time.Millisecond)
+
+	output := stop()
+	assert.Contains(t, output, "1 path(s) changed")
+	assert.Contains(t, output, "sub")
+	assert.Contains(t, output, "checksum mismatch")
+}
+
+func TestWatchCmd_InvalidMode_mustReturnError(t *testing.T) {
+	_, err := ExecuteCommandWithCapture(t, NewWatchCommand(), []string{t.TempDir(), "--mode", "audit"})
+	require.ErrorContains(t, err, "invalid --mode 'audit': must be 'generate' or 'verify'")
+}
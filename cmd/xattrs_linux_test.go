@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+)
+
+func TestVerifyCmd_WithChangedXattr_mustReportIt(t *testing.T) {
+	tempDir := CreateSampleStructureFromMap(t, map[string]string{"file.txt": "content", "other.txt": "other"})
+	filePath := filepath.Join(tempDir, "file.txt")
+	if err := unix.Setxattr(filePath, "user.origin", []byte("build"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+			t.Skip("the file system does not support user extended attributes")
+		}
+		require.NoError(t, err)
+	}
+	_, err := ExecuteCommandWithCapture(t, NewGenerateCmd(), []string{tempDir, "--xattrs"})
+	require.NoError(t, err)
+
+	output, err := ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	require.NoError(t, err)
+	assert.Contains(t, output, "verified 1 manifest(s)")
+
+	require.NoError(t, unix.Setxattr(filePath, "user.origin", []byte("tampered"), 0))
+	require.NoError(t, unix.Setxattr(filepath.Join(tempDir, "other.txt"), "user.origin", []byte("new"), 0))
+	output, _ = ExecuteCommandWithCapture(t, NewVerifyCommand(), []string{"--color", "always", tempDir})
+	assert.Contains(t, output, "extended attributes changed:"+ui.ColorReset+" file.txt")
+	assert.Contains(t, output, "extended attributes changed:"+ui.ColorReset+" other.txt")
+}
@@ -0,0 +1,160 @@
+// Package analyze derives reports from the entities recorded in manifests, without reading the files they describe
+package analyze
+
+import (
+	"path"
+	"sort"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// DuplicateSet lists files sharing a checksum
+type DuplicateSet struct {
+	Checksum string `json:"checksum"`
+	// Size is the size of each copy in bytes
+	Size int64 `json:"size"`
+	// Paths are relative to the tree root, slash-separated and sorted
+	Paths []string `json:"paths"`
+	// WastedBytes is the size of all copies but one, what removing the duplicates would save.
+	// Hard links of one file are a single copy, see manifest.Entity.LinkGroup.
+	WastedBytes int64 `json:"wastedBytes"`
+}
+
+// DuplicateReport is the result of DuplicateFinder.Report
+type DuplicateReport struct {
+	// Sets are sorted by WastedBytes, largest first, then by checksum
+	Sets []DuplicateSet `json:"sets"`
+	// Files counts the files analyzed, at least as large as the minimum size
+	Files int64 `json:"files"`
+	// DuplicateFiles counts the files of all sets
+	DuplicateFiles int64 `json:"duplicateFiles"`
+	// WastedBytes is the sum of the WastedBytes of all sets
+	WastedBytes int64 `json:"wastedBytes"`
+}
+
+// fileRef identifies a file by the index of its directory in DuplicateFinder.dirs and its name,
+// so that the path of each directory is held once however many files it has
+type fileRef struct {
+	dir       int32
+	name      string
+	linkGroup string
+}
+
+// checksumGroup holds the files found so far with one checksum
+type checksumGroup struct {
+	size  int64
+	files []fileRef
+}
+
+// DuplicateFinder groups files by checksum as Add is called with the entities of a tree, e.g. with millions of
+// them read from manifests one directory at a time. It holds one reference per file, not its full path.
+// Passing the entities to Count first makes Add hold references only for files sharing their checksum.
+type DuplicateFinder struct {
+	minSize int64
+	dirs    []string
+	dirIDs  map[string]int32
+	groups  map[string]*checksumGroup
+	// counts holds the number of files of every checksum passed to Count, nil if it was not called
+	counts map[string]int32
+	files  int64
+}
+
+// NewDuplicateFinder creates a DuplicateFinder leaving out files smaller than minSize bytes.
+// Empty files are always left out, they all share one checksum without wasting space.
+func NewDuplicateFinder(minSize int64) *DuplicateFinder {
+	return &DuplicateFinder{
+		minSize: max(minSize, 1),
+		dirIDs:  make(map[string]int32),
+		groups:  make(map[string]*checksumGroup),
+	}
+}
+
+// Count records the checksum of entity without a reference to its file. Once the entities of the whole tree
+// are counted, Add leaves out the files whose checksum no other file shares.
+func (f *DuplicateFinder) Count(entity manifest.Entity) {
+	if !f.eligible(entity) {
+		return
+	}
+	if f.counts == nil {
+		f.counts = make(map[string]int32)
+	}
+	f.counts[entity.Checksum]++
+}
+
+// Add records the entity of the directory dir, a slash-separated path relative to the tree root, "." for the
+// root itself. Only hashed regular files are recorded, their Size must be set. Manifests of older versions do
+// not record it, see StoredEntities.
+func (f *DuplicateFinder) Add(dir string, entity manifest.Entity) {
+	if !f.eligible(entity) {
+		return
+	}
+	f.files++
+	if f.counts != nil && f.counts[entity.Checksum] < 2 {
+		return
+	}
+	id, ok := f.dirIDs[dir]
+	if !ok {
+		id = int32(len(f.dirs))
+		f.dirs = append(f.dirs, dir)
+		f.dirIDs[dir] = id
+	}
+	group := f.groups[entity.Checksum]
+	if group == nil {
+		group = &checksumGroup{size: *entity.Size}
+		f.groups[entity.Checksum] = group
+	}
+	group.files = append(group.files, fileRef{dir: id, name: entity.Name, linkGroup: entity.LinkGroup})
+}
+
+// eligible reports whether entity is a hashed regular file of at least the minimum size
+func (f *DuplicateFinder) eligible(entity manifest.Entity) bool {
+	return !entity.IsDir && entity.Special == "" && entity.Checksum != "" && entity.Size != nil &&
+		*entity.Size >= f.minSize
+}
+
+// copies returns the number of distinct files of group, hard links of one file count once
+func (g *checksumGroup) copies() int {
+	linkGroups := make(map[string]bool)
+	copies := 0
+	for _, file := range g.files {
+		if file.linkGroup == "" {
+			copies++
+		} else if !linkGroups[file.linkGroup] {
+			linkGroups[file.linkGroup] = true
+			copies++
+		}
+	}
+	return copies
+}
+
+// Report returns the sets of files sharing a checksum, see DuplicateReport
+func (f *DuplicateFinder) Report() *DuplicateReport {
+	report := &DuplicateReport{Sets: make([]DuplicateSet, 0), Files: f.files}
+	for checksum, group := range f.groups {
+		copies := group.copies()
+		if copies < 2 {
+			continue
+		}
+		set := DuplicateSet{
+			Checksum:    checksum,
+			Size:        group.size,
+			Paths:       make([]string, 0, len(group.files)),
+			WastedBytes: group.size * int64(copies-1),
+		}
+		for _, file := range group.files {
+			set.Paths = append(set.Paths, path.Join(f.dirs[file.dir], file.name))
+		}
+		sort.Strings(set.Paths)
+		report.Sets = append(report.Sets, set)
+		report.DuplicateFiles += int64(len(group.files))
+		report.WastedBytes += set.WastedBytes
+	}
+	sort.Slice(report.Sets, func(i, j int) bool {
+		a, b := report.Sets[i], report.Sets[j]
+		if a.WastedBytes != b.WastedBytes {
+			return a.WastedBytes > b.WastedBytes
+		}
+		return a.Checksum < b.Checksum
+	})
+	return report
+}
@@ -0,0 +1,164 @@
+package analyze
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+func size(n int64) *int64 {
+	return &n
+}
+
+func TestDuplicateFinder_mustGroupByChecksumSortedBySavings(t *testing.T) {
+	finder := NewDuplicateFinder(0)
+	finder.Add(".", manifest.Entity{Name: "a", Checksum: "small", Size: size(10)})
+	finder.Add("x", manifest.Entity{Name: "a", Checksum: "small", Size: size(10)})
+	finder.Add("x/y", manifest.Entity{Name: "a", Checksum: "small", Size: size(10)})
+	finder.Add(".", manifest.Entity{Name: "big", Checksum: "large", Size: size(100)})
+	finder.Add("x", manifest.Entity{Name: "big-copy", Checksum: "large", Size: size(100)})
+	finder.Add(".", manifest.Entity{Name: "unique", Checksum: "unique", Size: size(1000)})
+	// Neither directories, special files, empty files nor files without a size are grouped
+	finder.Add(".", manifest.Entity{Name: "x", Checksum: "large", IsDir: true})
+	finder.Add(".", manifest.Entity{Name: "fifo", Checksum: "small", Special: manifest.SpecialFIFO})
+	finder.Add(".", manifest.Entity{Name: "e1", Checksum: "empty", Size: size(0)})
+	finder.Add("x", manifest.Entity{Name: "e2", Checksum: "empty", Size: size(0)})
+	finder.Add("x", manifest.Entity{Name: "old", Checksum: "small"})
+
+	report := finder.Report()
+
+	assert.Equal(t, []DuplicateSet{
+		{Checksum: "large", Size: 100, Paths: []string{"big", "x/big-copy"}, WastedBytes: 100},
+		{Checksum: "small", Size: 10, Paths: []string{"a", "x/a", "x/y/a"}, WastedBytes: 20},
+	}, report.Sets)
+	assert.Equal(t, int64(6), report.Files)
+	assert.Equal(t, int64(5), report.DuplicateFiles)
+	assert.Equal(t, int64(120), report.WastedBytes)
+}
+
+func TestDuplicateFinder_WithMinSize_mustLeaveOutSmallerFiles(t *testing.T) {
+	finder := NewDuplicateFinder(50)
+	finder.Add(".", manifest.Entity{Name: "a", Checksum: "small", Size: size(10)})
+	finder.Add(".", manifest.Entity{Name: "b", Checksum: "small", Size: size(10)})
+	finder.Add(".", manifest.Entity{Name: "c", Checksum: "large", Size: size(50)})
+	finder.Add(".", manifest.Entity{Name: "d", Checksum: "large", Size: size(50)})
+
+	report := finder.Report()
+
+	require.Len(t, report.Sets, 1)
+	assert.Equal(t, []string{"c", "d"}, report.Sets[0].Paths)
+	assert.Equal(t, int64(2), report.Files)
+}
+
+func TestDuplicateFinder_WithCount_mustHoldOnlyFilesWithDuplicates(t *testing.T) {
+	entities := []manifest.Entity{
+		{Name: "a", Checksum: "shared", Size: size(10)},
+		{Name: "unique", Checksum: "unique", Size: size(10)},
+		{Name: "b", Checksum: "shared", Size: size(10)},
+	}
+	finder := NewDuplicateFinder(0)
+	for _, entity := range entities {
+		finder.Count(entity)
+	}
+	for _, entity := range entities {
+		finder.Add(".", entity)
+	}
+
+	assert.NotContains(t, finder.groups, "unique")
+	report := finder.Report()
+	require.Len(t, report.Sets, 1)
+	assert.Equal(t, []string{"a", "b"}, report.Sets[0].Paths)
+	assert.Equal(t, int64(3), report.Files)
+}
+
+func TestDuplicateFinder_WithHardlinks_mustNotCountThemAsWasted(t *testing.T) {
+	finder := NewDuplicateFinder(0)
+	finder.Add(".", manifest.Entity{Name: "a", Checksum: "linked", Size: size(10), LinkGroup: "1"})
+	finder.Add("x", manifest.Entity{Name: "a-link", Checksum: "linked", Size: size(10), LinkGroup: "1"})
+	finder.Add(".", manifest.Entity{Name: "b", Checksum: "copied", Size: size(10), LinkGroup: "2"})
+	finder.Add("x", manifest.Entity{Name: "b-link", Checksum: "copied", Size: size(10), LinkGroup: "2"})
+	finder.Add("x", manifest.Entity{Name: "b-copy", Checksum: "copied", Size: size(10)})
+
+	report := finder.Report()
+
+	require.Len(t, report.Sets, 1)
+	assert.Equal(t, []string{"b", "x/b-copy", "x/b-link"}, report.Sets[0].Paths)
+	assert.Equal(t, int64(10), report.Sets[0].WastedBytes)
+	assert.Equal(t, int64(10), report.WastedBytes)
+}
+
+// createDuplicateTree creates a tree holding two sets of duplicates, wasting 2*6 and 4 bytes
+func createDuplicateTree(t *testing.T) string {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.txt":           "shared",
+		"docs/a-copy.txt": "shared",
+		"docs/deep/a.txt": "shared",
+		"b.bin":           "blob",
+		"docs/b.bin":      "blob",
+		"unique.txt":      "unique content",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestStoredEntities_mustFindDuplicatesOfGeneratedTree(t *testing.T) {
+	root := createDuplicateTree(t)
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), root))
+
+	for name, collect := range map[string]func(fn EntityFunc) error{
+		"stored": func(fn EntityFunc) error {
+			return StoredEntities(context.Background(), root, manifest.DefaultName, fn)
+		},
+		"scanned": func(fn EntityFunc) error {
+			return ScannedEntities(context.Background(), scanner.New(), root, fn)
+		},
+	} {
+		finder := NewDuplicateFinder(0)
+		require.NoError(t, collect(func(dir string, entity manifest.Entity) error {
+			finder.Add(dir, entity)
+			return nil
+		}), name)
+
+		report := finder.Report()
+		require.Len(t, report.Sets, 2, name)
+		assert.Equal(t, []string{"a.txt", "docs/a-copy.txt", "docs/deep/a.txt"}, report.Sets[0].Paths, name)
+		assert.Equal(t, int64(12), report.Sets[0].WastedBytes, name)
+		assert.Equal(t, []string{"b.bin", "docs/b.bin"}, report.Sets[1].Paths, name)
+		assert.Equal(t, int64(16), report.WastedBytes, name)
+		assert.Equal(t, int64(6), report.Files, name)
+	}
+}
+
+func TestStoredEntities_WithoutRecordedSizes_mustStatFiles(t *testing.T) {
+	root := createDuplicateTree(t)
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), root))
+	// Drop the sizes, as in manifests written by older versions
+	manifestPath := filepath.Join(root, manifest.DefaultName)
+	m, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	for i := range m.Entities {
+		m.Entities[i].Size = nil
+	}
+	require.NoError(t, m.Save(manifestPath))
+
+	var sizes = make(map[string]int64)
+	require.NoError(t, StoredEntities(context.Background(), root, manifest.DefaultName, func(dir string, entity manifest.Entity) error {
+		if dir == "." && entity.Size != nil {
+			sizes[entity.Name] = *entity.Size
+		}
+		return nil
+	}))
+
+	assert.Equal(t, map[string]int64{"a.txt": 6, "b.bin": 4, "unique.txt": 14}, sizes)
+}
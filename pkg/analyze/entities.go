@@ -0,0 +1,84 @@
+package analyze
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+)
+
+// EntityFunc is called with every entity of a tree and the directory listing it, a slash-separated path
+// relative to the tree root, see DuplicateFinder.Add
+type EntityFunc func(dir string, entity manifest.Entity) error
+
+// StoredEntities calls fn with the entities of the manifests named manifestName in the tree rooted at root,
+// without reading any file. Manifests written by older versions do not record file sizes, they are then taken
+// from the file system, files that vanished since are passed without one. Directories without a manifest are
+// left out.
+func StoredEntities(ctx context.Context, root, manifestName string, fn EntityFunc) error {
+	return traverse.WalkPostOrder(ctx, root, func(ctx context.Context, dirPath string, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		manifestPath := filepath.Join(dirPath, manifestName)
+		m, err := manifest.LoadManifest(manifestPath)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest for %s: %w", manifestPath, err)
+		}
+		if m == nil {
+			return nil
+		}
+		dir, err := relativeDir(root, dirPath)
+		if err != nil {
+			return err
+		}
+		for _, entity := range m.Entities {
+			if entity.Size == nil && !entity.IsDir && entity.Special == "" {
+				if info, err := os.Lstat(filepath.Join(dirPath, manifest.LocalName(entity.Name))); err == nil {
+					size := info.Size()
+					entity.Size = &size
+				}
+			}
+			if err := fn(dir, entity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ScannedEntities calls fn with the entities of the manifests sc computes from the current content of the tree
+// rooted at root, hashing every file
+func ScannedEntities(ctx context.Context, sc *scanner.Scanner, root string, fn EntityFunc) error {
+	return sc.Walk(ctx, root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to scan directory: %w", err)
+		}
+		dir, err := relativeDir(root, dirPath)
+		if err != nil {
+			return err
+		}
+		for _, entity := range m.Entities {
+			if err := fn(dir, entity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func relativeDir(root, dirPath string) (string, error) {
+	relPath, err := filepath.Rel(root, dirPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine relative path of %s: %w", dirPath, err)
+	}
+	// Paths use forward slashes so reports look the same on every OS
+	return manifest.PortableName(relPath), nil
+}
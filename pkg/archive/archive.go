@@ -0,0 +1,413 @@
+// Package archive exposes the contents of tar and zip archives as a read-only fs.FS,
+// so that trees shipped as archives can be verified without extracting them.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSymlinkHops bounds the resolution of chained symbolic links
+const maxSymlinkHops = 40
+
+// FS is a read-only file system with the contents of an archive. Only the index of the entries is held in
+// memory, file contents are read on demand from the archive file, or from a temporary copy of compressed tar
+// archives and tar streams, see NewTarFS.
+type FS struct {
+	nodes  map[string]*node
+	closer io.Closer
+}
+
+// node is a file, directory or symbolic link of the archive
+type node struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+	open    func() (io.ReadCloser, error) // contents of files
+	target  string                        // target of symbolic links
+	// explicit is false for directories that are only implied by the paths of their contents
+	explicit bool
+	children []*node
+}
+
+// Open reads the archive at archivePath. Tar archives, optionally gzip-compressed,
+// and zip archives are recognized by their content. Close must be called when the FS is no longer used.
+func Open(archivePath string) (*FS, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		f.Close()
+		return nil, fmt.Errorf("failed to read archive '%s': %w", archivePath, err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		fsys, err := NewZipFS(f, info.Size())
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid zip archive '%s': %w", archivePath, err)
+		}
+		fsys.closer = f
+		return fsys, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		defer f.Close()
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive '%s': %w", archivePath, err)
+		}
+		defer gz.Close()
+		fsys, err := NewTarFS(gz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive '%s': %w", archivePath, err)
+		}
+		return fsys, nil
+	default:
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		fsys, err := NewTarFSAt(f, info.Size())
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid tar archive '%s': %w", archivePath, err)
+		}
+		fsys.closer = f
+		return fsys, nil
+	}
+}
+
+// NewTarFS indexes a tar stream, which cannot be read again, by copying it to a temporary file first.
+// The copy is removed by Close. Use NewTarFSAt for tar archives that can be read at any offset.
+func NewTarFS(r io.Reader) (*FS, error) {
+	tmp, err := os.CreateTemp("", "bytecheck-archive-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	closer := &tempFile{File: tmp}
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	fsys, err := NewTarFSAt(tmp, size)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	fsys.closer = closer
+	return fsys, nil
+}
+
+// tempFile removes the temporary file it wraps when closed
+type tempFile struct {
+	*os.File
+}
+
+func (t *tempFile) Close() error {
+	return errors.Join(t.File.Close(), os.Remove(t.Name()))
+}
+
+// NewTarFSAt indexes an uncompressed tar archive, file contents are read from r when opened.
+// Hard links, sparse files, duplicate entries and entries with absolute paths or paths leaving the archive
+// are rejected.
+func NewTarFSAt(r io.ReaderAt, size int64) (*FS, error) {
+	fsys := newFS()
+	// The tar reader skips the contents of the entries by seeking, it reads only their headers
+	section := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(section)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		n := &node{mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime, size: hdr.Size}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeDir:
+		case tar.TypeReg, tar.TypeRegA:
+			if isSparse(hdr) {
+				return nil, fmt.Errorf("entry '%s' is a sparse file, sparse files are not supported", hdr.Name)
+			}
+			// The contents of the entry start right after its headers
+			offset, err := section.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			if offset+hdr.Size > size {
+				return nil, fmt.Errorf("entry '%s' is truncated", hdr.Name)
+			}
+			n.open = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(r, offset, n.size)), nil
+			}
+		case tar.TypeSymlink:
+			n.target = hdr.Linkname
+		case tar.TypeLink:
+			return nil, fmt.Errorf("entry '%s' is a hard link to '%s', hard links are not supported", hdr.Name, hdr.Linkname)
+		default:
+			return nil, fmt.Errorf("entry '%s' has unsupported type '%c'", hdr.Name, hdr.Typeflag)
+		}
+		if err := fsys.add(hdr.Name, n); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isSparse reports whether hdr describes a sparse file in the PAX format, whose contents
+// are not stored as they are read
+func isSparse(hdr *tar.Header) bool {
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// NewZipFS indexes a zip archive, file contents are read from r when opened.
+// Duplicate entries and entries with absolute paths or paths leaving the archive are rejected.
+func NewZipFS(r io.ReaderAt, size int64) (*FS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, err
+	}
+	fsys := newFS()
+	for _, f := range zr.File {
+		n := &node{mode: f.Mode(), modTime: f.Modified, size: int64(f.UncompressedSize64), open: f.Open}
+		if n.mode&fs.ModeSymlink != 0 {
+			target, err := readZipSymlink(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read entry '%s': %w", f.Name, err)
+			}
+			n.target, n.open = target, nil
+		}
+		if err := fsys.add(f.Name, n); err != nil {
+			return nil, err
+		}
+	}
+	return fsys, nil
+}
+
+// readZipSymlink returns the target of a symbolic link, which zip stores as the file content
+func readZipSymlink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(rc)
+	return string(target), err
+}
+
+func newFS() *FS {
+	return &FS{nodes: map[string]*node{
+		".": {name: ".", mode: fs.ModeDir | 0o755},
+	}}
+}
+
+// Close releases the underlying archive file, if any, and removes the temporary copy made by NewTarFS
+func (fsys *FS) Close() error {
+	if fsys.closer == nil {
+		return nil
+	}
+	return fsys.closer.Close()
+}
+
+// cleanName validates an entry name and converts it into an fs.FS path
+func cleanName(name string) (string, error) {
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("entry '%s' has an absolute path", name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("entry '%s' points outside the archive", name)
+	}
+	return cleaned, nil
+}
+
+// add stores n under name, creating implicit parent directories
+func (fsys *FS) add(name string, n *node) error {
+	cleaned, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	n.name = path.Base(cleaned)
+	n.explicit = true
+	if existing, ok := fsys.nodes[cleaned]; ok {
+		if existing.explicit || !n.mode.IsDir() {
+			return fmt.Errorf("duplicate entry '%s'", name)
+		}
+		existing.mode, existing.modTime, existing.explicit = n.mode, n.modTime, true
+		return nil
+	}
+	if cleaned == "." {
+		return fmt.Errorf("entry '%s' replaces the archive root", name)
+	}
+	parent, err := fsys.dir(path.Dir(cleaned), name)
+	if err != nil {
+		return err
+	}
+	fsys.nodes[cleaned] = n
+	parent.children = append(parent.children, n)
+	return nil
+}
+
+// dir returns the directory dirName, creating it and its parents if needed.
+// entryName is the entry being added, for error messages.
+func (fsys *FS) dir(dirName string, entryName string) (*node, error) {
+	if existing, ok := fsys.nodes[dirName]; ok {
+		if !existing.mode.IsDir() {
+			return nil, fmt.Errorf("entry '%s' is inside '%s', which is not a directory", entryName, dirName)
+		}
+		return existing, nil
+	}
+	parent, err := fsys.dir(path.Dir(dirName), entryName)
+	if err != nil {
+		return nil, err
+	}
+	n := &node{name: path.Base(dirName), mode: fs.ModeDir | 0o755}
+	fsys.nodes[dirName] = n
+	parent.children = append(parent.children, n)
+	return n, nil
+}
+
+// lookup returns the node of name, following a final symbolic link if follow is set
+func (fsys *FS) lookup(op string, name string, follow bool) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	current := name
+	for hops := 0; ; hops++ {
+		n, ok := fsys.nodes[current]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !follow || n.mode&fs.ModeSymlink == 0 {
+			return n, nil
+		}
+		if hops == maxSymlinkHops {
+			return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		if path.IsAbs(n.target) {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("symbolic link to '%s' points outside the archive", n.target)}
+		}
+		current = path.Join(path.Dir(current), n.target)
+		if current == ".." || strings.HasPrefix(current, "../") {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("symbolic link to '%s' points outside the archive", n.target)}
+		}
+	}
+}
+
+// Open opens the named file, following symbolic links
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if n.mode.IsDir() {
+		return &dirFile{node: n, entries: n.dirEntries()}, nil
+	}
+	var rc io.ReadCloser = io.NopCloser(bytes.NewReader(nil))
+	if n.open != nil {
+		if rc, err = n.open(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return &file{node: n, ReadCloser: rc}, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return n.dirEntries(), nil
+}
+
+// Stat returns information about the named file, following symbolic links
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *node) dirEntries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+// node implements fs.FileInfo
+func (n *node) Name() string       { return n.name }
+func (n *node) Size() int64        { return n.size }
+func (n *node) Mode() fs.FileMode  { return n.mode }
+func (n *node) ModTime() time.Time { return n.modTime }
+func (n *node) IsDir() bool        { return n.mode.IsDir() }
+func (n *node) Sys() any           { return nil }
+
+type file struct {
+	node *node
+	io.ReadCloser
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.node, nil }
+
+type dirFile struct {
+	node    *node
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.node, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if count > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && count < len(remaining) {
+		remaining = remaining[:count]
+	}
+	d.offset += len(remaining)
+	return remaining, nil
+}
@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func buildTar(t *testing.T, entries ...tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.content))
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		require.NoError(t, tw.WriteHeader(&hdr))
+		if e.content != "" {
+			_, err := tw.Write([]byte(e.content))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func regularFile(name, content string) tarEntry {
+	return tarEntry{hdr: tar.Header{Name: name, Typeflag: tar.TypeReg}, content: content}
+}
+
+func TestNewTarFS(t *testing.T) {
+	data := buildTar(t,
+		tarEntry{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0o755}},
+		regularFile("./a.txt", "a"),
+		regularFile("./sub/b.txt", "b"),
+		tarEntry{hdr: tar.Header{Name: "./sub/", Typeflag: tar.TypeDir, Mode: 0o700}},
+		tarEntry{hdr: tar.Header{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "sub/b.txt"}},
+	)
+	fsys, err := NewTarFS(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	require.NoError(t, fstest.TestFS(fsys, "a.txt", "sub/b.txt", "link"))
+
+	content, err := fs.ReadFile(fsys, "link")
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+	info, err := fs.Stat(fsys, "sub")
+	require.NoError(t, err)
+	assert.Equal(t, fs.ModeDir|0o700, info.Mode())
+}
+
+// countingReaderAt counts the bytes read from an archive
+type countingReaderAt struct {
+	r    *bytes.Reader
+	read int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += n
+	return n, err
+}
+
+func TestNewTarFSAt_mustReadContentsOnlyWhenOpened(t *testing.T) {
+	large := strings.Repeat("x", 1<<20)
+	data := buildTar(t, regularFile("large.bin", large), regularFile("small.txt", "small"))
+	r := &countingReaderAt{r: bytes.NewReader(data)}
+
+	fsys, err := NewTarFSAt(r, int64(len(data)))
+	require.NoError(t, err)
+	assert.Less(t, r.read, 1<<16, "indexing must skip the contents of the entries")
+
+	content, err := fs.ReadFile(fsys, "small.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "small", string(content))
+	content, err = fs.ReadFile(fsys, "large.bin")
+	require.NoError(t, err)
+	assert.Equal(t, large, string(content))
+	require.NoError(t, fstest.TestFS(fsys, "large.bin", "small.txt"))
+}
+
+func TestNewTarFS_InvalidEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr string
+	}{
+		{
+			name: "hard link",
+			entries: []tarEntry{regularFile("a.txt", "a"),
+				{hdr: tar.Header{Name: "b.txt", Typeflag: tar.TypeLink, Linkname: "a.txt"}}},
+			wantErr: "entry 'b.txt' is a hard link to 'a.txt', hard links are not supported",
+		},
+		{
+			name:    "duplicate",
+			entries: []tarEntry{regularFile("sub/a.txt", "a"), regularFile("./sub/a.txt", "b")},
+			wantErr: "duplicate entry './sub/a.txt'",
+		},
+		{
+			name:    "absolute path",
+			entries: []tarEntry{regularFile("/etc/passwd", "x")},
+			wantErr: "entry '/etc/passwd' has an absolute path",
+		},
+		{
+			name:    "parent path",
+			entries: []tarEntry{regularFile("sub/../../a.txt", "x")},
+			wantErr: "entry 'sub/../../a.txt' points outside the archive",
+		},
+		{
+			name:    "file used as directory",
+			entries: []tarEntry{regularFile("a", "x"), regularFile("a/b", "y")},
+			wantErr: "entry 'a/b' is inside 'a', which is not a directory",
+		},
+		{
+			name:    "device",
+			entries: []tarEntry{{hdr: tar.Header{Name: "null", Typeflag: tar.TypeChar}}},
+			wantErr: "entry 'null' has unsupported type '3'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTarFS(bytes.NewReader(buildTar(t, tt.entries...)))
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestFS_SymlinkOutsideArchive(t *testing.T) {
+	data := buildTar(t,
+		tarEntry{hdr: tar.Header{Name: "abs", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+		tarEntry{hdr: tar.Header{Name: "rel", Typeflag: tar.TypeSymlink, Linkname: "../secret"}},
+	)
+	fsys, err := NewTarFS(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	_, err = fsys.Open("abs")
+	assert.ErrorContains(t, err, "points outside the archive")
+	_, err = fsys.Open("rel")
+	assert.ErrorContains(t, err, "points outside the archive")
+}
+
+func TestNewZipFS(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	fsys, err := NewZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys, "a.txt", "sub/b.txt"))
+}
+
+func TestNewZipFS_Duplicate(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "a.txt"} {
+		_, err := zw.Create(name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	_, err := NewZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.EqualError(t, err, "duplicate entry 'a.txt'")
+}
+
+func TestOpen_DetectsFormat(t *testing.T) {
+	tarData := buildTar(t, regularFile("a.txt", "a"))
+	var gzData bytes.Buffer
+	gz := gzip.NewWriter(&gzData)
+	_, err := gz.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	var zipData bytes.Buffer
+	zw := zip.NewWriter(&zipData)
+	w, err := zw.Create("a.txt")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	for name, data := range map[string][]byte{"a.tar": tarData, "a.tar.gz": gzData.Bytes(), "a.zip": zipData.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(archivePath, data, 0644))
+			fsys, err := Open(archivePath)
+			require.NoError(t, err)
+			defer fsys.Close()
+
+			content, err := fs.ReadFile(fsys, "a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "a", string(content))
+		})
+	}
+}
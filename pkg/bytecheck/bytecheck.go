@@ -0,0 +1,806 @@
+// Package bytecheck is the high-level API for embedding bytecheck in other programs.
+// It wires the scanner, generator, verifier and trust verifiers the same way the CLI does,
+// which uses this package itself. Functions, options and report types of this package are stable.
+package bytecheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/archive"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/remote"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/state"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GenerateReport is the result of GenerateTree and AttestTree
+type GenerateReport struct {
+	// Directories is the number of directories processed, including cached ones
+	Directories int64
+	// Cached is the number of directories whose fresh manifest was reused
+	Cached int64
+	// Vanished is the number of entries that disappeared during the scan and were left out
+	Vanished int64
+	// ManifestsWritten lists paths of the manifests written (generated or co-signed)
+	ManifestsWritten []string
+	// RootDigest commits to the whole tree, see manifest.RootDigest. Empty for AttestTree, and for RegeneratePath
+	// when the changes affect no manifest.
+	RootDigest string
+	// Subtree holds the totals of the whole tree recorded in the root manifest, nil if unknown or for AttestTree
+	Subtree *manifest.SubtreeTotals
+	// Signatures counts the existing signatures kept or dropped when generating without a signer
+	Signatures generator.SignatureStats
+	// DryRun lists what would happen to the manifest of every directory processed, set by WithDryRun
+	DryRun []generator.DryRunDirectory
+	// Stats are the final scan statistics
+	Stats *scanner.Stats
+	// Regenerated lists the directories given to RegenerateDirectories whose manifests were written
+	Regenerated []string
+	// AncestorsUpdated lists the other directories whose manifests RegenerateDirectories wrote,
+	// the ancestors recording the new checksums
+	AncestorsUpdated []string
+	// Skipped lists the paths given to RegenerateDirectories that were left out, with the reason
+	Skipped []SkippedPath
+}
+
+// SkippedPath is a path RegenerateDirectories left out
+type SkippedPath struct {
+	Path   string
+	Reason string
+}
+
+// VerifyReport is the result of VerifyTree. Result holds per-directory and per-auditor
+// statuses, the summary and the root digest of the recomputed tree.
+type VerifyReport struct {
+	*verifier.Result
+}
+
+// GenerateTree writes a manifest into every directory of the tree rooted at dir.
+// Manifests are signed when WithSigner is given.
+func GenerateTree(ctx context.Context, dir string, opts ...Option) (report *GenerateReport, err error) {
+	o := makeOptions(opts...)
+	if err := o.checkOnly(os.DirFS(dir)); err != nil {
+		return nil, err
+	}
+	return o.generate(func(gen *generator.Generator) error {
+		return gen.Generate(ctx, dir)
+	})
+}
+
+// RegeneratePath updates only the manifests of the tree rooted at dir that are affected by changes of
+// changedPaths: the directories containing them, the subtrees of changed directories and all their ancestors,
+// see generator.Generator.RegeneratePath. It suits trees whose manifests are kept up to date, e.g. by watching
+// them. WithOnly does not apply.
+func RegeneratePath(ctx context.Context, dir string, changedPaths []string, opts ...Option) (report *GenerateReport, err error) {
+	o := makeOptions(opts...)
+	o.only = nil
+	return o.generate(func(gen *generator.Generator) error {
+		return gen.RegeneratePath(ctx, dir, changedPaths...)
+	})
+}
+
+// RegenerateDirectories updates the manifests of the directories dirPaths and then of their ancestors up to dir,
+// so that the tree rooted at dir stays consistent, without scanning other directories, see
+// generator.Generator.RegenerateDirectories. Relative paths are resolved against the working directory.
+// Paths outside dir, duplicates and paths that are not existing directories are reported in
+// GenerateReport.Skipped instead of failing the run. WithOnly does not apply.
+func RegenerateDirectories(ctx context.Context, dir string, dirPaths []string, opts ...Option) (report *GenerateReport, err error) {
+	o := makeOptions(opts...)
+	o.only = nil
+	if o.dryRun {
+		return nil, fmt.Errorf("a dry run cannot regenerate a list of directories")
+	}
+	targets, skipped, err := resolveDirectories(dir, dirPaths)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return &GenerateReport{Skipped: skipped, Stats: &scanner.Stats{}}, nil
+	}
+	report, err = o.generate(func(gen *generator.Generator) error {
+		return gen.RegenerateDirectories(ctx, dir, targets...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	isTarget := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		isTarget[target] = true
+	}
+	for _, written := range report.ManifestsWritten {
+		if isTarget[filepath.Clean(written)] {
+			report.Regenerated = append(report.Regenerated, written)
+			delete(isTarget, filepath.Clean(written))
+		} else {
+			report.AncestorsUpdated = append(report.AncestorsUpdated, written)
+		}
+	}
+	// The scan leaves out excluded directories, those deeper than WithMaxDepth and fresh ones
+	for _, target := range targets {
+		if isTarget[target] {
+			skipped = append(skipped, SkippedPath{Path: target, Reason: "excluded, too deep or still fresh"})
+		}
+	}
+	report.Skipped = skipped
+	return report, nil
+}
+
+// RepairReport is the result of RepairTree
+type RepairReport struct {
+	// Before is the verification finding the directories to repair
+	Before *VerifyReport
+	// Repaired lists the directories whose manifests were invalid or missing and were regenerated,
+	// or would be by a dry run
+	Repaired []string
+	// AncestorsUpdated lists the other directories whose manifests were regenerated to record the new checksums
+	AncestorsUpdated []string
+	// Regenerate reports regenerating the directories, nil for a dry run or when nothing needed repair
+	Regenerate *GenerateReport
+	// After is the verification of the repaired tree, nil for a dry run or when nothing needed repair
+	After *VerifyReport
+}
+
+// ErrSignaturesRemoved is returned by RepairTree when the manifests it would regenerate are signed but it has no
+// signer, see WithStripSignatures
+var ErrSignaturesRemoved = errors.New("signatures would be removed")
+
+// RepairTree verifies the tree rooted at dir and regenerates the manifests of the directories failing it, the ones
+// whose manifests are invalid, corrupt or missing, together with their ancestors, see RegenerateDirectories.
+// Without a signer, it refuses to regenerate signed manifests unless WithStripSignatures is set, see
+// ErrSignaturesRemoved: the regenerated ancestors include the root, whose signature covers the whole tree.
+// The repaired tree is verified again, see RepairReport.After. Issuers are not looked up while verifying, trust
+// does not decide which manifests to repair. Manifests record the metadata the root manifest does, see
+// WithTrackPermissions. With WithDryRun nothing is written, the directories are only listed, and every ancestor
+// of them is reported as updated.
+func RepairTree(ctx context.Context, dir string, opts ...Option) (*RepairReport, error) {
+	o := makeOptions(opts...)
+	// Every directory must have a status, the ancestors of the failing ones are regenerated too
+	verifyOpts := append(slices.Clone(opts), WithAllowMissingManifests(true),
+		WithTrustVerifier(issuer.NewMultiSourceVerifier()), WithStatusSink(nil))
+	before, err := VerifyTree(ctx, dir, verifyOpts...)
+	if err != nil {
+		return nil, err
+	}
+	report := &RepairReport{Before: before}
+	pathOf := make(map[string]string, len(before.DirectoryStatuses))
+	repaired := make(map[string]bool)
+	for _, status := range before.DirectoryStatuses {
+		pathOf[status.RelativePath] = status.Path
+		if ms := status.ManifestStatus; !ms.Found || !ms.Valid {
+			report.Repaired = append(report.Repaired, status.Path)
+			repaired[status.RelativePath] = true
+		}
+	}
+	if len(report.Repaired) == 0 {
+		return report, nil
+	}
+	// The ancestors of every verified directory are verified too, so they all have a status
+	ancestors := make(map[string]bool)
+	for rel := range repaired {
+		for rel != "." {
+			rel = filepath.Dir(rel)
+			if !repaired[rel] {
+				ancestors[rel] = true
+			}
+		}
+	}
+	if o.dryRun {
+		for rel := range ancestors {
+			report.AncestorsUpdated = append(report.AncestorsUpdated, pathOf[rel])
+		}
+		sort.Strings(report.AncestorsUpdated)
+		return report, nil
+	}
+	if o.signer == nil && !o.stripSignatures {
+		var signed []string
+		for _, status := range before.DirectoryStatuses {
+			if (repaired[status.RelativePath] || ancestors[status.RelativePath]) && status.ManifestStatus.Signed {
+				signed = append(signed, status.Path)
+			}
+		}
+		if len(signed) > 0 {
+			return nil, fmt.Errorf("%w: repairing without a signer would remove the signatures of %d manifest(s),"+
+				" including the one of %s", ErrSignaturesRemoved, len(signed), signed[0])
+		}
+	}
+
+	track := o.recordedTracking(dir)
+	regenerateOpts := append(slices.Clone(opts),
+		WithTrackPermissions(track.permissions), WithXattrs(track.xattrs), WithTrackHardlinks(track.hardlinks))
+	if report.Regenerate, err = RegenerateDirectories(ctx, dir, report.Repaired, regenerateOpts...); err != nil {
+		return nil, err
+	}
+	report.Repaired = report.Regenerate.Regenerated
+	report.AncestorsUpdated = report.Regenerate.AncestorsUpdated
+	if report.After, err = VerifyTree(ctx, dir, verifyOpts...); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// resolveDirectories returns dirPaths as paths below dir, together with the paths
+// that are not existing directories inside dir or that are listed more than once
+func resolveDirectories(dir string, dirPaths []string) (targets []string, skipped []SkippedPath, err error) {
+	absRoot, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	for _, dirPath := range dirPaths {
+		abs, err := filepath.Abs(dirPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		rel, err := filepath.Rel(absRoot, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			skipped = append(skipped, SkippedPath{Path: dirPath, Reason: "outside of " + dir})
+			continue
+		}
+		target := filepath.Join(dir, rel)
+		if seen[target] {
+			skipped = append(skipped, SkippedPath{Path: dirPath, Reason: "duplicate"})
+			continue
+		}
+		info, err := os.Lstat(abs)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			skipped = append(skipped, SkippedPath{Path: dirPath, Reason: "does not exist"})
+		case err != nil:
+			skipped = append(skipped, SkippedPath{Path: dirPath, Reason: err.Error()})
+		case !info.IsDir():
+			skipped = append(skipped, SkippedPath{Path: dirPath, Reason: "not a directory"})
+		default:
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets, skipped, nil
+}
+
+// generate runs generate with a generator configured by the options and reports its result
+func (o *options) generate(generate func(gen *generator.Generator) error) (report *GenerateReport, err error) {
+	if o.dryRun {
+		if o.stateFile != "" {
+			return nil, fmt.Errorf("a dry run cannot use a state file, it would be updated")
+		}
+		o.overlay = scanner.NewManifestOverlay()
+	}
+	// Files deleted by concurrent processes should not abort a whole generate run
+	sc, done, err := o.newScanner(tracking{permissions: o.trackPermissions, xattrs: o.trackXattrs, hardlinks: o.trackHardlinks}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if doneErr := done(); doneErr != nil && err == nil {
+			report, err = nil, doneErr
+		}
+	}()
+
+	genOpts, err := o.generatorOptions()
+	if err != nil {
+		return nil, err
+	}
+	if o.overlay != nil {
+		genOpts = append(genOpts, generator.WithDryRun(o.overlay))
+	}
+	gen := generator.New(sc, o.signer, genOpts...)
+	if err := generate(gen); err != nil {
+		return nil, err
+	}
+	report = newGenerateReport(gen.GetStats())
+	// RegeneratePath visits nothing when the changes affect no manifest
+	if report.Directories > 0 {
+		if report.RootDigest, err = gen.RootDigest(); err != nil {
+			return nil, err
+		}
+		report.Subtree = gen.RootSubtree()
+	}
+	return report, nil
+}
+
+// AttestTree co-signs the existing manifests of the tree rooted at dir with the signer given
+// by WithSigner. Every manifest must match its directory; other auditors' signatures are kept.
+func AttestTree(ctx context.Context, dir string, opts ...Option) (report *GenerateReport, err error) {
+	o := makeOptions(opts...)
+	if o.signer == nil {
+		return nil, fmt.Errorf("a signer is required to attest manifests")
+	}
+	sc, done, err := o.newScanner(o.recordedTracking(dir), false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if doneErr := done(); doneErr != nil && err == nil {
+			report, err = nil, doneErr
+		}
+	}()
+
+	genOpts, err := o.generatorOptions()
+	if err != nil {
+		return nil, err
+	}
+	gen := generator.New(sc, o.signer, genOpts...)
+	if err := gen.Attest(ctx, dir); err != nil {
+		return nil, err
+	}
+	return newGenerateReport(gen.GetStats()), nil
+}
+
+// VerifyTree checks every manifest of the tree rooted at dir against the directory content
+// and validates auditor signatures against the trust sources, see WithTrustVerifier.
+// Mismatches are reported in VerifyReport, the error is only returned when verification could not run.
+// When ctx is cancelled, the partial report is returned along with the error, see verifier.Result.Interrupted.
+// Mode and owner, and extended attributes, are compared when the root manifest records them.
+func VerifyTree(ctx context.Context, dir string, opts ...Option) (report *VerifyReport, err error) {
+	o := makeOptions(opts...)
+	if err := o.checkOnly(os.DirFS(dir)); err != nil {
+		return nil, err
+	}
+	if err := o.fetchRemoteManifests(ctx, dir); err != nil {
+		return nil, err
+	}
+	return o.verify(dir, o.recordedTracking(dir), func(vr *verifier.Verifier) (*verifier.Result, error) {
+		return vr.Verify(ctx, dir)
+	})
+}
+
+// VerifyPath is like VerifyTree but only checks the manifests affected by changes of changedPaths,
+// see RegeneratePath. WithOnly does not apply.
+func VerifyPath(ctx context.Context, dir string, changedPaths []string, opts ...Option) (report *VerifyReport, err error) {
+	o := makeOptions(opts...)
+	o.only = nil
+	if err := o.fetchRemoteManifests(ctx, dir); err != nil {
+		return nil, err
+	}
+	return o.verify(dir, o.recordedTracking(dir), func(vr *verifier.Verifier) (*verifier.Result, error) {
+		return vr.VerifyPath(ctx, dir, changedPaths...)
+	})
+}
+
+// fetchRemoteManifests fetches the manifests of the tree rooted at dir given by WithRemoteManifests, if any,
+// into an overlay replacing the manifests of the tree
+func (o *options) fetchRemoteManifests(ctx context.Context, dir string) error {
+	if o.remoteStore == nil {
+		return nil
+	}
+	if o.freshnessInterval > 0 || o.stateFile != "" {
+		return fmt.Errorf("freshness and state files cannot be used with remote manifests")
+	}
+	manifests, err := remote.Fetch(ctx, o.remoteStore, o.remoteTreeID, dir, o.manifestFileName())
+	if err != nil {
+		return err
+	}
+	o.remoteManifests = manifests
+	o.overlay = scanner.NewManifestOverlay()
+	for manifestPath, data := range manifests {
+		o.overlay.SetData(manifestPath, data)
+	}
+	return nil
+}
+
+// verify runs verify with a verifier configured by the options for the tree rooted at root.
+// The report given by WithReport is written even when verification fails.
+func (o *options) verify(root string, track tracking, verify func(vr *verifier.Verifier) (*verifier.Result, error)) (report *VerifyReport, err error) {
+	// Sample checksums, chunks and content types are recorded by generate, verification only reads the recorded ones
+	o.sampling = nil
+	o.chunkSize = 0
+	o.contentTypes = false
+	o.contentTypeVerify = true
+	// A touched manifest must not stand in for a directory that no longer matches it
+	o.freshListingCheck = true
+	var detachedSignature []byte
+	var allowedSigners []signing.AllowedSigner
+	if o.detachedSignature != "" {
+		if detachedSignature, err = os.ReadFile(o.detachedSignature); err != nil {
+			return nil, fmt.Errorf("failed to read detached signature: %w", err)
+		}
+		if allowedSigners, err = signing.LoadAllowedSigners(o.allowedSigners); err != nil {
+			return nil, err
+		}
+	}
+	trustVerifier := o.trustVerifier
+	if o.trustAnchors != "" {
+		anchors, err := issuer.LoadTrustAnchors(o.trustAnchors)
+		if err != nil {
+			return nil, err
+		}
+		// Pinned keys take precedence over every trust source
+		trustVerifier = issuer.NewPinnedVerifier(anchors, trustVerifier)
+	}
+	var verifierOpts []verifier.Option
+	if o.auditorPolicy != nil {
+		verifierOpts = append(verifierOpts, verifier.WithAuditorPolicy(o.auditorPolicy))
+	}
+	if o.requiredLabels != nil {
+		verifierOpts = append(verifierOpts, verifier.WithRequiredLabels(o.requiredLabels))
+	}
+	if o.allowMissing {
+		verifierOpts = append(verifierOpts, verifier.WithAllowMissingManifests(true))
+	}
+	if o.singleAuditorRun {
+		verifierOpts = append(verifierOpts, verifier.WithRequireSingleAuditorRun(true))
+	}
+	if o.requireSigned {
+		verifierOpts = append(verifierOpts, verifier.WithRequireSigned(true))
+	}
+	if o.requireTrusted {
+		verifierOpts = append(verifierOpts, verifier.WithRequireTrusted(true))
+	}
+	if o.refreshTimestamps {
+		verifierOpts = append(verifierOpts, verifier.WithRefreshTimestamps(true))
+	}
+	if o.ignoreHidden {
+		verifierOpts = append(verifierOpts, verifier.WithIgnoreHiddenDifferences(true))
+	}
+	if o.statusSink != nil {
+		verifierOpts = append(verifierOpts, verifier.WithStatusSink(o.statusSink),
+			verifier.WithMaxRetainedFailures(o.maxRetained))
+	}
+	if o.reportPath != "" {
+		var reportWriter *verifier.ReportWriter
+		if reportWriter, err = verifier.CreateReport(o.reportPath, root); err != nil {
+			return nil, err
+		}
+		verifierOpts = append(verifierOpts, verifier.WithDirectoryReport(reportWriter.WriteDirectory))
+		defer func() {
+			var result *verifier.Result
+			if report != nil {
+				result = report.Result
+			}
+			if finishErr := reportWriter.Finish(result, err); finishErr != nil && err == nil {
+				report, err = nil, finishErr
+			}
+		}()
+	}
+	sc, done, err := o.newScanner(track, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if doneErr := done(); doneErr != nil && err == nil {
+			report, err = nil, doneErr
+		}
+	}()
+
+	vr := verifier.New(sc, verifier.NewSimpleManifestAuditor(verifier.WithMaxClockSkew(o.maxClockSkew),
+		verifier.WithExpiryWarning(o.certExpiryWarning)),
+		trustVerifier, verifierOpts...)
+	result, err := verify(vr)
+	if err != nil {
+		if result != nil {
+			// A cancelled verification reports what was verified before it stopped
+			return &VerifyReport{Result: result}, err
+		}
+		return nil, err
+	}
+	if detachedSignature != nil {
+		result.DetachedSignature = verifier.CheckDetachedSignature(result, detachedSignature, allowedSigners,
+			o.signerIdentity, time.Now())
+	}
+	return &VerifyReport{Result: result}, nil
+}
+
+// SignRootDigest signs the digest of the root manifest of the tree rooted at dir with the signer given by
+// WithSigner, which must be a signing.SSHSigner, and returns the signature armored like `ssh-keygen -Y sign`
+// output together with the digest, see signing.SignDigest. The tree itself is not verified: its root manifest
+// commits to it, and WithDetachedSignature checks the signature against the recomputed digest.
+func SignRootDigest(dir string, opts ...Option) (signature []byte, digest string, err error) {
+	o := makeOptions(opts...)
+	if o.signer == nil {
+		return nil, "", fmt.Errorf("a signer is required to sign the root digest")
+	}
+	manifestPath := filepath.Join(dir, o.manifestFileName())
+	m, err := manifest.LoadManifest(manifestPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if m == nil {
+		return nil, "", fmt.Errorf("%w: %s does not exist", ErrNoManifests, manifestPath)
+	}
+	if digest, err = manifest.RootDigest(m); err != nil {
+		return nil, "", err
+	}
+	if signature, err = signing.SignDigest(o.signer, digest); err != nil {
+		return nil, "", err
+	}
+	return signature, digest, nil
+}
+
+// VerifySubtree is like VerifyTree for dir, a subdirectory of a tree with a signed root manifest, and proves that
+// dir belongs to that tree, see verifier.Verifier.VerifySubtree. rootDir holds the manifests of the ancestors laid
+// out like the tree, the directories may hold nothing else; a path to the root manifest stands for its directory.
+// subtreePath is the path of dir in the tree, it is computed when empty, which requires dir to be inside rootDir.
+// A broken chain is reported in VerifyReport.Chain, not as an error.
+func VerifySubtree(ctx context.Context, dir, rootDir, subtreePath string, opts ...Option) (report *VerifyReport, err error) {
+	o := makeOptions(opts...)
+	if err := o.checkOnly(os.DirFS(dir)); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(rootDir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		rootDir = filepath.Dir(rootDir)
+	}
+	if subtreePath == "" {
+		if subtreePath, err = pathBelow(rootDir, dir); err != nil {
+			return nil, err
+		}
+	}
+	return o.verify(dir, o.recordedTracking(dir), func(vr *verifier.Verifier) (*verifier.Result, error) {
+		return vr.VerifySubtree(ctx, dir, rootDir, subtreePath)
+	})
+}
+
+// pathBelow returns the path of dir relative to rootDir, which must contain it
+func pathBelow(rootDir, dir string) (string, error) {
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not a subdirectory of %s, the path of the subtree in the tree must be given", dir, rootDir)
+	}
+	return rel, nil
+}
+
+// VerifyArchive is like VerifyTree but checks the tree stored in a tar, tar.gz or zip archive
+// against the manifests inside it, without extracting it. Compressed tar archives are decompressed to a
+// temporary file first, see archive.NewTarFS. The tree is the root of the archive, or its single top-level
+// directory when only that directory holds a root manifest, as in archives of a directory like release-1.0/.
+// Freshness and state files do not apply to archives and are rejected.
+func VerifyArchive(ctx context.Context, archivePath string, opts ...Option) (report *VerifyReport, err error) {
+	o := makeOptions(opts...)
+	if o.freshnessInterval > 0 || o.stateFile != "" {
+		return nil, fmt.Errorf("freshness and state files cannot be used when verifying an archive")
+	}
+	fsys, err := archive.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+	tree, err := archiveTree(fsys, o.manifestFileName())
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkOnly(tree); err != nil {
+		return nil, err
+	}
+	o.fsys = tree
+
+	track := manifestTracking(manifest.LoadManifestFS(tree, o.manifestFileName()))
+	return o.verify(archivePath, track, func(vr *verifier.Verifier) (*verifier.Result, error) {
+		return vr.Verify(ctx, ".")
+	})
+}
+
+// archiveTree returns the directory of fsys holding the tree: its root, unless the root has no manifest named
+// manifestName and a single entry, a directory holding one
+func archiveTree(fsys fs.FS, manifestName string) (fs.FS, error) {
+	if _, err := fs.Stat(fsys, manifestName); err == nil {
+		return fsys, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return fsys, nil
+	}
+	if _, err := fs.Stat(fsys, path.Join(entries[0].Name(), manifestName)); err != nil {
+		return fsys, nil
+	}
+	return fs.Sub(fsys, entries[0].Name())
+}
+
+// generatorOptions returns the generator options matching o
+func (o *options) generatorOptions() ([]generator.Option, error) {
+	genOpts := []generator.Option{
+		generator.WithStripSignatures(o.stripSignatures),
+		generator.WithSignRootOnly(o.signRootOnly),
+		generator.WithLabels(o.labels),
+		generator.WithLabelRootOnly(o.labelRootOnly),
+		generator.WithCertificateValidity(o.certValidity),
+	}
+	if o.reproducible != nil {
+		if o.freshnessMode == scanner.FreshnessModeEmbedded {
+			return nil, fmt.Errorf("reproducible manifests cannot use embedded freshness, it records the generation time")
+		}
+		genOpts = append(genOpts, generator.WithReproducible(*o.reproducible))
+	}
+	if o.sshCertificate != "" {
+		if o.signer == nil {
+			return nil, fmt.Errorf("an SSH certificate requires a signer")
+		}
+		cert, certifiedKey, err := issuer.LoadSSHCertificate(o.sshCertificate)
+		if err != nil {
+			return nil, err
+		}
+		signerKey, err := o.signer.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get signer public key: %w", err)
+		}
+		if !certifiedKey.Equal(signerKey) {
+			return nil, fmt.Errorf("SSH certificate %s does not certify the signer's key", o.sshCertificate)
+		}
+		genOpts = append(genOpts, generator.WithIssuerCertificate(cert))
+	}
+	return genOpts, nil
+}
+
+func newGenerateReport(stats generator.Stats) *GenerateReport {
+	return &GenerateReport{
+		Directories:      stats.DirsProcessed() + stats.CachedProcessed(),
+		Cached:           stats.CachedProcessed(),
+		Vanished:         stats.EntriesVanished(),
+		ManifestsWritten: stats.ManifestsGenerated,
+		Signatures:       stats.Signatures,
+		DryRun:           stats.DryRun,
+		Stats:            stats.Stats,
+	}
+}
+
+// checkOnly makes sure every WithOnly pattern matches a directory of fsys, so that a typo
+// does not silently turn into a run that processes nothing but the ancestors
+func (o *options) checkOnly(fsys fs.FS) error {
+	for _, pattern := range o.only {
+		matches, err := fs.Glob(fsys, path.Clean(filepath.ToSlash(pattern)))
+		if err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		found := false
+		for _, match := range matches {
+			if info, err := fs.Stat(fsys, match); err == nil && info.IsDir() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("pattern '%s' does not match any directory", pattern)
+		}
+	}
+	return nil
+}
+
+// newScanner creates a scanner configured by the options. The returned function must be called
+// once the scan is over; it flushes progress updates and saves the state file.
+func (o *options) newScanner(track tracking, tolerateVanished bool) (*scanner.Scanner, func() error, error) {
+	scannerOpts := []scanner.Option{
+		scanner.WithFreshnessMode(o.freshnessMode),
+		scanner.WithSpecialFiles(o.specialFiles),
+		scanner.WithHiddenPolicy(o.hiddenPolicy),
+		scanner.WithTrackPermissions(track.permissions),
+		scanner.WithXattrs(track.xattrs),
+		scanner.WithTrackHardlinks(track.hardlinks),
+		scanner.WithTolerateVanished(tolerateVanished),
+		scanner.WithTolerateLongPaths(o.skipLongPaths),
+		scanner.WithExcludes(o.excludes...),
+		scanner.WithMaxDepth(o.maxDepth),
+		scanner.WithOnly(o.only...),
+		scanner.WithOneFileSystem(o.oneFileSystem),
+		scanner.WithMaxBytesPerSecond(o.maxBytesPerSecond),
+		scanner.WithLogger(o.logger),
+		scanner.WithSampledVerification(o.sampled),
+		scanner.WithFastVerification(o.fast),
+		scanner.WithChangedSince(o.changedSince),
+		scanner.WithAllowMissingManifests(o.allowMissing),
+		scanner.WithChunking(o.chunkSize),
+		scanner.WithChunkedVerification(o.chunkedVerify),
+		scanner.WithContentTypes(o.contentTypes),
+		scanner.WithContentTypeVerification(o.contentTypeVerify),
+		scanner.WithFreshListingCheck(o.freshListingCheck),
+	}
+	if o.sampling != nil {
+		scannerOpts = append(scannerOpts, scanner.WithSampling(*o.sampling))
+	}
+	if o.manifestName != "" {
+		scannerOpts = append(scannerOpts, scanner.WithManifestName(o.manifestName))
+	}
+	if o.fsys != nil {
+		scannerOpts = append(scannerOpts, scanner.WithFS(o.fsys))
+	}
+	if o.overlay != nil {
+		scannerOpts = append(scannerOpts, scanner.WithManifestOverlay(o.overlay))
+	}
+	if o.freshnessInterval > 0 {
+		scannerOpts = append(scannerOpts, scanner.WithManifestFreshnessLimit(o.freshnessInterval))
+	}
+	if o.tracer != nil {
+		scannerOpts = append(scannerOpts, scanner.WithTracer(o.tracer, o.dirSpanThreshold))
+	}
+	if o.hasher != nil {
+		scannerOpts = append(scannerOpts, scanner.WithHasher(o.hasher))
+	}
+	var store *state.Store
+	if o.stateFile != "" {
+		var err error
+		if store, err = state.Open(o.stateFile); err != nil {
+			return nil, nil, err
+		}
+		scannerOpts = append(scannerOpts, scanner.WithChecksumCache(store))
+	}
+	// Snapshots of this operation alone are forwarded, the source of the caller may outlive it
+	progress := scanner.NewProgressSource()
+	updates := progress.Subscribe(context.Background())
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		for stats := range updates {
+			if o.progressSource != nil {
+				o.progressSource.Publish(stats)
+			}
+			if o.progress != nil {
+				o.progress(stats)
+			}
+		}
+	}()
+	scannerOpts = append(scannerOpts, scanner.WithProgressSource(progress))
+
+	done := func() error {
+		progress.Close()
+		<-progressDone
+		if store != nil {
+			if err := store.Close(); err != nil {
+				return fmt.Errorf("failed to save state file: %w", err)
+			}
+		}
+		return nil
+	}
+	return scanner.New(scannerOpts...), done, nil
+}
+
+// tracking tells which metadata, besides content, a scan records
+type tracking struct {
+	permissions bool
+	xattrs      bool
+	hardlinks   bool
+}
+
+// recordedTracking returns the metadata recorded by the manifest in dir,
+// so that the same data is collected when checking the tree
+func (o *options) recordedTracking(dir string) tracking {
+	manifestPath := filepath.Join(dir, o.manifestFileName())
+	if o.remoteManifests != nil {
+		if data := o.remoteManifests[manifestPath]; data != nil {
+			return manifestTracking(manifest.Parse(data))
+		}
+		return tracking{}
+	}
+	return manifestTracking(manifest.LoadManifest(manifestPath))
+}
+
+// manifestFileName returns the name manifests are stored under, see WithManifestName
+func (o *options) manifestFileName() string {
+	if o.manifestName != "" {
+		return o.manifestName
+	}
+	return manifest.DefaultName
+}
+
+func manifestTracking(m *manifest.Manifest, err error) tracking {
+	if err != nil || m == nil {
+		return tracking{}
+	}
+	return tracking{permissions: m.HasPermissions(), xattrs: m.HasXattrs(), hardlinks: m.Hardlinks}
+}
+
+// DefaultTrustVerifier validates auditors against GitHub keys and custom URLs, like the CLI.
+// Verifiers of other schemes, like issuer.NewEmailIssuerVerifier, can be added with extra.
+func DefaultTrustVerifier(extra ...issuer.Verifier) issuer.Verifier {
+	verifiers := []issuer.Verifier{issuer.NewGitHubIssuerVerifier(), issuer.NewCustomURLVerifier()}
+	return issuer.NewMultiSourceVerifier(append(verifiers, extra...)...)
+}
@@ -0,0 +1,394 @@
+package bytecheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+func TestGenerateTree_WithLogger_mustEmitEvents(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err = GenerateTree(context.Background(), dir,
+		WithLogger(logger),
+		WithSigner(signing.NewEd25519Signer(privateKey, "custom:tester")))
+	if err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+
+	for _, event := range []string{`"msg":"manifest written"`, `"msg":"signature created"`} {
+		if count := strings.Count(logs.String(), event); count != 2 {
+			t.Errorf("Expected 2 %s events, got %d in:\n%s", event, count, logs.String())
+		}
+	}
+}
+
+// TestGenerateTree_WithProgress_mustEndWithCompleteStats is meant to be run with -race as well
+func TestGenerateTree_WithProgress_mustEndWithCompleteStats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		var last *scanner.Stats
+		report, err := GenerateTree(context.Background(), dir, WithProgress(func(stats *scanner.Stats) { last = stats }))
+		if err != nil {
+			t.Fatalf("GenerateTree failed: %v", err)
+		}
+		if last == nil {
+			t.Fatal("Expected progress updates but got none")
+		}
+		if last.DirsProcessed() != report.Stats.DirsProcessed() || last.FilesProcessed() != report.Stats.FilesProcessed() ||
+			last.BytesHashed() != report.Stats.BytesHashed() || last.CachedProcessed() != report.Stats.CachedProcessed() {
+			t.Fatalf("Run %d: final progress %d dirs, %d files, %d bytes differs from %d dirs, %d files, %d bytes", i,
+				last.DirsProcessed(), last.FilesProcessed(), last.BytesHashed(),
+				report.Stats.DirsProcessed(), report.Stats.FilesProcessed(), report.Stats.BytesHashed())
+		}
+	}
+}
+
+func TestGenerateTree_WithProgressSource_mustPublishCompleteStats(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := scanner.NewProgressSource()
+	updates := source.Subscribe(context.Background())
+	report, err := GenerateTree(context.Background(), dir, WithProgressSource(source))
+	if err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+	source.Close()
+
+	var last *scanner.Stats
+	for stats := range updates {
+		last = stats
+	}
+	if last == nil || last.DirsProcessed() != report.Stats.DirsProcessed() || last.BytesHashed() != report.Stats.BytesHashed() {
+		t.Errorf("Expected the final progress to match %d dirs, %d bytes, got %+v",
+			report.Stats.DirsProcessed(), report.Stats.BytesHashed(), last)
+	}
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestGenerateTree_WithBlockedProgress_mustNotHoldUpTheScan(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("d%02d", i), "f.txt")
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The root manifest is written last, once every directory was scanned
+	rootWritten := make(chan struct{})
+	var once sync.Once
+	rootManifest := []byte(strconv.Quote(filepath.Join(dir, manifest.DefaultName)))
+	logger := slog.New(slog.NewJSONHandler(writerFunc(func(p []byte) (int, error) {
+		if bytes.Contains(p, []byte(`"msg":"manifest written"`)) && bytes.Contains(p, rootManifest) {
+			once.Do(func() { close(rootWritten) })
+		}
+		return len(p), nil
+	}), &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	_, err := GenerateTree(context.Background(), dir, WithLogger(logger), WithProgress(func(*scanner.Stats) {
+		select {
+		case <-rootWritten:
+		case <-time.After(10 * time.Second):
+			t.Error("Expected the scan to go on while the progress callback is blocked")
+		}
+	}))
+	if err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+}
+
+func TestVerifyTree_WithManifestName_mustCheckTheMetadataRecordedByTheRoot(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateTree(context.Background(), dir, WithManifestName("checksums.json"), WithTrackPermissions(true)); err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+	if err := os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyTree(context.Background(), dir, WithManifestName("checksums.json"))
+	if err != nil {
+		t.Fatalf("VerifyTree failed: %v", err)
+	}
+	if !report.HasFailures() {
+		t.Errorf("Expected the changed mode to be reported, permissions are recorded by the root manifest")
+	}
+}
+
+func TestVerifyReport_Err_mustClassifyFailures(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyTree(context.Background(), dir); !errors.Is(err, ErrNoManifests) {
+		t.Errorf("expected ErrNoManifests, got %v", err)
+	}
+
+	if _, err := GenerateTree(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyTree(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = VerifyTree(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	err = report.Err()
+	var verificationErr *VerificationError
+	if !errors.Is(err, ErrVerificationFailed) || errors.Is(err, ErrTrustFailure) || !errors.As(err, &verificationErr) {
+		t.Fatalf("expected a VerificationError wrapping ErrVerificationFailed, got %v", err)
+	}
+	if verificationErr.Result != report.Result {
+		t.Errorf("expected the error to carry the result")
+	}
+}
+
+// assertRoundTrip generates the manifests of dir and verifies them, expecting no difference
+func assertRoundTrip(t *testing.T, dir string, opts ...Option) *GenerateReport {
+	t.Helper()
+	generated, err := GenerateTree(context.Background(), dir, opts...)
+	if err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+	report, err := VerifyTree(context.Background(), dir, opts...)
+	if err != nil {
+		t.Fatalf("VerifyTree failed: %v", err)
+	}
+	for _, status := range report.DirectoryStatuses {
+		if len(status.Differences) > 0 {
+			t.Errorf("Expected no differences in %s, got %+v", status.Path, status.Differences)
+		}
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("Expected verification to pass, got %v", err)
+	}
+	return generated
+}
+
+func TestGenerateTree_WithUnusualNames_mustRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"new\nline.txt", "tab\there", "invalid-\xff\xfe.bin", "invalid-\xff\xfd.bin", "ünïcödé", " lead"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Skipf("file system does not allow the name %q: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub\n\xc3"), 0755); err != nil {
+		t.Skipf("file system does not allow the name: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub\n\xc3", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRoundTrip(t, dir)
+
+	// Names differing only by their invalid bytes must not be mixed up
+	if err := os.WriteFile(filepath.Join(dir, "invalid-\xff\xfd.bin"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyTree(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var changed []string
+	for _, status := range report.DirectoryStatuses {
+		for _, difference := range status.Differences {
+			if difference.Type != manifest.DiffSubtreeMismatch {
+				changed = append(changed, difference.Name)
+			}
+		}
+	}
+	if len(changed) != 1 || changed[0] != "invalid-\xff\xfd.bin" {
+		t.Errorf("Expected only %q to differ, got %q", "invalid-\xff\xfd.bin", changed)
+	}
+}
+
+func TestGenerateTree_WithDeepNesting_mustRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	deepest := dir
+	for len(deepest) < 3000 {
+		deepest = filepath.Join(deepest, strings.Repeat("d", 40))
+	}
+	if err := os.MkdirAll(deepest, 0755); err != nil {
+		t.Skipf("file system does not allow deep nesting: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(deepest, "leaf.txt"), []byte("leaf"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := assertRoundTrip(t, dir)
+	if report.Stats.DirectoriesTooLong() != 0 {
+		t.Errorf("Expected no directory left out, got %d", report.Stats.DirectoriesTooLong())
+	}
+	if _, err := os.Stat(filepath.Join(deepest, ".bytecheck.manifest")); err != nil {
+		t.Errorf("Expected a manifest in the deepest directory: %v", err)
+	}
+}
+
+func TestGenerateTree_WithPathsTooLong_mustLeaveThemOutOnlyWhenSkipped(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Paths longer than the OS allows can only be created relative to open directories
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	name := strings.Repeat("n", 200)
+	for depth := 0; depth < 25; depth++ {
+		if err := root.Mkdir(name, 0755); err != nil {
+			t.Skipf("cannot create nested directories: %v", err)
+		}
+		child, err := root.OpenRoot(name)
+		if err != nil {
+			t.Skipf("cannot open nested directories: %v", err)
+		}
+		defer child.Close()
+		root = child
+	}
+	if _, err := os.Stat(dir + strings.Repeat("/"+name, 25)); err == nil {
+		t.Skip("the OS does not limit the length of paths")
+	}
+
+	if _, err := GenerateTree(context.Background(), dir); err == nil {
+		t.Errorf("Expected GenerateTree to fail without WithSkipLongPaths")
+	}
+	report := assertRoundTrip(t, dir, WithSkipLongPaths(true))
+	if report.Stats.DirectoriesTooLong() == 0 {
+		t.Errorf("Expected directories left out because their paths are too long")
+	}
+}
+
+func TestRepairTree_mustKeepTheMetadataRecordedByTheRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateTree(context.Background(), dir, WithTrackPermissions(true)); err != nil {
+		t.Fatalf("GenerateTree failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := RepairTree(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("RepairTree failed: %v", err)
+	}
+	if want := []string{filepath.Join(dir, "sub")}; !slices.Equal(report.Repaired, want) {
+		t.Errorf("Expected %v to be repaired, got %v", want, report.Repaired)
+	}
+	if want := []string{dir}; !slices.Equal(report.AncestorsUpdated, want) {
+		t.Errorf("Expected %v to be updated, got %v", want, report.AncestorsUpdated)
+	}
+	if err := report.After.Err(); err != nil {
+		t.Errorf("Expected the repaired tree to verify, got %v", err)
+	}
+	m, err := manifest.LoadManifest(filepath.Join(dir, "sub", manifest.DefaultName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.HasPermissions() {
+		t.Errorf("Expected the repaired manifest to record permissions like the root")
+	}
+}
+
+// retryRecordingVerifier trusts nobody and records the retry policy set on it
+type retryRecordingVerifier struct {
+	policy *issuer.RetryPolicy
+}
+
+func (v *retryRecordingVerifier) Supports(issuer.Reference) bool { return false }
+
+func (v *retryRecordingVerifier) Verify([]issuer.Issuer) map[issuer.Reference]issuer.Status {
+	return nil
+}
+
+func (v *retryRecordingVerifier) SetRetryPolicy(policy issuer.RetryPolicy) { v.policy = &policy }
+
+func (v *retryRecordingVerifier) Clone() issuer.Verifier {
+	clone := *v
+	return &clone
+}
+
+func TestMakeOptions_WithTrustRetryPolicy_mustNotConfigureTheCallersVerifier(t *testing.T) {
+	shared := &retryRecordingVerifier{}
+
+	o := makeOptions(WithTrustVerifier(shared), WithTrustRetryPolicy(issuer.RetryPolicy{Attempts: 5}))
+
+	if shared.policy != nil {
+		t.Errorf("expected the caller's verifier to be left unchanged, got retry policy %+v", *shared.policy)
+	}
+	configured, ok := o.trustVerifier.(*retryRecordingVerifier)
+	if !ok || configured.policy == nil || configured.policy.Attempts != 5 {
+		t.Errorf("expected a copy configured with 5 attempts, got %+v", o.trustVerifier)
+	}
+}
@@ -0,0 +1,44 @@
+package bytecheck
+
+import "github.com/tomekjarosik/bytecheck/pkg/verifier"
+
+// Errors telling failed runs apart, test for them with errors.Is. They are wrapped by a VerificationError, see
+// VerifyReport.Err, or by the error a function returns, e.g. ErrNoManifests when VerifyTree finds a directory
+// without a manifest.
+var (
+	// ErrVerificationFailed means the tree does not match its manifests
+	ErrVerificationFailed = verifier.ErrVerificationFailed
+	// ErrNoManifests means the tree, or one of its directories, has no manifest
+	ErrNoManifests = verifier.ErrManifestNotFound
+	// ErrTrustFailure means a signature is invalid, a certificate is outside its validity window, the root of
+	// a subtree is not signed, the auditor policy is violated, a detached signature is rejected, with
+	// WithRequireSingleAuditorRun, an auditor signed the tree in several runs or, with WithRequireSigned and
+	// WithRequireTrusted, a manifest is unsigned or not signed by a trusted auditor
+	ErrTrustFailure = verifier.ErrAuditFailed
+)
+
+// VerificationError is a verification that completed but failed. It wraps both Kind, one of the errors above,
+// and Err, which explains the failure.
+type VerificationError struct {
+	Kind error
+	Err  error
+	// Result is the failed verification, nil when the failure is not one of a verification, e.g. generate --check
+	Result *verifier.Result
+}
+
+func (e *VerificationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *VerificationError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Err returns a VerificationError when the verification failed, nil otherwise, see verifier.Result.Failure.
+// Interrupted verifications come with the error of the interruption instead.
+func (r *VerifyReport) Err() error {
+	if failure := r.Failure(); failure != nil {
+		return &VerificationError{Kind: failure.Kind, Err: failure.Err, Result: r.Result}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package bytecheck_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+)
+
+// createTree creates a temporary directory with a file and a subdirectory
+func createTree() string {
+	dir, err := os.MkdirTemp("", "bytecheck_example")
+	if err != nil {
+		panic(err)
+	}
+	files := map[string]string{
+		"readme.txt":          "hello",
+		"data/values.csv":     "1,2,3",
+		"build/output.binary": "generated",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			panic(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			panic(err)
+		}
+	}
+	return dir
+}
+
+func ExampleGenerateTree() {
+	dir := createTree()
+	defer os.RemoveAll(dir)
+
+	report, err := bytecheck.GenerateTree(context.Background(), dir)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("generated %d manifest(s)\n", len(report.ManifestsWritten))
+	// Output: generated 3 manifest(s)
+}
+
+func ExampleVerifyTree() {
+	dir := createTree()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	if _, err := bytecheck.GenerateTree(ctx, dir); err != nil {
+		panic(err)
+	}
+	report, err := bytecheck.VerifyTree(ctx, dir)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("failures: %v, verified: %d\n", report.HasFailures(), report.Summary().Verified)
+
+	if err := os.WriteFile(filepath.Join(dir, "data", "values.csv"), []byte("1,2,4"), 0644); err != nil {
+		panic(err)
+	}
+	report, err = bytecheck.VerifyTree(ctx, dir)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("failures: %v, invalid: %d\n", report.HasFailures(), report.Summary().Invalid)
+	// Output:
+	// failures: false, verified: 3
+	// failures: true, invalid: 1
+}
+
+func ExampleWithExcludes() {
+	dir := createTree()
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	report, err := bytecheck.GenerateTree(ctx, dir, bytecheck.WithExcludes("build"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("generated %d manifest(s)\n", len(report.ManifestsWritten))
+
+	// Build outputs may change freely without failing verification
+	if err := os.WriteFile(filepath.Join(dir, "build", "output.binary"), []byte("rebuilt"), 0644); err != nil {
+		panic(err)
+	}
+	verifyReport, err := bytecheck.VerifyTree(ctx, dir, bytecheck.WithExcludes("build"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("failures: %v\n", verifyReport.HasFailures())
+	// Output:
+	// generated 2 manifest(s)
+	// failures: false
+}
@@ -0,0 +1,578 @@
+package bytecheck
+
+import (
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/remote"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+	"io/fs"
+	"log/slog"
+	"time"
+)
+
+type options struct {
+	freshnessInterval time.Duration
+	freshnessMode     scanner.FreshnessMode
+	specialFiles      scanner.SpecialFilesPolicy
+	hiddenPolicy      scanner.HiddenPolicy
+	ignoreHidden      bool
+	stateFile         string
+	trackPermissions  bool
+	trackXattrs       bool
+	trackHardlinks    bool
+	excludes          []string
+	maxDepth          int
+	only              []string
+	oneFileSystem     bool
+	skipLongPaths     bool
+	maxBytesPerSecond int64
+	signer            signing.Signer
+	trustVerifier     issuer.Verifier
+	trustAnchors      string
+	auditorPolicy     *issuer.AuditorPolicy
+	trustRetryPolicy  *issuer.RetryPolicy
+	trustConcurrency  int
+	stripSignatures   bool
+	signRootOnly      bool
+	labels            map[string]string
+	labelRootOnly     bool
+	requiredLabels    map[string]string
+	singleAuditorRun  bool
+	requireSigned     bool
+	requireTrusted    bool
+	sampling          *manifest.Sampling
+	sampled           bool
+	fast              bool
+	changedSince      time.Time
+	allowMissing      bool
+	refreshTimestamps bool
+	chunkSize         int64
+	chunkedVerify     bool
+	contentTypes      bool
+	contentTypeVerify bool
+	freshListingCheck bool
+	reproducible      *time.Time
+	reportPath        string
+	statusSink        func(verifier.DirectoryVerificationStatus)
+	// detachedSignature and allowedSigners locate the files of WithDetachedSignature
+	detachedSignature string
+	allowedSigners    string
+	// signerIdentity is the identity the principals of the allowed signer must match, see WithDetachedSignature
+	signerIdentity    string
+	maxRetained       int
+	dryRun            bool
+	sshCertificate    string
+	progress          func(*scanner.Stats)
+	progressSource    *scanner.ProgressSource
+	logger            *slog.Logger
+	tracer            telemetry.Tracer
+	hasher            scanner.Hasher
+	dirSpanThreshold  time.Duration
+	maxClockSkew      time.Duration
+	certValidity      time.Duration
+	certExpiryWarning time.Duration
+	manifestName      string
+	// fsys is the file system scanned instead of the OS one, set by VerifyArchive
+	fsys fs.FS
+	// overlay holds the manifests of a dry run, see WithDryRun, or the remote manifests
+	overlay *scanner.ManifestOverlay
+	// remoteStore and remoteTreeID locate the remote manifests, see WithRemoteManifests
+	remoteStore  remote.Store
+	remoteTreeID string
+	// remoteManifests holds the fetched manifests by manifest path, nil for directories without one
+	remoteManifests map[string][]byte
+}
+
+// Option configures GenerateTree, AttestTree, VerifyTree and VerifyArchive
+type Option func(o *options)
+
+func makeOptions(opts ...Option) *options {
+	res := &options{
+		freshnessMode:     scanner.FreshnessModeMtime,
+		specialFiles:      scanner.SpecialFilesRecord,
+		hiddenPolicy:      scanner.HiddenInclude,
+		trustVerifier:     DefaultTrustVerifier(),
+		maxClockSkew:      verifier.DefaultMaxClockSkew,
+		certExpiryWarning: verifier.DefaultExpiryWarning,
+		maxRetained:       verifier.DefaultMaxRetainedFailures,
+		maxDepth:          -1,
+	}
+	for _, o := range opts {
+		o(res)
+	}
+	if res.trustRetryPolicy != nil || res.trustConcurrency > 0 || res.tracer != nil {
+		// The verifier may be shared by the caller, e.g. between runs with different settings
+		res.trustVerifier = issuer.Clone(res.trustVerifier)
+	}
+	if configurable, ok := res.trustVerifier.(issuer.RetryConfigurable); ok && res.trustRetryPolicy != nil {
+		configurable.SetRetryPolicy(*res.trustRetryPolicy)
+	}
+	if configurable, ok := res.trustVerifier.(issuer.ConcurrencyConfigurable); ok && res.trustConcurrency > 0 {
+		configurable.SetConcurrency(res.trustConcurrency)
+	}
+	if configurable, ok := res.trustVerifier.(issuer.TracerConfigurable); ok && res.tracer != nil {
+		configurable.SetTracer(res.tracer)
+	}
+	return res
+}
+
+// WithFreshness reuses manifests that are not older than interval instead of recalculating them
+func WithFreshness(interval time.Duration) Option {
+	return func(o *options) {
+		o.freshnessInterval = interval
+	}
+}
+
+// WithManifestName stores and looks up manifests under name instead of manifest.DefaultName.
+// The same name must be used to generate and to verify a tree.
+func WithManifestName(name string) Option {
+	return func(o *options) {
+		o.manifestName = name
+	}
+}
+
+// WithFreshnessMode selects how manifest freshness is determined, see scanner.FreshnessMode
+func WithFreshnessMode(mode scanner.FreshnessMode) Option {
+	return func(o *options) {
+		o.freshnessMode = mode
+	}
+}
+
+// WithSpecialFiles selects how sockets, FIFOs and device nodes are handled, see scanner.SpecialFilesPolicy.
+// The same policy must be used to generate and to verify a tree.
+func WithSpecialFiles(policy scanner.SpecialFilesPolicy) Option {
+	return func(o *options) {
+		o.specialFiles = policy
+	}
+}
+
+// WithHiddenPolicy selects how hidden files and directories are handled, see scanner.HiddenPolicy.
+// The same policy must be used to generate and to verify a tree.
+func WithHiddenPolicy(policy scanner.HiddenPolicy) Option {
+	return func(o *options) {
+		o.hiddenPolicy = policy
+	}
+}
+
+// WithIgnoreHiddenDifferences makes verification pass directories differing only in hidden entries of trees
+// generated with scanner.HiddenWarn, see verifier.WithIgnoreHiddenDifferences
+func WithIgnoreHiddenDifferences(ignore bool) Option {
+	return func(o *options) {
+		o.ignoreHidden = ignore
+	}
+}
+
+// WithStateFile remembers checksums of unchanged files between runs in the file at path
+func WithStateFile(path string) Option {
+	return func(o *options) {
+		o.stateFile = path
+	}
+}
+
+// WithTrackPermissions records file mode and, on Unix, owner in generated manifests.
+// Verification detects it from the root manifest and ignores this option.
+func WithTrackPermissions(track bool) Option {
+	return func(o *options) {
+		o.trackPermissions = track
+	}
+}
+
+// WithDryRun makes GenerateTree and RegeneratePath write nothing, not even the state file, and report
+// in GenerateReport.DryRun what they would do with every manifest instead. Nothing is signed.
+func WithDryRun(dryRun bool) Option {
+	return func(o *options) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithXattrs records a digest of the extended attributes, including POSIX ACLs, of files and
+// directories in generated manifests. Verification detects it from the root manifest and ignores this option.
+func WithXattrs(track bool) Option {
+	return func(o *options) {
+		o.trackXattrs = track
+	}
+}
+
+// WithTrackHardlinks records which files of generated manifests are hard links of the same file, so that
+// verification reports the links broken since, see scanner.WithTrackHardlinks. Verification detects it from the
+// root manifest and ignores this option.
+func WithTrackHardlinks(track bool) Option {
+	return func(o *options) {
+		o.trackHardlinks = track
+	}
+}
+
+// WithHasher computes the checksums of regular files with h instead of reading them, in generation and
+// verification alike, see scanner.WithHasher
+func WithHasher(h scanner.Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithExcludes leaves out files and directories whose name matches any of the patterns.
+// The same patterns must be used to generate and to verify a tree.
+func WithExcludes(patterns ...string) Option {
+	return func(o *options) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// WithMaxDepth leaves out directories more than n levels below the root, see scanner.WithMaxDepth.
+// The same depth must be used to generate and to verify a tree. A negative n means unlimited.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithOneFileSystem leaves out subdirectories on another file system than dir, see scanner.WithOneFileSystem.
+// The same setting must be used to generate and to verify a tree.
+func WithOneFileSystem(enabled bool) Option {
+	return func(o *options) {
+		o.oneFileSystem = enabled
+	}
+}
+
+// WithSkipLongPaths leaves out directories whose path, or the path of their manifest, exceeds the limit of the OS
+// instead of failing, see scanner.WithTolerateLongPaths. Their number is reported by Stats.DirectoriesTooLong.
+// The same setting must be used to generate and to verify a tree.
+func WithSkipLongPaths(enabled bool) Option {
+	return func(o *options) {
+		o.skipLongPaths = enabled
+	}
+}
+
+// WithOnly restricts processing to the subdirectories matching the patterns, relative to the root,
+// and their ancestors, whose manifests are updated accordingly, see scanner.WithOnly.
+// Every pattern must match at least one directory.
+func WithOnly(patterns ...string) Option {
+	return func(o *options) {
+		o.only = append(o.only, patterns...)
+	}
+}
+
+// WithMaxBytesPerSecond limits the read bandwidth used for hashing, 0 means unlimited
+func WithMaxBytesPerSecond(n int64) Option {
+	return func(o *options) {
+		o.maxBytesPerSecond = n
+	}
+}
+
+// WithSigner signs generated manifests, or co-signs them in AttestTree
+func WithSigner(signer signing.Signer) Option {
+	return func(o *options) {
+		o.signer = signer
+	}
+}
+
+// WithTrustAnchors pins the keys of auditors listed in the trust anchors file at path, see issuer.LoadTrustAnchors.
+// Pinned auditors are checked only against their pinned keys, before any other trust source. Pins are never read
+// from the verified tree: whoever can rewrite it could pin their own keys.
+func WithTrustAnchors(path string) Option {
+	return func(o *options) {
+		o.trustAnchors = path
+	}
+}
+
+// WithTrustVerifier replaces the trust sources auditors are validated against,
+// DefaultTrustVerifier is used otherwise. A verifier implementing issuer.Cloneable is copied before
+// WithTrustRetryPolicy, WithTrustConcurrency or WithTracer configure it.
+func WithTrustVerifier(verifier issuer.Verifier) Option {
+	return func(o *options) {
+		o.trustVerifier = verifier
+	}
+}
+
+// WithAuditorPolicy applies the allow/deny rules of policy to the auditors of a verification,
+// see verifier.WithAuditorPolicy
+func WithAuditorPolicy(policy *issuer.AuditorPolicy) Option {
+	return func(o *options) {
+		o.auditorPolicy = policy
+	}
+}
+
+// WithTrustRetryPolicy sets how fetching keys from trusted sources is retried when they fail temporarily,
+// issuer.DefaultRetryPolicy by default. It applies to trust verifiers implementing issuer.RetryConfigurable.
+func WithTrustRetryPolicy(policy issuer.RetryPolicy) Option {
+	return func(o *options) {
+		o.trustRetryPolicy = &policy
+	}
+}
+
+// WithTrustConcurrency sets how many references the keys are fetched of at the same time,
+// issuer.DefaultConcurrency by default. It applies to trust verifiers implementing issuer.ConcurrencyConfigurable.
+func WithTrustConcurrency(n int) Option {
+	return func(o *options) {
+		o.trustConcurrency = n
+	}
+}
+
+// WithTracer reports the directories taking at least dirThreshold as spans of tracer, children of the span of the
+// context given to GenerateTree or VerifyTree, see scanner.WithTracer, together with the requests of trust verifiers
+// implementing issuer.TracerConfigurable. Nothing is traced by default.
+func WithTracer(tracer telemetry.Tracer, dirThreshold time.Duration) Option {
+	return func(o *options) {
+		o.tracer = tracer
+		o.dirSpanThreshold = dirThreshold
+	}
+}
+
+// WithStripSignatures removes the signatures of existing manifests when GenerateTree runs without a signer.
+// By default signatures are kept for directories whose content did not change.
+func WithStripSignatures(strip bool) Option {
+	return func(o *options) {
+		o.stripSignatures = strip
+	}
+}
+
+// WithSignRootOnly signs only the root manifest in GenerateTree, which covers the whole tree through
+// the checksums of the child manifests, see generator.WithSignRootOnly. It requires a signer.
+func WithSignRootOnly(rootOnly bool) Option {
+	return func(o *options) {
+		o.signRootOnly = rootOnly
+	}
+}
+
+// WithLabels stamps labels on the manifests written by GenerateTree, see manifest.Manifest.Labels and
+// manifest.ParseLabels. They are covered by the HMAC and the signatures.
+func WithLabels(labels map[string]string) Option {
+	return func(o *options) {
+		o.labels = labels
+	}
+}
+
+// WithLabelRootOnly stamps the labels of WithLabels on the root manifest only, see generator.WithLabelRootOnly
+func WithLabelRootOnly(rootOnly bool) Option {
+	return func(o *options) {
+		o.labelRootOnly = rootOnly
+	}
+}
+
+// WithRequiredLabels makes verification fail unless the root manifest holds labels with the same values and
+// is signed by a trusted auditor, see VerifyReport.Err
+func WithRequiredLabels(labels map[string]string) Option {
+	return func(o *options) {
+		o.requiredLabels = labels
+	}
+}
+
+// WithRequireSingleAuditorRun makes verification fail when an auditor signed the tree in more than one generate
+// run, e.g. because a directory signed for another tree was spliced in, see verifier.Result.MixedAuditorSubjects
+// and VerifyReport.Err
+func WithRequireSingleAuditorRun(require bool) Option {
+	return func(o *options) {
+		o.singleAuditorRun = require
+	}
+}
+
+// WithRequireSigned makes verification fail when a manifest is unsigned, including the ones of trees generated
+// with WithSignRootOnly, see verifier.Result.Signing and VerifyReport.Err
+func WithRequireSigned(require bool) Option {
+	return func(o *options) {
+		o.requireSigned = require
+	}
+}
+
+// WithRequireTrusted makes verification fail when a manifest is unsigned or none of its auditors is trusted,
+// e.g. unsupported or unverifiable, see verifier.Result.Signing and VerifyReport.Err
+func WithRequireTrusted(require bool) Option {
+	return func(o *options) {
+		o.requireTrusted = require
+	}
+}
+
+// WithSampling records in GenerateTree a sample checksum of the files larger than threshold, besides their
+// checksum, with the default sampling regions, see manifest.DefaultSampling and WithSampledVerification
+func WithSampling(threshold int64) Option {
+	return func(o *options) {
+		sampling := manifest.DefaultSampling(threshold)
+		o.sampling = &sampling
+	}
+}
+
+// WithSampledVerification makes verification read only the sampled regions of the files whose manifests
+// record a sample checksum, see scanner.WithSampledVerification. It is quicker on huge files but only
+// probabilistic: changes outside of the sampled regions go unnoticed.
+func WithSampledVerification(sampled bool) Option {
+	return func(o *options) {
+		o.sampled = sampled
+	}
+}
+
+// WithFastVerification makes verification report the files whose size differs from the one recorded by
+// their manifest without reading them, see scanner.WithFastVerification. Their new checksum is then unknown.
+func WithFastVerification(fast bool) Option {
+	return func(o *options) {
+		o.fast = fast
+	}
+}
+
+// WithChangedSince makes verification read only the files modified since cutoff, trusting the checksums
+// recorded by their manifests for the older ones, see scanner.WithChangedSince. Directories in which nothing
+// changed are verified shallowly, like fresh manifests. The zero time reads every file.
+func WithChangedSince(cutoff time.Time) Option {
+	return func(o *options) {
+		o.changedSince = cutoff
+	}
+}
+
+// WithAllowMissingManifests makes verification report directories without a manifest as unmanaged instead
+// of failing, see verifier.WithAllowMissingManifests. A parent recording the checksum of such a directory's
+// manifest reports a checksum mismatch, only directories it records as unmanaged are verified without one.
+func WithAllowMissingManifests(allow bool) Option {
+	return func(o *options) {
+		o.allowMissing = allow
+	}
+}
+
+// WithRefreshTimestamps makes verification update the modification time of the manifests of valid directories,
+// so that a later run with WithFreshness reuses them, see verifier.WithRefreshTimestamps
+func WithRefreshTimestamps(refresh bool) Option {
+	return func(o *options) {
+		o.refreshTimestamps = refresh
+	}
+}
+
+// WithChunking records in GenerateTree the checksums of the chunks of chunkSize bytes of the files larger
+// than one chunk, besides their checksum, see manifest.Entity.Chunking. Verification with
+// WithChunkedVerification then reports which chunks of a changed file differ. With WithStateFile, a file whose
+// hashing is interrupted is resumed from its last completed chunk by the next run.
+func WithChunking(chunkSize int64) Option {
+	return func(o *options) {
+		o.chunkSize = chunkSize
+	}
+}
+
+// WithChunkedVerification makes VerifyTree hash the chunks recorded by WithChunking too, so that a changed file
+// is narrowed down to the chunks that differ, at the cost of a second checksum of those files,
+// see scanner.WithChunkedVerification
+func WithChunkedVerification(enabled bool) Option {
+	return func(o *options) {
+		o.chunkedVerify = enabled
+	}
+}
+
+// WithContentTypes records in GenerateTree the content type of every regular file, classified by its first
+// bytes while it is hashed, see manifest.Entity.ContentType. Verification then tells what a file whose checksum
+// changed was and what it is now.
+func WithContentTypes(enabled bool) Option {
+	return func(o *options) {
+		o.contentTypes = enabled
+	}
+}
+
+// WithReproducible records epoch as the signing time of every signature, so that generating identical trees
+// yields identical manifests, see generator.WithReproducible. With a signer, the auditor sections still differ
+// between runs. It cannot be combined with scanner.FreshnessModeEmbedded.
+func WithReproducible(epoch time.Time) Option {
+	return func(o *options) {
+		o.reproducible = &epoch
+	}
+}
+
+// WithRemoteManifests makes VerifyTree and VerifyPath check the tree against the manifests pushed to store below
+// treeID, see remote.Push, instead of the manifests stored in the tree. Directories the store holds no manifest
+// for are treated as having none. Freshness and state files cannot be used with it, they trust local manifests.
+func WithRemoteManifests(store remote.Store, treeID string) Option {
+	return func(o *options) {
+		o.remoteStore = store
+		o.remoteTreeID = treeID
+	}
+}
+
+// WithReport writes a newline-delimited JSON report of the differences found by verification to path,
+// see verifier.ReportWriter. It is written while verifying and completed with a summary even when
+// verification fails, so remediation tools can consume it, see verifier.ParseReport.
+func WithReport(path string) Option {
+	return func(o *options) {
+		o.reportPath = path
+	}
+}
+
+// WithStatusSink makes verification call fn with the status of every directory as soon as it is verified and
+// keep only the failed ones in the result, see verifier.WithStatusSink. RepairTree ignores it.
+func WithStatusSink(fn func(status verifier.DirectoryVerificationStatus)) Option {
+	return func(o *options) {
+		o.statusSink = fn
+	}
+}
+
+// WithMaxRetainedFailures sets how many failed directories the result keeps with WithStatusSink,
+// verifier.DefaultMaxRetainedFailures by default, see verifier.WithMaxRetainedFailures
+func WithMaxRetainedFailures(n int) Option {
+	return func(o *options) {
+		o.maxRetained = n
+	}
+}
+
+// WithDetachedSignature makes verification check the detached signature stored at signaturePath, see
+// SignRootDigest, against the recomputed root digest once every manifest matches, see
+// verifier.CheckDetachedSignature. Its key must be listed in the OpenSSH allowed_signers file at allowedSignersPath
+// for a principal matching identity, like `ssh-keygen -Y verify -I identity` requires. It cannot be combined with
+// WithManifestFreshnessLimit, manifests reused without rehashing their directories reject the signature.
+func WithDetachedSignature(signaturePath, allowedSignersPath, identity string) Option {
+	return func(o *options) {
+		o.detachedSignature = signaturePath
+		o.allowedSigners = allowedSignersPath
+		o.signerIdentity = identity
+	}
+}
+
+// WithSSHCertificate records the SSH user certificate stored at path, in authorized_keys format,
+// in every signature so issuer.SSHCAVerifier can trust it. It must certify the signer's key.
+func WithSSHCertificate(path string) Option {
+	return func(o *options) {
+		o.sshCertificate = path
+	}
+}
+
+// WithProgress calls fn with periodic snapshots of the scan statistics.
+// fn is called from a separate goroutine, never after the operation returns.
+func WithProgress(fn func(*scanner.Stats)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithProgressSource publishes periodic snapshots of the scan statistics to source, the last one showing the
+// final totals, see scanner.ProgressSource. The caller closes source once the operation returned.
+func WithProgressSource(source *scanner.ProgressSource) Option {
+	return func(o *options) {
+		o.progressSource = source
+	}
+}
+
+// WithLogger reports events, like manifests written, to logger instead of logging.Logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMaxClockSkew sets how far in the future signed auditor timestamps may be before verification
+// warns about the auditor, see issuer.Status.Warning, verifier.DefaultMaxClockSkew by default
+func WithMaxClockSkew(skew time.Duration) Option {
+	return func(o *options) {
+		o.maxClockSkew = skew
+	}
+}
+
+// WithCertValidity limits how long the certificates of the keys signing the manifests are valid, counted from
+// the start of the run, see generator.WithCertificateValidity. They never expire by default.
+func WithCertValidity(validity time.Duration) Option {
+	return func(o *options) {
+		o.certValidity = validity
+	}
+}
+
+// WithCertExpiryWarning sets how soon before their certificates expire verification reports auditors as fishy,
+// verifier.DefaultExpiryWarning by default
+func WithCertExpiryWarning(window time.Duration) Option {
+	return func(o *options) {
+		o.certExpiryWarning = window
+	}
+}
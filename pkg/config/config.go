@@ -0,0 +1,182 @@
+// Package config loads defaults for command-line flags from configuration files and environment variables.
+// Layers override the ones before them: the user config, the config at the root of the tree, then the
+// environment. Flags given on the command line override all of them, which is up to the caller.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// UserFileName is the name of the user config in the bytecheck directory of the user config directory,
+	// e.g. ~/.config/bytecheck/config.yaml on Linux, see UserFilePath
+	UserFileName = "config.yaml"
+	// TreeFileName is the name of the config at the root of a tree. Like any other file, it is recorded
+	// in the root manifest.
+	TreeFileName = ".bytecheck.yaml"
+	// EnvPrefix starts the names of the environment variables setting keys, see EnvName
+	EnvPrefix = "BYTECHECK_"
+)
+
+// Keys lists the keys that can be configured, sorted. They are named like the flags they provide defaults for.
+var Keys = []string{
+	"auditor-reference",
+	"color",
+	"email-keys-url",
+	"freshness-interval",
+	"manifest-name",
+	"private-key",
+	"ssh-ca",
+}
+
+// pathKeys holds the keys whose values are paths, see expandPath
+var pathKeys = map[string]bool{"private-key": true, "ssh-ca": true}
+
+// Source tells which layer a value comes from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceUser    Source = "user config"
+	SourceTree    Source = "tree config"
+	SourceEnv     Source = "environment"
+)
+
+// Setting is the value of a key and where it comes from
+type Setting struct {
+	Key    string
+	Value  string
+	Source Source
+	// Origin is the file or the environment variable holding the value, empty for defaults and flags
+	Origin string
+}
+
+// String describes where the value comes from, e.g. "tree config /data/.bytecheck.yaml"
+func (s Setting) String() string {
+	if s.Origin == "" {
+		return string(s.Source)
+	}
+	return string(s.Source) + " " + s.Origin
+}
+
+// Config holds the settings of the keys configured by any layer
+type Config struct {
+	settings map[string]Setting
+}
+
+// Load merges the user config, the config of the tree rooted at treeDir unless it is empty, and the environment.
+// Missing files are ignored, files with unknown keys or values that are not scalars are rejected.
+func Load(treeDir string) (*Config, error) {
+	c := &Config{settings: make(map[string]Setting)}
+	if path, ok := UserFilePath(); ok {
+		if err := c.loadFile(path, SourceUser, ""); err != nil {
+			return nil, err
+		}
+	}
+	if treeDir != "" {
+		if err := c.loadFile(filepath.Join(treeDir, TreeFileName), SourceTree, treeDir); err != nil {
+			return nil, err
+		}
+	}
+	c.loadEnv(os.LookupEnv)
+	return c, nil
+}
+
+// UserFilePath returns the path of the user config, false when the user config directory is unknown
+func UserFilePath() (string, bool) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, "bytecheck", UserFileName), true
+}
+
+// EnvName returns the environment variable setting key, e.g. BYTECHECK_FRESHNESS_INTERVAL for freshness-interval
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// Lookup returns the setting of key, false when no layer configures it
+func (c *Config) Lookup(key string) (Setting, bool) {
+	setting, ok := c.settings[key]
+	return setting, ok
+}
+
+// Settings returns the settings of the configured keys, sorted by key
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, 0, len(c.settings))
+	for _, setting := range c.settings {
+		settings = append(settings, setting)
+	}
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings
+}
+
+// loadFile sets the keys configured by the YAML file at path, relative paths are relative to baseDir unless it is empty
+func (c *Config) loadFile(path string, source Source, baseDir string) error {
+	data, err := os.ReadFile(path)
+	// A tree argument that is not a directory is reported by the command using it
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var values map[string]string
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for key, value := range values {
+		if !slices.Contains(Keys, key) {
+			return fmt.Errorf("invalid config %s: unknown key '%s', expected one of %s",
+				path, key, strings.Join(Keys, ", "))
+		}
+		if pathKeys[key] {
+			value = expandPath(value, baseDir)
+		}
+		c.settings[key] = Setting{Key: key, Value: value, Source: source, Origin: path}
+	}
+	return nil
+}
+
+// loadEnv sets the keys given by non-empty environment variables, see EnvName
+func (c *Config) loadEnv(lookup func(name string) (string, bool)) {
+	for _, key := range Keys {
+		name := EnvName(key)
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		if pathKeys[key] {
+			value = expandPath(value, "")
+		}
+		c.settings[key] = Setting{Key: key, Value: value, Source: SourceEnv, Origin: name}
+	}
+}
+
+// expandPath replaces a leading "~" of path with the home directory, as shells do for flags,
+// and makes other relative paths relative to baseDir unless it is empty
+func expandPath(path, baseDir string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+		return path
+	}
+	if baseDir != "" && path != "" && !filepath.IsAbs(path) {
+		return filepath.Join(baseDir, path)
+	}
+	return path
+}
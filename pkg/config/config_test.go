@@ -0,0 +1,88 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isolate points the user config and home directories to empty temporary ones and clears the environment variables
+// of every key, it returns the path of the user config
+func isolate(t *testing.T) string {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("HOME", t.TempDir())
+	for _, key := range Keys {
+		t.Setenv(EnvName(key), "")
+	}
+	userFile, ok := UserFilePath()
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(configHome, "bytecheck", UserFileName), userFile)
+	require.NoError(t, os.MkdirAll(filepath.Dir(userFile), 0755))
+	return userFile
+}
+
+func TestLoad_mustLetEnvironmentOverrideTreeOverrideUserConfig(t *testing.T) {
+	userFile := isolate(t)
+	treeDir := t.TempDir()
+	require.NoError(t, os.WriteFile(userFile, []byte("manifest-name: user.manifest\nfreshness-interval: 1h\ncolor: never\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(treeDir, TreeFileName), []byte("manifest-name: tree.manifest\nfreshness-interval: 24h\n"), 0644))
+	t.Setenv("BYTECHECK_MANIFEST_NAME", "env.manifest")
+
+	cfg, err := Load(treeDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Setting{
+		{Key: "color", Value: "never", Source: SourceUser, Origin: userFile},
+		{Key: "freshness-interval", Value: "24h", Source: SourceTree, Origin: filepath.Join(treeDir, TreeFileName)},
+		{Key: "manifest-name", Value: "env.manifest", Source: SourceEnv, Origin: "BYTECHECK_MANIFEST_NAME"},
+	}, cfg.Settings())
+	_, ok := cfg.Lookup("private-key")
+	assert.False(t, ok)
+}
+
+func TestLoad_WithoutTree_mustIgnoreTreeConfig(t *testing.T) {
+	isolate(t)
+	require.NoError(t, os.WriteFile(TreeFileName, []byte("freshness-interval: 24h\n"), 0644))
+	t.Cleanup(func() { os.Remove(TreeFileName) })
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Settings())
+}
+
+func TestLoad_mustExpandPaths(t *testing.T) {
+	userFile := isolate(t)
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+	treeDir := t.TempDir()
+	require.NoError(t, os.WriteFile(userFile, []byte("private-key: ~/.ssh/bytecheck\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(treeDir, TreeFileName), []byte("ssh-ca: keys/ca.pub\n"), 0644))
+
+	cfg, err := Load(treeDir)
+	require.NoError(t, err)
+
+	privateKey, _ := cfg.Lookup("private-key")
+	assert.Equal(t, filepath.Join(home, ".ssh", "bytecheck"), privateKey.Value)
+	sshCA, _ := cfg.Lookup("ssh-ca")
+	assert.Equal(t, filepath.Join(treeDir, "keys", "ca.pub"), sshCA.Value)
+}
+
+func TestLoad_WithInvalidConfig_mustFail(t *testing.T) {
+	userFile := isolate(t)
+
+	require.NoError(t, os.WriteFile(userFile, []byte("private_key: ~/.ssh/bytecheck\n"), 0644))
+	_, err := Load("")
+	assert.ErrorContains(t, err, "unknown key 'private_key'")
+
+	require.NoError(t, os.WriteFile(userFile, []byte("freshness-interval: [1h, 2h]\n"), 0644))
+	_, err = Load("")
+	assert.ErrorContains(t, err, "invalid config "+userFile)
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "BYTECHECK_FRESHNESS_INTERVAL", EnvName("freshness-interval"))
+}
@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+	"path/filepath"
+	"sort"
+)
+
+// DirectoryChange describes how a directory differs between two trees
+type DirectoryChange int
+
+const (
+	// DirectoryModified indicates the directory exists in both trees with different content
+	DirectoryModified DirectoryChange = iota
+	// DirectoryAdded indicates the directory exists only in tree B
+	DirectoryAdded
+	// DirectoryRemoved indicates the directory exists only in tree A
+	DirectoryRemoved
+)
+
+// String returns the string representation of the directory change
+func (c DirectoryChange) String() string {
+	switch c {
+	case DirectoryModified:
+		return "modified"
+	case DirectoryAdded:
+		return "added"
+	case DirectoryRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (c DirectoryChange) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// DirectoryDifference holds the differences found in a single directory
+type DirectoryDifference struct {
+	Path        string                      `json:"path"`
+	Change      DirectoryChange             `json:"change"`
+	Differences []manifest.EntityDifference `json:"differences"`
+}
+
+// Report is the result of comparing two manifest trees
+type Report struct {
+	RootA       string                `json:"rootA"`
+	RootB       string                `json:"rootB"`
+	Directories []DirectoryDifference `json:"directories"`
+}
+
+// HasDifferences returns true if any directory differs between the trees
+func (r *Report) HasDifferences() bool {
+	return len(r.Directories) > 0
+}
+
+// Source collects manifests of a directory tree keyed by path relative to the tree root
+type Source func(ctx context.Context, root string) (map[string]*manifest.Manifest, error)
+
+// StoredManifests returns a Source that loads existing manifest files without hashing any data.
+// Directories without a manifest are reported with an empty one.
+func StoredManifests(manifestName string) Source {
+	return func(ctx context.Context, root string) (map[string]*manifest.Manifest, error) {
+		manifests := make(map[string]*manifest.Manifest)
+		err := traverse.WalkPostOrder(ctx, root, func(ctx context.Context, dirPath string, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			manifestPath := filepath.Join(dirPath, manifestName)
+			m, err := manifest.LoadManifest(manifestPath)
+			if err != nil {
+				return fmt.Errorf("failed to load manifest for %s: %w", manifestPath, err)
+			}
+			if m == nil {
+				m = manifest.New(nil)
+			}
+			return addManifest(manifests, root, dirPath, m)
+		})
+		return manifests, err
+	}
+}
+
+// ScannedManifests returns a Source that computes manifests from the current directory content
+func ScannedManifests(sc *scanner.Scanner) Source {
+	return func(ctx context.Context, root string) (map[string]*manifest.Manifest, error) {
+		manifests := make(map[string]*manifest.Manifest)
+		err := sc.Walk(ctx, root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			if err != nil {
+				return fmt.Errorf("failed to scan directory: %w", err)
+			}
+			return addManifest(manifests, root, dirPath, m)
+		})
+		return manifests, err
+	}
+}
+
+func addManifest(manifests map[string]*manifest.Manifest, root, dirPath string, m *manifest.Manifest) error {
+	relPath, err := filepath.Rel(root, dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to determine relative path of %s: %w", dirPath, err)
+	}
+	// Paths use forward slashes so reports look the same on every OS
+	manifests[manifest.PortableName(relPath)] = m
+	return nil
+}
+
+// CompareTrees pairs manifests of both trees by relative directory path and compares them.
+// Directories are reported in lexical order of their relative paths.
+func CompareTrees(ctx context.Context, rootA, rootB string, source Source) (*Report, error) {
+	manifestsA, err := source(ctx, rootA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect manifests of %s: %w", rootA, err)
+	}
+	manifestsB, err := source(ctx, rootB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect manifests of %s: %w", rootB, err)
+	}
+
+	paths := make([]string, 0, len(manifestsA)+len(manifestsB))
+	for path := range manifestsA {
+		paths = append(paths, path)
+	}
+	for path := range manifestsB {
+		if _, exists := manifestsA[path]; !exists {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	report := &Report{RootA: rootA, RootB: rootB, Directories: make([]DirectoryDifference, 0)}
+	for _, path := range paths {
+		a, inA := manifestsA[path]
+		b, inB := manifestsB[path]
+		change := DirectoryModified
+		switch {
+		case !inA:
+			a, change = manifest.New(nil), DirectoryAdded
+		case !inB:
+			b, change = manifest.New(nil), DirectoryRemoved
+		}
+
+		identical, differences, err := manifest.CompareManifests(a, b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare manifests for %s: %w", path, err)
+		}
+		if identical && change == DirectoryModified {
+			continue
+		}
+		sort.Slice(differences, func(i, j int) bool {
+			return differences[i].Name < differences[j].Name
+		})
+		report.Directories = append(report.Directories, DirectoryDifference{
+			Path:        path,
+			Change:      change,
+			Differences: differences,
+		})
+	}
+	return report, nil
+}
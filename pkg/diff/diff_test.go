@@ -0,0 +1,106 @@
+package diff
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+func createTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for path, content := range files {
+		fullPath := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+	return root
+}
+
+func generateManifests(t *testing.T, root string) {
+	t.Helper()
+	sc := scanner.New()
+	err := sc.Walk(context.Background(), root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		require.NoError(t, err)
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	require.NoError(t, err)
+}
+
+func TestCompareTrees_IdenticalTrees(t *testing.T) {
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	rootA, rootB := createTree(t, files), createTree(t, files)
+	generateManifests(t, rootA)
+	generateManifests(t, rootB)
+
+	for name, source := range map[string]Source{
+		"stored":  StoredManifests(manifest.DefaultName),
+		"scanned": ScannedManifests(scanner.New()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			report, err := CompareTrees(context.Background(), rootA, rootB, source)
+			require.NoError(t, err)
+			assert.False(t, report.HasDifferences())
+		})
+	}
+}
+
+func TestCompareTrees_StoredManifests_ReportsChangesPerDirectory(t *testing.T) {
+	rootA := createTree(t, map[string]string{
+		"a.txt":         "a",
+		"sub/b.txt":     "b",
+		"removed/c.txt": "c",
+	})
+	rootB := createTree(t, map[string]string{
+		"a.txt":       "a",
+		"sub/b.txt":   "b changed",
+		"sub/new.txt": "new",
+		"added/d.txt": "d",
+	})
+	generateManifests(t, rootA)
+	generateManifests(t, rootB)
+
+	report, err := CompareTrees(context.Background(), rootA, rootB, StoredManifests(manifest.DefaultName))
+	require.NoError(t, err)
+	require.True(t, report.HasDifferences())
+
+	byPath := make(map[string]DirectoryDifference)
+	for _, dir := range report.Directories {
+		byPath[dir.Path] = dir
+	}
+	require.Len(t, byPath, 4)
+	assert.Equal(t, DirectoryModified, byPath["."].Change)
+	assert.Equal(t, DirectoryAdded, byPath["added"].Change)
+	assert.Equal(t, DirectoryRemoved, byPath["removed"].Change)
+
+	sub := byPath["sub"]
+	assert.Equal(t, DirectoryModified, sub.Change)
+	require.Len(t, sub.Differences, 2)
+	assert.Equal(t, "b.txt", sub.Differences[0].Name)
+	assert.Equal(t, manifest.DiffChecksumMismatch, sub.Differences[0].Type)
+	assert.Equal(t, "new.txt", sub.Differences[1].Name)
+	assert.Equal(t, manifest.DiffMissingInA, sub.Differences[1].Type)
+}
+
+func TestCompareTrees_StoredManifests_DoesNotHashData(t *testing.T) {
+	files := map[string]string{"a.txt": "a"}
+	rootA, rootB := createTree(t, files), createTree(t, files)
+	generateManifests(t, rootA)
+	generateManifests(t, rootB)
+	// Data changed after the manifest was generated is invisible in manifests-only mode
+	require.NoError(t, os.WriteFile(filepath.Join(rootB, "a.txt"), []byte("changed"), 0644))
+
+	report, err := CompareTrees(context.Background(), rootA, rootB, StoredManifests(manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, report.HasDifferences())
+
+	report, err = CompareTrees(context.Background(), rootA, rootB, ScannedManifests(scanner.New()))
+	require.NoError(t, err)
+	assert.True(t, report.HasDifferences())
+}
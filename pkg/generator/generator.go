@@ -2,10 +2,18 @@ package generator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"github.com/tomekjarosik/bytecheck/pkg/scanner"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/version"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
 // Generator handles manifest generation with optimization features
@@ -14,52 +22,381 @@ type Generator struct {
 	progressCh         chan scanner.Stats
 	signer             signing.Signer
 	manifestsGenerated []string
+	rootManifest       *manifest.Manifest
+	writer             ManifestWriter
+	issuerCertificate  []byte
+	stripSignatures    bool
+	signRootOnly       bool
+	signatures         SignatureStats
+	timestamp          *time.Time
+	certValidity       time.Duration
+	labels             map[string]string
+	labelRootOnly      bool
+	// dryRun keeps the manifests of a dry run in memory, see WithDryRun
+	dryRun            *scanner.ManifestOverlay
+	dryRunDirectories []DryRunDirectory
+	// onResult is called for every directory, see WithResultCallback
+	onResult ResultFunc
 }
 
 type Stats struct {
 	*scanner.Stats
 	ManifestsGenerated []string
+	// Signatures counts the existing signatures kept or dropped by an unsigned Generate run
+	Signatures SignatureStats
+	// DryRun lists what a dry run would do with the manifest of every directory visited, see WithDryRun
+	DryRun []DryRunDirectory
 }
 
-// New creates a new Generator instance
-func New(sc *scanner.Scanner, signer signing.Signer) *Generator {
-	return &Generator{
+// Option configures a Generator
+type Option func(g *Generator)
+
+// ResultFunc is called for every directory a generation visits, see WithResultCallback.
+// m is the final manifest of dirPath, with the auditor section when signing, and written reports whether it
+// was just handed to the ManifestWriter, which keeps it in memory in a dry run, rather than reused as fresh.
+// err is the error writing the manifest, if any.
+type ResultFunc func(ctx context.Context, dirPath string, m *manifest.Manifest, written bool, err error) error
+
+// WithManifestWriter stores manifests with w instead of saving them next to the scanned files.
+// It is required when the scanner reads a file system given by scanner.WithFS.
+func WithManifestWriter(w ManifestWriter) Option {
+	return func(g *Generator) {
+		g.writer = w
+	}
+}
+
+// WithIssuerCertificate records the SSH certificate of the signer's key, in wire format, in every signature,
+// which lets issuer.SSHCAVerifier trust it. See issuer.LoadSSHCertificate.
+func WithIssuerCertificate(cert []byte) Option {
+	return func(g *Generator) {
+		g.issuerCertificate = cert
+	}
+}
+
+// WithStripSignatures removes the signatures of existing manifests when generating without a signer.
+// They are kept by default as long as they still match the directory content.
+func WithStripSignatures(strip bool) Option {
+	return func(g *Generator) {
+		g.stripSignatures = strip
+	}
+}
+
+// WithSignRootOnly signs only the manifest of the root directory, the others are generated like without a signer.
+// The root signature covers the checksums of the child manifests, which cover theirs, so verification
+// can still establish trust for the whole tree, see verifier.ManifestVerificationStatus.Inherited.
+func WithSignRootOnly(rootOnly bool) Option {
+	return func(g *Generator) {
+		g.signRootOnly = rootOnly
+	}
+}
+
+// WithLabels stamps labels on every manifest generated, see manifest.Manifest.Labels. Manifests reused as fresh
+// keep their labels, the others lose the ones they had unless they are given again.
+func WithLabels(labels map[string]string) Option {
+	return func(g *Generator) {
+		g.labels = labels
+	}
+}
+
+// WithLabelRootOnly stamps the labels of WithLabels on the manifest of the root directory only
+func WithLabelRootOnly(rootOnly bool) Option {
+	return func(g *Generator) {
+		g.labelRootOnly = rootOnly
+	}
+}
+
+// WithSigner replaces the signer given to New, nil generates unsigned manifests
+func WithSigner(signer signing.Signer) Option {
+	return func(g *Generator) {
+		g.signer = signer
+	}
+}
+
+// WithReproducible records epoch as the signing time of every signature instead of the current time and ends the
+// saved manifests with a newline, so that runs on identical trees produce identical manifests. The auditor
+// sections of signed manifests still differ between runs: every run certifies a new ephemeral key, whose
+// signatures and certificate differ. Manifests record the generation time in embedded freshness mode, which
+// cannot be made reproducible.
+func WithReproducible(epoch time.Time) Option {
+	return func(g *Generator) {
+		epoch = epoch.UTC()
+		g.timestamp = &epoch
+	}
+}
+
+// WithCertificateValidity limits the certificates of the ephemeral signing keys to validity from the start of the run,
+// so that a leaked key cannot sign manifests that verify forever. They never expire by default.
+func WithCertificateValidity(validity time.Duration) Option {
+	return func(g *Generator) {
+		g.certValidity = validity
+	}
+}
+
+// WithResultCallback calls fn for every directory of Generate, RegeneratePath and RegenerateDirectories once its
+// manifest is written, or with written unset once it is reused as fresh. Directories are reported in post-order,
+// children before their parent and the root last, from the goroutine calling Generate. An error returned by fn
+// aborts the generation and is returned, like one returned by a scanner.ScannedDirFunc. A failed write aborts
+// the generation whatever fn returns.
+func WithResultCallback(fn ResultFunc) Option {
+	return func(g *Generator) {
+		g.onResult = fn
+	}
+}
+
+// WithDryRun makes Generate and RegeneratePath write nothing. Every manifest is compared with the one
+// stored in its directory instead, see GetStats, and kept in overlay, which must also be given to the scanner
+// with scanner.WithManifestOverlay so that parents are computed from the manifests of their subdirectories.
+// Nothing is signed.
+func WithDryRun(overlay *scanner.ManifestOverlay) Option {
+	return func(g *Generator) {
+		g.dryRun = overlay
+	}
+}
+
+// New creates a new Generator instance. A nil signer generates unsigned manifests.
+func New(sc *scanner.Scanner, signer signing.Signer, opts ...Option) *Generator {
+	g := &Generator{
 		scanner: sc,
 		signer:  signer,
 	}
+	for _, o := range opts {
+		o(g)
+	}
+	return g
 }
 
-// Generate generates manifests using the appropriate processor based on signer capabilities
+// checkWritable makes sure manifests of rootPath can be stored, see ensureWritable.
+// Custom writers are responsible for their own storage.
+func (g *Generator) checkWritable(rootPath string) error {
+	if g.writer != nil {
+		return nil
+	}
+	if g.scanner.GetFS() != nil {
+		return fmt.Errorf("a manifest writer is required for trees read through scanner.WithFS")
+	}
+	return ensureWritable(rootPath)
+}
+
+// manifestWriter returns the writer given by WithManifestWriter or FileWriter
+func (g *Generator) manifestWriter() ManifestWriter {
+	if g.writer != nil {
+		return g.writer
+	}
+	return FileWriter{TrailingNewline: g.timestamp != nil}
+}
+
+// join returns how processors join manifest paths, with slashes when the tree is read through scanner.WithFS
+func (g *Generator) join() func(elem ...string) string {
+	if g.scanner.GetFS() != nil {
+		return path.Join
+	}
+	return filepath.Join
+}
+
+// Generate generates manifests, signed unless the generator has no signer
 func (g *Generator) Generate(ctx context.Context, rootPath string) error {
-	processor, err := g.createProcessor()
+	if g.dryRun == nil {
+		if err := g.checkWritable(rootPath); err != nil {
+			return err
+		}
+	}
+	return g.generate(ctx, rootPath, g.scanner.Walk)
+}
+
+// RegeneratePath updates the manifests affected by changes of changedPaths inside rootPath, see
+// scanner.Scanner.WalkChanged: the directory containing a change, or its whole subtree when the changed path is
+// a directory, and every ancestor up to rootPath, which record the new checksums. Manifests of deleted
+// directories disappear with them, their parents stop listing them. GetStats reports the last call only,
+// so it can be called repeatedly, e.g. while watching a tree. Unlike Generate it writes nothing but manifests.
+func (g *Generator) RegeneratePath(ctx context.Context, rootPath string, changedPaths ...string) error {
+	g.manifestsGenerated = nil
+	g.signatures = SignatureStats{}
+	g.rootManifest = nil
+	g.dryRunDirectories = nil
+	return g.generate(ctx, rootPath, func(ctx context.Context, root string, walkFn scanner.ScannedDirFunc) error {
+		return g.scanner.WalkChanged(ctx, root, changedPaths, walkFn)
+	})
+}
+
+// RegenerateDirectories updates the manifests of dirPaths inside rootPath, without descending into their
+// subdirectories, and of their ancestors up to rootPath, see scanner.Scanner.WalkDirectories.
+// Like RegeneratePath, GetStats reports the last call only.
+func (g *Generator) RegenerateDirectories(ctx context.Context, rootPath string, dirPaths ...string) error {
+	g.manifestsGenerated = nil
+	g.signatures = SignatureStats{}
+	g.rootManifest = nil
+	g.dryRunDirectories = nil
+	return g.generate(ctx, rootPath, func(ctx context.Context, root string, walkFn scanner.ScannedDirFunc) error {
+		return g.scanner.WalkDirectories(ctx, root, dirPaths, walkFn)
+	})
+}
+
+// generate processes the directories visited by walk
+func (g *Generator) generate(ctx context.Context, rootPath string,
+	walk func(ctx context.Context, root string, walkFn scanner.ScannedDirFunc) error) error {
+	processor, err := g.createProcessor(rootPath)
 	if err != nil {
 		return fmt.Errorf("failed to create processor: %w", err)
 	}
 
-	return g.scanner.Walk(ctx, rootPath, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+	return walk(ctx, rootPath, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
 		if err != nil {
 			return err
 		}
+		// Directories are visited in post-order, so the root comes last
+		g.rootManifest = m
 		if cached {
-			return nil
+			if g.dryRun != nil {
+				g.dryRunDirectories = append(g.dryRunDirectories, DryRunDirectory{Path: dirPath, Outcome: DryRunUnchanged})
+			}
+			return g.reportResult(ctx, dirPath, m, false, nil)
+		}
+		manifestPath := g.scanner.ManifestPath(dirPath)
+		m.GeneratedBy = version.String()
+		if len(g.labels) > 0 && (!g.labelRootOnly || filepath.Clean(dirPath) == filepath.Clean(rootPath)) {
+			m.Labels = g.labels
+		}
+		if err := processor.Process(dirPath, m, filepath.Base(manifestPath)); err != nil {
+			_ = g.reportResult(ctx, dirPath, m, false, err)
+			return err
 		}
-		return processor.Process(dirPath, m, g.scanner.GetManifestName())
+		g.scanner.GetLogger().Debug("manifest written", "path", manifestPath)
+		return g.reportResult(ctx, dirPath, m, true, nil)
 	})
 }
 
-// createProcessor determines which processor to use based on signer capabilities
-func (g *Generator) createProcessor() (ManifestProcessor, error) {
-	// Test if signer supports signing
-	// TODO: pass proper signing method from outside. Do not guess it.
-	if g.signer.Reference() == "fake" {
-		return NewUnsignedProcessor(&g.manifestsGenerated), nil
+// reportResult passes the result of dirPath to the callback of WithResultCallback, if any, and records it on the
+// span of the directory, see scanner.WithTracer
+func (g *Generator) reportResult(ctx context.Context, dirPath string, m *manifest.Manifest, written bool, err error) error {
+	telemetry.Annotate(ctx, telemetry.Bool(telemetry.KeyManifestWritten, written && err == nil))
+	if g.onResult == nil {
+		return nil
 	}
-	return NewSignedProcessor(g.signer, &g.manifestsGenerated)
+	return g.onResult(ctx, dirPath, m, written, err)
+}
+
+// RootDigest returns the digest of the root manifest of the last Generate run, see manifest.RootDigest
+func (g *Generator) RootDigest() (string, error) {
+	if g.rootManifest == nil {
+		return "", fmt.Errorf("no manifests generated")
+	}
+	return manifest.RootDigest(g.rootManifest)
+}
+
+// RootSubtree returns the totals recorded in the root manifest of the last Generate run,
+// nil if they are unknown, see manifest.Manifest.Subtree
+func (g *Generator) RootSubtree() *manifest.SubtreeTotals {
+	if g.rootManifest == nil {
+		return nil
+	}
+	return g.rootManifest.Subtree
+}
+
+// Attest co-signs existing manifests starting from rootPath. Every manifest must still
+// match its directory content; signatures of other auditors are preserved.
+func (g *Generator) Attest(ctx context.Context, rootPath string) error {
+	if g.signer == nil {
+		return fmt.Errorf("attesting manifests requires a signer")
+	}
+	if err := g.checkWritable(rootPath); err != nil {
+		return err
+	}
+	processor, err := NewCosignProcessor(g.signer, &g.manifestsGenerated, g.certValidity)
+	if err != nil {
+		return fmt.Errorf("failed to create processor: %w", err)
+	}
+	processor.logger = g.scanner.GetLogger()
+	processor.writer = g.manifestWriter()
+	processor.join = g.join()
+	processor.signerCertificate.IssuerCert = g.issuerCertificate
+	processor.timestamp = g.timestamp
+
+	return g.scanner.Walk(ctx, rootPath, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		manifestPath := g.scanner.ManifestPath(dirPath)
+		existing, err := g.scanner.LoadManifest(dirPath)
+		if err != nil {
+			return fmt.Errorf("failed to load manifest for %s: %w", manifestPath, err)
+		}
+		if existing == nil {
+			return fmt.Errorf("manifest in directory '%s' not found", dirPath)
+		}
+		if !cached {
+			identical, _, err := manifest.CompareManifests(existing, m)
+			if err != nil {
+				return fmt.Errorf("failed to compare manifests for %s: %w", manifestPath, err)
+			}
+			if !identical {
+				return fmt.Errorf("manifest in directory '%s' does not match its content, regenerate it before attesting", dirPath)
+			}
+		}
+		if err := processor.Process(dirPath, existing, filepath.Base(manifestPath)); err != nil {
+			return err
+		}
+		g.scanner.GetLogger().Debug("manifest attested", "path", manifestPath)
+		return nil
+	})
+}
+
+// ensureWritable returns one clear error when rootPath is on a read-only filesystem or is not
+// writable, instead of failing in the first directory whose manifest cannot be saved.
+// Other errors, like a missing directory, are left for the scan to report.
+func ensureWritable(rootPath string) error {
+	err := checkWriteAccess(rootPath)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("cannot write manifests, directory '%s' is read-only: %w", rootPath, err)
+	}
+	return nil
+}
+
+// createProcessor determines which processor to use for the tree at rootPath, manifests are signed unless the signer is nil
+func (g *Generator) createProcessor(rootPath string) (ManifestProcessor, error) {
+	if g.dryRun != nil {
+		processor := NewDryRunProcessor(g.dryRun, &g.dryRunDirectories)
+		processor.join = g.join()
+		processor.logger = g.scanner.GetLogger()
+		processor.load = g.scanner.LoadManifest
+		return processor, nil
+	}
+	if g.signer == nil {
+		if g.signRootOnly {
+			return nil, fmt.Errorf("signing only the root manifest requires a signer")
+		}
+		return g.createUnsignedProcessor(), nil
+	}
+	processor, err := NewSignedProcessor(g.signer, &g.manifestsGenerated, g.certValidity)
+	if err != nil {
+		return nil, err
+	}
+	processor.logger = g.scanner.GetLogger()
+	processor.writer = g.manifestWriter()
+	processor.join = g.join()
+	processor.signerCertificate.IssuerCert = g.issuerCertificate
+	processor.timestamp = g.timestamp
+	if g.signRootOnly {
+		return NewRootOnlyProcessor(rootPath, processor, g.createUnsignedProcessor()), nil
+	}
+	return processor, nil
+}
+
+func (g *Generator) createUnsignedProcessor() *UnsignedProcessor {
+	processor := NewUnsignedProcessor(&g.manifestsGenerated)
+	processor.writer = g.manifestWriter()
+	processor.join = g.join()
+	processor.logger = g.scanner.GetLogger()
+	processor.load = g.scanner.LoadManifest
+	processor.strip = g.stripSignatures
+	processor.signatures = &g.signatures
+	return processor
 }
 
 func (g *Generator) GetStats() Stats {
 	return Stats{
 		Stats:              g.scanner.GetStats(),
 		ManifestsGenerated: g.manifestsGenerated,
+		Signatures:         g.signatures,
+		DryRun:             g.dryRunDirectories,
 	}
 }
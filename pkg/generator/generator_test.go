@@ -0,0 +1,408 @@
+package generator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// mapFSWriter stores manifests in the scanned MapFS, so parents see the manifests of their children
+type mapFSWriter struct {
+	fsys fstest.MapFS
+}
+
+func (w mapFSWriter) WriteManifest(manifestPath string, m *manifest.Manifest) error {
+	data, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	w.fsys[manifestPath] = &fstest.MapFile{Data: data, Mode: 0644}
+	return nil
+}
+
+func TestGenerate_WithFSAndManifestWriter(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":    {Data: []byte("root")},
+		"sub/a.txt":   {Data: []byte("a")},
+		"sub/b/c.txt": {Data: []byte("c")},
+	}
+	sc := scanner.New(scanner.WithFS(fsys))
+	gen := New(sc, nil, WithManifestWriter(mapFSWriter{fsys: fsys}))
+
+	require.NoError(t, gen.Generate(context.Background(), "."))
+
+	assert.Equal(t, []string{"sub/b", "sub", "."}, gen.GetStats().ManifestsGenerated)
+	for _, name := range []string{"sub/b/.bytecheck.manifest", "sub/.bytecheck.manifest", ".bytecheck.manifest"} {
+		m, err := manifest.LoadManifestFS(fsys, name)
+		require.NoError(t, err)
+		require.NotNil(t, m, name)
+	}
+	_, err := gen.RootDigest()
+	assert.NoError(t, err)
+}
+
+func TestGenerate_WithFSWithoutManifestWriter_mustFail(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("a")}}
+	gen := New(scanner.New(scanner.WithFS(fsys)), nil)
+
+	err := gen.Generate(context.Background(), ".")
+	assert.ErrorContains(t, err, "a manifest writer is required")
+}
+
+// signTree generates signed manifests for a tree with a root file and a subdirectory
+func signTree(t *testing.T, opts ...scanner.Option) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.txt"), []byte("root"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	gen := New(scanner.New(opts...), signing.NewEd25519Signer(privKey, "custom:alice"))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+	return dir
+}
+
+// requireSignedManifest asserts that the manifest of dir carries one valid signature
+func requireSignedManifest(t *testing.T, dir string) {
+	t.Helper()
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Len(t, m.Auditors, 1, dir)
+	data, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	assert.True(t, signatureMatches(&m.Auditors[0], data), dir)
+}
+
+func TestGenerate_UnsignedOverUnchangedSignedTree_PreservesSignatures(t *testing.T) {
+	for name, opts := range map[string][]scanner.Option{
+		"mtime":    nil,
+		"embedded": {scanner.WithFreshnessMode(scanner.FreshnessModeEmbedded)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := signTree(t, opts...)
+
+			gen := New(scanner.New(opts...), nil)
+			require.NoError(t, gen.Generate(context.Background(), dir))
+
+			assert.Equal(t, SignatureStats{Preserved: 2}, gen.GetStats().Signatures)
+			requireSignedManifest(t, dir)
+			requireSignedManifest(t, filepath.Join(dir, "sub"))
+		})
+	}
+}
+
+func TestGenerate_UnsignedOverChangedSignedTree_DropsInvalidatedSignatures(t *testing.T) {
+	dir := signTree(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.txt"), []byte("changed"), 0644))
+
+	gen := New(scanner.New(), nil)
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	assert.Equal(t, SignatureStats{Preserved: 1, Invalidated: 1}, gen.GetStats().Signatures)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Empty(t, m.Auditors)
+	requireSignedManifest(t, filepath.Join(dir, "sub"))
+}
+
+func TestGenerate_WithStripSignatures_RemovesSignatures(t *testing.T) {
+	dir := signTree(t)
+
+	gen := New(scanner.New(), nil, WithStripSignatures(true))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	assert.Equal(t, SignatureStats{Stripped: 2}, gen.GetStats().Signatures)
+	for _, path := range []string{dir, filepath.Join(dir, "sub")} {
+		m, err := manifest.LoadManifest(filepath.Join(path, manifest.DefaultName))
+		require.NoError(t, err)
+		assert.False(t, m.IsAudited(), path)
+	}
+}
+
+func TestGenerate_WithSignRootOnly_SignsOnlyRootManifest(t *testing.T) {
+	dir := signTree(t)
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	gen := New(scanner.New(), signing.NewEd25519Signer(privKey, "custom:bob"), WithSignRootOnly(true), WithStripSignatures(true))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	requireSignedManifest(t, dir)
+	m, err := manifest.LoadManifest(filepath.Join(dir, "sub", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, m.IsAudited())
+	assert.Equal(t, SignatureStats{Stripped: 1}, gen.GetStats().Signatures)
+}
+
+func TestGenerate_WithSignRootOnlyWithoutSigner_mustFail(t *testing.T) {
+	gen := New(scanner.New(), nil, WithSignRootOnly(true))
+
+	err := gen.Generate(context.Background(), t.TempDir())
+	assert.ErrorContains(t, err, "signing only the root manifest requires a signer")
+}
+
+// recordingProcessor records the arguments of Process
+type recordingProcessor struct {
+	names []string
+}
+
+func (p *recordingProcessor) Process(dirPath string, m *manifest.Manifest, manifestName string) error {
+	p.names = append(p.names, dirPath+": "+manifestName)
+	return nil
+}
+
+func TestRootOnlyProcessor_PassesTheManifestName(t *testing.T) {
+	root, others := &recordingProcessor{}, &recordingProcessor{}
+	processor := NewRootOnlyProcessor("/tree", root, others)
+
+	require.NoError(t, processor.Process("/tree/sub", &manifest.Manifest{}, manifest.DefaultName))
+	require.NoError(t, processor.Process("/tree", &manifest.Manifest{}, "root.manifest"))
+
+	assert.Equal(t, []string{"/tree: root.manifest"}, root.names)
+	assert.Equal(t, []string{"/tree/sub: " + manifest.DefaultName}, others.names)
+}
+
+func TestUnsignedProcessor_JoinsTheManifestName(t *testing.T) {
+	fsys := fstest.MapFS{}
+	processor := NewUnsignedProcessor(&[]string{})
+	processor.writer = mapFSWriter{fsys: fsys}
+	processor.load = func(string) (*manifest.Manifest, error) { return nil, nil }
+
+	require.NoError(t, processor.Process(filepath.Join("a", "b"), &manifest.Manifest{}, "custom.manifest"))
+
+	assert.Contains(t, fsys, filepath.Join("a", "b", "custom.manifest"))
+}
+
+func TestDryRunProcessor_LoadsTheExistingManifestUnderItsName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, FileWriter{}.WriteManifest(filepath.Join(dir, "custom.manifest"), &manifest.Manifest{}))
+	var directories []DryRunDirectory
+	processor := NewDryRunProcessor(mapFSWriter{fsys: fstest.MapFS{}}, &directories)
+
+	require.NoError(t, processor.Process(dir, &manifest.Manifest{}, "custom.manifest"))
+
+	require.Len(t, directories, 1)
+	assert.Equal(t, DryRunUnchanged, directories[0].Outcome)
+}
+
+func TestRegeneratePath_UpdatesAffectedManifestsOnly(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "root.txt"), []byte("root"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "deep", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "other"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other", "b.txt"), []byte("b"), 0644))
+	gen := New(scanner.New(), nil)
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "deep", "a.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "new", "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "new", "nested", "c.txt"), []byte("c"), 0644))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "other")))
+	err := gen.RegeneratePath(context.Background(), dir, filepath.Join(dir, "sub", "deep", "a.txt"),
+		filepath.Join(dir, "sub", "new"), filepath.Join(dir, "other", "b.txt"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "sub", "deep"),
+		filepath.Join(dir, "sub", "new", "nested"),
+		filepath.Join(dir, "sub", "new"),
+		filepath.Join(dir, "sub"),
+		dir,
+	}, gen.GetStats().ManifestsGenerated)
+	digest, err := gen.RootDigest()
+	require.NoError(t, err)
+
+	// The updated manifests equal those of a full run
+	full := New(scanner.New(), nil)
+	require.NoError(t, full.Generate(context.Background(), dir))
+	fullDigest, err := full.RootDigest()
+	require.NoError(t, err)
+	assert.Equal(t, fullDigest, digest)
+}
+
+func TestGenerate_WithDryRun_MatchesRealRunWithoutWriting(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":    {Data: []byte("root")},
+		"sub/a.txt":   {Data: []byte("a")},
+		"sub/b/c.txt": {Data: []byte("c")},
+		"other/d.txt": {Data: []byte("d")},
+	}
+	writer := mapFSWriter{fsys: fsys}
+	require.NoError(t, New(scanner.New(scanner.WithFS(fsys)), nil, WithManifestWriter(writer)).
+		Generate(context.Background(), "."))
+	fsys["sub/b/c.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	fsys["new/e.txt"] = &fstest.MapFile{Data: []byte("e")}
+	rootManifest := fsys[".bytecheck.manifest"].Data
+
+	overlay := scanner.NewManifestOverlay()
+	dryRun := New(scanner.New(scanner.WithFS(fsys), scanner.WithManifestOverlay(overlay)), nil,
+		WithDryRun(overlay))
+	require.NoError(t, dryRun.Generate(context.Background(), "."))
+
+	outcomes := make(map[string]DryRunOutcome)
+	for _, dir := range dryRun.GetStats().DryRun {
+		outcomes[dir.Path] = dir.Outcome
+	}
+	assert.Equal(t, map[string]DryRunOutcome{"sub/b": DryRunUpdated, "sub": DryRunUpdated, "other": DryRunUnchanged,
+		"new": DryRunNew, ".": DryRunUpdated}, outcomes)
+	assert.Empty(t, dryRun.GetStats().ManifestsGenerated)
+	assert.Equal(t, rootManifest, fsys[".bytecheck.manifest"].Data)
+	assert.NotContains(t, fsys, "new/.bytecheck.manifest")
+
+	regenerated := New(scanner.New(scanner.WithFS(fsys)), nil, WithManifestWriter(writer))
+	require.NoError(t, regenerated.Generate(context.Background(), "."))
+	expected, err := regenerated.RootDigest()
+	require.NoError(t, err)
+	actual, err := dryRun.RootDigest()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+// countingSigner counts the calls of Sign of the signer it wraps
+type countingSigner struct {
+	signing.Signer
+	calls int
+}
+
+func (s *countingSigner) Sign(data []byte) ([]byte, error) {
+	s.calls++
+	return s.Signer.Sign(data)
+}
+
+func TestGenerate_WithNilSigner_mustNeverSign(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signer := &countingSigner{Signer: signing.NewEd25519Signer(privKey, "custom:alice")}
+
+	require.NoError(t, New(scanner.New(), signer, WithSigner(nil)).Generate(context.Background(), dir))
+	assert.Zero(t, signer.calls)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.False(t, m.IsAudited())
+
+	require.NoError(t, New(scanner.New(), nil, WithSigner(signer)).Generate(context.Background(), dir))
+	assert.Positive(t, signer.calls)
+	requireSignedManifest(t, dir)
+}
+
+func TestAttest_WithNilSigner_mustFail(t *testing.T) {
+	err := New(scanner.New(), nil).Attest(context.Background(), t.TempDir())
+	assert.EqualError(t, err, "attesting manifests requires a signer")
+}
+
+// generatedResult is a call of a ResultFunc
+type generatedResult struct {
+	dirPath string
+	data    []byte
+	written bool
+}
+
+// collectResults returns a ResultFunc recording its calls in results, with the manifests encoded like Save does
+func collectResults(t *testing.T, results *[]generatedResult) ResultFunc {
+	return func(ctx context.Context, dirPath string, m *manifest.Manifest, written bool, err error) error {
+		require.NoError(t, err)
+		data, err := m.Encode()
+		require.NoError(t, err)
+		*results = append(*results, generatedResult{dirPath: dirPath, data: data, written: written})
+		return nil
+	}
+}
+
+func TestGenerate_WithResultCallback_ReportsManifestsWrittenInPostOrder(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "b", "b.txt"), []byte("b"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "c"), 0755))
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	var results []generatedResult
+
+	gen := New(scanner.New(), signing.NewEd25519Signer(privKey, "custom:alice"),
+		WithResultCallback(collectResults(t, &results)))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	require.Len(t, results, 4)
+	position := make(map[string]int)
+	for i, result := range results {
+		position[result.dirPath] = i
+		assert.True(t, result.written, result.dirPath)
+		onDisk, err := os.ReadFile(filepath.Join(result.dirPath, manifest.DefaultName))
+		require.NoError(t, err)
+		assert.Equal(t, string(onDisk), string(result.data), result.dirPath)
+		assert.Contains(t, string(result.data), `"auditors"`, result.dirPath)
+	}
+	assert.Less(t, position[filepath.Join(dir, "a", "b")], position[filepath.Join(dir, "a")])
+	assert.Equal(t, dir, results[3].dirPath)
+	assert.ElementsMatch(t, gen.GetStats().ManifestsGenerated,
+		[]string{dir, filepath.Join(dir, "a"), filepath.Join(dir, "a", "b"), filepath.Join(dir, "c")})
+}
+
+func TestGenerate_WithResultCallback_ReportsFreshManifestsAsNotWritten(t *testing.T) {
+	dir := signTree(t)
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, manifest.DefaultName), old, old))
+	var results []generatedResult
+
+	gen := New(scanner.New(scanner.WithManifestFreshnessLimit(time.Hour)), nil,
+		WithResultCallback(collectResults(t, &results)))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+
+	// The root is regenerated, its fresh child is reused as is
+	require.Len(t, results, 2)
+	assert.Equal(t, filepath.Join(dir, "sub"), results[0].dirPath)
+	assert.False(t, results[0].written)
+	assert.Equal(t, dir, results[1].dirPath)
+	assert.True(t, results[1].written)
+	for _, result := range results {
+		onDisk, err := os.ReadFile(filepath.Join(result.dirPath, manifest.DefaultName))
+		require.NoError(t, err)
+		assert.Equal(t, string(onDisk), string(result.data), result.dirPath)
+	}
+}
+
+func TestGenerate_WithFailingResultCallback_mustAbort(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	errUpload := errors.New("upload failed")
+
+	gen := New(scanner.New(), nil, WithResultCallback(
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, written bool, err error) error {
+			return errUpload
+		}))
+	err := gen.Generate(context.Background(), dir)
+
+	assert.ErrorIs(t, err, errUpload)
+	assert.FileExists(t, filepath.Join(dir, "sub", manifest.DefaultName))
+	assert.NoFileExists(t, filepath.Join(dir, manifest.DefaultName))
+}
+
+func TestEnsureWritable_LeavesTheDirectoryUntouched(t *testing.T) {
+	dir := t.TempDir()
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(dir, past, past))
+
+	require.NoError(t, ensureWritable(dir))
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(past), "no probe file may be created in the tree")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
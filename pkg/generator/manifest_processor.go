@@ -2,10 +2,18 @@ package generator
 
 import (
 	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"log/slog"
+	"maps"
+	"os"
 	"path/filepath"
+	"slices"
+	"time"
 )
 
 type Signer interface {
@@ -16,57 +24,112 @@ type Signer interface {
 	Close() error
 }
 
+// ManifestProcessor stores the manifest m of dirPath under manifestName, the file name of the manifest in dirPath
 type ManifestProcessor interface {
 	Process(dirPath string, m *manifest.Manifest, manifestName string) error
 }
 
+// ManifestWriter stores the manifests produced by processors
+type ManifestWriter interface {
+	WriteManifest(manifestPath string, m *manifest.Manifest) error
+}
+
+// FileWriter is the default ManifestWriter, it saves manifests to the OS file system
+type FileWriter struct {
+	// TrailingNewline ends the saved files with a newline, as tools expecting POSIX text files do, see
+	// WithReproducible. Parents checksum the manifests regardless of it, see manifest.UnsignedData.
+	TrailingNewline bool
+}
+
+// WriteManifest implements ManifestWriter
+func (w FileWriter) WriteManifest(manifestPath string, m *manifest.Manifest) error {
+	if !w.TrailingNewline {
+		return m.Save(manifestPath)
+	}
+	data, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, append(data, '\n'), 0644)
+}
+
 // SignedProcessor handles manifests with cryptographic signatures
 type SignedProcessor struct {
-	signerCertificate  manifest.Certificate
+	signerCertificate  *signing.SimpleCertificate
 	signer             Signer
 	manifestsGenerated *[]string
+	cosign             bool
+	logger             *slog.Logger
+	writer             ManifestWriter
+	// join builds the path of the manifest in dirPath, path.Join for trees read through scanner.WithFS
+	join func(elem ...string) string
+	// timestamp replaces the signing time recorded with every signature when set, see WithReproducible
+	timestamp *time.Time
 }
 
-// UnsignedProcessor handles manifests without signatures
+// UnsignedProcessor handles manifests without signatures.
+// Signatures of existing manifests that still match are kept unless stripping is requested.
 type UnsignedProcessor struct {
 	manifestsGenerated *[]string
+	writer             ManifestWriter
+	join               func(elem ...string) string
+	logger             *slog.Logger
+	// load returns the existing manifest of a directory, nil if there is none. When unset, the manifest
+	// named as passed to Process is read from the file system.
+	load       func(dirPath string) (*manifest.Manifest, error)
+	strip      bool
+	signatures *SignatureStats
 }
 
-// NewSignedProcessor creates a processor that signs manifests
-func NewSignedProcessor(rootSigner Signer, manifestsGenerated *[]string) (*SignedProcessor, error) {
+// SignatureStats counts what happened to the signatures of existing manifests in an unsigned run
+type SignatureStats struct {
+	// Preserved signatures still match the regenerated manifest
+	Preserved int
+	// Invalidated signatures were dropped because the directory content changed
+	Invalidated int
+	// Stripped signatures were dropped on request, see WithStripSignatures
+	Stripped int
+}
+
+// NewSignedProcessor creates a processor that signs manifests with an ephemeral key certified by rootSigner.
+// A positive validity limits how long the certificate is valid, see signing.IssueCertificate.
+func NewSignedProcessor(rootSigner Signer, manifestsGenerated *[]string, validity time.Duration) (*SignedProcessor, error) {
 	pubKey, privKey, err := ed25519.GenerateKey(nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ephemeral signing key: %w", err)
 	}
 
-	dataToSign := append(pubKey[:], []byte(rootSigner.Reference())...)
-	signature, err := rootSigner.Sign(dataToSign)
+	certificate, err := signing.IssueCertificate(rootSigner, pubKey, validity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to sign intermediate signer public key using root signer: %w", err)
+		return nil, fmt.Errorf("failed to certify intermediate signer public key using root signer: %w", err)
 	}
 
 	intermediateSigner := signing.NewEd25519Signer(privKey, "ephemeral")
 
-	issuerPublicKey, err := rootSigner.PublicKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get root signer public key: %w", err)
-	}
-
 	return &SignedProcessor{
-		signerCertificate: &manifest.SimpleCertificate{
-			PubKey:       pubKey,
-			Sig:          signature,
-			IssuerPubKey: issuerPublicKey,
-			IssuerRef:    rootSigner.Reference(),
-			SigAlgo:      rootSigner.Algorithm(),
-		},
+		signerCertificate:  certificate,
 		signer:             intermediateSigner,
 		manifestsGenerated: manifestsGenerated,
+		logger:             logging.Logger(),
+		writer:             FileWriter{},
+		join:               filepath.Join,
 	}, nil
 }
 
+// NewCosignProcessor creates a processor that appends a signature to manifests,
+// keeping the signatures of other auditors intact
+func NewCosignProcessor(rootSigner Signer, manifestsGenerated *[]string, validity time.Duration) (*SignedProcessor, error) {
+	p, err := NewSignedProcessor(rootSigner, manifestsGenerated, validity)
+	if err != nil {
+		return nil, err
+	}
+	p.cosign = true
+	return p, nil
+}
+
 // Process implements ManifestProcessor for signed manifests
 func (p *SignedProcessor) Process(dirPath string, m *manifest.Manifest, manifestName string) error {
+	manifestPath := p.join(dirPath, manifestName)
 	*p.manifestsGenerated = append(*p.manifestsGenerated, dirPath)
 
 	manifestData, err := m.DataWithoutAuditor()
@@ -78,21 +141,219 @@ func (p *SignedProcessor) Process(dirPath string, m *manifest.Manifest, manifest
 	if err != nil {
 		return fmt.Errorf("failed to sign manifest: %w", err)
 	}
+	p.logger.Debug("signature created", "dir", dirPath, "auditor", p.signerCertificate.IssuerReference())
 
-	m.SetAuditedBy(p.signerCertificate, manifestSignature)
-	return m.Save(filepath.Join(dirPath, manifestName))
+	var auditor *manifest.AuditorData
+	if p.cosign {
+		if auditor, err = m.AddAuditor(p.signerCertificate, manifestSignature, p.signer.Algorithm()); err != nil {
+			return fmt.Errorf("failed to co-sign manifest of %s: %w", dirPath, err)
+		}
+	} else {
+		auditor = m.SetAuditedBy(p.signerCertificate, manifestSignature, p.signer.Algorithm())
+	}
+	if p.timestamp != nil {
+		auditor.Timestamp = *p.timestamp
+	}
+	if auditor.AttributesSignature, err = p.signAttributes(m, auditor); err != nil {
+		return err
+	}
+	return p.writer.WriteManifest(manifestPath, m)
+}
+
+// signAttributes returns the hex encoded signature of the timestamp and algorithm of the auditor of m
+func (p *SignedProcessor) signAttributes(m *manifest.Manifest, auditor *manifest.AuditorData) (string, error) {
+	data, err := m.AttributesData(auditor.Timestamp, auditor.Algorithm)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal auditor attributes: %w", err)
+	}
+	signature, err := p.signer.Sign(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign auditor attributes: %w", err)
+	}
+	return hex.EncodeToString(signature), nil
 }
 
 // NewUnsignedProcessor creates a processor that saves manifests without signatures
 func NewUnsignedProcessor(manifestsGenerated *[]string) *UnsignedProcessor {
 	return &UnsignedProcessor{
 		manifestsGenerated: manifestsGenerated,
+		writer:             FileWriter{},
+		join:               filepath.Join,
+		logger:             logging.Logger(),
+		signatures:         &SignatureStats{},
 	}
 }
 
 // Process implements ManifestProcessor for unsigned manifests
 func (p *UnsignedProcessor) Process(dirPath string, m *manifest.Manifest, manifestName string) error {
+	manifestPath := p.join(dirPath, manifestName)
 	*p.manifestsGenerated = append(*p.manifestsGenerated, dirPath)
-	m.SetAuditedBy(nil, nil)
-	return m.Save(filepath.Join(dirPath, manifestName))
+	m.SetAuditedBy(nil, nil, "")
+	if err := p.keepSignatures(dirPath, manifestPath, m); err != nil {
+		return err
+	}
+	return p.writer.WriteManifest(manifestPath, m)
+}
+
+// keepSignatures copies the auditors of the existing manifest whose signatures are still valid for m.
+// Signatures also cover the embedded freshness data, which is taken over from the existing manifest
+// when any signature is kept, so regenerating an unchanged directory does not invalidate them.
+func (p *UnsignedProcessor) keepSignatures(dirPath, manifestPath string, m *manifest.Manifest) error {
+	existing, err := loadExisting(p.load, dirPath, manifestPath)
+	if errors.Is(err, manifest.ErrInvalidManifest) {
+		// A damaged manifest, or a file that merely has the manifest name, is replaced
+		p.logger.Warn("invalid manifest replaced", "dir", dirPath, "error", err)
+		return nil
+	}
+	if err != nil {
+		// Its signatures cannot be trusted anyway
+		p.logger.Debug("existing manifest unreadable, signatures dropped", "dir", dirPath, "error", err)
+		return nil
+	}
+	if existing == nil || len(existing.Auditors) == 0 {
+		return nil
+	}
+	if p.strip {
+		p.signatures.Stripped += len(existing.Auditors)
+		return nil
+	}
+
+	candidate := *m
+	candidate.HMAC = ""
+	candidate.GeneratedAt = existing.GeneratedAt
+	candidate.Fingerprint = existing.Fingerprint
+	data, err := candidate.DataWithoutAuditor()
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	var kept []manifest.AuditorData
+	for _, auditor := range existing.Auditors {
+		if signatureMatches(&auditor, data) {
+			kept = append(kept, auditor)
+		} else {
+			p.logger.Debug("signature invalidated", "dir", dirPath, "auditor", auditor.Certificate.IssuerRef)
+		}
+	}
+	p.signatures.Preserved += len(kept)
+	p.signatures.Invalidated += len(existing.Auditors) - len(kept)
+	if len(kept) > 0 {
+		*m = candidate
+		m.Auditors = kept
+	}
+	return nil
+}
+
+// loadExisting returns the existing manifest of dirPath through load, or from manifestPath when load is nil
+func loadExisting(load func(dirPath string) (*manifest.Manifest, error), dirPath, manifestPath string) (*manifest.Manifest, error) {
+	if load != nil {
+		return load(dirPath)
+	}
+	return manifest.LoadManifest(manifestPath)
+}
+
+// signatureMatches reports whether the auditor's certificate and its signature over data are valid
+func signatureMatches(auditor *manifest.AuditorData, data []byte) bool {
+	cert, err := auditor.DecodeCertificate()
+	if err != nil {
+		return false
+	}
+	if valid, err := signing.VerifyCertificate(cert); err != nil || !valid {
+		return false
+	}
+	signature, err := auditor.DecodeManifestSignature()
+	if err != nil {
+		return false
+	}
+	valid, err := signing.VerifySignature(auditor.Algorithm, cert.PublicKey(), data, signature)
+	return err == nil && valid
+}
+
+// RootOnlyProcessor passes the manifest of the root directory to one processor and all others to another,
+// see WithSignRootOnly
+type RootOnlyProcessor struct {
+	rootPath string
+	root     ManifestProcessor
+	others   ManifestProcessor
+}
+
+// NewRootOnlyProcessor creates a processor handing the manifest of rootPath to root and the others to others
+func NewRootOnlyProcessor(rootPath string, root, others ManifestProcessor) *RootOnlyProcessor {
+	return &RootOnlyProcessor{rootPath: filepath.Clean(rootPath), root: root, others: others}
+}
+
+// Process implements ManifestProcessor
+func (p *RootOnlyProcessor) Process(dirPath string, m *manifest.Manifest, manifestName string) error {
+	if filepath.Clean(dirPath) == p.rootPath {
+		return p.root.Process(dirPath, m, manifestName)
+	}
+	return p.others.Process(dirPath, m, manifestName)
+}
+
+// DryRunOutcome is what a generate run would do with the manifest of a directory
+type DryRunOutcome string
+
+const (
+	// DryRunNew means the directory has no manifest yet
+	DryRunNew DryRunOutcome = "new"
+	// DryRunUpdated means the existing manifest lists different entries, records a different config or labels,
+	// or cannot be read
+	DryRunUpdated DryRunOutcome = "updated"
+	// DryRunUnchanged means the existing manifest lists the same entries
+	DryRunUnchanged DryRunOutcome = "unchanged"
+)
+
+// DryRunDirectory describes the manifest a generate run would write into a directory
+type DryRunDirectory struct {
+	Path    string
+	Outcome DryRunOutcome
+	// Differences holds the changes against the existing manifest for DryRunUpdated
+	Differences []manifest.EntityDifference
+}
+
+// DryRunProcessor writes no manifest. It compares every manifest with the one stored in its directory,
+// records the outcome, and hands the manifest to a writer that keeps it in memory, see WithDryRun.
+type DryRunProcessor struct {
+	writer ManifestWriter
+	join   func(elem ...string) string
+	logger *slog.Logger
+	// load returns the existing manifest of a directory, nil if there is none. When unset, the manifest
+	// named as passed to Process is read from the file system.
+	load        func(dirPath string) (*manifest.Manifest, error)
+	directories *[]DryRunDirectory
+}
+
+// NewDryRunProcessor creates a processor recording its outcomes in directories and passing manifests to writer
+func NewDryRunProcessor(writer ManifestWriter, directories *[]DryRunDirectory) *DryRunProcessor {
+	return &DryRunProcessor{
+		writer:      writer,
+		join:        filepath.Join,
+		logger:      logging.Logger(),
+		directories: directories,
+	}
+}
+
+// Process implements ManifestProcessor for dry runs
+func (p *DryRunProcessor) Process(dirPath string, m *manifest.Manifest, manifestName string) error {
+	manifestPath := p.join(dirPath, manifestName)
+	directory := DryRunDirectory{Path: dirPath, Outcome: DryRunUpdated}
+	existing, err := loadExisting(p.load, dirPath, manifestPath)
+	switch {
+	case err != nil:
+		p.logger.Debug("existing manifest unreadable", "dir", dirPath, "error", err)
+	case existing == nil:
+		directory.Outcome = DryRunNew
+	default:
+		identical, differences, err := manifest.CompareManifests(existing, m)
+		if err != nil {
+			return fmt.Errorf("failed to compare manifests for %s: %w", manifestPath, err)
+		}
+		// A changed config or labels are recorded even when the entries are the same
+		if identical && manifest.SecureEqualHex(existing.ConfigDigest, m.ConfigDigest) && maps.Equal(existing.Labels, m.Labels) &&
+			slices.Equal(existing.Mountpoints, m.Mountpoints) {
+			directory.Outcome = DryRunUnchanged
+		}
+		directory.Differences = differences
+	}
+	*p.directories = append(*p.directories, directory)
+	return p.writer.WriteManifest(manifestPath, m)
 }
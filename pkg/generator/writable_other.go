@@ -0,0 +1,9 @@
+//go:build !unix
+
+package generator
+
+// checkWriteAccess cannot tell without writing on this platform, a directory that is not writable
+// fails when its manifest is saved
+func checkWriteAccess(rootPath string) error {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package generator
+
+import "golang.org/x/sys/unix"
+
+// checkWriteAccess asks the kernel whether rootPath is writable, without writing to it, so that runs leave no
+// trace behind in the tree, e.g. for watchers. Read-only filesystems fail with EROFS.
+func checkWriteAccess(rootPath string) error {
+	return unix.Access(rootPath, unix.W_OK)
+}
@@ -0,0 +1,204 @@
+package issuer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RuleOutcome is what an AuditorPolicy rule decides for the references it matches
+type RuleOutcome string
+
+const (
+	// RuleRequire accepts matching auditors and requires at least one of them to be trusted
+	RuleRequire RuleOutcome = "require"
+	// RuleAllow accepts matching auditors
+	RuleAllow RuleOutcome = "allow"
+	// RuleWarn accepts matching auditors but reports them
+	RuleWarn RuleOutcome = "warn"
+	// RuleDeny rejects matching auditors, their signatures fail the verification
+	RuleDeny RuleOutcome = "deny"
+)
+
+// PolicyRule assigns an outcome to the references matching a glob pattern,
+// in which '*' matches any sequence of characters, '/' included, and '?' any single character
+type PolicyRule struct {
+	Match   string      `json:"match"`
+	Outcome RuleOutcome `json:"outcome"`
+	pattern *regexp.Regexp
+}
+
+// Matches reports whether reference matches the pattern of the rule
+func (r *PolicyRule) Matches(reference Reference) bool {
+	return r.pattern.MatchString(string(reference))
+}
+
+// AuditorPolicy holds ordered rules deciding which auditors are acceptable, on top of the verification of
+// their keys against trusted sources. The first rule matching a reference decides, references matched by
+// no rule are accepted.
+type AuditorPolicy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyDecision is the decision of an AuditorPolicy about one auditor
+type PolicyDecision struct {
+	// Rule is the 1-based number of the deciding rule, 0 if no rule matched
+	Rule    int
+	Outcome RuleOutcome
+}
+
+// Denied reports whether the auditor is rejected
+func (d PolicyDecision) Denied() bool {
+	return d.Outcome == RuleDeny
+}
+
+// UnmetRequirement is a require rule that no trusted auditor satisfies
+type UnmetRequirement struct {
+	// Rule is the 1-based number of the rule
+	Rule  int
+	Match string
+}
+
+// PolicyResult holds the decisions of an AuditorPolicy about the auditors of a verification
+type PolicyResult struct {
+	Decisions map[Reference]PolicyDecision
+	Unmet     []UnmetRequirement
+}
+
+// Failed reports whether an auditor is denied or a requirement is not met
+func (r *PolicyResult) Failed() bool {
+	if r == nil {
+		return false
+	}
+	if len(r.Unmet) > 0 {
+		return true
+	}
+	for _, decision := range r.Decisions {
+		if decision.Denied() {
+			return true
+		}
+	}
+	return false
+}
+
+// Violations counts the denied auditors and unmet requirements
+func (r *PolicyResult) Violations() int {
+	if r == nil {
+		return 0
+	}
+	violations := len(r.Unmet)
+	for _, decision := range r.Decisions {
+		if decision.Denied() {
+			violations++
+		}
+	}
+	return violations
+}
+
+// LoadAuditorPolicy reads an auditor policy from a JSON file, see ParseAuditorPolicy
+func LoadAuditorPolicy(path string) (*AuditorPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auditor policy: %w", err)
+	}
+	policy, err := ParseAuditorPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auditor policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ParseAuditorPolicy parses a JSON document of the form
+//
+//	{"rules": [{"match": "github:my-org/*", "outcome": "allow"}, {"match": "*", "outcome": "deny"}]}
+//
+// Errors about a rule name it by its 1-based number.
+func ParseAuditorPolicy(data []byte) (*AuditorPolicy, error) {
+	var document struct {
+		Rules []json.RawMessage `json:"rules"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	if len(document.Rules) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+	policy := &AuditorPolicy{}
+	for i, raw := range document.Rules {
+		rule, err := parseRule(raw)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+func parseRule(raw json.RawMessage) (PolicyRule, error) {
+	var rule PolicyRule
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		return PolicyRule{}, err
+	}
+	if rule.Match == "" {
+		return PolicyRule{}, fmt.Errorf("missing match pattern")
+	}
+	switch rule.Outcome {
+	case RuleRequire, RuleAllow, RuleWarn, RuleDeny:
+	default:
+		return PolicyRule{}, fmt.Errorf("invalid outcome '%s', expected '%s', '%s', '%s' or '%s'",
+			rule.Outcome, RuleRequire, RuleAllow, RuleWarn, RuleDeny)
+	}
+	rule.pattern = globPattern(rule.Match)
+	return rule, nil
+}
+
+// globPattern converts a rule pattern into an anchored regular expression
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Evaluate decides about every auditor of statuses. A require rule is met when a matching
+// auditor is trusted, see Status.Category.
+func (p *AuditorPolicy) Evaluate(statuses map[Reference]Status) *PolicyResult {
+	result := &PolicyResult{Decisions: make(map[Reference]PolicyDecision, len(statuses))}
+	met := make(map[int]bool)
+	for reference, status := range statuses {
+		decision := PolicyDecision{Outcome: RuleAllow}
+		for i := range p.Rules {
+			if p.Rules[i].Matches(reference) {
+				decision = PolicyDecision{Rule: i + 1, Outcome: p.Rules[i].Outcome}
+				break
+			}
+		}
+		result.Decisions[reference] = decision
+		if decision.Outcome == RuleRequire && status.Category() == CategoryTrusted {
+			met[decision.Rule] = true
+		}
+	}
+	for i, rule := range p.Rules {
+		if rule.Outcome == RuleRequire && !met[i+1] {
+			result.Unmet = append(result.Unmet, UnmetRequirement{Rule: i + 1, Match: rule.Match})
+		}
+	}
+	return result
+}
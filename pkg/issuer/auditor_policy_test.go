@@ -0,0 +1,126 @@
+package issuer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuditorPolicy_InvalidRules_mustNameTheRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"not json", `rules:`, "failed to parse"},
+		{"unknown top-level field", `{"rules":[{"match":"*","outcome":"allow"}],"default":"deny"}`, "failed to parse"},
+		{"no rules", `{"rules":[]}`, "no rules"},
+		{"missing match", `{"rules":[{"match":"*","outcome":"allow"},{"outcome":"deny"}]}`,
+			"rule 2: missing match pattern"},
+		{"invalid outcome", `{"rules":[{"match":"*","outcome":"block"}]}`,
+			"rule 1: invalid outcome 'block', expected 'require', 'allow', 'warn' or 'deny'"},
+		{"unknown rule field", `{"rules":[{"match":"*","outcome":"allow"},{"match":"*","outcome":"deny"},{"match":"x","outcome":"warn","why":"?"}]}`,
+			"rule 3: json: unknown field \"why\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAuditorPolicy([]byte(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestLoadAuditorPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"match":"github:*","outcome":"allow"}]}`), 0644))
+	policy, err := LoadAuditorPolicy(path)
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 1)
+	assert.Equal(t, RuleAllow, policy.Rules[0].Outcome)
+
+	_, err = LoadAuditorPolicy(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "failed to read auditor policy")
+}
+
+func TestPolicyRule_Matches_Glob(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		reference Reference
+		want      bool
+	}{
+		{"github:my-org/*", "github:my-org/alice", true},
+		{"github:my-org/*", "github:my-org/team/alice", true},
+		{"github:my-org/*", "github:my-org-evil/alice", false},
+		{"github:*", "custom:github:x", false},
+		{"custom:bo?", "custom:bob", true},
+		{"custom:bo?", "custom:bobby", false},
+		{"email:*@example.com", "email:alice@example.com", true},
+		{"email:*@example.com", "email:alice@example.com.evil", false},
+		{"custom:a.b", "custom:axb", false},
+		{"*", "anything:at-all", true},
+	}
+	for _, tt := range tests {
+		policy, err := ParseAuditorPolicy([]byte(`{"rules":[{"match":"` + tt.pattern + `","outcome":"allow"}]}`))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, policy.Rules[0].Matches(tt.reference), "%s ~ %s", tt.pattern, tt.reference)
+	}
+}
+
+func TestAuditorPolicy_Evaluate_FirstMatchingRuleDecides(t *testing.T) {
+	policy, err := ParseAuditorPolicy([]byte(`{"rules":[
+		{"match":"github:my-org/intern","outcome":"warn"},
+		{"match":"github:my-org/*","outcome":"require"},
+		{"match":"github:*","outcome":"deny"},
+		{"match":"github:my-org/bob","outcome":"deny"}
+	]}`))
+	require.NoError(t, err)
+
+	result := policy.Evaluate(map[Reference]Status{
+		"github:my-org/intern": {Supported: true},
+		"github:my-org/bob":    {Supported: true},
+		"github:stranger":      {Supported: true},
+		"custom:alice":         {Supported: true},
+	})
+	assert.Equal(t, map[Reference]PolicyDecision{
+		"github:my-org/intern": {Rule: 1, Outcome: RuleWarn},
+		"github:my-org/bob":    {Rule: 2, Outcome: RuleRequire},
+		"github:stranger":      {Rule: 3, Outcome: RuleDeny},
+		"custom:alice":         {Rule: 0, Outcome: RuleAllow},
+	}, result.Decisions)
+	assert.Empty(t, result.Unmet)
+	assert.True(t, result.Failed())
+	assert.Equal(t, 1, result.Violations())
+}
+
+func TestAuditorPolicy_Evaluate_RequireNeedsTrustedAuditor(t *testing.T) {
+	policy, err := ParseAuditorPolicy([]byte(`{"rules":[
+		{"match":"github:my-org/*","outcome":"require"},
+		{"match":"custom:*","outcome":"require"}
+	]}`))
+	require.NoError(t, err)
+
+	result := policy.Evaluate(map[Reference]Status{
+		"github:my-org/alice": {Supported: true, Error: errors.New("not found in trusted source")},
+		"custom:bob":          {Supported: true},
+	})
+	assert.Equal(t, []UnmetRequirement{{Rule: 1, Match: "github:my-org/*"}}, result.Unmet)
+	assert.True(t, result.Failed())
+
+	result = policy.Evaluate(map[Reference]Status{
+		"github:my-org/alice": {Supported: true},
+		"custom:bob":          {Supported: true},
+	})
+	assert.Empty(t, result.Unmet)
+	assert.False(t, result.Failed())
+}
+
+func TestPolicyResult_Nil_IsNotFailed(t *testing.T) {
+	var result *PolicyResult
+	assert.False(t, result.Failed())
+	assert.Zero(t, result.Violations())
+}
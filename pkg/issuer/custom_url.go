@@ -1,7 +1,10 @@
 package issuer
 
 import (
+	"context"
 	"os"
+
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
 )
 
 var CustomScheme = "custom:"
@@ -39,3 +42,38 @@ func (v *CustomURLVerifier) Supports(reference Reference) bool {
 func (v *CustomURLVerifier) Verify(issuers []Issuer) map[Reference]Status {
 	return v.URLBasedVerifier.Verify(issuers)
 }
+
+// VerifyContext delegates to the underlying URLBasedVerifier
+func (v *CustomURLVerifier) VerifyContext(ctx context.Context, issuers []Issuer) map[Reference]Status {
+	return v.URLBasedVerifier.VerifyContext(ctx, issuers)
+}
+
+// Clone implements Cloneable
+func (v *CustomURLVerifier) Clone() Verifier {
+	if v.URLBasedVerifier == nil {
+		return &CustomURLVerifier{nil}
+	}
+	clone := *v.URLBasedVerifier
+	return &CustomURLVerifier{URLBasedVerifier: &clone}
+}
+
+// SetRetryPolicy delegates to the underlying URLBasedVerifier if the URL template is set
+func (v *CustomURLVerifier) SetRetryPolicy(policy RetryPolicy) {
+	if v.URLBasedVerifier != nil {
+		v.URLBasedVerifier.SetRetryPolicy(policy)
+	}
+}
+
+// SetConcurrency delegates to the underlying URLBasedVerifier if the URL template is set
+func (v *CustomURLVerifier) SetConcurrency(n int) {
+	if v.URLBasedVerifier != nil {
+		v.URLBasedVerifier.SetConcurrency(n)
+	}
+}
+
+// SetTracer delegates to the underlying URLBasedVerifier if the URL template is set
+func (v *CustomURLVerifier) SetTracer(tracer telemetry.Tracer) {
+	if v.URLBasedVerifier != nil {
+		v.URLBasedVerifier.SetTracer(tracer)
+	}
+}
@@ -0,0 +1,13 @@
+package issuer
+
+// EmailScheme is the reference scheme of issuers identified by an email address, e.g. "email:alice@example.com"
+var EmailScheme = "email:"
+
+// NewEmailIssuerVerifier creates a verifier for the "email:" scheme fetching the authorized keys of
+// an address from urlTemplate (e.g., "https://keys.example.com/users/%s/authorized_keys").
+// Addresses are a single path element, a '/' in them is percent-encoded.
+func NewEmailIssuerVerifier(urlTemplate string) *URLBasedVerifier {
+	v := NewURLBasedVerifier(EmailScheme, urlTemplate)
+	v.escapeSlashes = true
+	return v
+}
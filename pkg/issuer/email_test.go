@@ -0,0 +1,81 @@
+package issuer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestEscapeIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"alice":             "alice",
+		"alice@example.com": "alice@example.com",
+		"team/alice":        "team%2Falice",
+		"a b+c&d=e?f#g":     "a%20b%2Bc%26d%3De%3Ff%23g",
+		"../etc/passwd":     "..%2Fetc%2Fpasswd",
+		"zoë":               "zo%C3%AB",
+	}
+	for identifier, expected := range tests {
+		assert.Equal(t, expected, escapeIdentifier(identifier, true), identifier)
+	}
+	// Other schemes keep the path elements of nested names, e.g. GitLab groups
+	assert.Equal(t, "group/sub%20group/alice", escapeIdentifier("group/sub group/alice", false))
+}
+
+func TestURLBasedVerifier_WithDotPathElement_mustRejectIdentifier(t *testing.T) {
+	v := NewURLBasedVerifier("custom:", "file://"+t.TempDir()+"/%s.pub")
+	for _, reference := range []Reference{"custom:..", "custom:team/../../etc/passwd", "custom:team/./alice"} {
+		_, err := v.fetchPublicKeys(context.Background(), reference)
+		assert.ErrorContains(t, err, "is not allowed", reference)
+	}
+}
+
+func TestEmailIssuerVerifier_Verify(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+
+	var requestedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.EscapedPath()
+		w.Write(ssh.MarshalAuthorizedKey(sshPub))
+	}))
+	defer server.Close()
+
+	verifier := NewEmailIssuerVerifier(server.URL + "/users/%s/authorized_keys")
+	verifier.client = server.Client()
+	ref := Reference("email:alice+signing@example.com")
+	results := verifier.Verify([]Issuer{{Reference: ref, PublicKey: publicKey}})
+
+	assert.True(t, results[ref].Supported)
+	assert.NoError(t, results[ref].Error)
+	assert.Equal(t, "/users/alice%2Bsigning@example.com/authorized_keys", requestedPath)
+	assert.False(t, verifier.Supports("github:alice"))
+}
+
+func TestEmailIssuerVerifier_WithFileURL_UsesEncodedFileName(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team%2Falice@example.com.pub"), ssh.MarshalAuthorizedKey(sshPub), 0644))
+
+	verifier := NewEmailIssuerVerifier("file://" + dir + "/%s.pub")
+	ref := Reference("email:team/alice@example.com")
+	results := verifier.Verify([]Issuer{{Reference: ref, PublicKey: publicKey}})
+	assert.NoError(t, results[ref].Error)
+
+	ref = Reference("email:..")
+	results = verifier.Verify([]Issuer{{Reference: ref, PublicKey: publicKey}})
+	assert.ErrorContains(t, results[ref].Error, "identifier '..' is not allowed")
+}
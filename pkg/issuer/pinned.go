@@ -0,0 +1,122 @@
+package issuer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrPinnedKeyMismatch is the error of issuers whose reference is pinned with another key, see PinnedVerifier.
+// Unlike other untrusted issuers, it fails verification.
+var ErrPinnedKeyMismatch = errors.New("key differs from the key pinned by the trust anchors")
+
+// TrustAnchors maps issuer references to the keys pinned for them, see LoadTrustAnchors
+type TrustAnchors map[Reference][]ed25519.PublicKey
+
+// LoadTrustAnchors reads a trust anchors file: one reference followed by an ed25519 SSH public key in
+// authorized_keys format per line, e.g. "github:alice ssh-ed25519 AAAA... alice@laptop". A reference may be
+// listed on several lines to pin several keys. Empty lines and lines starting with '#' are ignored.
+func LoadTrustAnchors(path string) (TrustAnchors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust anchors: %w", err)
+	}
+	anchors := make(TrustAnchors)
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; lines.Scan(); number++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		reference, keyText, _ := strings.Cut(line, " ")
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyText))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid public key of '%s': %w", path, number, reference, err)
+		}
+		cryptoKey, ok := key.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: unsupported public key of '%s'", path, number, reference)
+		}
+		edKey, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: public key of '%s' is not an ed25519 key", path, number, reference)
+		}
+		anchors[Reference(reference)] = append(anchors[Reference(reference)], edKey)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trust anchors: %w", err)
+	}
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("no trust anchors found in %s", path)
+	}
+	return anchors, nil
+}
+
+// PinnedVerifier trusts issuers whose key is pinned by trust anchors ahead of any other source: an issuer
+// whose reference is pinned with another key is rejected even if the next verifier would accept it.
+// Issuers whose reference is not pinned are verified by the next verifier.
+type PinnedVerifier struct {
+	anchors TrustAnchors
+	next    Verifier
+}
+
+// NewPinnedVerifier creates a verifier checking issuers against anchors before next
+func NewPinnedVerifier(anchors TrustAnchors, next Verifier) *PinnedVerifier {
+	return &PinnedVerifier{anchors: anchors, next: next}
+}
+
+// Supports returns true for pinned references and the references next supports
+func (v *PinnedVerifier) Supports(reference Reference) bool {
+	_, pinned := v.anchors[reference]
+	return pinned || v.next.Supports(reference)
+}
+
+// Verify checks the issuers of pinned references against their pinned keys and passes the others to next
+func (v *PinnedVerifier) Verify(issuers []Issuer) map[Reference]Status {
+	return v.VerifyContext(context.Background(), issuers)
+}
+
+// VerifyContext is Verify passing ctx to next, see ContextVerifier
+func (v *PinnedVerifier) VerifyContext(ctx context.Context, issuers []Issuer) map[Reference]Status {
+	var unpinned []Issuer
+	results := make(map[Reference]Status)
+	for _, issuer := range issuers {
+		keys, pinned := v.anchors[issuer.Reference]
+		if !pinned {
+			unpinned = append(unpinned, issuer)
+			continue
+		}
+		if previous, ok := results[issuer.Reference]; ok && previous.Error != nil {
+			continue // Keep the first failure of a reference
+		}
+		status := Status{Issuer: issuer, Supported: true, Pinned: true}
+		if !containsKey(keys, issuer.PublicKey) {
+			status.Pinned = false
+			status.Error = fmt.Errorf("public %w: issuer '%s' signed with %s",
+				ErrPinnedKeyMismatch, issuer.Reference, Fingerprint(issuer.PublicKey))
+		}
+		results[issuer.Reference] = status
+	}
+	if len(unpinned) > 0 {
+		for reference, status := range VerifyContext(ctx, v.next, unpinned) {
+			results[reference] = status
+		}
+	}
+	return results
+}
+
+func containsKey(keys []ed25519.PublicKey, key ed25519.PublicKey) bool {
+	for _, k := range keys {
+		if k.Equal(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package issuer
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// acceptingVerifier trusts every issuer of the references it supports, like a trust source publishing any key
+type acceptingVerifier struct {
+	verified []Issuer
+}
+
+func (v *acceptingVerifier) Supports(reference Reference) bool { return true }
+
+func (v *acceptingVerifier) Verify(issuers []Issuer) map[Reference]Status {
+	v.verified = append(v.verified, issuers...)
+	results := make(map[Reference]Status)
+	for _, issuer := range issuers {
+		results[issuer.Reference] = Status{Issuer: issuer, Supported: true}
+	}
+	return results
+}
+
+func newTestKey(t *testing.T) ed25519.PublicKey {
+	key, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return key
+}
+
+func authorizedKey(t *testing.T, key ed25519.PublicKey) string {
+	sshKey, err := ssh.NewPublicKey(key)
+	require.NoError(t, err)
+	return string(ssh.MarshalAuthorizedKey(sshKey))
+}
+
+func TestPinnedVerifier_Verify(t *testing.T) {
+	pinnedKey, otherKey := newTestKey(t), newTestKey(t)
+	anchors := TrustAnchors{"github:alice": {pinnedKey}}
+
+	tests := []struct {
+		name       string
+		issuer     Issuer
+		wantPinned bool
+		wantErr    string
+		wantNext   bool
+	}{
+		{"match", Issuer{Reference: "github:alice", PublicKey: pinnedKey}, true, "", false},
+		// The next verifier would accept the key, the pin overrides it
+		{"mismatch", Issuer{Reference: "github:alice", PublicKey: otherKey}, false, "differs from the key pinned", false},
+		{"fall through", Issuer{Reference: "github:bob", PublicKey: otherKey}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &acceptingVerifier{}
+			status := NewPinnedVerifier(anchors, next).Verify([]Issuer{tt.issuer})[tt.issuer.Reference]
+			assert.True(t, status.Supported)
+			assert.Equal(t, tt.wantPinned, status.Pinned)
+			if tt.wantErr == "" {
+				assert.NoError(t, status.Error)
+				assert.Equal(t, CategoryTrusted, status.Category())
+			} else {
+				assert.ErrorContains(t, status.Error, tt.wantErr)
+				assert.Equal(t, CategoryError, status.Category())
+			}
+			assert.Equal(t, tt.wantNext, len(next.verified) > 0)
+		})
+	}
+}
+
+func TestPinnedVerifier_mustKeepFirstFailureOfReference(t *testing.T) {
+	pinnedKey, otherKey := newTestKey(t), newTestKey(t)
+	results := NewPinnedVerifier(TrustAnchors{"github:alice": {pinnedKey}}, &acceptingVerifier{}).Verify([]Issuer{
+		{Reference: "github:alice", PublicKey: otherKey},
+		{Reference: "github:alice", PublicKey: pinnedKey},
+	})
+	assert.Error(t, results["github:alice"].Error)
+}
+
+func TestLoadTrustAnchors(t *testing.T) {
+	alice, aliceRotated, bob := newTestKey(t), newTestKey(t), newTestKey(t)
+	path := filepath.Join(t.TempDir(), "anchors.trust")
+	require.NoError(t, os.WriteFile(path, []byte("# delivered with the tree\n\n"+
+		"github:alice "+authorizedKey(t, alice)+
+		"github:alice "+authorizedKey(t, aliceRotated)+
+		"custom:bob "+authorizedKey(t, bob)), 0644))
+
+	anchors, err := LoadTrustAnchors(path)
+	require.NoError(t, err)
+	assert.Equal(t, TrustAnchors{"github:alice": {alice, aliceRotated}, "custom:bob": {bob}}, anchors)
+
+	require.NoError(t, os.WriteFile(path, []byte("github:alice not-a-key\n"), 0644))
+	_, err = LoadTrustAnchors(path)
+	assert.ErrorContains(t, err, ":1: invalid public key of 'github:alice'")
+
+	require.NoError(t, os.WriteFile(path, []byte("# nothing pinned\n"), 0644))
+	_, err = LoadTrustAnchors(path)
+	assert.ErrorContains(t, err, "no trust anchors found")
+}
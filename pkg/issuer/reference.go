@@ -0,0 +1,148 @@
+package issuer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// GitHubScheme is the reference scheme of issuers identified by a GitHub user name, e.g. "github:alice"
+var GitHubScheme = "github:"
+
+// ErrInvalidReference is wrapped by the errors of ParseReference for malformed references
+var ErrInvalidReference = errors.New("invalid reference")
+
+// ErrUnknownScheme is wrapped by the error of ParseReference for well-formed references whose scheme is not known.
+// Their scheme and identifier are returned along with it, so that callers may accept them anyway.
+var ErrUnknownScheme = errors.New("unknown issuer reference scheme")
+
+var (
+	schemeName   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+	gitHubUser   = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	emailAddress = regexp.MustCompile(`^[^@/]+@[^@/]+\.[^@/]+$`)
+)
+
+// KnownSchemes returns the schemes of the trust sources of bytecheck
+func KnownSchemes() []string {
+	return []string{GitHubScheme, CustomScheme, EmailScheme, SSHCAScheme}
+}
+
+// ParseReference splits reference into its scheme, lower-cased and with its colon, and its identifier, e.g.
+// "Github:alice" into "github:" and "alice". The scheme must be one of KnownSchemes or extraSchemes, otherwise
+// the error wraps ErrUnknownScheme. References that are empty, contain whitespace, lack a scheme or an identifier,
+// or are URLs are rejected with an error wrapping ErrInvalidReference, suggesting the reference likely meant,
+// e.g. "did you mean github:alice?" for "github.com/alice". The scheme is returned whenever reference has one,
+// even along an error.
+func ParseReference(reference string, extraSchemes ...string) (scheme, identifier string, err error) {
+	invalid := func(reason string, suggested string) error {
+		if suggested != "" {
+			reason += fmt.Sprintf(", did you mean %s?", suggested)
+		}
+		return fmt.Errorf("%w '%s': %s", ErrInvalidReference, reference, reason)
+	}
+	if reference == "" {
+		return "", "", fmt.Errorf("%w: empty reference", ErrInvalidReference)
+	}
+	if strings.IndexFunc(reference, unicode.IsSpace) >= 0 {
+		trimmed := strings.TrimSpace(reference)
+		if strings.IndexFunc(trimmed, unicode.IsSpace) >= 0 {
+			trimmed = ""
+		}
+		return "", "", invalid("contains whitespace", trimmed)
+	}
+	name, identifier, found := strings.Cut(reference, ":")
+	if strings.Contains(reference, "://") || !found && looksLikeURL(reference) {
+		return "", "", invalid("a URL is not a reference, expected scheme:identifier", suggestForURL(reference))
+	}
+	if !found {
+		return "", "", invalid("missing scheme, expected scheme:identifier", suggestScheme(reference))
+	}
+	if !schemeName.MatchString(name) {
+		return "", "", invalid(fmt.Sprintf("invalid scheme '%s:'", name), "")
+	}
+	scheme = strings.ToLower(name) + ":"
+	if identifier == "" {
+		return scheme, "", invalid(fmt.Sprintf("missing identifier after '%s'", scheme), "")
+	}
+	known := append(KnownSchemes(), extraSchemes...)
+	if !slices.Contains(known, scheme) {
+		err = fmt.Errorf("%w '%s' in '%s', known schemes are %s", ErrUnknownScheme, scheme, reference,
+			strings.Join(known, ", "))
+		if closest := closestScheme(scheme, known); closest != "" {
+			err = fmt.Errorf("%w, did you mean %s%s?", err, closest, identifier)
+		}
+		return scheme, identifier, err
+	}
+	return scheme, identifier, nil
+}
+
+// looksLikeURL reports whether reference, which has no scheme, starts with a host name, e.g. "github.com/alice"
+func looksLikeURL(reference string) bool {
+	host, _, found := strings.Cut(reference, "/")
+	return found && strings.Contains(host, ".")
+}
+
+// suggestForURL returns the reference of the GitHub user whose page or keys reference is the URL of,
+// empty for other URLs
+func suggestForURL(reference string) string {
+	if !strings.Contains(reference, "://") {
+		reference = "https://" + reference
+	}
+	u, err := url.Parse(reference)
+	if err != nil || strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") != "github.com" {
+		return ""
+	}
+	user, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	user = strings.TrimSuffix(user, ".keys")
+	if !gitHubUser.MatchString(user) {
+		return ""
+	}
+	return GitHubScheme + user
+}
+
+// suggestScheme returns reference with the scheme it likely lacks: email: for email addresses, github: for
+// names that are valid GitHub user names
+func suggestScheme(reference string) string {
+	switch {
+	case emailAddress.MatchString(reference):
+		return EmailScheme + reference
+	case gitHubUser.MatchString(reference):
+		return GitHubScheme + reference
+	}
+	return ""
+}
+
+// closestScheme returns the scheme of known one edit away from scheme, e.g. "github:" for "gihub:", if any
+func closestScheme(scheme string, known []string) string {
+	for _, candidate := range known {
+		if editDistance(scheme, candidate) == 1 {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
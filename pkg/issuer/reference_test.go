@@ -0,0 +1,76 @@
+package issuer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name           string
+		reference      string
+		wantScheme     string
+		wantIdentifier string
+		wantErr        error
+		wantMessage    string
+	}{
+		{"github", "github:alice", "github:", "alice", nil, ""},
+		{"custom with slash", "custom:team/alice", "custom:", "team/alice", nil, ""},
+		{"email", "email:alice@example.com", "email:", "alice@example.com", nil, ""},
+		{"sshca", "sshca:alice", "sshca:", "alice", nil, ""},
+		{"scheme case is normalized", "Github:Alice", "github:", "Alice", nil, ""},
+		{"empty", "", "", "", ErrInvalidReference, "empty reference"},
+		{"bare name", "alice", "", "", ErrInvalidReference, "missing scheme, expected scheme:identifier, did you mean github:alice?"},
+		{"bare email", "alice@example.com", "", "", ErrInvalidReference, "did you mean email:alice@example.com?"},
+		{"host and user", "github.com/alice", "", "", ErrInvalidReference, "a URL is not a reference, expected scheme:identifier, did you mean github:alice?"},
+		{"keys URL", "https://github.com/alice.keys", "", "", ErrInvalidReference, "did you mean github:alice?"},
+		{"www URL", "https://www.github.com/alice/", "", "", ErrInvalidReference, "did you mean github:alice?"},
+		{"other URL", "https://keys.example.com/alice", "", "", ErrInvalidReference, "a URL is not a reference, expected scheme:identifier"},
+		{"surrounding whitespace", " github:alice\n", "", "", ErrInvalidReference, "contains whitespace, did you mean github:alice?"},
+		{"inner whitespace", "github:alice smith", "", "", ErrInvalidReference, "contains whitespace"},
+		{"missing identifier", "github:", "github:", "", ErrInvalidReference, "missing identifier after 'github:'"},
+		{"invalid scheme", "1x:alice", "", "", ErrInvalidReference, "invalid scheme '1x:'"},
+		{"unknown scheme", "gitlab:alice", "gitlab:", "alice", ErrUnknownScheme,
+			"unknown issuer reference scheme 'gitlab:' in 'gitlab:alice', known schemes are github:, custom:, email:, sshca:"},
+		{"misspelled scheme", "gihub:alice", "gihub:", "alice", ErrUnknownScheme, "did you mean github:alice?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme, identifier, err := ParseReference(tt.reference)
+			assert.Equal(t, tt.wantScheme, scheme)
+			assert.Equal(t, tt.wantIdentifier, identifier)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.ErrorContains(t, err, tt.wantMessage)
+		})
+	}
+}
+
+func TestParseReference_ExtraSchemes(t *testing.T) {
+	scheme, identifier, err := ParseReference("Corp:alice", "corp:")
+	assert.NoError(t, err)
+	assert.Equal(t, "corp:", scheme)
+	assert.Equal(t, "alice", identifier)
+}
+
+func TestURLBasedVerifier_Supports_MatchesSchemeExactly(t *testing.T) {
+	verifier := NewGitHubIssuerVerifier()
+	assert.True(t, verifier.Supports("github:alice"))
+	assert.False(t, verifier.Supports("GitHub:alice"))
+	assert.False(t, verifier.Supports("github.com/alice"))
+}
+
+func TestURLBasedVerifier_Verify_ReportsReferenceError(t *testing.T) {
+	verifier := NewGitHubIssuerVerifier()
+	results := verifier.Verify([]Issuer{{Reference: "github: alice"}})
+	status := results["github: alice"]
+	require.True(t, status.Supported)
+	require.Error(t, status.Error)
+	assert.ErrorIs(t, status.Error, ErrInvalidReference)
+	assert.Contains(t, status.Error.Error(), "contains whitespace")
+}
@@ -0,0 +1,102 @@
+package issuer
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how often fetching keys from a trusted source is attempted when it fails temporarily
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, values below 1 mean a single attempt
+	Attempts int
+	// InitialBackoff is the delay before the second attempt, it doubles with every further attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts, including delays requested with Retry-After
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy makes 3 attempts, waiting between 0.25s and 0.5s, then between 0.5s and 1s
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// RetryConfigurable is implemented by verifiers fetching keys from remote trusted sources
+type RetryConfigurable interface {
+	SetRetryPolicy(policy RetryPolicy)
+}
+
+// TransientError reports a failure of a trusted source which may succeed later, like a 5xx response or a timeout.
+// Issuers failing with it are temporarily unverifiable rather than untrusted.
+type TransientError struct {
+	Err error
+	// RetryAfter is the delay requested by the source, 0 if none
+	RetryAfter time.Duration
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// IsTransient reports whether err is caused by a temporary failure of a trusted source, see TransientError
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// retry calls fetch until it succeeds, fails permanently, the attempts of the policy are used up or ctx is done
+func retry[T any](ctx context.Context, policy RetryPolicy, sleep func(context.Context, time.Duration) error,
+	fetch func() (T, error)) (T, error) {
+	attempts := max(policy.Attempts, 1)
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := fetch()
+		var transient *TransientError
+		if err == nil || attempt >= attempts || !errors.As(err, &transient) {
+			return result, err
+		}
+		delay := transient.RetryAfter
+		if delay == 0 {
+			// A random delay between half and all of the backoff spreads out retries of concurrent runs
+			delay = backoff/2 + rand.N(backoff/2+1)
+			backoff *= 2
+		}
+		if policy.MaxBackoff > 0 {
+			delay = min(delay, policy.MaxBackoff)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return result, err
+		}
+	}
+}
+
+// sleepContext waits for d, it returns the error of ctx when ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isTransientStatus reports whether an HTTP status code signals a temporary failure
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// parseRetryAfter returns the delay of a Retry-After header given in seconds or as an HTTP date, 0 if absent or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
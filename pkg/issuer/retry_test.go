@@ -0,0 +1,133 @@
+package issuer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newFlakyServer serves publicKey after answering the first failures requests with status
+func newFlakyServer(t *testing.T, publicKey ed25519.PublicKey, failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(ssh.MarshalAuthorizedKey(sshKey))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestURLBasedVerifier_Verify_RetriesTransientFailures(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server, requests := newFlakyServer(t, publicKey, 2, http.StatusBadGateway, nil)
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.SetRetryPolicy(RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+
+	results := verifier.Verify([]Issuer{{Reference: "test:issuer", PublicKey: publicKey}})
+
+	require.Len(t, results, 1)
+	status := results["test:issuer"]
+	assert.True(t, status.Supported)
+	assert.NoError(t, status.Error)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestURLBasedVerifier_Verify_AttemptsExhausted_IsTransient(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server, requests := newFlakyServer(t, publicKey, 5, http.StatusServiceUnavailable, nil)
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.SetRetryPolicy(RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond})
+
+	status := verifier.Verify([]Issuer{{Reference: "test:issuer", PublicKey: publicKey}})["test:issuer"]
+
+	require.Error(t, status.Error)
+	assert.True(t, IsTransient(status.Error))
+	assert.Contains(t, status.Error.Error(), "503")
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestURLBasedVerifier_Verify_NotFound_IsNotRetried(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server, requests := newFlakyServer(t, publicKey, 1, http.StatusNotFound, nil)
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.SetRetryPolicy(RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond})
+
+	status := verifier.Verify([]Issuer{{Reference: "test:issuer", PublicKey: publicKey}})["test:issuer"]
+
+	require.Error(t, status.Error)
+	assert.False(t, IsTransient(status.Error))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestURLBasedVerifier_Verify_TooManyRequests_HonorsRetryAfter(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	server, requests := newFlakyServer(t, publicKey, 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"7"}})
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.SetRetryPolicy(RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Minute})
+	var delays []time.Duration
+	verifier.sleep = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	status := verifier.Verify([]Issuer{{Reference: "test:issuer", PublicKey: publicKey}})["test:issuer"]
+
+	assert.NoError(t, status.Error)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, []time.Duration{7 * time.Second}, delays)
+}
+
+func TestRetry_BackoffGrowsWithJitterAndIsCapped(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	var delays []time.Duration
+	calls := 0
+	_, err := retry(context.Background(), policy, func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}, func() (int, error) {
+		calls++
+		return 0, &TransientError{Err: assert.AnError}
+	})
+
+	require.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 5, calls)
+	require.Len(t, delays, 4)
+	for i, limit := range []time.Duration{100, 200, 300, 300} {
+		assert.LessOrEqual(t, delays[i], limit*time.Millisecond)
+		assert.GreaterOrEqual(t, delays[i], min(limit*time.Millisecond, 50*time.Millisecond<<i))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+}
@@ -0,0 +1,160 @@
+package issuer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHCAScheme is the reference scheme of issuers holding an SSH user certificate for the principal
+// following it, e.g. "sshca:alice"
+var SSHCAScheme = "sshca:"
+
+// SSHCAVerifier trusts issuers whose key is certified by an SSH certificate authority.
+// The certificate is recorded in the manifests when signing, see Issuer.Certificate.
+type SSHCAVerifier struct {
+	authorities []ssh.PublicKey
+	now         func() time.Time
+}
+
+// NewSSHCAVerifier creates a verifier for the "sshca:" scheme accepting certificates signed by any of the authorities
+func NewSSHCAVerifier(authorities ...ssh.PublicKey) *SSHCAVerifier {
+	return &SSHCAVerifier{authorities: authorities, now: time.Now}
+}
+
+// NewSSHCAVerifierFromFile creates an SSHCAVerifier trusting the CA public keys listed in path,
+// one per line in authorized_keys format
+func NewSSHCAVerifierFromFile(path string) (*SSHCAVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate authority keys: %w", err)
+	}
+	var authorities []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		var key ssh.PublicKey
+		key, _, _, data, err = ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate authority keys in %s: %w", path, err)
+		}
+		authorities = append(authorities, key)
+	}
+	if len(authorities) == 0 {
+		return nil, fmt.Errorf("no certificate authority keys found in %s", path)
+	}
+	return NewSSHCAVerifier(authorities...), nil
+}
+
+// Supports returns true for references that use the "sshca:" scheme. The scheme is matched exactly,
+// as trust anchors and policies are, so that "SSHCA:alice" is not verified as "sshca:alice"
+func (v *SSHCAVerifier) Supports(reference Reference) bool {
+	return strings.HasPrefix(string(reference), SSHCAScheme)
+}
+
+// Verify checks that every issuer carries a valid SSH user certificate for its key,
+// signed by a trusted authority and issued for the principal named in its reference
+func (v *SSHCAVerifier) Verify(issuers []Issuer) map[Reference]Status {
+	results := make(map[Reference]Status)
+	for _, issuer := range issuers {
+		if !v.Supports(issuer.Reference) {
+			results[issuer.Reference] = Status{Issuer: issuer, Supported: false}
+			continue
+		}
+		if previous, ok := results[issuer.Reference]; ok && previous.Error != nil {
+			continue // Keep the first failure of a reference
+		}
+		results[issuer.Reference] = Status{Issuer: issuer, Supported: true, Error: v.verifyIssuer(issuer)}
+	}
+	return results
+}
+
+// verifyIssuer validates the certificate of a single issuer
+func (v *SSHCAVerifier) verifyIssuer(issuer Issuer) error {
+	_, principal, err := ParseReference(string(issuer.Reference))
+	if err != nil {
+		return err
+	}
+	if len(issuer.Certificate) == 0 {
+		return fmt.Errorf("no SSH certificate recorded for issuer '%s'", issuer.Reference)
+	}
+	cert, certifiedKey, err := parseUserCertificate(issuer.Certificate)
+	if err != nil {
+		return err
+	}
+	if !v.isAuthority(cert.SignatureKey) {
+		return fmt.Errorf("SSH certificate of issuer '%s' is not signed by a trusted certificate authority", issuer.Reference)
+	}
+	if !certifiedKey.Equal(issuer.PublicKey) {
+		return fmt.Errorf("SSH certificate of issuer '%s' does not certify its public key", issuer.Reference)
+	}
+	// CheckCert validates the principal, the validity window and the CA signature. The certificate must have
+	// been valid when the manifests were signed, so that they stay trusted once it expires; issuers without
+	// signing times are checked against the current time.
+	signed := []time.Time{issuer.FirstSigned, issuer.LastSigned}
+	if issuer.FirstSigned.IsZero() || issuer.LastSigned.IsZero() {
+		signed = []time.Time{v.now()}
+	}
+	for _, at := range signed {
+		checker := ssh.CertChecker{Clock: func() time.Time { return at }}
+		if err := checker.CheckCert(principal, cert); err != nil {
+			return fmt.Errorf("SSH certificate of issuer '%s' rejected: %w", issuer.Reference, err)
+		}
+	}
+	return nil
+}
+
+// LoadSSHCertificate reads an SSH user certificate of an ed25519 key in authorized_keys format,
+// like ~/.ssh/id_ed25519-cert.pub, and returns it in wire format with the certified key
+func LoadSSHCertificate(path string) ([]byte, ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read SSH certificate: %w", err)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse SSH certificate %s: %w", path, err)
+	}
+	_, certifiedKey, err := parseUserCertificate(key.Marshal())
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Marshal(), certifiedKey, nil
+}
+
+// parseUserCertificate parses an SSH user certificate in wire format and returns the ed25519 key it certifies
+func parseUserCertificate(data []byte) (*ssh.Certificate, ed25519.PublicKey, error) {
+	key, err := ssh.ParsePublicKey(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SSH certificate: %w", err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid SSH certificate: got a plain %s key", key.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, nil, fmt.Errorf("invalid SSH certificate: not a user certificate")
+	}
+	certKey, ok := cert.Key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid SSH certificate: unsupported key type %s", cert.Key.Type())
+	}
+	edKey, ok := certKey.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid SSH certificate: certified key is %s, expected ed25519", cert.Key.Type())
+	}
+	return cert, edKey, nil
+}
+
+// isAuthority reports whether key is one of the trusted certificate authorities
+func (v *SSHCAVerifier) isAuthority(key ssh.PublicKey) bool {
+	for _, authority := range v.authorities {
+		if bytes.Equal(authority.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package issuer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestCA generates a certificate authority key pair
+func newTestCA(t *testing.T) ssh.Signer {
+	_, caKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+	return signer
+}
+
+// newTestCertificate issues a user certificate for key, modify adjusts it before signing
+func newTestCertificate(t *testing.T, ca ssh.Signer, key ed25519.PublicKey, modify func(cert *ssh.Certificate)) []byte {
+	sshKey, err := ssh.NewPublicKey(key)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{
+		Key:             sshKey,
+		CertType:        ssh.UserCert,
+		KeyId:           "alice",
+		ValidPrincipals: []string{"alice"},
+		ValidAfter:      uint64(time.Now().Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(time.Now().Add(time.Hour).Unix()),
+	}
+	if modify != nil {
+		modify(cert)
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	return cert.Marshal()
+}
+
+func TestSSHCAVerifier_Verify(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		ref     Reference
+		cert    []byte
+		wantErr string
+	}{
+		{"valid", "sshca:alice", newTestCertificate(t, ca, publicKey, nil), ""},
+		{"no certificate", "sshca:alice", nil, "no SSH certificate recorded"},
+		{"wrong principal", "sshca:bob", newTestCertificate(t, ca, publicKey, nil), "not in the set of valid principals"},
+		{"expired", "sshca:alice", newTestCertificate(t, ca, publicKey, func(cert *ssh.Certificate) {
+			cert.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+		}), "cert has expired"},
+		{"untrusted authority", "sshca:alice", newTestCertificate(t, otherCA, publicKey, nil), "not signed by a trusted certificate authority"},
+		{"other key", "sshca:alice", newTestCertificate(t, ca, otherKey, nil), "does not certify its public key"},
+		{"host certificate", "sshca:alice", newTestCertificate(t, ca, publicKey, func(cert *ssh.Certificate) {
+			cert.CertType = ssh.HostCert
+		}), "not a user certificate"},
+		{"missing principal", "sshca:", newTestCertificate(t, ca, publicKey, nil), "missing identifier after 'sshca:'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewSSHCAVerifier(ca.PublicKey())
+			results := verifier.Verify([]Issuer{{Reference: tt.ref, PublicKey: publicKey, Certificate: tt.cert}})
+			status := results[tt.ref]
+			assert.True(t, status.Supported)
+			if tt.wantErr == "" {
+				assert.NoError(t, status.Error)
+			} else {
+				assert.ErrorContains(t, status.Error, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSSHCAVerifier_WithSigningTimes_mustCheckValidityWhenSigned(t *testing.T) {
+	ca := newTestCA(t)
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signedAt := time.Now().Add(-48 * time.Hour)
+	cert := newTestCertificate(t, ca, publicKey, func(cert *ssh.Certificate) {
+		cert.ValidAfter = uint64(signedAt.Add(-time.Hour).Unix())
+		cert.ValidBefore = uint64(signedAt.Add(time.Hour).Unix())
+	})
+	verifier := NewSSHCAVerifier(ca.PublicKey())
+
+	// Expired now, but valid when the manifests were signed
+	issuer := Issuer{Reference: "sshca:alice", PublicKey: publicKey, Certificate: cert, FirstSigned: signedAt, LastSigned: signedAt}
+	assert.NoError(t, verifier.Verify([]Issuer{issuer})["sshca:alice"].Error)
+
+	issuer.LastSigned = signedAt.Add(2 * time.Hour)
+	assert.ErrorContains(t, verifier.Verify([]Issuer{issuer})["sshca:alice"].Error, "cert has expired")
+
+	issuer.FirstSigned, issuer.LastSigned = time.Time{}, time.Time{}
+	assert.ErrorContains(t, verifier.Verify([]Issuer{issuer})["sshca:alice"].Error, "cert has expired")
+}
+
+func TestSSHCAVerifier_WithUnsupportedScheme(t *testing.T) {
+	results := NewSSHCAVerifier(newTestCA(t).PublicKey()).Verify([]Issuer{testIssuer1})
+	assert.False(t, results[testReference1].Supported)
+}
+
+func TestNewSSHCAVerifierFromFile(t *testing.T) {
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	path := filepath.Join(t.TempDir(), "ca.pub")
+	data := append(ssh.MarshalAuthorizedKey(ca.PublicKey()), ssh.MarshalAuthorizedKey(otherCA.PublicKey())...)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	verifier, err := NewSSHCAVerifierFromFile(path)
+	require.NoError(t, err)
+	assert.Len(t, verifier.authorities, 2)
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0644))
+	_, err = NewSSHCAVerifierFromFile(path)
+	assert.ErrorContains(t, err, "no certificate authority keys found")
+}
+
+func TestLoadSSHCertificate(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	cert := newTestCertificate(t, newTestCA(t), publicKey, nil)
+	sshCert, err := ssh.ParsePublicKey(cert)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "id_ed25519-cert.pub")
+	require.NoError(t, os.WriteFile(path, ssh.MarshalAuthorizedKey(sshCert), 0644))
+
+	loaded, certifiedKey, err := LoadSSHCertificate(path)
+	require.NoError(t, err)
+	assert.Equal(t, cert, loaded)
+	assert.True(t, certifiedKey.Equal(publicKey))
+
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, ssh.MarshalAuthorizedKey(sshKey), 0644))
+	_, _, err = LoadSSHCertificate(path)
+	assert.ErrorContains(t, err, "got a plain ssh-ed25519 key")
+}
@@ -2,108 +2,200 @@ package issuer
 
 import (
 	"bufio"
+	"context"
 	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
 	"golang.org/x/crypto/ssh"
 )
 
+// DefaultConcurrency is the number of references whose keys are fetched at the same time unless set
+const DefaultConcurrency = 8
+
+// ConcurrencyConfigurable is implemented by verifiers fetching the keys of several references at the same time
+type ConcurrencyConfigurable interface {
+	SetConcurrency(n int)
+}
+
+// TracerConfigurable is implemented by verifiers fetching keys over HTTP, they report every request as a span
+type TracerConfigurable interface {
+	SetTracer(tracer telemetry.Tracer)
+}
+
 // URLBasedVerifier validates issuers against public keys hosted at a given URL template.
+// Transient failures of HTTP sources are retried according to a RetryPolicy, DefaultRetryPolicy unless set.
+// The keys of up to DefaultConcurrency references are fetched at the same time unless set.
 type URLBasedVerifier struct {
 	client      *http.Client
 	scheme      string
 	urlTemplate string
+	retry       RetryPolicy
+	sleep       func(ctx context.Context, d time.Duration) error
+	concurrency int
+	tracer      telemetry.Tracer
+	// escapeSlashes percent-encodes '/' in identifiers too, see escapeIdentifier
+	escapeSlashes bool
 }
 
 // NewURLBasedVerifier creates a generic verifier that fetches keys from a URL.
 // The urlTemplate should be a format string that accepts one argument (e.g., "https://example.com/keys/%s").
+// The identifier is percent-encoded before it is substituted, except for '/' separating its path elements,
+// see escapeIdentifier.
 func NewURLBasedVerifier(scheme string, urlTemplate string) *URLBasedVerifier {
 	return &URLBasedVerifier{
-		client:      &http.Client{},
+		client:      &http.Client{Timeout: 30 * time.Second},
 		scheme:      scheme,
 		urlTemplate: urlTemplate,
+		retry:       DefaultRetryPolicy,
+		sleep:       sleepContext,
+		concurrency: DefaultConcurrency,
+		tracer:      telemetry.Noop,
 	}
 }
 
+// Clone implements Cloneable, the copy shares the HTTP client
+func (v *URLBasedVerifier) Clone() Verifier {
+	clone := *v
+	return &clone
+}
+
+// SetRetryPolicy implements RetryConfigurable
+func (v *URLBasedVerifier) SetRetryPolicy(policy RetryPolicy) {
+	v.retry = policy
+}
+
+// SetConcurrency implements ConcurrencyConfigurable, values below 1 fetch one reference at a time
+func (v *URLBasedVerifier) SetConcurrency(n int) {
+	v.concurrency = max(n, 1)
+}
+
+// SetTracer implements TracerConfigurable
+func (v *URLBasedVerifier) SetTracer(tracer telemetry.Tracer) {
+	v.tracer = tracer
+}
+
 // NewGitHubIssuerVerifier creates a new verifier specifically for GitHub-hosted keys.
 func NewGitHubIssuerVerifier() *URLBasedVerifier {
-	return NewURLBasedVerifier("github:", "https://github.com/%s.keys")
+	return NewURLBasedVerifier(GitHubScheme, "https://github.com/%s.keys")
 }
 
-// Supports returns true for references that match the verifier's configured scheme.
+// Supports returns true for references that start with the verifier's configured scheme.
+// The scheme is matched exactly, as trust anchors and policies are.
 func (v *URLBasedVerifier) Supports(reference Reference) bool {
 	return strings.HasPrefix(string(reference), v.scheme)
 }
 
-// Verify checks if the public keys of the given issuers are present in the trusted source.
-// It returns a map where each key is an issuer reference and the value is an IssuerStatus
+// Verify checks if the public keys of the given issuers are present in the trusted source, see VerifyContext
 func (v *URLBasedVerifier) Verify(issuers []Issuer) map[Reference]Status {
-	results := make(map[Reference]Status)
+	return v.VerifyContext(context.Background(), issuers)
+}
+
+// VerifyContext checks if the public keys of the given issuers are present in the trusted source.
+// It returns a map where each key is an issuer reference and the value is an IssuerStatus.
+// The keys of distinct references are fetched concurrently, a failure of one reference does not affect others.
+// Fetches and the waits between their attempts stop when ctx is done, see ContextVerifier.
+func (v *URLBasedVerifier) VerifyContext(ctx context.Context, issuers []Issuer) map[Reference]Status {
 	issuersByRef := make(map[Reference][]Issuer)
 	for _, issuer := range issuers {
 		if v.Supports(issuer.Reference) {
 			issuersByRef[issuer.Reference] = append(issuersByRef[issuer.Reference], issuer)
 		}
 	}
+	// The statuses are returned in a map, consumers sort the references themselves
+	refs := make([]Reference, 0, len(issuersByRef))
+	for ref := range issuersByRef {
+		refs = append(refs, ref)
+	}
 
-	for ref, issuerGroup := range issuersByRef {
-		trustedKeys, err := v.fetchPublicKeys(ref)
-		if err != nil {
-			results[ref] = Status{
-				Issuer:    issuerGroup[0],
-				Supported: true,
-				Error:     fmt.Errorf("could not fetch keys for '%s': %w", ref, err),
+	// Every worker writes only the statuses of the references it takes, by index
+	statuses := make([]Status, len(refs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(v.concurrency, 1), len(refs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				statuses[i] = v.verifyReference(ctx, refs[i], issuersByRef[refs[i]])
 			}
-			continue
-		}
+		}()
+	}
+	for i := range refs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
 
-		// Check each issuer's public key against the trusted set.
-		allKeysValid := true
-		for _, issuer := range issuerGroup {
-			if !isKeyInSet(issuer.PublicKey, trustedKeys) {
-				allKeysValid = false
-				break // Found one invalid key, no need to check others for this ref.
-			}
+	results := make(map[Reference]Status, len(issuers))
+	for i, ref := range refs {
+		results[ref] = statuses[i]
+	}
+	for _, issuer := range issuers {
+		if _, ok := results[issuer.Reference]; !ok {
+			results[issuer.Reference] = Status{Issuer: issuer, Supported: false, Error: nil}
 		}
+	}
 
-		if !allKeysValid {
-			results[ref] = Status{
-				Issuer:    issuerGroup[0],
-				Supported: true,
-				Error:     fmt.Errorf("one or more public keys for issuer '%s' not found in trusted source", ref),
-			}
-			continue
-		}
+	return results
+}
 
-		results[ref] = Status{
+// verifyReference fetches the keys of ref and checks the public key of every issuer of issuerGroup against them
+func (v *URLBasedVerifier) verifyReference(ctx context.Context, ref Reference, issuerGroup []Issuer) Status {
+	trustedKeys, err := v.fetchPublicKeys(ctx, ref)
+	if err != nil {
+		return Status{
 			Issuer:    issuerGroup[0],
 			Supported: true,
-			Error:     nil,
+			Error:     fmt.Errorf("could not fetch keys for '%s': %w", ref, err),
 		}
 	}
 
-	for _, issuer := range issuers {
-		if _, ok := results[issuer.Reference]; !ok {
-			results[issuer.Reference] = Status{Issuer: issuer, Supported: false, Error: nil}
+	// Check each issuer's public key against the trusted set.
+	for _, issuer := range issuerGroup {
+		if !isKeyInSet(issuer.PublicKey, trustedKeys) {
+			return Status{
+				Issuer:    issuerGroup[0],
+				Supported: true,
+				Error:     fmt.Errorf("one or more public keys for issuer '%s' not found in trusted source", ref),
+			}
 		}
 	}
 
-	return results
+	return Status{
+		Issuer:    issuerGroup[0],
+		Supported: true,
+		Error:     nil,
+	}
 }
 
 // fetchPublicKeys retrieves and parses public keys from the configured URL template.
 // Supports both HTTP URLs and file URLs.
-func (v *URLBasedVerifier) fetchPublicKeys(reference Reference) (map[string]struct{}, error) {
-	identifier := strings.TrimPrefix(string(reference), v.scheme)
-	if identifier == "" {
-		return nil, fmt.Errorf("invalid reference: missing identifier in '%s'", reference)
+func (v *URLBasedVerifier) fetchPublicKeys(ctx context.Context, reference Reference) (map[string]struct{}, error) {
+	_, identifier, err := ParseReference(string(reference), v.scheme)
+	if err != nil {
+		return nil, err
+	}
+	elements := []string{identifier}
+	if !v.escapeSlashes {
+		elements = strings.Split(identifier, "/")
+	}
+	for _, element := range elements {
+		if element == "." || element == ".." {
+			return nil, fmt.Errorf("invalid reference: identifier '%s' is not allowed", identifier)
+		}
 	}
 
-	url := fmt.Sprintf(v.urlTemplate, identifier)
+	url := fmt.Sprintf(v.urlTemplate, escapeIdentifier(identifier, v.escapeSlashes))
 
 	var reader io.Reader
 	var closeFunc func() error
@@ -119,21 +211,86 @@ func (v *URLBasedVerifier) fetchPublicKeys(reference Reference) (map[string]stru
 		closeFunc = file.Close
 	} else {
 		// Handle HTTP URL
-		resp, err := v.client.Get(url)
+		body, err := retry(ctx, v.retry, v.sleep, func() (io.ReadCloser, error) { return v.get(ctx, reference, url) })
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch URL %s: %w", url, err)
+			return nil, err
 		}
-		reader = resp.Body
-		closeFunc = resp.Body.Close
+		reader = body
+		closeFunc = body.Close
+	}
+	defer closeFunc()
+
+	keys, err := v.parsePublicKeys(reader)
+	if err != nil {
+		return nil, err
+	}
+	logging.Logger().Debug("key fetched", "reference", reference, "url", url, "keys", len(keys))
+	return keys, nil
+}
 
-		if resp.StatusCode != http.StatusOK {
-			closeFunc()
-			return nil, fmt.Errorf("failed to fetch URL %s: received status %s", url, resp.Status)
+// get performs a single request for the keys of reference, failures which may succeed when repeated are returned
+// as TransientError. A missing resource, like an unknown GitHub user, is a permanent failure.
+func (v *URLBasedVerifier) get(ctx context.Context, reference Reference, url string) (body io.ReadCloser, err error) {
+	// The query and the user info of custom URL templates may hold credentials, spans only record the host and
+	// the path, and errors without the URL
+	attrs := []telemetry.Attribute{telemetry.String(telemetry.KeyReference, string(reference))}
+	if parsed, parseErr := neturl.Parse(url); parseErr == nil {
+		attrs = append(attrs, telemetry.String(telemetry.KeyServerAddress, parsed.Host),
+			telemetry.String(telemetry.KeyURLPath, parsed.Path))
+	}
+	_, span := v.tracer.Start(ctx, "fetch keys", time.Time{}, attrs...)
+	var spanErr error
+	defer func() {
+		if spanErr != nil {
+			span.RecordError(spanErr)
 		}
+		span.End()
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		spanErr = err
+		return nil, fmt.Errorf("failed to fetch URL %s: %w", url, err)
 	}
-	defer closeFunc()
+	resp, err := v.client.Do(req)
+	if err != nil {
+		spanErr = err
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			spanErr = urlErr.Err
+		}
+		// Network errors and timeouts are worth retrying
+		return nil, &TransientError{Err: fmt.Errorf("failed to fetch URL %s: %w", url, err)}
+	}
+	span.SetAttributes(telemetry.Int64(telemetry.KeyStatusCode, int64(resp.StatusCode)))
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	resp.Body.Close()
+	spanErr = fmt.Errorf("received status %s", resp.Status)
+	err = fmt.Errorf("failed to fetch URL %s: %w", url, spanErr)
+	if isTransientStatus(resp.StatusCode) {
+		logging.Logger().Debug("transient key fetch failure", "url", url, "status", resp.StatusCode)
+		return nil, &TransientError{Err: err, RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+	}
+	return nil, err
+}
 
-	return v.parsePublicKeys(reader)
+// escapeIdentifier percent-encodes every byte of identifier except unreserved URL characters, '@' and, unless
+// escapeSlashes is set, '/', so it can be used in a path or a query value. Identifiers of schemes with nested
+// names, e.g. GitLab groups, keep their path elements. With escapeSlashes, the identifier never adds path
+// elements: file URLs use the encoded identifier as file name, e.g. "team%2Falice" for "team/alice".
+func escapeIdentifier(identifier string, escapeSlashes bool) string {
+	var b strings.Builder
+	for i := 0; i < len(identifier); i++ {
+		c := identifier[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~@", c) >= 0 ||
+			c == '/' && !escapeSlashes {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
 }
 
 // parsePublicKeys parses public keys from a reader containing SSH authorized keys format
@@ -1,11 +1,21 @@
 package issuer
 
 import (
+	"bytes"
+	"context"
 	"crypto/ed25519"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
 	"golang.org/x/crypto/ssh"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -105,6 +115,27 @@ func TestURLBasedVerifier_Verify_Success(t *testing.T) {
 	assert.NoError(t, status.Error)
 }
 
+func TestURLBasedVerifier_Verify_LogsKeyFetched(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(ssh.MarshalAuthorizedKey(sshPub))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logging.SetLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer logging.SetLogger(nil)
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.client = server.Client()
+	verifier.Verify([]Issuer{{Reference: "test:issuer", PublicKey: publicKey}})
+
+	assert.Contains(t, logs.String(), `"msg":"key fetched","reference":"test:issuer"`)
+}
+
 // TestURLBasedVerifier_Verify_KeyNotFound tests when public key is not in trusted set
 func TestURLBasedVerifier_Verify_KeyNotFound(t *testing.T) {
 	// Generate keys
@@ -148,6 +179,7 @@ func TestURLBasedVerifier_Verify_HTTPError(t *testing.T) {
 		name          string
 		handler       http.HandlerFunc
 		expectedError string
+		transient     bool
 	}{
 		{
 			name: "server returns 404",
@@ -162,6 +194,7 @@ func TestURLBasedVerifier_Verify_HTTPError(t *testing.T) {
 				w.WriteHeader(http.StatusInternalServerError)
 			},
 			expectedError: "failed to fetch URL",
+			transient:     true,
 		},
 		{
 			name: "server connection error",
@@ -174,6 +207,7 @@ func TestURLBasedVerifier_Verify_HTTPError(t *testing.T) {
 				}
 			},
 			expectedError: "failed to fetch URL",
+			transient:     true,
 		},
 	}
 
@@ -184,6 +218,7 @@ func TestURLBasedVerifier_Verify_HTTPError(t *testing.T) {
 
 			verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
 			verifier.client = server.Client()
+			verifier.sleep = func(context.Context, time.Duration) error { return nil }
 
 			issuers := []Issuer{
 				{
@@ -198,6 +233,7 @@ func TestURLBasedVerifier_Verify_HTTPError(t *testing.T) {
 			require.True(t, status.Supported)
 			require.Error(t, status.Error)
 			assert.Contains(t, status.Error.Error(), tt.expectedError)
+			assert.Equal(t, tt.transient, IsTransient(status.Error))
 		})
 	}
 }
@@ -289,3 +325,146 @@ func TestNewGitHubIssuerVerifier(t *testing.T) {
 	assert.Equal(t, "https://github.com/%s.keys", verifier.urlTemplate)
 	assert.NotNil(t, verifier.client)
 }
+
+func TestURLBasedVerifier_Verify_FetchesReferencesConcurrently(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+	var inFlight, maxInFlight atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for current := maxInFlight.Load(); n > current && !maxInFlight.CompareAndSwap(current, n); {
+			current = maxInFlight.Load()
+		}
+		<-release
+		if r.URL.Path == "/team-3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(ssh.MarshalAuthorizedKey(sshPub))
+	}))
+	defer server.Close()
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.client = server.Client()
+	verifier.SetConcurrency(4)
+	var issuers []Issuer
+	for i := range 10 {
+		issuers = append(issuers, Issuer{Reference: Reference(fmt.Sprintf("test:team-%d", i)), PublicKey: publicKey})
+	}
+
+	done := make(chan map[Reference]Status)
+	go func() { done <- verifier.Verify(issuers) }()
+	// Requests are held until 4 of them are in flight at the same time
+	require.Eventually(t, func() bool { return inFlight.Load() == 4 }, 5*time.Second, time.Millisecond)
+	close(release)
+	results := <-done
+
+	assert.Equal(t, int32(4), maxInFlight.Load())
+	require.Len(t, results, 10)
+	for _, issuer := range issuers {
+		status := results[issuer.Reference]
+		assert.Equal(t, issuer.Reference, status.Issuer.Reference)
+		if issuer.Reference == "test:team-3" {
+			assert.ErrorContains(t, status.Error, "could not fetch keys for 'test:team-3'")
+		} else {
+			assert.NoError(t, status.Error, issuer.Reference)
+		}
+	}
+}
+
+// recordingTracer records the spans started, in the order they end
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	attrs  map[string]any
+	err    error
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, _ time.Time, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	span := &recordedSpan{tracer: t, name: name, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...telemetry.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+
+func (s *recordedSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+func TestURLBasedVerifier_SetTracer_RecordsEveryRequest(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	tracer := &recordingTracer{}
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s?token=secret")
+	verifier.client = server.Client()
+	verifier.sleep = func(context.Context, time.Duration) error { return nil }
+	NewMultiSourceVerifier(verifier).SetTracer(tracer)
+
+	status := verifier.Verify([]Issuer{{Reference: "test:alice"}})["test:alice"]
+
+	require.Error(t, status.Error)
+	require.Len(t, tracer.spans, 2, "the transient failure is retried")
+	for i, code := range []int64{http.StatusServiceUnavailable, http.StatusNotFound} {
+		span := tracer.spans[i]
+		assert.Equal(t, "fetch keys", span.name)
+		assert.Equal(t, "test:alice", span.attrs[telemetry.KeyReference])
+		assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), span.attrs[telemetry.KeyServerAddress])
+		assert.Equal(t, "/alice", span.attrs[telemetry.KeyURLPath])
+		assert.Equal(t, code, span.attrs[telemetry.KeyStatusCode])
+		assert.Error(t, span.err)
+		assert.NotContains(t, span.err.Error(), "secret", "the query of the URL is not recorded")
+	}
+}
+
+func TestURLBasedVerifier_VerifyContext_StopsFetchingWhenCancelled(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	verifier := NewURLBasedVerifier("test:", server.URL+"/%s")
+	verifier.client = server.Client()
+	verifier.SetRetryPolicy(RetryPolicy{Attempts: 3, InitialBackoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for requests.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	status := verifier.VerifyContext(ctx, []Issuer{{Reference: "test:issuer", PublicKey: publicKey}})["test:issuer"]
+
+	assert.ErrorIs(t, status.Error, context.Canceled)
+	assert.Equal(t, CategoryUnverifiable, status.Category())
+	assert.Equal(t, int32(1), requests.Load())
+}
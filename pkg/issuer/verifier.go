@@ -1,7 +1,15 @@
 package issuer
 
 import (
+	"context"
 	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"strings"
+	"time"
 )
 
 type Reference string
@@ -11,12 +19,81 @@ type Reference string
 type Issuer struct {
 	Reference Reference
 	PublicKey ed25519.PublicKey
+	// Certificate is the SSH certificate of PublicKey in wire format, recorded by the signer if it has one
+	Certificate []byte
+	// FirstSigned and LastSigned bound the signing times the issuer recorded in its manifests with a valid
+	// signature, zero when unknown
+	FirstSigned time.Time
+	LastSigned  time.Time
 }
 
 type Status struct {
 	Issuer
 	Supported bool
 	Error     error
+	// Pinned is set when the issuer is trusted because its key is pinned by trust anchors, see PinnedVerifier
+	Pinned bool
+	// Warning notes something questionable that does not change the category of the status, e.g. clock skew
+	Warning string
+}
+
+// Category classifies the outcome of verifying an issuer for reports
+type Category string
+
+const (
+	CategoryTrusted     Category = "trusted"
+	CategoryUnsupported Category = "unsupported"
+	// CategoryUnverifiable means the trusted source could not be reached, a later run may still trust the issuer
+	CategoryUnverifiable Category = "unverifiable"
+	// CategoryFishy means the issuer is questionable rather than clearly untrusted, e.g. its key expired
+	CategoryFishy Category = "fishy"
+	// CategoryExpired means a certificate of the issuer is outside its validity window, see signing.CheckValidity
+	CategoryExpired Category = "expired"
+	CategoryError   Category = "error"
+)
+
+// Category returns the category of the status
+func (s Status) Category() Category {
+	switch {
+	case errors.Is(s.Error, signing.ErrCertificateExpired) || errors.Is(s.Error, signing.ErrCertificateNotYetValid):
+		return CategoryExpired
+	case !s.Supported:
+		return CategoryUnsupported
+	case IsTransient(s.Error):
+		return CategoryUnverifiable
+	case s.Error != nil && isFishy(s.Error):
+		return CategoryFishy
+	case s.Error != nil:
+		return CategoryError
+	default:
+		return CategoryTrusted
+	}
+}
+
+// isFishy determines if an error represents a "fishy" situation rather than a hard failure
+func isFishy(err error) bool {
+	errStr := strings.ToLower(err.Error())
+	// Consider errors related to key validation as "fishy" rather than complete failures
+	fishyIndicators := []string{
+		"key expired",
+		"not found in trusted source",
+		"validation warning",
+		"fishy",
+		"questionable",
+		"expires soon",
+	}
+	for _, indicator := range fishyIndicators {
+		if strings.Contains(errStr, indicator) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of a public key prefixed with "sha256:"
+func Fingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "sha256:" + hex.EncodeToString(sum[:])
 }
 
 // Verifier defines the interface for verifying a collection of issuers
@@ -30,6 +107,33 @@ type Verifier interface {
 	Supports(reference Reference) bool
 }
 
+// ContextVerifier is implemented by verifiers whose lookups, e.g. fetching keys over HTTP, stop when ctx is done
+type ContextVerifier interface {
+	VerifyContext(ctx context.Context, issuers []Issuer) map[Reference]Status
+}
+
+// VerifyContext verifies issuers with v, stopping its lookups when ctx is done if v is a ContextVerifier
+func VerifyContext(ctx context.Context, v Verifier, issuers []Issuer) map[Reference]Status {
+	if contextVerifier, ok := v.(ContextVerifier); ok {
+		return contextVerifier.VerifyContext(ctx, issuers)
+	}
+	return v.Verify(issuers)
+}
+
+// Cloneable is implemented by configurable verifiers, e.g. RetryConfigurable ones. Configuring a clone leaves
+// the original unchanged.
+type Cloneable interface {
+	Clone() Verifier
+}
+
+// Clone returns a copy of v if it implements Cloneable, v itself otherwise
+func Clone(v Verifier) Verifier {
+	if cloneable, ok := v.(Cloneable); ok {
+		return cloneable.Clone()
+	}
+	return v
+}
+
 // MultiSourceVerifier is a container for multiple Verifier implementations.
 // It delegates verification to the first verifier that supports the issuer's reference scheme.
 type MultiSourceVerifier struct {
@@ -41,22 +145,73 @@ func NewMultiSourceVerifier(verifiers ...Verifier) *MultiSourceVerifier {
 	return &MultiSourceVerifier{verifiers: verifiers}
 }
 
-// Verify iterates through the issuers and delegates to the appropriate verifier.
+// Verify delegates each issuer to the first verifier that supports its reference, see VerifyContext
 func (v *MultiSourceVerifier) Verify(issuers []Issuer) map[Reference]Status {
+	return v.VerifyContext(context.Background(), issuers)
+}
+
+// VerifyContext delegates each issuer to the first verifier that supports its reference. Every verifier is
+// called once with all its issuers, so that it can batch the lookups, e.g. fetch the keys of a reference once.
+func (v *MultiSourceVerifier) VerifyContext(ctx context.Context, issuers []Issuer) map[Reference]Status {
 	result := make(map[Reference]Status)
+	partitions := make([][]Issuer, len(v.verifiers))
 	for _, issuer := range issuers {
 		result[issuer.Reference] = Status{Issuer: issuer, Supported: false}
-		for _, verifier := range v.verifiers {
+		for i, verifier := range v.verifiers {
 			if verifier.Supports(issuer.Reference) {
-				singleResult := verifier.Verify([]Issuer{issuer})
-				result[issuer.Reference] = singleResult[issuer.Reference]
+				partitions[i] = append(partitions[i], issuer)
 				break
 			}
 		}
 	}
+	for i, partition := range partitions {
+		if len(partition) == 0 {
+			continue
+		}
+		batchResult := VerifyContext(ctx, v.verifiers[i], partition)
+		for _, issuer := range partition {
+			result[issuer.Reference] = batchResult[issuer.Reference]
+		}
+	}
 	return result
 }
 
 func (v *MultiSourceVerifier) Supports(reference Reference) bool {
 	return true
 }
+
+// Clone implements Cloneable by cloning every verifier supporting it
+func (v *MultiSourceVerifier) Clone() Verifier {
+	verifiers := make([]Verifier, len(v.verifiers))
+	for i, verifier := range v.verifiers {
+		verifiers[i] = Clone(verifier)
+	}
+	return &MultiSourceVerifier{verifiers: verifiers}
+}
+
+// SetRetryPolicy implements RetryConfigurable by passing the policy to every verifier supporting it
+func (v *MultiSourceVerifier) SetRetryPolicy(policy RetryPolicy) {
+	for _, verifier := range v.verifiers {
+		if configurable, ok := verifier.(RetryConfigurable); ok {
+			configurable.SetRetryPolicy(policy)
+		}
+	}
+}
+
+// SetTracer implements TracerConfigurable by passing tracer to every verifier supporting it
+func (v *MultiSourceVerifier) SetTracer(tracer telemetry.Tracer) {
+	for _, verifier := range v.verifiers {
+		if configurable, ok := verifier.(TracerConfigurable); ok {
+			configurable.SetTracer(tracer)
+		}
+	}
+}
+
+// SetConcurrency implements ConcurrencyConfigurable by passing n to every verifier supporting it
+func (v *MultiSourceVerifier) SetConcurrency(n int) {
+	for _, verifier := range v.verifiers {
+		if configurable, ok := verifier.(ConcurrencyConfigurable); ok {
+			configurable.SetConcurrency(n)
+		}
+	}
+}
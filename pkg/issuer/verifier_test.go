@@ -12,6 +12,8 @@ import (
 type MockVerifier struct {
 	supportedSchemes map[Reference]bool
 	verifyResults    map[Reference]Status
+	// calls records the issuers of every Verify call
+	calls [][]Issuer
 }
 
 func NewMockVerifier() *MockVerifier {
@@ -26,6 +28,7 @@ func (m *MockVerifier) Supports(reference Reference) bool {
 }
 
 func (m *MockVerifier) Verify(issuers []Issuer) map[Reference]Status {
+	m.calls = append(m.calls, issuers)
 	result := make(map[Reference]Status)
 	for _, issuer := range issuers {
 		if status, exists := m.verifyResults[issuer.Reference]; exists {
@@ -172,6 +175,29 @@ func TestMultiSourceVerifier_Verify_OrderMatters(t *testing.T) {
 	}
 }
 
+func TestMultiSourceVerifier_Verify_BatchesIssuersPerVerifier(t *testing.T) {
+	githubVerifier := NewMockVerifier()
+	githubVerifier.AddSupportedScheme(testReference1, Status{Issuer: testIssuer1, Supported: true})
+	corpVerifier := NewMockVerifier()
+	corpVerifier.AddSupportedScheme(testReference1, Status{Issuer: testIssuer1, Supported: false})
+	corpVerifier.AddSupportedScheme(testReference2, Status{Issuer: testIssuer2, Supported: true})
+	otherIssuer := Issuer{Reference: Reference("corp://keyserver/other"), PublicKey: validPublicKey}
+	corpVerifier.AddSupportedScheme(otherIssuer.Reference, Status{Issuer: otherIssuer, Supported: true})
+
+	multiVerifier := NewMultiSourceVerifier(githubVerifier, corpVerifier)
+	result := multiVerifier.Verify([]Issuer{testIssuer1, testIssuer2, testIssuer3, otherIssuer})
+
+	require.Len(t, githubVerifier.calls, 1)
+	assert.Equal(t, []Issuer{testIssuer1}, githubVerifier.calls[0])
+	require.Len(t, corpVerifier.calls, 1)
+	assert.Equal(t, []Issuer{testIssuer2, otherIssuer}, corpVerifier.calls[0])
+	assert.True(t, result[testReference1].Supported, "the first supporting verifier must handle the issuer")
+	assert.True(t, result[testReference2].Supported)
+	assert.True(t, result[otherIssuer.Reference].Supported)
+	assert.False(t, result[testReference3].Supported)
+	assert.Len(t, result, 4)
+}
+
 func TestMultiSourceVerifier_Verify_EmptyIssuers(t *testing.T) {
 	verifier := NewMockVerifier()
 	multiVerifier := NewMultiSourceVerifier(verifier)
@@ -275,3 +301,18 @@ func (is Status) String() string {
 	}
 	return "Issuer(" + string(is.Reference) + "): " + status
 }
+
+func TestMultiSourceVerifier_Clone_mustLeaveTheOriginalUnchanged(t *testing.T) {
+	urlVerifier := NewURLBasedVerifier("test:", "https://example.com/%s")
+	original := NewMultiSourceVerifier(urlVerifier, NewMockVerifier())
+
+	clone := Clone(original)
+	clone.(RetryConfigurable).SetRetryPolicy(RetryPolicy{Attempts: 7})
+	clone.(ConcurrencyConfigurable).SetConcurrency(1)
+
+	assert.Equal(t, DefaultRetryPolicy, urlVerifier.retry)
+	assert.Equal(t, DefaultConcurrency, urlVerifier.concurrency)
+	cloned := clone.(*MultiSourceVerifier).verifiers[0].(*URLBasedVerifier)
+	assert.Equal(t, 7, cloned.retry.Attempts)
+	assert.Equal(t, 1, cloned.concurrency)
+}
@@ -0,0 +1,142 @@
+// Package lock keeps two runs writing manifests from working on the same tree at once.
+// The lock is advisory: a file at the root of the tree, created exclusively and removed by Release.
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Name is the name of the lock file at the root of a locked tree, it is never recorded in manifests
+const Name = ".bytecheck.lock"
+
+// ErrLocked is wrapped by the error of Acquire when another run holds the lock, see HeldError
+var ErrLocked = errors.New("tree is locked by another run")
+
+// Holder describes the run holding a lock, as stored in the lock file
+type Holder struct {
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// HeldError is returned by Acquire when the tree is locked
+type HeldError struct {
+	// Path is the path of the lock file
+	Path   string
+	Holder Holder
+	// Stale is set when the holder process no longer exists, the lock may then be taken over, see Acquire
+	Stale bool
+}
+
+func (e *HeldError) Error() string {
+	message := fmt.Sprintf("another bytecheck %s (pid %d, started %s ago) is running on this tree",
+		e.Holder.Command, e.Holder.PID, formatAge(time.Since(e.Holder.StartedAt)))
+	if e.Stale {
+		message += fmt.Sprintf("; pid %d no longer exists, the lock %s is stale", e.Holder.PID, e.Path)
+	}
+	return message
+}
+
+func (e *HeldError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// Lock is a lock held on a tree
+type Lock struct {
+	path string
+}
+
+// Acquire locks the tree rooted at root for command, e.g. "generate". It fails fast with a HeldError when
+// the tree is locked, unless takeOverStale is set and the holder process no longer exists. Lock files that
+// cannot be read are taken over as stale as well.
+func Acquire(root, command string, takeOverStale bool) (*Lock, error) {
+	path := filepath.Join(root, Name)
+	holder := Holder{PID: os.Getpid(), Command: command, StartedAt: time.Now()}
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := create(path, data)
+		if err == nil {
+			return &Lock{path: path}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+		held, err := read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released in the meantime
+			continue
+		}
+		if err == nil && !held.Stale {
+			return nil, held
+		}
+		if !takeOverStale {
+			if err != nil {
+				return nil, fmt.Errorf("%w: lock file %s cannot be read: %w", ErrLocked, path, err)
+			}
+			return nil, held
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock file: %w", err)
+		}
+		// Another run taking over the same stale lock at once loses the exclusive creation
+		takeOverStale = false
+	}
+}
+
+// Release removes the lock file
+func (l *Lock) Release() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+func create(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// read returns the HeldError describing the lock file at path
+func read(path string) (*HeldError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var holder Holder
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return nil, err
+	}
+	return &HeldError{Path: path, Holder: holder, Stale: !processExists(holder.PID)}, nil
+}
+
+// formatAge rounds age to its largest unit, e.g. 2m
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
@@ -0,0 +1,115 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadPID returns the PID of a process that exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stale locks are not detected on Windows")
+	}
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+func writeLock(t *testing.T, root string, holder Holder) {
+	t.Helper()
+	data, err := json.Marshal(holder)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, Name), data, 0644))
+}
+
+func TestAcquire_WhenHeld_mustFailFastNamingHolder(t *testing.T) {
+	root := t.TempDir()
+	first, err := Acquire(root, "generate", false)
+	require.NoError(t, err)
+
+	_, err = Acquire(root, "generate", true)
+
+	require.ErrorIs(t, err, ErrLocked)
+	var held *HeldError
+	require.True(t, errors.As(err, &held))
+	assert.False(t, held.Stale)
+	assert.Equal(t, os.Getpid(), held.Holder.PID)
+	assert.Regexp(t, `^another bytecheck generate \(pid \d+, started \d+s ago\) is running on this tree$`, err.Error())
+
+	require.NoError(t, first.Release())
+	assert.NoFileExists(t, filepath.Join(root, Name))
+	second, err := Acquire(root, "generate", false)
+	require.NoError(t, err)
+	require.NoError(t, second.Release())
+}
+
+func TestAcquire_Concurrently_mustLetOneRunIn(t *testing.T) {
+	root := t.TempDir()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var acquired int
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Acquire(root, "generate", true)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				acquired++
+			} else {
+				assert.ErrorIs(t, err, ErrLocked)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, acquired)
+}
+
+func TestAcquire_WithStaleLock_mustTakeOverOnlyWhenAsked(t *testing.T) {
+	root := t.TempDir()
+	pid := deadPID(t)
+	writeLock(t, root, Holder{PID: pid, Command: "generate", StartedAt: time.Now().Add(-2 * time.Minute)})
+
+	_, err := Acquire(root, "generate", false)
+	var held *HeldError
+	require.True(t, errors.As(err, &held))
+	assert.True(t, held.Stale)
+	assert.ErrorContains(t, err, fmt.Sprintf("(pid %d, started 2m ago)", pid))
+	assert.ErrorContains(t, err, "no longer exists")
+
+	l, err := Acquire(root, "generate", true)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(root, Name))
+	require.NoError(t, err)
+	var holder Holder
+	require.NoError(t, json.Unmarshal(data, &holder))
+	assert.Equal(t, os.Getpid(), holder.PID)
+	require.NoError(t, l.Release())
+}
+
+func TestAcquire_WithUnreadableLock_mustTakeOverOnlyWhenAsked(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, Name), []byte("garbage"), 0644))
+
+	_, err := Acquire(root, "generate", false)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.ErrorContains(t, err, "cannot be read")
+
+	l, err := Acquire(root, "generate", true)
+	require.NoError(t, err)
+	require.NoError(t, l.Release())
+}
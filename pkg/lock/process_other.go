@@ -0,0 +1,8 @@
+//go:build !unix
+
+package lock
+
+// processExists cannot tell on this platform, locks are then never considered stale
+func processExists(pid int) bool {
+	return pid > 0
+}
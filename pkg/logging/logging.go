@@ -0,0 +1,28 @@
+// Package logging holds the default logger of the bytecheck library packages.
+// Events are discarded unless a logger is installed with SetLogger; components created
+// with their own logger option, like the scanner, use that one instead.
+package logging
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	SetLogger(nil)
+}
+
+// Logger returns the default logger
+func Logger() *slog.Logger {
+	return logger.Load()
+}
+
+// SetLogger replaces the default logger, nil restores the one discarding all events
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logger.Store(l)
+}
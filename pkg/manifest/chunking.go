@@ -0,0 +1,38 @@
+package manifest
+
+// DefaultChunkSize is the size of the chunks of large files unless another one is chosen, see Chunking
+const DefaultChunkSize = 64 << 20
+
+// Chunking holds the checksums of the consecutive chunks of a file, the last one possibly shorter.
+// It is recorded, besides the checksum of the whole file, for files larger than one chunk, so that
+// a checksum mismatch can be narrowed down to the byte ranges that changed.
+type Chunking struct {
+	ChunkSize    int64    `json:"chunkSize"`
+	ChunkDigests []string `json:"chunkDigests"`
+}
+
+// Offset returns the offset in the file of chunk index
+func (c Chunking) Offset(index int) int64 {
+	return int64(index) * c.ChunkSize
+}
+
+// BadChunks returns the index of the first chunk that differs between expected and actual and the number
+// of chunks that differ, chunks present in only one of them included. ok is false unless both record chunks
+// of the same size.
+func BadChunks(expected, actual *Chunking) (first int, count int, ok bool) {
+	if expected == nil || actual == nil || expected.ChunkSize != actual.ChunkSize {
+		return 0, 0, false
+	}
+	first = -1
+	for i := 0; i < max(len(expected.ChunkDigests), len(actual.ChunkDigests)); i++ {
+		if i < len(expected.ChunkDigests) && i < len(actual.ChunkDigests) &&
+			SecureEqualHex(expected.ChunkDigests[i], actual.ChunkDigests[i]) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		count++
+	}
+	return max(first, 0), count, true
+}
@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadChunks(t *testing.T) {
+	expected := &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "0b", "0c", "0d"}}
+
+	first, count, ok := BadChunks(expected, &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "0b", "ff", "0d"}})
+	assert.True(t, ok)
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 1, count)
+
+	// A truncated file misses its last chunks
+	first, count, ok = BadChunks(expected, &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "ee"}})
+	assert.True(t, ok)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 3, count)
+
+	// Digests are lowercase hex, other spellings never match
+	first, count, ok = BadChunks(expected, &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "0B", "0c", "0d"}})
+	assert.True(t, ok)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 1, count)
+
+	_, _, ok = BadChunks(expected, &Chunking{ChunkSize: 8, ChunkDigests: []string{"0a"}})
+	assert.False(t, ok)
+	_, _, ok = BadChunks(expected, nil)
+	assert.False(t, ok)
+}
+
+func TestCompareManifests_WithChunks_mustReportFirstBadChunk(t *testing.T) {
+	a := New([]Entity{{Name: "big.bin", Checksum: "01", Chunking: &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "0b", "0c"}}}})
+	b := New([]Entity{{Name: "big.bin", Checksum: "02", Chunking: &Chunking{ChunkSize: 4, ChunkDigests: []string{"0a", "0b", "ff"}}}})
+	_, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffChecksumMismatch, differences[0].Type)
+	require.NotNil(t, differences[0].FirstBadChunk)
+	assert.Equal(t, 2, *differences[0].FirstBadChunk)
+	assert.Equal(t, 1, differences[0].BadChunkCount)
+
+	// The first chunk is not omitted from JSON
+	b.Entities[0].Chunking.ChunkDigests[0] = "ff"
+	_, differences, err = CompareManifests(a, b)
+	require.NoError(t, err)
+	data, err := json.Marshal(differences[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"firstBadChunk":0,"badChunkCount":2`)
+}
+
+func TestParse_WithTamperedChunk_mustFailHMAC(t *testing.T) {
+	m := New([]Entity{{Name: "big.bin", Checksum: "1", Chunking: &Chunking{ChunkSize: 4, ChunkDigests: []string{"a", "b"}}}})
+	data, err := m.Encode()
+	require.NoError(t, err)
+	_, err = Parse(data)
+	require.NoError(t, err)
+
+	m.Entities[0].Chunking.ChunkDigests[1] = "x"
+	tampered, err := json.Marshal(m)
+	require.NoError(t, err)
+	_, err = Parse(tampered)
+	assert.True(t, errors.Is(err, ErrInvalidManifest), "got %v", err)
+}
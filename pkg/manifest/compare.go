@@ -12,8 +12,21 @@ const (
 	DiffMissingInB
 	// DiffChecksumMismatch indicates entities have different checksums
 	DiffChecksumMismatch
-	// DiffTypeMismatch indicates entities have different types (file vs directory)
+	// DiffTypeMismatch indicates entities have different types (file, directory or special file), see Entity.Kind
 	DiffTypeMismatch
+	// DiffPermissionMismatch indicates entities have different mode or owner
+	DiffPermissionMismatch
+	// DiffSubtreeMismatch indicates the manifests record different totals of the tree below the directory,
+	// see Manifest.Subtree. It has no entity, it summarizes the entity differences and is not one of them, see
+	// CompareSubtrees.
+	DiffSubtreeMismatch
+	// DiffXattrMismatch indicates entities have different extended attributes, see Entity.XattrsDigest
+	DiffXattrMismatch
+	// DiffSizeMismatch indicates files have different sizes and one of them was not hashed, see SizeMismatch
+	DiffSizeMismatch
+	// DiffHardlinkBroken indicates a file is no longer a hard link of the file it was recorded linked with, see
+	// Entity.LinkGroup. CompareManifests does not report it, links are checked across directories by verification.
+	DiffHardlinkBroken
 )
 
 // String returns the string representation of the difference type
@@ -27,17 +40,45 @@ func (d DifferenceType) String() string {
 		return "checksum_mismatch"
 	case DiffTypeMismatch:
 		return "type_mismatch"
+	case DiffPermissionMismatch:
+		return "permission_mismatch"
+	case DiffSubtreeMismatch:
+		return "subtree_mismatch"
+	case DiffXattrMismatch:
+		return "xattr_mismatch"
+	case DiffSizeMismatch:
+		return "size_mismatch"
+	case DiffHardlinkBroken:
+		return "hardlink_broken"
 	default:
 		return "unknown"
 	}
 }
 
+// MarshalText implements encoding.TextMarshaler
+func (d DifferenceType) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
 // EntityDifference represents a specific difference between two manifests
 type EntityDifference struct {
-	Name           string
-	Type           DifferenceType
-	ExpectedEntity *Entity
-	ActualEntity   *Entity
+	Name           string         `json:"name"`
+	Type           DifferenceType `json:"type"`
+	ExpectedEntity *Entity        `json:"expected,omitempty"`
+	ActualEntity   *Entity        `json:"actual,omitempty"`
+	// ExpectedSubtree and ActualSubtree are only set for DiffSubtreeMismatch
+	ExpectedSubtree *SubtreeTotals `json:"expectedSubtree,omitempty"`
+	ActualSubtree   *SubtreeTotals `json:"actualSubtree,omitempty"`
+	// FirstBadChunk and BadChunkCount narrow down a DiffChecksumMismatch of a file to its chunks, see Chunking.
+	// They are only set when both entities record chunks of the same size.
+	FirstBadChunk *int `json:"firstBadChunk,omitempty"`
+	BadChunkCount int  `json:"badChunkCount,omitempty"`
+	// Hidden is set by verification for differences involving hidden entries, or entries below a hidden directory,
+	// of manifests generated with the "warn" hidden policy, see Manifest.HiddenPolicy
+	Hidden bool `json:"hidden,omitempty"`
+	// LinkedTo is only set for DiffHardlinkBroken, it is the path relative to the verified root of the file
+	// the entity was recorded linked with
+	LinkedTo string `json:"linkedTo,omitempty"`
 }
 
 // CompareManifests compares two manifests and returns their differences
@@ -48,21 +89,33 @@ func CompareManifests(a, b *Manifest) (bool, []EntityDifference, error) {
 	}
 
 	// Create maps for easier comparison
-	entitiesA := make(map[string]Entity)
-	for _, entity := range a.Entities {
-		entitiesA[entity.Name] = entity
+	entitiesA, err := entitiesByName(a)
+	if err != nil {
+		return false, nil, err
 	}
-
-	entitiesB := make(map[string]Entity)
-	for _, entity := range b.Entities {
-		entitiesB[entity.Name] = entity
+	entitiesB, err := entitiesByName(b)
+	if err != nil {
+		return false, nil, err
 	}
 
 	differences := make([]EntityDifference, 0)
 
+	// Directories which became mountpoints, or stopped being ones, are not differences, see Manifest.Mountpoints
+	mountpointsA := make(map[string]bool, len(a.Mountpoints))
+	for _, name := range a.Mountpoints {
+		mountpointsA[name] = true
+	}
+	mountpointsB := make(map[string]bool, len(b.Mountpoints))
+	for _, name := range b.Mountpoints {
+		mountpointsB[name] = true
+	}
+
 	// Check for entities in A but not in B
 	for name, entityA := range entitiesA {
 		if entityB, exists := entitiesB[name]; !exists {
+			if mountpointsB[name] {
+				continue
+			}
 			differences = append(differences, EntityDifference{
 				Name:           name,
 				Type:           DiffMissingInB,
@@ -71,19 +124,50 @@ func CompareManifests(a, b *Manifest) (bool, []EntityDifference, error) {
 			})
 		} else {
 			// Entity exists in both, check for differences
-			if entityA.IsDir != entityB.IsDir {
+			if entityA.Kind() != entityB.Kind() {
 				differences = append(differences, EntityDifference{
 					Name:           name,
 					Type:           DiffTypeMismatch,
 					ExpectedEntity: &entityA,
 					ActualEntity:   &entityB,
 				})
-			} else if entityA.Checksum != entityB.Checksum {
+				continue
+			}
+			if SizeMismatch(entityA, entityB) {
 				differences = append(differences, EntityDifference{
+					Name:           name,
+					Type:           DiffSizeMismatch,
+					ExpectedEntity: &entityA,
+					ActualEntity:   &entityB,
+				})
+			} else if !entityA.Unmanaged() && ChecksumMismatch(entityA, entityB) {
+				// A directory recorded as unmanaged has no checksum to compare, but one recorded with a checksum
+				// whose manifest is now missing is reported: deleting it must not hide changes below
+				difference := EntityDifference{
 					Name:           name,
 					Type:           DiffChecksumMismatch,
 					ExpectedEntity: &entityA,
 					ActualEntity:   &entityB,
+				}
+				if first, count, ok := BadChunks(entityA.Chunking, entityB.Chunking); ok && count > 0 {
+					difference.FirstBadChunk, difference.BadChunkCount = &first, count
+				}
+				differences = append(differences, difference)
+			}
+			if ModeChanged(entityA, entityB) || OwnerChanged(entityA, entityB) {
+				differences = append(differences, EntityDifference{
+					Name:           name,
+					Type:           DiffPermissionMismatch,
+					ExpectedEntity: &entityA,
+					ActualEntity:   &entityB,
+				})
+			}
+			if XattrsChanged(entityA, entityB) {
+				differences = append(differences, EntityDifference{
+					Name:           name,
+					Type:           DiffXattrMismatch,
+					ExpectedEntity: &entityA,
+					ActualEntity:   &entityB,
 				})
 			}
 		}
@@ -91,7 +175,7 @@ func CompareManifests(a, b *Manifest) (bool, []EntityDifference, error) {
 
 	// Check for entities in B but not in A
 	for name, entityB := range entitiesB {
-		if _, exists := entitiesA[name]; !exists {
+		if _, exists := entitiesA[name]; !exists && !mountpointsA[name] {
 			differences = append(differences, EntityDifference{
 				Name:           name,
 				Type:           DiffMissingInA,
@@ -103,3 +187,58 @@ func CompareManifests(a, b *Manifest) (bool, []EntityDifference, error) {
 
 	return len(differences) == 0, differences, nil
 }
+
+// CompareSubtrees returns a DiffSubtreeMismatch difference when a and b record different totals of their trees,
+// nil otherwise. Manifests without totals, e.g. written by older versions, are not compared. The totals change
+// along with the entities, so the difference is not reported by CompareManifests.
+func CompareSubtrees(a, b *Manifest) *EntityDifference {
+	if a == nil || b == nil || a.Subtree == nil || b.Subtree == nil || *a.Subtree == *b.Subtree {
+		return nil
+	}
+	return &EntityDifference{
+		Type:            DiffSubtreeMismatch,
+		ExpectedSubtree: a.Subtree,
+		ActualSubtree:   b.Subtree,
+	}
+}
+
+// ModeChanged returns true if both entities record a mode and the modes differ
+func ModeChanged(a, b Entity) bool {
+	return a.Mode != nil && b.Mode != nil && *a.Mode != *b.Mode
+}
+
+// SizeMismatch returns true if both entities record a size, the sizes differ and one of the entities was not
+// hashed, like the files a fast verification skips. Files hashed on both sides are compared by checksum.
+func SizeMismatch(a, b Entity) bool {
+	if a.Size == nil || b.Size == nil || *a.Size == *b.Size {
+		return false
+	}
+	return a.Unhashed() || b.Unhashed()
+}
+
+// XattrsChanged returns true if both entities record extended attributes and they differ.
+// Entries scanned where extended attributes are not supported are not compared.
+func XattrsChanged(a, b Entity) bool {
+	return a.XattrsDigest != "" && b.XattrsDigest != "" && !SecureEqualHex(a.XattrsDigest, b.XattrsDigest)
+}
+
+// OwnerChanged returns true if both entities record an owner and the owners differ
+func OwnerChanged(a, b Entity) bool {
+	if a.UID == nil || b.UID == nil || a.GID == nil || b.GID == nil {
+		return false
+	}
+	return *a.UID != *b.UID || *a.GID != *b.GID
+}
+
+// entitiesByName maps the entities of m by name. Manifests built by hand may bypass Validate, an entity sharing
+// the name of another is rejected rather than dropped.
+func entitiesByName(m *Manifest) (map[string]Entity, error) {
+	entities := make(map[string]Entity, len(m.Entities))
+	for _, entity := range m.Entities {
+		if _, exists := entities[entity.Name]; exists {
+			return nil, fmt.Errorf("%w: duplicate entity %q", ErrInvalidManifest, entity.Name)
+		}
+		entities[entity.Name] = entity
+	}
+	return entities, nil
+}
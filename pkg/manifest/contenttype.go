@@ -0,0 +1,46 @@
+package manifest
+
+import "fmt"
+
+// Content types recorded in Entity.ContentType besides the MIME types of recognized formats
+const (
+	// ContentTypeEmpty is recorded for empty files
+	ContentTypeEmpty = "inode/x-empty"
+	// ContentTypeZeros is recorded for files whose first bytes are all zeros
+	ContentTypeZeros = "application/octet-stream; zeros=all"
+)
+
+// DescribeContentType returns the content type as shown to users
+func DescribeContentType(contentType string) string {
+	switch contentType {
+	case ContentTypeEmpty:
+		return "empty"
+	case ContentTypeZeros:
+		return "application/octet-stream (all zeros)"
+	case "":
+		return "unknown"
+	default:
+		return contentType
+	}
+}
+
+// ContentTypeChange describes how the content type of a file changed, "" if either entity does not record one
+func ContentTypeChange(expected, actual *Entity) string {
+	if expected == nil || actual == nil || expected.ContentType == "" || actual.ContentType == "" {
+		return ""
+	}
+	if expected.ContentType == actual.ContentType {
+		return fmt.Sprintf("still %s", DescribeContentType(actual.ContentType))
+	}
+	return fmt.Sprintf("was %s, now %s", DescribeContentType(expected.ContentType), DescribeContentType(actual.ContentType))
+}
+
+// LikelyBitRot returns true when a file which had content now starts with zeros or is empty, which is how
+// storage bit-rot and truncated writes usually show, rather than an intended change
+func LikelyBitRot(expected, actual *Entity) bool {
+	if expected == nil || actual == nil || expected.ContentType == "" {
+		return false
+	}
+	lost := actual.ContentType == ContentTypeZeros || actual.ContentType == ContentTypeEmpty
+	return lost && expected.ContentType != actual.ContentType
+}
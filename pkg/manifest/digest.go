@@ -0,0 +1,30 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// RootDigest returns the canonical digest of a manifest: the SHA-256 of its entities,
+// sorted by name and serialized as JSON. HMAC, freshness data and auditor sections are
+// not covered. Because directory entities carry the checksum of their child manifest,
+// the digest of a root manifest commits to the entire tree below it.
+func RootDigest(m *Manifest) (string, error) {
+	if m == nil {
+		return "", fmt.Errorf("cannot compute digest of nil manifest")
+	}
+	entities := make([]Entity, len(m.Entities))
+	copy(entities, m.Entities)
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].Name < entities[j].Name
+	})
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize entities: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
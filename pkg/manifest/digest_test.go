@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRootDigest_IsInvariantToEntityOrder(t *testing.T) {
+	a := &Manifest{Entities: []Entity{{Name: "a.txt", Checksum: "c1"}, {Name: "sub", Checksum: "c2", IsDir: true}}}
+	b := &Manifest{Entities: []Entity{{Name: "sub", Checksum: "c2", IsDir: true}, {Name: "a.txt", Checksum: "c1"}}}
+
+	digestA, err := RootDigest(a)
+	require.NoError(t, err)
+	digestB, err := RootDigest(b)
+	require.NoError(t, err)
+	assert.Equal(t, digestA, digestB)
+	assert.Len(t, digestA, 64)
+	assert.Equal(t, "sub", b.Entities[0].Name, "RootDigest must not reorder the manifest")
+}
+
+func TestRootDigest_IsInvariantToAuditorsAndHMAC(t *testing.T) {
+	m := New([]Entity{{Name: "a.txt", Checksum: "c1"}})
+	before, err := RootDigest(m)
+	require.NoError(t, err)
+
+	m.HMAC = "something-else"
+	_, err = m.AddAuditor(createTestCertificate(t), []byte("signature"), "ed25519")
+	require.NoError(t, err)
+	after, err := RootDigest(m)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestRootDigest_ChangesWithEntities(t *testing.T) {
+	before, err := RootDigest(New([]Entity{{Name: "sub", Checksum: "c1", IsDir: true}}))
+	require.NoError(t, err)
+	after, err := RootDigest(New([]Entity{{Name: "sub", Checksum: "c2", IsDir: true}}))
+	require.NoError(t, err)
+	assert.NotEqual(t, before, after)
+
+	_, err = RootDigest(nil)
+	assert.Error(t, err)
+}
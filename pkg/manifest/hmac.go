@@ -2,22 +2,43 @@ package manifest
 
 import (
 	"crypto/hmac"
+	"crypto/subtle"
 	"encoding/hex"
-	"fmt"
 	"github.com/minio/sha256-simd"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
 	"os"
+	"sync"
 )
 
 var DEFAULT_HMAC_KEY = []byte("this-is-obscurity-key-that")
 var HMAC_KEY_ENV_VAR = "BYTECHECK_HMAC_KEY"
 
+// hmacKeyFromEnvLogged reports the key override once instead of for every manifest
+var hmacKeyFromEnvLogged sync.Once
+
 func calculateHMAC(data []byte) string {
 	hmacKey := DEFAULT_HMAC_KEY
 	if val, exist := os.LookupEnv(HMAC_KEY_ENV_VAR); exist {
 		hmacKey = []byte(val)
-		fmt.Printf("Using HMAC key from environment variable %s\n", HMAC_KEY_ENV_VAR)
+		hmacKeyFromEnvLogged.Do(func() {
+			logging.Logger().Info("using HMAC key from environment variable", "variable", HMAC_KEY_ENV_VAR)
+		})
 	}
 	h := hmac.New(sha256.New, hmacKey)
 	h.Write(data)
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// SecureEqualHex reports whether the hex encoded digests a and b are equal, taking time independent of where they
+// differ. The comparison is case-sensitive, digests are recorded in lowercase, and malformed hex never matches.
+// HMACs, checksums, signatures and keys must be compared with it.
+func SecureEqualHex(a, b string) bool {
+	if _, err := hex.DecodeString(a); err != nil {
+		return false
+	}
+	if _, err := hex.DecodeString(b); err != nil {
+		return false
+	}
+	// Returns 0 right away for different lengths, which leaks only the length of a digest
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
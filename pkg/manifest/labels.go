@@ -0,0 +1,91 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Labels are arbitrary key/value pairs stamped on manifests, e.g. the pipeline that produced a tree.
+// They are covered by the HMAC and by auditor signatures like the entities.
+
+// MaxLabelsSize bounds the total length of the keys and values of the labels of a manifest
+const MaxLabelsSize = 4096
+
+// labelKeyPattern lists the characters of label keys, which start with a letter or a digit
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,127}$`)
+
+// ValidateLabel rejects keys outside of letters, digits, '.', '_', '/' and '-' or longer than 128 bytes,
+// and values that are not valid UTF-8 or hold control characters, which would garble terminal output
+func ValidateLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q: expected up to 128 letters, digits, '.', '_', '/' or '-',"+
+			" starting with a letter or a digit", key)
+	}
+	if !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Errorf("invalid value of label %q: expected printable UTF-8", key)
+	}
+	return nil
+}
+
+// ValidateLabels checks every label with ValidateLabel and their total size against MaxLabelsSize
+func ValidateLabels(labels map[string]string) error {
+	size := 0
+	for _, key := range SortedLabelKeys(labels) {
+		if err := ValidateLabel(key, labels[key]); err != nil {
+			return err
+		}
+		size += len(key) + len(labels[key])
+	}
+	if size > MaxLabelsSize {
+		return fmt.Errorf("labels take %d bytes, more than the limit of %d", size, MaxLabelsSize)
+	}
+	return nil
+}
+
+// ParseLabels parses "key=value" pairs, e.g. given with --label. Duplicate keys are rejected.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label '%s': expected key=value", pair)
+		}
+		if _, exists := labels[key]; exists {
+			return nil, fmt.Errorf("duplicate label key '%s'", key)
+		}
+		labels[key] = value
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// MissingLabels returns the required labels that labels lacks or holds with another value, as sorted
+// "key=value" pairs
+func MissingLabels(labels, required map[string]string) []string {
+	var missing []string
+	for _, key := range SortedLabelKeys(required) {
+		if value, ok := labels[key]; !ok || value != required[key] {
+			missing = append(missing, key+"="+required[key])
+		}
+	}
+	return missing
+}
+
+// SortedLabelKeys returns the keys of labels in ascending order
+func SortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+package manifest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"pipeline=ci-42", "git.commit=0123abc", "dataset/version=v3=final", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pipeline": "ci-42", "git.commit": "0123abc", "dataset/version": "v3=final", "empty": "",
+	}, labels)
+
+	labels, err = ParseLabels(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	for pairs, expected := range map[string]string{
+		"novalue":                       "expected key=value",
+		"a=1,a=2":                       "duplicate label key 'a'",
+		"=value":                        "invalid label key",
+		"-lead=1":                       "invalid label key",
+		"sp ace=1":                      "invalid label key",
+		"key=line\nbreak":               "expected printable UTF-8",
+		"key=\x1b[31mred":               "expected printable UTF-8",
+		"key=\xff":                      "expected printable UTF-8",
+		strings.Repeat("k", 129) + "=1": "invalid label key",
+	} {
+		_, err := ParseLabels(strings.Split(pairs, ","))
+		assert.ErrorContains(t, err, expected, "%q", pairs)
+	}
+}
+
+func TestValidateLabels_mustCapTotalSize(t *testing.T) {
+	labels := map[string]string{"a": strings.Repeat("x", MaxLabelsSize-1)}
+	require.NoError(t, ValidateLabels(labels))
+	labels["b"] = "y"
+	assert.ErrorContains(t, ValidateLabels(labels), "more than the limit")
+}
+
+func TestParse_WithTamperedLabels_mustFailHMAC(t *testing.T) {
+	m := New([]Entity{{Name: "a.txt", Checksum: "00"}})
+	m.Labels = map[string]string{"pipeline": "ci-42"}
+	data, err := m.Encode()
+	require.NoError(t, err)
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, m.Labels, parsed.Labels)
+
+	_, err = Parse(bytes.Replace(data, []byte("ci-42"), []byte("ci-43"), 1))
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+	assert.ErrorContains(t, err, "invalid HMAC")
+}
+
+func TestEncode_WithInvalidLabel_mustFail(t *testing.T) {
+	m := New(nil)
+	m.Labels = map[string]string{"bad key": "value"}
+
+	_, err := m.Encode()
+
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+}
+
+func TestMissingLabels(t *testing.T) {
+	labels := map[string]string{"pipeline": "ci-42", "team": "data"}
+
+	assert.Empty(t, MissingLabels(labels, map[string]string{"pipeline": "ci-42"}))
+	assert.Equal(t, []string{"pipeline=ci-7", "stage=prod"},
+		MissingLabels(labels, map[string]string{"stage": "prod", "pipeline": "ci-7", "team": "data"}))
+	assert.Equal(t, []string{"team=data"}, MissingLabels(nil, map[string]string{"team": "data"}))
+}
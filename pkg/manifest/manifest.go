@@ -1,13 +1,19 @@
 package manifest
 
 import (
-	"crypto/ed25519"
+	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"sort"
+	"slices"
 	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
 )
 
 var DefaultName = ".bytecheck.manifest"
@@ -16,31 +22,81 @@ type Entity struct {
 	Name     string `json:"name"`
 	Checksum string `json:"checksum"`
 	IsDir    bool   `json:"isDir"`
+	// Mode holds Unix-style permission bits, UID and GID the owner.
+	// They are only recorded when permission tracking is enabled.
+	Mode *uint32 `json:"mode,omitempty"`
+	UID  *uint32 `json:"uid,omitempty"`
+	GID  *uint32 `json:"gid,omitempty"`
+	// Special holds the kind of special files, like SpecialFIFO, which are never read.
+	// Their checksum is derived from the kind and the name, see SpecialChecksum.
+	Special string `json:"special,omitempty"`
+	// Empty marks directories whose manifest lists no entities
+	Empty bool `json:"empty,omitempty"`
+	// XattrsDigest commits to the extended attributes of the entry, including POSIX ACLs, see XattrsDigest.
+	// It is only recorded when extended attributes are tracked and the platform and file system support them.
+	XattrsDigest string `json:"xattrs,omitempty"`
+	// SampleChecksum covers the size and the sampled regions of files larger than the sampling threshold,
+	// see Manifest.Sampling. Checksum is empty in manifests computed by a sampled verification.
+	SampleChecksum string `json:"sampleChecksum,omitempty"`
+	// Chunking holds the checksums of the chunks of files larger than one chunk, see Chunking.
+	// It is covered by the HMAC like every other field of the entity.
+	Chunking *Chunking `json:"chunking,omitempty"`
+	// Size holds the size of regular files in bytes. Manifests written by older versions do not record it.
+	Size *int64 `json:"size,omitempty"`
+	// LinkGroup identifies the file of which the entry is one of several hard links, links of the same file
+	// share it. It is only recorded when hard links are tracked, see Manifest.Hardlinks, and only tells links
+	// apart within a tree: the identifiers differ once the tree is copied, while its links stay together.
+	LinkGroup string `json:"linkGroup,omitempty"`
+	// ContentType classifies regular files by their first bytes, e.g. "application/x-gzip", see ContentTypeZeros.
+	// It is only recorded on request and is not compared, it explains checksum mismatches.
+	ContentType string `json:"contentType,omitempty"`
 }
 
-// Certificate defines the interface for any certificate structure.
-type Certificate interface {
-	PublicKey() ed25519.PublicKey
-	Signature() []byte
-	IssuerPublicKey() ed25519.PublicKey
-	IssuerReference() string
-	SignatureAlgorithm() string
+// Kinds of special files recorded in Entity.Special
+const (
+	SpecialFIFO       = "fifo"
+	SpecialSocket     = "socket"
+	SpecialDevice     = "device"
+	SpecialCharDevice = "char-device"
+	SpecialIrregular  = "irregular"
+)
+
+// SpecialChecksum returns the checksum recorded for a special file of the given kind and name
+func SpecialChecksum(kind string, name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte("special:"+kind+":"+name)))
 }
 
-// SimpleCertificate implements Certificate interface
-type SimpleCertificate struct {
-	PubKey       ed25519.PublicKey `json:"-"`
-	Sig          []byte            `json:"-"`
-	IssuerPubKey ed25519.PublicKey `json:"-"`
-	IssuerRef    string            `json:"-"`
-	SigAlgo      string            `json:"-"`
+// Kind describes the type of the entity: "file", "directory" or the kind of special file
+func (e Entity) Kind() string {
+	switch {
+	case e.IsDir:
+		return "directory"
+	case e.Special != "":
+		return e.Special
+	}
+	return "file"
 }
 
-func (c *SimpleCertificate) PublicKey() ed25519.PublicKey       { return c.PubKey }
-func (c *SimpleCertificate) Signature() []byte                  { return c.Sig }
-func (c *SimpleCertificate) IssuerPublicKey() ed25519.PublicKey { return c.IssuerPubKey }
-func (c *SimpleCertificate) IssuerReference() string            { return c.IssuerRef }
-func (c *SimpleCertificate) SignatureAlgorithm() string         { return c.SigAlgo }
+// Unmanaged reports whether the entity is a directory without a manifest, whose checksum is thus unknown,
+// see scanner.WithAllowMissingManifests
+func (e Entity) Unmanaged() bool {
+	return e.IsDir && e.Checksum == ""
+}
+
+// Unhashed reports whether neither checksum of the file was computed, only its size, see Entity.Size
+func (e Entity) Unhashed() bool {
+	return !e.IsDir && e.Special == "" && e.Checksum == "" && e.SampleChecksum == ""
+}
+
+// Certificate is the certificate of a manifest signing key.
+//
+// Deprecated: use signing.Certificate, this alias will be removed in the next release.
+type Certificate = signing.Certificate
+
+// SimpleCertificate implements Certificate.
+//
+// Deprecated: use signing.SimpleCertificate, this alias will be removed in the next release.
+type SimpleCertificate = signing.SimpleCertificate
 
 // CertificateData is the JSON-serializable representation
 type CertificateData struct {
@@ -49,6 +105,12 @@ type CertificateData struct {
 	IssuerPublicKey    string `json:"issuerPublicKey"`
 	IssuerRef          string `json:"issuerReference"`
 	SignatureAlgorithm string `json:"signatureAlgorithm"`
+	// IssuerCertificate is an SSH user certificate of the issuer key, issued by a certificate authority
+	IssuerCertificate string `json:"issuerCertificate,omitempty"`
+	// NotBefore and NotAfter bound the validity of the certificate, see signing.CheckValidity.
+	// They are covered by the issuer's signature and missing from certificates issued without a window.
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
 }
 
 // AuditorData is the JSON-serializable representation
@@ -56,31 +118,122 @@ type AuditorData struct {
 	Timestamp         time.Time       `json:"timestamp"`
 	Certificate       CertificateData `json:"certificate"`
 	ManifestSignature string          `json:"manifestSignature"`
+	// Algorithm of the manifest signature. Empty means ed25519. It is covered by AttributesSignature.
+	Algorithm string `json:"algorithm,omitempty"`
+	// AttributesSignature is made with the certificate key over AttributesData, using the manifest signature
+	// algorithm. Auditors written by older versions lack it, their timestamps and algorithms are not signed.
+	AttributesSignature string `json:"attributesSignature,omitempty"`
 }
 
+// CurrentFormat is the Format of the manifests created by New
+const CurrentFormat = 1
+
 type Manifest struct {
-	Entities []Entity     `json:"entities"`
-	HMAC     string       `json:"hmac"`
-	Auditor  *AuditorData `json:"auditor,omitempty"`
+	Entities []Entity `json:"entities"`
+	HMAC     string   `json:"hmac"`
+	// Format is the version of the manifest format, 0 for manifests written before it was recorded.
+	// It decides what the checksum recorded by the parent directory covers, see UnsignedData. It is covered by the HMAC.
+	Format int `json:"format,omitempty"`
+	// GeneratedAt and Fingerprint are only recorded in embedded freshness mode.
+	// Fingerprint summarizes the directory listing the manifest was computed from, hex encoded.
+	GeneratedAt *time.Time `json:"generatedAt,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	// Subtree holds the totals of the tree below the directory when the manifest was computed.
+	// It is missing when a child manifest does not record totals, e.g. one written by an older version.
+	Subtree *SubtreeTotals `json:"subtree,omitempty"`
+	// Sampling holds the parameters of the sample checksums of the entities, nil if none are recorded.
+	// It is covered by the HMAC, so the sampled regions cannot be moved away from a change.
+	Sampling *Sampling `json:"sampling,omitempty"`
+	// ConfigDigest is the digest of the effective .bytecheck.config of the directory, empty if none applies.
+	// It is covered by the HMAC, so a manifest cannot be made to match a changed config.
+	ConfigDigest string `json:"configDigest,omitempty"`
+	// Labels are key/value pairs given at generation time, e.g. the pipeline producing the tree, see ValidateLabels.
+	// They are covered by the HMAC and by auditor signatures.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Mountpoints lists, sorted, the subdirectories left out of Entities because they are on another file system
+	// than the root of the tree, see scanner.WithOneFileSystem. It is covered by the HMAC.
+	Mountpoints []string `json:"mountpoints,omitempty"`
+	// HiddenPolicy is the scanner.HiddenPolicy the entities were listed with, empty for the default "include".
+	// It is covered by the HMAC, manifests listed with another policy cannot be compared, see IsHidden.
+	HiddenPolicy string `json:"hiddenPolicy,omitempty"`
+	// Hardlinks marks manifests listed while tracking hard links, whose files with several links record their
+	// LinkGroup. It is covered by the HMAC.
+	Hardlinks bool `json:"hardlinks,omitempty"`
+	// GeneratedBy names the tool that wrote the manifest, e.g. "bytecheck v1.2.3 (0123abc)".
+	// It is informational only: the HMAC, signatures and the checksum recorded by the parent exclude it,
+	// so manifests from older versions stay valid and can be co-signed by newer ones.
+	GeneratedBy string        `json:"generatedBy,omitempty"`
+	Auditors    []AuditorData `json:"auditors,omitempty"`
+	// Auditor is the legacy single-auditor section. It is only read for backward
+	// compatibility and is folded into Auditors by LoadManifest.
+	Auditor *AuditorData `json:"auditor,omitempty"`
+}
+
+// SubtreeTotals counts the files, including special files, the directories and the bytes of regular files
+// below a directory. The directory itself is not counted.
+type SubtreeTotals struct {
+	Files       int64 `json:"files"`
+	Directories int64 `json:"directories"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// Add adds the totals of other to t
+func (t *SubtreeTotals) Add(other SubtreeTotals) {
+	t.Files += other.Files
+	t.Directories += other.Directories
+	t.Bytes += other.Bytes
 }
 
-// New creates a new manifest with the given entities
+// New creates a new manifest with the given entities, sorted by name. Should a name repeat, only its first entity
+// is kept.
+// Their names are checked when the manifest is encoded, callers may check them earlier with Validate.
 func New(entities []Entity) *Manifest {
-	sort.Slice(entities, func(i, j int) bool {
-		return entities[i].Name < entities[j].Name
-	})
+	for i := range entities {
+		entities[i].Name = PortableName(entities[i].Name)
+	}
+	sortEntities(entities)
+	// Directory listings never repeat a name, a buggy caller must not produce a manifest Parse rejects
+	entities = slices.CompactFunc(entities, func(a, b Entity) bool { return a.Name == b.Name })
 	return &Manifest{
 		Entities: entities,
+		Format:   CurrentFormat,
 	}
 }
 
-// SetAuditedBy sets the auditor using the Certificate interface
-func (m *Manifest) SetAuditedBy(cert Certificate, manifestSignature []byte) {
+// SetAuditedBy replaces all auditors with a single one using the Certificate interface
+// and returns it. Passing a nil certificate removes all auditors.
+func (m *Manifest) SetAuditedBy(cert signing.Certificate, manifestSignature []byte, algorithm string) *AuditorData {
+	m.Auditor = nil
+	m.Auditors = nil
 	if cert == nil {
-		m.Auditor = nil
-		return
+		return nil
 	}
-	m.Auditor = &AuditorData{
+	m.Auditors = append(m.Auditors, newAuditorData(cert, manifestSignature, algorithm))
+	return &m.Auditors[0]
+}
+
+// ErrDuplicateAuditor is returned by AddAuditor for a manifest already signed with the same issuer public key
+var ErrDuplicateAuditor = errors.New("manifest already signed by this auditor")
+
+// AddAuditor appends a co-signature to the manifest without touching existing ones.
+// The algorithm is the one used to create manifestSignature with the certificate's key.
+// A manifest already carrying an entry made with the same issuer public key is left unchanged and
+// ErrDuplicateAuditor is returned. The stored entry is returned otherwise.
+func (m *Manifest) AddAuditor(cert signing.Certificate, manifestSignature []byte, algorithm string) (*AuditorData, error) {
+	auditor := newAuditorData(cert, manifestSignature, algorithm)
+	for i := range m.Auditors {
+		if SecureEqualHex(m.Auditors[i].Certificate.IssuerPublicKey, auditor.Certificate.IssuerPublicKey) {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateAuditor, m.Auditors[i].Certificate.IssuerRef)
+		}
+	}
+	m.Auditors = append(m.Auditors, auditor)
+	return &m.Auditors[len(m.Auditors)-1], nil
+}
+
+// newAuditorData returns the auditor section of a manifest signed with manifestSignature
+func newAuditorData(cert signing.Certificate, manifestSignature []byte, algorithm string) AuditorData {
+	notBefore, notAfter := signing.CertificateValidity(cert)
+	return AuditorData{
 		Timestamp: time.Now(),
 		Certificate: CertificateData{
 			PublicKey:          hex.EncodeToString(cert.PublicKey()),
@@ -88,80 +241,205 @@ func (m *Manifest) SetAuditedBy(cert Certificate, manifestSignature []byte) {
 			IssuerPublicKey:    hex.EncodeToString(cert.IssuerPublicKey()),
 			IssuerRef:          cert.IssuerReference(),
 			SignatureAlgorithm: cert.SignatureAlgorithm(),
+			IssuerCertificate:  hex.EncodeToString(cert.IssuerCertificate()),
+			NotBefore:          optionalTime(notBefore),
+			NotAfter:           optionalTime(notAfter),
 		},
 		ManifestSignature: hex.EncodeToString(manifestSignature),
+		Algorithm:         algorithm,
 	}
 }
 
-// GetAuditorCertificate returns the auditor's certificate as a Certificate interface
-func (m *Manifest) GetAuditorCertificate() Certificate {
-	if m.Auditor == nil {
+// optionalTime returns nil for the zero time, so that it is left out of the JSON, and t otherwise
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
 		return nil
 	}
+	return &t
+}
+
+// IsAudited reports whether the manifest carries at least one auditor section
+func (m *Manifest) IsAudited() bool {
+	return len(m.Auditors) > 0 || m.Auditor != nil
+}
 
-	pubKey, _ := hex.DecodeString(m.Auditor.Certificate.PublicKey)
-	sig, _ := hex.DecodeString(m.Auditor.Certificate.Signature)
-	issuerPubKey, _ := hex.DecodeString(m.Auditor.Certificate.IssuerPublicKey)
+// ErrMalformedAuditor is wrapped by the errors of auditor sections whose keys or signatures are not valid hex
+var ErrMalformedAuditor = errors.New("malformed auditor data")
 
-	return &SimpleCertificate{
-		PubKey:       pubKey,
-		Sig:          sig,
-		IssuerPubKey: issuerPubKey,
-		IssuerRef:    m.Auditor.Certificate.IssuerRef,
-		SigAlgo:      m.Auditor.Certificate.SignatureAlgorithm,
+// decodeAuditorHex decodes the hex encoded field of an auditor section, see ErrMalformedAuditor. The bytes
+// decoded before malformed hex are returned with the error.
+func decodeAuditorHex(field, value string) ([]byte, error) {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return decoded, fmt.Errorf("%w: %s: %v", ErrMalformedAuditor, field, err)
 	}
+	return decoded, nil
+}
+
+// GetCertificate returns the auditor's certificate as a Certificate interface. Fields that are not valid hex are
+// decoded up to the malformed hex, see DecodeCertificate.
+func (a *AuditorData) GetCertificate() signing.Certificate {
+	cert, _ := a.DecodeCertificate()
+	return cert
 }
 
-// GetAuditorManifestSignature returns the decoded manifest signature
+// DecodeCertificate is like GetCertificate but also returns an error wrapping ErrMalformedAuditor for the first
+// field that is not valid hex, the certificate must not be trusted then.
+func (a *AuditorData) DecodeCertificate() (signing.Certificate, error) {
+	var firstErr error
+	decode := func(field, value string) []byte {
+		decoded, err := decodeAuditorHex(field, value)
+		if firstErr == nil {
+			firstErr = err
+		}
+		return decoded
+	}
+	cert := &signing.SimpleCertificate{
+		PubKey:       decode("certificate public key", a.Certificate.PublicKey),
+		Sig:          decode("certificate signature", a.Certificate.Signature),
+		IssuerPubKey: decode("issuer public key", a.Certificate.IssuerPublicKey),
+		IssuerRef:    a.Certificate.IssuerRef,
+		SigAlgo:      a.Certificate.SignatureAlgorithm,
+		IssuerCert:   decode("issuer certificate", a.Certificate.IssuerCertificate),
+	}
+	if a.Certificate.NotBefore != nil {
+		cert.NotBefore = *a.Certificate.NotBefore
+	}
+	if a.Certificate.NotAfter != nil {
+		cert.NotAfter = *a.Certificate.NotAfter
+	}
+	return cert, firstErr
+}
+
+// GetManifestSignature returns the decoded manifest signature, see DecodeManifestSignature
+func (a *AuditorData) GetManifestSignature() []byte {
+	sig, _ := a.DecodeManifestSignature()
+	return sig
+}
+
+// DecodeManifestSignature is like GetManifestSignature but also returns an error wrapping ErrMalformedAuditor when
+// the signature is not valid hex
+func (a *AuditorData) DecodeManifestSignature() ([]byte, error) {
+	return decodeAuditorHex("manifest signature", a.ManifestSignature)
+}
+
+// GetAuditorCertificate returns the first auditor's certificate as a Certificate interface
+func (m *Manifest) GetAuditorCertificate() signing.Certificate {
+	if len(m.Auditors) == 0 {
+		return nil
+	}
+	return m.Auditors[0].GetCertificate()
+}
+
+// GetAuditorManifestSignature returns the first auditor's decoded manifest signature
 func (m *Manifest) GetAuditorManifestSignature() []byte {
-	if m.Auditor == nil {
+	if len(m.Auditors) == 0 {
 		return nil
 	}
-	sig, _ := hex.DecodeString(m.Auditor.ManifestSignature)
-	return sig
+	return m.Auditors[0].GetManifestSignature()
 }
 
-// LoadManifest loads a manifest from the given directory
+// ErrInvalidManifest is wrapped by the errors of files that cannot be decoded as a manifest or whose HMAC
+// does not match, e.g. corrupted manifests or unrelated files that happen to have the manifest name
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// LoadManifest loads a manifest from the given directory, nil without error when it does not exist
 func LoadManifest(manifestPath string) (*Manifest, error) {
-	data, err := os.ReadFile(manifestPath)
+	return loadManifestFile(os.Open(manifestPath))
+}
+
+// LoadManifestFS is like LoadManifest but reads the manifest named name from fsys
+func LoadManifestFS(fsys fs.FS, name string) (*Manifest, error) {
+	return loadManifestFile(fsys.Open(name))
+}
+
+// LoadManifestFrom reads a manifest from r and parses it, see Parse. It lets manifests held outside of
+// file systems, e.g. in remote stores, be checked exactly like the ones loaded by LoadManifest.
+func LoadManifestFrom(r io.Reader) (*Manifest, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return Parse(data)
+}
+
+// loadManifestFile loads the manifest from the opened file f, nil when it does not exist
+func loadManifestFile(f fs.File, err error) (*Manifest, error) {
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, nil // No manifest exists
 		}
 		return nil, fmt.Errorf("failed to read manifest: %w", err)
 	}
+	defer f.Close()
+	return LoadManifestFrom(f)
+}
 
+// Parse decodes a manifest and checks its HMAC and entity names, see Validate
+func Parse(data []byte) (*Manifest, error) {
 	var m Manifest
 	if err := json.Unmarshal(data, &m); err != nil {
-		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse: %w", ErrInvalidManifest, err)
+	}
+	sortEntities(m.Entities)
+	if m.Auditor != nil {
+		m.Auditors = append([]AuditorData{*m.Auditor}, m.Auditors...)
+		m.Auditor = nil
 	}
-	sort.Slice(m.Entities, func(i, j int) bool {
-		return m.Entities[i].Name < m.Entities[j].Name
-	})
 
+	// The HMAC is defined over sorted entities with distinct names, which Validate checks first
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
 	loadedHMAC := m.HMAC
-	err = m.calculateHMAC()
+	err := m.calculateHMAC()
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate HMAC: %w", err)
 	}
-	if loadedHMAC != m.HMAC {
-		return nil, fmt.Errorf("invalid HMAC")
+	if !SecureEqualHex(loadedHMAC, m.HMAC) {
+		return nil, fmt.Errorf("%w: invalid HMAC", ErrInvalidManifest)
 	}
 
 	return &m, nil
 }
 
-// Save saves the manifest to the given directory
+// Save saves the manifest to the given directory. The manifest is encoded before the file is opened, so that
+// a manifest failing to encode leaves the existing file untouched.
 func (m *Manifest) Save(manifestPath string) error {
+	data, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, data, 0644)
+}
+
+// WriteTo implements io.WriterTo, it writes the manifest to w as Save stores it, see Encode
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	data, err := m.Encode()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Encode updates the HMAC and returns the manifest as stored by Save, see Parse.
+// Manifests with unsafe entity names are rejected, see Validate.
+// The encoding is canonical: entities sorted by name and two-space indentation, so equal manifests are
+// stored byte for byte identical.
+func (m *Manifest) Encode() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	sortEntities(m.Entities)
 	if err := m.calculateHMAC(); err != nil {
-		return fmt.Errorf("failed to calculate HMAC: %w", err)
+		return nil, fmt.Errorf("failed to calculate HMAC: %w", err)
 	}
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal manifest: %w", err)
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
 	}
-
-	return os.WriteFile(manifestPath, data, 0644)
+	return data, nil
 }
 
 // Touch updates the manifest file's modification time without changing content
@@ -179,33 +457,122 @@ func GetModTime(manifestPath string) (time.Time, error) {
 	return info.ModTime(), nil
 }
 
+// LoadManifestIfFresh loads the manifest at manifestPath if it was modified within freshnessLimit,
+// nil without error otherwise or when freshnessLimit is nil
 func LoadManifestIfFresh(manifestPath string, freshnessLimit *time.Duration) (*Manifest, error) {
+	return LoadManifestIfFreshFrom(freshnessLimit, func() (time.Time, error) { return GetModTime(manifestPath) },
+		func() (*Manifest, error) { return LoadManifest(manifestPath) })
+}
+
+// LoadManifestIfFreshFS is like LoadManifestIfFresh but reads the manifest named name from fsys
+func LoadManifestIfFreshFS(fsys fs.FS, name string, freshnessLimit *time.Duration) (*Manifest, error) {
+	return LoadManifestIfFreshFrom(freshnessLimit, modTimeFS(fsys, name),
+		func() (*Manifest, error) { return LoadManifestFS(fsys, name) })
+}
+
+// ModTimeFunc returns the modification time of a manifest, an error wrapping fs.ErrNotExist when there is none
+type ModTimeFunc func() (time.Time, error)
+
+// modTimeFS returns the ModTimeFunc of the file named name in fsys
+func modTimeFS(fsys fs.FS, name string) ModTimeFunc {
+	return func() (time.Time, error) {
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return info.ModTime(), nil
+	}
+}
+
+// LoadManifestIfFreshFrom is like LoadManifestIfFresh for manifests of any backend: modTime tells when the
+// manifest was modified and load loads it, e.g. with LoadManifestFrom, only once it is known to be fresh
+func LoadManifestIfFreshFrom(freshnessLimit *time.Duration, modTime ModTimeFunc, load func() (*Manifest, error)) (*Manifest, error) {
 	if freshnessLimit == nil {
 		return nil, nil
 	}
 
-	modTime, err := GetModTime(manifestPath)
+	modified, err := modTime()
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, fs.ErrNotExist) {
 			return nil, nil // No manifest exists
 		}
 		return nil, err
 	}
-	age := time.Since(modTime)
-	if age > *freshnessLimit {
+	// A modification time in the future means clock skew or tampering, such a manifest is never fresh
+	age := time.Since(modified)
+	if age < 0 || age > *freshnessLimit {
 		return nil, nil
 	}
-	m, err := LoadManifest(manifestPath)
-	if err != nil {
+	return load()
+}
+
+// LoadManifestIfFreshEmbedded loads the manifest if its embedded generation time is within
+// the freshness limit and its embedded fingerprint matches the given one, both hex encoded, see SecureEqualHex.
+// The manifest file's own modification time is not taken into account.
+func LoadManifestIfFreshEmbedded(manifestPath string, freshnessLimit *time.Duration, fingerprint string) (*Manifest, error) {
+	return loadManifestIfFreshEmbedded(freshnessLimit, fingerprint,
+		func() (*Manifest, error) { return LoadManifest(manifestPath) })
+}
+
+// LoadManifestIfFreshEmbeddedFS is like LoadManifestIfFreshEmbedded but reads the manifest named name from fsys
+func LoadManifestIfFreshEmbeddedFS(fsys fs.FS, name string, freshnessLimit *time.Duration, fingerprint string) (*Manifest, error) {
+	return loadManifestIfFreshEmbedded(freshnessLimit, fingerprint,
+		func() (*Manifest, error) { return LoadManifestFS(fsys, name) })
+}
+
+func loadManifestIfFreshEmbedded(freshnessLimit *time.Duration, fingerprint string, load func() (*Manifest, error)) (*Manifest, error) {
+	if freshnessLimit == nil {
+		return nil, nil
+	}
+
+	m, err := load()
+	if err != nil || m == nil {
 		return nil, err
 	}
+	if m.GeneratedAt == nil || m.Fingerprint == "" || !SecureEqualHex(m.Fingerprint, fingerprint) {
+		return nil, nil
+	}
+	if age := time.Since(*m.GeneratedAt); age < 0 || age > *freshnessLimit {
+		return nil, nil
+	}
 	return m, nil
 }
 
+// HasPermissions returns true if any entity records permission data
+func (m *Manifest) HasPermissions() bool {
+	for _, entity := range m.Entities {
+		if entity.Mode != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasXattrs reports whether any entity records extended attributes, see Entity.XattrsDigest
+func (m *Manifest) HasXattrs() bool {
+	for _, entity := range m.Entities {
+		if entity.XattrsDigest != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // calculateHMAC computes HMAC for the manifest (excluding the HMAC field itself)
 func (m *Manifest) calculateHMAC() error {
 	manifestCopy := &Manifest{
-		Entities: m.Entities,
+		Entities:    m.Entities,
+		Format:      m.Format,
+		GeneratedAt: m.GeneratedAt,
+		Fingerprint: m.Fingerprint,
+		Subtree:     m.Subtree,
+		Sampling:    m.Sampling,
+		// Empty for manifests without config, so that their HMAC does not change
+		ConfigDigest: m.ConfigDigest,
+		Labels:       m.Labels,
+		Mountpoints:  m.Mountpoints,
+		HiddenPolicy: m.HiddenPolicy,
+		Hardlinks:    m.Hardlinks,
 		// HMAC field is omitted
 	}
 
@@ -226,5 +593,78 @@ func (m *Manifest) DataWithoutAuditor() ([]byte, error) {
 	}
 	manifestCopy := *m
 	manifestCopy.Auditor = nil
+	manifestCopy.Auditors = nil
+	manifestCopy.GeneratedBy = ""
 	return json.Marshal(&manifestCopy)
 }
+
+// signedAttributes are the fields of an auditor section covered by AttributesData
+type signedAttributes struct {
+	Timestamp time.Time `json:"timestamp"`
+	Algorithm string    `json:"algorithm"`
+}
+
+// AttributesData returns the data signed for the timestamp and the signature algorithm of an auditor: the signed
+// manifest data followed by both, which binds them to this manifest. The manifest signature cannot cover them,
+// it is made before they are recorded and co-signing must not change the data other auditors signed.
+func (m *Manifest) AttributesData(timestamp time.Time, algorithm string) ([]byte, error) {
+	data, err := m.DataWithoutAuditor()
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := json.Marshal(signedAttributes{Timestamp: timestamp.UTC(), Algorithm: algorithm})
+	if err != nil {
+		return nil, err
+	}
+	return append(append(data, '\n'), attributes...), nil
+}
+
+// UnsignedContent returns the data whose checksum the parent directory records for the manifest once saved,
+// see UnsignedData
+func (m *Manifest) UnsignedContent() ([]byte, error) {
+	manifestCopy := *m
+	data, err := manifestCopy.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return UnsignedData(data), nil
+}
+
+// unsignedFields are the top-level fields UnsignedData leaves out
+var unsignedFields = []string{"auditor", "auditors", "generatedBy"}
+
+// UnsignedData returns the part of the stored manifest data covered by the checksum the parent directory records.
+// From format 1 on, the auditor sections and GeneratedBy are left out, so that co-signing a manifest does not
+// invalidate its parent: the rest is encoded like Encode stores it, so that the data of an unsigned manifest
+// saved by this version is covered as is. Data with top-level fields unknown to this version keeps them, encoded
+// compactly and sorted by name. Manifests of format 0, as written by older versions, and data that does not
+// decode as a manifest are covered byte for byte, as older versions did.
+func UnsignedData(data []byte) []byte {
+	var header struct {
+		Format int `json:"format"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil || header.Format < 1 {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var m Manifest
+	if err := decoder.Decode(&m); err == nil {
+		m.Auditor, m.Auditors, m.GeneratedBy = nil, nil, ""
+		if unsigned, err := json.MarshalIndent(&m, "", "  "); err == nil {
+			return unsigned
+		}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	for _, name := range unsignedFields {
+		delete(fields, name)
+	}
+	unsigned, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return unsigned
+}
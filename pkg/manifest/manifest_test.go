@@ -1,26 +1,30 @@
 package manifest
 
 import (
+	"bytes"
 	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
 )
 
 // createTestCertificate is a helper function to create a new Certificate for testing.
-func createTestCertificate(t *testing.T) Certificate {
+func createTestCertificate(t *testing.T) signing.Certificate {
 	pubKey, privKey, err := ed25519.GenerateKey(nil)
 	require.NoError(t, err, "Failed to generate key pair")
 
 	signature := ed25519.Sign(privKey, pubKey)
 
-	return &SimpleCertificate{
+	return &signing.SimpleCertificate{
 		PubKey:       pubKey,
 		Sig:          signature,
 		IssuerPubKey: pubKey, // Self-signed for testing
@@ -41,22 +45,13 @@ func TestNew(t *testing.T) {
 	assert.Equal(t, "file1.txt", manifest.Entities[0].Name)
 	assert.Equal(t, "file2.txt", manifest.Entities[1].Name)
 	assert.Empty(t, manifest.HMAC, "HMAC should be empty for a new manifest")
-	assert.Nil(t, manifest.Auditor, "Auditor should be nil for a new manifest")
+	assert.Empty(t, manifest.Auditors, "Auditors should be empty for a new manifest")
 }
 
-func TestSimpleCertificate_Interface(t *testing.T) {
-	cert := createTestCertificate(t)
-	require.NotNil(t, cert)
-
-	assert.Implements(t, (*Certificate)(nil), cert)
-
-	simpleCert, ok := cert.(*SimpleCertificate)
-	require.True(t, ok)
-
-	assert.True(t, cert.PublicKey().Equal(simpleCert.PubKey))
-	assert.Equal(t, simpleCert.Sig, cert.Signature())
-	assert.True(t, cert.IssuerPublicKey().Equal(simpleCert.IssuerPubKey))
-	assert.Equal(t, "test-issuer", cert.IssuerReference())
+func TestDeprecatedCertificateAliases_AreSigningTypes(t *testing.T) {
+	var cert Certificate = &SimpleCertificate{IssuerRef: "test-issuer"}
+	_, ok := cert.(*signing.SimpleCertificate)
+	assert.True(t, ok)
 }
 
 func TestManifest_AuditorFlow(t *testing.T) {
@@ -70,14 +65,15 @@ func TestManifest_AuditorFlow(t *testing.T) {
 	cert := createTestCertificate(t)
 	manifestSignature := []byte("test-signature")
 	beforeTime := time.Now()
-	manifest.SetAuditedBy(cert, manifestSignature)
+	manifest.SetAuditedBy(cert, manifestSignature, "ed25519")
 	afterTime := time.Now()
 
-	// 3. Verify Auditor field
-	auditor := manifest.Auditor
-	require.NotNil(t, auditor)
+	// 3. Verify Auditors field
+	require.Len(t, manifest.Auditors, 1)
+	auditor := manifest.Auditors[0]
 	assert.WithinDuration(t, beforeTime, auditor.Timestamp, afterTime.Sub(beforeTime))
 	assert.Equal(t, hex.EncodeToString(manifestSignature), auditor.ManifestSignature)
+	assert.Equal(t, "ed25519", auditor.Algorithm)
 
 	// 4. Verify CertificateData within Auditor
 	certData := auditor.Certificate
@@ -99,8 +95,86 @@ func TestManifest_AuditorFlow(t *testing.T) {
 	assert.Equal(t, manifestSignature, retrievedSig)
 
 	// 7. Unset the auditor
-	manifest.SetAuditedBy(nil, nil)
-	assert.Nil(t, manifest.Auditor)
+	manifest.SetAuditedBy(nil, nil, "")
+	assert.Empty(t, manifest.Auditors)
+	assert.False(t, manifest.IsAudited())
+}
+
+func TestManifest_AddAuditor_keepsExistingAuditors(t *testing.T) {
+	manifest := New([]Entity{{Name: "test.txt", Checksum: "abc123"}})
+	first := createTestCertificate(t)
+	second := createTestCertificate(t)
+
+	manifest.SetAuditedBy(first, []byte("sig1"), "ed25519")
+	_, err := manifest.AddAuditor(second, []byte("sig2"), "ed25519")
+	require.NoError(t, err)
+	require.Len(t, manifest.Auditors, 2)
+	assert.Equal(t, hex.EncodeToString([]byte("sig1")), manifest.Auditors[0].ManifestSignature)
+	assert.Equal(t, hex.EncodeToString([]byte("sig2")), manifest.Auditors[1].ManifestSignature)
+
+	// Signing again with the same issuer key is refused, the existing entry is kept
+	_, err = manifest.AddAuditor(second, []byte("sig3"), "ed25519")
+	assert.ErrorIs(t, err, ErrDuplicateAuditor)
+	require.Len(t, manifest.Auditors, 2)
+	assert.Equal(t, hex.EncodeToString([]byte("sig2")), manifest.Auditors[1].ManifestSignature)
+}
+
+func TestLoadManifest_LegacyAuditorField(t *testing.T) {
+	tempDir := t.TempDir()
+	manifestPath := filepath.Join(tempDir, DefaultName)
+
+	legacy := New([]Entity{{Name: "file.txt", Checksum: "checksum123"}})
+	legacy.SetAuditedBy(createTestCertificate(t), []byte("sig"), "ed25519")
+	legacy.Auditor = &legacy.Auditors[0]
+	legacy.Auditors = nil
+	require.NoError(t, legacy.Save(manifestPath))
+
+	loaded, err := LoadManifest(manifestPath)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Nil(t, loaded.Auditor)
+	require.Len(t, loaded.Auditors, 1)
+	assert.Equal(t, hex.EncodeToString([]byte("sig")), loaded.Auditors[0].ManifestSignature)
+}
+
+func TestManifest_UnsignedContent_matchesSavedUnsignedManifest(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	manifest := New([]Entity{{Name: "file.txt", Checksum: "checksum123"}})
+	require.NoError(t, manifest.Save(manifestPath))
+	saved, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+
+	manifest.SetAuditedBy(createTestCertificate(t), []byte("sig"), "ed25519")
+	content, err := manifest.UnsignedContent()
+	require.NoError(t, err)
+	assert.Equal(t, string(saved), string(content))
+}
+
+func TestUnsignedData_WithLegacyManifest_mustKeepStoredBytes(t *testing.T) {
+	// Parents of manifests written before formats were recorded checksum them byte for byte, auditors included
+	legacy := []byte(`{"entities":[],"hmac":"00","auditor":{"manifestSignature":"01"}}` + "\n")
+	assert.Equal(t, legacy, UnsignedData(legacy))
+	invalid := []byte("not a manifest")
+	assert.Equal(t, invalid, UnsignedData(invalid))
+}
+
+func TestUnsignedData_WithUnknownFields_mustKeepThem(t *testing.T) {
+	data := []byte(`{"hmac": "00", "format": 1, "future": {"b": 1, "a": 2}, "auditors": [], "generatedBy": "x"}`)
+	assert.Equal(t, `{"format":1,"future":{"b":1,"a":2},"hmac":"00"}`, string(UnsignedData(data)))
+}
+
+func TestManifest_Encode_isCanonical(t *testing.T) {
+	sorted := New([]Entity{{Name: "a.txt", Checksum: "1"}, {Name: "b", Checksum: "2", IsDir: true}, {Name: "c.txt", Checksum: "3"}})
+	shuffled := New([]Entity{{Name: "c.txt", Checksum: "3"}, {Name: "a.txt", Checksum: "1"}, {Name: "b", Checksum: "2", IsDir: true}})
+
+	want, err := sorted.Encode()
+	require.NoError(t, err)
+	got, err := shuffled.Encode()
+	require.NoError(t, err)
+
+	assert.Equal(t, string(want), string(got))
+	assert.True(t, strings.HasSuffix(string(got), "\n}"))
+	assert.Contains(t, string(got), "\n  \"entities\": [\n")
 }
 
 func TestManifest_SaveAndLoad(t *testing.T) {
@@ -109,7 +183,7 @@ func TestManifest_SaveAndLoad(t *testing.T) {
 
 	manifest := New([]Entity{{Name: "file.txt", Checksum: "checksum123"}})
 	cert := createTestCertificate(t)
-	manifest.SetAuditedBy(cert, []byte("sig"))
+	manifest.SetAuditedBy(cert, []byte("sig"), "ed25519")
 
 	// Save the manifest
 	err := manifest.Save(manifestPath)
@@ -126,9 +200,9 @@ func TestManifest_SaveAndLoad(t *testing.T) {
 	// Verify loaded content matches original
 	assert.Equal(t, originalHMAC, loadedManifest.HMAC)
 	assert.Equal(t, manifest.Entities, loadedManifest.Entities)
-	require.NotNil(t, loadedManifest.Auditor)
-	assert.Equal(t, manifest.Auditor.Timestamp.Unix(), loadedManifest.Auditor.Timestamp.Unix())
-	assert.Equal(t, manifest.Auditor.ManifestSignature, loadedManifest.Auditor.ManifestSignature)
+	require.Len(t, loadedManifest.Auditors, 1)
+	assert.Equal(t, manifest.Auditors[0].Timestamp.Unix(), loadedManifest.Auditors[0].Timestamp.Unix())
+	assert.Equal(t, manifest.Auditors[0].ManifestSignature, loadedManifest.Auditors[0].ManifestSignature)
 
 	loadedCert := loadedManifest.GetAuditorCertificate()
 	require.NotNil(t, loadedCert)
@@ -161,7 +235,7 @@ func TestLoadManifest_NotExist(t *testing.T) {
 
 func TestManifest_DataWithoutAuditor(t *testing.T) {
 	manifest := New([]Entity{{Name: "f"}})
-	manifest.SetAuditedBy(createTestCertificate(t), []byte("sig"))
+	manifest.SetAuditedBy(createTestCertificate(t), []byte("sig"), "ed25519")
 
 	data, err := manifest.DataWithoutAuditor()
 	require.NoError(t, err)
@@ -174,6 +248,8 @@ func TestManifest_DataWithoutAuditor(t *testing.T) {
 	assert.NotNil(t, untyped["entities"])
 	_, hasAuditor := untyped["auditor"]
 	assert.False(t, hasAuditor)
+	_, hasAuditors := untyped["auditors"]
+	assert.False(t, hasAuditors)
 }
 
 func TestLoadManifestIfFresh(t *testing.T) {
@@ -204,3 +280,430 @@ func TestLoadManifestIfFresh(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, nilLimitManifest)
 }
+
+func TestManifest_WriteTo_mustMatchSavedFileByteForByte(t *testing.T) {
+	m := New([]Entity{{Name: "b.txt", Checksum: "2"}, {Name: "a", Checksum: "1", IsDir: true}})
+	m.Labels = map[string]string{"pipeline": "nightly"}
+	m.SetAuditedBy(createTestCertificate(t), []byte("sig"), "ed25519")
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	require.NoError(t, m.Save(manifestPath))
+	saved, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(saved)), n)
+	assert.Equal(t, string(saved), buf.String())
+
+	fromReader, err := LoadManifestFrom(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	fromFile, err := LoadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, fromFile, fromReader)
+
+	// Loading and writing again reproduces the same bytes
+	buf.Reset()
+	_, err = fromReader.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, string(saved), buf.String())
+}
+
+func TestLoadManifestFrom_WithTamperedData_mustFail(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New([]Entity{{Name: "file.txt", Checksum: "1"}}).WriteTo(&buf)
+	require.NoError(t, err)
+	tampered := strings.Replace(buf.String(), `"checksum": "1"`, `"checksum": "2"`, 1)
+
+	_, err = LoadManifestFrom(strings.NewReader(tampered))
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+	_, err = LoadManifestFrom(strings.NewReader("not json"))
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+}
+
+func TestManifest_WriteTo_WithHostileName_mustWriteNothing(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New([]Entity{{Name: "../escape"}}).WriteTo(&buf)
+	assert.Error(t, err)
+	assert.Zero(t, buf.Len())
+}
+
+func TestLoadManifestIfFreshFrom_mustUseModTimeProvider(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(nil).WriteTo(&buf)
+	require.NoError(t, err)
+	loads := 0
+	load := func() (*Manifest, error) {
+		loads++
+		return LoadManifestFrom(bytes.NewReader(buf.Bytes()))
+	}
+	modifiedAt := func(modTime time.Time) ModTimeFunc {
+		return func() (time.Time, error) { return modTime, nil }
+	}
+	limit := time.Hour
+
+	m, err := LoadManifestIfFreshFrom(&limit, modifiedAt(time.Now().Add(-time.Minute)), load)
+	require.NoError(t, err)
+	assert.NotNil(t, m)
+
+	for _, modTime := range []time.Time{time.Now().Add(-2 * time.Hour), time.Now().Add(time.Hour)} {
+		m, err = LoadManifestIfFreshFrom(&limit, modifiedAt(modTime), load)
+		require.NoError(t, err)
+		assert.Nil(t, m, "stale or future manifests are not fresh")
+	}
+	m, err = LoadManifestIfFreshFrom(&limit, func() (time.Time, error) { return time.Time{}, fs.ErrNotExist }, load)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+	m, err = LoadManifestIfFreshFrom(nil, modifiedAt(time.Now()), load)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+	assert.Equal(t, 1, loads, "only fresh manifests are loaded")
+}
+
+func TestLoadManifestIfFreshEmbedded(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	limit := time.Hour
+
+	// Manifests without embedded data are never fresh
+	require.NoError(t, New(nil).Save(manifestPath))
+	m, err := LoadManifestIfFreshEmbedded(manifestPath, &limit, "0f")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	generatedAt := time.Now().Add(-time.Minute)
+	embedded := New(nil)
+	embedded.GeneratedAt = &generatedAt
+	embedded.Fingerprint = "0f"
+	require.NoError(t, embedded.Save(manifestPath))
+
+	m, err = LoadManifestIfFreshEmbedded(manifestPath, &limit, "0f")
+	require.NoError(t, err)
+	assert.NotNil(t, m)
+
+	m, err = LoadManifestIfFreshEmbedded(manifestPath, &limit, "f0")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	shortLimit := time.Second
+	m, err = LoadManifestIfFreshEmbedded(manifestPath, &shortLimit, "0f")
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestLoadManifest_EmbeddedFreshnessDataIsCoveredByHMAC(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	generatedAt := time.Now()
+	m := New([]Entity{{Name: "f"}})
+	m.GeneratedAt = &generatedAt
+	m.Fingerprint = "0f"
+	require.NoError(t, m.Save(manifestPath))
+
+	m.Fingerprint = "tampered"
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestPath, data, 0644))
+
+	_, err = LoadManifest(manifestPath)
+	assert.ErrorContains(t, err, "invalid HMAC")
+}
+
+func TestLoadManifest_SubtreeTotalsAreCoveredByHMAC(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	m := New([]Entity{{Name: "f"}})
+	m.Subtree = &SubtreeTotals{Files: 1, Bytes: 10}
+	require.NoError(t, m.Save(manifestPath))
+
+	m.Subtree.Bytes = 1 << 30
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(manifestPath, data, 0644))
+
+	_, err = LoadManifest(manifestPath)
+	assert.ErrorContains(t, err, "invalid HMAC")
+}
+
+func TestCompareSubtrees_IsNotCountedAsDifference(t *testing.T) {
+	a := New([]Entity{{Name: "a.txt", Checksum: "c1"}})
+	a.Subtree = &SubtreeTotals{Files: 1, Bytes: 10}
+	b := New([]Entity{{Name: "a.txt", Checksum: "c2"}})
+	b.Subtree = &SubtreeTotals{Files: 1, Bytes: 12}
+
+	identical, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	assert.False(t, identical)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffChecksumMismatch, differences[0].Type)
+
+	subtree := CompareSubtrees(a, b)
+	require.NotNil(t, subtree)
+	assert.Equal(t, DiffSubtreeMismatch, subtree.Type)
+	assert.Equal(t, a.Subtree, subtree.ExpectedSubtree)
+	assert.Equal(t, b.Subtree, subtree.ActualSubtree)
+
+	// Manifests without totals, e.g. from older versions, are compared by entities only
+	b.Subtree = nil
+	assert.Nil(t, CompareSubtrees(a, b))
+}
+
+func TestCompareManifests_PermissionMismatch(t *testing.T) {
+	mode := func(v uint32) *uint32 { return &v }
+	a := New([]Entity{{Name: "run.sh", Checksum: "c1", Mode: mode(0o644), UID: mode(1000), GID: mode(1000)}})
+	b := New([]Entity{{Name: "run.sh", Checksum: "c1", Mode: mode(0o755), UID: mode(0), GID: mode(0)}})
+
+	identical, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	assert.False(t, identical)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffPermissionMismatch, differences[0].Type)
+	assert.True(t, ModeChanged(*differences[0].ExpectedEntity, *differences[0].ActualEntity))
+	assert.True(t, OwnerChanged(*differences[0].ExpectedEntity, *differences[0].ActualEntity))
+}
+
+func TestCompareManifests_FileReplacedByFIFO_IsTypeMismatch(t *testing.T) {
+	a := New([]Entity{{Name: "pipe", Checksum: "c1"}})
+	b := New([]Entity{{Name: "pipe", Checksum: SpecialChecksum(SpecialFIFO, "pipe"), Special: SpecialFIFO}})
+
+	identical, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	assert.False(t, identical)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffTypeMismatch, differences[0].Type)
+	assert.Equal(t, "file", differences[0].ExpectedEntity.Kind())
+	assert.Equal(t, "fifo", differences[0].ActualEntity.Kind())
+	assert.NotEqual(t, SpecialChecksum(SpecialFIFO, "pipe"), SpecialChecksum(SpecialSocket, "pipe"))
+}
+
+func TestCompareManifests_WithoutPermissionData_mustNotReportPermissions(t *testing.T) {
+	mode := uint32(0o755)
+	a := New([]Entity{{Name: "run.sh", Checksum: "c1"}})
+	b := New([]Entity{{Name: "run.sh", Checksum: "c1", Mode: &mode}})
+
+	identical, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	assert.True(t, identical)
+	assert.Empty(t, differences)
+	assert.False(t, a.HasPermissions())
+	assert.True(t, b.HasPermissions())
+}
+
+func TestCompareManifests_SizeMismatch_OnlyForUnhashedFiles(t *testing.T) {
+	size := func(v int64) *int64 { return &v }
+	a := New([]Entity{{Name: "big.bin", Checksum: "c1", Size: size(100)}, {Name: "old.bin", Checksum: "c2"}})
+	b := New([]Entity{{Name: "big.bin", Size: size(200)}, {Name: "old.bin", Size: size(50)}})
+
+	_, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	require.Len(t, differences, 2)
+	byName := map[string]DifferenceType{differences[0].Name: differences[0].Type, differences[1].Name: differences[1].Type}
+	assert.Equal(t, DiffSizeMismatch, byName["big.bin"])
+	// Manifests without sizes, e.g. from older versions, are compared by checksum
+	assert.Equal(t, DiffChecksumMismatch, byName["old.bin"])
+
+	// Files hashed on both sides are reported with their checksums
+	b.Entities[0].Checksum = "c3"
+	_, differences, err = CompareManifests(a, b)
+	require.NoError(t, err)
+	for _, difference := range differences {
+		assert.Equal(t, DiffChecksumMismatch, difference.Type, difference.Name)
+	}
+	assert.Equal(t, "size_mismatch", DiffSizeMismatch.String())
+}
+
+func TestCompareManifests_WithMountpoints_mustNotReportThem(t *testing.T) {
+	a := New([]Entity{{Name: "a.txt", Checksum: "c1"}, {Name: "nfs", Checksum: "c2", IsDir: true}})
+	b := New([]Entity{{Name: "a.txt", Checksum: "c1"}})
+	b.Mountpoints = []string{"nfs"}
+
+	// A directory which became a mountpoint is not missing, nor is one which stopped being a mountpoint new
+	identical, differences, err := CompareManifests(a, b)
+	require.NoError(t, err)
+	assert.True(t, identical, differences)
+	identical, differences, err = CompareManifests(b, a)
+	require.NoError(t, err)
+	assert.True(t, identical, differences)
+
+	b.Mountpoints = nil
+	_, differences, err = CompareManifests(a, b)
+	require.NoError(t, err)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffMissingInB, differences[0].Type)
+}
+
+func TestCompareManifests_WithUnmanagedDirectory_mustCompareRecordedChecksum(t *testing.T) {
+	recorded := New([]Entity{{Name: "sub", Checksum: "c1", IsDir: true}})
+	unmanaged := New([]Entity{{Name: "sub", IsDir: true}})
+
+	// A directory recorded with a checksum whose manifest is now missing is reported
+	_, differences, err := CompareManifests(recorded, unmanaged)
+	require.NoError(t, err)
+	require.Len(t, differences, 1)
+	assert.Equal(t, DiffChecksumMismatch, differences[0].Type)
+
+	// One recorded as unmanaged has no checksum to compare
+	identical, differences, err := CompareManifests(unmanaged, recorded)
+	require.NoError(t, err)
+	assert.True(t, identical, differences)
+}
+
+func TestEntity_JSON_WithInvalidUTF8Name_mustKeepExactBytes(t *testing.T) {
+	m := New([]Entity{{Name: "plain\n\tname", Checksum: "c1"}, {Name: "bad-\xff", Checksum: "c2"}, {Name: "bad-\xfe", Checksum: "c3"}})
+	data, err := m.Encode()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"name": "plain\n\tname"`)
+	assert.Contains(t, string(data), `"nameEncoding": "base64"`)
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, m.Entities, parsed.Entities)
+	identical, _, err := CompareManifests(m, parsed)
+	require.NoError(t, err)
+	assert.True(t, identical)
+
+	// Names that are valid UTF-8 encode like before, so existing HMACs stay valid
+	entity, err := json.Marshal(Entity{Name: "a.txt", Checksum: "c1"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"name":"a.txt","checksum":"c1","isDir":false}`, string(entity))
+
+	var decoded Entity
+	assert.ErrorContains(t, json.Unmarshal([]byte(`{"name":"a","nameEncoding":"rot13"}`), &decoded), "unsupported name encoding")
+}
+
+func TestLoadManifestIfFresh_WithFutureModTime_IsStale(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	require.NoError(t, New(nil).Save(manifestPath))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(manifestPath, future, future))
+
+	limit := 24 * time.Hour
+	m, err := LoadManifestIfFresh(manifestPath, &limit)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestLoadManifestIfFreshEmbedded_WithFutureGenerationTime_IsStale(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	generatedAt := time.Now().Add(time.Hour)
+	m := New(nil)
+	m.GeneratedAt = &generatedAt
+	m.Fingerprint = "0f"
+	require.NoError(t, m.Save(manifestPath))
+
+	limit := 24 * time.Hour
+	loaded, err := LoadManifestIfFreshEmbedded(manifestPath, &limit, "0f")
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+}
+
+func TestManifest_GeneratedByIsInformational(t *testing.T) {
+	m := New([]Entity{{Name: "a.txt", Checksum: "abc"}})
+	data, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	content, err := m.UnsignedContent()
+	require.NoError(t, err)
+	hmac := m.HMAC
+
+	m.GeneratedBy = "bytecheck v1.2.3 (0123abc)"
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	require.NoError(t, m.Save(manifestPath))
+	assert.Equal(t, hmac, m.HMAC)
+	dataWithGeneratedBy, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	assert.Equal(t, data, dataWithGeneratedBy)
+	contentWithGeneratedBy, err := m.UnsignedContent()
+	require.NoError(t, err)
+	assert.Equal(t, content, contentWithGeneratedBy)
+
+	loaded, err := LoadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Equal(t, "bytecheck v1.2.3 (0123abc)", loaded.GeneratedBy)
+}
+
+func TestSecureEqualHex(t *testing.T) {
+	assert.True(t, SecureEqualHex("00ff", "00ff"))
+	assert.False(t, SecureEqualHex("00ff", "00FF"), "digests are compared case-sensitively")
+	assert.True(t, SecureEqualHex("", ""))
+	assert.False(t, SecureEqualHex("00ff", "00fe"))
+	assert.False(t, SecureEqualHex("00ff", "00ff00"))
+	assert.False(t, SecureEqualHex("00ff", ""))
+	assert.False(t, SecureEqualHex("zz", "zz"))
+	assert.False(t, SecureEqualHex("0", "0"))
+}
+
+func TestAuditorData_WithMalformedHex_ReturnsMalformedAuditorError(t *testing.T) {
+	m := New([]Entity{{Name: "test.txt", Checksum: "abc123"}})
+	m.SetAuditedBy(createTestCertificate(t), []byte("test-signature"), "ed25519")
+
+	m.Auditors[0].Certificate.IssuerPublicKey = "not hex"
+	_, err := m.Auditors[0].DecodeCertificate()
+	assert.ErrorIs(t, err, ErrMalformedAuditor)
+	assert.ErrorContains(t, err, "malformed auditor data: issuer public key")
+
+	m.Auditors[0].ManifestSignature = "abc"
+	_, err = m.Auditors[0].DecodeManifestSignature()
+	assert.ErrorIs(t, err, ErrMalformedAuditor)
+	assert.ErrorContains(t, err, "malformed auditor data: manifest signature")
+}
+
+func TestManifest_CertificateValidity_RoundTripsThroughJSON(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	cert := createTestCertificate(t).(*signing.SimpleCertificate)
+	cert.NotBefore = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cert.NotAfter = cert.NotBefore.Add(30 * 24 * time.Hour)
+	m := New([]Entity{{Name: "file.txt", Checksum: "c1"}})
+	m.SetAuditedBy(cert, []byte("sig"), "ed25519")
+	require.NoError(t, m.Save(manifestPath))
+
+	data, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"notBefore": "2026-01-02T03:04:05Z"`)
+	assert.Contains(t, string(data), `"notAfter": "2026-02-01T03:04:05Z"`)
+
+	loaded, err := LoadManifest(manifestPath)
+	require.NoError(t, err)
+	loadedCert := loaded.GetAuditorCertificate()
+	notBefore, notAfter := signing.CertificateValidity(loadedCert)
+	assert.True(t, cert.NotBefore.Equal(notBefore))
+	assert.True(t, cert.NotAfter.Equal(notAfter))
+}
+
+func TestManifest_LegacyCertificate_HasNoValidity(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), DefaultName)
+	m := New([]Entity{{Name: "file.txt", Checksum: "c1"}})
+	m.SetAuditedBy(createTestCertificate(t), []byte("sig"), "ed25519")
+	require.NoError(t, m.Save(manifestPath))
+
+	data, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "notBefore")
+	assert.NotContains(t, string(data), "notAfter")
+
+	loaded, err := LoadManifest(manifestPath)
+	require.NoError(t, err)
+	loadedCert := loaded.GetAuditorCertificate()
+	notBefore, notAfter := signing.CertificateValidity(loadedCert)
+	assert.True(t, notBefore.IsZero())
+	assert.True(t, notAfter.IsZero())
+}
+
+func TestLikelyBitRot(t *testing.T) {
+	gz := &Entity{ContentType: "application/x-gzip"}
+	tests := []struct {
+		name             string
+		expected, actual *Entity
+		want             bool
+	}{
+		{"zeroed", gz, &Entity{ContentType: ContentTypeZeros}, true},
+		{"truncated to nothing", gz, &Entity{ContentType: ContentTypeEmpty}, true},
+		{"rewritten", gz, &Entity{ContentType: "application/x-gzip"}, false},
+		{"zeros before", &Entity{ContentType: ContentTypeZeros}, &Entity{ContentType: ContentTypeZeros}, false},
+		{"not recorded", &Entity{}, &Entity{ContentType: ContentTypeZeros}, false},
+		{"missing", gz, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, LikelyBitRot(tt.expected, tt.actual))
+		})
+	}
+	assert.Equal(t, "", ContentTypeChange(&Entity{}, gz))
+	assert.Equal(t, "was empty, now application/x-gzip", ContentTypeChange(&Entity{ContentType: ContentTypeEmpty}, gz))
+}
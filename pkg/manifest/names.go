@@ -0,0 +1,190 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Entity names are stored with forward slashes regardless of the OS that generated the manifest,
+// so manifests, their HMACs and checksums are byte-identical across platforms. Names are
+// converted at the filesystem boundary with PortableName and LocalName.
+
+// NameEncodingBase64 is the Entity.MarshalJSON encoding of names that are not valid UTF-8. JSON strings
+// would replace their invalid bytes, so that distinct names could collide and none would match the file system.
+const NameEncodingBase64 = "base64"
+
+// storedEntity is the JSON representation of an Entity, entityFields prevents MarshalJSON from recursing
+type storedEntity struct {
+	entityFields
+	// NameEncoding is empty for names stored as they are
+	NameEncoding string `json:"nameEncoding,omitempty"`
+}
+
+type entityFields Entity
+
+// MarshalJSON stores names that are not valid UTF-8 base64-encoded, with their encoding, names that are
+// stay readable. Manifests without such names encode exactly like before, and so keep their HMAC.
+func (e Entity) MarshalJSON() ([]byte, error) {
+	stored := storedEntity{entityFields: entityFields(e)}
+	if !utf8.ValidString(e.Name) {
+		stored.Name = base64.StdEncoding.EncodeToString([]byte(e.Name))
+		stored.NameEncoding = NameEncodingBase64
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON restores the exact bytes of names encoded by MarshalJSON
+func (e *Entity) UnmarshalJSON(data []byte) error {
+	var stored storedEntity
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	switch stored.NameEncoding {
+	case "":
+	case NameEncodingBase64:
+		name, err := base64.StdEncoding.DecodeString(stored.Name)
+		if err != nil {
+			return fmt.Errorf("invalid base64 name %q: %w", stored.Name, err)
+		}
+		stored.Name = string(name)
+	default:
+		return fmt.Errorf("unsupported name encoding %q of entity %q", stored.NameEncoding, stored.Name)
+	}
+	*e = Entity(stored.entityFields)
+	return nil
+}
+
+// PortableName converts a name, or a path relative to a directory, coming from the local filesystem into
+// its form stored in manifests and reports
+func PortableName(name string) string {
+	return portableName(name, filepath.Separator)
+}
+
+// LocalName converts a name stored in a manifest into a path for the local filesystem
+func LocalName(name string) string {
+	return localName(name, filepath.Separator)
+}
+
+// portableName replaces separator with a forward slash. It does not depend on the
+// OS running it, which lets tests simulate other platforms.
+func portableName(name string, separator rune) string {
+	if separator == '/' {
+		return name
+	}
+	return strings.ReplaceAll(name, string(separator), "/")
+}
+
+// localName replaces forward slashes with separator, see portableName
+func localName(name string, separator rune) string {
+	if separator == '/' {
+		return name
+	}
+	return strings.ReplaceAll(name, "/", string(separator))
+}
+
+// ValidateName rejects entity names that could address a file outside of the directory of the manifest
+// when joined to its path: empty names, "." and "..", names with a path separator or a NUL byte.
+// Names are the plain names of directory entries, anything else is legal, e.g. spaces, leading dots or unicode.
+func ValidateName(name string) error {
+	return validateName(name, filepath.Separator)
+}
+
+// validateName implements ValidateName for the path separator of an OS. A backslash is only a separator
+// on Windows, elsewhere it is a valid character of a name.
+func validateName(name string, separator rune) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("name must not be empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("name must not be '%s'", name)
+	case strings.ContainsRune(name, 0):
+		return fmt.Errorf("name must not contain a NUL byte")
+	case strings.ContainsRune(name, '/') || strings.ContainsRune(name, separator):
+		return fmt.Errorf("name must not contain a path separator")
+	}
+	return nil
+}
+
+// IsHidden reports whether name, an entity name, is hidden by Unix convention: it starts with a dot,
+// "." and ".." excepted
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// sortEntities sorts entities by name, the order the HMAC is computed over. The sort is stable, so that
+// entities sharing a name keep their order, until Validate rejects them.
+func sortEntities(entities []Entity) {
+	sort.SliceStable(entities, func(i, j int) bool {
+		return entities[i].Name < entities[j].Name
+	})
+}
+
+// CaseCollisions returns the groups of entity names differing only in case, see strings.EqualFold, sorted.
+// They are distinct names on most Linux file systems, but the default ones of macOS and Windows hold a single
+// file for each group.
+func (m *Manifest) CaseCollisions() [][]string {
+	names := make([]string, 0, len(m.Entities))
+	for _, entity := range m.Entities {
+		names = append(names, entity.Name)
+	}
+	// Sorting by the folded name makes names equal under EqualFold adjacent
+	sort.Slice(names, func(i, j int) bool {
+		fi, fj := foldCase(names[i]), foldCase(names[j])
+		return fi < fj || fi == fj && names[i] < names[j]
+	})
+	var collisions [][]string
+	for start, end := 0, 1; start < len(names); start, end = end, end+1 {
+		for end < len(names) && strings.EqualFold(names[start], names[end]) {
+			end++
+		}
+		if end-start > 1 {
+			collisions = append(collisions, names[start:end:end])
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i][0] < collisions[j][0] })
+	return collisions
+}
+
+// foldCase maps every rune of name to the smallest rune it is equal to under simple case folding,
+// names equal under strings.EqualFold map to the same string
+func foldCase(name string) string {
+	return strings.Map(func(r rune) rune {
+		folded := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			folded = min(folded, f)
+		}
+		return folded
+	}, name)
+}
+
+// Validate checks the names of entities and mountpoints with ValidateName and the labels with ValidateLabels,
+// and rejects entities sharing a name. It is called when a manifest is parsed or encoded. The error wraps
+// ErrInvalidManifest and identifies the offending entity.
+func (m *Manifest) Validate() error {
+	names := make(map[string]bool, len(m.Entities))
+	for _, entity := range m.Entities {
+		if err := ValidateName(entity.Name); err != nil {
+			return fmt.Errorf("%w: entity %q: %w", ErrInvalidManifest, entity.Name, err)
+		}
+		// Comparisons look entities up by name, a second one would go unnoticed
+		if names[entity.Name] {
+			return fmt.Errorf("%w: duplicate entity %q", ErrInvalidManifest, entity.Name)
+		}
+		names[entity.Name] = true
+	}
+	for _, name := range m.Mountpoints {
+		if err := ValidateName(name); err != nil {
+			return fmt.Errorf("%w: mountpoint %q: %w", ErrInvalidManifest, name, err)
+		}
+	}
+	if err := ValidateLabels(m.Labels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+	return nil
+}
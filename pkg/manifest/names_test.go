@@ -0,0 +1,189 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortableName_SimulatedWindowsSeparator(t *testing.T) {
+	assert.Equal(t, "sub/dir/file.txt", portableName(`sub\dir\file.txt`, '\\'))
+	assert.Equal(t, `sub\dir\file.txt`, localName("sub/dir/file.txt", '\\'))
+	// On Unix a backslash is a valid character of a file name and must be kept
+	assert.Equal(t, `back\slash.txt`, portableName(`back\slash.txt`, '/'))
+	assert.Equal(t, `back\slash.txt`, localName(`back\slash.txt`, '/'))
+}
+
+func TestNew_ManifestIsIdenticalRegardlessOfGeneratingOS(t *testing.T) {
+	unixNames := []string{"a.txt", "sub/b.txt"}
+	windowsNames := []string{"a.txt", `sub\b.txt`}
+	build := func(names []string, separator rune) []byte {
+		entities := make([]Entity, 0, len(names))
+		for _, name := range names {
+			entities = append(entities, Entity{Name: portableName(name, separator), Checksum: "00"})
+		}
+		m := New(entities)
+		require.NoError(t, m.calculateHMAC())
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		return data
+	}
+	assert.Equal(t, string(build(unixNames, '/')), string(build(windowsNames, '\\')))
+}
+
+var hostileNames = []string{"", ".", "..", "../../etc/passwd", "/etc/passwd", "a/b", "a/", "/", "a\x00b", "\x00"}
+
+var weirdButValidNames = []string{"naïve café.txt", "日本語", " leading and trailing spaces ", ".hidden",
+	"..double-dot", "a..b", "...", "emoji 🎉", "tab\tname", "-dash", "~tilde"}
+
+func TestValidateName_RejectsHostileNames(t *testing.T) {
+	for _, name := range hostileNames {
+		assert.Error(t, validateName(name, '/'), "%q", name)
+		assert.Error(t, validateName(name, '\\'), "%q", name)
+	}
+	// A backslash separates paths on Windows only
+	assert.Error(t, validateName(`..\..\windows\system32`, '\\'))
+	assert.NoError(t, validateName(`back\slash.txt`, '/'))
+}
+
+func TestValidateName_AcceptsWeirdButValidNames(t *testing.T) {
+	for _, name := range weirdButValidNames {
+		assert.NoError(t, ValidateName(name), "%q", name)
+	}
+}
+
+func TestIsHidden(t *testing.T) {
+	for _, name := range []string{".cache", ".DS_Store", "..hidden", ".bytecheck.manifest"} {
+		assert.True(t, IsHidden(name), "%q", name)
+	}
+	for _, name := range []string{"data.txt", "file.", ".", "..", ""} {
+		assert.False(t, IsHidden(name), "%q", name)
+	}
+}
+
+func FuzzValidateName(f *testing.F) {
+	for _, name := range append(hostileNames, weirdButValidNames...) {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if ValidateName(name) != nil {
+			return
+		}
+		// A valid name joined to a directory addresses an entry right inside it
+		joined := filepath.Join("root", name)
+		if filepath.Dir(joined) != "root" || filepath.Base(joined) != name {
+			t.Errorf("name %q escapes its directory as %q", name, joined)
+		}
+	})
+}
+
+// hostileManifest returns a manifest with a valid HMAC listing an entity named name
+func hostileManifest(t *testing.T, name string) []byte {
+	entities := []Entity{{Name: "ok.txt", Checksum: "00"}, {Name: name, Checksum: "00"}}
+	// Parse sorts entities before checking the HMAC
+	sort.Slice(entities, func(i, j int) bool { return entities[i].Name < entities[j].Name })
+	m := &Manifest{Entities: entities}
+	require.NoError(t, m.calculateHMAC())
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	return data
+}
+
+func TestParse_WithHostileEntityName_mustFailNamingIt(t *testing.T) {
+	for _, name := range hostileNames {
+		_, err := Parse(hostileManifest(t, name))
+		require.ErrorIs(t, err, ErrInvalidManifest, "%q", name)
+		assert.ErrorContains(t, err, fmt.Sprintf("entity %q", name))
+	}
+}
+
+func TestParse_WithWeirdButValidNames_mustSucceed(t *testing.T) {
+	for _, name := range weirdButValidNames {
+		m, err := Parse(hostileManifest(t, name))
+		require.NoError(t, err, "%q", name)
+		assert.NoError(t, m.Validate())
+	}
+}
+
+func TestEncode_WithHostileEntityName_mustFail(t *testing.T) {
+	m := New([]Entity{{Name: "../escape", Checksum: "00"}})
+
+	assert.Error(t, m.Validate())
+	_, err := m.Encode()
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+}
+
+func TestParse_WithDuplicateEntityNames_mustFail(t *testing.T) {
+	for _, entities := range [][]Entity{
+		{{Name: "a", Checksum: "00"}, {Name: "a", Checksum: "01"}},
+		{{Name: "a", Checksum: "01"}, {Name: "a", Checksum: "00"}},
+		{{Name: "a", Checksum: "00"}, {Name: "b", Checksum: "00"}, {Name: "a", Checksum: "00"}},
+	} {
+		m := &Manifest{Entities: entities}
+		require.NoError(t, m.calculateHMAC())
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+
+		_, err = Parse(data)
+		require.ErrorIs(t, err, ErrInvalidManifest)
+		assert.ErrorContains(t, err, `duplicate entity "a"`)
+		_, err = m.Encode()
+		assert.ErrorIs(t, err, ErrInvalidManifest)
+	}
+}
+
+func TestNew_WithDuplicateNames_mustKeepFirstEntity(t *testing.T) {
+	m := New([]Entity{{Name: "b", Checksum: "00"}, {Name: "a", Checksum: "01"}, {Name: "a", Checksum: "02"}})
+
+	assert.Equal(t, []Entity{{Name: "a", Checksum: "01"}, {Name: "b", Checksum: "00"}}, m.Entities)
+	assert.NoError(t, m.Validate())
+}
+
+func TestCompareManifests_WithDuplicateNames_mustFail(t *testing.T) {
+	valid := &Manifest{Entities: []Entity{{Name: "a", Checksum: "00"}}}
+	duplicated := &Manifest{Entities: []Entity{{Name: "a", Checksum: "00"}, {Name: "a", Checksum: "01"}}}
+
+	_, _, err := CompareManifests(valid, duplicated)
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+	_, _, err = CompareManifests(duplicated, valid)
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+}
+
+func TestCaseCollisions_mustGroupNamesDifferingOnlyInCase(t *testing.T) {
+	m := New([]Entity{{Name: "readme"}, {Name: "README"}, {Name: "Makefile"}, {Name: "b"}, {Name: "B"}, {Name: "ReadMe"}})
+
+	assert.Equal(t, [][]string{{"B", "b"}, {"README", "ReadMe", "readme"}}, m.CaseCollisions())
+	assert.NoError(t, m.Validate())
+	assert.Empty(t, New([]Entity{{Name: "a"}, {Name: "b"}}).CaseCollisions())
+	// Case folding, not lower casing, decides: the Kelvin sign folds to k, the dotted capital I does not fold to i
+	kelvin := New([]Entity{{Name: "\u212aey"}, {Name: "key"}, {Name: "\u0130d"}, {Name: "i\u0307d"}})
+	assert.Equal(t, [][]string{{"key", "\u212aey"}}, kelvin.CaseCollisions())
+}
+
+func TestParse_WithManifestOfOlderVersion_mustLoad(t *testing.T) {
+	data := `{
+  "entities": [
+    {
+      "name": "config.go",
+      "checksum": "52729c59f0a01d7982cfb541b7eae6ed9f9064ba704121bf6ebf33ebe3ea1efc",
+      "isDir": false
+    },
+    {
+      "name": "test",
+      "checksum": "3c17022aabcf48e38969f330d4b35f15c2e40023b1e4ffb8a7c7e86aabf7356a",
+      "isDir": true
+    }
+  ],
+  "hmac": "87024b7993879875c3909b7acfd0256933d4b72539c24d9ad0071ba6f2ffee26"
+}`
+
+	m, err := Parse([]byte(data))
+
+	require.NoError(t, err)
+	assert.Len(t, m.Entities, 2)
+}
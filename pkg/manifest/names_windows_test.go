@@ -0,0 +1,18 @@
+//go:build windows
+
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortableName_Windows(t *testing.T) {
+	assert.Equal(t, "sub/file.txt", PortableName(filepath.Join("sub", "file.txt")))
+	assert.Equal(t, filepath.Join("sub", "file.txt"), LocalName("sub/file.txt"))
+
+	m := New([]Entity{{Name: filepath.Join("sub", "file.txt")}})
+	assert.Equal(t, "sub/file.txt", m.Entities[0].Name)
+}
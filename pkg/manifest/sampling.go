@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// Default sampling regions, see Sampling
+const (
+	DefaultSampleEdgeBytes  = 4 << 20
+	DefaultSampleBlockBytes = 1 << 20
+	DefaultSampleBlocks     = 16
+)
+
+// Sampling holds the parameters of the sample checksums recorded for files larger than Threshold,
+// see Entity.SampleChecksum. A sample covers the first and last EdgeBytes of a file and Blocks blocks
+// of BlockBytes spread over the rest. Verification must use the parameters recorded in the manifest
+// to read the same regions.
+type Sampling struct {
+	Threshold  int64 `json:"threshold"`
+	EdgeBytes  int64 `json:"edgeBytes"`
+	BlockBytes int64 `json:"blockBytes"`
+	Blocks     int   `json:"blocks"`
+}
+
+// DefaultSampling returns the default sampling parameters for files larger than threshold
+func DefaultSampling(threshold int64) Sampling {
+	return Sampling{
+		Threshold:  threshold,
+		EdgeBytes:  DefaultSampleEdgeBytes,
+		BlockBytes: DefaultSampleBlockBytes,
+		Blocks:     DefaultSampleBlocks,
+	}
+}
+
+// Applies reports whether a file of the given size is sampled
+func (s Sampling) Applies(size int64) bool {
+	return size > s.Threshold
+}
+
+// Region is a byte range of a file
+type Region struct {
+	Offset int64
+	Length int64
+}
+
+// Regions returns the sorted, non-overlapping regions sampled from a file of the given size.
+// Blocks are evenly spaced between the edges, each placed within its slot by a generator seeded
+// with the file size, so that the regions only depend on the size and the parameters.
+func (s Sampling) Regions(size int64) []Region {
+	regions := []Region{{Offset: 0, Length: s.EdgeBytes}}
+	if middle := size - 2*s.EdgeBytes; middle > 0 && s.Blocks > 0 && s.BlockBytes > 0 {
+		slot := middle / int64(s.Blocks)
+		for i := 0; i < s.Blocks; i++ {
+			offset := s.EdgeBytes + int64(i)*slot
+			if slack := slot - s.BlockBytes; slack > 0 {
+				offset += int64(rand.New(rand.NewPCG(uint64(size), uint64(i))).Uint64N(uint64(slack) + 1))
+			}
+			regions = append(regions, Region{Offset: offset, Length: s.BlockBytes})
+		}
+	}
+	regions = append(regions, Region{Offset: size - s.EdgeBytes, Length: s.EdgeBytes})
+	return mergeRegions(regions, size)
+}
+
+// mergeRegions clamps regions to [0, size) and merges the overlapping ones
+func mergeRegions(regions []Region, size int64) []Region {
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Offset < regions[j].Offset })
+	merged := make([]Region, 0, len(regions))
+	for _, r := range regions {
+		start, end := max(r.Offset, 0), min(r.Offset+r.Length, size)
+		if end <= start {
+			continue
+		}
+		if n := len(merged); n > 0 && start <= merged[n-1].Offset+merged[n-1].Length {
+			merged[n-1].Length = max(merged[n-1].Length, end-merged[n-1].Offset)
+			continue
+		}
+		merged = append(merged, Region{Offset: start, Length: end - start})
+	}
+	return merged
+}
+
+// ChecksumMismatch reports whether the content checksums of two entities differ. Full checksums are
+// authoritative when both entities record one, otherwise the sample checksums are compared, which
+// both entities must record, see Entity.SampleChecksum.
+func ChecksumMismatch(a, b Entity) bool {
+	if a.Checksum != "" && b.Checksum != "" || a.SampleChecksum == "" && b.SampleChecksum == "" {
+		return !SecureEqualHex(a.Checksum, b.Checksum)
+	}
+	return !SecureEqualHex(a.SampleChecksum, b.SampleChecksum)
+}
+
+// Sampled reports whether only the sample checksum of the entity was computed, see Entity.SampleChecksum
+func (e Entity) Sampled() bool {
+	return e.Checksum == "" && e.SampleChecksum != ""
+}
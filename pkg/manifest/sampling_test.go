@@ -0,0 +1,71 @@
+package manifest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling_Regions(t *testing.T) {
+	s := Sampling{Threshold: 100, EdgeBytes: 10, BlockBytes: 5, Blocks: 4}
+	regions := s.Regions(1000)
+	assert.Equal(t, regions, s.Regions(1000), "regions must only depend on the size")
+	assert.Equal(t, Region{Offset: 0, Length: 10}, regions[0])
+	assert.Equal(t, Region{Offset: 990, Length: 10}, regions[len(regions)-1])
+	assert.Len(t, regions, 6)
+	for i := 1; i < len(regions); i++ {
+		assert.Greater(t, regions[i].Offset, regions[i-1].Offset+regions[i-1].Length-1, "regions must not overlap")
+	}
+	for i, r := range regions[1:5] {
+		slot := int64(980 / 4)
+		assert.GreaterOrEqual(t, r.Offset, 10+int64(i)*slot)
+		assert.LessOrEqual(t, r.Offset+r.Length, 10+int64(i+1)*slot)
+	}
+	assert.NotEqual(t, regions[1:5], s.Regions(1001)[1:5], "block positions are seeded by the size")
+}
+
+func TestSampling_Regions_SmallFile_CoversItWhole(t *testing.T) {
+	s := DefaultSampling(0)
+	assert.Equal(t, []Region{{Offset: 0, Length: 3000}}, s.Regions(3000))
+	assert.Empty(t, s.Regions(0))
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Entity
+		mismatch bool
+	}{
+		{"same checksums", Entity{Checksum: "aa"}, Entity{Checksum: "aa"}, false},
+		{"different checksums", Entity{Checksum: "aa"}, Entity{Checksum: "bb"}, true},
+		{"full checksums are authoritative", Entity{Checksum: "aa", SampleChecksum: "cc"},
+			Entity{Checksum: "bb", SampleChecksum: "cc"}, true},
+		{"sampled and matching", Entity{Checksum: "aa", SampleChecksum: "cc"}, Entity{SampleChecksum: "cc"}, false},
+		{"sampled and different", Entity{Checksum: "aa", SampleChecksum: "cc"}, Entity{SampleChecksum: "dd"}, true},
+		{"upper-cased checksum", Entity{Checksum: "aa"}, Entity{Checksum: "AA"}, true},
+		{"upper-cased sample checksum", Entity{Checksum: "aa", SampleChecksum: "cc"}, Entity{SampleChecksum: "CC"}, true},
+		{"sampled without recorded sample", Entity{Checksum: "aa"}, Entity{SampleChecksum: "cc"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.mismatch, ChecksumMismatch(tt.a, tt.b))
+		})
+	}
+}
+
+func TestParse_WithTamperedSampling_mustFailHMAC(t *testing.T) {
+	m := New([]Entity{{Name: "a.bin", Checksum: "00", SampleChecksum: "11"}})
+	m.Sampling = &Sampling{Threshold: 100, EdgeBytes: 10, BlockBytes: 5, Blocks: 4}
+	data, err := m.Encode()
+	require.NoError(t, err)
+
+	parsed, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, m.Sampling, parsed.Sampling)
+
+	_, err = Parse(bytes.Replace(data, []byte(`"blocks": 4`), []byte(`"blocks": 5`), 1))
+	assert.ErrorIs(t, err, ErrInvalidManifest)
+	assert.ErrorContains(t, err, "invalid HMAC")
+}
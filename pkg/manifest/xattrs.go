@@ -0,0 +1,28 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// XattrsDigest returns the digest recorded in Entity.XattrsDigest for the extended attributes attrs,
+// mapping names to values. It is the SHA-256 of the attributes sorted by name, each serialized as the
+// big-endian uint32 length of the name, the name, the length of the value and the value.
+// It is part of the manifest format, changing it makes existing manifests report differences.
+func XattrsDigest(attrs map[string][]byte) string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(name))))
+		h.Write([]byte(name))
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(attrs[name]))))
+		h.Write(attrs[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
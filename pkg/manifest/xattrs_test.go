@@ -0,0 +1,39 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXattrsDigest(t *testing.T) {
+	// The digest of no attributes is the digest of empty input
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", XattrsDigest(nil))
+
+	digest := XattrsDigest(map[string][]byte{"user.b": []byte("2"), "user.a": []byte("1")})
+	assert.Equal(t, digest, XattrsDigest(map[string][]byte{"user.a": []byte("1"), "user.b": []byte("2")}))
+	assert.NotEqual(t, digest, XattrsDigest(map[string][]byte{"user.a": []byte("1"), "user.b": []byte("3")}))
+	// Names and values are length-prefixed, moving bytes between them changes the digest
+	assert.NotEqual(t, XattrsDigest(map[string][]byte{"user.ab": []byte("c")}), XattrsDigest(map[string][]byte{"user.a": []byte("bc")}))
+}
+
+func TestCompareManifests_XattrMismatch(t *testing.T) {
+	a := New([]Entity{{Name: "f", Checksum: "01", XattrsDigest: "aa"}, {Name: "g", Checksum: "02", XattrsDigest: "bb"}})
+	b := New([]Entity{{Name: "f", Checksum: "01", XattrsDigest: "cc"}, {Name: "g", Checksum: "02"}})
+
+	identical, differences, err := CompareManifests(a, b)
+
+	assert.NoError(t, err)
+	assert.False(t, identical)
+	// g was scanned without extended attributes and is not compared
+	if assert.Len(t, differences, 1) {
+		assert.Equal(t, DiffXattrMismatch, differences[0].Type)
+		assert.Equal(t, "f", differences[0].Name)
+	}
+	assert.True(t, a.HasXattrs())
+}
+
+func TestXattrsChanged_WithUpperCasedDigest_mustReportChange(t *testing.T) {
+	assert.False(t, XattrsChanged(Entity{XattrsDigest: "aa"}, Entity{XattrsDigest: "aa"}))
+	assert.True(t, XattrsChanged(Entity{XattrsDigest: "aa"}, Entity{XattrsDigest: "AA"}))
+}
@@ -0,0 +1,201 @@
+// Package metrics exports the progress and outcome of generate and verify runs in the Prometheus format.
+// It is the only package depending on the Prometheus client, the scanner reports progress through its
+// statistics, see Exporter.Update.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+const namespace = "bytecheck"
+
+// auditorCategories are exported as one gauge each, e.g. bytecheck_auditors_trusted
+var auditorCategories = []issuer.Category{
+	issuer.CategoryTrusted,
+	issuer.CategoryFishy,
+	issuer.CategoryExpired,
+	issuer.CategoryError,
+	issuer.CategoryUnsupported,
+	issuer.CategoryUnverifiable,
+}
+
+// Exporter serves the metrics of one run at /metrics
+type Exporter struct {
+	registry *prometheus.Registry
+
+	mu    sync.Mutex
+	stats *scanner.Stats
+
+	manifestsValid   prometheus.Gauge
+	manifestsInvalid prometheus.Gauge
+	manifestsShallow prometheus.Gauge
+	// manifestsSkipped is the former name of manifestsShallow, kept for existing dashboards
+	manifestsSkipped prometheus.Gauge
+	auditors         map[issuer.Category]prometheus.Gauge
+
+	listener net.Listener
+	server   *http.Server
+	served   chan struct{}
+	// ending is set by CloseAfterScrape, scrapes starting afterwards close scraped
+	ending      atomic.Bool
+	scraped     chan struct{}
+	scrapedOnce sync.Once
+}
+
+// New creates an Exporter with all metrics at zero
+func New() *Exporter {
+	e := &Exporter{
+		registry: prometheus.NewRegistry(),
+		auditors: make(map[issuer.Category]prometheus.Gauge),
+		scraped:  make(chan struct{}),
+	}
+	e.counter("bytes_processed_total", "Bytes of files read and hashed", (*scanner.Stats).BytesHashed)
+	e.counter("files_processed_total", "Files read and hashed", (*scanner.Stats).FilesProcessed)
+	e.counter("dirs_processed_total", "Directories scanned", (*scanner.Stats).DirsProcessed)
+	e.counter("cached_total", "Directories whose fresh manifest was reused instead of scanning them",
+		(*scanner.Stats).CachedProcessed)
+	e.manifestsValid = e.gauge("manifests_valid", "Manifests matching their directory, set when verify ends")
+	e.manifestsInvalid = e.gauge("manifests_invalid", "Manifests not matching their directory, set when verify ends")
+	e.manifestsShallow = e.gauge("manifests_shallow", "Fresh manifests verified without hashing their files, set when verify ends")
+	e.manifestsSkipped = e.gauge("manifests_skipped", "Deprecated: same as manifests_shallow")
+	for _, category := range auditorCategories {
+		e.auditors[category] = e.gauge("auditors_"+string(category),
+			fmt.Sprintf("Auditors whose status is %s, set when verify ends", category))
+	}
+	return e
+}
+
+// counter registers a counter reading value from the latest statistics
+func (e *Exporter) counter(name, help string, value func(*scanner.Stats) int64) {
+	e.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, func() float64 {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.stats == nil {
+			return 0
+		}
+		return float64(value(e.stats))
+	}))
+}
+
+// gauge registers a gauge
+func (e *Exporter) gauge(name, help string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	})
+	e.registry.MustRegister(g)
+	return g
+}
+
+// Update records a snapshot of the scan statistics, it is meant to be called from bytecheck.WithProgress.
+// Snapshots are passed by the scanner as copies, they are not modified afterwards.
+func (e *Exporter) Update(stats *scanner.Stats) {
+	if stats == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stats = stats
+}
+
+// SetVerifyResult records the manifest and auditor counts of a finished verification
+func (e *Exporter) SetVerifyResult(result *verifier.Result) {
+	e.Update(result.Stats)
+	summary := result.Summary()
+	e.manifestsValid.Set(float64(summary.Verified))
+	e.manifestsInvalid.Set(float64(summary.Invalid))
+	e.manifestsShallow.Set(float64(summary.Shallow))
+	e.manifestsSkipped.Set(float64(summary.Shallow))
+	counts := make(map[issuer.Category]int)
+	for _, status := range result.AuditorStatuses {
+		counts[status.Category()]++
+	}
+	for category, g := range e.auditors {
+		g.Set(float64(counts[category]))
+	}
+}
+
+// Handler returns the handler serving the metrics in the Prometheus text format
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// Listen serves the metrics at /metrics on addr, e.g. ":9090", in the background until Close is called
+func (e *Exporter) Listen(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	handler := e.Handler()
+	mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ending := e.ending.Load()
+		handler.ServeHTTP(w, r)
+		if ending {
+			e.scrapedOnce.Do(func() { close(e.scraped) })
+		}
+	}))
+	e.listener = listener
+	e.server = &http.Server{Handler: mux}
+	e.served = make(chan struct{})
+	go func() {
+		defer close(e.served)
+		_ = e.server.Serve(listener)
+	}()
+	return nil
+}
+
+// Addr returns the address the metrics are served on, nil before Listen
+func (e *Exporter) Addr() net.Addr {
+	if e.listener == nil {
+		return nil
+	}
+	return e.listener.Addr()
+}
+
+// CloseAfterScrape keeps serving the metrics once the run is over until they are scraped once more, so that
+// the outcome is collected, or until linger elapses, then stops serving them like Close does
+func (e *Exporter) CloseAfterScrape(linger time.Duration) error {
+	if e.server == nil {
+		return nil
+	}
+	e.ending.Store(true)
+	timer := time.NewTimer(linger)
+	defer timer.Stop()
+	select {
+	case <-e.scraped:
+	case <-timer.C:
+	}
+	return e.Close()
+}
+
+// Close stops serving the metrics. It does nothing if Listen was not called.
+func (e *Exporter) Close() error {
+	if e.server == nil {
+		return nil
+	}
+	err := e.server.Close()
+	<-e.served
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+// scrape returns the values of the bytecheck metrics served by e
+func scrape(t *testing.T, e *Exporter) map[string]float64 {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", e.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, match := range regexp.MustCompile(`(?m)^bytecheck_(\w+) (\S+)$`).FindAllStringSubmatch(string(body), -1) {
+		value, err := strconv.ParseFloat(match[2], 64)
+		require.NoError(t, err)
+		values[match[1]] = value
+	}
+	return values
+}
+
+// createTree creates the files, given by slash separated paths relative to a new temporary directory,
+// together with their parent directories and returns the directory
+func createTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestExporter_ScrapedDuringVerify_mustReportProgressAndOutcome(t *testing.T) {
+	dir := createTree(t, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/deep/c.txt": "c"})
+	_, err := bytecheck.GenerateTree(context.Background(), dir)
+	require.NoError(t, err)
+
+	e := New()
+	require.NoError(t, e.Listen("127.0.0.1:0"))
+	defer e.Close()
+	assert.Zero(t, scrape(t, e)["files_processed_total"])
+
+	// Scraping from the progress callback happens while the verification is still running
+	var midRun map[string]float64
+	report, err := bytecheck.VerifyTree(context.Background(), dir, bytecheck.WithProgress(func(stats *scanner.Stats) {
+		e.Update(stats)
+		if midRun == nil && stats.FilesProcessed() > 0 {
+			midRun = scrape(t, e)
+		}
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, midRun, "expected a progress update with processed files")
+	assert.Positive(t, midRun["files_processed_total"])
+	assert.Positive(t, midRun["bytes_processed_total"])
+	assert.Positive(t, midRun["dirs_processed_total"])
+	assert.Zero(t, midRun["manifests_valid"], "outcome is only known once verify ends")
+
+	e.SetVerifyResult(report.Result)
+	final := scrape(t, e)
+	stats := report.Result.Stats
+	assert.Equal(t, float64(stats.FilesProcessed()), final["files_processed_total"])
+	assert.Equal(t, float64(stats.BytesHashed()), final["bytes_processed_total"])
+	assert.Equal(t, float64(stats.DirsProcessed()), final["dirs_processed_total"])
+	assert.Equal(t, float64(3), final["manifests_valid"])
+	assert.Zero(t, final["manifests_invalid"])
+	assert.Zero(t, final["manifests_shallow"])
+	assert.Zero(t, final["manifests_skipped"])
+	assert.Contains(t, final, "auditors_trusted")
+	assert.Contains(t, final, "cached_total")
+}
+
+func TestExporter_Close_withoutListen(t *testing.T) {
+	e := New()
+	assert.Nil(t, e.Addr())
+	assert.NoError(t, e.Close())
+}
+
+func TestExporter_CloseAfterScrape_mustServeUntilScraped(t *testing.T) {
+	e := New()
+	require.NoError(t, e.Listen("127.0.0.1:0"))
+	closed := make(chan error)
+	go func() { closed <- e.CloseAfterScrape(time.Minute) }()
+
+	require.Eventually(t, e.ending.Load, 5*time.Second, time.Millisecond)
+	scrape(t, e)
+
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the exporter to close once scraped")
+	}
+}
+
+func TestExporter_CloseAfterScrape_withoutScrape_mustCloseAfterLinger(t *testing.T) {
+	e := New()
+	require.NoError(t, e.Listen("127.0.0.1:0"))
+	addr := e.Addr().String()
+
+	require.NoError(t, e.CloseAfterScrape(10*time.Millisecond))
+
+	_, err := http.Get(fmt.Sprintf("http://%s/metrics", addr))
+	assert.Error(t, err)
+}
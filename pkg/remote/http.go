@@ -0,0 +1,155 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultAttempts is the number of attempts of HTTP requests failing temporarily, see WithRetries
+const DefaultAttempts = 3
+
+// maxResponseSize bounds the data read from a GET, manifests of huge directories stay well below it
+const maxResponseSize = 1 << 30
+
+// HTTPStore is a Store reading and writing keys below a base URL with plain GET and PUT requests, like
+// WebDAV servers or S3-compatible object stores accepting bearer tokens or presigned access do
+type HTTPStore struct {
+	baseURL  string
+	client   *http.Client
+	token    string
+	attempts int
+	backoff  time.Duration
+}
+
+// HTTPOption configures an HTTPStore
+type HTTPOption func(s *HTTPStore)
+
+// WithBearerToken sends token in the Authorization header of every request, e.g. read from TokenEnvVar
+func WithBearerToken(token string) HTTPOption {
+	return func(s *HTTPStore) {
+		s.token = token
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(client *http.Client) HTTPOption {
+	return func(s *HTTPStore) {
+		s.client = client
+	}
+}
+
+// WithRetries makes up to attempts attempts of requests failing with a network error, a 5xx, 408 or 429
+// response, waiting backoff before the second one and doubling it every time
+func WithRetries(attempts int, backoff time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.attempts = max(attempts, 1)
+		s.backoff = backoff
+	}
+}
+
+// NewHTTPStore creates a store below baseURL, keys are appended to its path
+func NewHTTPStore(baseURL string, opts ...HTTPOption) *HTTPStore {
+	s := &HTTPStore{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		client:   http.DefaultClient,
+		attempts: DefaultAttempts,
+		backoff:  500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Put implements Store
+func (s *HTTPStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, key, data)
+	return err
+}
+
+// Get implements Store
+func (s *HTTPStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil)
+}
+
+// transientError marks failures worth retrying
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// do sends the request, retrying transient failures, and returns the body of a successful response
+func (s *HTTPStore) do(ctx context.Context, method, key string, data []byte) ([]byte, error) {
+	backoff := s.backoff
+	for attempt := 1; ; attempt++ {
+		body, err := s.send(ctx, method, key, data)
+		var transient *transientError
+		if err == nil || attempt >= s.attempts || !errors.As(err, &transient) {
+			return body, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *HTTPStore) send(ctx context.Context, method, key string, data []byte) ([]byte, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	keyURL := s.url(key)
+	req, err := http.NewRequestWithContext(ctx, method, keyURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &transientError{err: err}
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode >= 500:
+		return nil, &transientError{err: fmt.Errorf("%s %s: %s", method, keyURL, resp.Status)}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("%s %s: %s", method, keyURL, resp.Status)
+	}
+	if method != http.MethodGet {
+		return nil, nil
+	}
+	respData, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, &transientError{err: fmt.Errorf("failed to read %s: %w", keyURL, err)}
+	}
+	return respData, nil
+}
+
+// url escapes every element of key
+func (s *HTTPStore) url(key string) string {
+	elems := strings.Split(key, "/")
+	for i, elem := range elems {
+		elems[i] = url.PathEscape(elem)
+	}
+	return s.baseURL + "/" + strings.Join(elems, "/")
+}
@@ -0,0 +1,124 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryServer is an HTTP object store keeping data by request path, requiring a bearer token
+type memoryServer struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests int
+	// failures makes the next requests fail with this status
+	failures []int
+}
+
+func (s *memoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if len(s.failures) > 0 {
+		w.WriteHeader(s.failures[0])
+		s.failures = s.failures[1:]
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.EscapedPath()] = data
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}
+}
+
+func newMemoryServer(t *testing.T) (*memoryServer, *httptest.Server) {
+	server := &memoryServer{objects: make(map[string][]byte)}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+func TestHTTPStore_PutAndGet(t *testing.T) {
+	server, httpServer := newMemoryServer(t)
+	store := NewHTTPStore(httpServer.URL+"/registry/", WithBearerToken("secret"))
+
+	require.NoError(t, store.Put(context.Background(), "tree/a b/.bytecheck.manifest", []byte("data")))
+	assert.Contains(t, server.objects, "/registry/tree/a%20b/.bytecheck.manifest")
+	data, err := store.Get(context.Background(), "tree/a b/.bytecheck.manifest")
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	_, err = store.Get(context.Background(), "tree/missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = NewHTTPStore(httpServer.URL).Put(context.Background(), "tree/x", []byte("data"))
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
+
+func TestHTTPStore_WithTransientFailures_mustRetry(t *testing.T) {
+	server, httpServer := newMemoryServer(t)
+	store := NewHTTPStore(httpServer.URL, WithBearerToken("secret"), WithRetries(3, time.Millisecond))
+
+	server.failures = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	require.NoError(t, store.Put(context.Background(), "tree/key", []byte("data")))
+	assert.Equal(t, 3, server.requests)
+
+	// Attempts are bounded, and permanent failures are not retried
+	server.requests = 0
+	server.failures = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	_, err := store.Get(context.Background(), "tree/key")
+	assert.ErrorContains(t, err, "502 Bad Gateway")
+	assert.Equal(t, 3, server.requests)
+
+	server.requests = 0
+	server.failures = []int{http.StatusForbidden}
+	_, err = store.Get(context.Background(), "tree/key")
+	assert.ErrorContains(t, err, "403 Forbidden")
+	assert.Equal(t, 1, server.requests)
+}
+
+func TestHTTPStore_WithCancelledContext_mustStopRetrying(t *testing.T) {
+	server, httpServer := newMemoryServer(t)
+	server.failures = []int{http.StatusServiceUnavailable}
+	store := NewHTTPStore(httpServer.URL, WithRetries(5, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := store.Get(ctx, "tree/key")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestOpen_mustSelectStoreByURL(t *testing.T) {
+	store, err := Open("https://registry.example.com/manifests")
+	require.NoError(t, err)
+	assert.IsType(t, &HTTPStore{}, store)
+
+	for _, location := range []string{"/srv/registry", "file:///srv/registry", "registry"} {
+		store, err = Open(location)
+		require.NoError(t, err)
+		assert.IsType(t, &DirStore{}, store, location)
+	}
+
+	_, err = Open("s3://bucket/prefix")
+	assert.True(t, err != nil && strings.Contains(err.Error(), "unsupported remote store URL"))
+}
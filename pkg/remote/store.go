@@ -0,0 +1,67 @@
+// Package remote stores manifests in a central registry, so that a tree can be verified against the manifests
+// published when it was generated instead of the ones found on the local disk.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// ErrNotFound is returned by Store.Get when no data is stored under the key
+var ErrNotFound = errors.New("not found in remote store")
+
+// TokenEnvVar names the environment variable holding the bearer token sent to HTTP stores
+const TokenEnvVar = "BYTECHECK_REMOTE_TOKEN"
+
+// Store holds data by slash-separated keys, see ManifestKey
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the data stored under key, ErrNotFound if there is none
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Open returns the store at rawURL: an HTTPStore for http and https URLs, a DirStore for file URLs and
+// plain paths. The options apply to HTTP stores only.
+func Open(rawURL string, opts ...HTTPOption) (Store, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("remote store URL must not be empty")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// Not a URL, or a Windows drive letter
+		return NewDirStore(rawURL), nil
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewHTTPStore(rawURL, opts...), nil
+	case "file":
+		return NewDirStore(filepath.FromSlash(u.Path)), nil
+	}
+	return nil, fmt.Errorf("unsupported remote store URL '%s': expected http, https or file", rawURL)
+}
+
+// ValidateTreeID checks that id can prefix keys: one or more slash-separated names, see manifest.ValidateName
+func ValidateTreeID(id string) error {
+	if id == "" {
+		return fmt.Errorf("tree identifier must not be empty")
+	}
+	for _, name := range strings.Split(id, "/") {
+		if err := manifest.ValidateName(name); err != nil {
+			return fmt.Errorf("invalid tree identifier '%s': %w", id, err)
+		}
+	}
+	return nil
+}
+
+// ManifestKey returns the key of the manifest of the directory relDir, a slash-separated path relative to the
+// root of the tree, "." for the root itself. Keys mirror the layout of the tree below treeID.
+func ManifestKey(treeID, relDir string) string {
+	return path.Join(treeID, relDir, manifest.DefaultName)
+}
@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the number of manifests Push and Fetch transfer at the same time
+const DefaultConcurrency = 8
+
+// Push uploads the manifests named manifestName found in the tree rooted at root to store, below treeID,
+// and returns their keys, sorted. Manifests are uploaded as they are stored, after checking that they are valid,
+// so that the checksums recorded by their parents still match.
+func Push(ctx context.Context, store Store, treeID, root, manifestName string) ([]string, error) {
+	if err := ValidateTreeID(treeID); err != nil {
+		return nil, err
+	}
+	dirs, err := directories(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var keys []string
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultConcurrency)
+	for _, rel := range dirs {
+		g.Go(func() error {
+			manifestPath := filepath.Join(root, rel, manifestName)
+			data, err := os.ReadFile(manifestPath)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if _, err := manifest.Parse(data); err != nil {
+				return fmt.Errorf("refusing to push %s: %w", manifestPath, err)
+			}
+			key := ManifestKey(treeID, manifest.PortableName(rel))
+			if err := store.Put(ctx, key, data); err != nil {
+				return fmt.Errorf("failed to push %s: %w", manifestPath, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			keys = append(keys, key)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Fetch downloads from store the manifests pushed below treeID for every directory of the tree rooted at root.
+// They are returned by the path of the manifest named manifestName in the directory, nil for directories
+// the store holds no manifest for.
+func Fetch(ctx context.Context, store Store, treeID, root, manifestName string) (map[string][]byte, error) {
+	if err := ValidateTreeID(treeID); err != nil {
+		return nil, err
+	}
+	dirs, err := directories(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	manifests := make(map[string][]byte, len(dirs))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(DefaultConcurrency)
+	for _, rel := range dirs {
+		g.Go(func() error {
+			data, err := store.Get(ctx, ManifestKey(treeID, manifest.PortableName(rel)))
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("failed to fetch the manifest of %s: %w", filepath.Join(root, rel), err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			manifests[filepath.Join(root, rel, manifestName)] = data
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return manifests, nil
+}
+
+// directories lists the directories of the tree rooted at root, relative to it
+func directories(ctx context.Context, root string) ([]string, error) {
+	var dirs []string
+	err := traverse.WalkPostOrder(ctx, root, func(ctx context.Context, dirPath string, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, dirPath)
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, rel)
+		return nil
+	})
+	return dirs, err
+}
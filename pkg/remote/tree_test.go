@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+func generateTree(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "empty"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "deep", "b.txt"), []byte("b"), 0644))
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	return dir
+}
+
+func TestPushAndFetch_mustRoundTripManifests(t *testing.T) {
+	dir := generateTree(t)
+	// A directory created after generating has no manifest
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "new"), 0755))
+	store := NewDirStore(t.TempDir())
+
+	keys, err := Push(context.Background(), store, "team/tree", dir, manifest.DefaultName)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"team/tree/.bytecheck.manifest",
+		"team/tree/empty/.bytecheck.manifest",
+		"team/tree/sub/.bytecheck.manifest",
+		"team/tree/sub/deep/.bytecheck.manifest",
+	}, keys)
+
+	manifests, err := Fetch(context.Background(), store, "team/tree", dir, manifest.DefaultName)
+	require.NoError(t, err)
+	assert.Len(t, manifests, 5)
+	local, err := os.ReadFile(filepath.Join(dir, "sub", manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Equal(t, local, manifests[filepath.Join(dir, "sub", manifest.DefaultName)])
+	assert.Contains(t, manifests, filepath.Join(dir, "new", manifest.DefaultName))
+	assert.Nil(t, manifests[filepath.Join(dir, "new", manifest.DefaultName)])
+}
+
+func TestPush_WithInvalidManifestOrTreeID_mustFail(t *testing.T) {
+	dir := generateTree(t)
+	store := NewDirStore(t.TempDir())
+
+	_, err := Push(context.Background(), store, "../escape", dir, manifest.DefaultName)
+	assert.ErrorContains(t, err, "invalid tree identifier '../escape'")
+	_, err = Fetch(context.Background(), store, "", dir, manifest.DefaultName)
+	assert.ErrorContains(t, err, "tree identifier must not be empty")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", manifest.DefaultName), []byte("{}"), 0644))
+	_, err = Push(context.Background(), store, "tree", dir, manifest.DefaultName)
+	assert.ErrorIs(t, err, manifest.ErrInvalidManifest)
+	assert.ErrorContains(t, err, "refusing to push")
+}
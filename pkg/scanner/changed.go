@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"context"
+	"os"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// unchangedFiles returns the entities of the files whose recorded checksums are trusted when they were not
+// modified since the cutoff of WithChangedSince, nil without a cutoff. Files recorded without their size,
+// by older versions, are always read.
+func (s *Scanner) unchangedFiles(existing *manifest.Manifest) map[string]manifest.Entity {
+	if s.options.changedSince.IsZero() || existing == nil {
+		return nil
+	}
+	files := make(map[string]manifest.Entity)
+	for _, entity := range existing.Entities {
+		if entity.Kind() == "file" && entity.Size != nil && !entity.Unhashed() {
+			files[entity.Name] = entity
+		}
+	}
+	return files
+}
+
+// unchangedSince reports whether the file at fpath was last modified before the cutoff of WithChangedSince
+func (s *Scanner) unchangedSince(fpath string) bool {
+	info, err := s.fs.Stat(fpath)
+	return err == nil && info.ModTime().Before(s.options.changedSince)
+}
+
+// trustRecorded records in entity the checksums of recorded, as reading the unchanged file would have
+// computed them with the sampling of its directory, see fileChecksums
+func trustRecorded(entity *manifest.Entity, recorded manifest.Entity, sampling *manifest.Sampling, sampleOnly bool) {
+	if !sampleOnly {
+		entity.Checksum = recorded.Checksum
+		entity.Chunking = recorded.Chunking
+	}
+	if sampling != nil {
+		entity.SampleChecksum = recorded.SampleChecksum
+	}
+	entity.ContentType = recorded.ContentType
+}
+
+// unchangedManifest returns the manifest of dir when the directory can be verified shallowly, as nothing in it
+// was modified since the cutoff of WithChangedSince: its listing matches the manifest, its files are older than
+// the cutoff and the manifests of its subdirectories match their recorded checksums. It returns nil otherwise,
+// and always when permissions, extended attributes or hard links are tracked, as changing them keeps the
+// modification time.
+func (s *Scanner) unchangedManifest(ctx context.Context, dir string, entries []os.DirEntry, scope dirScope) *manifest.Manifest {
+	if s.options.changedSince.IsZero() || scope.ancestorOnly || s.trackPermissions(scope.config) || s.options.trackXattrs ||
+		s.options.trackHardlinks {
+		return nil
+	}
+	existing, err := s.LoadManifest(dir)
+	if err != nil || existing == nil || existing.HiddenPolicy != s.options.hiddenPolicy.recorded() ||
+		!manifest.SecureEqualHex(existing.ConfigDigest, scope.config.Digest()) {
+		return nil
+	}
+	if !s.listingMatches(dir, entries, scope, existing) || !s.childManifestsMatch(ctx, dir, existing) {
+		return nil
+	}
+	for _, entity := range existing.Entities {
+		entryPath := s.fs.Join(dir, entity.Name)
+		switch {
+		case entity.IsDir:
+			// Checked by childManifestsMatch
+		case entity.Special != "":
+			// Special files are never read, the listing covers them
+		case entity.Unhashed() || !s.unchangedSince(entryPath):
+			return nil
+		}
+	}
+	return existing
+}
+
+// countUnchanged records the files of a directory reused by unchangedManifest in the statistics
+func (s *Scanner) countUnchanged(m *manifest.Manifest) {
+	var files int64
+	for _, entity := range m.Entities {
+		if entity.Kind() == "file" {
+			files++
+		}
+	}
+	bytes := manifestFileBytes(m)
+	s.stats.IncreaseDirectoriesUnchanged()
+	s.stats.AddFilesUnchanged(files)
+	s.stats.AddBytesCovered(bytes)
+	s.stats.AddBytesCached(bytes)
+}
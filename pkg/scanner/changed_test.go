@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// writeAged writes a file and sets its modification time to age ago
+func writeAged(t *testing.T, path string, content string, age time.Duration) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-age)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// walkChangedSince walks dir with a scanner trusting the files older than cutoff and returns the manifests
+// computed per directory, relative to dir, and the directories reused
+func walkChangedSince(t *testing.T, dir string, cutoff time.Time) (map[string]*manifest.Manifest, map[string]bool, *Stats) {
+	t.Helper()
+	sc := New(WithChangedSince(cutoff))
+	manifests := make(map[string]*manifest.Manifest)
+	reused := make(map[string]bool)
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, dirPath)
+		manifests[rel], reused[rel] = m, cached
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	return manifests, reused, sc.GetStats()
+}
+
+func TestScanner_WithChangedSince(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "old.txt"), "old", 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "recent.txt"), "recent", 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "sub", "a.txt"), "a", 48*time.Hour)
+	generateWith(t, New(), dir)
+
+	// Same sizes, so only the modification time tells the changes apart
+	writeAged(t, filepath.Join(dir, "old.txt"), "OLD", 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "recent.txt"), "RECENT", time.Minute)
+
+	manifests, cached, stats := walkChangedSince(t, dir, time.Now().Add(-24*time.Hour))
+
+	if !cached["sub"] || cached["."] {
+		t.Errorf("Expected only the unchanged subdirectory to be reused, got %v", cached)
+	}
+	root, err := manifest.LoadManifest(filepath.Join(dir, New().GetManifestName()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := make(map[string]manifest.Entity)
+	for _, entity := range root.Entities {
+		recorded[entity.Name] = entity
+	}
+	for _, entity := range manifests["."].Entities {
+		switch entity.Name {
+		case "old.txt":
+			if entity.Checksum != recorded["old.txt"].Checksum {
+				t.Errorf("Expected the recorded checksum of old.txt to be trusted")
+			}
+		case "recent.txt":
+			if entity.Checksum == recorded["recent.txt"].Checksum {
+				t.Errorf("Expected recent.txt to be hashed again")
+			}
+		}
+	}
+	if got := stats.FilesUnchanged(); got != 2 {
+		t.Errorf("Expected 2 unchanged files (old.txt, sub/a.txt), got %d", got)
+	}
+	if got := stats.DirectoriesUnchanged(); got != 1 {
+		t.Errorf("Expected 1 unchanged directory, got %d", got)
+	}
+	if got := stats.CachedProcessed(); got != 0 {
+		t.Errorf("Expected no fresh manifest, got %d", got)
+	}
+}
+
+func TestScanner_WithChangedSince_ListingChangeScansDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "sub", "a.txt"), "a", 48*time.Hour)
+	generateWith(t, New(), dir)
+	// An old file copied in keeps its modification time, the listing still tells it apart
+	writeAged(t, filepath.Join(dir, "sub", "b.txt"), "b", 48*time.Hour)
+
+	manifests, cached, stats := walkChangedSince(t, dir, time.Now().Add(-24*time.Hour))
+	if cached["sub"] {
+		t.Error("Expected the subdirectory with a new entry to be scanned")
+	}
+	if got := len(manifests["sub"].Entities); got != 2 {
+		t.Errorf("Expected 2 entities in sub, got %d", got)
+	}
+	if got := stats.FilesUnchanged(); got != 1 {
+		t.Errorf("Expected only a.txt to be trusted, got %d unchanged files", got)
+	}
+}
+
+func TestScanner_WithChangedSince_ChangedSubdirectoryManifestScansParent(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "a.txt"), "a", 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "sub", "b.txt"), "b", 48*time.Hour)
+	generateWith(t, New(), dir)
+	// Regenerating the subdirectory changes its manifest, its parent records the previous one
+	writeAged(t, filepath.Join(dir, "sub", "c.txt"), "c", time.Minute)
+	generateWith(t, New(), filepath.Join(dir, "sub"))
+
+	_, cached, _ := walkChangedSince(t, dir, time.Now().Add(-24*time.Hour))
+	if cached["."] {
+		t.Error("Expected the parent of a changed subdirectory manifest to be scanned")
+	}
+}
+
+func TestScanner_WithChangedSince_ZeroCutoffReadsEverything(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "a.txt"), "a", 48*time.Hour)
+	generateWith(t, New(), dir)
+
+	_, cached, stats := walkChangedSince(t, dir, time.Time{})
+	if cached["."] || stats.FilesUnchanged() != 0 || stats.BytesHashed() == 0 {
+		t.Errorf("Expected every file to be read without a cutoff, got %d unchanged", stats.FilesUnchanged())
+	}
+}
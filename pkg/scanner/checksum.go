@@ -2,15 +2,215 @@ package scanner
 
 import (
 	"context"
+	"encoding"
+	"encoding/binary"
 	"fmt"
 	"github.com/minio/sha256-simd"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"hash"
 	"io"
-	"os"
+	"io/fs"
+	"slices"
+	"sync"
 )
 
-// CalculateFileChecksumWithStats calculates SHA-256 checksum of a file and tracks bytes processed
-func calculateChecksum(ctx context.Context, fpath string, stats *Stats) (string, error) {
-	file, err := os.Open(fpath)
+// DefaultReadBufferSize is the amount of data read from a file at once unless WithReadBufferSize is used.
+// Cancellation and bandwidth limits are checked between reads.
+const DefaultReadBufferSize = 1024 * 1024
+
+// bufferPool hands out read buffers of a fixed size, so hashing a file does not allocate
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool(size int) *bufferPool {
+	if size <= 0 {
+		size = DefaultReadBufferSize
+	}
+	return &bufferPool{pool: sync.Pool{New: func() any {
+		buf := make([]byte, size)
+		return &buf
+	}}}
+}
+
+func (p *bufferPool) get() *[]byte    { return p.pool.Get().(*[]byte) }
+func (p *bufferPool) put(buf *[]byte) { p.pool.Put(buf) }
+
+// calculateChecksum calculates SHA-256 checksum of a file and tracks bytes processed.
+// It returns ctx.Err() as soon as the context is cancelled, even in the middle of a large file.
+// Reads are throttled by limiter, which may be nil. classify, when not nil, is given the first bytes
+// of the file as they are hashed, see readFile.
+func calculateChecksum(ctx context.Context, fsys fs.FS, fpath string, stats *Stats, limiter *bandwidthLimiter, buffers *bufferPool,
+	classify func(head []byte)) (string, error) {
+	hash := sha256.New()
+	if err := readFile(ctx, fsys, fpath, 0, hash, stats, limiter, buffers, classify); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// calculateChunkedChecksum calculates the SHA-256 checksum of a file together with the checksums of its
+// chunks of chunkSize bytes, reading the file once, see calculateChecksum and manifest.Chunking.
+// With resume, hashing continues after the chunks it records instead of reading the file from its start.
+// When hashing fails, e.g. because ctx is cancelled, the state at the end of the last chunk hashed is returned
+// together with the error, nil when no chunk was completed, so that a later run can resume from it.
+func calculateChunkedChecksum(ctx context.Context, fsys fs.FS, fpath string, chunkSize int64, resume *chunkedProgress,
+	stats *Stats, limiter *bandwidthLimiter, buffers *bufferPool, classify func(head []byte)) (string, *manifest.Chunking, *chunkedProgress, error) {
+	chunks := &chunkHasher{chunking: manifest.Chunking{ChunkSize: chunkSize}, file: sha256.New(), hash: sha256.New()}
+	var offset int64
+	if resume != nil {
+		if err := chunks.restore(resume); err != nil {
+			return "", nil, nil, err
+		}
+		offset = chunks.chunking.Offset(len(resume.chunkDigests))
+	}
+	if err := readFile(ctx, fsys, fpath, offset, chunks, stats, limiter, buffers, classify); err != nil {
+		return "", nil, chunks.checkpoint, err
+	}
+	return fmt.Sprintf("%x", chunks.file.Sum(nil)), chunks.finish(), nil, nil
+}
+
+// chunkedProgress is the state of a chunked checksum at the end of its last completed chunk,
+// see calculateChunkedChecksum
+type chunkedProgress struct {
+	chunkDigests []string
+	// hashState is the state of the checksum of the whole file, see encoding.BinaryMarshaler
+	hashState []byte
+}
+
+// chunkHasher records the checksum of the whole data written to it and of every chunk of it
+type chunkHasher struct {
+	chunking manifest.Chunking
+	file     hash.Hash
+	hash     hash.Hash
+	written  int64
+	// checkpoint is the state at the end of the last completed chunk, nil when the hash cannot be saved
+	checkpoint *chunkedProgress
+}
+
+func (c *chunkHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		k := min(int64(len(p)), c.chunking.ChunkSize-c.written)
+		c.file.Write(p[:k])
+		c.hash.Write(p[:k])
+		c.written += k
+		p = p[k:]
+		if c.written == c.chunking.ChunkSize {
+			c.sum()
+			c.save()
+		}
+	}
+	return n, nil
+}
+
+func (c *chunkHasher) sum() {
+	c.chunking.ChunkDigests = append(c.chunking.ChunkDigests, fmt.Sprintf("%x", c.hash.Sum(nil)))
+	c.hash.Reset()
+	c.written = 0
+}
+
+// save records the current state as the checkpoint, at the end of a chunk
+func (c *chunkHasher) save() {
+	marshaler, ok := c.file.(encoding.BinaryMarshaler)
+	if !ok {
+		return
+	}
+	state, err := marshaler.MarshalBinary()
+	if err != nil {
+		return
+	}
+	c.checkpoint = &chunkedProgress{chunkDigests: slices.Clone(c.chunking.ChunkDigests), hashState: state}
+}
+
+// restore continues hashing from progress
+func (c *chunkHasher) restore(progress *chunkedProgress) error {
+	unmarshaler, ok := c.file.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("cannot resume checksum: hash state cannot be restored")
+	}
+	if err := unmarshaler.UnmarshalBinary(progress.hashState); err != nil {
+		return fmt.Errorf("cannot resume checksum: %w", err)
+	}
+	c.chunking.ChunkDigests = slices.Clone(progress.chunkDigests)
+	c.checkpoint = progress
+	return nil
+}
+
+// finish records the last, shorter chunk and returns the chunks
+func (c *chunkHasher) finish() *manifest.Chunking {
+	if c.written > 0 {
+		c.sum()
+	}
+	return &c.chunking
+}
+
+// readFile writes the content of a file from offset on to w, see calculateChecksum. classify, when not nil,
+// is called once with the first sniffLength bytes written, or all of them when they are shorter, so that the
+// file is classified without being opened again.
+func readFile(ctx context.Context, fsys fs.FS, fpath string, offset int64, w io.Writer, stats *Stats, limiter *bandwidthLimiter,
+	buffers *bufferPool, classify func(head []byte)) error {
+	file, err := fsys.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if offset > 0 {
+		if seeker, ok := file.(io.Seeker); ok {
+			_, err = seeker.Seek(offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, file, offset)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	stats.SetCurrentFile(fpath)
+
+	bufPtr := buffers.get()
+	defer buffers.put(bufPtr)
+	buf := *bufPtr
+	// head collects the first bytes when the first read is shorter than sniffLength
+	var head []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := file.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			if classify != nil {
+				if head == nil && n >= sniffLength {
+					classify(buf[:sniffLength])
+					classify = nil
+				} else if head = append(head, buf[:min(n, sniffLength-len(head))]...); len(head) == sniffLength {
+					classify(head)
+					classify = nil
+				}
+			}
+			stats.AddBytesHashed(int64(n))
+			if err := limiter.wait(ctx, n); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			if classify != nil {
+				classify(head)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// calculateSampleChecksum calculates the SHA-256 checksum of the size of a file followed by the regions
+// sampled from it, see manifest.Sampling.Regions. Files that cannot seek are read up to the last region.
+func calculateSampleChecksum(ctx context.Context, fsys fs.FS, fpath string, size int64, sampling manifest.Sampling,
+	stats *Stats, limiter *bandwidthLimiter, buffers *bufferPool) (string, error) {
+	file, err := fsys.Open(fpath)
 	if err != nil {
 		return "", err
 	}
@@ -19,18 +219,84 @@ func calculateChecksum(ctx context.Context, fpath string, stats *Stats) (string,
 	stats.SetCurrentFile(fpath)
 
 	hash := sha256.New()
-
-	// Use a custom writer that counts bytes
-	counter := &byteCounter{
-		ctx:    ctx,
-		stats:  stats,
-		writer: hash,
+	_ = binary.Write(hash, binary.BigEndian, size)
+	bufPtr := buffers.get()
+	defer buffers.put(bufPtr)
+	buf := *bufPtr
+	seeker, canSeek := file.(io.Seeker)
+	var position int64
+	for _, region := range sampling.Regions(size) {
+		if canSeek {
+			if _, err := seeker.Seek(region.Offset, io.SeekStart); err != nil {
+				return "", err
+			}
+		} else if _, err := io.CopyN(io.Discard, file, region.Offset-position); err != nil {
+			return "", err
+		}
+		remaining := region.Length
+		for remaining > 0 {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			n, err := io.ReadFull(file, buf[:min(int64(len(buf)), remaining)])
+			if n > 0 {
+				hash.Write(buf[:n])
+				stats.AddBytesHashed(int64(n))
+				remaining -= int64(n)
+				if err := limiter.wait(ctx, n); err != nil {
+					return "", err
+				}
+			}
+			if err != nil {
+				// A file shorter than its size was truncated while being read
+				return "", err
+			}
+		}
+		position = region.Offset + region.Length
 	}
 
-	buf := make([]byte, 1024*1024)
-	if _, err := io.CopyBuffer(counter, file, buf); err != nil {
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// calculateManifestChecksum calculates SHA-256 checksum of a child directory's manifest.
+// Auditor sections of current manifests are excluded so that co-signing a subdirectory does not change
+// the checksum recorded by its parent, see manifest.UnsignedData. Manifests that cannot be parsed are
+// hashed as-is, which makes them show up as a checksum mismatch rather than a scan error.
+// Manifests are small and parsed whole, so no read buffer is used.
+func calculateManifestChecksum(ctx context.Context, fsys fs.FS, fpath string, stats *Stats, limiter *bandwidthLimiter, _ *bufferPool) (string, error) {
+	data, err := fs.ReadFile(fsys, fpath)
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := limiter.wait(ctx, len(data)); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	// Manifests are not files of the tree, their bytes are neither counted as hashed nor as covered
+	stats.SetCurrentFile(fpath)
+	return manifestDataChecksum(data), nil
+}
+
+// ManifestChecksum returns the checksum a parent directory records for the child manifest stored as data,
+// which leaves out its auditor sections
+func ManifestChecksum(data []byte) string {
+	return manifestDataChecksum(data)
+}
+
+// manifestDataChecksum returns the checksum of the manifest stored as data, see calculateManifestChecksum
+func manifestDataChecksum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(manifest.UnsignedData(data)))
+}
+
+// fileChecksumBuffers serves FileChecksum, which is not tied to a Scanner
+var fileChecksumBuffers = newBufferPool(DefaultReadBufferSize)
+
+// FileChecksum calculates the SHA-256 checksum of the content of a single file, as manifests record it for
+// regular files hashed in full. Manifests of child directories are recorded without their auditors, see
+// ManifestChecksum, and sampled files with the checksum of their regions, see manifest.Sampling.
+func FileChecksum(ctx context.Context, fpath string) (string, error) {
+	return calculateChecksum(ctx, osFileSystem{}, fpath, &Stats{}, nil, fileChecksumBuffers, nil)
 }
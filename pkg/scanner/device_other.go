@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// deviceID is not available on this platform, WithOneFileSystem then leaves out nothing
+func deviceID(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// DirConfigName is the name of the optional file configuring the scan of a directory and its subtree, see DirConfig
+const DirConfigName = ".bytecheck.config"
+
+// ChecksumAlgorithmSHA256 is the checksum algorithm of files, the only one supported
+const ChecksumAlgorithmSHA256 = "sha256"
+
+// DirConfig holds the settings of a .bytecheck.config file, which apply to its directory and the subtree below.
+// The config of a subdirectory overrides the one of its parent: exclude patterns add up, other settings
+// replace the inherited ones, and settings left out are inherited. Configs are read from the walk root down,
+// starting with the ones of the directories above it holding a manifest; settings no config gives come from the
+// scanner options.
+type DirConfig struct {
+	// Exclude holds filepath.Match patterns of names left out, like the patterns of WithExcludes
+	Exclude []string `json:"exclude,omitempty"`
+	// Algorithm of the checksums of files, only ChecksumAlgorithmSHA256 is supported
+	Algorithm string `json:"algorithm,omitempty"`
+	// TrackPermissions overrides WithTrackPermissions
+	TrackPermissions *bool `json:"trackPermissions,omitempty"`
+}
+
+// ParseDirConfig decodes and validates a .bytecheck.config file
+func ParseDirConfig(data []byte) (*DirConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config DirConfig
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	for _, pattern := range config.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern '%s': %w", pattern, err)
+		}
+	}
+	if config.Algorithm != "" && config.Algorithm != ChecksumAlgorithmSHA256 {
+		return nil, fmt.Errorf("unsupported algorithm '%s', expected '%s'", config.Algorithm, ChecksumAlgorithmSHA256)
+	}
+	return &config, nil
+}
+
+// merge returns the config of a directory whose own config is child and whose parent's config is c
+func (c DirConfig) merge(child DirConfig) DirConfig {
+	merged := DirConfig{Exclude: append(append([]string(nil), c.Exclude...), child.Exclude...)}
+	merged.Algorithm = c.Algorithm
+	if child.Algorithm != "" {
+		merged.Algorithm = child.Algorithm
+	}
+	merged.TrackPermissions = c.TrackPermissions
+	if child.TrackPermissions != nil {
+		merged.TrackPermissions = child.TrackPermissions
+	}
+	return merged
+}
+
+// Digest returns the digest of the config recorded by the manifests of the directories it applies to,
+// see manifest.Manifest.ConfigDigest. It is empty when no config applies.
+func (c DirConfig) Digest() string {
+	if len(c.Exclude) == 0 && c.Algorithm == "" && c.TrackPermissions == nil {
+		return ""
+	}
+	data, _ := json.Marshal(c)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// dirConfigs caches the effective configs of the directories of a walk, keyed by path
+type dirConfigs struct {
+	mu      sync.Mutex
+	configs map[string]dirConfigResult
+}
+
+type dirConfigResult struct {
+	config DirConfig
+	err    error
+}
+
+// dirConfig returns the effective config of the directory with the relative path elems below root,
+// merging the configs from the ancestors of root belonging to the same tree, see ancestorsConfig, down to it
+func (s *Scanner) dirConfig(root string, elems []string) (DirConfig, error) {
+	dirPath := s.fs.Join(append([]string{root}, elems...)...)
+	s.configs.mu.Lock()
+	cached, ok := s.configs.configs[dirPath]
+	s.configs.mu.Unlock()
+	if ok {
+		return cached.config, cached.err
+	}
+
+	var parent DirConfig
+	var err error
+	if len(elems) > 0 {
+		parent, err = s.dirConfig(root, elems[:len(elems)-1])
+	} else {
+		parent, err = s.ancestorsConfig(root)
+	}
+	config := parent
+	if err == nil {
+		var own *DirConfig
+		if own, err = s.loadDirConfig(dirPath); own != nil {
+			config = parent.merge(*own)
+		}
+	}
+
+	s.configs.mu.Lock()
+	if s.configs.configs == nil {
+		s.configs.configs = make(map[string]dirConfigResult)
+	}
+	s.configs.configs[dirPath] = dirConfigResult{config: config, err: err}
+	s.configs.mu.Unlock()
+	return config, err
+}
+
+// ancestorsConfig returns the config root inherits from the directories above it holding a manifest, which were
+// generated along with it, so that a subtree scanned on its own is listed like when its whole tree is scanned.
+// Trees read through WithFS have no directories above their root.
+func (s *Scanner) ancestorsConfig(root string) (DirConfig, error) {
+	if _, ok := s.fs.(osFileSystem); !ok {
+		return DirConfig{}, nil
+	}
+	dir, err := filepath.Abs(root)
+	if err != nil {
+		return DirConfig{}, nil
+	}
+	var ancestors []string
+	for parent := filepath.Dir(dir); parent != dir && s.holdsManifest(parent); dir, parent = parent, filepath.Dir(parent) {
+		ancestors = append(ancestors, parent)
+	}
+	var config DirConfig
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		own, err := s.loadDirConfig(ancestors[i])
+		if err != nil {
+			return config, err
+		}
+		if own != nil {
+			config = config.merge(*own)
+		}
+	}
+	return config, nil
+}
+
+// holdsManifest reports whether dirPath holds a manifest, under the name of root manifests or of the other ones
+func (s *Scanner) holdsManifest(dirPath string) bool {
+	for _, isRoot := range []bool{false, true} {
+		if _, err := s.fs.Lstat(s.fs.Join(dirPath, s.ManifestName(dirPath, isRoot))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDirConfig loads the config stored in dirPath, it returns nil if there is none
+func (s *Scanner) loadDirConfig(dirPath string) (*DirConfig, error) {
+	configPath := s.fs.Join(dirPath, DirConfigName)
+	data, err := s.fs.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", configPath, err)
+	}
+	config, err := ParseDirConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+	return config, nil
+}
+
+// trackPermissions reports whether permissions are recorded in a directory with the given config
+func (s *Scanner) trackPermissions(config DirConfig) bool {
+	if config.TrackPermissions != nil {
+		return *config.TrackPermissions
+	}
+	return s.options.trackPermissions
+}
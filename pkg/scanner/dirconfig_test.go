@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func TestParseDirConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr string
+	}{
+		{`{"exclude": "*.log"}`, "failed to parse"},
+		{`{"excludes": ["*.log"]}`, "unknown field"},
+		{`{"exclude": ["[a"]}`, "invalid exclude pattern '[a'"},
+		{`{"algorithm": "md5"}`, "unsupported algorithm 'md5', expected 'sha256'"},
+	}
+	for _, tt := range tests {
+		_, err := ParseDirConfig([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseDirConfig(%s): expected error containing %q, got %v", tt.data, tt.wantErr, err)
+		}
+	}
+}
+
+func TestDirConfig_Merge_ChildOverridesParent(t *testing.T) {
+	yes, no := true, false
+	parent := DirConfig{Exclude: []string{"*.log"}, Algorithm: "sha256", TrackPermissions: &yes}
+
+	merged := parent.merge(DirConfig{Exclude: []string{"*.tmp"}, TrackPermissions: &no})
+	want := DirConfig{Exclude: []string{"*.log", "*.tmp"}, Algorithm: "sha256", TrackPermissions: &no}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("expected %+v, got %+v", want, merged)
+	}
+	if !reflect.DeepEqual(parent.merge(DirConfig{}), parent) {
+		t.Errorf("expected an empty child config to inherit everything")
+	}
+	if len(parent.Exclude) != 1 {
+		t.Errorf("expected merging to leave the parent unchanged, got %v", parent.Exclude)
+	}
+	if (DirConfig{}).Digest() != "" {
+		t.Errorf("expected no digest without config")
+	}
+	if parent.Digest() == merged.Digest() {
+		t.Errorf("expected different configs to have different digests")
+	}
+}
+
+func TestScanner_WithDirConfigs_AppliesThemToTheirSubtree(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"root.log":                     "kept, the config is below",
+		"app/" + DirConfigName:         `{"exclude": ["*.log", "cache"]}`,
+		"app/main.go":                  "package main",
+		"app/debug.log":                "excluded",
+		"app/cache/blob":               "excluded with its directory",
+		"app/secrets/key.pem":          "tracked",
+		"app/secrets/old.log":          "excluded, inherited",
+		"app/secrets/" + DirConfigName: `{"trackPermissions": true}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests := make(map[string]*manifest.Manifest)
+	err := New().Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tempDir, dirPath)
+		manifests[rel] = m
+		// Parents hash the manifests of their subdirectories
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	names := func(m *manifest.Manifest) []string {
+		var names []string
+		for _, e := range m.Entities {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	if _, ok := manifests[filepath.Join("app", "cache")]; ok {
+		t.Errorf("expected the excluded directory not to be scanned")
+	}
+	if got, want := names(manifests["app"]), []string{DirConfigName, "main.go", "secrets"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected app to list %v, got %v", want, got)
+	}
+	secrets := manifests[filepath.Join("app", "secrets")]
+	if got, want := names(secrets), []string{DirConfigName, "key.pem"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected secrets to list %v, got %v", want, got)
+	}
+	if !secrets.HasPermissions() || manifests["app"].HasPermissions() {
+		t.Errorf("expected only secrets to track permissions")
+	}
+	if manifests["."].ConfigDigest != "" {
+		t.Errorf("expected no config digest for the root")
+	}
+	if manifests["app"].ConfigDigest == "" || secrets.ConfigDigest == manifests["app"].ConfigDigest {
+		t.Errorf("expected app and secrets to record the digests of their effective configs")
+	}
+	if got := names(manifests["."]); !reflect.DeepEqual(got, []string{"app", "root.log"}) {
+		t.Errorf("expected the root to keep root.log, got %v", got)
+	}
+}
+
+func TestScanner_Walk_OfSubtree_InheritsConfigsOfManagedAncestors(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{
+		"app/" + DirConfigName:  `{"exclude": ["*.log"]}`,
+		"app/main.go":           "package main",
+		"app/secrets/key.pem":   "tracked",
+		"app/secrets/debug.log": "excluded, inherited",
+	} {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generateWith(t, New(), tempDir)
+	secretsDir := filepath.Join(tempDir, "app", "secrets")
+	generated, err := manifest.LoadManifest(filepath.Join(secretsDir, manifest.DefaultName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned *manifest.Manifest
+	err = New().Walk(context.Background(), secretsDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		scanned = m
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(scanned.Entities) != 1 || scanned.Entities[0].Name != "key.pem" {
+		t.Errorf("expected the subtree to inherit the excludes of app, got %+v", scanned.Entities)
+	}
+	if scanned.ConfigDigest != generated.ConfigDigest {
+		t.Errorf("expected config digest %q, got %q", generated.ConfigDigest, scanned.ConfigDigest)
+	}
+}
+
+func TestScanner_WithInvalidDirConfig_FailsNamingIt(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, DirConfigName), []byte(`{"algorithm": "md5"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := New().Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid config "+filepath.Join(tempDir, DirConfigName)) {
+		t.Errorf("expected an error naming the config, got %v", err)
+	}
+}
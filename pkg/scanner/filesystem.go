@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+)
+
+// fileSystem is the tree a Scanner reads. It satisfies fs.FS, so manifests can be loaded
+// with the manifest package's FS functions, but names are in the form used by the implementation:
+// OS paths for osFileSystem and slash-separated fs.FS paths for ioFileSystem.
+type fileSystem interface {
+	fs.ReadDirFS
+	fs.ReadFileFS
+	fs.StatFS
+	// Lstat is like Stat but does not follow a final symbolic link where the file system supports them
+	Lstat(name string) (fs.FileInfo, error)
+	// Join joins path elements with the separator of the file system
+	Join(elem ...string) string
+	// RelElems returns the names of the directories leading from root to target, which is below root
+	RelElems(root, target string) []string
+	// WalkPostOrder traverses the tree rooted at root, see traverse.WalkPostOrderPruned
+	WalkPostOrder(ctx context.Context, root string, prune traverse.PruneFunc, walkFn traverse.WalkFunc) error
+}
+
+// osFileSystem passes names to the os package unchanged, so paths in errors and
+// reported to callbacks are exactly the ones derived from the walk root
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFileSystem) ReadFile(name string) ([]byte, error)       { return os.ReadFile(name) }
+func (osFileSystem) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFileSystem) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFileSystem) Join(elem ...string) string                 { return filepath.Join(elem...) }
+
+func (osFileSystem) RelElems(root, target string) []string {
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(rel, string(filepath.Separator))
+}
+
+func (osFileSystem) WalkPostOrder(ctx context.Context, root string, prune traverse.PruneFunc, walkFn traverse.WalkFunc) error {
+	return traverse.WalkPostOrderPruned(ctx, root, prune, walkFn)
+}
+
+// ioFileSystem reads from an fs.FS, e.g. the contents of an archive
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+func (f ioFileSystem) Open(name string) (fs.File, error)          { return f.fsys.Open(name) }
+func (f ioFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(f.fsys, name) }
+func (f ioFileSystem) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(f.fsys, name) }
+func (f ioFileSystem) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(f.fsys, name) }
+func (ioFileSystem) Join(elem ...string) string                   { return path.Join(elem...) }
+
+// Lstat falls back to Stat, fs.FS has no notion of symbolic links
+func (f ioFileSystem) Lstat(name string) (fs.FileInfo, error) { return fs.Stat(f.fsys, name) }
+
+func (ioFileSystem) RelElems(root, target string) []string {
+	rel := target
+	if root != "." {
+		rel = strings.TrimPrefix(strings.TrimPrefix(target, root), "/")
+	}
+	if rel == "" || rel == "." {
+		return nil
+	}
+	return strings.Split(rel, "/")
+}
+
+func (f ioFileSystem) WalkPostOrder(ctx context.Context, root string, prune traverse.PruneFunc, walkFn traverse.WalkFunc) error {
+	return traverse.WalkPostOrderFSPruned(ctx, f.fsys, root, prune, walkFn)
+}
@@ -0,0 +1,62 @@
+package scanner
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// sniffLength is the number of leading bytes files are classified by, see http.DetectContentType
+const sniffLength = 512
+
+// extensionTypes classifies common formats http.DetectContentType does not recognize by their extension
+var extensionTypes = map[string]string{
+	".tar":     "application/x-tar",
+	".bz2":     "application/x-bzip2",
+	".xz":      "application/x-xz",
+	".zst":     "application/zstd",
+	".7z":      "application/x-7z-compressed",
+	".json":    "application/json",
+	".csv":     "text/csv",
+	".parquet": "application/vnd.apache.parquet",
+	".sqlite":  "application/vnd.sqlite3",
+	".db":      "application/vnd.sqlite3",
+}
+
+// contentType classifies the file name by head, its first bytes, see manifest.Entity.ContentType.
+// Unrecognized content falls back to the type of the extension of name, unless it is all zeros.
+func contentType(name string, head []byte) string {
+	if len(head) == 0 {
+		return manifest.ContentTypeEmpty
+	}
+	if len(bytes.Trim(head, "\x00")) == 0 {
+		return manifest.ContentTypeZeros
+	}
+	detected := http.DetectContentType(head)
+	if detected == "application/octet-stream" || strings.HasPrefix(detected, "text/plain") {
+		if byExtension, ok := extensionTypes[strings.ToLower(path.Ext(name))]; ok {
+			return byExtension
+		}
+	}
+	return detected
+}
+
+// readHead reads the first sniffLength bytes of a file whose checksum is not computed, see contentType
+func readHead(fsys fs.FS, fpath string) ([]byte, error) {
+	file, err := fsys.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
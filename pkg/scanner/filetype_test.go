@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func gzipped(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"archive.gz", gzipped(t, []byte("payload")), "application/x-gzip"},
+		{"image.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"notes.txt", []byte("plain text"), "text/plain; charset=utf-8"},
+		{"data.csv", []byte("a,b\n1,2\n"), "text/csv"},
+		{"backup.tar.xz", []byte("\xfd7zXZ\x00\x00\x04"), "application/x-xz"},
+		{"unknown.bin", []byte{1, 2, 3, 4}, "application/octet-stream"},
+		{"archive.gz", make([]byte, 512), manifest.ContentTypeZeros},
+		{"data.csv", make([]byte, 3), manifest.ContentTypeZeros},
+		{"archive.gz", nil, manifest.ContentTypeEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contentType(tt.name, tt.head); got != tt.want {
+				t.Errorf("contentType(%s) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateChecksum_ClassifiesFirstBytes(t *testing.T) {
+	content := make([]byte, 2000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	fpath := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(fpath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	short := filepath.Join(t.TempDir(), "short.bin")
+	if err := os.WriteFile(short, content[:100], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{1, 100, 512, 4096} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			for path, want := range map[string][]byte{fpath: content[:sniffLength], short: content[:100]} {
+				calls := 0
+				var head []byte
+				_, err := calculateChecksum(context.Background(), osFileSystem{}, path, &Stats{}, nil, newBufferPool(size),
+					func(b []byte) {
+						calls++
+						head = append([]byte(nil), b...)
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if calls != 1 || !bytes.Equal(head, want) {
+					t.Errorf("%s: classified %d time(s) with %d bytes, want once with %d", filepath.Base(path), calls, len(head), len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestScanner_WithContentTypes(t *testing.T) {
+	tempDir := t.TempDir()
+	archive := gzipped(t, bytes.Repeat([]byte("payload"), 100))
+	for name, content := range map[string][]byte{"archive.gz": archive, "notes.txt": []byte("notes")} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walk := func(sc *Scanner) map[string]manifest.Entity {
+		t.Helper()
+		entities := make(map[string]manifest.Entity)
+		err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			for _, e := range m.Entities {
+				entities[e.Name] = e
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return entities
+	}
+
+	if plain := walk(New()); plain["archive.gz"].ContentType != "" {
+		t.Errorf("expected no content type without WithContentTypes, got %q", plain["archive.gz"].ContentType)
+	}
+	generated := walk(New(WithContentTypes(true)))
+	if got := generated["archive.gz"].ContentType; got != "application/x-gzip" {
+		t.Errorf("expected application/x-gzip, got %q", got)
+	}
+
+	m := manifest.New([]manifest.Entity{generated["archive.gz"]})
+	if err := m.Save(filepath.Join(tempDir, manifest.DefaultName)); err != nil {
+		t.Fatal(err)
+	}
+	// Bit-rot zeroes the file without changing its length
+	if err := os.WriteFile(filepath.Join(tempDir, "archive.gz"), make([]byte, len(archive)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verification classifies only the files whose manifest records a content type
+	verified := walk(New(WithContentTypeVerification(true)))
+	if got := verified["archive.gz"].ContentType; got != manifest.ContentTypeZeros {
+		t.Errorf("expected %q, got %q", manifest.ContentTypeZeros, got)
+	}
+	if got := verified["notes.txt"].ContentType; got != "" {
+		t.Errorf("expected no content type for a file its manifest records none for, got %q", got)
+	}
+}
@@ -0,0 +1,37 @@
+package scanner
+
+import (
+	"fmt"
+	"github.com/minio/sha256-simd"
+	"os"
+)
+
+// fingerprint computes a cheap digest of a directory listing from names, types, sizes and
+// modification times. Subdirectories are represented by the stat of their manifest file,
+// so a regenerated child manifest changes the fingerprint of its parent.
+// The directory's own manifest, named manifestName, is excluded. manifestPath locates the manifests of subdirectories.
+func fingerprint(fsys fileSystem, dir string, entries []os.DirEntry, manifestName string,
+	manifestPath func(dirPath string) string) (string, error) {
+	hash := sha256.New()
+	for _, entry := range entries {
+		if entry.Name() == manifestName {
+			continue
+		}
+		var info os.FileInfo
+		var err error
+		if entry.IsDir() {
+			info, err = fsys.Lstat(manifestPath(fsys.Join(dir, entry.Name())))
+		} else {
+			info, err = entry.Info()
+		}
+		if err != nil {
+			if os.IsNotExist(err) {
+				fmt.Fprintf(hash, "%s\x00%v\x00missing\n", entry.Name(), entry.Type())
+				continue
+			}
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%v\x00%d\x00%d\n", entry.Name(), entry.Type(), info.Size(), info.ModTime().UnixNano())
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
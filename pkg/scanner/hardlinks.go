@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"sync"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// inodeKey identifies a file by its device and inode, which all of its hard links share
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// linkGroup returns the identifier of the file recorded in manifest.Entity.LinkGroup. It only tells the links of
+// the same file apart from others in one tree, inodes change when the tree is copied.
+func (k inodeKey) linkGroup() string {
+	var data [16]byte
+	binary.BigEndian.PutUint64(data[:8], k.dev)
+	binary.BigEndian.PutUint64(data[8:], k.ino)
+	sum := sha256.Sum256(data[:])
+	return hex.EncodeToString(sum[:8])
+}
+
+// hashParams are the parameters a file is hashed with, which vary between directories in verification.
+// Links hashed with other parameters than the ones of their first link are hashed again.
+type hashParams struct {
+	sampling    manifest.Sampling
+	sampled     bool
+	sampleOnly  bool
+	chunkSize   int64
+	contentType bool
+}
+
+// hardlinks holds the checksums of the files with several hard links hashed during a walk, so that their
+// other links reuse them instead of reading the same content again. It is safe for concurrent use by the
+// workers. Files with a single link are never held, and a file is dropped once all of its links were seen,
+// so only the files whose other links are still to come, or are outside the tree, take memory.
+type hardlinks struct {
+	mu    sync.Mutex
+	files map[inodeKey]*linkedFile
+}
+
+// linkedFile holds the checksums of a file computed by its first link, ready once done is closed
+type linkedFile struct {
+	done   chan struct{}
+	params hashParams
+	entity manifest.Entity
+	err    error
+	// remaining counts the links not seen yet
+	remaining uint64
+}
+
+func newHardlinks() *hardlinks {
+	return &hardlinks{files: make(map[inodeKey]*linkedFile)}
+}
+
+// acquire returns the file of key, which the caller computes when first is true and must then pass to
+// complete. Every call but the first one counts a link as seen.
+func (h *hardlinks) acquire(key inodeKey, links uint64, params hashParams) (file *linkedFile, first bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if file, ok := h.files[key]; ok {
+		if file.remaining--; file.remaining == 0 {
+			delete(h.files, key)
+		}
+		return file, false
+	}
+	file = &linkedFile{done: make(chan struct{}), params: params, remaining: links - 1}
+	h.files[key] = file
+	return file, true
+}
+
+// complete makes the checksums of entity, or err, available to the other links of file
+func (file *linkedFile) complete(entity *manifest.Entity, err error) {
+	file.entity, file.err = *entity, err
+	close(file.done)
+}
+
+// linkedChecksums records the checksums of the file described by info in entity with compute, unless they were
+// computed for another hard link of the file during the walk. Reused checksums are counted as cached. With
+// WithTrackHardlinks, entity records the link group of files with several links. Symbolic links to such files
+// share their inode without being one of their links, they are hashed on their own.
+func (s *Scanner) linkedChecksums(ctx context.Context, info os.FileInfo, entity *manifest.Entity, params hashParams,
+	symlink bool, compute func() error) error {
+	key, links, ok := inodeOf(info)
+	if !ok || links < 2 || symlink || s.links == nil {
+		return compute()
+	}
+	if s.options.trackHardlinks {
+		entity.LinkGroup = key.linkGroup()
+	}
+	file, first := s.links.acquire(key, links, params)
+	if first {
+		err := compute()
+		file.complete(entity, err)
+		return err
+	}
+	select {
+	case <-file.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if file.err != nil || file.params != params {
+		return compute()
+	}
+	entity.Checksum, entity.SampleChecksum = file.entity.Checksum, file.entity.SampleChecksum
+	entity.Chunking, entity.ContentType = file.entity.Chunking, file.entity.ContentType
+	s.stats.IncreaseFilesCached()
+	s.stats.AddBytesCached(info.Size())
+	return nil
+}
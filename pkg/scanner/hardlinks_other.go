@@ -0,0 +1,14 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// hardlinksSupported is false because inodes are not available on this platform. Every link is then hashed
+// on its own, and entities record no link group.
+const hardlinksSupported = false
+
+// inodeOf is not available on this platform
+func inodeOf(info os.FileInfo) (key inodeKey, links uint64, ok bool) {
+	return inodeKey{}, 0, false
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinksSupported is true because files record their inode and link count on this platform
+const hardlinksSupported = true
+
+// inodeOf returns the inode of the file described by info and its number of links
+func inodeOf(info os.FileInfo) (key inodeKey, links uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inodeKey{}, 0, false
+	}
+	return inodeKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, uint64(stat.Nlink), true
+}
@@ -0,0 +1,150 @@
+//go:build unix
+
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+const linkedSize = 64 * 1024
+
+// createLinkedTree creates a tree with a file linked three times across two directories, a file of its own
+// and a symbolic link to the linked file
+func createLinkedTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a", "data.bin"), bytes.Repeat([]byte("x"), linkedSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"a/copy.bin", "b/data.bin"} {
+		if err := os.Link(filepath.Join(dir, "a", "data.bin"), filepath.Join(dir, link)); err != nil {
+			t.Skipf("Hard links are not supported: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b", "own.txt"), []byte("own"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("data.bin", filepath.Join(dir, "b", "symlink.bin")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// walkLinkedTree generates the manifests of dir and returns them by relative path
+func walkLinkedTree(t *testing.T, sc *Scanner, dir string) map[string]*manifest.Manifest {
+	t.Helper()
+	manifests := make(map[string]*manifest.Manifest)
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, dirPath)
+		manifests[rel] = m
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	return manifests
+}
+
+func entityOf(t *testing.T, m *manifest.Manifest, name string) manifest.Entity {
+	t.Helper()
+	for _, entity := range m.Entities {
+		if entity.Name == name {
+			return entity
+		}
+	}
+	t.Fatalf("Entity %s not found", name)
+	return manifest.Entity{}
+}
+
+func TestScanner_WithHardlinks_HashesContentOnce(t *testing.T) {
+	dir := createLinkedTree(t)
+	sc := New(WithWorkersCount(4))
+	manifests := walkLinkedTree(t, sc, dir)
+
+	stats := sc.GetStats()
+	// The symbolic link is hashed on its own, the two other links reuse the checksum of the first one
+	if hashed := stats.BytesHashed(); hashed < 2*linkedSize || hashed >= 3*linkedSize {
+		t.Errorf("Expected the content hashed once for the links and once for the symbolic link, got %d bytes", hashed)
+	}
+	if stats.FilesCached() != 2 || stats.BytesCached() != 2*linkedSize {
+		t.Errorf("Expected 2 links counted as cached with %d bytes, got %d and %d",
+			2*linkedSize, stats.FilesCached(), stats.BytesCached())
+	}
+	if stats.FilesProcessed() != 7 {
+		t.Errorf("Expected 7 entries processed, got %d", stats.FilesProcessed())
+	}
+
+	expected := entityOf(t, manifests["a"], "data.bin")
+	for _, linked := range []manifest.Entity{entityOf(t, manifests["a"], "copy.bin"),
+		entityOf(t, manifests["b"], "data.bin"), entityOf(t, manifests["b"], "symlink.bin")} {
+		if linked.Checksum != expected.Checksum {
+			t.Errorf("Entity %s has checksum %s, expected %s", linked.Name, linked.Checksum, expected.Checksum)
+		}
+		if linked.LinkGroup != "" {
+			t.Errorf("Entity %s records link group %q without tracking", linked.Name, linked.LinkGroup)
+		}
+	}
+	if manifests["."].Hardlinks {
+		t.Error("Expected manifests not to track hard links by default")
+	}
+	// All links were seen, nothing is held once the walk is over
+	if len(sc.links.files) != 0 {
+		t.Errorf("Expected no linked files held after the walk, got %d", len(sc.links.files))
+	}
+}
+
+func TestScanner_WithHardlinkOutsideTree_HoldsItUntilTheWalkEnds(t *testing.T) {
+	dir := createLinkedTree(t)
+	outside := filepath.Join(t.TempDir(), "outside.bin")
+	if err := os.Link(filepath.Join(dir, "a", "data.bin"), outside); err != nil {
+		t.Fatal(err)
+	}
+	sc := New()
+	walkLinkedTree(t, sc, dir)
+	if len(sc.links.files) != 1 {
+		t.Errorf("Expected the file with a link outside the tree held, got %d files", len(sc.links.files))
+	}
+	if sc.GetStats().FilesCached() != 2 {
+		t.Errorf("Expected 2 links counted as cached, got %d", sc.GetStats().FilesCached())
+	}
+}
+
+func TestScanner_WithTrackHardlinks_RecordsLinkGroups(t *testing.T) {
+	dir := createLinkedTree(t)
+	manifests := walkLinkedTree(t, New(WithTrackHardlinks(true)), dir)
+
+	for rel, m := range manifests {
+		if !m.Hardlinks {
+			t.Errorf("Expected manifest of %s to track hard links", rel)
+		}
+	}
+	group := entityOf(t, manifests["a"], "data.bin").LinkGroup
+	if group == "" {
+		t.Fatal("Expected the linked file to record its link group")
+	}
+	for _, linked := range []manifest.Entity{entityOf(t, manifests["a"], "copy.bin"), entityOf(t, manifests["b"], "data.bin")} {
+		if linked.LinkGroup != group {
+			t.Errorf("Entity %s records link group %q, expected %q", linked.Name, linked.LinkGroup, group)
+		}
+	}
+	for _, single := range []manifest.Entity{entityOf(t, manifests["b"], "own.txt"), entityOf(t, manifests["b"], "symlink.bin")} {
+		if single.LinkGroup != "" {
+			t.Errorf("Entity %s is not a hard link, but records link group %q", single.Name, single.LinkGroup)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+)
+
+// Hasher computes the checksums of regular files in place of the scanner reading them, e.g. on a storage appliance
+// hashing its files server-side, see WithHasher. Manifests record the checksums as they are, so a hasher must be
+// deterministic and return the lowercase hex encoded checksum of the whole content of the file in the algorithm it
+// names, the one of the checksums of manifests. It is called concurrently by the workers of the scanner.
+type Hasher interface {
+	// Hash returns the checksum of the file at path, described by info, and the bytes to count as hashed in
+	// Stats. The path is the one the scanner walks, on the file system of WithFS when there is one. Errors fail
+	// the scan like read errors do, unless they wrap fs.ErrNotExist for a file that vanished, see
+	// WithTolerateVanished.
+	Hash(ctx context.Context, path string, info fs.FileInfo) (checksum string, bytesCounted int64, err error)
+	// Algorithm names the checksum algorithm, it must be ChecksumAlgorithmSHA256
+	Algorithm() string
+}
+
+// FileHasher is a Hasher reading files from a file system, the way the scanner does without WithHasher. Hashers
+// of remote storage can fall back to it for the files they cannot hash.
+type FileHasher struct {
+	fsys    fileSystem
+	buffers *bufferPool
+}
+
+// NewFileHasher creates a FileHasher reading from fsys, the local file system when it is nil
+func NewFileHasher(fsys fs.FS) *FileHasher {
+	h := &FileHasher{fsys: osFileSystem{}, buffers: newBufferPool(DefaultReadBufferSize)}
+	if fsys != nil {
+		h.fsys = ioFileSystem{fsys: fsys}
+	}
+	return h
+}
+
+// Hash reads the file at path and returns its checksum, counting the bytes read
+func (h *FileHasher) Hash(ctx context.Context, path string, _ fs.FileInfo) (string, int64, error) {
+	var stats Stats
+	checksum, err := calculateChecksum(ctx, h.fsys, path, &stats, nil, h.buffers, nil)
+	return checksum, stats.BytesHashed(), err
+}
+
+// Algorithm returns ChecksumAlgorithmSHA256
+func (h *FileHasher) Algorithm() string {
+	return ChecksumAlgorithmSHA256
+}
+
+// checkHasher rejects a hasher of WithHasher computing checksums in another algorithm than the one of manifests
+func (s *Scanner) checkHasher() error {
+	if h := s.options.hasher; h != nil && h.Algorithm() != ChecksumAlgorithmSHA256 {
+		return fmt.Errorf("hasher algorithm '%s' does not match the checksums of manifests, expected '%s'",
+			h.Algorithm(), ChecksumAlgorithmSHA256)
+	}
+	return nil
+}
+
+// isChecksumSHA256 reports whether checksum is the lowercase hex encoding of a SHA-256 digest
+func isChecksumSHA256(checksum string) bool {
+	if len(checksum) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range checksum {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// hash computes the checksum of the regular file at fpath, with the hasher of WithHasher when there is one.
+// classify is given the first bytes of the file, which are read on their own for a hasher, see readFile.
+func (s *Scanner) hash(ctx context.Context, fpath string, classify func(head []byte)) (string, error) {
+	h := s.options.hasher
+	if h == nil {
+		// Bytes are counted as they are read, so that progress is reported within large files
+		return calculateChecksum(ctx, s.fs, fpath, &s.stats, s.limiter, s.buffers, classify)
+	}
+	info, err := s.fs.Stat(fpath)
+	if err != nil {
+		return "", err
+	}
+	s.stats.SetCurrentFile(fpath)
+	checksum, counted, err := h.Hash(ctx, fpath, info)
+	if err != nil {
+		return "", err
+	}
+	if !isChecksumSHA256(checksum) {
+		return "", fmt.Errorf("hasher returned an invalid checksum '%s' for %s, expected 64 lowercase hex characters",
+			checksum, fpath)
+	}
+	s.stats.AddBytesHashed(counted)
+	if classify != nil {
+		head, err := readHead(s.fs, fpath)
+		if err != nil {
+			return "", err
+		}
+		classify(head)
+	}
+	return checksum, nil
+}
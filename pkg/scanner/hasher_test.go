@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// fakeHasher records the paths it hashes and returns a checksum derived from the name of the file, see fakeChecksum,
+// or checksum when it is set
+type fakeHasher struct {
+	mu        sync.Mutex
+	paths     []string
+	algorithm string
+	checksum  string
+	err       error
+}
+
+// fakeChecksum returns the checksum fakeHasher returns for the file name, which differs from the one of its content
+func fakeChecksum(name string) string {
+	sum := sha256.Sum256([]byte("fake-" + name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *fakeHasher) Hash(ctx context.Context, path string, info fs.FileInfo) (string, int64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paths = append(h.paths, path)
+	if h.err != nil {
+		return "", 0, h.err
+	}
+	if h.checksum != "" {
+		return h.checksum, 1000, nil
+	}
+	return fakeChecksum(info.Name()), 1000, nil
+}
+
+func (h *fakeHasher) Algorithm() string {
+	if h.algorithm != "" {
+		return h.algorithm
+	}
+	return ChecksumAlgorithmSHA256
+}
+
+func createHasherTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", filepath.Join("sub", "b.txt")} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestScanner_WithHasher_HashesFilesOnly(t *testing.T) {
+	dir := createHasherTree(t)
+	hasher := &fakeHasher{}
+	sc := New(WithHasher(hasher))
+	var root *manifest.Manifest
+	// Saving the manifests makes the scan of the root read the manifest of sub
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		root = m
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	sort.Strings(hasher.paths)
+	expected := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "b.txt")}
+	if strings.Join(hasher.paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the hasher called for %v, got %v", expected, hasher.paths)
+	}
+	for _, entity := range root.Entities {
+		if entity.Name == "a.txt" && entity.Checksum != fakeChecksum("a.txt") {
+			t.Errorf("Expected the checksum of the hasher recorded, got %s", entity.Checksum)
+		}
+		if entity.Name == "sub" && entity.Checksum == fakeChecksum("sub") {
+			t.Errorf("Expected the manifest of sub hashed by the scanner, got %s", entity.Checksum)
+		}
+	}
+	// The files count as the hasher says, the manifest of sub is not counted
+	if hashed := sc.GetStats().BytesHashed(); hashed != 2000 {
+		t.Errorf("Expected 2000 bytes hashed for the files, got %d", hashed)
+	}
+	if covered := sc.GetStats().BytesCovered(); covered != 14 {
+		t.Errorf("Expected 14 bytes covered for the files, got %d", covered)
+	}
+}
+
+func TestScanner_WithHasher_FailingHasherFailsWalk(t *testing.T) {
+	dir := createHasherTree(t)
+	hashErr := errors.New("appliance unreachable")
+	sc := New(WithHasher(&fakeHasher{err: hashErr}))
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	})
+	if !errors.Is(err, hashErr) {
+		t.Errorf("Expected the error of the hasher, got %v", err)
+	}
+}
+
+func TestScanner_WithHasher_OtherAlgorithmIsRejected(t *testing.T) {
+	hasher := &fakeHasher{algorithm: "blake3"}
+	err := New(WithHasher(hasher)).Walk(context.Background(), createHasherTree(t),
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			return err
+		})
+	if err == nil || !strings.Contains(err.Error(), "hasher algorithm 'blake3'") {
+		t.Errorf("Expected the algorithm of the hasher rejected, got %v", err)
+	}
+	if len(hasher.paths) != 0 {
+		t.Errorf("Expected no file hashed, got %v", hasher.paths)
+	}
+}
+
+func TestScanner_WithHasher_InvalidChecksumFailsWalk(t *testing.T) {
+	for _, checksum := range []string{"fake-a.txt", strings.ToUpper(fakeChecksum("a.txt")), fakeChecksum("a.txt")[:62]} {
+		sc := New(WithHasher(&fakeHasher{checksum: checksum}))
+		err := sc.Walk(context.Background(), createHasherTree(t), func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			return err
+		})
+		if err == nil || !strings.Contains(err.Error(), "hasher returned an invalid checksum '"+checksum+"'") {
+			t.Errorf("Expected the checksum %q rejected, got %v", checksum, err)
+		}
+	}
+}
+
+func TestFileHasher_MatchesFileChecksum(t *testing.T) {
+	dir := createHasherTree(t)
+	path := filepath.Join(dir, "a.txt")
+	checksum, counted, err := NewFileHasher(nil).Hash(context.Background(), path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := FileChecksum(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum != expected || counted != int64(len("content")) {
+		t.Errorf("Expected %s and %d bytes, got %s and %d", expected, len("content"), checksum, counted)
+	}
+
+	checksum, _, err = NewFileHasher(os.DirFS(dir)).Hash(context.Background(), "a.txt", nil)
+	if err != nil || checksum != expected {
+		t.Errorf("Expected %s read through the file system, got %s (%v)", expected, checksum, err)
+	}
+}
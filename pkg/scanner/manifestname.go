@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// alternativeManifestNames are names manifests are commonly stored under, tried before parsing other files
+var alternativeManifestNames = []string{manifest.DefaultName, "bytecheck.manifest", ".bytecheck.json", "manifest.json"}
+
+// maxProbedManifestSize bounds the files FindManifestName parses, larger ones are not taken for manifests
+const maxProbedManifestSize = 4 << 20
+
+// FindManifestName looks in dirPath for a manifest stored under another name than the configured one:
+// a file with one of a few common names, or any other file parsing as a valid manifest. It returns that name,
+// or an empty name if there is none. root is the root of the tree, whose manifest may be named differently,
+// see WithManifestNameFunc. It explains verifications finding no manifest and only reads the files of dirPath.
+func (s *Scanner) FindManifestName(root, dirPath string) (string, error) {
+	entries, err := s.fs.ReadDir(dirPath)
+	if err != nil {
+		return "", err
+	}
+	candidates := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && entry.Name() != s.ManifestName(dirPath, s.fs.Join(dirPath) == s.fs.Join(root)) {
+			candidates = append(candidates, entry.Name())
+		}
+	}
+	// Common names are preferred, the others are tried in order
+	rank := func(name string) int {
+		for i, alternative := range alternativeManifestNames {
+			if name == alternative {
+				return i
+			}
+		}
+		return len(alternativeManifestNames)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return rank(candidates[i]) < rank(candidates[j]) })
+	for _, candidate := range candidates {
+		if s.isManifest(s.fs.Join(dirPath, candidate)) {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// isManifest reports whether the file at fpath parses as a valid manifest
+func (s *Scanner) isManifest(fpath string) bool {
+	info, err := s.fs.Lstat(fpath)
+	if err != nil || info.Size() > maxProbedManifestSize {
+		return false
+	}
+	data, err := s.fs.ReadFile(fpath)
+	if err != nil {
+		return false
+	}
+	_, err = manifest.Parse(data)
+	return err == nil
+}
+
+// checkManifestName makes sure the name resolved for the manifest of dir, see WithManifestNameFunc, names a file
+// that can hold it: a file name without a directory, other than the files bytecheck keeps next to manifests,
+// and not an entry of dir that is not a regular file, which would otherwise be left out of the manifest.
+// Names resolved by WithManifestNameFunc must not name an existing file that is not a manifest either, so that
+// generate does not overwrite a data file; invalid manifests stored under such names must be removed first.
+func (s *Scanner) checkManifestName(dir, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid manifest name '%s' for %s: must be a file name without a directory", name, dir)
+	}
+	if name == DirConfigName || name == lock.Name {
+		return fmt.Errorf("invalid manifest name '%s' for %s: reserved by bytecheck", name, dir)
+	}
+	info, err := s.fs.Lstat(s.fs.Join(dir, name))
+	if err != nil {
+		return nil
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("manifest name '%s' for %s collides with an entry that is not a regular file", name, dir)
+	}
+	if s.options.manifestNameFunc != nil {
+		data, err := s.fs.ReadFile(s.fs.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if _, err := manifest.Parse(data); err != nil {
+			return fmt.Errorf("manifest name '%s' for %s collides with a file that is not a valid manifest: %w", name, dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func TestScanner_FindManifestName(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A JSON file which is not a manifest must not be taken for one
+	if err := os.WriteFile(filepath.Join(root, "a", "b", "data.json"), []byte(`{"entities": []}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sc := New()
+	name, err := sc.FindManifestName(root, filepath.Join(root, "a", "b"))
+	if err != nil || name != "" {
+		t.Fatalf("Expected no manifest name, got %q, %v", name, err)
+	}
+
+	for _, dir := range []string{"a/b", "a", "."} {
+		m := &manifest.Manifest{Entities: []manifest.Entity{{Name: "x", Checksum: "00"}}}
+		if err := m.Save(filepath.Join(root, dir, "custom.manifest")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name, err = sc.FindManifestName(root, filepath.Join(root, "a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "custom.manifest" {
+		t.Errorf("Expected a manifest named custom.manifest, got %q", name)
+	}
+}
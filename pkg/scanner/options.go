@@ -1,16 +1,146 @@
 package scanner
 
 import (
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"io/fs"
+	"log/slog"
+	"os"
 	"runtime"
 	"time"
 )
 
+// FreshnessMode selects how the scanner decides whether an existing manifest is fresh
+type FreshnessMode string
+
+const (
+	// FreshnessModeMtime uses the modification time of the manifest file
+	FreshnessModeMtime FreshnessMode = "mtime"
+	// FreshnessModeEmbedded uses the generation time and directory fingerprint stored in the manifest
+	FreshnessModeEmbedded FreshnessMode = "embedded"
+)
+
+// ParseFreshnessMode converts a string into a FreshnessMode
+func ParseFreshnessMode(mode string) (FreshnessMode, error) {
+	switch FreshnessMode(mode) {
+	case FreshnessModeMtime, FreshnessModeEmbedded:
+		return FreshnessMode(mode), nil
+	}
+	return "", fmt.Errorf("unknown freshness mode '%s', expected '%s' or '%s'", mode, FreshnessModeMtime, FreshnessModeEmbedded)
+}
+
+// SpecialFilesPolicy selects how the scanner handles sockets, FIFOs and device nodes, which are never read
+type SpecialFilesPolicy string
+
+const (
+	// SpecialFilesRecord records special files with a checksum derived from their kind and name
+	SpecialFilesRecord SpecialFilesPolicy = "record"
+	// SpecialFilesSkip leaves special files out of manifests
+	SpecialFilesSkip SpecialFilesPolicy = "skip"
+)
+
+// ParseSpecialFilesPolicy converts a string into a SpecialFilesPolicy
+func ParseSpecialFilesPolicy(policy string) (SpecialFilesPolicy, error) {
+	switch SpecialFilesPolicy(policy) {
+	case SpecialFilesRecord, SpecialFilesSkip:
+		return SpecialFilesPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown special files policy '%s', expected '%s' or '%s'", policy, SpecialFilesRecord, SpecialFilesSkip)
+}
+
+// HiddenPolicy selects how the scanner handles hidden files and directories, whose name starts with a dot,
+// see manifest.IsHidden. It is recorded in manifests, see manifest.Manifest.HiddenPolicy.
+type HiddenPolicy string
+
+const (
+	// HiddenInclude lists hidden entries like any other
+	HiddenInclude HiddenPolicy = "include"
+	// HiddenExclude leaves hidden entries out of manifests and does not descend into hidden directories.
+	// The manifest itself is not an entry and is still read and written.
+	HiddenExclude HiddenPolicy = "exclude"
+	// HiddenWarn lists hidden entries like HiddenInclude, but hidden directories created after generation, and
+	// the ones below, may lack a manifest. Verification tags their differences, see manifest.EntityDifference.Hidden.
+	HiddenWarn HiddenPolicy = "warn"
+)
+
+// ParseHiddenPolicy converts a string into a HiddenPolicy
+func ParseHiddenPolicy(policy string) (HiddenPolicy, error) {
+	switch HiddenPolicy(policy) {
+	case HiddenInclude, HiddenExclude, HiddenWarn:
+		return HiddenPolicy(policy), nil
+	}
+	return "", fmt.Errorf("unknown hidden policy '%s', expected '%s', '%s' or '%s'",
+		policy, HiddenInclude, HiddenExclude, HiddenWarn)
+}
+
+// recorded returns the value of manifest.Manifest.HiddenPolicy for manifests listed with the policy
+func (p HiddenPolicy) recorded() string {
+	if p == HiddenInclude {
+		return ""
+	}
+	return string(p)
+}
+
+// ChecksumCache remembers file checksums between runs, see state.Store
+type ChecksumCache interface {
+	Lookup(path string, info os.FileInfo) (string, bool)
+	Update(path string, info os.FileInfo, checksum string)
+}
+
+// ResumableChecksumCache is a ChecksumCache also remembering how far the chunked checksum of a file got before
+// it was interrupted, so that a later run resumes it from the end of its last completed chunk instead of reading
+// the file from its start, see WithChunking. hashState is the state of the checksum of the whole file, as saved
+// by encoding.BinaryMarshaler. Progress only applies to a file unchanged since it was recorded.
+type ResumableChecksumCache interface {
+	ChecksumCache
+	LookupProgress(path string, info os.FileInfo, chunkSize int64) (chunkDigests []string, hashState []byte, ok bool)
+	UpdateProgress(path string, info os.FileInfo, chunkSize int64, chunkDigests []string, hashState []byte)
+}
+
 type options struct {
-	workersCount           int
-	manifestName           string
-	manifestFreshnessLimit *time.Duration
-	progressChannel        chan *Stats
-	reportInterval         time.Duration
+	workersCount            int
+	manifestName            string
+	manifestNameFunc        ManifestNameFunc
+	manifestFreshnessLimit  *time.Duration
+	freshnessMode           FreshnessMode
+	specialFiles            SpecialFilesPolicy
+	hiddenPolicy            HiddenPolicy
+	checksumCache           ChecksumCache
+	hasher                  Hasher
+	trackPermissions        bool
+	trackXattrs             bool
+	trackHardlinks          bool
+	sampling                *manifest.Sampling
+	sampledVerification     bool
+	chunkSize               int64
+	chunkedVerification     bool
+	contentTypes            bool
+	contentTypeVerification bool
+	fastVerification        bool
+	changedSince            time.Time
+	allowMissingManifests   bool
+	expectedManifests       ExpectedManifestFunc
+	tolerateVanished        bool
+	tolerateLongPaths       bool
+	freshListingCheck       bool
+	excludes                []string
+	maxDepth                int
+	only                    []string
+	oneFileSystem           bool
+	maxBytesPerSecond       int64
+	readBufferSize          int
+	logger                  *slog.Logger
+	dirStartHook            func(dirPath string)
+	tracer                  telemetry.Tracer
+	dirSpanThreshold        time.Duration
+	fsys                    fs.FS
+	overlay                 *ManifestOverlay
+	progressChannel         chan *Stats
+	progress                *ProgressSource
+	reportInterval          time.Duration
+	// mountpoint overrides the device comparison of WithOneFileSystem, it lets tests simulate mountpoints
+	mountpoint func(dirPath string) bool
 }
 
 type Option func(opts *options)
@@ -22,6 +152,11 @@ func makeOptions(opts ...Option) *options {
 		reportInterval:         200 * time.Millisecond,
 		manifestName:           ".bytecheck.manifest",
 		manifestFreshnessLimit: nil,
+		freshnessMode:          FreshnessModeMtime,
+		specialFiles:           SpecialFilesRecord,
+		hiddenPolicy:           HiddenInclude,
+		readBufferSize:         DefaultReadBufferSize,
+		maxDepth:               -1,
 	}
 
 	for _, o := range opts {
@@ -37,6 +172,18 @@ func WithWorkersCount(workersCount int) Option {
 	}
 }
 
+// WithProgressSource publishes progress snapshots to source, see Scanner.Walk. The source is left open for
+// further walks, its owner closes it.
+func WithProgressSource(source *ProgressSource) Option {
+	return func(o *options) {
+		o.progress = source
+	}
+}
+
+// WithProgressChannel sends progress snapshots to progressChannel, see Scanner.Walk. Snapshots are dropped
+// while the channel is full, and an unbuffered channel must be received from until Walk returns.
+//
+// Deprecated: Use WithProgressSource, which delivers the latest snapshot to slow consumers.
 func WithProgressChannel(progressChannel chan *Stats) Option {
 	return func(o *options) {
 		o.progressChannel = progressChannel
@@ -49,8 +196,307 @@ func WithManifestFreshnessLimit(limit time.Duration) Option {
 	}
 }
 
+// WithSpecialFiles selects how sockets, FIFOs and device nodes are handled, SpecialFilesRecord by default.
+// See bytecheck.WithSpecialFiles for how trees are generated and verified with it.
+func WithSpecialFiles(policy SpecialFilesPolicy) Option {
+	return func(o *options) {
+		o.specialFiles = policy
+	}
+}
+
+// WithHiddenPolicy selects how hidden files and directories are handled, HiddenInclude by default.
+// Verification fails on manifests generated with another policy instead of reporting the hidden entries as missing
+// or extra, see bytecheck.WithHiddenPolicy.
+func WithHiddenPolicy(policy HiddenPolicy) Option {
+	return func(o *options) {
+		o.hiddenPolicy = policy
+	}
+}
+
+// WithSampling records a sample checksum, in addition to the checksum, of the files larger than the
+// sampling threshold, see manifest.Entity.SampleChecksum
+func WithSampling(sampling manifest.Sampling) Option {
+	return func(o *options) {
+		o.sampling = &sampling
+	}
+}
+
+// WithSampledVerification computes only the sample checksum of the files whose existing manifest records one,
+// with the sampling parameters of that manifest, instead of reading them whole. Other files are hashed whole.
+func WithSampledVerification(enabled bool) Option {
+	return func(o *options) {
+		o.sampledVerification = enabled
+	}
+}
+
+// WithChunking records the checksums of the chunks of chunkSize bytes, in addition to the checksum,
+// of the files larger than one chunk, see manifest.Entity.Chunking
+func WithChunking(chunkSize int64) Option {
+	return func(o *options) {
+		o.chunkSize = chunkSize
+	}
+}
+
+// WithChunkedVerification records the chunks of the files whose existing manifest records them, with the
+// chunk size of that manifest, so that a checksum mismatch can be narrowed down to the chunks that differ
+func WithChunkedVerification(enabled bool) Option {
+	return func(o *options) {
+		o.chunkedVerification = enabled
+	}
+}
+
+// WithContentTypes records the content type of regular files, classified by their first bytes as they are
+// hashed, see manifest.Entity.ContentType
+func WithContentTypes(enabled bool) Option {
+	return func(o *options) {
+		o.contentTypes = enabled
+	}
+}
+
+// WithContentTypeVerification records the content type of the files whose existing manifest records one,
+// so that a checksum mismatch tells what the file was and what it is now
+func WithContentTypeVerification(enabled bool) Option {
+	return func(o *options) {
+		o.contentTypeVerification = enabled
+	}
+}
+
+// WithFastVerification records only the size of the files whose size differs from the one recorded by the
+// expected manifest of their directory, without reading them, see WithExpectedManifests. Comparing the manifests
+// reports such files with manifest.DiffSizeMismatch instead of their new checksum.
+func WithFastVerification(enabled bool) Option {
+	return func(o *options) {
+		o.fastVerification = enabled
+	}
+}
+
+// WithChangedSince trusts the checksums recorded by the expected manifest for the regular files not modified
+// since cutoff, of the same size, instead of reading them, see WithExpectedManifests. A directory whose listing
+// matches its manifest, whose files were all left unread and whose subdirectory manifests did not change is
+// reused like a fresh manifest, unless permissions or extended attributes are tracked. The zero time reads
+// every file.
+func WithChangedSince(cutoff time.Time) Option {
+	return func(o *options) {
+		o.changedSince = cutoff
+	}
+}
+
+// WithAllowMissingManifests records subdirectories without a manifest with no checksum instead of failing,
+// see manifest.Entity.Unmanaged. Comparing the manifests of their parents does not report their checksum.
+func WithAllowMissingManifests(allow bool) Option {
+	return func(o *options) {
+		o.allowMissingManifests = allow
+	}
+}
+
+// ExpectedManifestFunc returns the manifest the entries of dirPath are expected to match, nil if there is none
+type ExpectedManifestFunc func(dirPath string) *manifest.Manifest
+
+// WithExpectedManifests supplies the manifests consulted by sampled, chunked and fast verifications.
+// By default the manifest stored in each directory is loaded.
+func WithExpectedManifests(fn ExpectedManifestFunc) Option {
+	return func(o *options) {
+		o.expectedManifests = fn
+	}
+}
+
+// WithFreshnessMode selects how manifest freshness is determined, see FreshnessMode
+func WithFreshnessMode(mode FreshnessMode) Option {
+	return func(o *options) {
+		o.freshnessMode = mode
+	}
+}
+
+// WithChecksumCache makes the scanner reuse checksums of unchanged files from the cache. Chunked checksums
+// interrupted by a cancelled walk are resumed when the cache is a ResumableChecksumCache.
+func WithChecksumCache(cache ChecksumCache) Option {
+	return func(o *options) {
+		o.checksumCache = cache
+	}
+}
+
+// WithHasher makes the scanner compute the checksums of regular files with h instead of reading them, see Hasher.
+// The checksum cache of WithChecksumCache is still looked up first, and chunked and sampled checksums, see
+// WithChunking and WithSampling, as well as the checksums of manifests, are computed by reading the files.
+// WithMaxBytesPerSecond does not throttle the hasher.
+func WithHasher(h Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithTrackPermissions records the mode and, on Unix, the owner of every entity
+func WithTrackPermissions(track bool) Option {
+	return func(o *options) {
+		o.trackPermissions = track
+	}
+}
+
+// WithXattrs records a digest of the extended attributes of every entity, which include POSIX ACLs,
+// see manifest.XattrsDigest. Nothing is recorded where the platform or file system do not support them,
+// or when reading a file system given by WithFS.
+func WithXattrs(track bool) Option {
+	return func(o *options) {
+		o.trackXattrs = track
+	}
+}
+
+// WithTrackHardlinks records the link group of files with several hard links, see manifest.Entity.LinkGroup,
+// so that verification reports links broken since. Nothing is recorded where the platform does not tell the
+// inodes of files, or when reading a file system given by WithFS.
+func WithTrackHardlinks(track bool) Option {
+	return func(o *options) {
+		o.trackHardlinks = track
+	}
+}
+
+// WithTolerateVanished makes the scanner skip files and directories that disappear
+// between listing and hashing instead of failing, see Stats.EntriesVanished
+func WithTolerateVanished(tolerate bool) Option {
+	return func(o *options) {
+		o.tolerateVanished = tolerate
+	}
+}
+
+// WithTolerateLongPaths makes the scanner leave out directories whose path, or the path of their manifest,
+// is longer than the OS allows (ENAMETOOLONG) instead of failing. Their parents do not list them, each one is
+// logged as a warning and counted, see Stats.DirectoriesTooLong.
+func WithTolerateLongPaths(tolerate bool) Option {
+	return func(o *options) {
+		o.tolerateLongPaths = tolerate
+	}
+}
+
+// WithExcludes leaves out files and directories whose name matches any of the patterns,
+// see filepath.Match. Excluded directories get no manifest and are not descended into.
+func WithExcludes(patterns ...string) Option {
+	return func(o *options) {
+		o.excludes = append(o.excludes, patterns...)
+	}
+}
+
+// WithMaxDepth leaves out directories more than n levels below the walk root. They get no manifest
+// and their parents do not list them, as if they were excluded, so the same depth must be used to
+// generate and to verify a tree. 0 keeps only the root, a negative n means unlimited.
+func WithMaxDepth(n int) Option {
+	return func(o *options) {
+		o.maxDepth = n
+	}
+}
+
+// WithOneFileSystem leaves out subdirectories on another file system than the walk root, e.g. bind or network
+// mounts. They get no manifest and their parents do not list them as entities but record their names in
+// manifest.Manifest.Mountpoints, so that mounts appearing or disappearing are not reported as differences.
+// The same setting must be used to generate and to verify a tree. It has no effect on platforms without device
+// IDs, like Windows, and for trees read through an fs.FS.
+func WithOneFileSystem(enabled bool) Option {
+	return func(o *options) {
+		o.oneFileSystem = enabled
+	}
+}
+
+// WithOnly restricts a walk to the directories whose slash-separated path relative to the walk root
+// matches any of the patterns, see path.Match, and everything below them. Their ancestors are
+// always rescanned, ignoring freshness, so that they record the new checksums of the subtrees.
+// Other directories are not visited; their existing manifests are checksummed by their parents as usual.
+func WithOnly(patterns ...string) Option {
+	return func(o *options) {
+		o.only = append(o.only, patterns...)
+	}
+}
+
+// WithMaxBytesPerSecond limits the aggregate read bandwidth of all workers, 0 means unlimited
+func WithMaxBytesPerSecond(n int64) Option {
+	return func(o *options) {
+		o.maxBytesPerSecond = n
+	}
+}
+
+// WithReadBufferSize sets how many bytes are read from a file at once while hashing,
+// values below 1 select DefaultReadBufferSize. Buffers are pooled and shared by all workers.
+func WithReadBufferSize(bytes int) Option {
+	return func(o *options) {
+		o.readBufferSize = bytes
+	}
+}
+
+// WithLogger reports scan events to logger instead of logging.Logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithDirStartHook calls hook right before each directory is scanned, from the goroutine calling Walk, e.g. to
+// show which directory is being processed. Directories are scanned in post-order, so the hook sees them in the
+// order ScannedDirFunc does, each after its subdirectories. The hook is not called for directories whose fresh
+// manifest is reused, see WithManifestFreshnessLimit, so a tree that did not change since its manifests were
+// written is walked without calling it. The subdirectories of a directory are visited before its manifest is
+// found fresh: they are only passed to the hook when they are scanned themselves, because their own manifest
+// is not fresh. Directories that are left out, e.g. by WithExcludes, WithOnly or WithMaxDepth, or that cannot
+// be read are never passed to the hook. A nil hook is ignored.
+func WithDirStartHook(hook func(dirPath string)) Option {
+	return func(o *options) {
+		o.dirStartHook = hook
+	}
+}
+
+// WithTracer reports every directory taking at least threshold, from the start of its scan until the
+// ScannedDirFunc returns, as a span of tracer, a child of the span of the context given to Walk. The span records
+// the bytes hashed in the directory and the attributes the ScannedDirFunc adds with telemetry.Annotate.
+// Directories are not traced by default.
+func WithTracer(tracer telemetry.Tracer, threshold time.Duration) Option {
+	return func(o *options) {
+		o.tracer = tracer
+		o.dirSpanThreshold = threshold
+	}
+}
+
+// WithFS makes the scanner read the tree from fsys instead of the OS file system.
+// Paths given to Walk and passed to its callback are then slash-separated fs.FS paths, e.g. "." for the root.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// WithFreshListingCheck reuses fresh manifests only while the directory listing matches their entities by name,
+// kind and recorded size, and the manifests of subdirectories match their recorded checksums, so that touching an
+// outdated manifest does not make it fresh, see WithManifestFreshnessLimit. Only file contents are then trusted
+// without hashing them.
+func WithFreshListingCheck(enabled bool) Option {
+	return func(o *options) {
+		o.freshListingCheck = enabled
+	}
+}
+
+// WithManifestOverlay makes parent directories record the checksums of the subdirectory manifests held
+// by overlay instead of the ones stored in the tree, see ManifestOverlay
+func WithManifestOverlay(overlay *ManifestOverlay) Option {
+	return func(o *options) {
+		o.overlay = overlay
+	}
+}
+
 func WithManifestName(name string) Option {
 	return func(o *options) {
 		o.manifestName = name
 	}
 }
+
+// ManifestNameFunc returns the name of the manifest of dirPath, isRoot telling whether dirPath is the root
+// of the walk. The name must be a file name without a directory. When a subtree of a tree using a distinct
+// root manifest name is walked, isRoot holds for the root of the subtree, whose manifest is stored under the
+// name of the other directories: such functions must then compare dirPath with the root of the whole tree
+// instead of relying on isRoot.
+type ManifestNameFunc func(dirPath string, isRoot bool) string
+
+// WithManifestNameFunc stores and looks up the manifest of each directory under the name fn returns for it,
+// e.g. a distinctive name for the root manifest, instead of the single name of WithManifestName.
+// Generate and verify must resolve the same names for a tree to verify. An existing file under a resolved name
+// must be a valid manifest.
+func WithManifestNameFunc(fn ManifestNameFunc) Option {
+	return func(o *options) {
+		o.manifestNameFunc = fn
+	}
+}
@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// ManifestOverlay holds manifests that replace the ones stored in the scanned tree when a parent
+// directory records the checksum of a subdirectory, see WithManifestOverlay. It lets a dry run compute
+// the manifests a generate run would write without writing any, and a verification check a tree against
+// manifests fetched from elsewhere, see Scanner.LoadManifest. It is safe for concurrent use.
+type ManifestOverlay struct {
+	mu sync.RWMutex
+	// manifests holds the manifests encoded as Save stores them, by manifest path. Nil data stands for
+	// a manifest that does not exist, whatever the tree holds.
+	manifests map[string][]byte
+}
+
+// NewManifestOverlay creates an empty overlay
+func NewManifestOverlay() *ManifestOverlay {
+	return &ManifestOverlay{manifests: make(map[string][]byte)}
+}
+
+// WriteManifest stores m as the manifest at manifestPath, a path as returned by Scanner.ManifestPath.
+// It matches generator.ManifestWriter.
+func (o *ManifestOverlay) WriteManifest(manifestPath string, m *manifest.Manifest) error {
+	data, err := m.Encode()
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.manifests[manifestPath] = data
+	return nil
+}
+
+// SetData stores data, an encoded manifest, as the manifest at manifestPath, nil if there is none.
+// Unlike WriteManifest it keeps the exact bytes, so that parents recording their checksum match.
+func (o *ManifestOverlay) SetData(manifestPath string, data []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.manifests[manifestPath] = data
+}
+
+// data returns the encoded manifest stored at manifestPath, false if there is none
+func (o *ManifestOverlay) data(manifestPath string) ([]byte, bool) {
+	if o == nil {
+		return nil, false
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	data, ok := o.manifests[manifestPath]
+	return data, ok
+}
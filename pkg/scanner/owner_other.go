@@ -0,0 +1,14 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// modeSupported is false because file modes do not carry Unix permission bits on this platform.
+// Not recording them keeps manifests generated on Unix verifiable here without false differences.
+const modeSupported = false
+
+// owner is not available on this platform
+func owner(info os.FileInfo) (uid uint32, gid uint32, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// modeSupported reports whether file modes carry Unix permission bits on this platform
+const modeSupported = true
+
+func owner(info os.FileInfo) (uid uint32, gid uint32, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Uid, stat.Gid, true
+	}
+	return 0, 0, false
+}
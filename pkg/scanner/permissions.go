@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// unixMode converts a FileMode into Unix-style permission bits, including setuid, setgid and sticky bits
+func unixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// recordPermissions stores the mode and, where available, the owner of info in entity
+func recordPermissions(entity *manifest.Entity, info os.FileInfo) {
+	if modeSupported {
+		mode := unixMode(info.Mode())
+		entity.Mode = &mode
+	}
+	if uid, gid, ok := owner(info); ok {
+		entity.UID = &uid
+		entity.GID = &gid
+	}
+}
+
+// recordXattrs stores the digest of the extended attributes of path in entity, where they are supported
+func recordXattrs(entity *manifest.Entity, path string) error {
+	if !xattrsSupported {
+		return nil
+	}
+	attrs, ok, err := readXattrs(path)
+	if err != nil {
+		return fmt.Errorf("failed to read extended attributes of %s: %w", path, err)
+	}
+	if ok {
+		entity.XattrsDigest = manifest.XattrsDigest(attrs)
+	}
+	return nil
+}
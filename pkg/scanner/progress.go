@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// ProgressSource publishes snapshots of the scan statistics with latest-value semantics: a subscriber that
+// falls behind receives the most recent snapshot once it catches up, the ones in between are coalesced.
+// Publishing never blocks, so a slow subscriber cannot hold up the scanner.
+//
+// The scanner publishes a snapshot of the complete statistics when a walk ends. Subscribers receive the latest
+// snapshot before their channel is closed by Close, so the last one they receive shows the final totals.
+type ProgressSource struct {
+	mu          sync.Mutex
+	subscribers map[*progressSubscriber]struct{}
+	latest      *Stats
+	closed      bool
+}
+
+// progressSubscriber holds the snapshot pending delivery to a subscriber, guarded by the mutex of the source
+type progressSubscriber struct {
+	ch      chan *Stats
+	wake    chan struct{}
+	pending *Stats
+	closed  bool
+}
+
+// NewProgressSource creates a source without subscribers
+func NewProgressSource() *ProgressSource {
+	return &ProgressSource{subscribers: make(map[*progressSubscriber]struct{})}
+}
+
+// Subscribe returns a channel receiving the snapshots published from now on, starting with the latest one
+// published so far, if any. Every subscriber receives copies of its own. The channel is closed once the latest
+// snapshot was received after Close, or when ctx ends.
+func (p *ProgressSource) Subscribe(ctx context.Context) <-chan *Stats {
+	sub := &progressSubscriber{ch: make(chan *Stats), wake: make(chan struct{}, 1)}
+	p.mu.Lock()
+	sub.pending, sub.closed = p.latest, p.closed
+	if !p.closed {
+		p.subscribers[sub] = struct{}{}
+	}
+	p.mu.Unlock()
+	sub.notify()
+	go p.deliver(ctx, sub)
+	return sub.ch
+}
+
+// Publish makes stats the latest snapshot, replacing the one still pending for subscribers that did not
+// receive it yet. Snapshots published after Close are dropped.
+func (p *ProgressSource) Publish(stats *Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.latest = stats
+	for sub := range p.subscribers {
+		sub.pending = stats
+		sub.notify()
+	}
+}
+
+// Close ends the subscriptions once their subscribers received the latest snapshot
+func (p *ProgressSource) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for sub := range p.subscribers {
+		sub.closed = true
+		sub.notify()
+	}
+	clear(p.subscribers)
+}
+
+// deliver sends the pending snapshots of sub until it is closed or ctx ends
+func (p *ProgressSource) deliver(ctx context.Context, sub *progressSubscriber) {
+	defer close(sub.ch)
+	defer func() {
+		p.mu.Lock()
+		delete(p.subscribers, sub)
+		p.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.wake:
+		}
+		p.mu.Lock()
+		pending, closed := sub.pending, sub.closed
+		sub.pending = nil
+		p.mu.Unlock()
+		if pending != nil {
+			snapshot := pending.Snapshot()
+			select {
+			case sub.ch <- &snapshot:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// notify wakes the delivery of sub, unless it is already due
+func (sub *progressSubscriber) notify() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sendProgress sends stats to ch of WithProgressChannel without blocking, dropping it when ch is full. The final
+// snapshot drops the pending ones instead to make room, the final one supersedes them, and is waited on when ch
+// is unbuffered.
+func sendProgress(ch chan *Stats, stats *Stats, final bool) {
+	if ch == nil {
+		return
+	}
+	if !final {
+		select {
+		case ch <- stats:
+		default: // channel is full, skip
+		}
+		return
+	}
+	if cap(ch) == 0 {
+		ch <- stats
+		return
+	}
+	for {
+		select {
+		case ch <- stats:
+			return
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}
+}
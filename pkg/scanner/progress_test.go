@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// createProgressTree creates dirs directories of a file each in a temporary directory
+func createProgressTree(t *testing.T, dirs int) string {
+	t.Helper()
+	tempDir := t.TempDir()
+	for i := range dirs {
+		dirPath := filepath.Join(tempDir, fmt.Sprintf("dir%d", i))
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dirPath, "file.txt"), []byte(fmt.Sprint(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tempDir
+}
+
+func walkWith(t *testing.T, sc *Scanner, dir string) {
+	t.Helper()
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		// Parents record the checksums of the manifests of their children
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+}
+
+func TestProgressSource_WithSlowSubscriber_mustDeliverFinalTotals(t *testing.T) {
+	dir := createProgressTree(t, 50)
+	source := NewProgressSource()
+	sc := New(WithProgressSource(source))
+
+	updates := source.Subscribe(context.Background())
+	received := make(chan []*Stats)
+	go func() {
+		var snapshots []*Stats
+		for stats := range updates {
+			snapshots = append(snapshots, stats)
+			time.Sleep(50 * time.Millisecond)
+		}
+		received <- snapshots
+	}()
+
+	walkWith(t, sc, dir)
+	source.Close()
+	snapshots := <-received
+
+	if len(snapshots) == 0 {
+		t.Fatal("Expected progress updates but got none")
+	}
+	last := snapshots[len(snapshots)-1]
+	if expected := sc.GetStats().Snapshot(); !reflect.DeepEqual(last, &expected) {
+		t.Errorf("Final snapshot %+v differs from the statistics %+v", last, &expected)
+	}
+	if last.DirsProcessed() != 51 || last.FilesProcessed() != 100 {
+		t.Errorf("Expected 51 directories and 100 entries, got %d and %d", last.DirsProcessed(), last.FilesProcessed())
+	}
+	for i := 1; i < len(snapshots); i++ {
+		if snapshots[i] == snapshots[i-1] || snapshots[i].DirsProcessed() < snapshots[i-1].DirsProcessed() {
+			t.Errorf("Snapshot %d is not a newer copy of the one before", i)
+		}
+	}
+}
+
+func TestProgressSource_WithBlockedSubscriber_mustNotBlockScanner(t *testing.T) {
+	dir := createProgressTree(t, 20)
+	source := NewProgressSource()
+	sc := New(WithProgressSource(source))
+	// Two subscribers that do not receive anything until the walks end
+	first, second := source.Subscribe(context.Background()), source.Subscribe(context.Background())
+
+	walked := make(chan struct{})
+	go func() {
+		defer close(walked)
+		walkWith(t, sc, dir)
+		// Walks of a shared source publish their final snapshot each
+		walkWith(t, sc, dir)
+	}()
+	select {
+	case <-walked:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Walk blocked on subscribers that do not receive")
+	}
+	source.Close()
+
+	expected := sc.GetStats().Snapshot()
+	for i, updates := range []<-chan *Stats{first, second} {
+		var snapshots []*Stats
+		for stats := range updates {
+			snapshots = append(snapshots, stats)
+		}
+		// The latest snapshot was pending when the first one was received, all the ones between are coalesced
+		if len(snapshots) > 2 {
+			t.Errorf("Subscriber %d: expected coalesced snapshots, got %d", i, len(snapshots))
+		}
+		if len(snapshots) == 0 || !reflect.DeepEqual(snapshots[len(snapshots)-1], &expected) {
+			t.Errorf("Subscriber %d: expected the final snapshot %+v last, got %+v", i, &expected, snapshots)
+		}
+	}
+}
+
+func TestProgressSource_Subscribe_AfterClose_mustDeliverLatest(t *testing.T) {
+	source := NewProgressSource()
+	stats := &Stats{}
+	stats.AddBytesHashed(42)
+	source.Publish(stats)
+	source.Close()
+	source.Publish(&Stats{})
+
+	var snapshots []*Stats
+	for stats := range source.Subscribe(context.Background()) {
+		snapshots = append(snapshots, stats)
+	}
+	if len(snapshots) != 1 || snapshots[0].BytesHashed() != 42 {
+		t.Errorf("Expected the snapshot published before Close alone, got %+v", snapshots)
+	}
+}
+
+func TestProgressSource_Subscribe_mustCloseWhenContextEnds(t *testing.T) {
+	source := NewProgressSource()
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := source.Subscribe(ctx)
+	source.Publish(&Stats{})
+	cancel()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected the subscription to be closed once its context ended")
+		}
+	}
+}
@@ -2,87 +2,489 @@ package scanner
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/logging"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
 	"github.com/tomekjarosik/bytecheck/pkg/traverse"
 	"golang.org/x/sync/errgroup"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
 )
 
+// ScannedDirFunc is called by Walk with the manifest computed for each directory, or the error scanning it.
+// Cached is true when the existing manifest was fresh and reused, see WithManifestFreshnessLimit.
 type ScannedDirFunc func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error
 
+// ScannedDirInfoFunc is the ScannedDirFunc of WalkWithInfo, given how the directory was scanned
+type ScannedDirInfoFunc func(ctx context.Context, dirPath string, m *manifest.Manifest, info ScanInfo, err error) error
+
+// withInfo returns fn as a ScannedDirInfoFunc
+func (fn ScannedDirFunc) withInfo() ScannedDirInfoFunc {
+	return func(ctx context.Context, dirPath string, m *manifest.Manifest, info ScanInfo, err error) error {
+		return fn(ctx, dirPath, m, info.Cached, err)
+	}
+}
+
+// ScanInfo describes how the directory passed to a ScannedDirInfoFunc was scanned
+type ScanInfo struct {
+	// Cached is true when the existing manifest was fresh and reused, see WithManifestFreshnessLimit
+	Cached bool
+	// Duration is the time from entering the directory until its manifest was complete, including the check of
+	// its existing manifest. It excludes the subdirectories, which are scanned before.
+	Duration time.Duration
+}
+
 // Scanner handles file system scanning and checksum calculation
 type Scanner struct {
 	lastReportTime time.Time
 	stats          Stats
 	options        *options
+	fs             fileSystem
+	limiter        *bandwidthLimiter
+	buffers        *bufferPool
+	configs        dirConfigs
 	progressMutex  sync.Mutex
+	// rootDevice is the device of the walk root, nil when unknown, see WithOneFileSystem
+	rootDevice *uint64
+	// tooLong holds the directories of the current walk left out by WithTolerateLongPaths. It is written
+	// between directory scans and read by the workers scanning their parents.
+	tooLong map[string]bool
+	// subtrees holds the totals of the directories scanned by the current walk until their parent is scanned.
+	// It is written between directory scans and read by the workers scanning their parents.
+	subtrees map[string]*manifest.SubtreeTotals
+	// links holds the checksums of the files with several hard links hashed during the current walk
+	links *hardlinks
+	// root is the root of the current walk, the directory whose manifest is resolved as the root one,
+	// see WithManifestNameFunc and SetRoot
+	root string
 }
 
 // New creates a new Scanner instance
 func New(opts ...Option) *Scanner {
-	return &Scanner{
+	s := &Scanner{
 		options: makeOptions(opts...),
+		fs:      osFileSystem{},
+	}
+	s.buffers = newBufferPool(s.options.readBufferSize)
+	if s.options.fsys != nil {
+		s.fs = ioFileSystem{fsys: s.options.fsys}
 	}
+	if s.options.maxBytesPerSecond > 0 {
+		s.limiter = newBandwidthLimiter(s.options.maxBytesPerSecond)
+	}
+	return s
 }
 
 // Walk walks the file tree rooted at root, calling walkFn for each directory.
 // It processes directories in POST-ORDER (children before parents) which is perfect
 // for calculating directory checksums based on manifest files that depend on child manifests.
+// Progress snapshots are sent to the progress channel while walking, dropping them when the channel
+// is full, except for the final one, which is always sent before Walk returns. Nothing is sent afterwards,
+// so the owner of the channel may close it once Walk has returned.
 func (s *Scanner) Walk(ctx context.Context, root string, walkFn ScannedDirFunc) error {
-	statsCtx, cancelStats := context.WithCancel(ctx)
-	defer cancelStats()
-	s.stats.Start(statsCtx, func(stats *Stats) {
-		select {
-		case <-statsCtx.Done():
-			return
-		case s.options.progressChannel <- stats:
-		default: // channel is full, skip
-		}
-	}, 100*time.Millisecond)
-	return traverse.WalkPostOrder(ctx, root, func(ctx context.Context, dirPath string, err error) error {
+	return s.walk(ctx, root, s.onlyPatterns(), walkFn.withInfo())
+}
+
+// WalkWithInfo is like Walk but passes walkFn how each directory was scanned, e.g. how long it took
+func (s *Scanner) WalkWithInfo(ctx context.Context, root string, walkFn ScannedDirInfoFunc) error {
+	return s.walk(ctx, root, s.onlyPatterns(), walkFn)
+}
+
+// WalkChanged is like Walk but only visits the directories affected by changes of changedPaths, which are inside root:
+// a changed directory and all its subdirectories, or for other paths the nearest existing directory above them,
+// followed by their ancestors up to root. The ancestors are always rescanned, so that they record the new checksums.
+// Changes that cannot affect any manifest are ignored, e.g. of excluded paths, paths deeper than WithMaxDepth,
+// or manifests themselves. Nothing is visited when all changes are ignored. Patterns given by WithOnly do not apply.
+func (s *Scanner) WalkChanged(ctx context.Context, root string, changedPaths []string, walkFn ScannedDirFunc) error {
+	var targets []onlyPattern
+	for _, changedPath := range changedPaths {
+		target, affected, err := s.changeTarget(root, changedPath)
 		if err != nil {
-			return walkFn(ctx, dirPath, nil, false, err)
+			return err
 		}
-		m, cached, err := s.scanDirectory(ctx, dirPath)
-		return walkFn(ctx, dirPath, m, cached, err)
-	})
+		if affected {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return s.walk(ctx, root, targets, walkFn.withInfo())
+}
+
+// WalkDirectories is like WalkChanged but visits each directory of dirPaths, which are inside root, without its
+// subdirectories, followed by their ancestors up to root. The subdirectories are represented by their existing
+// manifests. Excluded directories and directories deeper than WithMaxDepth are ignored. Patterns given by
+// WithOnly do not apply.
+func (s *Scanner) WalkDirectories(ctx context.Context, root string, dirPaths []string, walkFn ScannedDirFunc) error {
+	var targets []onlyPattern
+	for _, dirPath := range dirPaths {
+		elems := s.fs.RelElems(root, dirPath)
+		if slices.Contains(elems, "..") {
+			return fmt.Errorf("'%s' is not inside '%s'", dirPath, root)
+		}
+		if _, visited := s.scope(root, dirPath, nil); !visited {
+			continue
+		}
+		var target onlyPattern
+		for _, name := range elems {
+			target.elems = append(target.elems, literalPattern(name))
+		}
+		targets = append(targets, target)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return s.walk(ctx, root, targets, walkFn.withInfo())
+}
+
+// changeTarget returns the pattern matching the directories affected by a change of changedPath, see WalkChanged
+func (s *Scanner) changeTarget(root string, changedPath string) (onlyPattern, bool, error) {
+	elems := s.fs.RelElems(root, changedPath)
+	if slices.Contains(elems, "..") {
+		return onlyPattern{}, false, fmt.Errorf("'%s' is not inside '%s'", changedPath, root)
+	}
+	if s.excludedPath(root, elems) {
+		return onlyPattern{}, false, nil
+	}
+	if n := len(elems); n > 0 && elems[n-1] == s.ManifestName(s.fs.Join(append([]string{root}, elems[:n-1]...)...), n == 1) {
+		return onlyPattern{}, false, nil
+	}
+	// The nearest existing directory is affected, deleted ones are dropped by their parent
+	target := onlyPattern{subtree: true}
+	for ; len(elems) > 0; elems, target.subtree = elems[:len(elems)-1], false {
+		if info, err := s.fs.Lstat(s.fs.Join(append([]string{root}, elems...)...)); err == nil && info.IsDir() {
+			break
+		}
+	}
+	if s.options.maxDepth >= 0 && len(elems) > s.options.maxDepth {
+		return onlyPattern{}, false, nil
+	}
+	for _, name := range elems {
+		target.elems = append(target.elems, literalPattern(name))
+	}
+	return target, true, nil
+}
+
+// walk implements Walk, visiting only the directories matched by only unless it is empty
+func (s *Scanner) walk(ctx context.Context, root string, only []onlyPattern, walkFn ScannedDirInfoFunc) error {
+	if err := s.checkHasher(); err != nil {
+		return err
+	}
+	// Configs may have changed since the previous walk
+	s.configs = dirConfigs{}
+	s.tooLong = map[string]bool{}
+	s.subtrees = map[string]*manifest.SubtreeTotals{}
+	defer func() { s.subtrees = nil }()
+	s.links = newHardlinks()
+	s.rootDevice = nil
+	s.SetRoot(root)
+	if info, err := s.fs.Lstat(root); err == nil && s.options.oneFileSystem {
+		if device, ok := deviceID(info); ok {
+			s.rootDevice = &device
+		}
+	}
+	onUpdate := func(stats *Stats) {
+		if s.options.progress != nil {
+			s.options.progress.Publish(stats)
+		}
+		sendProgress(s.options.progressChannel, stats, false)
+	}
+	if s.options.trackPermissions && !modeSupported {
+		s.GetLogger().Warn("permissions are not tracked on this platform, file modes carry no Unix permission bits")
+	}
+	s.stats.Start(ctx, onUpdate, 100*time.Millisecond)
+	defer s.sendFinalStats()
+	prune := func(dirPath string) bool {
+		_, visited := s.scope(root, dirPath, only)
+		return !visited
+	}
+	visit := func(ctx context.Context, dirPath string, err error) error {
+		if err == nil && s.options.tolerateLongPaths {
+			// The manifest path may exceed the limit even when the directory itself can be read
+			if _, statErr := s.fs.Lstat(s.ManifestPath(dirPath)); errors.Is(statErr, syscall.ENAMETOOLONG) {
+				err = statErr
+			}
+		}
+		var info ScanInfo
+		if err == nil {
+			scope, _ := s.scope(root, dirPath, only)
+			started := time.Now()
+			var m *manifest.Manifest
+			m, info.Cached, err = s.scanDirectory(ctx, dirPath, scope)
+			info.Duration = time.Since(started)
+			if err == nil {
+				s.recordSubtree(dirPath, m)
+				telemetry.Annotate(ctx, telemetry.Bool(telemetry.KeyCached, info.Cached))
+				return walkFn(ctx, dirPath, m, info, nil)
+			}
+		}
+		// The parent counts the vanished directory when it fails to find its manifest
+		if dirPath != root && s.vanished(err, nil, dirPath) {
+			return traverse.SkipDir
+		}
+		if dirPath != root && s.options.tolerateLongPaths && errors.Is(err, syscall.ENAMETOOLONG) {
+			s.GetLogger().Warn("path too long, directory left out", "path", dirPath, "error", err)
+			s.tooLong[dirPath] = true
+			s.stats.IncreaseDirectoriesTooLong()
+			return traverse.SkipDir
+		}
+		return walkFn(ctx, dirPath, nil, info, err)
+	}
+	if s.options.tracer != nil {
+		visit = s.traced(root, visit)
+	}
+	return s.fs.WalkPostOrder(ctx, root, prune, visit)
+}
+
+// sendFinalStats stops periodic progress updates and publishes a snapshot of the complete statistics
+func (s *Scanner) sendFinalStats() {
+	s.stats.Stop()
+	snapshot := s.stats.Snapshot()
+	if s.options.progress != nil {
+		s.options.progress.Publish(&snapshot)
+	}
+	sendProgress(s.options.progressChannel, &snapshot, true)
+}
+
+// excluded reports whether name matches any of the exclude patterns of the options or of config,
+// the config of the directory containing it, or is hidden and left out by HiddenExclude. The manifest of the
+// directory, named manifestName, is never hidden.
+func (s *Scanner) excluded(name string, config DirConfig, manifestName string) bool {
+	if s.options.hiddenPolicy == HiddenExclude && manifest.IsHidden(name) && name != manifestName {
+		return true
+	}
+	for _, patterns := range [][]string{s.options.excludes, config.Exclude} {
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
 }
 
+// excludedPath reports whether the path with the relative path elems below root, or one of the directories
+// leading to it, is excluded. Configs that cannot be loaded are ignored here, scanning their directory fails.
+func (s *Scanner) excludedPath(root string, elems []string) bool {
+	for i, name := range elems {
+		config, _ := s.dirConfig(root, elems[:i])
+		if s.excluded(name, config, s.ManifestName(s.fs.Join(append([]string{root}, elems[:i]...)...), i == 0)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmanagedAllowed reports whether the subdirectory name of a directory of scope may lack a manifest, see
+// WithAllowMissingManifests. With HiddenWarn hidden directories, and the ones below, may always lack one.
+// Their entities are then recorded without a checksum, which a parent recording one reports as a mismatch,
+// see manifest.CompareManifests.
+func (s *Scanner) unmanagedAllowed(scope dirScope, name string) bool {
+	return s.options.allowMissingManifests ||
+		s.options.hiddenPolicy == HiddenWarn && (scope.hidden || manifest.IsHidden(name))
+}
+
+// vanished reports whether err is caused by entryPath disappearing after it was listed
+// and the scanner is configured to tolerate that. Dangling symbolic links have not vanished, entry tells
+// them apart from the files they point to in file systems whose Lstat follows links, see WithFS.
+func (s *Scanner) vanished(err error, entry fs.DirEntry, entryPath string) bool {
+	if !s.options.tolerateVanished || !errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if entry != nil && entry.Type()&fs.ModeSymlink != 0 {
+		return false
+	}
+	_, statErr := s.fs.Lstat(entryPath)
+	return errors.Is(statErr, fs.ErrNotExist)
+}
+
+// GetManifestName returns the name given by WithManifestName, which WithManifestNameFunc may override per directory
 func (s *Scanner) GetManifestName() string {
 	return s.options.manifestName
 }
 
+// ManifestName returns the name of the manifest of dirPath, isRoot telling whether it is the root of the tree,
+// see WithManifestNameFunc
+func (s *Scanner) ManifestName(dirPath string, isRoot bool) string {
+	if s.options.manifestNameFunc != nil {
+		return s.options.manifestNameFunc(dirPath, isRoot)
+	}
+	return s.options.manifestName
+}
+
+// SetRoot sets the root of the tree whose manifest ManifestPath resolves as the root one, see
+// WithManifestNameFunc. Walk sets it, callers loading manifests before walking set it first. It is the root
+// of the walk, which is not the root of the tree when only a subtree is walked, see ManifestNameFunc.
+func (s *Scanner) SetRoot(root string) {
+	s.root = s.fs.Join(root)
+}
+
 func (s *Scanner) GetManifestFreshnessLimit() *time.Duration {
 	return s.options.manifestFreshnessLimit
 }
 
+// GetLogger returns the logger scan events are reported to, see WithLogger
+func (s *Scanner) GetLogger() *slog.Logger {
+	if s.options.logger != nil {
+		return s.options.logger
+	}
+	return logging.Logger()
+}
+
+// GetFS returns the file system given by WithFS, nil when the scanner reads the OS file system
+func (s *Scanner) GetFS() fs.FS {
+	return s.options.fsys
+}
+
+// ManifestPath returns the path of the manifest of dirPath in the scanned file system, resolving its name
+// as the root one when dirPath is the root set by SetRoot
+func (s *Scanner) ManifestPath(dirPath string) string {
+	return s.fs.Join(dirPath, s.ManifestName(dirPath, s.fs.Join(dirPath) == s.root))
+}
+
+// LoadManifest loads the manifest stored in dirPath, from the overlay if it holds it, see WithManifestOverlay.
+// It returns nil if there is none.
+func (s *Scanner) LoadManifest(dirPath string) (*manifest.Manifest, error) {
+	manifestPath := s.ManifestPath(dirPath)
+	if data, ok := s.options.overlay.data(manifestPath); ok {
+		if data == nil {
+			return nil, nil
+		}
+		return manifest.Parse(data)
+	}
+	return manifest.LoadManifestFS(s.fs, manifestPath)
+}
+
+// Overlaid reports whether the manifest of dirPath is held by the overlay rather than the tree, see LoadManifest
+func (s *Scanner) Overlaid(dirPath string) bool {
+	_, ok := s.options.overlay.data(s.ManifestPath(dirPath))
+	return ok
+}
+
+// GetProgressSource returns the source of WithProgressSource, nil unless progress is published
+func (s *Scanner) GetProgressSource() *ProgressSource {
+	return s.options.progress
+}
+
+// GetProgressChannel returns the channel of WithProgressChannel
+//
+// Deprecated: Use GetProgressSource.
 func (s *Scanner) GetProgressChannel() <-chan *Stats {
 	return s.options.progressChannel
 }
 
-func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Manifest, cached bool, err error) {
-	// Check for fresh manifest first (same as before)
-	m, err = manifest.LoadManifestIfFresh(
-		filepath.Join(dir, s.options.manifestName),
-		s.options.manifestFreshnessLimit)
+// TracksHardlinks reports whether computed manifests record the link groups of files, see WithTrackHardlinks
+func (s *Scanner) TracksHardlinks() bool {
+	return s.options.trackHardlinks && hardlinksSupported && s.options.fsys == nil
+}
+
+func (s *Scanner) GetFreshnessMode() FreshnessMode {
+	return s.options.freshnessMode
+}
+
+// GetHiddenPolicy returns the policy of WithHiddenPolicy
+func (s *Scanner) GetHiddenPolicy() HiddenPolicy {
+	return s.options.hiddenPolicy
+}
+
+func (s *Scanner) scanDirectory(ctx context.Context, dir string, scope dirScope) (m *manifest.Manifest, cached bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	if scope.configErr != nil {
+		return nil, false, scope.configErr
+	}
+	if err := s.checkManifestName(dir, scope.manifestName); err != nil {
+		return nil, false, err
+	}
+	manifestPath := s.ManifestPath(dir)
+	var entries []os.DirEntry
+	var dirFingerprint string
+	// mountpoints holds the names of the subdirectories left out by WithOneFileSystem
+	var mountpoints []string
+
+	if s.options.freshnessMode == FreshnessModeEmbedded {
+		if entries, err = s.fs.ReadDir(dir); err != nil {
+			return nil, false, err
+		}
+		entries, mountpoints = s.dropMountpoints(dir, s.filterEntries(entries, scope))
+		if dirFingerprint, err = fingerprint(s.fs, dir, entries, scope.manifestName, s.ManifestPath); err != nil {
+			return nil, false, err
+		}
+		if !scope.ancestorOnly {
+			m, err = manifest.LoadManifestIfFreshEmbeddedFS(s.fs, manifestPath, s.options.manifestFreshnessLimit, dirFingerprint)
+		}
+	} else if !scope.ancestorOnly {
+		m, err = manifest.LoadManifestIfFreshFS(s.fs, manifestPath, s.options.manifestFreshnessLimit)
+	}
+	if errors.Is(err, manifest.ErrInvalidManifest) {
+		// The directory is scanned as if it had no manifest, generate replaces it and verify reports it
+		s.GetLogger().Debug("invalid manifest ignored", "path", manifestPath, "error", err)
+		m, err = nil, nil
+	}
 
 	if err != nil {
 		return nil, false, err
 	}
+	if m != nil && m.HiddenPolicy != s.options.hiddenPolicy.recorded() {
+		// Verification reports the mismatch, generate lists the entries again
+		s.GetLogger().Debug("fresh manifest listed with another hidden policy", "path", manifestPath)
+		m = nil
+	}
+	if m != nil && s.options.freshListingCheck &&
+		(!s.listingMatches(dir, entries, scope, m) || !s.childManifestsMatch(ctx, dir, m)) {
+		// Only the contents of fresh manifests are trusted, not a tampered or outdated listing, nor the manifests
+		// of subdirectories regenerated since
+		s.GetLogger().Debug("fresh manifest does not match the directory listing", "path", manifestPath)
+		m = nil
+	}
 	if m != nil {
 		s.stats.IncreaseCachedProcessed()
+		bytes := manifestFileBytes(m)
+		s.stats.AddBytesCovered(bytes)
+		s.stats.AddBytesCached(bytes)
+		return m, true, nil
+	}
+	// Directories whose fresh manifest is reused are not scanned, see WithDirStartHook
+	if s.options.dirStartHook != nil {
+		s.options.dirStartHook(dir)
+	}
+	if m = s.unchangedManifest(ctx, dir, entries, scope); m != nil {
+		s.GetLogger().Debug("directory unchanged since the cutoff", "path", dir)
+		s.countUnchanged(m)
 		return m, true, nil
 	}
 
-	// Read and filter directory entries
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, false, err
+	// Directory entries are listed in batches as workers hash them, unless they were read whole
+	// for the fingerprint of embedded freshness
+	listEntries := func(fn func(entries []os.DirEntry) error) error {
+		if entries != nil {
+			return fn(entries)
+		}
+		return traverse.ReadDirBatches(s.fs, dir, traverse.DefaultBatchSize, func(batch []os.DirEntry) error {
+			kept, skipped := s.dropMountpoints(dir, s.filterEntries(batch, scope))
+			mountpoints = append(mountpoints, skipped...)
+			return fn(kept)
+		})
 	}
 
+	existing := s.verifiedManifest(dir)
+	sampling, sampleOnly := s.sampling(existing)
+	chunkSizes := s.chunkSizes(existing)
+	contentTyped := s.contentTyped(existing)
+	expectedSizes := s.expectedSizes(existing)
+	unchanged := s.unchangedFiles(existing)
+
 	// Use channel-based worker pool
 	type Job struct {
 		index int
@@ -92,6 +494,8 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Ma
 	type Result struct {
 		index  int
 		entity manifest.Entity
+		// totals is what the entry adds to the totals of the directory, nil if unknown
+		totals *manifest.SubtreeTotals
 		err    error
 	}
 
@@ -99,7 +503,10 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Ma
 	results := make(chan Result)
 
 	// Determine worker count (you could make this configurable)
-	workerCount := min(len(entries), s.options.workersCount)
+	workerCount := s.options.workersCount
+	if entries != nil {
+		workerCount = min(len(entries), workerCount)
+	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -110,43 +517,122 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Ma
 				if ctx.Err() != nil {
 					return ctx.Err()
 				}
-				if job.entry.Name() == s.options.manifestName {
+				if job.entry.Name() == scope.manifestName {
 					continue
 				}
 
-				fullPath := filepath.Join(dir, job.entry.Name())
-				if job.entry.IsDir() {
-					fullPath = filepath.Join(fullPath, s.options.manifestName)
+				entryPath := s.fs.Join(dir, job.entry.Name())
+				entity := manifest.Entity{Name: job.entry.Name(), IsDir: job.entry.IsDir()}
+				var totals *manifest.SubtreeTotals
+				var info fs.FileInfo
+				var err error
+				if entity.IsDir && s.tooLong[entryPath] {
+					continue
+				}
+				if entity.IsDir {
+					manifestPath := s.ManifestPath(entryPath)
+					if entity.Checksum, err = s.checksum(ctx, manifestPath, true, nil); err == nil {
+						child := s.loadChildManifest(manifestPath)
+						entity.Empty = child != nil && len(child.Entities) == 0
+						totals = s.childTotals(entryPath, child)
+					} else if s.unmanagedAllowed(scope, entity.Name) && errors.Is(err, fs.ErrNotExist) {
+						// The directory is unmanaged unless it vanished itself
+						if _, statErr := s.fs.Lstat(entryPath); statErr == nil {
+							entity.Checksum, err = "", nil
+						}
+					}
+				} else if entity.Special = s.specialKind(job.entry, entryPath); entity.Special != "" {
+					// Special files are never opened, reading a FIFO would block forever
+					if s.options.specialFiles == SpecialFilesSkip {
+						s.GetLogger().Debug("special file skipped", "path", entryPath, "kind", entity.Special)
+						continue
+					}
+					entity.Checksum = manifest.SpecialChecksum(entity.Special, entity.Name)
+					totals = &manifest.SubtreeTotals{Files: 1}
+				} else if totals, info, err = s.fileTotals(entryPath); err == nil {
+					size := totals.Bytes
+					entity.Size = &size
+					if expected, ok := expectedSizes[entity.Name]; ok && expected != size {
+						// The file changed, its content is not read to tell how, see WithFastVerification
+						s.stats.IncreaseFilesUnhashed()
+					} else if recorded, ok := unchanged[entity.Name]; ok && *recorded.Size == size && s.unchangedSince(entryPath) {
+						// The recorded checksums are trusted, see WithChangedSince
+						trustRecorded(&entity, recorded, sampling, sampleOnly[entity.Name])
+						s.stats.AddFilesUnchanged(1)
+						s.stats.AddBytesCovered(size)
+						s.stats.AddBytesCached(size)
+					} else {
+						params := hashParams{sampled: sampling != nil, sampleOnly: sampleOnly[entity.Name],
+							chunkSize: chunkSizes[entity.Name], contentType: s.options.contentTypes || contentTyped[entity.Name]}
+						if sampling != nil {
+							params.sampling = *sampling
+						}
+						// Symbolic links to a file share its inode, but are not hard links of it
+						symlink := job.entry.Type()&fs.ModeSymlink != 0
+						err = s.linkedChecksums(ctx, info, &entity, params, symlink, func() error {
+							return s.fileChecksums(ctx, entryPath, &entity, sampling, params.sampleOnly, params.chunkSize,
+								params.contentType)
+						})
+						if err == nil {
+							s.stats.AddBytesCovered(size)
+						}
+					}
+				}
+				if s.vanished(err, job.entry, entryPath) {
+					s.GetLogger().Debug("entry vanished", "path", entryPath)
+					s.stats.IncreaseEntriesVanished()
+					continue
 				}
-
-				checksum, err := calculateChecksum(ctx, fullPath, &s.stats)
 				if err != nil {
 					return err
 				}
 
 				s.stats.IncreaseFilesProcessed()
-				entity := manifest.Entity{
-					Name:     job.entry.Name(),
-					Checksum: checksum,
-					IsDir:    job.entry.IsDir(),
+				if s.trackPermissions(scope.config) {
+					info, err := job.entry.Info()
+					if s.vanished(err, job.entry, entryPath) {
+						s.GetLogger().Debug("entry vanished", "path", entryPath)
+						s.stats.IncreaseEntriesVanished()
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					recordPermissions(&entity, info)
 				}
-				results <- Result{index: job.index, entity: entity}
+				if s.options.trackXattrs && s.options.fsys == nil {
+					err := recordXattrs(&entity, entryPath)
+					if s.vanished(err, job.entry, entryPath) {
+						s.GetLogger().Debug("entry vanished", "path", entryPath)
+						s.stats.IncreaseEntriesVanished()
+						continue
+					}
+					if err != nil {
+						return err
+					}
+				}
+				results <- Result{index: job.index, entity: entity, totals: totals}
 			}
 			return nil
 		})
 	}
 
-	// Send jobs
+	// Send jobs, the unbuffered channel keeps at most one batch of entries in flight
 	g.Go(func() error {
 		defer close(jobs)
-		for i, entry := range entries {
-			select {
-			case jobs <- Job{index: i, entry: entry}:
-			case <-ctx.Done():
-				return ctx.Err()
+		index := 0
+		return listEntries(func(batch []os.DirEntry) error {
+			s.stats.AddEntriesDiscovered(int64(len(batch)))
+			for _, entry := range batch {
+				select {
+				case jobs <- Job{index: index, entry: entry}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				index++
 			}
-		}
-		return nil
+			return nil
+		})
 	})
 
 	go func() {
@@ -155,12 +641,21 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Ma
 	}()
 
 	computedEntities := make([]manifest.Entity, 0)
+	subtree := &manifest.SubtreeTotals{}
+	sampled := false
 	var firstError error
 	for result := range results {
 		if result.err != nil && firstError == nil {
 			firstError = result.err
 		} else {
 			computedEntities = append(computedEntities, result.entity)
+			sampled = sampled || result.entity.SampleChecksum != ""
+			// Totals are only recorded when they are known for every entry
+			if subtree != nil && result.totals != nil {
+				subtree.Add(*result.totals)
+			} else {
+				subtree = nil
+			}
 		}
 	}
 
@@ -172,7 +667,244 @@ func (s *Scanner) scanDirectory(ctx context.Context, dir string) (m *manifest.Ma
 	}
 
 	s.stats.IncreaseDirProcessed()
-	return manifest.New(computedEntities), false, nil
+	m = manifest.New(computedEntities)
+	for _, names := range m.CaseCollisions() {
+		s.GetLogger().Warn("names differ only in case, they collide on case-insensitive file systems",
+			"path", dir, "names", names)
+	}
+	m.Subtree = subtree
+	m.ConfigDigest = scope.config.Digest()
+	m.HiddenPolicy = s.options.hiddenPolicy.recorded()
+	m.Hardlinks = s.TracksHardlinks()
+	if len(mountpoints) > 0 {
+		sort.Strings(mountpoints)
+		m.Mountpoints = mountpoints
+	}
+	if sampled {
+		m.Sampling = sampling
+	}
+	if s.options.freshnessMode == FreshnessModeEmbedded {
+		generatedAt := time.Now().UTC()
+		m.GeneratedAt = &generatedAt
+		m.Fingerprint = dirFingerprint
+	}
+	return m, false, nil
+}
+
+// verifiedManifest returns the expected manifest of dir when it tells how to hash the files of dir,
+// see WithSampledVerification, WithChunkedVerification, WithContentTypeVerification and WithFastVerification,
+// nil otherwise
+func (s *Scanner) verifiedManifest(dir string) *manifest.Manifest {
+	if !s.options.sampledVerification && !s.options.chunkedVerification && !s.options.fastVerification &&
+		!s.options.contentTypeVerification && s.options.changedSince.IsZero() {
+		return nil
+	}
+	if s.options.expectedManifests != nil {
+		return s.options.expectedManifests(dir)
+	}
+	existing, err := s.LoadManifest(dir)
+	if err != nil {
+		// Missing and invalid manifests are reported by the verification, their files are hashed whole
+		return nil
+	}
+	return existing
+}
+
+// sampling returns the sampling parameters of the files of dir, nil if they are not sampled. In a sampled
+// verification these are the parameters recorded by the existing manifest, and sampleOnly holds the names
+// of the files it records a sample checksum for, see WithSampledVerification.
+func (s *Scanner) sampling(existing *manifest.Manifest) (sampling *manifest.Sampling, sampleOnly map[string]bool) {
+	if !s.options.sampledVerification {
+		return s.options.sampling, nil
+	}
+	if existing == nil || existing.Sampling == nil {
+		return nil, nil
+	}
+	sampleOnly = make(map[string]bool)
+	for _, entity := range existing.Entities {
+		if entity.SampleChecksum != "" {
+			sampleOnly[entity.Name] = true
+		}
+	}
+	return existing.Sampling, sampleOnly
+}
+
+// chunkSizes returns the chunk sizes the existing manifest records for the files of dir in a chunked
+// verification, see WithChunkedVerification
+func (s *Scanner) chunkSizes(existing *manifest.Manifest) map[string]int64 {
+	if !s.options.chunkedVerification || existing == nil {
+		return nil
+	}
+	sizes := make(map[string]int64)
+	for _, entity := range existing.Entities {
+		if entity.Chunking != nil && entity.Chunking.ChunkSize > 0 {
+			sizes[entity.Name] = entity.Chunking.ChunkSize
+		}
+	}
+	return sizes
+}
+
+// contentTyped returns the names of the files whose existing manifest records their content type in a
+// verification, see WithContentTypeVerification
+func (s *Scanner) contentTyped(existing *manifest.Manifest) map[string]bool {
+	if !s.options.contentTypeVerification || existing == nil {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, entity := range existing.Entities {
+		if entity.ContentType != "" {
+			names[entity.Name] = true
+		}
+	}
+	return names
+}
+
+// expectedSizes returns the sizes the existing manifest records for the files of dir in a fast verification,
+// see WithFastVerification
+func (s *Scanner) expectedSizes(existing *manifest.Manifest) map[string]int64 {
+	if !s.options.fastVerification || existing == nil {
+		return nil
+	}
+	sizes := make(map[string]int64)
+	for _, entity := range existing.Entities {
+		if entity.Size != nil && entity.Kind() == "file" {
+			sizes[entity.Name] = *entity.Size
+		}
+	}
+	return sizes
+}
+
+// fileChecksums records the checksum of a regular file in entity and, when sampling applies to its size,
+// its sample checksum. With sampleOnly, the checksum is left empty for the files whose sample checksum is
+// computed. The chunks of the file are recorded with verifiedChunkSize if it is set, otherwise with the
+// chunk size of WithChunking when the file is larger than one chunk. With recordContentType, the content type
+// of the file is classified from the data being hashed, sampled files are not classified.
+func (s *Scanner) fileChecksums(ctx context.Context, fpath string, entity *manifest.Entity, sampling *manifest.Sampling,
+	sampleOnly bool, verifiedChunkSize int64, recordContentType bool) error {
+	chunkSize := verifiedChunkSize
+	if sampling != nil || chunkSize == 0 && s.options.chunkSize > 0 {
+		info, err := s.fs.Stat(fpath)
+		if err != nil {
+			return err
+		}
+		if sampling != nil && sampling.Applies(info.Size()) {
+			entity.SampleChecksum, err = calculateSampleChecksum(ctx, s.fs, fpath, info.Size(), *sampling, &s.stats, s.limiter, s.buffers)
+			if err != nil {
+				return err
+			}
+			if sampleOnly {
+				s.stats.IncreaseFilesSampled()
+				return nil
+			}
+		}
+		if chunkSize == 0 && info.Size() > s.options.chunkSize {
+			chunkSize = s.options.chunkSize
+		}
+	}
+	var classify func(head []byte)
+	if recordContentType {
+		classify = func(head []byte) {
+			entity.ContentType = contentType(entity.Name, head)
+		}
+	}
+	if chunkSize > 0 {
+		return s.chunkedChecksum(ctx, fpath, entity, chunkSize, classify)
+	}
+	var err error
+	entity.Checksum, err = s.checksum(ctx, fpath, false, classify)
+	return err
+}
+
+// chunkedChecksum records the checksum and the chunks of a file in entity. The checksum cache cannot
+// provide the chunks, it is only updated. A ResumableChecksumCache resumes the checksum where an interrupted
+// run left it and records where this one gets to when it is interrupted in turn.
+func (s *Scanner) chunkedChecksum(ctx context.Context, fpath string, entity *manifest.Entity, chunkSize int64,
+	classify func(head []byte)) error {
+	cache := s.options.checksumCache
+	resumable, _ := cache.(ResumableChecksumCache)
+	var info fs.FileInfo
+	var resume *chunkedProgress
+	if cache != nil {
+		var err error
+		if info, err = s.fs.Stat(fpath); err != nil {
+			return err
+		}
+	}
+	if resumable != nil {
+		if digests, hashState, ok := resumable.LookupProgress(fpath, info, chunkSize); ok {
+			resume = &chunkedProgress{chunkDigests: digests, hashState: hashState}
+			if classify != nil {
+				// The first bytes are not read again
+				head, err := readHead(s.fs, fpath)
+				if err != nil {
+					return err
+				}
+				classify(head)
+				classify = nil
+			}
+		}
+	}
+	checksum, chunking, progress, err := calculateChunkedChecksum(ctx, s.fs, fpath, chunkSize, resume, &s.stats, s.limiter, s.buffers, classify)
+	if err != nil {
+		if resumable != nil && progress != nil && progress != resume {
+			resumable.UpdateProgress(fpath, info, chunkSize, progress.chunkDigests, progress.hashState)
+		}
+		return err
+	}
+	entity.Checksum, entity.Chunking = checksum, chunking
+	if cache != nil {
+		cache.Update(fpath, info, checksum)
+	}
+	return nil
+}
+
+// checksum calculates the checksum of a file or of a child directory's manifest,
+// reusing the checksum cache when one is configured. classify is given the first bytes of files,
+// which are read on their own when the checksum is cached, see readFile.
+func (s *Scanner) checksum(ctx context.Context, fpath string, isManifest bool, classify func(head []byte)) (string, error) {
+	checksumFn := func() (string, error) {
+		return s.hash(ctx, fpath, classify)
+	}
+	if isManifest {
+		if data, ok := s.options.overlay.data(fpath); ok {
+			if data == nil {
+				return "", &fs.PathError{Op: "open", Path: fpath, Err: fs.ErrNotExist}
+			}
+			return manifestDataChecksum(data), nil
+		}
+		checksumFn = func() (string, error) {
+			return calculateManifestChecksum(ctx, s.fs, fpath, &s.stats, s.limiter, s.buffers)
+		}
+	}
+	cache := s.options.checksumCache
+	if cache == nil {
+		return checksumFn()
+	}
+
+	info, err := s.fs.Stat(fpath)
+	if err != nil {
+		return "", err
+	}
+	if checksum, ok := cache.Lookup(fpath, info); ok {
+		s.stats.IncreaseFilesCached()
+		if !isManifest {
+			s.stats.AddBytesCached(info.Size())
+		}
+		if classify != nil {
+			head, err := readHead(s.fs, fpath)
+			if err != nil {
+				return "", err
+			}
+			classify(head)
+		}
+		return checksum, nil
+	}
+	checksum, err := checksumFn()
+	if err != nil {
+		return "", err
+	}
+	cache.Update(fpath, info, checksum)
+	return checksum, nil
 }
 
 func (s *Scanner) GetStats() *Stats {
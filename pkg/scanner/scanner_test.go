@@ -1,13 +1,25 @@
 package scanner
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/tomekjarosik/bytecheck/pkg/archive"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/state"
 )
 
 // TestScannerWalk tests the scanner's Walk functionality
@@ -244,16 +256,60 @@ func TestScannerProgressChannel(t *testing.T) {
 		t.Error("Expected progress updates but got none")
 	}
 
-	// The last progress update should show completion
+	// The last progress update is the final one sent by Walk and must show completion
 	if len(progressUpdates) > 0 {
 		lastUpdate := progressUpdates[len(progressUpdates)-1]
-		t.Logf("Final progress: DirsProcessed=%d, FilesProcessed=%d, BytesProcessed=%d",
-			lastUpdate.DirsProcessed(), lastUpdate.FilesProcessed(), lastUpdate.BytesProcessed())
+		final := scanner.GetStats()
+		if lastUpdate.DirsProcessed() != final.DirsProcessed() || lastUpdate.FilesProcessed() != final.FilesProcessed() ||
+			lastUpdate.BytesHashed() != final.BytesHashed() {
+			t.Errorf("Final progress: DirsProcessed=%d, FilesProcessed=%d, BytesHashed=%d, expected %d, %d, %d",
+				lastUpdate.DirsProcessed(), lastUpdate.FilesProcessed(), lastUpdate.BytesHashed(),
+				final.DirsProcessed(), final.FilesProcessed(), final.BytesHashed())
+		}
 	}
 
 	t.Log("✓ Progress channel test passed")
 }
 
+// TestScannerWalk_WithFullProgressChannel_mustDeliverExactFinalStats checks that the final snapshot replaces
+// the stale ones filling a channel nobody reads during the walk
+func TestScannerWalk_WithFullProgressChannel_mustDeliverExactFinalStats(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := range 5 {
+		dirPath := filepath.Join(tempDir, fmt.Sprintf("dir%d", i))
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dirPath, "file.txt"), []byte(strings.Repeat("x", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	progressCh := make(chan *Stats, 1)
+	scanner := New(WithProgressChannel(progressCh))
+
+	err := scanner.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, computedManifest *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		// Parents record the checksums of the manifests of their children
+		return computedManifest.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	if len(progressCh) != 1 {
+		t.Fatalf("Expected the final snapshot alone in the channel, got %d snapshots", len(progressCh))
+	}
+	last := <-progressCh
+	if expected := scanner.GetStats().Snapshot(); !reflect.DeepEqual(last, &expected) {
+		t.Errorf("Final snapshot %+v differs from the statistics %+v", last, &expected)
+	}
+	if last.DirsProcessed() != 6 || last.FilesProcessed() != 10 {
+		t.Errorf("Expected 6 directories and 10 entries, got %d and %d", last.DirsProcessed(), last.FilesProcessed())
+	}
+}
+
 // TestScannerOptions tests various scanner options
 func TestScannerOptions(t *testing.T) {
 	// Test with different manifest names
@@ -275,5 +331,1227 @@ func TestScannerOptions(t *testing.T) {
 		t.Error("Progress channel not set correctly")
 	}
 
+	source := NewProgressSource()
+	if New(WithProgressSource(source)).GetProgressSource() != source {
+		t.Error("Progress source not set correctly")
+	}
+
 	t.Log("✓ Scanner options test passed")
 }
+
+// generateWith walks dir with the given scanner and saves every computed manifest.
+// It returns the number of directories that were reported as cached.
+func generateWith(t *testing.T, sc *Scanner, dir string) (cachedCount int) {
+	t.Helper()
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		if cached {
+			cachedCount++
+			return nil
+		}
+		return m.Save(filepath.Join(dirPath, sc.GetManifestName()))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	return cachedCount
+}
+
+func TestScanner_EmbeddedFreshnessMode_TouchingManifestDoesNotFakeFreshness(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "sub", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newScanner := func(mode FreshnessMode) *Scanner {
+		return New(WithManifestFreshnessLimit(time.Hour), WithFreshnessMode(mode))
+	}
+	generateWith(t, newScanner(FreshnessModeEmbedded), tempDir)
+
+	m, err := manifest.LoadManifest(filepath.Join(tempDir, "sub", ".bytecheck.manifest"))
+	if err != nil || m == nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if m.GeneratedAt == nil || m.Fingerprint == "" {
+		t.Fatal("Expected generatedAt and fingerprint to be embedded in the manifest")
+	}
+
+	// Nothing changed, so both directories are fresh
+	if cached := generateWith(t, newScanner(FreshnessModeEmbedded), tempDir); cached != 2 {
+		t.Errorf("Expected 2 cached directories, got %d", cached)
+	}
+
+	// Change the file, then touch the manifests as if they were just written
+	past := time.Now().Add(-time.Minute)
+	if err := os.WriteFile(filePath, []byte("changed!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filePath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, dir := range []string{tempDir, filepath.Join(tempDir, "sub")} {
+		if err := os.Chtimes(filepath.Join(dir, ".bytecheck.manifest"), now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// mtime mode is fooled by the touched manifest, embedded mode is not
+	err = newScanner(FreshnessModeMtime).Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if !cached {
+			t.Errorf("Expected %s to be cached in mtime mode", dirPath)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if cached := generateWith(t, newScanner(FreshnessModeEmbedded), tempDir); cached != 0 {
+		t.Errorf("Expected no cached directories in embedded mode, got %d", cached)
+	}
+}
+
+func TestScanner_EmbeddedFreshnessMode_IgnoresOldManifestMtime(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sc := New(WithManifestFreshnessLimit(time.Hour), WithFreshnessMode(FreshnessModeEmbedded))
+	generateWith(t, sc, tempDir)
+
+	// e.g. restored from a backup that preserves an old modification time
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tempDir, ".bytecheck.manifest"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if cached := generateWith(t, sc, tempDir); cached != 1 {
+		t.Errorf("Expected manifest to be fresh in embedded mode, got %d cached", cached)
+	}
+}
+
+func TestScanner_WithChecksumCache_SecondRunHashesZeroBytes(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{"a.txt", filepath.Join("sub", "b.txt"), filepath.Join("sub", "deep", "c.txt")}
+	for _, file := range files {
+		fullPath := filepath.Join(tempDir, file)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte("content of "+file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generateWith(t, New(), tempDir)
+
+	// Files written just now are not cached, see state.racyWindow
+	past := time.Now().Add(-time.Hour)
+	err := filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, past, past)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := state.Open(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	first := New(WithChecksumCache(store))
+	generateWithoutSaving := func(sc *Scanner) {
+		err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+	}
+	generateWithoutSaving(first)
+	if first.GetStats().BytesHashed() == 0 {
+		t.Error("Expected the first run to hash data")
+	}
+
+	second := New(WithChecksumCache(store))
+	generateWithoutSaving(second)
+	if bytes := second.GetStats().BytesHashed(); bytes != 0 {
+		t.Errorf("Expected the second run to hash zero bytes, got %d", bytes)
+	}
+	if cached := second.GetStats().FilesCached(); cached != 5 {
+		t.Errorf("Expected 5 cached checksums (3 files, 2 child manifests), got %d", cached)
+	}
+	// Child manifests are hashed or cached, but only files count as covered
+	if covered, firstCovered := second.GetStats().BytesCovered(), first.GetStats().BytesCovered(); covered == 0 || covered != firstCovered {
+		t.Errorf("Expected both runs to cover the same bytes, got %d and %d", firstCovered, covered)
+	}
+	if ratio := second.GetStats().CacheHitRatio(); ratio != 1 {
+		t.Errorf("Expected a cache hit ratio of 1, got %f", ratio)
+	}
+}
+
+// vanishingCache deletes a file right before it is hashed, simulating a concurrent process
+type vanishingCache struct {
+	path string
+}
+
+func (c *vanishingCache) Lookup(path string, info os.FileInfo) (string, bool) {
+	if path == c.path {
+		_ = os.Remove(path)
+	}
+	return "", false
+}
+
+func (c *vanishingCache) Update(path string, info os.FileInfo, checksum string) {}
+
+func TestScanner_VanishedFile(t *testing.T) {
+	for _, tolerate := range []bool{true, false} {
+		t.Run(fmt.Sprintf("tolerate=%v", tolerate), func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, name := range []string{"keep.txt", "gone.txt"} {
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cache := &vanishingCache{path: filepath.Join(tempDir, "gone.txt")}
+			sc := New(WithChecksumCache(cache), WithTolerateVanished(tolerate))
+
+			var computed *manifest.Manifest
+			err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+				computed = m
+				return err
+			})
+			if !tolerate {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("Expected a 'file does not exist' error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			if len(computed.Entities) != 1 || computed.Entities[0].Name != "keep.txt" {
+				t.Errorf("Expected only keep.txt in the manifest, got %+v", computed.Entities)
+			}
+			if vanished := sc.GetStats().EntriesVanished(); vanished != 1 {
+				t.Errorf("Expected 1 vanished entry, got %d", vanished)
+			}
+		})
+	}
+}
+
+func TestScanner_DanglingSymlinkInArchive_mustNotCountAsVanished(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Stat follows links in archives, the link looks as if it had vanished
+	fsys, err := archive.NewTarFSAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := New(WithFS(fsys), WithTolerateVanished(true))
+	err = sc.Walk(context.Background(), ".", func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected the dangling link to fail the walk, got: %v", err)
+	}
+	if vanished := sc.GetStats().EntriesVanished(); vanished != 0 {
+		t.Errorf("Expected no vanished entry, got %d", vanished)
+	}
+}
+
+func TestScanner_WithMaxBytesPerSecond_ThrottlesHashing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping throttling test in short mode")
+	}
+	tempDir := t.TempDir()
+	// 2 workers hash 1.5MB each, the limit is shared between them
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), make([]byte, 1536*1024), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sc := New(WithWorkersCount(2), WithMaxBytesPerSecond(1024*1024))
+
+	start := time.Now()
+	err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if elapsed < 2*time.Second || elapsed > 6*time.Second {
+		t.Errorf("Expected hashing 3MB at 1MB/s to take about 3s, took %v", elapsed)
+	}
+	if bytes := sc.GetStats().BytesHashed(); bytes != 3*1024*1024 {
+		t.Errorf("Expected 3MB processed, got %d", bytes)
+	}
+}
+
+// writeManifestTo returns a walk function that stores every computed manifest in fsys
+func writeManifestTo(fsys fstest.MapFS) ScannedDirFunc {
+	return func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		data, err := m.Encode()
+		if err != nil {
+			return err
+		}
+		fsys[path.Join(dirPath, manifest.DefaultName)] = &fstest.MapFile{Data: data, Mode: 0644}
+		return nil
+	}
+}
+
+func TestScanner_WithFS_MatchesOSFilesystem(t *testing.T) {
+	files := map[string]string{
+		"root.txt":           "root content",
+		"a/file1.txt":        "content1",
+		"a/nested/file2.txt": "content2",
+		"b/file3.txt":        "content3",
+	}
+	fsys := fstest.MapFS{}
+	tempDir := t.TempDir()
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+		fullPath := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	err := New(WithFS(fsys)).Walk(context.Background(), ".", func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		visited = append(visited, dirPath)
+		return walkFn(ctx, dirPath, m, cached, err)
+	})
+	if err != nil {
+		t.Fatalf("Walk over fs.FS failed: %v", err)
+	}
+	expectedOrder := []string{"a/nested", "a", "b", "."}
+	if fmt.Sprint(visited) != fmt.Sprint(expectedOrder) {
+		t.Errorf("Expected order %v, got %v", expectedOrder, visited)
+	}
+	generateWith(t, New(), tempDir)
+
+	fromFS, err := manifest.LoadManifestFS(fsys, manifest.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromOS, err := manifest.LoadManifest(filepath.Join(tempDir, manifest.DefaultName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digestFS, _ := manifest.RootDigest(fromFS)
+	digestOS, _ := manifest.RootDigest(fromOS)
+	if digestFS != digestOS {
+		t.Errorf("Root digest over fs.FS %s differs from the OS one %s", digestFS, digestOS)
+	}
+}
+
+func TestScanner_WithFS_WithExcludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"keep.txt":             {Data: []byte("keep")},
+		"skip.tmp":             {Data: []byte("skip")},
+		"node_modules/dep.txt": {Data: []byte("dep")},
+	}
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	err := New(WithFS(fsys), WithExcludes("*.tmp", "node_modules")).Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			visited = append(visited, dirPath)
+			return walkFn(ctx, dirPath, m, cached, err)
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if fmt.Sprint(visited) != "[.]" {
+		t.Errorf("Expected only the root to be visited, got %v", visited)
+	}
+	m, err := manifest.LoadManifestFS(fsys, manifest.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entities) != 1 || m.Entities[0].Name != "keep.txt" {
+		t.Errorf("Expected only keep.txt, got %+v", m.Entities)
+	}
+}
+
+func TestScanner_WithHiddenPolicy(t *testing.T) {
+	tests := []struct {
+		policy   HiddenPolicy
+		visited  string
+		entities string
+		recorded string
+	}{
+		{HiddenInclude, "[.cache .]", "[.cache .swp data.txt]", ""},
+		{HiddenExclude, "[.]", "[data.txt]", "exclude"},
+		{HiddenWarn, "[.cache .]", "[.cache .swp data.txt]", "warn"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			fsys := fstest.MapFS{
+				"data.txt":     {Data: []byte("data")},
+				".swp":         {Data: []byte("editor")},
+				".cache/x.tmp": {Data: []byte("cache")},
+			}
+			var visited []string
+			walkFn := writeManifestTo(fsys)
+			err := New(WithFS(fsys), WithHiddenPolicy(tt.policy)).Walk(context.Background(), ".",
+				func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+					visited = append(visited, dirPath)
+					return walkFn(ctx, dirPath, m, cached, err)
+				})
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			if fmt.Sprint(visited) != tt.visited {
+				t.Errorf("Expected %s to be visited, got %v", tt.visited, visited)
+			}
+			m, err := manifest.LoadManifestFS(fsys, manifest.DefaultName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entity := range m.Entities {
+				names = append(names, entity.Name)
+			}
+			if fmt.Sprint(names) != tt.entities {
+				t.Errorf("Expected entities %s, got %v", tt.entities, names)
+			}
+			if m.HiddenPolicy != tt.recorded {
+				t.Errorf("Expected hidden policy '%s' to be recorded, got '%s'", tt.recorded, m.HiddenPolicy)
+			}
+		})
+	}
+}
+
+func TestParseHiddenPolicy(t *testing.T) {
+	for _, policy := range []string{"include", "exclude", "warn"} {
+		if parsed, err := ParseHiddenPolicy(policy); err != nil || string(parsed) != policy {
+			t.Errorf("ParseHiddenPolicy(%q) = %q, %v", policy, parsed, err)
+		}
+	}
+	if _, err := ParseHiddenPolicy("skip"); err == nil {
+		t.Errorf("Expected an unknown policy to be rejected")
+	}
+}
+
+// createBenchmarkTree creates dirs directories of files files of fileSize bytes each, with manifests in place
+func createBenchmarkTree(b *testing.B, dirs int, files int, fileSize int) string {
+	b.Helper()
+	root := b.TempDir()
+	content := make([]byte, fileSize)
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("dir%03d", d))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%04d", f)), content, 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	err := New().Walk(context.Background(), root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return root
+}
+
+func BenchmarkScannerWalk(b *testing.B) {
+	root := createBenchmarkTree(b, 20, 100, 4096)
+	noop := func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	}
+	b.Run("OS", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := New().Walk(context.Background(), root, noop); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("DirFS", func(b *testing.B) {
+		fsys := os.DirFS(root)
+		for i := 0; i < b.N; i++ {
+			if err := New(WithFS(fsys)).Walk(context.Background(), ".", noop); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkScannerWalk_SmallFiles scans 100k files of 256 bytes, where per-file overhead dominates.
+// Observed on a single-core x86_64 VM: 1.2-1.5s per walk with both a 4KiB and the default read buffer,
+// and ~147MB allocated in either case. Allocating the 1MiB buffer per file instead would add ~100GB.
+func BenchmarkScannerWalk_SmallFiles(b *testing.B) {
+	root := createBenchmarkTree(b, 100, 1000, 256)
+	noop := func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	}
+	for _, bufSize := range []int{4 << 10, DefaultReadBufferSize} {
+		b.Run(fmt.Sprintf("%dKiB", bufSize>>10), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := New(WithReadBufferSize(bufSize)).Walk(context.Background(), root, noop); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkScannerWalk_Cached walks a tree whose manifests are all fresh, so no file is hashed.
+// Observed on a single-core x86_64 VM: ~0.3s for the same 100k files, about a quarter of a full scan.
+func BenchmarkScannerWalk_Cached(b *testing.B) {
+	root := createBenchmarkTree(b, 100, 1000, 256)
+	walkFn := func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err == nil && !cached {
+			return fmt.Errorf("expected a cached manifest for %s", dirPath)
+		}
+		return err
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := New(WithManifestFreshnessLimit(time.Hour)).Walk(context.Background(), root, walkFn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScanner_WithMaxDepth(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":       {Data: []byte("root")},
+		"a/a.txt":        {Data: []byte("a")},
+		"a/b/b.txt":      {Data: []byte("b")},
+		"a/b/c/c.txt":    {Data: []byte("c")},
+		"x/x.txt":        {Data: []byte("x")},
+		"x/empty/y/y.md": {Data: []byte("y")},
+	}
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	err := New(WithFS(fsys), WithMaxDepth(1)).Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			visited = append(visited, dirPath)
+			return walkFn(ctx, dirPath, m, cached, err)
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if fmt.Sprint(visited) != "[a x .]" {
+		t.Errorf("Expected [a x .] to be visited, got %v", visited)
+	}
+	m, err := manifest.LoadManifestFS(fsys, "a/"+manifest.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Directories below the cutoff are not listed by their parent
+	if len(m.Entities) != 1 || m.Entities[0].Name != "a.txt" {
+		t.Errorf("Expected only a.txt in a, got %+v", m.Entities)
+	}
+	if _, err := fsys.Stat("a/b/" + manifest.DefaultName); err == nil {
+		t.Errorf("Expected no manifest below the maximum depth")
+	}
+}
+
+func TestScanner_WithOneFileSystem_mustLeaveOutMountpoints(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":         {Data: []byte("root")},
+		"a/a.txt":          {Data: []byte("a")},
+		"a/nfs/remote.txt": {Data: []byte("remote")},
+		"mnt/m.txt":        {Data: []byte("m")},
+	}
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	s := New(WithFS(fsys), WithOneFileSystem(true))
+	s.options.mountpoint = func(dirPath string) bool { return dirPath == "a/nfs" || dirPath == "mnt" }
+	err := s.Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			visited = append(visited, dirPath)
+			return walkFn(ctx, dirPath, m, cached, err)
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if fmt.Sprint(visited) != "[a .]" {
+		t.Errorf("Expected [a .] to be visited, got %v", visited)
+	}
+	if got := s.GetStats().MountpointsSkipped(); got != 2 {
+		t.Errorf("Expected 2 mountpoints skipped, got %d", got)
+	}
+	m, err := manifest.LoadManifestFS(fsys, "a/"+manifest.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entities) != 1 || m.Entities[0].Name != "a.txt" {
+		t.Errorf("Expected only a.txt in a, got %+v", m.Entities)
+	}
+	if fmt.Sprint(m.Mountpoints) != "[nfs]" {
+		t.Errorf("Expected nfs recorded as mountpoint of a, got %v", m.Mountpoints)
+	}
+	if _, err := fsys.Stat("a/nfs/" + manifest.DefaultName); err == nil {
+		t.Errorf("Expected no manifest in a mountpoint")
+	}
+
+	// Without the option the mountpoints are scanned like any directory
+	s = New(WithFS(fsys))
+	s.options.mountpoint = func(dirPath string) bool { return true }
+	if err := s.Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if _, err := fsys.Stat("a/nfs/" + manifest.DefaultName); err != nil {
+		t.Errorf("Expected a manifest in a/nfs without WithOneFileSystem: %v", err)
+	}
+}
+
+func TestScanner_WithOnly_RescansAncestorsAndSkipsSiblings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":         {Data: []byte("root")},
+		"apps/web/w.txt":   {Data: []byte("w")},
+		"apps/web/s/s.txt": {Data: []byte("s")},
+		"apps/api/a.txt":   {Data: []byte("a")},
+		"docs/d.txt":       {Data: []byte("d")},
+	}
+	if err := New(WithFS(fsys)).Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	oldRoot := fsys[manifest.DefaultName].Data
+	fsys["apps/web/s/s.txt"] = &fstest.MapFile{Data: []byte("changed")}
+
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	// Every manifest is fresh, only the targets may be reused
+	sc := New(WithFS(fsys), WithOnly("apps/w*"), WithManifestFreshnessLimit(time.Hour), WithFreshnessMode(FreshnessModeEmbedded))
+	err := sc.Walk(context.Background(), ".", func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		visited = append(visited, fmt.Sprintf("%s:%v", dirPath, cached))
+		return walkFn(ctx, dirPath, m, cached, err)
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if fmt.Sprint(visited) != "[apps/web/s:false apps/web:false apps:false .:false]" {
+		t.Errorf("Unexpected visits %v", visited)
+	}
+	if string(fsys[manifest.DefaultName].Data) == string(oldRoot) {
+		t.Errorf("Expected the root manifest to be updated")
+	}
+
+	// A full walk now finds every manifest consistent with its directory
+	sc = New(WithFS(fsys))
+	err = sc.Walk(context.Background(), ".", func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		existing, err := sc.LoadManifest(dirPath)
+		if err != nil {
+			return err
+		}
+		if identical, _, _ := manifest.CompareManifests(existing, m); !identical {
+			t.Errorf("Manifest of %s is out of date", dirPath)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+}
+
+func TestScanner_WalkChanged_VisitsAffectedDirectoriesAndAncestors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":         {Data: []byte("root")},
+		"apps/web/w.txt":   {Data: []byte("w")},
+		"apps/web/s/s.txt": {Data: []byte("s")},
+		"apps/[x]/x.txt":   {Data: []byte("x")},
+		"apps/api/a.txt":   {Data: []byte("a")},
+		"docs/d.txt":       {Data: []byte("d")},
+	}
+	if err := New(WithFS(fsys)).Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	fsys["apps/web/w.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	fsys["apps/[x]/y/new.txt"] = &fstest.MapFile{Data: []byte("new")}
+	delete(fsys, "docs/d.txt")
+	delete(fsys, "docs/"+manifest.DefaultName)
+
+	tests := []struct {
+		name    string
+		changed []string
+		visited string
+	}{
+		{"changed file", []string{"apps/web/w.txt"}, "[apps/web apps .]"},
+		{"new directory and its subtree", []string{"apps/[x]"}, "[apps/[x]/y apps/[x] apps .]"},
+		{"deleted directory", []string{"docs/d.txt", "docs"}, "[.]"},
+		{"several changes", []string{"apps/web/w.txt", "apps/api/a.txt"}, "[apps/api apps/web apps .]"},
+		{"manifest", []string{"apps/" + manifest.DefaultName}, "[]"},
+		{"excluded", []string{"apps/web/w.tmp"}, "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var visited []string
+			walkFn := writeManifestTo(fsys)
+			err := New(WithFS(fsys), WithExcludes("*.tmp")).WalkChanged(context.Background(), ".", tt.changed,
+				func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+					visited = append(visited, dirPath)
+					return walkFn(ctx, dirPath, m, cached, err)
+				})
+			if err != nil {
+				t.Fatalf("WalkChanged failed: %v", err)
+			}
+			if fmt.Sprint(visited) != tt.visited {
+				t.Errorf("Expected %s to be visited, got %v", tt.visited, visited)
+			}
+		})
+	}
+}
+
+func TestScanner_WalkChanged_OutsideRoot_mustFail(t *testing.T) {
+	dir := t.TempDir()
+	err := New().WalkChanged(context.Background(), filepath.Join(dir, "root"), []string{filepath.Join(dir, "other")},
+		func(_ context.Context, _ string, _ *manifest.Manifest, _ bool, err error) error { return err })
+	if err == nil || !strings.Contains(err.Error(), "is not inside") {
+		t.Errorf("Expected an error for a path outside the root, got %v", err)
+	}
+}
+
+func TestScanner_WithManifestName_ListsFilesNamedLikeTheDefaultManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":              {Data: []byte("a")},
+		manifest.DefaultName: {Data: []byte("not a manifest")},
+	}
+	var computed *manifest.Manifest
+	err := New(WithFS(fsys), WithManifestName(".custom.manifest")).Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			computed = m
+			return err
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(computed.Entities) != 2 || computed.Entities[0].Name != manifest.DefaultName {
+		t.Errorf("Expected %s to be listed like any other file, got %+v", manifest.DefaultName, computed.Entities)
+	}
+}
+
+func TestScanner_WithInvalidFreshManifest_RescansDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":              {Data: []byte("a")},
+		manifest.DefaultName: {Data: []byte("not a manifest"), ModTime: time.Now()},
+	}
+	var computed *manifest.Manifest
+	var wasCached bool
+	err := New(WithFS(fsys), WithManifestFreshnessLimit(time.Hour)).Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			computed, wasCached = m, cached
+			return err
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if wasCached || len(computed.Entities) != 1 || computed.Entities[0].Name != "a.txt" {
+		t.Errorf("Expected the directory to be rescanned without the invalid manifest, got cached=%v %+v", wasCached, computed.Entities)
+	}
+}
+
+func TestScanner_WithFreshListingCheck_RescansDirectoryNotMatchingFreshManifest(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("a")}, "b.txt": {Data: []byte("b")}}
+	if err := New(WithFS(fsys)).Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	fsys[manifest.DefaultName].ModTime = time.Now()
+	walk := func(opts ...Option) bool {
+		var wasCached bool
+		opts = append(opts, WithFS(fsys), WithManifestFreshnessLimit(time.Hour))
+		err := New(opts...).Walk(context.Background(), ".",
+			func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+				wasCached = cached
+				return err
+			})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return wasCached
+	}
+	if !walk(WithFreshListingCheck(true)) {
+		t.Errorf("Expected the fresh manifest matching the listing to be reused")
+	}
+
+	// Same names, different size: the listing no longer matches
+	fsys["b.txt"] = &fstest.MapFile{Data: []byte("bigger")}
+	if walk(WithFreshListingCheck(true)) {
+		t.Errorf("Expected a resized file to make the directory rescanned")
+	}
+	if !walk() {
+		t.Errorf("Expected the fresh manifest to be reused without the listing check")
+	}
+	fsys["b.txt"] = &fstest.MapFile{Data: []byte("b")}
+	fsys["c.txt"] = &fstest.MapFile{Data: []byte("c")}
+	if walk(WithFreshListingCheck(true)) {
+		t.Errorf("Expected an added file to make the directory rescanned")
+	}
+}
+
+func TestScanner_WithFreshListingCheck_RescansParentOfRegeneratedSubdirectory(t *testing.T) {
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("a")}, "sub/b.txt": {Data: []byte("b")}}
+	if err := New(WithFS(fsys)).Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	// The subdirectory is tampered with and regenerated, the root manifest is only touched
+	fsys["sub/b.txt"] = &fstest.MapFile{Data: []byte("x")}
+	if err := New(WithFS(fsys)).Walk(context.Background(), "sub", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	fsys[manifest.DefaultName].ModTime = time.Now()
+
+	reused := make(map[string]bool)
+	err := New(WithFS(fsys), WithManifestFreshnessLimit(time.Hour), WithFreshListingCheck(true)).Walk(context.Background(), ".",
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			reused[dirPath] = cached
+			return err
+		})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if reused["."] {
+		t.Errorf("Expected the root to be rescanned as it records another checksum of the subdirectory manifest")
+	}
+}
+
+// TestScannerWalk_HugeFlatDirectory_BoundedMemory scans a directory of 200k files, which is listed in batches
+// while workers hash them. The live heap is sampled during the scan, the manifest of the directory being the
+// only thing growing with the number of entries.
+func TestScannerWalk_HugeFlatDirectory_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates 200k files")
+	}
+	const files = 200_000
+	root := t.TempDir()
+	for i := 0; i < files; i++ {
+		f, err := os.Create(filepath.Join(root, fmt.Sprintf("object%06d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var peak uint64
+	stop, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&m)
+				peak = max(peak, m.HeapAlloc)
+			}
+		}
+	}()
+
+	sc := New()
+	var entities int
+	err := sc.Walk(context.Background(), root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err == nil {
+			entities = len(m.Entities)
+		}
+		return err
+	})
+	close(stop)
+	<-sampled
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if entities != files {
+		t.Errorf("Expected %d entities, got %d", files, entities)
+	}
+	if discovered := sc.GetStats().EntriesDiscovered(); discovered != files {
+		t.Errorf("Expected %d entries discovered, got %d", files, discovered)
+	}
+	growth := int64(peak) - int64(before.HeapAlloc)
+	t.Logf("peak heap growth %d MB, %d bytes per file", growth>>20, growth/files)
+	// Entities take ~200 bytes each, the garbage collector may let the heap grow to about twice the live data
+	if perFile := growth / files; perFile > 1024 {
+		t.Errorf("Expected at most 1 KB of heap per file, got %d bytes", perFile)
+	}
+}
+
+func TestScanner_WalkDirectories_VisitsListedDirectoriesAndAncestorsOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"root.txt":    {Data: []byte("root")},
+		"a/a.txt":     {Data: []byte("a")},
+		"a/b/b.txt":   {Data: []byte("b")},
+		"a/b/c/c.txt": {Data: []byte("c")},
+		"x/x.txt":     {Data: []byte("x")},
+	}
+	if err := New(WithFS(fsys)).Walk(context.Background(), ".", writeManifestTo(fsys)); err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	var visited []string
+	walkFn := writeManifestTo(fsys)
+	err := New(WithFS(fsys)).WalkDirectories(context.Background(), ".", []string{"a/b", "x"},
+		func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			visited = append(visited, dirPath)
+			return walkFn(ctx, dirPath, m, cached, err)
+		})
+	if err != nil {
+		t.Fatalf("WalkDirectories failed: %v", err)
+	}
+	if fmt.Sprint(visited) != "[a/b a x .]" {
+		t.Errorf("Expected [a/b a x .] to be visited, got %v", visited)
+	}
+
+	root := t.TempDir()
+	err = New().WalkDirectories(context.Background(), filepath.Join(root, "a"), []string{filepath.Join(root, "x")}, walkFn)
+	if err == nil || !strings.Contains(err.Error(), "is not inside") {
+		t.Errorf("Expected an error for a directory outside the root, got %v", err)
+	}
+}
+
+func TestScanner_WithSampledVerification_ReadsOnlySampledRegions(t *testing.T) {
+	tempDir := t.TempDir()
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	bigPath := filepath.Join(tempDir, "big.bin")
+	if err := os.WriteFile(bigPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "small.txt"), []byte("small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sampling := manifest.Sampling{Threshold: 100, EdgeBytes: 10, BlockBytes: 10, Blocks: 4}
+
+	walk := func(sc *Scanner) (*manifest.Manifest, *Stats) {
+		t.Helper()
+		var root *manifest.Manifest
+		err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			root = m
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return root, sc.GetStats()
+	}
+	entity := func(m *manifest.Manifest, name string) manifest.Entity {
+		for _, e := range m.Entities {
+			if e.Name == name {
+				return e
+			}
+		}
+		t.Fatalf("entity %s not found", name)
+		return manifest.Entity{}
+	}
+
+	generated, _ := walk(New(WithSampling(sampling)))
+	if generated.Sampling == nil || *generated.Sampling != sampling {
+		t.Fatalf("expected sampling parameters to be recorded, got %v", generated.Sampling)
+	}
+	big := entity(generated, "big.bin")
+	if big.Checksum == "" || big.SampleChecksum == "" {
+		t.Fatalf("expected both checksums of big.bin, got %+v", big)
+	}
+	if small := entity(generated, "small.txt"); small.SampleChecksum != "" {
+		t.Errorf("files below the threshold must not be sampled, got %+v", small)
+	}
+	if err := generated.Save(filepath.Join(tempDir, manifest.DefaultName)); err != nil {
+		t.Fatal(err)
+	}
+
+	sampled, stats := walk(New(WithSampledVerification(true)))
+	if got := entity(sampled, "big.bin"); got.Checksum != "" || got.SampleChecksum != big.SampleChecksum {
+		t.Errorf("expected only the sample checksum %s, got %+v", big.SampleChecksum, got)
+	}
+	if stats.FilesSampled() != 1 {
+		t.Errorf("expected 1 sampled file, got %d", stats.FilesSampled())
+	}
+	if stats.BytesHashed() >= int64(len(data)) {
+		t.Errorf("expected only the sampled regions to be read, read %d bytes", stats.BytesHashed())
+	}
+	if identical, diffs, _ := manifest.CompareManifests(generated, sampled); !identical {
+		t.Errorf("expected the sampled manifest to match, got %v", diffs)
+	}
+
+	// A change between the sampled regions goes unnoticed, one inside them does not
+	regions := sampling.Regions(int64(len(data)))
+	data[regions[0].Offset+regions[0].Length] ^= 0xff
+	if err := os.WriteFile(bigPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sampled, _ = walk(New(WithSampledVerification(true)))
+	if identical, _, _ := manifest.CompareManifests(generated, sampled); !identical {
+		t.Error("a change outside of the sampled regions must not be detected by a sampled verification")
+	}
+	full, _ := walk(New())
+	if identical, _, _ := manifest.CompareManifests(generated, full); identical {
+		t.Error("a full verification must detect every change")
+	}
+	data[regions[1].Offset] ^= 0xff
+	if err := os.WriteFile(bigPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sampled, _ = walk(New(WithSampledVerification(true)))
+	_, diffs, _ := manifest.CompareManifests(generated, sampled)
+	if len(diffs) != 1 || diffs[0].Type != manifest.DiffChecksumMismatch || !diffs[0].ActualEntity.Sampled() {
+		t.Errorf("expected a sampled checksum mismatch of big.bin, got %+v", diffs)
+	}
+}
+
+func TestScanner_WithChunking_RecordsChunksOfLargeFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "big.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "small.txt"), []byte("small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(sc *Scanner) map[string]manifest.Entity {
+		t.Helper()
+		entities := make(map[string]manifest.Entity)
+		err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			for _, e := range m.Entities {
+				entities[e.Name] = e
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return entities
+	}
+
+	generated := walk(New(WithChunking(4096)))
+	big := generated["big.bin"]
+	if big.Chunking == nil || big.Chunking.ChunkSize != 4096 || len(big.Chunking.ChunkDigests) != 3 {
+		t.Fatalf("expected 3 chunks of 4096 bytes, got %+v", big.Chunking)
+	}
+	checksum, err := FileChecksum(context.Background(), filepath.Join(tempDir, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if big.Checksum != checksum {
+		t.Errorf("expected the checksum of the whole file %s, got %s", checksum, big.Checksum)
+	}
+	if generated["small.txt"].Chunking != nil {
+		t.Errorf("expected no chunks for a file smaller than one chunk")
+	}
+
+	m := manifest.New([]manifest.Entity{generated["big.bin"], generated["small.txt"]})
+	if err := m.Save(filepath.Join(tempDir, manifest.DefaultName)); err != nil {
+		t.Fatal(err)
+	}
+	data[9000] ^= 0xff
+	if err := os.WriteFile(filepath.Join(tempDir, "big.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verification chunks the files with the chunk size their manifest records
+	verified := walk(New(WithChunkedVerification(true)))
+	first, count, ok := manifest.BadChunks(big.Chunking, verified["big.bin"].Chunking)
+	if !ok || first != 2 || count != 1 {
+		t.Errorf("expected only chunk 2 to differ, got first %d, count %d, ok %v", first, count, ok)
+	}
+	if verified["small.txt"].Chunking != nil {
+		t.Errorf("expected no chunks for a file its manifest records none for")
+	}
+}
+
+func TestScanner_WithFastVerification_SkipsFilesWhoseSizeChanged(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{"grown.bin": "original", "same.txt": "same"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	walk := func(sc *Scanner) (*manifest.Manifest, *Stats) {
+		t.Helper()
+		var root *manifest.Manifest
+		err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+			root = m
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Walk failed: %v", err)
+		}
+		return root, sc.GetStats()
+	}
+
+	generated, _ := walk(New())
+	if err := generated.Save(filepath.Join(tempDir, manifest.DefaultName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "grown.bin"), []byte("original and more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fast, stats := walk(New(WithFastVerification(true)))
+	if stats.FilesUnhashed() != 1 {
+		t.Errorf("expected 1 unhashed file, got %d", stats.FilesUnhashed())
+	}
+	if stats.BytesHashed() != int64(len("same")) {
+		t.Errorf("expected only same.txt to be read, read %d bytes", stats.BytesHashed())
+	}
+	_, diffs, _ := manifest.CompareManifests(generated, fast)
+	if len(diffs) != 1 || diffs[0].Type != manifest.DiffSizeMismatch ||
+		*diffs[0].ActualEntity.Size != int64(len("original and more")) {
+		t.Errorf("expected a size mismatch of grown.bin, got %+v", diffs)
+	}
+
+	// Without the fast path, the new checksum is computed and reported
+	full, _ := walk(New())
+	_, diffs, _ = manifest.CompareManifests(generated, full)
+	if len(diffs) != 1 || diffs[0].Type != manifest.DiffChecksumMismatch || diffs[0].ActualEntity.Checksum == "" {
+		t.Errorf("expected a checksum mismatch of grown.bin, got %+v", diffs)
+	}
+
+	// Expectations can be supplied instead of loaded from the tree
+	expected := manifest.New(nil)
+	fast, _ = walk(New(WithFastVerification(true), WithExpectedManifests(func(dirPath string) *manifest.Manifest {
+		return expected
+	})))
+	for _, entity := range fast.Entities {
+		if entity.Unhashed() {
+			t.Errorf("expected every file to be hashed without recorded sizes, got %+v", entity)
+		}
+	}
+}
+
+// BenchmarkScannerWalk_FastVerification verifies a tree of 8 files of 32MiB whose size all changed.
+// The fast path only stats them, while a full verification reads 256MiB.
+// Observed on a single-core x86_64 VM: ~0.25s per walk without the fast path, ~0.2ms with it.
+func BenchmarkScannerWalk_FastVerification(b *testing.B) {
+	root := createBenchmarkTree(b, 1, 8, 32<<20)
+	var generated *manifest.Manifest
+	err := New().Walk(context.Background(), root, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err == nil && dirPath != root {
+			generated = m
+		}
+		return err
+	})
+	if err != nil || generated == nil {
+		b.Fatalf("failed to scan the tree: %v", err)
+	}
+	for i := range generated.Entities {
+		size := *generated.Entities[i].Size + 1
+		generated.Entities[i].Size = &size
+	}
+	expected := func(dirPath string) *manifest.Manifest { return generated }
+	noop := func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return err
+	}
+	for _, fast := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fast=%v", fast), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sc := New(WithFastVerification(fast), WithExpectedManifests(expected))
+				if err := sc.Walk(context.Background(), root, noop); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestScanner_WithDirStartHook_CalledBeforeEachScanInPostOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/file.txt": &fstest.MapFile{Data: []byte("b")},
+		"a/file.txt":   &fstest.MapFile{Data: []byte("a")},
+		"c/file.txt":   &fstest.MapFile{Data: []byte("c")},
+		"x/file.txt":   &fstest.MapFile{Data: []byte("x")},
+	}
+	var events []string
+	walkFn := writeManifestTo(fsys)
+	sc := New(WithFS(fsys), WithExcludes("x"), WithDirStartHook(func(dirPath string) {
+		events = append(events, "start "+dirPath)
+	}))
+	err := sc.WalkWithInfo(context.Background(), ".", func(ctx context.Context, dirPath string, m *manifest.Manifest, info ScanInfo, err error) error {
+		if err == nil && info.Duration <= 0 {
+			t.Errorf("Expected a positive duration for %s, got %v", dirPath, info.Duration)
+		}
+		events = append(events, "done "+dirPath)
+		return walkFn(ctx, dirPath, m, info.Cached, err)
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	expected := []string{"start a/b", "done a/b", "start a", "done a", "start c", "done c", "start .", "done ."}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events %v, got %v", expected, events)
+	}
+}
+
+func TestScanner_WithDirStartHook_NotCalledForCachedDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generateWith(t, New(), tempDir)
+
+	var started []string
+	var reused []string
+	sc := New(WithManifestFreshnessLimit(time.Hour), WithDirStartHook(func(dirPath string) {
+		started = append(started, filepath.Base(dirPath))
+	}))
+	err := sc.Walk(context.Background(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if cached {
+			reused = append(reused, filepath.Base(dirPath))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	if len(started) != 0 {
+		t.Errorf("Expected no directory started when all manifests are reused, got %v", started)
+	}
+	if !reflect.DeepEqual(reused, []string{"sub", filepath.Base(tempDir)}) {
+		t.Errorf("Expected every directory to be cached, got %v", reused)
+	}
+}
@@ -0,0 +1,235 @@
+package scanner
+
+import (
+	"context"
+	"github.com/tomekjarosik/bytecheck/pkg/lock"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// dirScope describes how a directory visited by Walk is scanned
+type dirScope struct {
+	// depth is the number of directories between the walk root and the directory, 0 for the root
+	depth int
+	// ancestorOnly is set for directories that are only scanned because they lead to a WithOnly or WalkChanged target.
+	// They are always rescanned, so that they record the new checksums of the targets.
+	ancestorOnly bool
+	// config is the effective config of the directory, see DirConfig, configErr the error loading it
+	config    DirConfig
+	configErr error
+	// hidden is set for hidden directories and directories below one, see manifest.IsHidden
+	hidden bool
+	// manifestName is the name of the manifest of the directory, see WithManifestNameFunc
+	manifestName string
+}
+
+// onlyPattern restricts a walk to the directories it matches, their ancestors and, with subtree, their subdirectories
+type onlyPattern struct {
+	// elems holds the path.Match patterns of the path elements relative to the walk root
+	elems   []string
+	subtree bool
+}
+
+// onlyPatterns returns the patterns given by WithOnly
+func (s *Scanner) onlyPatterns() []onlyPattern {
+	patterns := make([]onlyPattern, 0, len(s.options.only))
+	for _, pattern := range s.options.only {
+		patterns = append(patterns, onlyPattern{elems: splitOnlyPattern(pattern), subtree: true})
+	}
+	return patterns
+}
+
+// scope returns the scope of dirPath and whether it is visited at all.
+// Directories are left out when they or one of their ancestors are excluded, also by a DirConfig, when they are
+// deeper than WithMaxDepth, when they are mountpoints left out by WithOneFileSystem, or when only is not empty and
+// they are neither inside nor above a directory it matches.
+func (s *Scanner) scope(root string, dirPath string, only []onlyPattern) (dirScope, bool) {
+	elems := s.fs.RelElems(root, dirPath)
+	if s.excludedPath(root, elems) {
+		return dirScope{}, false
+	}
+	if s.options.maxDepth >= 0 && len(elems) > s.options.maxDepth {
+		return dirScope{}, false
+	}
+	if len(elems) > 0 && s.isMountpoint(dirPath) {
+		return dirScope{}, false
+	}
+	scope := dirScope{depth: len(elems), hidden: slices.ContainsFunc(elems, manifest.IsHidden),
+		manifestName: s.ManifestName(dirPath, len(elems) == 0)}
+	scope.config, scope.configErr = s.dirConfig(root, elems)
+	if len(only) == 0 {
+		return scope, true
+	}
+	inside, ancestor := matchOnly(only, elems)
+	scope.ancestorOnly = !inside
+	return scope, inside || ancestor
+}
+
+// matchOnly reports whether the directory with the relative path elems is matched by one of the patterns
+// or inside a subtree they match, and whether it is an ancestor of directories that may be matched
+func matchOnly(patterns []onlyPattern, elems []string) (inside bool, ancestor bool) {
+	for _, pattern := range patterns {
+		if len(elems) > len(pattern.elems) && !pattern.subtree {
+			continue
+		}
+		n := min(len(elems), len(pattern.elems))
+		matched := true
+		for i := 0; i < n && matched; i++ {
+			matched, _ = path.Match(pattern.elems[i], elems[i])
+		}
+		if !matched {
+			continue
+		}
+		if len(elems) >= len(pattern.elems) {
+			return true, false
+		}
+		ancestor = true
+	}
+	return false, ancestor
+}
+
+// splitOnlyPattern splits a WithOnly pattern into the patterns of its path elements, "." selects the root
+func splitOnlyPattern(pattern string) []string {
+	cleaned := path.Clean(filepath.ToSlash(pattern))
+	if cleaned == "." {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
+
+// literalPattern returns a path.Match pattern matching only name
+func literalPattern(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// filterEntries removes excluded entries in place, including hidden ones with HiddenExclude, subdirectories of directories at WithMaxDepth and the lock
+// file of a run writing manifests, see lock.Name. The lock is only held at the root of a tree, files of its name below are hashed like any other.
+func (s *Scanner) filterEntries(entries []os.DirEntry, scope dirScope) []os.DirEntry {
+	leaf := s.options.maxDepth >= 0 && scope.depth == s.options.maxDepth
+	filtering := len(s.options.excludes) > 0 || len(scope.config.Exclude) > 0 || leaf ||
+		s.options.hiddenPolicy == HiddenExclude
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Name() == lock.Name && scope.depth == 0 {
+			continue
+		}
+		if filtering && (s.excluded(entry.Name(), scope.config, scope.manifestName) || (leaf && entry.IsDir())) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// listingMatches reports whether the entries of dir match the entities of m by name and kind, and by size for the
+// files m records it for. It is the check a fresh manifest must pass to be reused without hashing anything, see
+// WithManifestFreshnessLimit. entries holds the filtered entries of dir when they were already read, nil otherwise.
+func (s *Scanner) listingMatches(dir string, entries []os.DirEntry, scope dirScope, m *manifest.Manifest) bool {
+	if entries == nil {
+		all, err := s.fs.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		entries = s.filterEntries(all, scope)
+	}
+	expected := make(map[string]manifest.Entity, len(m.Entities))
+	for _, entity := range m.Entities {
+		expected[entity.Name] = entity
+	}
+	matched := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == scope.manifestName || slices.Contains(m.Mountpoints, name) {
+			continue
+		}
+		entryPath := s.fs.Join(dir, name)
+		special := ""
+		if !entry.IsDir() {
+			special = s.specialKind(entry, entryPath)
+		}
+		if special != "" && s.options.specialFiles == SpecialFilesSkip {
+			continue
+		}
+		entity, ok := expected[name]
+		if !ok || entity.IsDir != entry.IsDir() || entity.Special != special {
+			return false
+		}
+		if entity.Size != nil {
+			info, err := s.fs.Stat(entryPath)
+			if err != nil || info.Size() != *entity.Size {
+				return false
+			}
+		}
+		matched++
+	}
+	return matched == len(m.Entities)
+}
+
+// childManifestsMatch reports whether the manifests of the subdirectories of dir match the checksums m records
+// for them, so that a subdirectory regenerated after m was written is not covered by it. Unmanaged subdirectories
+// never match, they are verified by scanning their parent.
+func (s *Scanner) childManifestsMatch(ctx context.Context, dir string, m *manifest.Manifest) bool {
+	for _, entity := range m.Entities {
+		if !entity.IsDir || slices.Contains(m.Mountpoints, entity.Name) {
+			continue
+		}
+		if entity.Unmanaged() {
+			return false
+		}
+		checksum, err := s.checksum(ctx, s.ManifestPath(s.fs.Join(dir, entity.Name)), true, nil)
+		if err != nil || !manifest.SecureEqualHex(checksum, entity.Checksum) {
+			return false
+		}
+	}
+	return true
+}
+
+// isMountpoint reports whether WithOneFileSystem leaves out dirPath because it is on another device than the walk root
+func (s *Scanner) isMountpoint(dirPath string) bool {
+	if !s.options.oneFileSystem {
+		return false
+	}
+	if s.options.mountpoint != nil {
+		return s.options.mountpoint(dirPath)
+	}
+	if s.rootDevice == nil {
+		return false
+	}
+	info, err := s.fs.Lstat(dirPath)
+	if err != nil {
+		return false
+	}
+	device, ok := deviceID(info)
+	return ok && device != *s.rootDevice
+}
+
+// dropMountpoints removes the subdirectories of dir left out by WithOneFileSystem from entries in place,
+// and returns their names
+func (s *Scanner) dropMountpoints(dir string, entries []os.DirEntry) ([]os.DirEntry, []string) {
+	if !s.options.oneFileSystem {
+		return entries, nil
+	}
+	var mountpoints []string
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.IsDir() && s.isMountpoint(s.fs.Join(dir, entry.Name())) {
+			s.GetLogger().Debug("mountpoint skipped", "path", s.fs.Join(dir, entry.Name()))
+			s.stats.IncreaseMountpointsSkipped()
+			mountpoints = append(mountpoints, entry.Name())
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept, mountpoints
+}
@@ -0,0 +1,33 @@
+package scanner
+
+import (
+	"io/fs"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// specialKind returns the kind of special file entry is, following symbolic links, or an empty string
+// for regular files. Errors are left for hashing to report.
+func (s *Scanner) specialKind(entry fs.DirEntry, entryPath string) string {
+	mode := entry.Type()
+	if mode&fs.ModeSymlink != 0 {
+		info, err := s.fs.Stat(entryPath)
+		if err != nil {
+			return ""
+		}
+		mode = info.Mode().Type()
+	}
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return manifest.SpecialFIFO
+	case mode&fs.ModeSocket != 0:
+		return manifest.SpecialSocket
+	case mode&fs.ModeCharDevice != 0:
+		return manifest.SpecialCharDevice
+	case mode&fs.ModeDevice != 0:
+		return manifest.SpecialDevice
+	case mode&fs.ModeIrregular != 0:
+		return manifest.SpecialIrregular
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+//go:build unix
+
+package scanner
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// createSpecialTree creates a tree with a regular file, a FIFO, a symbolic link to it,
+// a unix socket and an empty directory
+func createSpecialTree(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(dir, "pipe"), 0644); err != nil {
+		t.Fatalf("Failed to create FIFO: %v", err)
+	}
+	if err := os.Symlink("pipe", filepath.Join(dir, "pipe-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Socket paths are limited to about 100 bytes, which temporary directories may exceed
+	socketDir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(socketDir) })
+	listener, err := net.Listen("unix", filepath.Join(socketDir, "s"))
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	if err := os.Symlink(filepath.Join(socketDir, "s"), filepath.Join(dir, "socket-link")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// walkSpecialTree generates manifests of dir and returns the root manifest, failing instead of hanging
+func walkSpecialTree(t *testing.T, dir string, opts ...Option) *manifest.Manifest {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var root *manifest.Manifest
+	err := New(opts...).Walk(ctx, dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil {
+			return err
+		}
+		root = m
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+	return root
+}
+
+func TestScanner_WithSpecialFiles_RecordsThemWithoutReading(t *testing.T) {
+	dir := createSpecialTree(t)
+
+	root := walkSpecialTree(t, dir)
+
+	kinds := make(map[string]manifest.Entity)
+	for _, entity := range root.Entities {
+		kinds[entity.Name] = entity
+	}
+	for name, kind := range map[string]string{"file.txt": "file", "pipe": manifest.SpecialFIFO,
+		"pipe-link": manifest.SpecialFIFO, "socket-link": manifest.SpecialSocket, "empty": "directory"} {
+		if got := kinds[name].Kind(); got != kind {
+			t.Errorf("Expected %s to be a %s, got %s", name, kind, got)
+		}
+	}
+	if checksum := kinds["pipe"].Checksum; checksum != manifest.SpecialChecksum(manifest.SpecialFIFO, "pipe") {
+		t.Errorf("Unexpected checksum of FIFO: %s", checksum)
+	}
+	if !kinds["empty"].Empty {
+		t.Error("Expected the empty directory to be marked empty")
+	}
+	if kinds["file.txt"].Empty {
+		t.Error("Expected files not to be marked empty")
+	}
+}
+
+func TestScanner_WithSpecialFilesSkip_LeavesThemOut(t *testing.T) {
+	dir := createSpecialTree(t)
+
+	root := walkSpecialTree(t, dir, WithSpecialFiles(SpecialFilesSkip))
+
+	var names []string
+	for _, entity := range root.Entities {
+		names = append(names, entity.Name)
+	}
+	if len(names) != 2 || names[0] != "empty" || names[1] != "file.txt" {
+		t.Errorf("Expected only empty and file.txt, got %v", names)
+	}
+}
@@ -10,10 +10,38 @@ import (
 // Stats contains statistics about the scanning progress
 type Stats struct {
 	// Atomic fields (must be 64-bit aligned on 32-bit systems)
-	bytesProcessed  int64
+	// bytesHashed counts the bytes of files actually read and hashed. The manifests of child directories are
+	// hashed too, but their bytes are not counted, nor are they counted as covered.
+	bytesHashed int64
+	// bytesCovered counts the bytes of the files whose checksum is known, whether hashed or taken from a cache
+	// or a fresh manifest, bytesCached counts those taken from a cache or a fresh manifest
+	bytesCovered    int64
+	bytesCached     int64
 	filesProcessed  int64
 	cachedProcessed int64
 	dirsProcessed   int64
+	filesCached     int64
+	entriesVanished int64
+	// entriesDiscovered counts the entries listed in scanned directories, which grows while large directories
+	// are still being listed
+	entriesDiscovered int64
+	// filesSampled counts the files of which only the sampled regions were read, see WithSampledVerification
+	filesSampled int64
+	// filesUnhashed counts the files left unread because their size changed, see WithFastVerification
+	filesUnhashed int64
+	// filesUnchanged and dirsUnchanged count the files left unread and the directories reused as they were not
+	// modified since the cutoff of WithChangedSince
+	filesUnchanged int64
+	dirsUnchanged  int64
+	// mountpointsSkipped counts the subdirectories left out by WithOneFileSystem
+	mountpointsSkipped int64
+	// dirsTooLong counts the directories left out by WithTolerateLongPaths
+	dirsTooLong int64
+	// Verification counters, only a verifier updates them, see IncreaseManifestsValid
+	manifestsValid   int64
+	manifestsInvalid int64
+	manifestsShallow int64
+	manifestsAudited int64
 
 	// Protected by mutex
 	mu          sync.RWMutex
@@ -22,13 +50,31 @@ type Stats struct {
 
 	dirty    int32 // Atomic dirty flag
 	onUpdate func(*Stats)
+	// stop ends the periodic updates, stopped is closed once they ended, see Stop
+	stop    chan struct{}
+	stopped chan struct{}
 }
 
 func (s *Stats) Clear() {
-	atomic.StoreInt64(&s.bytesProcessed, 0)
+	atomic.StoreInt64(&s.bytesHashed, 0)
+	atomic.StoreInt64(&s.bytesCovered, 0)
+	atomic.StoreInt64(&s.bytesCached, 0)
 	atomic.StoreInt64(&s.filesProcessed, 0)
 	atomic.StoreInt64(&s.cachedProcessed, 0)
 	atomic.StoreInt64(&s.dirsProcessed, 0)
+	atomic.StoreInt64(&s.filesCached, 0)
+	atomic.StoreInt64(&s.entriesVanished, 0)
+	atomic.StoreInt64(&s.entriesDiscovered, 0)
+	atomic.StoreInt64(&s.filesSampled, 0)
+	atomic.StoreInt64(&s.filesUnhashed, 0)
+	atomic.StoreInt64(&s.filesUnchanged, 0)
+	atomic.StoreInt64(&s.dirsUnchanged, 0)
+	atomic.StoreInt64(&s.mountpointsSkipped, 0)
+	atomic.StoreInt64(&s.dirsTooLong, 0)
+	atomic.StoreInt64(&s.manifestsValid, 0)
+	atomic.StoreInt64(&s.manifestsInvalid, 0)
+	atomic.StoreInt64(&s.manifestsShallow, 0)
+	atomic.StoreInt64(&s.manifestsAudited, 0)
 
 	s.mu.Lock()
 	s.currentFile = ""
@@ -41,19 +87,75 @@ func (s *Stats) Snapshot() Stats {
 	defer s.mu.RUnlock()
 
 	return Stats{
-		bytesProcessed:  atomic.LoadInt64(&s.bytesProcessed),
-		filesProcessed:  atomic.LoadInt64(&s.filesProcessed),
-		cachedProcessed: atomic.LoadInt64(&s.cachedProcessed),
-		dirsProcessed:   atomic.LoadInt64(&s.dirsProcessed),
-		currentFile:     s.currentFile,
-		startTime:       s.startTime,
+		bytesHashed:        atomic.LoadInt64(&s.bytesHashed),
+		bytesCovered:       atomic.LoadInt64(&s.bytesCovered),
+		bytesCached:        atomic.LoadInt64(&s.bytesCached),
+		filesProcessed:     atomic.LoadInt64(&s.filesProcessed),
+		cachedProcessed:    atomic.LoadInt64(&s.cachedProcessed),
+		dirsProcessed:      atomic.LoadInt64(&s.dirsProcessed),
+		filesCached:        atomic.LoadInt64(&s.filesCached),
+		entriesVanished:    atomic.LoadInt64(&s.entriesVanished),
+		entriesDiscovered:  atomic.LoadInt64(&s.entriesDiscovered),
+		filesSampled:       atomic.LoadInt64(&s.filesSampled),
+		filesUnhashed:      atomic.LoadInt64(&s.filesUnhashed),
+		filesUnchanged:     atomic.LoadInt64(&s.filesUnchanged),
+		dirsUnchanged:      atomic.LoadInt64(&s.dirsUnchanged),
+		mountpointsSkipped: atomic.LoadInt64(&s.mountpointsSkipped),
+		dirsTooLong:        atomic.LoadInt64(&s.dirsTooLong),
+		manifestsValid:     atomic.LoadInt64(&s.manifestsValid),
+		manifestsInvalid:   atomic.LoadInt64(&s.manifestsInvalid),
+		manifestsShallow:   atomic.LoadInt64(&s.manifestsShallow),
+		manifestsAudited:   atomic.LoadInt64(&s.manifestsAudited),
+		currentFile:        s.currentFile,
+		startTime:          s.startTime,
 	}
 }
 
-func (s *Stats) BytesProcessed() int64  { return atomic.LoadInt64(&s.bytesProcessed) }
-func (s *Stats) FilesProcessed() int64  { return atomic.LoadInt64(&s.filesProcessed) }
-func (s *Stats) CachedProcessed() int64 { return atomic.LoadInt64(&s.cachedProcessed) }
-func (s *Stats) DirsProcessed() int64   { return atomic.LoadInt64(&s.dirsProcessed) }
+// BytesProcessed returns BytesHashed.
+//
+// Deprecated: use BytesHashed, or BytesCovered to include the bytes whose checksum was not computed.
+func (s *Stats) BytesProcessed() int64 { return s.BytesHashed() }
+
+func (s *Stats) BytesHashed() int64          { return atomic.LoadInt64(&s.bytesHashed) }
+func (s *Stats) BytesCovered() int64         { return atomic.LoadInt64(&s.bytesCovered) }
+func (s *Stats) BytesCached() int64          { return atomic.LoadInt64(&s.bytesCached) }
+func (s *Stats) FilesProcessed() int64       { return atomic.LoadInt64(&s.filesProcessed) }
+func (s *Stats) CachedProcessed() int64      { return atomic.LoadInt64(&s.cachedProcessed) }
+func (s *Stats) DirsProcessed() int64        { return atomic.LoadInt64(&s.dirsProcessed) }
+func (s *Stats) FilesCached() int64          { return atomic.LoadInt64(&s.filesCached) }
+func (s *Stats) EntriesVanished() int64      { return atomic.LoadInt64(&s.entriesVanished) }
+func (s *Stats) EntriesDiscovered() int64    { return atomic.LoadInt64(&s.entriesDiscovered) }
+func (s *Stats) FilesSampled() int64         { return atomic.LoadInt64(&s.filesSampled) }
+func (s *Stats) FilesUnhashed() int64        { return atomic.LoadInt64(&s.filesUnhashed) }
+func (s *Stats) FilesUnchanged() int64       { return atomic.LoadInt64(&s.filesUnchanged) }
+func (s *Stats) DirectoriesUnchanged() int64 { return atomic.LoadInt64(&s.dirsUnchanged) }
+func (s *Stats) MountpointsSkipped() int64   { return atomic.LoadInt64(&s.mountpointsSkipped) }
+func (s *Stats) DirectoriesTooLong() int64   { return atomic.LoadInt64(&s.dirsTooLong) }
+func (s *Stats) ManifestsValid() int64       { return atomic.LoadInt64(&s.manifestsValid) }
+func (s *Stats) ManifestsInvalid() int64     { return atomic.LoadInt64(&s.manifestsInvalid) }
+func (s *Stats) ManifestsShallow() int64     { return atomic.LoadInt64(&s.manifestsShallow) }
+func (s *Stats) ManifestsAudited() int64     { return atomic.LoadInt64(&s.manifestsAudited) }
+
+// ManifestsSkipped returns ManifestsShallow, fresh manifests are no longer skipped but verified shallowly.
+//
+// Deprecated: use ManifestsShallow.
+func (s *Stats) ManifestsSkipped() int64 { return s.ManifestsShallow() }
+
+// CacheHitRatio returns the share of the covered bytes whose checksum was taken from a cache or a fresh
+// manifest instead of being hashed, 0 when nothing was covered
+func (s *Stats) CacheHitRatio() float64 {
+	covered := s.BytesCovered()
+	if covered == 0 {
+		return 0
+	}
+	return float64(s.BytesCached()) / float64(covered)
+}
+
+// HasVerificationCounters reports whether any manifest was verified, see IncreaseManifestsValid
+func (s *Stats) HasVerificationCounters() bool {
+	return s.ManifestsValid()+s.ManifestsInvalid()+s.ManifestsShallow() > 0
+}
+
 func (s *Stats) StartTime() time.Time {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -71,17 +173,22 @@ func (s *Stats) SetCurrentFile(currentFile string) {
 	s.currentFile = currentFile
 }
 
+// Start clears the statistics and calls onUpdate with a snapshot every updateInterval while they change,
+// until ctx is done or Stop is called
 func (s *Stats) Start(ctx context.Context, onUpdate func(*Stats), updateInterval time.Duration) {
 	s.Clear()
+	stop, stopped := make(chan struct{}), make(chan struct{})
 	s.mu.Lock()
 	s.startTime = time.Now()
 	s.onUpdate = onUpdate
+	s.stop, s.stopped = stop, stopped
 	s.mu.Unlock()
 
 	s.sendUpdate()
 
 	// Periodic batch updates
 	go func() {
+		defer close(stopped)
 		ticker := time.NewTicker(updateInterval)
 		defer ticker.Stop()
 
@@ -93,11 +200,27 @@ func (s *Stats) Start(ctx context.Context, onUpdate func(*Stats), updateInterval
 				}
 			case <-ctx.Done():
 				return
+			case <-stop:
+				return
 			}
 		}
 	}()
 }
 
+// Stop ends the periodic updates started by Start and waits for a pending onUpdate call to return,
+// so onUpdate is never called after Stop returns. It does nothing if the updates are not running.
+func (s *Stats) Stop() {
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop, s.stopped = nil, nil
+	s.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
 func (s *Stats) IncreaseDirProcessed() {
 	atomic.AddInt64(&s.dirsProcessed, 1)
 	s.requestUpdate()
@@ -108,13 +231,112 @@ func (s *Stats) IncreaseFilesProcessed() {
 	s.requestUpdate()
 }
 
+func (s *Stats) IncreaseFilesCached() {
+	atomic.AddInt64(&s.filesCached, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseFilesSampled() {
+	atomic.AddInt64(&s.filesSampled, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseFilesUnhashed() {
+	atomic.AddInt64(&s.filesUnhashed, 1)
+	s.requestUpdate()
+}
+
+// AddFilesUnchanged counts files left unread as they were not modified since the cutoff of WithChangedSince
+func (s *Stats) AddFilesUnchanged(files int64) {
+	atomic.AddInt64(&s.filesUnchanged, files)
+	s.requestUpdate()
+}
+
+// IncreaseDirectoriesUnchanged counts a directory reused as it was not modified since the cutoff of
+// WithChangedSince
+func (s *Stats) IncreaseDirectoriesUnchanged() {
+	atomic.AddInt64(&s.dirsUnchanged, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseDirectoriesTooLong() {
+	atomic.AddInt64(&s.dirsTooLong, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseMountpointsSkipped() {
+	atomic.AddInt64(&s.mountpointsSkipped, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseEntriesVanished() {
+	atomic.AddInt64(&s.entriesVanished, 1)
+	s.requestUpdate()
+}
+
 func (s *Stats) IncreaseCachedProcessed() {
 	atomic.AddInt64(&s.cachedProcessed, 1)
 	s.requestUpdate()
 }
 
+// IncreaseManifestsValid counts a manifest matching its directory. The verification counters are kept by
+// the verifier as manifests are compared, so that progress shows failures while they accumulate.
+func (s *Stats) IncreaseManifestsValid() {
+	atomic.AddInt64(&s.manifestsValid, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) IncreaseManifestsInvalid() {
+	atomic.AddInt64(&s.manifestsInvalid, 1)
+	s.requestUpdate()
+}
+
+// IncreaseManifestsShallow counts a fresh manifest verified without hashing the file contents again
+func (s *Stats) IncreaseManifestsShallow() {
+	atomic.AddInt64(&s.manifestsShallow, 1)
+	s.requestUpdate()
+}
+
+// IncreaseManifestsSkipped calls IncreaseManifestsShallow.
+//
+// Deprecated: use IncreaseManifestsShallow.
+func (s *Stats) IncreaseManifestsSkipped() {
+	s.IncreaseManifestsShallow()
+}
+
+// IncreaseManifestsAudited counts a manifest whose auditor signatures verified
+func (s *Stats) IncreaseManifestsAudited() {
+	atomic.AddInt64(&s.manifestsAudited, 1)
+	s.requestUpdate()
+}
+
+func (s *Stats) AddEntriesDiscovered(entries int64) {
+	atomic.AddInt64(&s.entriesDiscovered, entries)
+	s.requestUpdate()
+}
+
+// AddBytesProcessed counts bytes as hashed.
+//
+// Deprecated: use AddBytesHashed.
 func (s *Stats) AddBytesProcessed(bytes int64) {
-	atomic.AddInt64(&s.bytesProcessed, bytes)
+	s.AddBytesHashed(bytes)
+}
+
+func (s *Stats) AddBytesHashed(bytes int64) {
+	atomic.AddInt64(&s.bytesHashed, bytes)
+	s.requestUpdate()
+}
+
+// AddBytesCovered counts the bytes of a file whose checksum is known, see AddBytesCached
+func (s *Stats) AddBytesCovered(bytes int64) {
+	atomic.AddInt64(&s.bytesCovered, bytes)
+	s.requestUpdate()
+}
+
+// AddBytesCached counts the bytes of a file whose checksum was taken from a cache or a fresh manifest,
+// they are counted as covered separately
+func (s *Stats) AddBytesCached(bytes int64) {
+	atomic.AddInt64(&s.bytesCached, bytes)
 	s.requestUpdate()
 }
 
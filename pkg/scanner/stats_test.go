@@ -13,7 +13,7 @@ func TestStats_Clear(t *testing.T) {
 	stats := &Stats{}
 
 	// Set some values first
-	atomic.StoreInt64(&stats.bytesProcessed, 100)
+	atomic.StoreInt64(&stats.bytesHashed, 100)
 	atomic.StoreInt64(&stats.filesProcessed, 10)
 	atomic.StoreInt64(&stats.cachedProcessed, 5)
 	atomic.StoreInt64(&stats.dirsProcessed, 3)
@@ -25,8 +25,8 @@ func TestStats_Clear(t *testing.T) {
 	// Clear and verify
 	stats.Clear()
 
-	if stats.BytesProcessed() != 0 {
-		t.Errorf("Expected BytesProcessed to be 0, got %d", stats.BytesProcessed())
+	if stats.BytesHashed() != 0 {
+		t.Errorf("Expected BytesHashed to be 0, got %d", stats.BytesHashed())
 	}
 	if stats.FilesProcessed() != 0 {
 		t.Errorf("Expected FilesProcessed to be 0, got %d", stats.FilesProcessed())
@@ -49,13 +49,13 @@ func TestStats_Getters(t *testing.T) {
 	stats := &Stats{}
 
 	// Test atomic getters
-	atomic.StoreInt64(&stats.bytesProcessed, 1024)
+	atomic.StoreInt64(&stats.bytesHashed, 1024)
 	atomic.StoreInt64(&stats.filesProcessed, 42)
 	atomic.StoreInt64(&stats.cachedProcessed, 7)
 	atomic.StoreInt64(&stats.dirsProcessed, 3)
 
-	if stats.BytesProcessed() != 1024 {
-		t.Errorf("Expected BytesProcessed to be 1024, got %d", stats.BytesProcessed())
+	if stats.BytesHashed() != 1024 {
+		t.Errorf("Expected BytesHashed to be 1024, got %d", stats.BytesHashed())
 	}
 	if stats.FilesProcessed() != 42 {
 		t.Errorf("Expected FilesProcessed to be 42, got %d", stats.FilesProcessed())
@@ -84,7 +84,7 @@ func TestStats_Snapshot(t *testing.T) {
 	now := time.Now()
 
 	// Set up test data
-	atomic.StoreInt64(&stats.bytesProcessed, 2048)
+	atomic.StoreInt64(&stats.bytesHashed, 2048)
 	atomic.StoreInt64(&stats.filesProcessed, 20)
 	atomic.StoreInt64(&stats.cachedProcessed, 5)
 	atomic.StoreInt64(&stats.dirsProcessed, 2)
@@ -95,8 +95,8 @@ func TestStats_Snapshot(t *testing.T) {
 
 	snapshot := stats.Snapshot()
 
-	if snapshot.BytesProcessed() != 2048 {
-		t.Errorf("Expected snapshot BytesProcessed to be 2048, got %d", snapshot.BytesProcessed())
+	if snapshot.BytesHashed() != 2048 {
+		t.Errorf("Expected snapshot BytesHashed to be 2048, got %d", snapshot.BytesHashed())
 	}
 	if snapshot.FilesProcessed() != 20 {
 		t.Errorf("Expected snapshot FilesProcessed to be 20, got %d", snapshot.FilesProcessed())
@@ -138,14 +138,49 @@ func TestStats_IncrementMethods(t *testing.T) {
 	}
 }
 
-func TestStats_AddBytesProcessed(t *testing.T) {
+func TestStats_AddBytesHashed(t *testing.T) {
 	stats := &Stats{}
 
-	stats.AddBytesProcessed(1024)
-	stats.AddBytesProcessed(512)
+	stats.AddBytesHashed(1024)
+	stats.AddBytesHashed(512)
 
-	if stats.BytesProcessed() != 1536 {
-		t.Errorf("Expected BytesProcessed to be 1536, got %d", stats.BytesProcessed())
+	if stats.BytesHashed() != 1536 {
+		t.Errorf("Expected BytesHashed to be 1536, got %d", stats.BytesHashed())
+	}
+}
+
+func TestStats_BytesCoveredAndCached(t *testing.T) {
+	stats := &Stats{}
+	if ratio := stats.CacheHitRatio(); ratio != 0 {
+		t.Errorf("Expected CacheHitRatio to be 0 when nothing was covered, got %f", ratio)
+	}
+
+	stats.AddBytesHashed(1024)
+	stats.AddBytesCovered(1024)
+	stats.AddBytesCovered(3072)
+	stats.AddBytesCached(3072)
+
+	if stats.BytesHashed() != 1024 {
+		t.Errorf("Expected BytesHashed to be 1024, got %d", stats.BytesHashed())
+	}
+	if stats.BytesCovered() != 4096 {
+		t.Errorf("Expected BytesCovered to be 4096, got %d", stats.BytesCovered())
+	}
+	if stats.BytesCached() != 3072 {
+		t.Errorf("Expected BytesCached to be 3072, got %d", stats.BytesCached())
+	}
+	if ratio := stats.CacheHitRatio(); ratio != 0.75 {
+		t.Errorf("Expected CacheHitRatio to be 0.75, got %f", ratio)
+	}
+
+	snapshot := stats.Snapshot()
+	if snapshot.BytesCovered() != 4096 || snapshot.BytesCached() != 3072 {
+		t.Errorf("Expected the snapshot to keep covered and cached bytes, got %d and %d",
+			snapshot.BytesCovered(), snapshot.BytesCached())
+	}
+	stats.Clear()
+	if stats.BytesCovered() != 0 || stats.BytesCached() != 0 {
+		t.Errorf("Expected Clear to reset covered and cached bytes, got %d and %d", stats.BytesCovered(), stats.BytesCached())
 	}
 }
 
@@ -162,7 +197,7 @@ func TestStats_Start_CallbackTriggered(t *testing.T) {
 		mu.Lock()
 		defer mu.Unlock()
 		atomic.AddInt32(&callbackCount, 1)
-		snapshot := *s
+		snapshot := s.Snapshot()
 		lastSnapshot = &snapshot
 	}
 
@@ -183,7 +218,7 @@ func TestStats_Start_CallbackTriggered(t *testing.T) {
 
 	// Make some changes to trigger updates
 	stats.IncreaseFilesProcessed()
-	stats.AddBytesProcessed(1024)
+	stats.AddBytesHashed(1024)
 
 	// Wait for periodic update
 	time.Sleep(5 * time.Millisecond)
@@ -246,7 +281,7 @@ func TestStats_ConcurrentAccess(t *testing.T) {
 			defer wg.Done()
 			for j := 0; j < operationsPerGoroutine; j++ {
 				stats.IncreaseFilesProcessed()
-				stats.AddBytesProcessed(int64(j))
+				stats.AddBytesHashed(int64(j))
 				stats.IncreaseDirProcessed()
 				stats.IncreaseCachedProcessed()
 				stats.SetCurrentFile(fmt.Sprintf("file_%d_%d", id, j))
@@ -278,8 +313,8 @@ func TestStats_ConcurrentAccess(t *testing.T) {
 			expectedBytes += int64(j)
 		}
 	}
-	if stats.BytesProcessed() != expectedBytes {
-		t.Errorf("Expected BytesProcessed to be %d, got %d", expectedBytes, stats.BytesProcessed())
+	if stats.BytesHashed() != expectedBytes {
+		t.Errorf("Expected BytesHashed to be %d, got %d", expectedBytes, stats.BytesHashed())
 	}
 
 	cancel()
@@ -308,13 +343,13 @@ func TestStats_NoCallback(t *testing.T) {
 
 	// Test that operations work without callback
 	stats.IncreaseFilesProcessed()
-	stats.AddBytesProcessed(100)
+	stats.AddBytesHashed(100)
 
 	if stats.FilesProcessed() != 1 {
 		t.Errorf("Expected FilesProcessed to be 1, got %d", stats.FilesProcessed())
 	}
-	if stats.BytesProcessed() != 100 {
-		t.Errorf("Expected BytesProcessed to be 100, got %d", stats.BytesProcessed())
+	if stats.BytesHashed() != 100 {
+		t.Errorf("Expected BytesHashed to be 100, got %d", stats.BytesHashed())
 	}
 }
 
@@ -352,3 +387,72 @@ func TestStats_ContextCancellation(t *testing.T) {
 		t.Errorf("Expected no new callbacks after context cancellation, before: %d, after: %d", beforeCount, afterCount)
 	}
 }
+
+func TestStats_Stop_NoUpdatesAfterReturn(t *testing.T) {
+	stats := &Stats{}
+	var stopped atomic.Bool
+	var late atomic.Int32
+	stats.Start(context.Background(), func(*Stats) {
+		if stopped.Load() {
+			late.Add(1)
+		}
+	}, time.Millisecond)
+	for i := 0; i < 50; i++ {
+		stats.IncreaseFilesProcessed()
+		time.Sleep(100 * time.Microsecond)
+	}
+	stats.Stop()
+	stopped.Store(true)
+	stats.IncreaseFilesProcessed()
+	time.Sleep(10 * time.Millisecond)
+	stats.Stop() // stopping twice is harmless
+
+	if n := late.Load(); n != 0 {
+		t.Errorf("Expected no updates after Stop, got %d", n)
+	}
+}
+
+func TestStats_VerificationCounters(t *testing.T) {
+	stats := &Stats{}
+	if stats.HasVerificationCounters() {
+		t.Error("Expected no verification counters before any manifest was verified")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				stats.IncreaseManifestsValid()
+				stats.IncreaseManifestsAudited()
+				if j%10 == 0 {
+					stats.IncreaseManifestsInvalid()
+				}
+				if j%4 == 0 {
+					stats.IncreaseManifestsShallow()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := stats.Snapshot()
+	if snapshot.ManifestsValid() != 1000 || snapshot.ManifestsAudited() != 1000 {
+		t.Errorf("Expected 1000 valid and audited manifests, got %d and %d", snapshot.ManifestsValid(), snapshot.ManifestsAudited())
+	}
+	if snapshot.ManifestsInvalid() != 100 || snapshot.ManifestsShallow() != 250 {
+		t.Errorf("Expected 100 invalid and 250 shallow manifests, got %d and %d", snapshot.ManifestsInvalid(), snapshot.ManifestsShallow())
+	}
+	if !snapshot.HasVerificationCounters() {
+		t.Error("Expected the snapshot to have verification counters")
+	}
+	if atomic.LoadInt32(&stats.dirty) != 1 {
+		t.Error("Expected verification counters to mark the stats dirty")
+	}
+
+	stats.Clear()
+	if stats.HasVerificationCounters() || stats.ManifestsAudited() != 0 {
+		t.Error("Expected Clear to reset the verification counters")
+	}
+}
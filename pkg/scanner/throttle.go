@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter is a token bucket shared by all workers of a scanner. Tokens are bytes,
+// refilled at bytesPerSecond and capped at one second worth of data.
+type bandwidthLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond float64
+	available      float64
+	last           time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		last:           time.Now(),
+	}
+}
+
+// wait takes n bytes from the bucket, sleeping until they are paid off.
+// The bucket may go into debt so that chunks larger than the bucket still pass.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.available += now.Sub(l.last).Seconds() * l.bytesPerSecond
+	l.available = min(l.available, l.bytesPerSecond)
+	l.last = now
+	l.available -= float64(n)
+	delay := time.Duration(-l.available / l.bytesPerSecond * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"io/fs"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// loadChildManifest loads the manifest of a child directory, from the overlay if it holds it, nil if it cannot be loaded.
+// Comparing checksums reports such manifests, they are only consulted for Empty and Subtree.
+func (s *Scanner) loadChildManifest(manifestPath string) *manifest.Manifest {
+	var m *manifest.Manifest
+	var err error
+	if data, ok := s.options.overlay.data(manifestPath); ok {
+		m, err = manifest.Parse(data)
+	} else {
+		m, err = manifest.LoadManifestFS(s.fs, manifestPath)
+	}
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// childTotals returns what a child directory adds to the totals of its parent: the directory itself and the
+// totals of its tree, as recomputed when the current walk scanned it, as recorded in child, its manifest, otherwise.
+// It returns nil when the totals are unknown.
+func (s *Scanner) childTotals(childPath string, child *manifest.Manifest) *manifest.SubtreeTotals {
+	subtree, scanned := s.subtrees[childPath]
+	if !scanned && child != nil {
+		subtree = child.Subtree
+	}
+	if subtree == nil {
+		return nil
+	}
+	totals := *subtree
+	totals.Directories++
+	return &totals
+}
+
+// recordSubtree keeps the totals of m, the manifest computed for dirPath, for the scan of its parent, and forgets
+// the totals of its subdirectories
+func (s *Scanner) recordSubtree(dirPath string, m *manifest.Manifest) {
+	if m == nil {
+		return
+	}
+	for _, entity := range m.Entities {
+		if entity.IsDir {
+			delete(s.subtrees, s.fs.Join(dirPath, entity.Name))
+		}
+	}
+	s.subtrees[dirPath] = m.Subtree
+}
+
+// fileTotals returns what a regular file adds to the totals of its directory, following symbolic links
+// like hashing does, together with the file info it was taken from
+func (s *Scanner) fileTotals(entryPath string) (*manifest.SubtreeTotals, fs.FileInfo, error) {
+	info, err := s.fs.Stat(entryPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &manifest.SubtreeTotals{Files: 1, Bytes: info.Size()}, info, nil
+}
+
+// manifestFileBytes returns the bytes of the files of a directory recorded in its manifest, files recorded
+// without their size are left out
+func manifestFileBytes(m *manifest.Manifest) int64 {
+	var bytes int64
+	for _, entity := range m.Entities {
+		if !entity.IsDir && entity.Size != nil {
+			bytes += *entity.Size
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func TestScanner_RecordsSubtreeTotals(t *testing.T) {
+	tempDir := t.TempDir()
+	for path, content := range map[string]string{
+		"root.txt":      "root",
+		"a/a.txt":       "aaa",
+		"a/b/b.txt":     "bb",
+		"a/b/c/c1.txt":  "c",
+		"a/b/c/c2.txt":  "cc",
+		"x/empty/.keep": "",
+	} {
+		fullPath := filepath.Join(tempDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generateWith(t, New(), tempDir)
+
+	for dir, expected := range map[string]manifest.SubtreeTotals{
+		".":     {Files: 6, Directories: 5, Bytes: 12},
+		"a":     {Files: 4, Directories: 2, Bytes: 8},
+		"a/b/c": {Files: 2, Directories: 0, Bytes: 3},
+		"x":     {Files: 1, Directories: 1, Bytes: 0},
+	} {
+		m, err := manifest.LoadManifest(filepath.Join(tempDir, dir, manifest.DefaultName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Subtree == nil || *m.Subtree != expected {
+			t.Errorf("Expected totals %+v for %s, got %+v", expected, dir, m.Subtree)
+		}
+	}
+}
+
+func TestScanner_ChildManifestWithoutTotals_LeavesParentTotalsUnknown(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "file.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A manifest written before totals were recorded
+	legacy := manifest.New([]manifest.Entity{{Name: "file.txt", Checksum: "c1"}})
+	if err := legacy.Save(filepath.Join(tempDir, "sub", manifest.DefaultName)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _, err := New().scanDirectory(t.Context(), tempDir, dirScope{manifestName: manifest.DefaultName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subtree != nil {
+		t.Errorf("Expected unknown totals, got %+v", m.Subtree)
+	}
+}
+
+func TestScanner_Walk_SumsRecomputedTotalsOfChildren(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "file.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generateWith(t, New(), tempDir)
+	// The manifest of sub on disk no longer matches its directory
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "new.txt"), []byte("more data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var root *manifest.Manifest
+	err := New().Walk(t.Context(), tempDir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if dirPath == tempDir {
+			root = m
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := manifest.SubtreeTotals{Files: 2, Directories: 1, Bytes: 13}
+	if root == nil || root.Subtree == nil || *root.Subtree != expected {
+		t.Errorf("Expected totals %+v, got %+v", expected, root)
+	}
+}
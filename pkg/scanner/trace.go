@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/traverse"
+)
+
+// traced wraps visit, the function visiting the directories of a walk rooted at root, so that every directory
+// taking at least the threshold of WithTracer is reported as a span. Directories are visited one at a time, the
+// bytes hashed meanwhile are the ones of the directory.
+func (s *Scanner) traced(root string, visit traverse.WalkFunc) traverse.WalkFunc {
+	return func(ctx context.Context, dirPath string, err error) error {
+		dirCtx, dir := telemetry.WithDirectory(ctx)
+		started, hashed, covered := time.Now(), s.stats.BytesHashed(), s.stats.BytesCovered()
+		err = visit(dirCtx, dirPath, err)
+		if time.Since(started) < s.options.dirSpanThreshold || errors.Is(err, traverse.SkipDir) {
+			return err
+		}
+		path := "."
+		if elems := s.fs.RelElems(root, dirPath); len(elems) > 0 {
+			path = strings.Join(elems, "/")
+		}
+		attrs := append([]telemetry.Attribute{
+			telemetry.String(telemetry.KeyPath, path),
+			telemetry.Int64(telemetry.KeyBytesHashed, s.stats.BytesHashed()-hashed),
+			telemetry.Int64(telemetry.KeyBytesCovered, s.stats.BytesCovered()-covered),
+		}, dir.Attributes()...)
+		_, span := s.options.tracer.Start(ctx, "directory", started, attrs...)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+)
+
+// recordingTracer records the spans started, in the order they end
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	tracer *recordingTracer
+	start  time.Time
+	attrs  map[string]any
+	err    error
+}
+
+func (t *recordingTracer) Start(ctx context.Context, _ string, start time.Time, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	span := &recordedSpan{tracer: t, start: start, attrs: map[string]any{}}
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...telemetry.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.tracer.spans = append(s.tracer.spans, s) }
+
+func TestScanner_WithTracer(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "abc", "slow/b.txt": "de"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tracer := &recordingTracer{}
+	sc := New(WithTracer(tracer, 50*time.Millisecond))
+	failure := errors.New("stop")
+	started := time.Now()
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		telemetry.Annotate(ctx, telemetry.String(telemetry.KeyOutcome, telemetry.OutcomeValid))
+		if filepath.Base(dirPath) == "slow" {
+			time.Sleep(60 * time.Millisecond)
+			return nil
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the callback, got %v", err)
+	}
+
+	// The root is quick, only the slow directory is reported
+	if len(tracer.spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	want := map[string]any{
+		telemetry.KeyPath:         "slow",
+		telemetry.KeyBytesHashed:  int64(2),
+		telemetry.KeyBytesCovered: int64(2),
+		telemetry.KeyCached:       false,
+		telemetry.KeyOutcome:      telemetry.OutcomeValid,
+	}
+	for key, value := range want {
+		if span.attrs[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, span.attrs[key])
+		}
+	}
+	if span.start.Before(started) || span.err != nil {
+		t.Errorf("Expected a successful span started with the walk, got start %v and error %v", span.start, span.err)
+	}
+}
+
+func TestScanner_WithTracer_RecordsErrors(t *testing.T) {
+	dir := t.TempDir()
+	tracer := &recordingTracer{}
+	failure := errors.New("stop")
+	err := New(WithTracer(tracer, 0)).Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the error of the callback, got %v", err)
+	}
+	if len(tracer.spans) != 1 || tracer.spans[0].attrs[telemetry.KeyPath] != "." || tracer.spans[0].err != failure {
+		t.Errorf("Expected the failed root to be reported, got %+v", tracer.spans)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build darwin || freebsd || netbsd
+
+package scanner
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned when reading an extended attribute that does not exist
+const errNoXattr = unix.ENOATTR
@@ -0,0 +1,6 @@
+package scanner
+
+import "golang.org/x/sys/unix"
+
+// errNoXattr is returned when reading an extended attribute that does not exist
+const errNoXattr = unix.ENODATA
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package scanner
+
+// xattrsSupported is false because extended attributes cannot be read on this platform.
+// Entities then record none, and verification does not compare them.
+const xattrsSupported = false
+
+// readXattrs is not available on this platform
+func readXattrs(path string) (attrs map[string][]byte, ok bool, err error) {
+	return nil, false, nil
+}
@@ -0,0 +1,63 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package scanner
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrsSupported reports whether extended attributes can be read on this platform
+const xattrsSupported = true
+
+// readXattrs returns the extended attributes of path, without following a final symbolic link.
+// ok is false when the file system does not support them.
+func readXattrs(path string) (attrs map[string][]byte, ok bool, err error) {
+	list, err := readXattr(func(dest []byte) (int, error) { return unix.Llistxattr(path, dest) })
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	attrs = make(map[string][]byte)
+	for _, name := range bytes.Split(list, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := readXattr(func(dest []byte) (int, error) { return unix.Lgetxattr(path, string(name), dest) })
+		if errors.Is(err, errNoXattr) {
+			// Removed after it was listed
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		attrs[string(name)] = value
+	}
+	return attrs, true, nil
+}
+
+// readXattr calls read with a buffer of the size it reports, retrying while the data grows meanwhile
+func readXattr(read func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := read(nil)
+		if err != nil {
+			return nil, err
+		}
+		dest := make([]byte, size)
+		if size == 0 {
+			return dest, nil
+		}
+		n, err := read(dest)
+		if errors.Is(err, unix.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dest[:n], nil
+	}
+}
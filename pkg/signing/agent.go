@@ -0,0 +1,172 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// AgentSigner signs with a key held by an ssh-agent, which includes hardware keys
+// (sk-ssh-ed25519) loaded into the agent. No ssh-keygen binary is required.
+type AgentSigner struct {
+	agent           agent.ExtendedAgent
+	key             ssh.PublicKey
+	issuerReference string
+	conn            net.Conn
+}
+
+var _ Signer = (*AgentSigner)(nil)
+
+// NewAgentSignerFromEnv connects to the agent listening on SSH_AUTH_SOCK, see NewAgentSigner
+func NewAgentSignerFromEnv(keyRef string, issuerReference string) (*AgentSigner, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set, is ssh-agent running?")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh-agent at SSH_AUTH_SOCK=%s, is it running? %w", socket, err)
+	}
+	signer, err := NewAgentSigner(agent.NewClient(conn), keyRef, issuerReference)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	signer.conn = conn
+	return signer, nil
+}
+
+// NewAgentSigner selects an ed25519 or sk-ssh-ed25519 key from the agent.
+// keyRef may be a path to a public key file, a SHA256 fingerprint or a key comment.
+// If keyRef is empty, the agent must hold a single supported key, otherwise the error lists them.
+func NewAgentSigner(ag agent.ExtendedAgent, keyRef string, issuerReference string) (*AgentSigner, error) {
+	keys, err := ag.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+
+	var wanted []byte
+	if keyRef != "" {
+		if data, err := os.ReadFile(keyRef); err == nil {
+			pubKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse SSH public key %s: %w", keyRef, err)
+			}
+			wanted = pubKey.Marshal()
+		}
+	}
+
+	var supported []*agent.Key
+	for _, key := range keys {
+		if key.Type() == ssh.KeyAlgoED25519 || key.Type() == ssh.KeyAlgoSKED25519 {
+			supported = append(supported, key)
+		}
+	}
+	if len(supported) == 0 {
+		return nil, fmt.Errorf("no ed25519 or sk-ssh-ed25519 key found in ssh-agent (%d other key(s) loaded),"+
+			" add one with ssh-add", len(keys))
+	}
+	if keyRef == "" {
+		if len(supported) > 1 {
+			return nil, fmt.Errorf("ssh-agent holds %d ed25519 or sk-ssh-ed25519 keys, select one of: %s",
+				len(supported), describeAgentKeys(supported))
+		}
+		return &AgentSigner{agent: ag, key: supported[0], issuerReference: issuerReference}, nil
+	}
+	for _, key := range supported {
+		if bytes.Equal(wanted, key.Marshal()) || ssh.FingerprintSHA256(key) == keyRef || key.Comment == keyRef {
+			return &AgentSigner{agent: ag, key: key, issuerReference: issuerReference}, nil
+		}
+	}
+	return nil, fmt.Errorf("key '%s' not found in ssh-agent, which holds: %s", keyRef, describeAgentKeys(supported))
+}
+
+// describeAgentKeys lists keys by fingerprint and comment, e.g. for choosing one of them
+func describeAgentKeys(keys []*agent.Key) string {
+	descriptions := make([]string, 0, len(keys))
+	for _, key := range keys {
+		description := ssh.FingerprintSHA256(key)
+		if key.Comment != "" {
+			description += " (" + key.Comment + ")"
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// Sign implements the Signer interface. Plain ed25519 keys produce raw ed25519 signatures,
+// security keys produce SSHSIG-wrapped signatures in the same format as `ssh-keygen -Y sign`.
+func (s *AgentSigner) Sign(data []byte) ([]byte, error) {
+	if s.key.Type() == ssh.KeyAlgoED25519 {
+		sig, err := s.agent.SignWithFlags(s.key, data, 0)
+		if err != nil {
+			return nil, fmt.Errorf("ssh-agent signing failed: %w", err)
+		}
+		return sig.Blob, nil
+	}
+
+	return s.sshSignature("file", data)
+}
+
+// SignSSH implements the SSHSigner interface, for plain ed25519 keys too
+func (s *AgentSigner) SignSSH(namespace string, data []byte) ([]byte, error) {
+	blob, err := s.sshSignature(namespace, data)
+	if err != nil {
+		return nil, err
+	}
+	return armorSSHSignature(blob), nil
+}
+
+// sshSignature returns the SSHSIG blob of data signed under namespace by the agent
+func (s *AgentSigner) sshSignature(namespace string, data []byte) ([]byte, error) {
+	const hashAlgorithm = "sha512"
+	payload, err := buildSSHSignaturePayload(namespace, hashAlgorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := s.agent.SignWithFlags(s.key, payload, 0)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent signing failed: %w", err)
+	}
+	return marshalSSHSignature(s.key, namespace, hashAlgorithm, sig)
+}
+
+func (s *AgentSigner) PublicKey() (ed25519.PublicKey, error) {
+	// Both ssh-ed25519 and sk-ssh-ed25519 blobs store the raw key right after the key type
+	r := bytes.NewReader(s.key.Marshal())
+	if _, err := readString(r); err != nil {
+		return nil, fmt.Errorf("failed to parse agent public key: %w", err)
+	}
+	rawKey, err := readBytes(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse agent public key: %w", err)
+	}
+	if len(rawKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected %d key bytes, got %d", ed25519.PublicKeySize, len(rawKey))
+	}
+	return rawKey, nil
+}
+
+func (s *AgentSigner) Reference() string {
+	return s.issuerReference
+}
+
+func (s *AgentSigner) Algorithm() string {
+	if s.key.Type() == ssh.KeyAlgoSKED25519 {
+		return SignatureAlgorithmSKEd25519
+	}
+	return SignatureAlgorithmEd25519
+}
+
+func (s *AgentSigner) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,120 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func newTestAgent(t *testing.T, comment string) (agent.ExtendedAgent, ed25519.PublicKey) {
+	t.Helper()
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: privKey, Comment: comment}))
+	return keyring, pubKey
+}
+
+func TestAgentSigner_Sign(t *testing.T) {
+	ag, expectedPubKey := newTestAgent(t, "me@example")
+
+	signer, err := NewAgentSigner(ag, "", "github:me")
+	require.NoError(t, err)
+	defer signer.Close()
+
+	pubKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.True(t, expectedPubKey.Equal(pubKey))
+	assert.Equal(t, "github:me", signer.Reference())
+	assert.Equal(t, SignatureAlgorithmEd25519, signer.Algorithm())
+
+	data := []byte("manifest content")
+	signature, err := signer.Sign(data)
+	require.NoError(t, err)
+	valid, err := VerifySignature(signer.Algorithm(), pubKey, data, signature)
+	require.NoError(t, err)
+	assert.True(t, valid)
+}
+
+func TestNewAgentSigner_SelectsKey(t *testing.T) {
+	ag, pubKey := newTestAgent(t, "me@example")
+	sshPubKey, err := ssh.NewPublicKey(pubKey)
+	require.NoError(t, err)
+
+	pubKeyPath := filepath.Join(t.TempDir(), "id_ed25519.pub")
+	require.NoError(t, os.WriteFile(pubKeyPath, ssh.MarshalAuthorizedKey(sshPubKey), 0644))
+
+	for _, keyRef := range []string{pubKeyPath, ssh.FingerprintSHA256(sshPubKey), "me@example"} {
+		signer, err := NewAgentSigner(ag, keyRef, "github:me")
+		require.NoError(t, err, keyRef)
+		selected, err := signer.PublicKey()
+		require.NoError(t, err)
+		assert.True(t, pubKey.Equal(selected))
+	}
+
+	_, err = NewAgentSigner(ag, "someone-else", "github:me")
+	assert.ErrorContains(t, err, "not found in ssh-agent")
+}
+
+func TestNewAgentSigner_EmptyAgent(t *testing.T) {
+	_, err := NewAgentSigner(agent.NewKeyring().(agent.ExtendedAgent), "", "github:me")
+	assert.ErrorContains(t, err, "no ed25519")
+}
+
+func TestNewSigner_Registry(t *testing.T) {
+	assert.Equal(t, []string{SignerAgent, SignerFile, SignerYubiKey}, RegisteredSigners())
+
+	_, err := NewSigner("unknown", "", "")
+	assert.ErrorContains(t, err, "unknown signer 'unknown'")
+
+	RegisterSigner("test", func(keyRef string, issuerRef string) (Signer, error) {
+		return NewFakeSigner(), nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test")
+		registryMu.Unlock()
+	}()
+	signer, err := NewSigner("test", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "fake", signer.Reference())
+}
+
+func TestNewAgentSigner_WithSeveralKeys_mustRequireSelection(t *testing.T) {
+	ag, _ := newTestAgent(t, "first@example")
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	require.NoError(t, ag.Add(agent.AddedKey{PrivateKey: privKey, Comment: "second@example"}))
+	sshPubKey, err := ssh.NewPublicKey(pubKey)
+	require.NoError(t, err)
+
+	_, err = NewAgentSigner(ag, "", "github:me")
+	assert.ErrorContains(t, err, "ssh-agent holds 2 ed25519 or sk-ssh-ed25519 keys, select one of: ")
+	assert.ErrorContains(t, err, ssh.FingerprintSHA256(sshPubKey)+" (second@example)")
+
+	signer, err := NewAgentSigner(ag, ssh.FingerprintSHA256(sshPubKey), "github:me")
+	require.NoError(t, err)
+	selected, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.True(t, pubKey.Equal(selected))
+}
+
+func TestAgentSigner_SignDigest_mustMatchFileSigner(t *testing.T) {
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: fixtureSigner().privKey}))
+	signer, err := NewAgentSigner(keyring, "", "github:me")
+	require.NoError(t, err)
+
+	armored, err := SignDigest(signer, fixtureDigest)
+	require.NoError(t, err)
+
+	expected, err := SignDigest(fixtureSigner(), fixtureDigest)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(armored))
+}
@@ -0,0 +1,206 @@
+package signing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AllowedSigner is an entry of an OpenSSH allowed_signers file, see ALLOWED SIGNERS in ssh-keygen(1)
+type AllowedSigner struct {
+	// Principals are the identities of the key, patterns like "*@example.com" are kept as given
+	Principals []string
+	PublicKey  ssh.PublicKey
+	// Namespaces restricts the signatures the key is accepted for, nil accepts any namespace
+	Namespaces []string
+	// CertAuthority marks keys trusted to certify signing keys, which plain signatures never match
+	CertAuthority bool
+	// ValidAfter and ValidBefore bound when the key is accepted, zero when unbounded
+	ValidAfter  time.Time
+	ValidBefore time.Time
+}
+
+// Accepts reports whether the entry accepts signatures under namespace at now
+func (s AllowedSigner) Accepts(namespace string, now time.Time) bool {
+	if s.CertAuthority {
+		return false
+	}
+	if !s.ValidAfter.IsZero() && now.Before(s.ValidAfter) || !s.ValidBefore.IsZero() && !now.Before(s.ValidBefore) {
+		return false
+	}
+	if s.Namespaces == nil {
+		return true
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether identity is one of the principals of the entry, which may be patterns with '*' and '?'
+// wildcards, like `ssh-keygen -Y verify -I identity` checks. A negated pattern, "!pattern", matching identity
+// rejects it whatever the other principals.
+func (s AllowedSigner) Matches(identity string) bool {
+	matched := false
+	for _, principal := range s.Principals {
+		if pattern, negated := strings.CutPrefix(principal, "!"); negated {
+			if matchPattern(pattern, identity) {
+				return false
+			}
+		} else if matchPattern(principal, identity) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// SignersFor returns the entries of signers whose principals match identity, see AllowedSigner.Matches
+func SignersFor(signers []AllowedSigner, identity string) []AllowedSigner {
+	var matching []AllowedSigner
+	for _, signer := range signers {
+		if signer.Matches(identity) {
+			matching = append(matching, signer)
+		}
+	}
+	return matching
+}
+
+// matchPattern reports whether s matches pattern, in which '*' matches any sequence of characters and '?' any
+// single one, like the patterns of ssh_config(5)
+func matchPattern(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// LoadAllowedSigners reads the allowed_signers file at path, see ParseAllowedSigners
+func LoadAllowedSigners(path string) ([]AllowedSigner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowed signers: %w", err)
+	}
+	defer f.Close()
+	signers, err := ParseAllowedSigners(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signers, nil
+}
+
+// ParseAllowedSigners parses an OpenSSH allowed_signers file: one "principals [options] keytype key [comment]"
+// entry per line, empty lines and lines starting with '#' being ignored. The options cert-authority, namespaces,
+// valid-after and valid-before are understood, any other one is rejected.
+func ParseAllowedSigners(r io.Reader) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		signers = append(signers, signer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+func parseAllowedSigner(line string) (AllowedSigner, error) {
+	var signer AllowedSigner
+	principals, rest, err := cutPrincipals(line)
+	if err != nil {
+		return signer, err
+	}
+	for _, principal := range strings.Split(principals, ",") {
+		if principal == "" {
+			return signer, fmt.Errorf("empty principal in '%s'", principals)
+		}
+		signer.Principals = append(signer.Principals, principal)
+	}
+	publicKey, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+	if err != nil {
+		return signer, fmt.Errorf("invalid public key: %w", err)
+	}
+	signer.PublicKey = publicKey
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			signer.CertAuthority = true
+		case "namespaces":
+			signer.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			if signer.ValidAfter, err = parseSignerTime(value); err != nil {
+				return signer, fmt.Errorf("invalid valid-after: %w", err)
+			}
+		case "valid-before":
+			if signer.ValidBefore, err = parseSignerTime(value); err != nil {
+				return signer, fmt.Errorf("invalid valid-before: %w", err)
+			}
+		default:
+			return signer, fmt.Errorf("unsupported option '%s'", name)
+		}
+	}
+	return signer, nil
+}
+
+// cutPrincipals splits line after its principals, which are quoted when they hold spaces
+func cutPrincipals(line string) (principals, rest string, err error) {
+	if strings.HasPrefix(line, `"`) {
+		end := strings.Index(line[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quote in principals")
+		}
+		return line[1 : end+1], strings.TrimSpace(line[end+2:]), nil
+	}
+	end := strings.IndexAny(line, " \t")
+	if end < 0 {
+		return "", "", fmt.Errorf("missing public key")
+	}
+	return line[:end], strings.TrimSpace(line[end:]), nil
+}
+
+// parseSignerTime parses the YYYYMMDD[HHMM[SS]] times of allowed signers, UTC when suffixed by 'Z', local otherwise
+func parseSignerTime(value string) (time.Time, error) {
+	location := time.Local
+	if strings.HasSuffix(value, "Z") {
+		value, location = strings.TrimSuffix(value, "Z"), time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.ParseInLocation(layout, value, location)
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not in the YYYYMMDD[HHMM[SS]][Z] format", value)
+}
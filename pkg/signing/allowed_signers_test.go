@@ -0,0 +1,83 @@
+package signing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtureAllowedSigners = `# release keys
+release@example.com namespaces="bytecheck" ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4 release key
+
+"alice@example.com,*@ops.example.com"	valid-after="20240101",valid-before="20250101Z" ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4
+ca@example.com cert-authority ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4
+`
+
+func TestParseAllowedSigners(t *testing.T) {
+	signers, err := ParseAllowedSigners(strings.NewReader(fixtureAllowedSigners))
+	require.NoError(t, err)
+	require.Len(t, signers, 3)
+
+	assert.Equal(t, []string{"release@example.com"}, signers[0].Principals)
+	assert.Equal(t, []string{"bytecheck"}, signers[0].Namespaces)
+	assert.Equal(t, "SHA256:lbmsoA0yIEcEiVDRnMWuzm+nV+3ZEEpVIURqFoeSspg", fingerprintOf(signers[0]))
+
+	assert.Equal(t, []string{"alice@example.com", "*@ops.example.com"}, signers[1].Principals)
+	assert.Nil(t, signers[1].Namespaces)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), signers[1].ValidAfter)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), signers[1].ValidBefore)
+
+	assert.True(t, signers[2].CertAuthority)
+}
+
+func TestAllowedSigner_Accepts(t *testing.T) {
+	signers, err := ParseAllowedSigners(strings.NewReader(fixtureAllowedSigners))
+	require.NoError(t, err)
+	inWindow := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.True(t, signers[0].Accepts("bytecheck", inWindow))
+	assert.False(t, signers[0].Accepts("git", inWindow), "namespace not listed")
+	assert.True(t, signers[1].Accepts("git", inWindow), "any namespace")
+	assert.False(t, signers[1].Accepts("git", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)), "not valid yet")
+	assert.False(t, signers[1].Accepts("git", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), "expired")
+	assert.False(t, signers[2].Accepts("bytecheck", inWindow), "only certificates match certificate authorities")
+}
+
+func TestAllowedSigner_Matches(t *testing.T) {
+	signer := AllowedSigner{Principals: []string{"alice@example.com", "*@ops.example.com", "!root@ops.example.com", "ci-?"}}
+
+	assert.True(t, signer.Matches("alice@example.com"))
+	assert.True(t, signer.Matches("bob@ops.example.com"))
+	assert.True(t, signer.Matches("ci-1"))
+	assert.False(t, signer.Matches("root@ops.example.com"), "negated")
+	assert.False(t, signer.Matches("bob@example.com"))
+	assert.False(t, signer.Matches("ci-10"))
+	assert.False(t, signer.Matches(""))
+
+	signers := []AllowedSigner{{Principals: []string{"alice@example.com"}}, signer}
+	assert.Len(t, SignersFor(signers, "alice@example.com"), 2)
+	assert.Empty(t, SignersFor(signers, "mallory@example.com"))
+}
+
+func TestParseAllowedSigners_WithInvalidEntries_mustReportLine(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, expected string
+	}{
+		{"missing key", "\nalice@example.com\n", "line 2: missing public key"},
+		{"invalid key", "alice@example.com ssh-ed25519 AAAA\n", "line 1: invalid public key"},
+		{"unterminated quote", `"alice@example.com ssh-ed25519 AAAA`, "line 1: unterminated quote"},
+		{"empty principal", "alice@example.com, ssh-ed25519 AAAA", "line 1: empty principal"},
+		{"unknown option", "alice@example.com no-touch-required ssh-ed25519 " +
+			"AAAAC3NzaC1lZDI1NTE5AAAAIAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4", "unsupported option 'no-touch-required'"},
+		{"invalid time", `alice@example.com valid-after="2024" ssh-ed25519 ` +
+			"AAAAC3NzaC1lZDI1NTE5AAAAIAOhB7/zzhC+HXDdGOdLwJln5NYwm6UNXx3chmQSVTG4", "invalid valid-after"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseAllowedSigners(strings.NewReader(tc.content))
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCertificateExpired is wrapped by the error of CheckValidity for a certificate past its NotAfter
+var ErrCertificateExpired = errors.New("certificate expired")
+
+// ErrCertificateNotYetValid is wrapped by the error of CheckValidity for a certificate before its NotBefore
+var ErrCertificateNotYetValid = errors.New("certificate not yet valid")
+
+// Certificate binds a public key to an issuer: the issuer signs the key together with its reference,
+// see CertificatePayload. Manifests are signed with the certified key.
+type Certificate interface {
+	PublicKey() ed25519.PublicKey
+	Signature() []byte
+	IssuerPublicKey() ed25519.PublicKey
+	IssuerReference() string
+	SignatureAlgorithm() string
+	// IssuerCertificate returns the SSH certificate of the issuer key in wire format, nil if there is none
+	IssuerCertificate() []byte
+}
+
+// ValidityCertificate is implemented by certificates with a validity window, see IssueCertificate
+type ValidityCertificate interface {
+	Certificate
+	// Validity returns the window in which the certificate is valid, zero times leave it open on that side.
+	// Certificates issued without a window, e.g. by older versions, return two zero times.
+	Validity() (notBefore, notAfter time.Time)
+}
+
+// CertificateValidity returns the validity window of cert, two zero times when it does not implement
+// ValidityCertificate
+func CertificateValidity(cert Certificate) (notBefore, notAfter time.Time) {
+	if c, ok := cert.(ValidityCertificate); ok {
+		return c.Validity()
+	}
+	return time.Time{}, time.Time{}
+}
+
+// SimpleCertificate implements ValidityCertificate
+type SimpleCertificate struct {
+	PubKey       ed25519.PublicKey `json:"-"`
+	Sig          []byte            `json:"-"`
+	IssuerPubKey ed25519.PublicKey `json:"-"`
+	IssuerRef    string            `json:"-"`
+	SigAlgo      string            `json:"-"`
+	IssuerCert   []byte            `json:"-"`
+	NotBefore    time.Time         `json:"-"`
+	NotAfter     time.Time         `json:"-"`
+}
+
+func (c *SimpleCertificate) PublicKey() ed25519.PublicKey       { return c.PubKey }
+func (c *SimpleCertificate) Signature() []byte                  { return c.Sig }
+func (c *SimpleCertificate) IssuerPublicKey() ed25519.PublicKey { return c.IssuerPubKey }
+func (c *SimpleCertificate) IssuerReference() string            { return c.IssuerRef }
+func (c *SimpleCertificate) SignatureAlgorithm() string         { return c.SigAlgo }
+func (c *SimpleCertificate) IssuerCertificate() []byte          { return c.IssuerCert }
+func (c *SimpleCertificate) Validity() (time.Time, time.Time)   { return c.NotBefore, c.NotAfter }
+
+// validityMarker separates the issuer reference from the validity window in CertificatePayload.
+// IssueCertificate rejects issuer references containing NUL, so a payload with a window cannot be mistaken
+// for one without.
+const validityMarker = "\x00validity"
+
+// CertificatePayload returns the data an issuer signs to certify publicKey: the raw key followed by
+// the issuer reference and, unless both times are zero, validityMarker and the window as two big-endian
+// Unix times in seconds, zero for an open side. It is part of the manifest format, changing it invalidates
+// existing signatures.
+func CertificatePayload(publicKey ed25519.PublicKey, issuerReference string, notBefore, notAfter time.Time) []byte {
+	payload := make([]byte, 0, len(publicKey)+len(issuerReference)+len(validityMarker)+16)
+	payload = append(payload, publicKey...)
+	payload = append(payload, issuerReference...)
+	if notBefore.IsZero() && notAfter.IsZero() {
+		return payload
+	}
+	payload = append(payload, validityMarker...)
+	payload = binary.BigEndian.AppendUint64(payload, unixSeconds(notBefore))
+	return binary.BigEndian.AppendUint64(payload, unixSeconds(notAfter))
+}
+
+// unixSeconds returns t as Unix time in seconds, 0 for the zero time
+func unixSeconds(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// IssueCertificate certifies publicKey with the issuer's key. A positive validity makes the certificate valid
+// from now for that long, see CheckValidity, otherwise it never expires.
+func IssueCertificate(issuer Signer, publicKey ed25519.PublicKey, validity time.Duration) (*SimpleCertificate, error) {
+	if strings.ContainsRune(issuer.Reference(), 0) {
+		return nil, fmt.Errorf("invalid issuer reference %q: contains NUL", issuer.Reference())
+	}
+	var notBefore, notAfter time.Time
+	if validity > 0 {
+		// The payload records whole seconds
+		notBefore = time.Now().UTC().Truncate(time.Second)
+		notAfter = notBefore.Add(validity)
+	}
+	signature, err := issuer.Sign(CertificatePayload(publicKey, issuer.Reference(), notBefore, notAfter))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+	issuerPublicKey, err := issuer.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get issuer public key: %w", err)
+	}
+	return &SimpleCertificate{
+		PubKey:       publicKey,
+		Sig:          signature,
+		IssuerPubKey: issuerPublicKey,
+		IssuerRef:    issuer.Reference(),
+		SigAlgo:      issuer.Algorithm(),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}, nil
+}
+
+// VerifyCertificate reports whether the certificate was signed by its issuer key
+func VerifyCertificate(cert Certificate) (bool, error) {
+	notBefore, notAfter := CertificateValidity(cert)
+	return VerifySignature(cert.SignatureAlgorithm(), cert.IssuerPublicKey(),
+		CertificatePayload(cert.PublicKey(), cert.IssuerReference(), notBefore, notAfter), cert.Signature())
+}
+
+// CheckValidity returns an error wrapping ErrCertificateExpired or ErrCertificateNotYetValid when now lies outside
+// the validity window of the certificate. A NotBefore up to maxClockSkew after now is accepted, the issuing
+// machine's clock may be ahead.
+func CheckValidity(cert Certificate, now time.Time, maxClockSkew time.Duration) error {
+	notBefore, notAfter := CertificateValidity(cert)
+	if !notAfter.IsZero() && now.After(notAfter) {
+		return fmt.Errorf("%w at %s", ErrCertificateExpired, notAfter.UTC().Format(time.RFC3339))
+	}
+	if !notBefore.IsZero() && notBefore.Sub(now) > maxClockSkew {
+		return fmt.Errorf("%w before %s", ErrCertificateNotYetValid, notBefore.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
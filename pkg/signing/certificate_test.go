@@ -0,0 +1,130 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificatePayload_IsKeyFollowedByReference(t *testing.T) {
+	publicKey := ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+	publicKey[0] = 0xab
+
+	payload := CertificatePayload(publicKey, "github:alice", time.Time{}, time.Time{})
+
+	assert.Equal(t, append(append([]byte{}, publicKey...), "github:alice"...), payload)
+	// The payload must not share memory with the key
+	payload[0] = 0
+	assert.Equal(t, byte(0xab), publicKey[0])
+}
+
+func TestIssueCertificate_VerifiesWithIssuerKey(t *testing.T) {
+	issuer := newTestSigner(t, "github:alice")
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	cert, err := IssueCertificate(issuer, publicKey, 0)
+	require.NoError(t, err)
+
+	assert.Implements(t, (*Certificate)(nil), cert)
+	assert.True(t, cert.PublicKey().Equal(publicKey))
+	assert.Equal(t, "github:alice", cert.IssuerReference())
+	assert.Equal(t, SignatureAlgorithmEd25519, cert.SignatureAlgorithm())
+	valid, err := VerifyCertificate(cert)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	cert.IssuerRef = "github:mallory"
+	valid, err = VerifyCertificate(cert)
+	require.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestIssueCertificate_WithValidity_SignsTheWindow(t *testing.T) {
+	issuer := newTestSigner(t, "github:alice")
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	before := time.Now().Add(-time.Second)
+	cert, err := IssueCertificate(issuer, publicKey, time.Hour)
+	require.NoError(t, err)
+
+	notBefore, notAfter := cert.Validity()
+	assert.WithinRange(t, notBefore, before, time.Now())
+	assert.Equal(t, time.Hour, notAfter.Sub(notBefore))
+	valid, err := VerifyCertificate(cert)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	// Extending the window, or dropping it to pass as a legacy certificate, breaks the signature
+	cert.NotAfter = notAfter.Add(24 * time.Hour)
+	valid, err = VerifyCertificate(cert)
+	require.NoError(t, err)
+	assert.False(t, valid)
+	cert.NotBefore, cert.NotAfter = time.Time{}, time.Time{}
+	valid, err = VerifyCertificate(cert)
+	require.NoError(t, err)
+	assert.False(t, valid)
+}
+
+func TestIssueCertificate_WithNULInReference_Fails(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	_, err = IssueCertificate(newTestSigner(t, "github:alice\x00"), publicKey, time.Hour)
+	assert.ErrorContains(t, err, "contains NUL")
+}
+
+func TestCheckValidity(t *testing.T) {
+	issued := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	windowed := &SimpleCertificate{NotBefore: issued, NotAfter: issued.Add(24 * time.Hour)}
+	tests := []struct {
+		name     string
+		cert     *SimpleCertificate
+		now      time.Time
+		expected error
+	}{
+		{name: "legacy certificate never expires", cert: &SimpleCertificate{}, now: issued.AddDate(10, 0, 0)},
+		{name: "within the window", cert: windowed, now: issued.Add(time.Hour)},
+		{name: "at the end of the window", cert: windowed, now: issued.Add(24 * time.Hour)},
+		{name: "issued then expired", cert: windowed, now: issued.Add(25 * time.Hour), expected: ErrCertificateExpired},
+		{name: "issuer clock ahead within skew", cert: windowed, now: issued.Add(-4 * time.Minute)},
+		{name: "issuer clock ahead beyond skew", cert: windowed, now: issued.Add(-6 * time.Minute), expected: ErrCertificateNotYetValid},
+		{name: "open start", cert: &SimpleCertificate{NotAfter: issued}, now: issued.AddDate(-1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckValidity(tt.cert, tt.now, 5*time.Minute)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+	assert.EqualError(t, CheckValidity(windowed, issued.AddDate(0, 0, 2), 0),
+		"certificate expired at 2026-01-02T00:00:00Z")
+}
+
+// certificateWithoutValidity implements Certificate only, like implementations predating validity windows
+type certificateWithoutValidity struct {
+	Certificate
+}
+
+func TestCertificateValidity_WithoutValidityCertificate_IsOpen(t *testing.T) {
+	issuer := newTestSigner(t, "github:alice")
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	cert, err := IssueCertificate(issuer, publicKey, time.Hour)
+	require.NoError(t, err)
+
+	notBefore, notAfter := CertificateValidity(certificateWithoutValidity{cert})
+	assert.True(t, notBefore.IsZero())
+	assert.True(t, notAfter.IsZero())
+	notBefore, notAfter = CertificateValidity(cert)
+	assert.Equal(t, cert.NotBefore, notBefore)
+	assert.Equal(t, cert.NotAfter, notAfter)
+}
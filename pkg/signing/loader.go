@@ -3,26 +3,89 @@ package signing
 import (
 	"crypto"
 	"crypto/ed25519"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/term"
 	"os"
+	"strings"
 )
 
+// PassphraseEnvVar holds the passphrase of an encrypted private key, see DefaultPassphrase
+const PassphraseEnvVar = "BYTECHECK_KEY_PASSPHRASE"
+
+// PassphraseFunc returns the passphrase of an encrypted private key. It is only called for encrypted keys.
+type PassphraseFunc func() ([]byte, error)
+
 // Ed25519KeyReader provides functionality to read ed25519 SSH keys
 type Ed25519KeyReader struct {
-	reference string
+	reference  string
+	passphrase PassphraseFunc
 }
 
-// NewEd25519KeyReader creates a new instance of Ed25519KeyReader
+// NewEd25519KeyReader creates a new instance of Ed25519KeyReader.
+// Encrypted keys are decrypted with the passphrase returned by DefaultPassphrase("").
 func NewEd25519KeyReader(reference string) *Ed25519KeyReader {
+	return NewEd25519KeyReaderWithPassphrase(reference, nil)
+}
+
+// NewEd25519KeyReaderWithPassphrase creates a new instance of Ed25519KeyReader.
+// Encrypted keys are decrypted with the passphrase returned by passphrase, DefaultPassphrase("") when nil.
+func NewEd25519KeyReaderWithPassphrase(reference string, passphrase PassphraseFunc) *Ed25519KeyReader {
+	if passphrase == nil {
+		passphrase = DefaultPassphrase("")
+	}
 	return &Ed25519KeyReader{
-		reference: reference,
+		reference:  reference,
+		passphrase: passphrase,
 	}
 }
 
+// DefaultPassphrase reads the passphrase from passphraseFile if it is set, otherwise from the
+// PassphraseEnvVar environment variable. Only when neither is available and stdin is a terminal
+// the user is prompted, so that non-interactive runs fail fast instead of hanging.
+func DefaultPassphrase(passphraseFile string) PassphraseFunc {
+	return func() ([]byte, error) {
+		if passphraseFile != "" {
+			return PassphraseFromFile(passphraseFile)()
+		}
+		if passphrase, ok := os.LookupEnv(PassphraseEnvVar); ok {
+			return []byte(passphrase), nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("private key is encrypted and stdin is not a terminal:"+
+				" provide the passphrase with --passphrase-file or the %s environment variable", PassphraseEnvVar)
+		}
+		return PromptPassphrase()
+	}
+}
+
+// PassphraseFromFile reads the passphrase from the first line of the file at path
+func PassphraseFromFile(path string) PassphraseFunc {
+	return func() ([]byte, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		line, _, _ := strings.Cut(string(data), "\n")
+		return []byte(strings.TrimSuffix(line, "\r")), nil
+	}
+}
+
+// PromptPassphrase asks for the passphrase on the terminal
+func PromptPassphrase() ([]byte, error) {
+	// Prompt on stderr so it does not mix with command output
+	fmt.Fprint(os.Stderr, "Enter passphrase: ")
+	passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr) // Add a newline after password entry
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passwordBytes, nil
+}
+
 // ReadKeyFromFile reads an ed25519 SSH key from a file
 // If the key is encrypted, password must be provided
 func (r *Ed25519KeyReader) ReadKeyFromFile(filePath string) (ed25519.PrivateKey, error) {
@@ -42,14 +105,11 @@ func (r *Ed25519KeyReader) ReadKeyFromBytes(keyData []byte) (ed25519.PrivateKey,
 
 	var passphraseErr *ssh.PassphraseMissingError
 	if errors.As(err, &passphraseErr) {
-		fmt.Print("Enter passphrase: ")
-		passwordBytes, passErr := terminal.ReadPassword(int(os.Stdin.Fd()))
+		passphrase, passErr := r.passphrase()
 		if passErr != nil {
-			return nil, fmt.Errorf("failed to read passphrase: %w", passErr)
+			return nil, passErr
 		}
-		fmt.Println() // Add a newline after password entry
-
-		cryptoKey, err = ssh.ParseRawPrivateKeyWithPassphrase(keyData, passwordBytes)
+		cryptoKey, err = ssh.ParseRawPrivateKeyWithPassphrase(keyData, passphrase)
 	}
 
 	if err != nil {
@@ -113,6 +173,18 @@ func (r *Ed25519KeyReader) GetPublicKeyFromPrivate(privateKey ed25519.PrivateKey
 // for owner only) and the public key file with permissions 0644 (read/write for owner, read for others).
 // Returns the generated private key and public key, or an error if any step fails.
 func GenerateKeyPair(privateKeyPath, publicKeyPath string) (ed25519.PrivateKey, ssh.PublicKey, error) {
+	return generateKeyPair(privateKeyPath, publicKeyPath, "", nil, os.O_TRUNC)
+}
+
+// GenerateEncryptedKeyPair is like GenerateKeyPair, but records comment in both files and encrypts
+// the private key with passphrase, which leaves it unencrypted when empty. Unlike GenerateKeyPair,
+// it never overwrites existing files: the error wraps fs.ErrExist when one of them exists.
+func GenerateEncryptedKeyPair(privateKeyPath, publicKeyPath, comment string, passphrase []byte) (ed25519.PrivateKey, ssh.PublicKey, error) {
+	return generateKeyPair(privateKeyPath, publicKeyPath, comment, passphrase, os.O_EXCL)
+}
+
+// generateKeyPair writes a new key pair, opening the files with flag in addition to os.O_WRONLY|os.O_CREATE
+func generateKeyPair(privateKeyPath, publicKeyPath, comment string, passphrase []byte, flag int) (ed25519.PrivateKey, ssh.PublicKey, error) {
 	// Generate the key pair
 	_, privateKey, err := ed25519.GenerateKey(nil)
 	if err != nil {
@@ -126,25 +198,42 @@ func GenerateKeyPair(privateKeyPath, publicKeyPath string) (ed25519.PrivateKey,
 	}
 
 	// Write private key file
-	pemBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	var pemBlock *pem.Block
+	if len(passphrase) > 0 {
+		pemBlock, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, comment, passphrase)
+	} else {
+		pemBlock, err = ssh.MarshalPrivateKey(privateKey, comment)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
 	}
 
-	privateFile, err := os.OpenFile(privateKeyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	privateFile, err := os.OpenFile(privateKeyPath, os.O_WRONLY|os.O_CREATE|flag, 0600)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open private key file for writing: %w", err)
 	}
+	written := false
+	if flag&os.O_EXCL != 0 {
+		// The private key created here is removed, once closed, unless the public key is written too
+		defer func() {
+			if !written {
+				_ = os.Remove(privateKeyPath)
+			}
+		}()
+	}
 	defer privateFile.Close()
 
 	if err := pem.Encode(privateFile, pemBlock); err != nil {
 		return nil, nil, fmt.Errorf("failed to write private key PEM data to file: %w", err)
 	}
 
-	// Write public key file
+	// Write public key file, in the authorized_keys format with the comment at the end of the line
 	publicKeyBytes := ssh.MarshalAuthorizedKey(publicKey)
+	if comment != "" {
+		publicKeyBytes = append(append(publicKeyBytes[:len(publicKeyBytes)-1], ' '), comment+"\n"...)
+	}
 
-	publicFile, err := os.OpenFile(publicKeyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	publicFile, err := os.OpenFile(publicKeyPath, os.O_WRONLY|os.O_CREATE|flag, 0644)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to open public key file for writing: %w", err)
 	}
@@ -153,6 +242,27 @@ func GenerateKeyPair(privateKeyPath, publicKeyPath string) (ed25519.PrivateKey,
 	if _, err := publicFile.Write(publicKeyBytes); err != nil {
 		return nil, nil, fmt.Errorf("failed to write public key to file: %w", err)
 	}
+	written = true
 
 	return privateKey, publicKey, nil
 }
+
+// KeyFingerprints identifies a public key the ways it shows up in manifests and on key servers
+type KeyFingerprints struct {
+	// SSH is the SHA256 fingerprint printed by ssh-keygen -l, e.g. "SHA256:..."
+	SSH string
+	// PublicKey is the hex-encoded key, as recorded in the issuerPublicKey of a manifest's certificate
+	PublicKey string
+}
+
+// Fingerprints returns the fingerprints of an ed25519 public key
+func Fingerprints(publicKey ed25519.PublicKey) (KeyFingerprints, error) {
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return KeyFingerprints{}, fmt.Errorf("failed to convert public key: %w", err)
+	}
+	return KeyFingerprints{
+		SSH:       ssh.FingerprintSHA256(sshKey),
+		PublicKey: hex.EncodeToString(publicKey),
+	}, nil
+}
@@ -0,0 +1,154 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeEncryptedKey writes a new ed25519 private key encrypted with passphrase and returns its path
+func writeEncryptedKey(t *testing.T, passphrase string) (string, ed25519.PrivateKey) {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte(passphrase))
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+	return keyPath, privateKey
+}
+
+func TestEd25519KeyReader_EncryptedKey_WithPassphraseFunc(t *testing.T) {
+	keyPath, privateKey := writeEncryptedKey(t, "secret")
+
+	calls := 0
+	reader := NewEd25519KeyReaderWithPassphrase("test", func() ([]byte, error) {
+		calls++
+		return []byte("secret"), nil
+	})
+	key, err := reader.ReadKeyFromFile(keyPath)
+	require.NoError(t, err)
+	assert.True(t, privateKey.Equal(key))
+	assert.Equal(t, 1, calls)
+
+	wrong := NewEd25519KeyReaderWithPassphrase("test", func() ([]byte, error) { return []byte("wrong"), nil })
+	_, err = wrong.ReadKeyFromFile(keyPath)
+	assert.ErrorContains(t, err, "failed to parse SSH private key")
+}
+
+func TestEd25519KeyReader_UnencryptedKey_DoesNotAskForPassphrase(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	_, _, err := GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+
+	reader := NewEd25519KeyReaderWithPassphrase("test", func() ([]byte, error) {
+		t.Fatal("passphrase must not be requested for unencrypted keys")
+		return nil, nil
+	})
+	_, err = reader.ReadKeyFromFile(keyPath)
+	require.NoError(t, err)
+}
+
+func TestDefaultPassphrase_FromFile(t *testing.T) {
+	keyPath, _ := writeEncryptedKey(t, "from-file")
+	passphraseFile := filepath.Join(t.TempDir(), "passphrase")
+	require.NoError(t, os.WriteFile(passphraseFile, []byte("from-file\r\n"), 0600))
+	t.Setenv(PassphraseEnvVar, "from-env")
+
+	_, err := NewEd25519SignerFromFileWithPassphrase(keyPath, "test", DefaultPassphrase(passphraseFile))
+	require.NoError(t, err)
+}
+
+func TestNewSignerWithPassphrase_FileSigner_UsesPassphrase(t *testing.T) {
+	keyPath, privateKey := writeEncryptedKey(t, "secret")
+	t.Setenv(PassphraseEnvVar, "wrong")
+
+	signer, err := NewSignerWithPassphrase(SignerFile, keyPath, "test", func() ([]byte, error) {
+		return []byte("secret"), nil
+	})
+	require.NoError(t, err)
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.True(t, privateKey.Public().(ed25519.PublicKey).Equal(publicKey))
+}
+
+func TestDefaultPassphrase_FromEnv(t *testing.T) {
+	keyPath, _ := writeEncryptedKey(t, "from-env")
+	t.Setenv(PassphraseEnvVar, "from-env")
+
+	_, err := NewEd25519SignerFromFile(keyPath, "test")
+	require.NoError(t, err)
+}
+
+func TestDefaultPassphrase_WithoutTerminal_mustFailFast(t *testing.T) {
+	stdin, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer stdin.Close()
+	originalStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = originalStdin }()
+	t.Setenv(PassphraseEnvVar, "") // restored after the test
+	require.NoError(t, os.Unsetenv(PassphraseEnvVar))
+	keyPath, _ := writeEncryptedKey(t, "secret")
+
+	_, err = NewEd25519SignerFromFile(keyPath, "test")
+	assert.ErrorContains(t, err, "stdin is not a terminal")
+	assert.ErrorContains(t, err, "--passphrase-file")
+	assert.ErrorContains(t, err, PassphraseEnvVar)
+}
+
+func TestGenerateEncryptedKeyPair_mustRequirePassphraseAndRecordComment(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	privateKey, publicKey, err := GenerateEncryptedKeyPair(keyPath, keyPath+".pub", "alice@example.com", []byte("secret"))
+	require.NoError(t, err)
+
+	_, err = NewEd25519KeyReaderWithPassphrase("", func() ([]byte, error) { return []byte("wrong"), nil }).ReadKeyFromFile(keyPath)
+	require.ErrorContains(t, err, "failed to parse SSH private key")
+
+	readKey, err := NewEd25519KeyReaderWithPassphrase("", func() ([]byte, error) { return []byte("secret"), nil }).ReadKeyFromFile(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, privateKey, readKey)
+
+	data, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	parsed, comment, _, _, err := ssh.ParseAuthorizedKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", comment)
+	assert.Equal(t, publicKey.Marshal(), parsed.Marshal())
+}
+
+func TestGenerateEncryptedKeyPair_WithExistingFile_mustNotOverwriteIt(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyPath+".pub", []byte("existing"), 0644))
+
+	_, _, err := GenerateEncryptedKeyPair(keyPath, keyPath+".pub", "", nil)
+
+	require.ErrorIs(t, err, fs.ErrExist)
+	data, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	assert.Equal(t, "existing", string(data))
+	// The private key is not left behind without its public key
+	assert.NoFileExists(t, keyPath)
+}
+
+func TestFingerprints_mustMatchSSHFingerprint(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	require.NoError(t, err)
+
+	fingerprints, err := Fingerprints(publicKey)
+
+	require.NoError(t, err)
+	assert.Equal(t, ssh.FingerprintSHA256(sshKey), fingerprints.SSH)
+	assert.Len(t, fingerprints.PublicKey, 2*ed25519.PublicKeySize)
+}
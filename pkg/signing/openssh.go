@@ -121,15 +121,18 @@ func parseSkSignature(data []byte) (*skSignature, error) {
 // This is the data that is hashed and then signed by the security key.
 // The structure is: "SSHSIG" || namespace || reserved || hash_alg || HASH(data)
 func buildSSHSignaturePayload(namespace string, hashAlgo string, dataToSign []byte) ([]byte, error) {
-	// 1. Hash the original data using the specified algorithm.
+	// 1. Hash the original data using the specified algorithm, ssh-keygen uses sha512 by default.
 	var dataHash []byte
-	if hashAlgo != "sha512" {
-		// The example uses sha512, for now we only support that.
+	switch hashAlgo {
+	case "sha512":
+		sum := sha512.Sum512(dataToSign)
+		dataHash = sum[:]
+	case "sha256":
+		sum := sha256.Sum256(dataToSign)
+		dataHash = sum[:]
+	default:
 		return nil, fmt.Errorf("unsupported hash algorithm: %s", hashAlgo)
 	}
-	h := sha512.New()
-	h.Write(dataToSign)
-	dataHash = h.Sum(nil)
 
 	// 2. Construct the "to be signed" blob.
 	buf := new(bytes.Buffer)
@@ -248,6 +251,10 @@ func writeBytes(w io.Writer, data []byte) error {
 	return err
 }
 
+func writeUint32(w io.Writer, v uint32) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
 func writeString(w io.Writer, s string) error {
 	return writeBytes(w, []byte(s))
 }
@@ -0,0 +1,85 @@
+package signing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SignerFactory creates a Signer from a backend-specific key reference
+// (e.g. a key file path) and the issuer reference recorded in certificates.
+type SignerFactory func(keyRef string, issuerRef string) (Signer, error)
+
+// PassphraseSignerFactory is a SignerFactory for backends whose keys may be encrypted,
+// passphrase returns the passphrase of an encrypted key and may be nil, see NewSignerWithPassphrase.
+type PassphraseSignerFactory func(keyRef string, issuerRef string, passphrase PassphraseFunc) (Signer, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]PassphraseSignerFactory)
+)
+
+// Names of the built-in signer backends
+const (
+	SignerFile    = "file"
+	SignerYubiKey = "yubikey"
+	SignerAgent   = "agent"
+)
+
+func init() {
+	RegisterPassphraseSigner(SignerFile, func(keyRef string, issuerRef string, passphrase PassphraseFunc) (Signer, error) {
+		return NewEd25519SignerFromFileWithPassphrase(keyRef, issuerRef, passphrase)
+	})
+	RegisterSigner(SignerYubiKey, func(keyRef string, issuerRef string) (Signer, error) {
+		return NewYubiKeySigner(keyRef, issuerRef)
+	})
+	RegisterSigner(SignerAgent, func(keyRef string, issuerRef string) (Signer, error) {
+		return NewAgentSignerFromEnv(keyRef, issuerRef)
+	})
+}
+
+// RegisterSigner makes a signer backend available under the given name.
+// Registering a name twice replaces the previous factory.
+func RegisterSigner(name string, factory SignerFactory) {
+	RegisterPassphraseSigner(name, func(keyRef string, issuerRef string, _ PassphraseFunc) (Signer, error) {
+		return factory(keyRef, issuerRef)
+	})
+}
+
+// RegisterPassphraseSigner makes a signer backend that reads encrypted keys available under the given name.
+// Registering a name twice replaces the previous factory.
+func RegisterPassphraseSigner(name string, factory PassphraseSignerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// NewSigner creates a Signer using the backend registered under name
+func NewSigner(name string, keyRef string, issuerRef string) (Signer, error) {
+	return NewSignerWithPassphrase(name, keyRef, issuerRef, nil)
+}
+
+// NewSignerWithPassphrase creates a Signer using the backend registered under name. Backends registered
+// with RegisterPassphraseSigner decrypt encrypted keys with the passphrase returned by passphrase,
+// see DefaultPassphrase for the behaviour when it is nil. Other backends ignore it.
+func NewSignerWithPassphrase(name string, keyRef string, issuerRef string, passphrase PassphraseFunc) (Signer, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signer '%s', available signers: %v", name, RegisteredSigners())
+	}
+	return factory(keyRef, issuerRef, passphrase)
+}
+
+// RegisteredSigners returns the sorted names of all registered signer backends
+func RegisteredSigners() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -38,9 +38,16 @@ func NewEd25519Signer(privKey ed25519.PrivateKey, reference string) *Ed25519Sign
 }
 
 // NewEd25519SignerFromFile reads an SSH-formatted ed25519 private key from a file
-// and returns a new Signer. It will prompt for a passphrase if the key is encrypted.
+// and returns a new Signer. Encrypted keys are decrypted with the passphrase returned by DefaultPassphrase("").
 func NewEd25519SignerFromFile(filePath string, reference string) (*Ed25519Signer, error) {
-	reader := NewEd25519KeyReader(reference)
+	return NewEd25519SignerFromFileWithPassphrase(filePath, reference, nil)
+}
+
+// NewEd25519SignerFromFileWithPassphrase reads an SSH-formatted ed25519 private key from a file
+// and returns a new Signer. Encrypted keys are decrypted with the passphrase returned by passphrase,
+// see DefaultPassphrase for the behaviour when it is nil.
+func NewEd25519SignerFromFileWithPassphrase(filePath string, reference string, passphrase PassphraseFunc) (*Ed25519Signer, error) {
+	reader := NewEd25519KeyReaderWithPassphrase(reference, passphrase)
 
 	privateKey, err := reader.ReadKeyFromFile(filePath)
 	if err != nil {
@@ -70,6 +77,8 @@ func (s *Ed25519Signer) Close() error {
 	return nil
 }
 
+// FakeSigner is a Signer whose Sign always fails with ErrNotImplemented, for tests needing a non-functional
+// signer. Generating unsigned manifests takes a nil signer, see generator.New.
 type FakeSigner struct{}
 
 func NewFakeSigner() *FakeSigner {
@@ -0,0 +1,141 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DigestNamespace is the SSHSIG namespace of detached signatures of root digests, see SignDigest.
+// They can be checked with `ssh-keygen -Y verify -n bytecheck` fed with DigestMessage.
+const DigestNamespace = "bytecheck"
+
+// sshSignaturePEMType is the type of the PEM block of armored SSHSIG signatures
+const sshSignaturePEMType = "SSH SIGNATURE"
+
+// ErrSignerNotAllowed is wrapped by the error of VerifySSHSignature when no allowed signer accepts the signature key
+var ErrSignerNotAllowed = errors.New("signature key is not an allowed signer")
+
+// SSHSigner is implemented by signers creating SSHSIG signatures, the format of `ssh-keygen -Y sign`
+type SSHSigner interface {
+	// SignSSH signs data under namespace and returns the signature armored like ssh-keygen does
+	SignSSH(namespace string, data []byte) ([]byte, error)
+}
+
+var (
+	_ SSHSigner = (*Ed25519Signer)(nil)
+	_ SSHSigner = (*AgentSigner)(nil)
+	_ SSHSigner = (*YubiKeySigner)(nil)
+)
+
+// DigestMessage returns the message signed for a root digest: the digest in lowercase hex followed by a newline,
+// as printed by `echo <digest>`
+func DigestMessage(digest string) []byte {
+	return []byte(strings.ToLower(digest) + "\n")
+}
+
+// SignDigest signs the root digest with signer, which must be an SSHSigner, see DigestMessage and DigestNamespace
+func SignDigest(signer Signer, digest string) ([]byte, error) {
+	sshSigner, ok := signer.(SSHSigner)
+	if !ok {
+		return nil, fmt.Errorf("signer '%s' cannot create SSH signatures", signer.Reference())
+	}
+	return sshSigner.SignSSH(DigestNamespace, DigestMessage(digest))
+}
+
+// VerifyDigestSignature checks that armored is a signature of the root digest made by one of signers,
+// see VerifySSHSignature
+func VerifyDigestSignature(armored []byte, digest string, signers []AllowedSigner, now time.Time) (*AllowedSigner, error) {
+	return VerifySSHSignature(armored, DigestNamespace, DigestMessage(digest), signers, now)
+}
+
+// VerifySSHSignature checks that armored is an SSHSIG signature of data under namespace made by a key of signers
+// accepting it at now, and returns the matching signer
+func VerifySSHSignature(armored []byte, namespace string, data []byte, signers []AllowedSigner, now time.Time) (*AllowedSigner, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sshSignaturePEMType {
+		return nil, fmt.Errorf("not an armored SSH signature")
+	}
+	sig, err := parseSSHSignature(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+	if sig.Namespace != namespace {
+		return nil, fmt.Errorf("signature namespace is '%s', expected '%s'", sig.Namespace, namespace)
+	}
+	publicKey, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signature public key: %w", err)
+	}
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return nil, fmt.Errorf("failed to parse signature blob: %w", err)
+	}
+	payload, err := buildSSHSignaturePayload(namespace, sig.HashAlgorithm, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range signers {
+		if !bytes.Equal(signers[i].PublicKey.Marshal(), sig.PublicKey) || !signers[i].Accepts(namespace, now) {
+			continue
+		}
+		if err := publicKey.Verify(payload, &signature); err != nil {
+			return nil, fmt.Errorf("signature by %s is invalid: %w", ssh.FingerprintSHA256(publicKey), err)
+		}
+		return &signers[i], nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSignerNotAllowed, ssh.FingerprintSHA256(publicKey))
+}
+
+// marshalSSHSignature returns the SSHSIG blob of signature, made by publicKey over the payload of namespace,
+// see buildSSHSignaturePayload
+func marshalSSHSignature(publicKey ssh.PublicKey, namespace, hashAlgorithm string, signature *ssh.Signature) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte("SSHSIG"))
+	if err := writeUint32(buf, 1); err != nil {
+		return nil, err
+	}
+	for _, field := range [][]byte{publicKey.Marshal(), []byte(namespace), nil, []byte(hashAlgorithm), ssh.Marshal(signature)} {
+		if err := writeBytes(buf, field); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// armorSSHSignature encodes an SSHSIG blob as PEM like ssh-keygen does
+func armorSSHSignature(blob []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: sshSignaturePEMType, Bytes: blob})
+}
+
+// SignSSH implements the SSHSigner interface
+func (s *Ed25519Signer) SignSSH(namespace string, data []byte) ([]byte, error) {
+	const hashAlgorithm = "sha512"
+	signer, err := ssh.NewSignerFromKey(s.privKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH signer: %w", err)
+	}
+	payload, err := buildSSHSignaturePayload(namespace, hashAlgorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.Sign(rand.Reader, payload)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := marshalSSHSignature(signer.PublicKey(), namespace, hashAlgorithm, signature)
+	if err != nil {
+		return nil, err
+	}
+	return armorSSHSignature(blob), nil
+}
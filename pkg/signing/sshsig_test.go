@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+const fixtureDigest = "f6e0a1e2ac41945a9aa7ff8a8aaa0cebc12a3bcc981a929ad5cf810a090e11ae"
+
+// fixtureDigestSignature was created by `ssh-keygen -Y sign -n bytecheck` over DigestMessage(fixtureDigest)
+// with the key of fixtureSigner
+const fixtureDigestSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgA6EHv/POEL4dcN0Y50vAmWfk1j
+CbpQ1fHdyGZBJVMbgAAAAJYnl0ZWNoZWNrAAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1l
+ZDI1NTE5AAAAQH3z1esvJXkMHmGK1NK0p3xtfvPqTB2My/WsCXvC6NaDu/FzFOi9bMTYSf
+7/2+qUAHniy6KrDPKWqO5LjSQ3RQc=
+-----END SSH SIGNATURE-----
+`
+
+// fixtureSigner holds the ed25519 key whose seed is the bytes 0 to 31, listed by fixtureAllowedSigners
+func fixtureSigner() *Ed25519Signer {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	return NewEd25519Signer(ed25519.NewKeyFromSeed(seed), "custom:release")
+}
+
+func fingerprintOf(signer AllowedSigner) string {
+	return ssh.FingerprintSHA256(signer.PublicKey)
+}
+
+func fixtureSigners(t *testing.T) []AllowedSigner {
+	signers, err := ParseAllowedSigners(strings.NewReader(fixtureAllowedSigners))
+	require.NoError(t, err)
+	return signers
+}
+
+func TestSignDigest_mustMatchSSHKeygen(t *testing.T) {
+	armored, err := SignDigest(fixtureSigner(), fixtureDigest)
+	require.NoError(t, err)
+
+	// ed25519 signatures are deterministic, only the line length of the armor differs from ssh-keygen
+	block, _ := pem.Decode(armored)
+	require.NotNil(t, block)
+	expected, _ := pem.Decode([]byte(fixtureDigestSignature))
+	assert.Equal(t, expected.Bytes, block.Bytes)
+}
+
+func TestVerifyDigestSignature_WithSSHKeygenSignature(t *testing.T) {
+	signer, err := VerifyDigestSignature([]byte(fixtureDigestSignature), fixtureDigest, fixtureSigners(t), time.Now())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"release@example.com"}, signer.Principals)
+}
+
+func TestVerifyDigestSignature_mustBindTheDigest(t *testing.T) {
+	signers := fixtureSigners(t)
+	armored, err := SignDigest(fixtureSigner(), fixtureDigest)
+	require.NoError(t, err)
+
+	_, err = VerifyDigestSignature(armored, strings.ToUpper(fixtureDigest), signers, time.Now())
+	assert.NoError(t, err, "digests are compared in lowercase")
+
+	otherDigest := strings.Replace(fixtureDigest, "f6", "f7", 1)
+	_, err = VerifyDigestSignature(armored, otherDigest, signers, time.Now())
+	assert.ErrorContains(t, err, "signature by SHA256:lbmsoA0yIEcEiVDRnMWuzm+nV+3ZEEpVIURqFoeSspg is invalid")
+
+	_, err = VerifySSHSignature(armored, "file", DigestMessage(fixtureDigest), signers, time.Now())
+	assert.ErrorContains(t, err, "signature namespace is 'bytecheck', expected 'file'")
+}
+
+func TestVerifyDigestSignature_WithUnknownKey_mustFail(t *testing.T) {
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	armored, err := SignDigest(NewEd25519Signer(otherKey, "custom:other"), fixtureDigest)
+	require.NoError(t, err)
+
+	_, err = VerifyDigestSignature(armored, fixtureDigest, fixtureSigners(t), time.Now())
+	assert.ErrorIs(t, err, ErrSignerNotAllowed)
+
+	_, err = VerifyDigestSignature([]byte("not a signature"), fixtureDigest, fixtureSigners(t), time.Now())
+	assert.ErrorContains(t, err, "not an armored SSH signature")
+}
+
+func TestSignDigest_WithSignerWithoutSSHSignatures_mustFail(t *testing.T) {
+	_, err := SignDigest(NewFakeSigner(), fixtureDigest)
+	assert.ErrorContains(t, err, "signer 'fake' cannot create SSH signatures")
+}
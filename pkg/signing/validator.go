@@ -47,6 +47,9 @@ func verifySSHSignature(publicKey []byte, data []byte, signature []byte) (bool,
 	messageToVerify := buildFIDO2VerifiableMessage("ssh:", sshPayload, skSig)
 
 	sigPubKey, err := parseRawPubKey(sshSig.PublicKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse signature public key: %w", err)
+	}
 	if !bytes.Equal(publicKey, sigPubKey) {
 		return false, fmt.Errorf("signature public key mismatch: %s != %s", publicKey, sigPubKey)
 	}
@@ -48,12 +48,29 @@ func NewYubiKeySigner(privateKeyPath string, issuerReference string) (*YubiKeySi
 }
 
 func (y *YubiKeySigner) Sign(data []byte) ([]byte, error) {
+	armored, err := y.SignSSH("file", data)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(armored)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block from ssh-keygen output")
+	}
+	if block.Type != sshSignaturePEMType {
+		return nil, fmt.Errorf("unexpected PEM block type: %s, expected 'SSH SIGNATURE'", block.Type)
+	}
+
+	return block.Bytes, nil
+}
 
-	// Use ssh-keygen to sign, just like Git does
-	fmt.Printf("Signing with YubiKey - you will need to touch it\n")
+// SignSSH implements the SSHSigner interface, it returns the output of ssh-keygen
+func (y *YubiKeySigner) SignSSH(namespace string, data []byte) ([]byte, error) {
+	// Use ssh-keygen to sign, just like Git does. The prompt is not a log event: it must show even with --quiet,
+	// like the passphrase prompt, and stay off stdout, which may carry JSON output
+	fmt.Fprintln(os.Stderr, "Signing with YubiKey - you will need to touch it")
 	cmd := exec.Command("ssh-keygen", "-Y", "sign",
 		"-f", y.privateKeyPath,
-		"-n", "file",
+		"-n", namespace,
 		"-q")
 
 	cmd.Stdin = bytes.NewReader(data)
@@ -66,15 +83,7 @@ func (y *YubiKeySigner) Sign(data []byte) ([]byte, error) {
 		}
 		return nil, fmt.Errorf("ssh-keygen signing failed: %w", err)
 	}
-	block, _ := pem.Decode(signatureOutput)
-	if block == nil {
-		return nil, fmt.Errorf("failed to decode PEM block from ssh-keygen output")
-	}
-	if block.Type != "SSH SIGNATURE" {
-		return nil, fmt.Errorf("unexpected PEM block type: %s, expected 'SSH SIGNATURE'", block.Type)
-	}
-
-	return block.Bytes, nil
+	return signatureOutput, nil
 }
 
 func (y *YubiKeySigner) PublicKey() (ed25519.PublicKey, error) {
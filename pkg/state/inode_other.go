@@ -0,0 +1,10 @@
+//go:build !unix
+
+package state
+
+import "os"
+
+// inode is not available on this platform, size and modification time are used alone
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,200 @@
+package state
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Version identifies the on-disk format together with the checksum algorithm.
+// Bump it whenever the way checksums are calculated changes, so that state files
+// written by older versions are discarded instead of producing wrong checksums.
+const Version = "1-sha256"
+
+// racyWindow protects against files modified within the filesystem's timestamp
+// granularity right after being hashed. Such files are not remembered.
+const racyWindow = 2 * time.Second
+
+// ErrLocked is returned when the state file is already used by another run
+var ErrLocked = errors.New("state file is in use by another run")
+
+type entry struct {
+	Size     int64
+	ModTime  int64
+	Inode    uint64
+	Checksum string
+	// Progress of an interrupted chunked checksum, see UpdateProgress
+	ChunkSize    int64
+	ChunkDigests []string
+	HashState    []byte
+}
+
+// matches reports whether e was recorded for the file described by info
+func (e entry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() && e.Inode == inode(info)
+}
+
+type fileData struct {
+	Version string
+	Entries map[string]entry
+}
+
+// Store remembers file checksums keyed by path, size, modification time and inode.
+// It is safe for concurrent use. Only one Store may use a given file at a time.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	lockPath string
+	entries  map[string]entry
+	dirty    bool
+}
+
+// Open loads the state file at path, creating an empty store if it does not exist or
+// was written by an incompatible version. It fails fast if another run holds the lock.
+func Open(path string) (*Store, error) {
+	lockPath := path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%w: remove %s if no other run is active", ErrLocked, lockPath)
+		}
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+	fmt.Fprintf(lock, "%d\n", os.Getpid())
+	lock.Close()
+
+	s := &Store{path: path, lockPath: lockPath, entries: make(map[string]entry)}
+	if err := s.load(); err != nil {
+		os.Remove(lockPath)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer file.Close()
+
+	var data fileData
+	if err := gob.NewDecoder(file).Decode(&data); err != nil || data.Version != Version {
+		// Unreadable or incompatible state is discarded and rebuilt from scratch
+		return nil
+	}
+	s.entries = data.Entries
+	return nil
+}
+
+// Lookup returns the remembered checksum if the file is unchanged since it was recorded
+func (s *Store) Lookup(path string, info os.FileInfo) (string, bool) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.Checksum == "" || !e.matches(info) {
+		return "", false
+	}
+	return e.Checksum, true
+}
+
+// LookupProgress returns the progress of the chunked checksum of a file recorded by UpdateProgress,
+// if the file is unchanged since and its chunks have chunkSize bytes
+func (s *Store) LookupProgress(path string, info os.FileInfo, chunkSize int64) ([]string, []byte, bool) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.HashState == nil || e.ChunkSize != chunkSize || !e.matches(info) {
+		return nil, nil, false
+	}
+	return e.ChunkDigests, e.HashState, true
+}
+
+// UpdateProgress remembers how far the chunked checksum of a file described by info got before it was
+// interrupted: the checksums of its first chunks and the state of the checksum of the whole file after them.
+// The checksum recorded for the unchanged file by Update is kept, recording it drops the progress.
+func (s *Store) UpdateProgress(path string, info os.FileInfo, chunkSize int64, chunkDigests []string, hashState []byte) {
+	if time.Since(info.ModTime()) < racyWindow {
+		return
+	}
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := entry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Inode: inode(info)}
+	if previous, ok := s.entries[key]; ok && previous.matches(info) {
+		e.Checksum = previous.Checksum
+	}
+	e.ChunkSize, e.ChunkDigests, e.HashState = chunkSize, chunkDigests, hashState
+	s.entries[key] = e
+	s.dirty = true
+}
+
+// Update remembers the checksum of a file described by info
+func (s *Store) Update(path string, info os.FileInfo, checksum string) {
+	if time.Since(info.ModTime()) < racyWindow {
+		return
+	}
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = entry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		Inode:    inode(info),
+		Checksum: checksum,
+	}
+	s.dirty = true
+}
+
+// Close writes the state file if it changed and releases the lock
+func (s *Store) Close() error {
+	defer os.Remove(s.lockPath)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+func (s *Store) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := gob.NewEncoder(tmp).Encode(fileData{Version: Version, Entries: s.entries}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
@@ -0,0 +1,127 @@
+package state
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeOldFile(t *testing.T, path, content string) os.FileInfo {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(path, past, past))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info
+}
+
+func TestStore_LookupAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state")
+	filePath := filepath.Join(dir, "file.txt")
+	info := writeOldFile(t, filePath, "content")
+
+	store, err := Open(statePath)
+	require.NoError(t, err)
+	_, ok := store.Lookup(filePath, info)
+	assert.False(t, ok)
+	store.Update(filePath, info, "checksum")
+	require.NoError(t, store.Close())
+
+	store, err = Open(statePath)
+	require.NoError(t, err)
+	defer store.Close()
+	checksum, ok := store.Lookup(filePath, info)
+	assert.True(t, ok)
+	assert.Equal(t, "checksum", checksum)
+
+	// Any change of size or modification time is a miss
+	changed := writeOldFile(t, filePath, "changed content")
+	_, ok = store.Lookup(filePath, changed)
+	assert.False(t, ok)
+}
+
+func TestStore_LookupProgressAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state")
+	filePath := filepath.Join(dir, "file.txt")
+	info := writeOldFile(t, filePath, "content")
+
+	store, err := Open(statePath)
+	require.NoError(t, err)
+	store.UpdateProgress(filePath, info, 4096, []string{"chunk0"}, []byte("hash state"))
+	require.NoError(t, store.Close())
+
+	store, err = Open(statePath)
+	require.NoError(t, err)
+	defer store.Close()
+	digests, hashState, ok := store.LookupProgress(filePath, info, 4096)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"chunk0"}, digests)
+	assert.Equal(t, []byte("hash state"), hashState)
+	_, _, ok = store.LookupProgress(filePath, info, 8192)
+	assert.False(t, ok, "chunks of another size cannot be resumed")
+	_, ok = store.Lookup(filePath, info)
+	assert.False(t, ok, "progress is not a checksum")
+
+	// Recording the checksum of the file drops its progress
+	store.Update(filePath, info, "checksum")
+	_, _, ok = store.LookupProgress(filePath, info, 4096)
+	assert.False(t, ok)
+}
+
+func TestStore_RecentlyModifiedFilesAreNotRemembered(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "file.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+
+	store, err := Open(filepath.Join(dir, "state"))
+	require.NoError(t, err)
+	defer store.Close()
+	store.Update(filePath, info, "checksum")
+	_, ok := store.Lookup(filePath, info)
+	assert.False(t, ok)
+}
+
+func TestOpen_WhenLocked_mustFailFast(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state")
+	store, err := Open(statePath)
+	require.NoError(t, err)
+
+	_, err = Open(statePath)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, store.Close())
+	store, err = Open(statePath)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+}
+
+func TestOpen_WithIncompatibleVersion_mustDiscardEntries(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state")
+	filePath := filepath.Join(dir, "file.txt")
+	info := writeOldFile(t, filePath, "content")
+
+	file, err := os.Create(statePath)
+	require.NoError(t, err)
+	require.NoError(t, gob.NewEncoder(file).Encode(fileData{
+		Version: "0-md5",
+		Entries: map[string]entry{filePath: {Size: info.Size(), ModTime: info.ModTime().UnixNano(), Inode: inode(info), Checksum: "old"}},
+	}))
+	require.NoError(t, file.Close())
+
+	store, err := Open(statePath)
+	require.NoError(t, err)
+	defer store.Close()
+	_, ok := store.Lookup(filePath, info)
+	assert.False(t, ok)
+}
@@ -0,0 +1,157 @@
+// Package opentelemetry exports the traces of bytecheck runs with OpenTelemetry, see telemetry.Tracer.
+// It is the only package depending on the OpenTelemetry SDK.
+package opentelemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"github.com/tomekjarosik/bytecheck/pkg/version"
+)
+
+const (
+	// EndpointEnv is the standard variable setting the OTLP endpoint, setting it enables tracing, see Enabled
+	EndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// TraceParentEnv and TraceStateEnv hold the W3C trace context of the process running bytecheck, e.g. a
+	// pipeline, which the root span continues, see Start
+	TraceParentEnv = "TRACEPARENT"
+	TraceStateEnv  = "TRACESTATE"
+)
+
+const instrumentationName = "github.com/tomekjarosik/bytecheck"
+
+// Enabled reports whether runs are traced: when requested, e.g. with --otel, or when EndpointEnv is set
+func Enabled(requested bool) bool {
+	return requested || os.Getenv(EndpointEnv) != ""
+}
+
+// NewExporter returns an exporter sending spans with OTLP over HTTP, JSON encoded, to the endpoint configured by
+// TracesEndpointEnv or EndpointEnv, http://localhost:4318 by default, with the headers of HeadersEnv
+func NewExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	exporter, err := newOTLPExporter()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+// Run is the trace of one run of a command, its root span and the spans started by its Tracer
+type Run struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	ctx      context.Context
+	span     trace.Span
+}
+
+// Start starts the root span name of a run whose spans are exported with exporter. The span continues the trace
+// of TraceParentEnv, if set, so that the run is linked to the pipeline triggering it.
+func Start(ctx context.Context, name string, exporter sdktrace.SpanExporter) *Run {
+	res, _ := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "bytecheck"),
+			attribute.String("service.version", version.Version)),
+		// OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take precedence
+		resource.WithFromEnv(), resource.WithTelemetrySDK())
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv(TraceParentEnv),
+		"tracestate":  os.Getenv(TraceStateEnv),
+	})
+	tracer := provider.Tracer(instrumentationName, trace.WithInstrumentationVersion(version.Version))
+	ctx, span := tracer.Start(ctx, name)
+	return &Run{provider: provider, tracer: tracer, ctx: ctx, span: span}
+}
+
+// Context returns a context holding the root span, the one the command runs with
+func (r *Run) Context() context.Context {
+	return r.ctx
+}
+
+// Tracer returns the tracer starting spans of the run, children of the root span when their context holds none
+func (r *Run) Tracer() telemetry.Tracer {
+	return runTracer{run: r}
+}
+
+// SetAttributes records attrs on the root span
+func (r *Run) SetAttributes(attrs ...telemetry.Attribute) {
+	r.span.SetAttributes(convert(attrs)...)
+}
+
+// End ends the root span, marked as failed when err is set, and exports the spans not exported yet
+func (r *Run) End(ctx context.Context, err error) error {
+	recordError(r.span, err)
+	r.span.End()
+	if shutdownErr := r.provider.Shutdown(ctx); shutdownErr != nil {
+		return fmt.Errorf("failed to export trace: %w", shutdownErr)
+	}
+	return nil
+}
+
+type runTracer struct {
+	run *Run
+}
+
+func (t runTracer) Start(ctx context.Context, name string, start time.Time, attrs ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = trace.ContextWithSpan(ctx, t.run.span)
+	}
+	opts := []trace.SpanStartOption{trace.WithAttributes(convert(attrs)...)}
+	if !start.IsZero() {
+		opts = append(opts, trace.WithTimestamp(start))
+	}
+	ctx, s := t.run.tracer.Start(ctx, name, opts...)
+	return ctx, span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs ...telemetry.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s span) RecordError(err error) {
+	recordError(s.span, err)
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+func recordError(s trace.Span, err error) {
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// convert returns attrs as OpenTelemetry attributes, values of other types than the ones of telemetry.Attribute
+// are recorded as strings
+func convert(attrs []telemetry.Attribute) []attribute.KeyValue {
+	converted := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch value := attr.Value.(type) {
+		case string:
+			converted = append(converted, attribute.String(attr.Key, value))
+		case int64:
+			converted = append(converted, attribute.Int64(attr.Key, value))
+		case float64:
+			converted = append(converted, attribute.Float64(attr.Key, value))
+		case bool:
+			converted = append(converted, attribute.Bool(attr.Key, value))
+		default:
+			converted = append(converted, attribute.String(attr.Key, fmt.Sprint(value)))
+		}
+	}
+	return converted
+}
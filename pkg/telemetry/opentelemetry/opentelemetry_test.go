@@ -0,0 +1,190 @@
+package opentelemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/tomekjarosik/bytecheck/pkg/bytecheck"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+)
+
+// keptExporter keeps the spans exported once the run ends, the in-memory exporter drops them on shutdown
+type keptExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keptExporter) Shutdown(context.Context) error { return nil }
+
+func attributes(span tracetest.SpanStub) map[string]attribute.Value {
+	values := make(map[string]attribute.Value)
+	for _, kv := range span.Attributes {
+		values[string(kv.Key)] = kv.Value
+	}
+	return values
+}
+
+func TestRun_SpansOfVerification(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	t.Setenv(TraceParentEnv, "00-"+traceID+"-00f067aa0ba902b7-01")
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+	_, err := bytecheck.GenerateTree(context.Background(), dir)
+	require.NoError(t, err)
+
+	exporter := keptExporter{tracetest.NewInMemoryExporter()}
+	run := Start(context.Background(), "bytecheck verify", exporter)
+	_, err = bytecheck.VerifyTree(run.Context(), dir, bytecheck.WithTracer(run.Tracer(), 0),
+		bytecheck.WithTrustVerifier(issuer.NewMultiSourceVerifier()))
+	require.NoError(t, err)
+	run.SetAttributes(telemetry.String(telemetry.KeyOutcome, telemetry.OutcomeValid))
+	require.NoError(t, run.End(context.Background(), nil))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	root := spans[len(spans)-1]
+	assert.Equal(t, "bytecheck verify", root.Name)
+	assert.Equal(t, traceID, root.SpanContext.TraceID().String(), "the run continues the trace of "+TraceParentEnv)
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent.SpanID().String())
+	assert.Equal(t, telemetry.OutcomeValid, attributes(root)[telemetry.KeyOutcome].AsString())
+
+	var paths []string
+	for _, span := range spans[:2] {
+		assert.Equal(t, "directory", span.Name)
+		assert.Equal(t, root.SpanContext.SpanID(), span.Parent.SpanID())
+		attrs := attributes(span)
+		paths = append(paths, attrs[telemetry.KeyPath].AsString())
+		assert.Equal(t, telemetry.OutcomeValid, attrs[telemetry.KeyOutcome].AsString())
+		assert.False(t, attrs[telemetry.KeyCached].AsBool())
+	}
+	assert.Equal(t, []string{"sub", "."}, paths, "subdirectories end first")
+	assert.Equal(t, int64(1), attributes(spans[0])[telemetry.KeyBytesHashed].AsInt64())
+}
+
+func TestRun_SpansWithoutContextAreChildrenOfRoot(t *testing.T) {
+	exporter := keptExporter{tracetest.NewInMemoryExporter()}
+	run := Start(context.Background(), "bytecheck verify", exporter)
+	_, span := run.Tracer().Start(context.Background(), "fetch keys", time.Time{},
+		telemetry.Int64(telemetry.KeyStatusCode, 503))
+	span.RecordError(errors.New("unavailable"))
+	span.End()
+	require.NoError(t, run.End(context.Background(), errors.New("failed")))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, int64(503), attributes(spans[0])[telemetry.KeyStatusCode].AsInt64())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.False(t, spans[1].Parent.IsValid(), "a run without "+TraceParentEnv+" starts a trace")
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv(EndpointEnv, "")
+	assert.False(t, Enabled(false))
+	assert.True(t, Enabled(true))
+	t.Setenv(EndpointEnv, "http://collector:4318")
+	assert.True(t, Enabled(false))
+}
+
+func TestNewExporter_SendsSpansAsOTLPJSON(t *testing.T) {
+	var received otlpRequest
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		header = r.Header
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	t.Setenv(TracesEndpointEnv, "")
+	t.Setenv(EndpointEnv, server.URL+"/")
+	t.Setenv(HeadersEnv, "authorization=Bearer%20token")
+
+	exporter, err := NewExporter(context.Background())
+	require.NoError(t, err)
+	run := Start(context.Background(), "bytecheck verify", exporter)
+	_, span := run.Tracer().Start(context.Background(), "fetch keys", time.Time{},
+		telemetry.Int64(telemetry.KeyStatusCode, 503), telemetry.String(telemetry.KeyReference, "github:alice"))
+	span.End()
+	require.NoError(t, run.End(context.Background(), errors.New("failed")))
+
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	require.Len(t, received.ResourceSpans, 1)
+	require.Len(t, received.ResourceSpans[0].ScopeSpans, 1)
+	scopeSpans := received.ResourceSpans[0].ScopeSpans[0]
+	assert.Equal(t, instrumentationName, scopeSpans.Scope.Name)
+	require.Len(t, scopeSpans.Spans, 2)
+	child, root := scopeSpans.Spans[0], scopeSpans.Spans[1]
+	assert.Equal(t, root.SpanID, child.ParentSpanID)
+	assert.Equal(t, root.TraceID, child.TraceID)
+	assert.Len(t, root.TraceID, 32)
+	assert.Empty(t, root.ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: 2, Message: "failed"}, root.Status)
+	values := make(map[string]otlpValue)
+	for _, kv := range child.Attributes {
+		values[kv.Key] = kv.Value
+	}
+	require.NotNil(t, values[telemetry.KeyStatusCode].IntValue)
+	assert.Equal(t, "503", *values[telemetry.KeyStatusCode].IntValue, "64-bit integers are strings in OTLP/JSON")
+	require.NotNil(t, values[telemetry.KeyReference].StringValue)
+	assert.Equal(t, "github:alice", *values[telemetry.KeyReference].StringValue)
+}
+
+func TestNewExporter_WithTracesEndpoint_mustSendToItAsIs(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer server.Close()
+	t.Setenv(TracesEndpointEnv, server.URL+"/custom")
+	t.Setenv(EndpointEnv, "http://unused:4318")
+	t.Setenv(HeadersEnv, "")
+
+	exporter, err := NewExporter(context.Background())
+	require.NoError(t, err)
+	run := Start(context.Background(), "bytecheck generate", exporter)
+	require.NoError(t, run.End(context.Background(), nil))
+	assert.Equal(t, "/custom", <-paths)
+}
+
+func TestNewExporter_WithRejectingCollector_mustFailExport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	t.Setenv(TracesEndpointEnv, server.URL)
+	t.Setenv(HeadersEnv, "")
+
+	exporter, err := NewExporter(context.Background())
+	require.NoError(t, err)
+	err = exporter.ExportSpans(context.Background(), tracetest.SpanStubs{{Name: "bytecheck generate"}}.Snapshots())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestNewExporter_WithInvalidConfiguration_mustFail(t *testing.T) {
+	t.Setenv(TracesEndpointEnv, "")
+	t.Setenv(EndpointEnv, "localhost:4318")
+	_, err := NewExporter(context.Background())
+	assert.ErrorContains(t, err, "invalid OTLP endpoint")
+
+	t.Setenv(EndpointEnv, "")
+	t.Setenv(HeadersEnv, "authorization")
+	_, err = NewExporter(context.Background())
+	assert.ErrorContains(t, err, "expected key=value")
+}
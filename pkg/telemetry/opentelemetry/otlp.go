@@ -0,0 +1,334 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// TracesEndpointEnv is the URL spans are sent to, it takes precedence over EndpointEnv
+	TracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	// HeadersEnv holds the headers of the requests exporting spans, e.g. "authorization=Bearer%20token"
+	HeadersEnv = "OTEL_EXPORTER_OTLP_HEADERS"
+)
+
+const defaultEndpoint = "http://localhost:4318"
+
+// otlpExporter sends spans with OTLP over HTTP, in its JSON encoding. It keeps the OTLP exporter of the
+// OpenTelemetry SDK, and the gRPC stack it depends on, out of the build.
+type otlpExporter struct {
+	client  *http.Client
+	url     string
+	headers http.Header
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// newOTLPExporter returns an exporter to the endpoint configured by TracesEndpointEnv, EndpointEnv and HeadersEnv
+func newOTLPExporter() (*otlpExporter, error) {
+	endpoint := os.Getenv(TracesEndpointEnv)
+	if endpoint == "" {
+		base := os.Getenv(EndpointEnv)
+		if base == "" {
+			base = defaultEndpoint
+		}
+		// The traces path is appended to the base endpoint, unlike to the traces endpoint
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s', expected an http or https URL", endpoint)
+	}
+	headers, err := parseHeaders(os.Getenv(HeadersEnv))
+	if err != nil {
+		return nil, err
+	}
+	headers.Set("Content-Type", "application/json")
+	return &otlpExporter{client: &http.Client{Timeout: 10 * time.Second}, url: endpoint, headers: headers}, nil
+}
+
+// parseHeaders parses the comma separated key=value pairs of HeadersEnv, whose values are URL encoded
+func parseHeaders(value string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, encoded, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid %s: expected key=value, got '%s'", HeadersEnv, pair)
+		}
+		decoded, err := url.QueryUnescape(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: value of '%s': %w", HeadersEnv, key, err)
+		}
+		headers.Set(key, decoded)
+	}
+	return headers, nil
+}
+
+// ExportSpans sends spans in a single request, spans exported after Shutdown are dropped
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	stopped := e.stopped
+	e.mu.Unlock()
+	if stopped || len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = e.headers.Clone()
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans to %s: %w", e.url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to send spans to %s: %s", e.url, resp.Status)
+	}
+	return nil
+}
+
+// Shutdown stops exporting, the provider flushed its spans before
+func (e *otlpExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	return nil
+}
+
+// The types below are the JSON encoding of the OTLP trace request, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding. Trace and span IDs are hex encoded and
+// 64-bit integers are strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string           `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope     otlpScope  `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	DroppedEventsCount     int            `json:"droppedEventsCount,omitempty"`
+	Links                  []otlpLink     `json:"links,omitempty"`
+	DroppedLinksCount      int            `json:"droppedLinksCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	TraceState string         `json:"traceState,omitempty"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// otlpStatus codes differ from codes.Code: 0 is unset, 1 ok and 2 error
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+// encodeSpans groups spans by their resource and instrumentation scope, keeping their order
+func encodeSpans(spans []sdktrace.ReadOnlySpan) otlpRequest {
+	var request otlpRequest
+	resources := make(map[*resource.Resource]int)
+	scopes := make(map[*resource.Resource]map[instrumentation.Scope]int)
+	for _, span := range spans {
+		res := span.Resource()
+		r, ok := resources[res]
+		if !ok {
+			r = len(request.ResourceSpans)
+			resources[res] = r
+			scopes[res] = make(map[instrumentation.Scope]int)
+			request.ResourceSpans = append(request.ResourceSpans, otlpResourceSpans{
+				Resource:  otlpResource{Attributes: encodeAttributes(res.Attributes())},
+				SchemaURL: res.SchemaURL(),
+			})
+		}
+		scope := span.InstrumentationScope()
+		s, ok := scopes[res][scope]
+		if !ok {
+			s = len(request.ResourceSpans[r].ScopeSpans)
+			scopes[res][scope] = s
+			request.ResourceSpans[r].ScopeSpans = append(request.ResourceSpans[r].ScopeSpans, otlpScopeSpans{
+				Scope:     otlpScope{Name: scope.Name, Version: scope.Version},
+				SchemaURL: scope.SchemaURL,
+			})
+		}
+		scopeSpans := &request.ResourceSpans[r].ScopeSpans[s]
+		scopeSpans.Spans = append(scopeSpans.Spans, encodeSpan(span))
+	}
+	return request
+}
+
+func encodeSpan(span sdktrace.ReadOnlySpan) otlpSpan {
+	sc := span.SpanContext()
+	encoded := otlpSpan{
+		TraceID:                sc.TraceID().String(),
+		SpanID:                 sc.SpanID().String(),
+		TraceState:             sc.TraceState().String(),
+		Name:                   span.Name(),
+		Kind:                   int(span.SpanKind()), // trace.SpanKind shares the values of OTLP
+		StartTimeUnixNano:      unixNano(span.StartTime()),
+		EndTimeUnixNano:        unixNano(span.EndTime()),
+		Attributes:             encodeAttributes(span.Attributes()),
+		DroppedAttributesCount: span.DroppedAttributes(),
+		DroppedEventsCount:     span.DroppedEvents(),
+		DroppedLinksCount:      span.DroppedLinks(),
+		Status:                 encodeStatus(span.Status()),
+	}
+	if parent := span.Parent(); parent.SpanID().IsValid() {
+		encoded.ParentSpanID = parent.SpanID().String()
+	}
+	for _, event := range span.Events() {
+		encoded.Events = append(encoded.Events, otlpEvent{
+			TimeUnixNano: unixNano(event.Time),
+			Name:         event.Name,
+			Attributes:   encodeAttributes(event.Attributes),
+		})
+	}
+	for _, link := range span.Links() {
+		encoded.Links = append(encoded.Links, otlpLink{
+			TraceID:    link.SpanContext.TraceID().String(),
+			SpanID:     link.SpanContext.SpanID().String(),
+			TraceState: link.SpanContext.TraceState().String(),
+			Attributes: encodeAttributes(link.Attributes),
+		})
+	}
+	return encoded
+}
+
+func encodeStatus(status sdktrace.Status) otlpStatus {
+	switch status.Code {
+	case codes.Ok:
+		return otlpStatus{Code: 1}
+	case codes.Error:
+		return otlpStatus{Code: 2, Message: status.Description}
+	default:
+		return otlpStatus{}
+	}
+}
+
+func encodeAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	encoded := make([]otlpKeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		encoded = append(encoded, otlpKeyValue{Key: string(kv.Key), Value: encodeValue(kv.Value)})
+	}
+	return encoded
+}
+
+func encodeValue(value attribute.Value) otlpValue {
+	switch value.Type() {
+	case attribute.BOOL:
+		b := value.AsBool()
+		return otlpValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(value.AsInt64(), 10)
+		return otlpValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := value.AsFloat64()
+		return otlpValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		return arrayValue(value.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return arrayValue(value.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return arrayValue(value.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return arrayValue(value.AsStringSlice(), attribute.StringValue)
+	default:
+		s := value.Emit()
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func arrayValue[T any](values []T, convert func(T) attribute.Value) otlpValue {
+	array := &otlpArrayValue{Values: make([]otlpValue, 0, len(values))}
+	for _, v := range values {
+		array.Values = append(array.Values, encodeValue(convert(v)))
+	}
+	return otlpValue{ArrayValue: array}
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,136 @@
+// Package telemetry lets the scanner, the generator, the verifier and the trust sources report traces of a run
+// without depending on a tracing library: they accept a Tracer, Noop unless set. Package opentelemetry adapts
+// OpenTelemetry to it, it is the only package depending on the OpenTelemetry SDK.
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attribute keys recorded on spans
+const (
+	// KeyPath is the path of a directory relative to the root of the tree, "." for the root
+	KeyPath = "bytecheck.directory.path"
+	// KeyCached is true for directories whose fresh manifest was reused instead of scanning them
+	KeyCached = "bytecheck.directory.cached"
+	// KeyBytesHashed is the number of bytes read and hashed
+	KeyBytesHashed = "bytecheck.bytes_hashed"
+	// KeyBytesCovered is the number of bytes of the files covered, hashed or whose checksums were reused
+	KeyBytesCovered = "bytecheck.bytes_covered"
+	// KeyCacheHitRatio is the share of the bytes covered whose checksums were reused, see scanner.Stats.CacheHitRatio
+	KeyCacheHitRatio = "bytecheck.cache_hit_ratio"
+	// KeyOutcome is the outcome of the verification of a directory or of a whole tree, see the Outcome constants
+	KeyOutcome = "bytecheck.verification.outcome"
+	// KeyManifestWritten is true for directories whose manifest was written by generate
+	KeyManifestWritten = "bytecheck.manifest.written"
+	// KeyReference is the issuer reference whose keys are fetched, e.g. "github:alice"
+	KeyReference = "bytecheck.issuer.reference"
+	// KeyStatusCode is the HTTP status code of a response
+	KeyStatusCode = "http.response.status_code"
+	// KeyServerAddress is the host of an HTTP request
+	KeyServerAddress = "server.address"
+	// KeyURLPath is the path of the URL of an HTTP request, its query is not recorded
+	KeyURLPath = "url.path"
+)
+
+// Verification outcomes recorded under KeyOutcome
+const (
+	OutcomeValid     = "valid"
+	OutcomeInvalid   = "invalid"
+	OutcomeShallow   = "shallow"
+	OutcomeUnmanaged = "unmanaged"
+	OutcomeError     = "error"
+)
+
+// Attribute is a key-value pair recorded on a span. Value is a string, an int64, a float64 or a bool.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 returns an integer attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float64 returns a floating point attribute
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans
+type Tracer interface {
+	// Start starts a span named name at start, now when start is zero, as a child of the span of ctx, or of the
+	// root span of the run when ctx holds none, e.g. for calls made without a context. The returned context
+	// holds the new span.
+	Start(ctx context.Context, name string, start time.Time, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation of a trace started by a Tracer
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError records err and marks the span as failed
+	RecordError(err error)
+	// End ends the span now, nothing may be recorded afterwards
+	End()
+}
+
+// Noop is the Tracer used unless one is set, its spans record nothing
+var Noop Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ time.Time, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// Directory collects the attributes of the span of a directory while it is processed. The span is only started
+// once the directory is complete, when it took long enough, so the code processing the directory cannot hold it,
+// it records its attributes with Annotate instead.
+type Directory struct {
+	mu    sync.Mutex
+	attrs []Attribute
+}
+
+type directoryKey struct{}
+
+// WithDirectory returns a context whose Annotate calls are collected by the returned Directory
+func WithDirectory(ctx context.Context) (context.Context, *Directory) {
+	d := &Directory{}
+	return context.WithValue(ctx, directoryKey{}, d), d
+}
+
+// Annotate records attrs on the span of the directory processed with ctx, see WithDirectory. It does nothing
+// when no directory is traced.
+func Annotate(ctx context.Context, attrs ...Attribute) {
+	if d, ok := ctx.Value(directoryKey{}).(*Directory); ok {
+		d.mu.Lock()
+		d.attrs = append(d.attrs, attrs...)
+		d.mu.Unlock()
+	}
+}
+
+// Attributes returns the attributes recorded so far, in the order of the Annotate calls
+func (d *Directory) Attributes() []Attribute {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Attribute(nil), d.attrs...)
+}
@@ -2,12 +2,24 @@ package traverse
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 )
 
+// DefaultBatchSize is the number of directory entries read at a time, see ReadDirBatches
+const DefaultBatchSize = 1024
+
+// SkipDir can be returned by a WalkFunc to leave a directory out of the traversal,
+// for example because it vanished after its parent was listed. The traversal
+// continues with the remaining siblings. Returned for the root, it ends the walk without an error.
+var SkipDir = errors.New("skip this directory")
+
 // WalkFunc is the type of the function called by Walk for each directory.
 // The path argument contains the directory being visited.
 // The entities argument contains the scanned entities in that directory.
@@ -16,9 +28,116 @@ import (
 // If the function returns a non-nil error, Walk stops and returns that error.
 type WalkFunc func(ctx context.Context, dirPath string, err error) error
 
+// PruneFunc reports whether the subdirectory dirPath and everything below it must be left out
+// of a traversal. Pruned directories are neither read nor passed to the WalkFunc.
+type PruneFunc func(dirPath string) bool
+
 // WalkPostOrder performs a post-order traversal of the directory tree
 func WalkPostOrder(ctx context.Context, dirPath string, walkFn WalkFunc) error {
-	entries, err := os.ReadDir(dirPath)
+	return WalkPostOrderPruned(ctx, dirPath, nil, walkFn)
+}
+
+// WalkPostOrderPruned is like WalkPostOrder but leaves out the subdirectories for which prune
+// returns true. The root is never pruned, prune may be nil.
+func WalkPostOrderPruned(ctx context.Context, dirPath string, prune PruneFunc, walkFn WalkFunc) error {
+	w := walker{fsys: osFS{}, join: filepath.Join, prune: prune, walkFn: walkFn}
+	return w.walk(ctx, dirPath)
+}
+
+// WalkPostOrderFS is like WalkPostOrder but traverses the tree rooted at root in fsys.
+// Paths passed to walkFn are slash-separated fs.FS paths.
+func WalkPostOrderFS(ctx context.Context, fsys fs.FS, root string, walkFn WalkFunc) error {
+	return WalkPostOrderFSPruned(ctx, fsys, root, nil, walkFn)
+}
+
+// WalkPostOrderFSPruned is like WalkPostOrderFS but leaves out the subdirectories for which prune returns true
+func WalkPostOrderFSPruned(ctx context.Context, fsys fs.FS, root string, prune PruneFunc, walkFn WalkFunc) error {
+	w := walker{fsys: fsys, join: path.Join, prune: prune, walkFn: walkFn}
+	return w.walk(ctx, root)
+}
+
+// ReadDirBatches calls fn with the entries of the directory name in fsys, at most n at a time and in
+// directory order rather than sorted, so that directories with millions of entries are never held in memory
+// at once. Directories not implementing fs.ReadDirFile are read whole and passed to fn in batches.
+// An error returned by fn stops the listing and is returned.
+func ReadDirBatches(fsys fs.FS, name string, n int, fn func(entries []fs.DirEntry) error) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dir, ok := f.(fs.ReadDirFile)
+	if !ok {
+		entries, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			return err
+		}
+		for len(entries) > 0 {
+			batch := entries[:min(n, len(entries))]
+			if err := fn(batch); err != nil {
+				return err
+			}
+			entries = entries[len(batch):]
+		}
+		return nil
+	}
+	for {
+		entries, err := dir.ReadDir(n)
+		if len(entries) > 0 {
+			if fnErr := fn(entries); fnErr != nil {
+				return fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// osFS opens OS paths unchanged, unlike os.DirFS it accepts absolute and relative names alike
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) { return os.Open(name) }
+
+// walker holds the file system a traversal reads
+type walker struct {
+	fsys   fs.FS
+	join   func(elem ...string) string
+	prune  PruneFunc
+	walkFn WalkFunc
+}
+
+// subdirectories lists the subdirectories of dirPath, streaming the listing so that
+// the files of large directories are not kept in memory
+func (w *walker) subdirectories(dirPath string) ([]fs.DirEntry, error) {
+	var dirs []fs.DirEntry
+	err := ReadDirBatches(w.fsys, dirPath, DefaultBatchSize, func(entries []fs.DirEntry) error {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, entry)
+			}
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+func (w *walker) walk(ctx context.Context, root string) error {
+	if err := w.walkPostOrder(ctx, root); err != nil && !errors.Is(err, SkipDir) {
+		return err
+	}
+	return nil
+}
+
+func (w *walker) walkPostOrder(ctx context.Context, dirPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	walkFn := w.walkFn
+	entries, err := w.subdirectories(dirPath)
 	if err != nil {
 		// Call walkFn with the error and let it decide how to handle it
 		return walkFn(ctx, dirPath, fmt.Errorf("failed to read directory: %w", err))
@@ -31,11 +150,15 @@ func WalkPostOrder(ctx context.Context, dirPath string, walkFn WalkFunc) error {
 
 	// Recursively process all subdirectories first (post-order)
 	for _, entry := range entries {
-		if entry.IsDir() {
-			childPath := filepath.Join(dirPath, entry.Name())
-			if err := WalkPostOrder(ctx, childPath, walkFn); err != nil {
-				return err
+		childPath := w.join(dirPath, entry.Name())
+		if w.prune != nil && w.prune(childPath) {
+			continue
+		}
+		if err := w.walkPostOrder(ctx, childPath); err != nil {
+			if errors.Is(err, SkipDir) {
+				continue
 			}
+			return err
 		}
 	}
 
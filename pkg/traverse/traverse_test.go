@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 // Helper to create a test directory structure.
@@ -245,3 +247,178 @@ func TestWalkPostOrder_WalkFnStopsTraversal(t *testing.T) {
 	}
 	t.Logf("✓ Traversal stopped as expected: %v", processedDirs)
 }
+
+func TestWalkPostOrder_ChildVanishedAfterListing(t *testing.T) {
+	tempDir := createTestDirStructure(t)
+
+	var processedDirs []string
+	walkFn := func(ctx context.Context, dirPath string, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return SkipDir
+			}
+			return err
+		}
+		relPath, _ := filepath.Rel(tempDir, dirPath)
+		processedDirs = append(processedDirs, relPath)
+		// "b" is already listed in the root, remove it before it is visited
+		if relPath == "a" {
+			return os.RemoveAll(filepath.Join(tempDir, "b"))
+		}
+		return nil
+	}
+
+	if err := WalkPostOrder(context.Background(), tempDir, walkFn); err != nil {
+		t.Fatalf("WalkPostOrder failed: %v", err)
+	}
+	expected := []string{filepath.Join("a", "a1"), filepath.Join("a", "a2"), "a", "c_empty", "."}
+	if strings.Join(processedDirs, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected processed dirs %v, got %v", expected, processedDirs)
+	}
+}
+
+func TestWalkPostOrderFS_CorrectOrder(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a1/file1.txt": {Data: []byte("test")},
+		"a/a2/file2.txt": {Data: []byte("test")},
+		"b/file3.txt":    {Data: []byte("test")},
+		"c_empty":        {Mode: fs.ModeDir | 0755},
+		"root_file.txt":  {Data: []byte("test")},
+	}
+
+	var processedDirs []string
+	err := WalkPostOrderFS(context.Background(), fsys, ".", func(ctx context.Context, dirPath string, err error) error {
+		if err != nil {
+			t.Errorf("walkFn received unexpected error for %s: %v", dirPath, err)
+			return err
+		}
+		processedDirs = append(processedDirs, dirPath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkPostOrderFS failed: %v", err)
+	}
+
+	// fs.FS paths are slash-separated on every platform
+	expectedOrder := []string{"a/a1", "a/a2", "a", "b", "c_empty", "."}
+	if strings.Join(processedDirs, ",") != strings.Join(expectedOrder, ",") {
+		t.Errorf("Expected order %v, got %v", expectedOrder, processedDirs)
+	}
+}
+
+func TestWalkPostOrderFS_Subtree(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a1/file1.txt": {Data: []byte("test")},
+		"b/file3.txt":    {Data: []byte("test")},
+	}
+
+	var processedDirs []string
+	err := WalkPostOrderFS(context.Background(), fsys, "a", func(ctx context.Context, dirPath string, err error) error {
+		processedDirs = append(processedDirs, dirPath)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkPostOrderFS failed: %v", err)
+	}
+	if strings.Join(processedDirs, ",") != "a/a1,a" {
+		t.Errorf("Expected [a/a1 a], got %v", processedDirs)
+	}
+}
+
+func TestWalkPostOrderFSPruned_SkipsPrunedSubtrees(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/a1/file1.txt":   {Data: []byte("test")},
+		"a/a2/file2.txt":   {Data: []byte("test")},
+		"b/b1/file3.txt":   {Data: []byte("test")},
+		"root_file.txt":    {Data: []byte("test")},
+		"c/deeper/d/x.txt": {Data: []byte("test")},
+	}
+
+	var pruneCalls, processedDirs []string
+	prune := func(dirPath string) bool {
+		pruneCalls = append(pruneCalls, dirPath)
+		return dirPath == "a/a2" || dirPath == "c"
+	}
+	err := WalkPostOrderFSPruned(context.Background(), fsys, ".", prune, func(ctx context.Context, dirPath string, err error) error {
+		processedDirs = append(processedDirs, dirPath)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WalkPostOrderFSPruned failed: %v", err)
+	}
+	if strings.Join(processedDirs, ",") != "a/a1,a,b/b1,b,." {
+		t.Errorf("Expected [a/a1 a b/b1 b .], got %v", processedDirs)
+	}
+	// Pruned directories are not read, so nothing below them is offered to prune
+	if strings.Join(pruneCalls, ",") != "a,a/a1,a/a2,b,b/b1,c" {
+		t.Errorf("Unexpected prune calls %v", pruneCalls)
+	}
+}
+
+// wholeDirFS opens directories as files that cannot be read in batches, so they are read with fs.ReadDirFS
+type wholeDirFS struct {
+	fstest.MapFS
+}
+
+func (f wholeDirFS) Open(name string) (fs.File, error) {
+	file, err := f.MapFS.Open(name)
+	return struct{ fs.File }{file}, err
+}
+
+func TestReadDirBatches_PassesEveryEntryInBoundedBatches(t *testing.T) {
+	dir := t.TempDir()
+	mapFS := fstest.MapFS{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mapFS["data/"+name] = &fstest.MapFile{}
+	}
+
+	for name, tc := range map[string]struct {
+		fsys fs.FS
+		dir  string
+	}{
+		"os":    {osFS{}, dir},
+		"fs.FS": {mapFS, "data"},
+		"dirFS": {os.DirFS(dir), "."},
+		"whole": {wholeDirFS{mapFS}, "data"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			seen := map[string]bool{}
+			err := ReadDirBatches(tc.fsys, tc.dir, 3, func(entries []fs.DirEntry) error {
+				if len(entries) == 0 || len(entries) > 3 {
+					t.Errorf("Expected batches of 1 to 3 entries, got %d", len(entries))
+				}
+				for _, entry := range entries {
+					seen[entry.Name()] = true
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ReadDirBatches failed: %v", err)
+			}
+			if len(seen) != 10 {
+				t.Errorf("Expected 10 entries, got %d", len(seen))
+			}
+		})
+	}
+}
+
+func TestReadDirBatches_StopsOnError(t *testing.T) {
+	fsys := fstest.MapFS{"a": {}, "b": {}, "c": {}}
+	stop := errors.New("stop")
+	calls := 0
+	err := ReadDirBatches(fsys, ".", 1, func(entries []fs.DirEntry) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Expected the error of the first batch, got %v after %d call(s)", err, calls)
+	}
+
+	if err := ReadDirBatches(fsys, "missing", 1, nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist for a missing directory, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// ColorMode selects when output is colored
+type ColorMode string
+
+const (
+	// ColorAuto colors output written to a terminal unless NO_COLOR is set
+	ColorAuto   ColorMode = "auto"
+	ColorAlways ColorMode = "always"
+	ColorNever  ColorMode = "never"
+)
+
+// ParseColorMode parses the value of a --color flag
+func ParseColorMode(value string) (ColorMode, error) {
+	switch mode := ColorMode(value); mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid color mode '%s', expected 'always', 'never' or 'auto'", value)
+}
+
+// Palette holds the escape sequences used to color output, all empty for plain output
+type Palette struct {
+	Reset  string
+	Red    string
+	Green  string
+	Yellow string
+	Blue   string
+	Cyan   string
+}
+
+// ColorPalette colors output with ANSI escape sequences
+var ColorPalette = Palette{
+	Reset:  ColorReset,
+	Red:    ColorRed,
+	Green:  ColorGreen,
+	Yellow: ColorYellow,
+	Blue:   ColorBlue,
+	Cyan:   ColorCyan,
+}
+
+// NoColorPalette leaves output uncolored
+var NoColorPalette = Palette{}
+
+// Output is a writer with the palette its output is colored with. The print functions of this
+// package color output written to an Output with its palette, and any other writer only if it is
+// a terminal, as in ColorAuto mode.
+// Writes are serialized, so that progress lines and results printed while an operation runs do not mix.
+type Output struct {
+	io.Writer
+	Palette Palette
+	mu      sync.Mutex
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.Writer.Write(p)
+}
+
+// NewOutput wraps w with the palette selected by mode, in ColorAuto mode output is colored only
+// when w is a terminal and the NO_COLOR environment variable is unset, see https://no-color.org
+func NewOutput(w io.Writer, mode ColorMode) *Output {
+	palette := NoColorPalette
+	if mode == ColorAlways || mode == ColorAuto && colorSupported(w) {
+		palette = ColorPalette
+	}
+	return &Output{Writer: w, Palette: palette}
+}
+
+func colorSupported(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// paletteOf returns the palette output written to w is colored with, the one of ColorAuto mode
+// for writers other than an Output, see NewOutput
+func paletteOf(w io.Writer) Palette {
+	if out, ok := w.(*Output); ok {
+		return out.Palette
+	}
+	if colorSupported(w) {
+		return ColorPalette
+	}
+	return NoColorPalette
+}
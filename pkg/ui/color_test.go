@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOutput_SelectsPalette(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Equal(t, ColorPalette, NewOutput(&buf, ColorAlways).Palette)
+	assert.Equal(t, NoColorPalette, NewOutput(&buf, ColorNever).Palette)
+	// Neither a buffer nor a regular file is a terminal
+	assert.Equal(t, NoColorPalette, NewOutput(&buf, ColorAuto).Palette)
+	file, err := os.CreateTemp(t.TempDir(), "out")
+	assert.NoError(t, err)
+	defer file.Close()
+	assert.Equal(t, NoColorPalette, NewOutput(file, ColorAuto).Palette)
+}
+
+func TestPrintWarning_WithUncoloredOutput_mustPrintPlainText(t *testing.T) {
+	var buf bytes.Buffer
+	PrintWarning(NewOutput(&buf, ColorNever), "%d thing(s)", 2)
+	assert.Equal(t, "warning - 2 thing(s)\n", buf.String())
+
+	// Writers other than an Output are colored only if they are a terminal
+	buf.Reset()
+	PrintWarning(&buf, "%d thing(s)", 2)
+	assert.Equal(t, "warning - 2 thing(s)\n", buf.String())
+
+	buf.Reset()
+	PrintWarning(NewOutput(&buf, ColorAlways), "%d thing(s)", 2)
+	assert.Equal(t, ColorYellow+"warning"+ColorReset+" - 2 thing(s)\n", buf.String())
+}
+
+func TestPrintWriteResult_WithVanishedEntries_mustWarnOnTheGivenWriter(t *testing.T) {
+	var buf bytes.Buffer
+	PrintWriteResult(NewOutput(&buf, ColorNever), 2, 0, 3, nil, "digest", nil)
+	assert.Contains(t, buf.String(), "warning - 3 entry(s) vanished during the scan and were left out of the manifests\n")
+}
+
+func TestParseColorMode(t *testing.T) {
+	mode, err := ParseColorMode("never")
+	assert.NoError(t, err)
+	assert.Equal(t, ColorNever, mode)
+	_, err = ParseColorMode("yes")
+	assert.ErrorContains(t, err, "invalid color mode 'yes'")
+}
@@ -0,0 +1,32 @@
+package ui
+
+import (
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/diff"
+	"io"
+)
+
+// PrintTreeDifferences prints a tree-wide report of differences between two manifest trees
+func PrintTreeDifferences(w io.Writer, report *diff.Report) {
+	p := paletteOf(w)
+	for _, dir := range report.Directories {
+		switch dir.Change {
+		case diff.DirectoryAdded:
+			fmt.Fprintf(w, "%s+ added directory:%s %s\n", p.Yellow, p.Reset, dir.Path)
+		case diff.DirectoryRemoved:
+			fmt.Fprintf(w, "%s- removed directory:%s %s\n", p.Red, p.Reset, dir.Path)
+		default:
+			fmt.Fprintf(w, "%s~ modified directory:%s %s\n", p.Cyan, p.Reset, dir.Path)
+		}
+		PrintEntityDifferences(w, dir.Differences)
+		fmt.Fprintln(w)
+	}
+
+	if !report.HasDifferences() {
+		fmt.Fprintf(w, "%sok%s - no differences between '%s' and '%s'\n", p.Green, p.Reset, report.RootA, report.RootB)
+		return
+	}
+	fmt.Fprintf(w, "%sdifferent%s - %d director%s differ between '%s' and '%s'\n",
+		p.Red, p.Reset, len(report.Directories), Pluralize(len(report.Directories), "y", "ies"),
+		report.RootA, report.RootB)
+}
@@ -0,0 +1,29 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tomekjarosik/bytecheck/pkg/analyze"
+)
+
+// PrintDuplicates prints the sets of duplicate files, largest savings first, and what removing them would save
+func PrintDuplicates(w io.Writer, report *analyze.DuplicateReport) {
+	p := paletteOf(w)
+	for _, set := range report.Sets {
+		fmt.Fprintf(w, "%s%d copies%s of %s, %s%s wasted%s (%s)\n", p.Yellow, len(set.Paths), p.Reset,
+			formatBytes(set.Size), p.Cyan, formatBytes(set.WastedBytes), p.Reset, set.Checksum)
+		for _, path := range set.Paths {
+			fmt.Fprintf(w, "  %s\n", path)
+		}
+		fmt.Fprintln(w)
+	}
+	if len(report.Sets) == 0 {
+		fmt.Fprintf(w, "%sok%s - no duplicates among %d file%s\n", p.Green, p.Reset,
+			report.Files, Pluralize(int(report.Files), "", "s"))
+		return
+	}
+	fmt.Fprintf(w, "%d duplicate set%s, %d of %d file%s, %s wasted\n",
+		len(report.Sets), Pluralize(len(report.Sets), "", "s"), report.DuplicateFiles,
+		report.Files, Pluralize(int(report.Files), "", "s"), formatBytes(report.WastedBytes))
+}
@@ -2,18 +2,106 @@ package ui
 
 import (
 	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"io"
+	"strings"
 )
 
-func PrintWriteResult(w io.Writer, dirsProcessed, dirsCached int64, manifestsGenerated []string) {
+// WriteSummary is the JSON representation of a generate run
+type WriteSummary struct {
+	Directories        int64    `json:"directories"`
+	Cached             int64    `json:"cached"`
+	Vanished           int64    `json:"vanished"`
+	MountpointsSkipped int64    `json:"mountpointsSkipped,omitempty"`
+	DirectoriesTooLong int64    `json:"directoriesTooLong,omitempty"`
+	ManifestsGenerated []string `json:"manifestsGenerated"`
+	RootDigest         string   `json:"rootDigest"`
+	// Subtree holds the totals of the whole tree, it is omitted when they are unknown
+	Subtree *manifest.SubtreeTotals `json:"subtree,omitempty"`
+	// Signatures of existing manifests kept or dropped by an unsigned run
+	SignaturesPreserved   int `json:"signaturesPreserved,omitempty"`
+	SignaturesInvalidated int `json:"signaturesInvalidated,omitempty"`
+	SignaturesStripped    int `json:"signaturesStripped,omitempty"`
+}
+
+// PrintSignatureChanges reports what happened to the signatures of existing manifests, nothing if there were none
+func PrintSignatureChanges(w io.Writer, preserved, invalidated, stripped int) {
+	p := paletteOf(w)
+	if preserved+invalidated+stripped == 0 {
+		return
+	}
+	parts := []string{fmt.Sprintf("%d preserved", preserved)}
+	if invalidated > 0 {
+		parts = append(parts, fmt.Sprintf("%s%d invalidated by changes%s", p.Yellow, invalidated, p.Reset))
+	}
+	if stripped > 0 {
+		parts = append(parts, fmt.Sprintf("%d stripped", stripped))
+	}
+	fmt.Fprintf(w, "existing signatures: %s\n", strings.Join(parts, ", "))
+}
+
+func PrintWriteResult(w io.Writer, dirsProcessed, dirsCached, entriesVanished int64, manifestsGenerated []string, rootDigest string, subtree *manifest.SubtreeTotals) {
 	totalDirectories := dirsProcessed + dirsCached
 
 	if totalDirectories == 0 {
-		PrintWarning("no directories processed")
+		PrintWarning(w, "no directories processed")
 		return
 	}
 	fmt.Fprintf(w, "processed %d directory(s) (%d cached)\n", totalDirectories, dirsCached)
+	if entriesVanished > 0 {
+		PrintWarning(w, "%d entry(s) vanished during the scan and were left out of the manifests", entriesVanished)
+	}
 	for _, m := range manifestsGenerated {
 		fmt.Fprintf(w, "manifest '%s' generated\n", m)
 	}
+	fmt.Fprintf(w, "root digest: %s\n", rootDigest)
+	if subtree != nil {
+		fmt.Fprintf(w, "tree: %s\n", formatSubtree(subtree))
+	}
+}
+
+// PrintSkippedDirectory reports a listed directory that was left out of a regeneration and why
+func PrintSkippedDirectory(w io.Writer, path, reason string) {
+	p := paletteOf(w)
+	fmt.Fprintf(w, "%sskipped%s '%s': %s\n", p.Yellow, p.Reset, path, reason)
+}
+
+// PrintRegenerateResult reports the manifests written for a list of directories and for their ancestors
+func PrintRegenerateResult(w io.Writer, regenerated, ancestorsUpdated []string, skipped int, rootDigest string) {
+	for _, dir := range regenerated {
+		fmt.Fprintf(w, "manifest '%s' regenerated\n", dir)
+	}
+	for _, dir := range ancestorsUpdated {
+		fmt.Fprintf(w, "manifest '%s' updated as ancestor\n", dir)
+	}
+	fmt.Fprintf(w, "regenerated %d directory(s), updated %d ancestor manifest(s), skipped %d path(s)\n",
+		len(regenerated), len(ancestorsUpdated), skipped)
+	if rootDigest != "" {
+		fmt.Fprintf(w, "root digest: %s\n", rootDigest)
+	}
+}
+
+// PrintDryRunResult summarizes what a generate run would do with the manifests of the directories,
+// with verbose listing every directory and the entries that changed in updated ones
+func PrintDryRunResult(w io.Writer, directories []generator.DryRunDirectory, verbose bool) {
+	p := paletteOf(w)
+	counts := make(map[generator.DryRunOutcome]int)
+	for _, dir := range directories {
+		counts[dir.Outcome]++
+		if !verbose {
+			continue
+		}
+		switch dir.Outcome {
+		case generator.DryRunNew:
+			fmt.Fprintf(w, "%s+ new manifest:%s %s\n", p.Yellow, p.Reset, dir.Path)
+		case generator.DryRunUpdated:
+			fmt.Fprintf(w, "%s~ updated manifest:%s %s\n", p.Cyan, p.Reset, dir.Path)
+			PrintEntityDifferences(w, dir.Differences)
+		default:
+			fmt.Fprintf(w, "= unchanged manifest: %s\n", dir.Path)
+		}
+	}
+	fmt.Fprintf(w, "dry run: %d new, %d updated, %d unchanged manifest(s), nothing written\n",
+		counts[generator.DryRunNew], counts[generator.DryRunUpdated], counts[generator.DryRunUnchanged])
 }
@@ -8,7 +8,9 @@ import (
 	"time"
 )
 
-// ProgressMonitor manages both instantaneous and average speed calculations
+// ProgressMonitor manages both instantaneous and average speed calculations. Speeds are hashing throughput,
+// the bytes actually read and hashed, while the coverage rate also counts the bytes whose checksum was cached,
+// so a run mostly served by caches is neither reported as slow nor as absurdly fast.
 type ProgressMonitor struct {
 	recentSamples []speedSample
 	windowSize    time.Duration
@@ -18,7 +20,8 @@ type ProgressMonitor struct {
 
 type speedSample struct {
 	timestamp time.Time
-	bytes     int64
+	hashed    int64
+	covered   int64
 }
 
 // NewProgressMonitor creates a new progress monitor with the specified window size
@@ -35,7 +38,8 @@ func (pm *ProgressMonitor) AddSample(stats *scanner.Stats) {
 
 	sample := speedSample{
 		timestamp: time.Now(),
-		bytes:     stats.BytesProcessed(),
+		hashed:    stats.BytesHashed(),
+		covered:   stats.BytesCovered(),
 	}
 
 	pm.recentSamples = append(pm.recentSamples, sample)
@@ -57,8 +61,18 @@ func (pm *ProgressMonitor) cleanOldSamples() {
 	pm.recentSamples = pm.recentSamples[i:]
 }
 
-// InstantaneousSpeed calculates the speed over the recent window
+// InstantaneousSpeed calculates the hashing throughput over the recent window
 func (pm *ProgressMonitor) InstantaneousSpeed() float64 {
+	return pm.windowRate(func(sample speedSample) int64 { return sample.hashed })
+}
+
+// InstantaneousCoverageRate calculates the coverage rate over the recent window, see AverageCoverageRate
+func (pm *ProgressMonitor) InstantaneousCoverageRate() float64 {
+	return pm.windowRate(func(sample speedSample) int64 { return sample.covered })
+}
+
+// windowRate calculates the bytes per second counted by bytes between the oldest and newest samples
+func (pm *ProgressMonitor) windowRate(bytes func(sample speedSample) int64) float64 {
 	if len(pm.recentSamples) < 2 {
 		return 0
 	}
@@ -71,17 +85,27 @@ func (pm *ProgressMonitor) InstantaneousSpeed() float64 {
 		return 0
 	}
 
-	bytesDiff := newest.bytes - oldest.bytes
+	bytesDiff := bytes(newest) - bytes(oldest)
 	return float64(bytesDiff) / timeDiff
 }
 
-// AverageSpeed calculates the overall average speed
+// AverageSpeed calculates the overall average hashing throughput, from the bytes actually read and hashed
 func (pm *ProgressMonitor) AverageSpeed(stats *scanner.Stats) float64 {
+	return averageRate(stats, stats.BytesHashed())
+}
+
+// AverageCoverageRate calculates the overall average of the bytes covered per second, whether hashed or
+// taken from a cache
+func (pm *ProgressMonitor) AverageCoverageRate(stats *scanner.Stats) float64 {
+	return averageRate(stats, stats.BytesCovered())
+}
+
+func averageRate(stats *scanner.Stats, bytes int64) float64 {
 	elapsed := time.Since(stats.StartTime()).Seconds()
 	if elapsed <= 0 {
 		return 0
 	}
-	return float64(stats.BytesProcessed()) / elapsed
+	return float64(bytes) / elapsed
 }
 
 // Monitor monitors the progress channel and prints updates
@@ -90,11 +114,14 @@ func (pm *ProgressMonitor) Monitor(ctx context.Context, w io.Writer, progressCh
 	defer ticker.Stop()
 
 	var lastStats *scanner.Stats
+	done := ctx.Done()
 
 	for {
 		select {
-		case <-ctx.Done():
-			return
+		case <-done:
+			// Stop printing but keep draining, senders may still report progress until the operation stops
+			ticker.Stop()
+			done = nil
 		case stats, ok := <-progressCh:
 			if !ok {
 				return
@@ -118,12 +145,25 @@ func (pm *ProgressMonitor) MonitorInBackground(ctx context.Context, w io.Writer,
 	}()
 }
 
+// MonitorSource subscribes to source and prints updates until source is closed, see Monitor. A slow writer
+// only delays the progress lines, the snapshots published meanwhile are coalesced.
+func (pm *ProgressMonitor) MonitorSource(ctx context.Context, w io.Writer, source *scanner.ProgressSource) {
+	// The subscription outlives ctx, like the channel of Monitor it ends once the operation stops
+	pm.Monitor(ctx, w, source.Subscribe(context.Background()))
+}
+
+// MonitorSourceInBackground runs MonitorSource in a goroutine, see Wait
+func (pm *ProgressMonitor) MonitorSourceInBackground(ctx context.Context, w io.Writer, source *scanner.ProgressSource) {
+	pm.MonitorInBackground(ctx, w, source.Subscribe(context.Background()))
+}
+
 func (pm *ProgressMonitor) Wait() {
 	<-pm.done
 }
 
 // PrintProgressLine prints a progress line with both instantaneous and average speeds
 func (pm *ProgressMonitor) PrintProgressLine(w io.Writer, stats *scanner.Stats) {
+	p := paletteOf(w)
 	// TODO: elapsed := time.Since(stats.StartTime())
 
 	// Calculate both speeds
@@ -132,35 +172,56 @@ func (pm *ProgressMonitor) PrintProgressLine(w io.Writer, stats *scanner.Stats)
 
 	clearProgressLine(w)
 
-	// Show both speeds: instantaneous (last 3s) and overall average
-	fmt.Fprintf(w, "\r%sprogress:%s %8d files, %4d dirs, %s, speed: %.1f MB/s (avg: %.1f MB/s) - %s",
-		ColorCyan, ColorReset,
+	// Show both hashing speeds: instantaneous (last 3s) and overall average, then the recent coverage rate
+	// Entries listed but not processed yet show the progress of listing large directories
+	fmt.Fprintf(w, "\r%sprogress:%s %8d files, %4d dirs, %d listed, %s hashed, speed: %.1f MB/s (avg: %.1f MB/s), covering: %.1f MB/s%s - %s",
+		p.Cyan, p.Reset,
 		stats.FilesProcessed(),
 		stats.DirsProcessed(),
-		formatBytes(stats.BytesProcessed()),
+		stats.EntriesDiscovered(),
+		formatBytes(stats.BytesHashed()),
 		instantRate/(1024*1024),
 		averageRate/(1024*1024),
+		pm.InstantaneousCoverageRate()/(1024*1024),
+		verificationCounters(p, stats),
 		truncatePath(stats.CurrentFile(), 50))
 }
 
-// PrintFinalLine prints a progress line with both instantaneous and average speeds
+// PrintFinalLine prints the final line with the average hashing throughput, the average coverage rate
+// and the cache hit ratio
 func (pm *ProgressMonitor) PrintFinalLine(w io.Writer, stats *scanner.Stats) {
+	p := paletteOf(w)
 	elapsed := time.Since(stats.StartTime())
 
-	averageRate := pm.AverageSpeed(stats)
-
 	clearProgressLine(w)
 
-	fmt.Fprintf(w, "\r%sfinal:%s %8d files, %4d dirs, %s, speed: %.1f MB/s over %.1f seconds - %s\n",
-		ColorCyan, ColorReset,
+	fmt.Fprintf(w, "\r%sfinal:%s %8d files, %4d dirs, %s hashed at %.1f MB/s, %s covered at %.1f MB/s, cache hits: %.0f%%, over %.1f seconds%s - %s\n",
+		p.Cyan, p.Reset,
 		stats.FilesProcessed(),
 		stats.DirsProcessed(),
-		formatBytes(stats.BytesProcessed()),
-		averageRate/(1024*1024),
+		formatBytes(stats.BytesHashed()),
+		pm.AverageSpeed(stats)/(1024*1024),
+		formatBytes(stats.BytesCovered()),
+		pm.AverageCoverageRate(stats)/(1024*1024),
+		stats.CacheHitRatio()*100,
 		elapsed.Seconds(),
+		verificationCounters(p, stats),
 		truncatePath(stats.CurrentFile(), 50))
 }
 
+// verificationCounters returns the compact segment of manifest counters of a verification in progress,
+// e.g. ", ok:123 fail:2 skip:45", empty when no manifest was verified. Failures are only shown once there are some.
+func verificationCounters(p Palette, stats *scanner.Stats) string {
+	if !stats.HasVerificationCounters() {
+		return ""
+	}
+	failures := ""
+	if invalid := stats.ManifestsInvalid(); invalid > 0 {
+		failures = fmt.Sprintf(" %sfail:%d%s", p.Red, invalid, p.Reset)
+	}
+	return fmt.Sprintf(", ok:%d%s shallow:%d", stats.ManifestsValid(), failures, stats.ManifestsShallow())
+}
+
 func clearProgressLine(w io.Writer) {
 	// Create a string of 120 spaces to overwrite the previous line
 	spaces := make([]byte, 120)
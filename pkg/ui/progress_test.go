@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+func TestPrintProgressLine_WithVerificationCounters_mustShowThem(t *testing.T) {
+	pm := NewProgressMonitor(3 * time.Second)
+	stats := &scanner.Stats{}
+	var buf bytes.Buffer
+
+	pm.PrintProgressLine(NewOutput(&buf, ColorNever), stats)
+	assert.NotContains(t, buf.String(), "ok:", "a scan without verification shows no counters")
+
+	stats.IncreaseManifestsValid()
+	stats.IncreaseManifestsValid()
+	stats.IncreaseManifestsShallow()
+	buf.Reset()
+	pm.PrintProgressLine(NewOutput(&buf, ColorNever), stats)
+	assert.Contains(t, buf.String(), "ok:2 shallow:1")
+	assert.NotContains(t, buf.String(), "fail", "failures are only shown once there are some")
+
+	stats.IncreaseManifestsInvalid()
+	buf.Reset()
+	pm.PrintProgressLine(NewOutput(&buf, ColorNever), stats)
+	assert.Contains(t, buf.String(), "ok:2 fail:1 shallow:1")
+
+	buf.Reset()
+	pm.PrintFinalLine(NewOutput(&buf, ColorAlways), stats)
+	assert.Contains(t, buf.String(), "ok:2 "+ColorRed+"fail:1"+ColorReset+" shallow:1")
+}
+
+func TestProgressMonitor_SeparatesHashingFromCoverage(t *testing.T) {
+	pm := NewProgressMonitor(time.Minute)
+	now := time.Now()
+	// One second in which 1 MB was hashed while 9 MB more were served by caches
+	pm.recentSamples = []speedSample{
+		{timestamp: now.Add(-time.Second), hashed: 0, covered: 0},
+		{timestamp: now, hashed: 1 << 20, covered: 10 << 20},
+	}
+	assert.InDelta(t, float64(1<<20), pm.InstantaneousSpeed(), 1)
+	assert.InDelta(t, float64(10<<20), pm.InstantaneousCoverageRate(), 1)
+
+	stats := &scanner.Stats{}
+	stats.Start(context.Background(), nil, time.Hour)
+	stats.Stop()
+	stats.AddBytesHashed(1 << 20)
+	stats.AddBytesCovered(10 << 20)
+	stats.AddBytesCached(9 << 20)
+	assert.Less(t, pm.AverageSpeed(stats), pm.AverageCoverageRate(stats))
+
+	var buf bytes.Buffer
+	pm.PrintFinalLine(NewOutput(&buf, ColorNever), stats)
+	assert.Contains(t, buf.String(), "1.0 MB hashed at ")
+	assert.Contains(t, buf.String(), "10.0 MB covered at ")
+	assert.Contains(t, buf.String(), "cache hits: 90%")
+}
+
+func TestProgressMonitor_WithoutSamples_mustReportZero(t *testing.T) {
+	pm := NewProgressMonitor(time.Minute)
+	assert.Zero(t, pm.InstantaneousSpeed())
+	assert.Zero(t, pm.InstantaneousCoverageRate())
+	assert.Zero(t, pm.AverageCoverageRate(&scanner.Stats{}), "nothing covered")
+}
+
+func TestProgressMonitor_MonitorSourceInBackground_mustEndWithLatestSnapshot(t *testing.T) {
+	pm := NewProgressMonitor(time.Minute)
+	source := scanner.NewProgressSource()
+	var buf bytes.Buffer
+	pm.MonitorSourceInBackground(context.Background(), NewOutput(&buf, ColorNever), source)
+
+	for i := 1; i <= 100; i++ {
+		stats := &scanner.Stats{}
+		stats.AddBytesHashed(int64(i))
+		source.Publish(stats)
+	}
+	source.Close()
+	pm.Wait()
+
+	assert.Equal(t, int64(100), pm.lastStats.BytesHashed(), "the latest snapshot is received before the monitor ends")
+}
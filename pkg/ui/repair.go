@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+// PrintRepairResult reports the manifests a repair regenerated, or would for a dry run, what the verification
+// before found, and unless after is nil, whether the repaired tree verifies
+func PrintRepairResult(w io.Writer, before, after *verifier.Result, repaired, ancestorsUpdated []string, dryRun bool) {
+	repairedVerb, ancestorVerb := "repaired", "updated as ancestor"
+	if dryRun {
+		repairedVerb, ancestorVerb = "would be repaired", "would be updated as ancestor"
+	}
+	for _, dir := range repaired {
+		fmt.Fprintf(w, "manifest '%s' %s\n", dir, repairedVerb)
+	}
+	for _, dir := range ancestorsUpdated {
+		fmt.Fprintf(w, "manifest '%s' %s\n", dir, ancestorVerb)
+	}
+
+	summary := before.Summary()
+	fmt.Fprintf(w, "before: %d invalid and %d missing manifest(s) in %d directory(s)\n",
+		summary.Invalid, summary.Unmanaged, len(before.DirectoryStatuses))
+	if len(repaired) == 0 {
+		PrintSuccess(w, "nothing to repair")
+		return
+	}
+	if dryRun {
+		fmt.Fprintf(w, "would repair %d directory(s) and update %d ancestor manifest(s)\n",
+			len(repaired), len(ancestorsUpdated))
+		return
+	}
+	fmt.Fprintf(w, "repaired %d directory(s), updated %d ancestor manifest(s)\n", len(repaired), len(ancestorsUpdated))
+	if after == nil {
+		return
+	}
+	if summary := after.Summary(); summary.Invalid+summary.Unmanaged > 0 {
+		PrintError(w, "after: %d invalid and %d missing manifest(s) remain", summary.Invalid, summary.Unmanaged)
+		return
+	}
+	PrintSuccess(w, "after: all %d manifest(s) verified", after.Summary().Verified)
+}
@@ -0,0 +1,340 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+// DefaultExportName is the report file the selected subtree is exported to, see Browser.ExportPath
+const DefaultExportName = "bytecheck-selection.jsonl"
+
+// help lists the keys of the browser, shown on the last line
+const help = "↑/↓ move  enter expand  f failures only  c copy path  e export  q quit"
+
+// Browser is the view model of the verification browser: a Tree, the selected row and the filter.
+// Statuses are added with Add, from any goroutine, while the terminal loop renders and handles keys, see Run.
+type Browser struct {
+	// ExportPath is the report file the selected subtree is written to, see verifier.ReportWriter.
+	// An existing file is only overwritten when the export is confirmed by pressing the key again.
+	ExportPath string
+	// Clipboard copies text to the clipboard of the terminal, Run sets it when nil
+	Clipboard func(text string) error
+	// Palette colors the statuses, ui.ColorPalette by default
+	Palette ui.Palette
+
+	mu           sync.Mutex
+	root         string
+	tree         *Tree
+	failuresOnly bool
+	cursor       int
+	selected     Row
+	verified     int
+	finished     string
+	message      string
+	version      int
+	// confirmExport is the directory whose export to the existing ExportPath awaits confirmation
+	confirmExport *Node
+}
+
+// NewBrowser returns a browser of the verification of root
+func NewBrowser(root string) *Browser {
+	tree := NewTree()
+	return &Browser{
+		ExportPath: DefaultExportName,
+		Palette:    ui.ColorPalette,
+		root:       root,
+		tree:       tree,
+		selected:   Row{Node: tree.Root(), Difference: -1},
+	}
+}
+
+// Add records the status of a verified directory, it is the status sink of the verification, see
+// verifier.WithStatusSink. Failed directories are expanded with their ancestors to show their differences.
+func (b *Browser) Add(status verifier.DirectoryVerificationStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	node := b.tree.Add(status)
+	if node.Status == StatusInvalid {
+		for n := node.parent; n != nil; n = n.parent {
+			n.Expanded = true
+		}
+	}
+	b.verified++
+	b.version++
+}
+
+// Finish records the end of the verification, summarized by result, or err when it failed
+func (b *Browser) Finish(result *verifier.Result, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case result != nil && result.Interrupted:
+		b.finished = "interrupted"
+	case result != nil:
+		s := result.Summary()
+		b.finished = fmt.Sprintf("done: %d verified, %d invalid, %d unmanaged", s.Verified, s.Invalid, s.Unmanaged)
+	case err != nil:
+		b.finished = "failed: " + err.Error()
+	default:
+		b.finished = "done"
+	}
+	b.version++
+}
+
+// Version changes whenever the browser needs to be rendered again
+func (b *Browser) Version() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.version
+}
+
+// Selected returns the selected row
+func (b *Browser) Selected() Row {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows()
+	return b.selected
+}
+
+// Rows returns the rows shown with the current filter
+func (b *Browser) Rows() []Row {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rows()
+}
+
+// rows flattens the tree and moves the cursor to the selected row, or keeps its position when the row
+// is no longer shown
+func (b *Browser) rows() []Row {
+	rows := b.tree.Rows(b.failuresOnly)
+	for i, row := range rows {
+		if row == b.selected {
+			b.cursor = i
+			return rows
+		}
+	}
+	b.cursor = max(0, min(b.cursor, len(rows)-1))
+	b.selected = rows[b.cursor]
+	return rows
+}
+
+// HandleKey applies a key decoded by the terminal loop, it returns true when the browser should be closed
+func (b *Browser) HandleKey(key string) (quit bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rows := b.rows()
+	b.message = ""
+	b.version++
+	node := b.selected.Node
+	confirmExport := b.confirmExport
+	b.confirmExport = nil
+	switch key {
+	case "q", "ctrl+c":
+		return true
+	case "up", "k":
+		b.move(rows, -1)
+	case "down", "j":
+		b.move(rows, 1)
+	case "pgup":
+		b.move(rows, -10)
+	case "pgdown":
+		b.move(rows, 10)
+	case "home", "g":
+		b.move(rows, -len(rows))
+	case "end", "G":
+		b.move(rows, len(rows))
+	case "enter", "space":
+		node.Expanded = !node.Expanded
+		b.selected = Row{Node: node, Difference: -1, Depth: b.selected.Depth - boolToInt(b.selected.Difference >= 0)}
+	case "right", "l":
+		node.Expanded = true
+	case "left", "h":
+		if b.selected.Difference < 0 && node.Expanded {
+			node.Expanded = false
+		} else if b.selected.Difference >= 0 {
+			b.selected = Row{Node: node, Difference: -1, Depth: b.selected.Depth - 1}
+		} else if node.parent != nil {
+			b.selected = Row{Node: node.parent, Difference: -1, Depth: b.selected.Depth - 1}
+		}
+	case "f":
+		b.failuresOnly = !b.failuresOnly
+		b.message = "showing all directories"
+		if b.failuresOnly {
+			b.message = "showing failures only"
+		}
+	case "c":
+		path := b.path(node)
+		if b.Clipboard == nil {
+			b.message = "no clipboard available"
+		} else if err := b.Clipboard(path); err != nil {
+			b.message = "copy failed: " + err.Error()
+		} else {
+			b.message = "copied " + path
+		}
+	case "e":
+		if _, err := os.Stat(b.ExportPath); err == nil && confirmExport != node {
+			b.confirmExport = node
+			b.message = fmt.Sprintf("%s exists, press e again to overwrite it", b.ExportPath)
+		} else if err := b.export(node); err != nil {
+			b.message = "export failed: " + err.Error()
+		} else {
+			b.message = fmt.Sprintf("exported %s to %s", b.path(node), b.ExportPath)
+		}
+	}
+	return false
+}
+
+func (b *Browser) move(rows []Row, delta int) {
+	b.cursor = max(0, min(b.cursor+delta, len(rows)-1))
+	b.selected = rows[b.cursor]
+}
+
+// path returns the path of the directory of node as given to the verification
+func (b *Browser) path(node *Node) string {
+	return filepath.Join(b.root, filepath.FromSlash(node.RelativePath))
+}
+
+// export writes the differences of the verified directories of the subtree of node to ExportPath
+func (b *Browser) export(node *Node) error {
+	statuses := b.tree.Statuses(node)
+	report, err := verifier.CreateReport(b.ExportPath, b.root)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if err := report.WriteDirectory(status); err != nil {
+			_ = report.Finish(nil, err)
+			return err
+		}
+	}
+	return report.Finish(verifier.NewResult(statuses, nil, nil), nil)
+}
+
+// Render draws the browser on a screen of width columns and height lines: a header, the rows around the
+// selected one, and a line with the last message or the keys. Lines end with "\r\n" as the terminal is in raw mode.
+func (b *Browser) Render(w io.Writer, width, height int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := b.Palette
+	rows := b.rows()
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	line := func(s string) {
+		buf.WriteString(truncate(s, width))
+		buf.WriteString("\x1b[K\r\n")
+	}
+
+	state := b.finished
+	if state == "" {
+		state = fmt.Sprintf("verifying... %d %s", b.verified, ui.Pluralize(b.verified, "directory", "directories"))
+	}
+	filter := ""
+	if b.failuresOnly {
+		filter = p.Yellow + " [failures only]" + p.Reset
+	}
+	line(fmt.Sprintf("bytecheck verify %s  %s%s", b.root, state, filter))
+
+	visible := max(1, height-2)
+	first := max(0, min(b.cursor-visible/2, len(rows)-visible))
+	for i := first; i < first+visible; i++ {
+		if i >= len(rows) {
+			line("")
+			continue
+		}
+		text := b.formatRow(rows[i], p)
+		if i == b.cursor {
+			// Reverse video, reapplied after each reset of the colors within the row
+			if p.Reset != "" {
+				text = strings.ReplaceAll(text, p.Reset, p.Reset+"\x1b[7m")
+			}
+			text = "\x1b[7m" + text + "\x1b[27m"
+		}
+		line(text)
+	}
+
+	if b.message != "" {
+		buf.WriteString(truncate(b.message, width))
+	} else {
+		buf.WriteString(truncate(help, width))
+	}
+	buf.WriteString("\x1b[K")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatRow formats a directory with its status colored, or one of its differences as printed by verify
+func (b *Browser) formatRow(row Row, p ui.Palette) string {
+	indent := strings.Repeat("  ", row.Depth)
+	node := row.Node
+	if row.Difference >= 0 {
+		var diff bytes.Buffer
+		ui.PrintEntityDifferences(&ui.Output{Writer: &diff, Palette: p}, node.Verification.Differences[row.Difference:row.Difference+1])
+		first, _, _ := strings.Cut(diff.String(), "\n")
+		return indent + strings.TrimLeft(first, " ")
+	}
+
+	marker := "  "
+	if len(node.children) > 0 || len(node.Verification.Differences) > 0 {
+		marker = "▸ "
+		if node.Expanded {
+			marker = "▾ "
+		}
+	}
+	name := node.Name
+	if node.parent == nil {
+		name = "<root>"
+	}
+	color := ""
+	switch node.Status {
+	case StatusOK:
+		color = p.Green
+	case StatusInvalid:
+		color = p.Red
+	case StatusSkipped:
+		color = p.Cyan
+	case StatusUnmanaged:
+		color = p.Yellow
+	}
+	text := fmt.Sprintf("%s%s%s %s%s%s", indent, marker, name, color, node.Status, p.Reset)
+	if node.Verification.ManifestError != nil {
+		text += ": " + node.Verification.ManifestError.Error()
+	} else if n := len(node.Verification.Differences); n > 0 {
+		text += fmt.Sprintf(" (%d %s)", n, ui.Pluralize(n, "difference", "differences"))
+	}
+	if below := node.failures - boolToInt(node.Status == StatusInvalid); below > 0 && !node.Expanded {
+		text += fmt.Sprintf(", %s%d invalid below%s", p.Red, below, p.Reset)
+	}
+	return text
+}
+
+// truncate cuts s to width visible characters, escape sequences are kept and do not count
+func truncate(s string, width int) string {
+	var out strings.Builder
+	visible := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			end := strings.IndexAny(s[i+1:], "mK")
+			if end >= 0 {
+				out.WriteString(s[i : i+end+2])
+				i += end + 2
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if visible < width {
+			out.WriteRune(r)
+		}
+		visible++
+		i += size
+	}
+	return out.String()
+}
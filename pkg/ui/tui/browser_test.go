@@ -0,0 +1,174 @@
+package tui
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/ui"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+func newTestBrowser(t *testing.T) *Browser {
+	b := NewBrowser("/data")
+	b.ExportPath = filepath.Join(t.TempDir(), "selection.jsonl")
+	b.Add(verified("a/bad", false, manifest.EntityDifference{Name: "f1", Type: manifest.DiffMissingInB,
+		ExpectedEntity: &manifest.Entity{Name: "f1"}}))
+	b.Add(verified("a/good", true))
+	b.Add(verified("a", true))
+	b.Add(verified("z", true))
+	b.Add(verified(".", true))
+	return b
+}
+
+func TestBrowser_FailuresAreExpanded(t *testing.T) {
+	b := newTestBrowser(t)
+	assert.Equal(t, []string{".", "a", "a/bad", "a/good", "z"}, paths(b.Rows()))
+}
+
+func TestBrowser_HandleKey(t *testing.T) {
+	b := newTestBrowser(t)
+	for _, key := range []string{"down", "down", "enter"} {
+		assert.False(t, b.HandleKey(key))
+	}
+	assert.Equal(t, "a/bad", b.Selected().Node.RelativePath)
+	assert.Equal(t, []string{".", "a", "a/bad", "+f1", "a/good", "z"}, paths(b.Rows()))
+
+	b.HandleKey("j")
+	assert.Equal(t, 0, b.Selected().Difference)
+	b.HandleKey("left")
+	assert.Equal(t, "a/bad", b.Selected().Node.RelativePath)
+	assert.Equal(t, -1, b.Selected().Difference)
+	b.HandleKey("left")
+	b.HandleKey("left")
+	assert.Equal(t, "a", b.Selected().Node.RelativePath)
+
+	b.HandleKey("end")
+	assert.Equal(t, "z", b.Selected().Node.RelativePath)
+	b.HandleKey("f")
+	assert.Equal(t, []string{".", "a", "a/bad"}, paths(b.Rows()))
+	// The selected directory was filtered out, the selection moves to the last row shown
+	assert.Equal(t, "a/bad", b.Selected().Node.RelativePath)
+
+	assert.True(t, b.HandleKey("q"))
+}
+
+func TestBrowser_CopyPath(t *testing.T) {
+	b := newTestBrowser(t)
+	var copied string
+	b.Clipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+	b.HandleKey("down")
+	b.HandleKey("c")
+	assert.Equal(t, filepath.Join("/data", "a"), copied)
+}
+
+func TestBrowser_ExportSelection(t *testing.T) {
+	b := newTestBrowser(t)
+	b.HandleKey("down")
+	b.HandleKey("e")
+
+	f, err := os.Open(b.ExportPath)
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := verifier.ParseReport(f)
+	require.NoError(t, err)
+	require.Len(t, report.Differences, 1)
+	assert.Equal(t, "a/bad", report.Differences[0].Directory)
+	require.NotNil(t, report.Summary)
+	assert.Equal(t, 3, report.Summary.Found)
+	assert.Equal(t, 1, report.Summary.Invalid)
+}
+
+func TestBrowser_Render(t *testing.T) {
+	b := newTestBrowser(t)
+	b.HandleKey("down")
+	var buf bytes.Buffer
+	require.NoError(t, b.Render(&buf, 80, 8))
+
+	screen := stripEscapes(buf.String())
+	lines := strings.Split(screen, "\r\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, "bytecheck verify /data  verifying... 5 directories", lines[0])
+	assert.Equal(t, "▾ <root> ok", lines[1])
+	assert.Equal(t, "  ▾ a ok", lines[2])
+	assert.Equal(t, "    ▸ bad invalid (1 difference)", lines[3])
+	assert.Equal(t, "      good ok", lines[4])
+	assert.Equal(t, "    z ok", lines[5])
+	assert.Equal(t, "", lines[6])
+	assert.Equal(t, help, lines[7])
+	assert.Contains(t, buf.String(), "\x1b[7m  ▾ a", "the selected row is highlighted")
+
+	b.Finish(verifier.NewResult(nil, nil, nil), nil)
+	buf.Reset()
+	require.NoError(t, b.Render(&buf, 20, 8))
+	assert.Equal(t, "bytecheck verify /da", strings.Split(stripEscapes(buf.String()), "\r\n")[0])
+}
+
+func stripEscapes(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' {
+			end := strings.IndexAny(s[i+1:], "mKH")
+			i += end + 1
+			continue
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+func TestDecodeKeys(t *testing.T) {
+	keys := decodeKeys([]byte("j\x1b[A\x1b[B\r \x03\x1b[6~\x1b[99;5uq\x1b"))
+	assert.Equal(t, []string{"j", "up", "down", "enter", "space", "ctrl+c", "pgdown", "q", "esc"}, keys)
+}
+
+func TestBrowser_ExportSelection_AsksBeforeOverwriting(t *testing.T) {
+	b := newTestBrowser(t)
+	require.NoError(t, os.WriteFile(b.ExportPath, []byte("keep"), 0o644))
+	b.HandleKey("down")
+	b.HandleKey("e")
+
+	data, err := os.ReadFile(b.ExportPath)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+	var buf bytes.Buffer
+	require.NoError(t, b.Render(&buf, 200, 8))
+	assert.Contains(t, buf.String(), "exists, press e again to overwrite it")
+
+	// Any other key cancels the export
+	b.HandleKey("j")
+	b.HandleKey("k")
+	b.HandleKey("e")
+	data, err = os.ReadFile(b.ExportPath)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+
+	b.HandleKey("e")
+	f, err := os.Open(b.ExportPath)
+	require.NoError(t, err)
+	defer f.Close()
+	report, err := verifier.ParseReport(f)
+	require.NoError(t, err)
+	assert.Len(t, report.Differences, 1)
+}
+
+func TestBrowser_Render_WithoutColors(t *testing.T) {
+	b := newTestBrowser(t)
+	b.Palette = ui.NoColorPalette
+	b.HandleKey("down")
+	var buf bytes.Buffer
+	require.NoError(t, b.Render(&buf, 80, 8))
+
+	for _, color := range []string{ui.ColorRed, ui.ColorGreen, ui.ColorYellow, ui.ColorReset} {
+		assert.NotContains(t, buf.String(), color)
+	}
+	assert.Contains(t, buf.String(), "\x1b[7m  ▾ a ok\x1b[27m", "the selected row is still highlighted")
+}
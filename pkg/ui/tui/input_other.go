@@ -0,0 +1,13 @@
+//go:build !unix
+
+package tui
+
+import (
+	"os"
+	"time"
+)
+
+// waitReadable cannot wait for input on this platform, the next read blocks until a key is pressed
+func waitReadable(f *os.File, timeout time.Duration) (bool, error) {
+	return true, nil
+}
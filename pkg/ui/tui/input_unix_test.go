@@ -0,0 +1,39 @@
+//go:build unix
+
+package tui
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadKeys_StopsWhenDone(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer r.Close()
+	defer w.Close()
+	keys := make(chan string)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		readKeys(r, keys, done)
+	}()
+
+	_, err = w.Write([]byte("j"))
+	require.NoError(t, err)
+	assert.Equal(t, "j", <-keys)
+	close(done)
+	<-stopped
+
+	// Input after the browser was closed is left for the caller
+	_, err = w.Write([]byte("q"))
+	require.NoError(t, err)
+	buf := make([]byte, 1)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "q", string(buf))
+}
@@ -0,0 +1,156 @@
+package tui
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// redrawInterval is how often the screen is redrawn when statuses were added or the terminal was resized
+const redrawInterval = 100 * time.Millisecond
+
+// keyPollInterval is how often reading keys checks whether the browser was closed
+const keyPollInterval = 50 * time.Millisecond
+
+// IsTerminal reports whether f is a terminal the browser can run in
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// Run shows the browser on the terminal out, reading keys from in, until the user quits or ctx is done.
+// The terminal is switched to raw mode and to the alternate screen, both are restored on return.
+func Run(ctx context.Context, in, out *os.File, b *Browser) error {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %w", err)
+	}
+	defer func() { _ = term.Restore(int(in.Fd()), state) }()
+	// Alternate screen without cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	if b.Clipboard == nil {
+		b.Clipboard = func(text string) error {
+			// OSC 52 asks the terminal to set its clipboard, it also works over SSH
+			_, err := fmt.Fprintf(out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+			return err
+		}
+	}
+
+	// Keys are no longer read once Run returns, the terminal belongs to the caller again
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	keys := make(chan string)
+	go func() {
+		defer close(stopped)
+		readKeys(in, keys, done)
+	}()
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	drawn, width, height := -1, 0, 0
+	for {
+		w, h, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			w, h = 80, 24
+		}
+		if version := b.Version(); version != drawn || w != width || h != height {
+			if err := b.Render(out, w, h); err != nil {
+				return err
+			}
+			drawn, width, height = version, w, h
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok || b.HandleKey(key) {
+				return nil
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// readKeys decodes the keys read from in until it fails or done is closed, then closes keys
+func readKeys(in *os.File, keys chan<- string, done <-chan struct{}) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		ready, err := waitReadable(in, keyPollInterval)
+		if err != nil {
+			return
+		}
+		if !ready {
+			continue
+		}
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			select {
+			case keys <- key:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// escapeKeys names the escape sequences of the keys the browser handles
+var escapeKeys = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdown",
+	"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+}
+
+// decodeKeys splits the input of a terminal in raw mode into keys: "up", "enter" or "ctrl+c" for special
+// keys, the character itself otherwise. Unknown escape sequences are dropped.
+func decodeKeys(input []byte) []string {
+	var keys []string
+	for len(input) > 0 {
+		switch c := input[0]; {
+		case c == 0x1b:
+			n := 1
+			if len(input) > 1 && (input[1] == '[' || input[1] == 'O') {
+				// CSI and SS3 sequences end with their first letter or '~'
+				n = 2
+				for n < len(input) && !(input[n] >= 0x40 && input[n] <= 0x7e) {
+					n++
+				}
+				n = min(n+1, len(input))
+			}
+			if key, ok := escapeKeys[string(input[:n])]; ok {
+				keys = append(keys, key)
+			} else if n == 1 {
+				keys = append(keys, "esc")
+			}
+			input = input[n:]
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, "enter")
+		case c == ' ':
+			keys = append(keys, "space")
+		case c == 0x03:
+			keys = append(keys, "ctrl+c")
+		default:
+			keys = append(keys, string(c))
+		}
+		input = input[1:]
+	}
+	return keys
+}
@@ -0,0 +1,219 @@
+// Package tui is an interactive terminal browser of verification results, see Browser.
+// The tree of directories is built as statuses stream in, see Tree, so results can be browsed while
+// verification is still running.
+package tui
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+// Status is the outcome of the verification of one directory as shown in the tree
+type Status int
+
+const (
+	// StatusPending marks a directory not verified yet, shown because one of its subdirectories was
+	StatusPending Status = iota
+	// StatusOK marks a directory matching its manifest
+	StatusOK
+	// StatusSkipped marks a directory whose manifest was reused without hashing its files, see
+	// verifier.ManifestVerificationStatus.Shallow
+	StatusSkipped
+	// StatusUnmanaged marks a directory without a manifest
+	StatusUnmanaged
+	// StatusInvalid marks a directory differing from its manifest, or with an unreadable manifest
+	StatusInvalid
+)
+
+// String returns the label of the status shown in the tree
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusSkipped:
+		return "skipped"
+	case StatusUnmanaged:
+		return "unmanaged"
+	case StatusInvalid:
+		return "invalid"
+	default:
+		return "pending"
+	}
+}
+
+// statusOf maps a verified directory to its Status
+func statusOf(status verifier.DirectoryVerificationStatus) Status {
+	switch ms := status.ManifestStatus; {
+	case status.ManifestError != nil:
+		return StatusInvalid
+	case !ms.Found:
+		return StatusUnmanaged
+	case !ms.Valid:
+		return StatusInvalid
+	case ms.Shallow:
+		return StatusSkipped
+	default:
+		return StatusOK
+	}
+}
+
+// Node is a directory of the Tree
+type Node struct {
+	// Name is the base name of the directory, "." for the root
+	Name string
+	// RelativePath is the path of the directory relative to the verified root, as in
+	// verifier.DirectoryVerificationStatus
+	RelativePath string
+	Status       Status
+	// Verification is the status the directory was verified with, the zero value while StatusPending
+	Verification verifier.DirectoryVerificationStatus
+	Expanded     bool
+
+	parent   *Node
+	children []*Node
+	// failures counts the invalid directories of the subtree, the node included
+	failures int
+}
+
+// Children returns the subdirectories of the node sorted by name
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// Parent returns the directory containing the node, nil for the root
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+// Failures returns the number of invalid directories of the subtree of the node, the node included
+func (n *Node) Failures() int {
+	return n.failures
+}
+
+// Tree holds verified directories by their path relative to the verified root.
+// Statuses may arrive in any order, directories not verified yet are added as StatusPending
+// so that their subdirectories can be shown.
+type Tree struct {
+	root  *Node
+	nodes map[string]*Node
+}
+
+// NewTree returns a tree holding only its root, expanded
+func NewTree() *Tree {
+	root := &Node{Name: ".", RelativePath: ".", Expanded: true}
+	return &Tree{root: root, nodes: map[string]*Node{".": root}}
+}
+
+// Root returns the node of the verified root
+func (t *Tree) Root() *Node {
+	return t.root
+}
+
+// Node returns the node of the directory at relativePath, nil if neither it nor its subdirectories were added
+func (t *Tree) Node(relativePath string) *Node {
+	return t.nodes[normalize(relativePath)]
+}
+
+// Add records the status of a verified directory, replacing a previous status of the same directory
+func (t *Tree) Add(status verifier.DirectoryVerificationStatus) *Node {
+	node := t.node(normalize(status.RelativePath))
+	failed := statusOf(status) == StatusInvalid
+	if delta := boolToInt(failed) - boolToInt(node.Status == StatusInvalid); delta != 0 {
+		for n := node; n != nil; n = n.parent {
+			n.failures += delta
+		}
+	}
+	node.Status = statusOf(status)
+	node.Verification = status
+	return node
+}
+
+// node returns the node at relativePath, creating it and its missing ancestors as StatusPending
+func (t *Tree) node(relativePath string) *Node {
+	if node, ok := t.nodes[relativePath]; ok {
+		return node
+	}
+	parent := t.node(parentPath(relativePath))
+	node := &Node{Name: path.Base(relativePath), RelativePath: relativePath, parent: parent}
+	i := sort.Search(len(parent.children), func(i int) bool { return parent.children[i].Name >= node.Name })
+	parent.children = append(parent.children, nil)
+	copy(parent.children[i+1:], parent.children[i:])
+	parent.children[i] = node
+	t.nodes[relativePath] = node
+	return node
+}
+
+// Row is a line of the flattened tree, either a directory or, below an expanded one, one of its differences
+type Row struct {
+	Node  *Node
+	Depth int
+	// Difference is the index of the difference of Node.Verification shown by the row, -1 for the directory itself
+	Difference int
+}
+
+// Rows flattens the tree in display order: a directory is followed by its differences and its subdirectories
+// when it is expanded. With failuresOnly only directories with invalid directories in their subtree are listed.
+func (t *Tree) Rows(failuresOnly bool) []Row {
+	var rows []Row
+	var walk func(node *Node, depth int)
+	walk = func(node *Node, depth int) {
+		rows = append(rows, Row{Node: node, Depth: depth, Difference: -1})
+		if !node.Expanded {
+			return
+		}
+		for i := range node.Verification.Differences {
+			rows = append(rows, Row{Node: node, Depth: depth + 1, Difference: i})
+		}
+		for _, child := range node.children {
+			if failuresOnly && child.failures == 0 {
+				continue
+			}
+			walk(child, depth+1)
+		}
+	}
+	walk(t.root, 0)
+	return rows
+}
+
+// Statuses returns the verified directories of the subtree of node, subdirectories before their parents
+// like the verifier reports them
+func (t *Tree) Statuses(node *Node) []verifier.DirectoryVerificationStatus {
+	var statuses []verifier.DirectoryVerificationStatus
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, child := range node.children {
+			walk(child)
+		}
+		if node.Status != StatusPending {
+			statuses = append(statuses, node.Verification)
+		}
+	}
+	walk(node)
+	return statuses
+}
+
+// normalize returns the slash-separated form of a relative path, "." for the root
+func normalize(relativePath string) string {
+	if relativePath == "" {
+		return "."
+	}
+	return filepath.ToSlash(filepath.Clean(relativePath))
+}
+
+func parentPath(relativePath string) string {
+	if i := strings.LastIndex(relativePath, "/"); i >= 0 {
+		return relativePath[:i]
+	}
+	return "."
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package tui
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+func verified(relativePath string, valid bool, differences ...manifest.EntityDifference) verifier.DirectoryVerificationStatus {
+	return verifier.DirectoryVerificationStatus{
+		Path:           "/data/" + relativePath,
+		RelativePath:   relativePath,
+		ManifestStatus: verifier.ManifestVerificationStatus{Found: true, Valid: valid},
+		Differences:    differences,
+	}
+}
+
+// paths returns the relative paths of the rows, with "+i" for the difference i of the directory above
+func paths(rows []Row) []string {
+	var paths []string
+	for _, row := range rows {
+		if row.Difference >= 0 {
+			paths = append(paths, "+"+row.Node.Verification.Differences[row.Difference].Name)
+			continue
+		}
+		paths = append(paths, row.Node.RelativePath)
+	}
+	return paths
+}
+
+func TestTree_AddBuildsPendingParents(t *testing.T) {
+	tree := NewTree()
+	// Statuses arrive subdirectories first, as the verifier reports them
+	tree.Add(verified("a/b/c", true))
+	tree.Add(verified("a/d", true))
+
+	a := tree.Node("a")
+	require.NotNil(t, a)
+	assert.Equal(t, StatusPending, a.Status)
+	assert.Equal(t, StatusPending, tree.Node("a/b").Status)
+	assert.Equal(t, []string{"b", "d"}, []string{a.Children()[0].Name, a.Children()[1].Name})
+	assert.Same(t, tree.Root(), a.Parent())
+
+	tree.Add(verified("a/b", true))
+	tree.Add(verified("a", true))
+	tree.Add(verified(".", true))
+	assert.Equal(t, StatusOK, a.Status)
+	assert.Equal(t, StatusOK, tree.Root().Status)
+	assert.Len(t, tree.Statuses(tree.Root()), 5)
+	assert.Equal(t, []string{"a/b/c", "a/b", "a/d", "a", "."}, statusPaths(tree.Statuses(tree.Root())))
+}
+
+func statusPaths(statuses []verifier.DirectoryVerificationStatus) []string {
+	var paths []string
+	for _, status := range statuses {
+		paths = append(paths, status.RelativePath)
+	}
+	return paths
+}
+
+func TestTree_Statuses(t *testing.T) {
+	tests := []struct {
+		name   string
+		status verifier.DirectoryVerificationStatus
+		want   Status
+	}{
+		{"valid", verified("x", true), StatusOK},
+		{"invalid", verified("x", false), StatusInvalid},
+		{"shallow", verifier.DirectoryVerificationStatus{RelativePath: "x",
+			ManifestStatus: verifier.ManifestVerificationStatus{Found: true, Valid: true, Shallow: true}}, StatusSkipped},
+		{"unmanaged", verifier.DirectoryVerificationStatus{RelativePath: "x"}, StatusUnmanaged},
+		{"manifest error", verifier.DirectoryVerificationStatus{RelativePath: "x",
+			ManifestStatus: verifier.ManifestVerificationStatus{Found: true},
+			ManifestError:  errors.New("bad manifest")}, StatusInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewTree()
+			assert.Equal(t, tt.want, tree.Add(tt.status).Status)
+		})
+	}
+}
+
+func TestTree_FailuresCountSubtree(t *testing.T) {
+	tree := NewTree()
+	tree.Add(verified("a/b", false))
+	tree.Add(verified("a/c", false))
+	tree.Add(verified("a", false))
+	assert.Equal(t, 3, tree.Node("a").Failures())
+	assert.Equal(t, 3, tree.Root().Failures())
+
+	// A directory verified again replaces its previous status
+	tree.Add(verified("a/b", true))
+	assert.Equal(t, 2, tree.Root().Failures())
+	assert.Equal(t, 0, tree.Node("a/b").Failures())
+}
+
+func TestTree_Rows(t *testing.T) {
+	tree := NewTree()
+	tree.Add(verified("a/bad", false, manifest.EntityDifference{Name: "f1", Type: manifest.DiffChecksumMismatch}))
+	tree.Add(verified("a/good", true))
+	tree.Add(verified("a", true))
+	tree.Add(verified("z", true))
+	tree.Add(verified(".", true))
+
+	assert.Equal(t, []string{".", "a", "z"}, paths(tree.Rows(false)), "only the root is expanded")
+
+	tree.Node("a").Expanded = true
+	tree.Node("a/bad").Expanded = true
+	rows := tree.Rows(false)
+	assert.Equal(t, []string{".", "a", "a/bad", "+f1", "a/good", "z"}, paths(rows))
+	assert.Equal(t, []int{0, 1, 2, 3, 2, 1}, depths(rows))
+
+	assert.Equal(t, []string{".", "a", "a/bad", "+f1"}, paths(tree.Rows(true)))
+}
+
+func depths(rows []Row) []int {
+	var depths []int
+	for _, row := range rows {
+		depths = append(depths, row.Depth)
+	}
+	return depths
+}
@@ -65,63 +65,133 @@ func Pluralize(count int, singular, plural string) string {
 	return plural
 }
 
-// PrintSuccess prints a success message with green color
-func PrintSuccess(format string, args ...interface{}) {
-	fmt.Printf("%sok%s - "+format+"\n", append([]interface{}{ColorGreen, ColorReset}, args...)...)
+// PrintSuccess prints a success message to w, colored green unless w is an uncolored Output
+func PrintSuccess(w io.Writer, format string, args ...interface{}) {
+	p := paletteOf(w)
+	fmt.Fprintf(w, "%sok%s - "+format+"\n", append([]interface{}{p.Green, p.Reset}, args...)...)
 }
 
-// PrintWarning prints a warning message with yellow color
-func PrintWarning(format string, args ...interface{}) {
-	fmt.Printf("%swarning%s - "+format+"\n", append([]interface{}{ColorYellow, ColorReset}, args...)...)
+// PrintWarning prints a warning message to w, colored yellow unless w is an uncolored Output
+func PrintWarning(w io.Writer, format string, args ...interface{}) {
+	p := paletteOf(w)
+	fmt.Fprintf(w, "%swarning%s - "+format+"\n", append([]interface{}{p.Yellow, p.Reset}, args...)...)
 }
 
-// PrintError prints an error message with red color
-func PrintError(format string, args ...interface{}) {
-	fmt.Printf("%serror%s - "+format+"\n", append([]interface{}{ColorRed, ColorReset}, args...)...)
+// PrintError prints an error message to w, colored red unless w is an uncolored Output
+func PrintError(w io.Writer, format string, args ...interface{}) {
+	p := paletteOf(w)
+	fmt.Fprintf(w, "%serror%s - "+format+"\n", append([]interface{}{p.Red, p.Reset}, args...)...)
+}
+
+// hiddenChange describes a difference of a hidden entity, see manifest.EntityDifference.Hidden
+func hiddenChange(diff manifest.EntityDifference) string {
+	switch diff.Type {
+	case manifest.DiffMissingInB:
+		return "missing " + entityKind(diff.ExpectedEntity)
+	case manifest.DiffMissingInA:
+		return "extra " + entityKind(diff.ActualEntity)
+	default:
+		return "changed " + entityKind(diff.ExpectedEntity)
+	}
+}
+
+// entityKind describes the type of an entity in difference output, see manifest.Entity.Kind
+func entityKind(entity *manifest.Entity) string {
+	if entity == nil {
+		return "file"
+	}
+	return entity.Kind()
+}
+
+// formatSubtree describes the totals of a tree in human-readable units
+func formatSubtree(totals *manifest.SubtreeTotals) string {
+	return fmt.Sprintf("%d file%s, %d director%s, %s",
+		totals.Files, Pluralize(int(totals.Files), "", "s"),
+		totals.Directories, Pluralize(int(totals.Directories), "y", "ies"),
+		formatBytes(totals.Bytes))
 }
 
 // PrintEntityDifferences prints detailed differences for manifest entities
 func PrintEntityDifferences(w io.Writer, differences []manifest.EntityDifference) {
+	p := paletteOf(w)
 	for _, diff := range differences {
+		if diff.Hidden && diff.Type != manifest.DiffSubtreeMismatch {
+			// Hidden entries are often created by tools browsing the tree, they are only hinted at
+			fmt.Fprintf(w, "  %s. hidden %s:%s %s\n", p.Yellow, hiddenChange(diff), p.Reset, diff.Name)
+			continue
+		}
 		switch diff.Type {
 		case manifest.DiffMissingInB:
-			entityType := "file"
-			if diff.ExpectedEntity != nil && diff.ExpectedEntity.IsDir {
-				entityType = "directory"
-			}
-			fmt.Fprintf(w, "  %s- missing %s:%s %s\n", ColorRed, entityType, ColorReset, diff.Name)
+			fmt.Fprintf(w, "  %s- missing %s:%s %s\n", p.Red, entityKind(diff.ExpectedEntity), p.Reset, diff.Name)
 
 		case manifest.DiffMissingInA:
-			entityType := "file"
-			if diff.ActualEntity != nil && diff.ActualEntity.IsDir {
-				entityType = "directory"
-			}
-			fmt.Fprintf(w, "  %s+ extra %s:%s %s\n", ColorYellow, entityType, ColorReset, diff.Name)
+			fmt.Fprintf(w, "  %s+ extra %s:%s %s\n", p.Yellow, entityKind(diff.ActualEntity), p.Reset, diff.Name)
 
 		case manifest.DiffTypeMismatch:
-			expectedType := "file"
-			actualType := "file"
-			if diff.ExpectedEntity != nil && diff.ExpectedEntity.IsDir {
-				expectedType = "directory"
-			}
-			if diff.ActualEntity != nil && diff.ActualEntity.IsDir {
-				actualType = "directory"
-			}
 			fmt.Fprintf(w, "  %s~ type mismatch:%s %s (expected %s, got %s)\n",
-				ColorCyan, ColorReset, diff.Name, expectedType, actualType)
+				p.Cyan, p.Reset, diff.Name, entityKind(diff.ExpectedEntity), entityKind(diff.ActualEntity))
 
 		case manifest.DiffChecksumMismatch:
-			entityType := "file"
-			if diff.ExpectedEntity != nil && diff.ExpectedEntity.IsDir {
-				entityType = "directory"
-			}
+			entityType := entityKind(diff.ExpectedEntity)
 			fmt.Fprintf(w, "  %s! checksum mismatch:%s %s (%s)\n",
-				ColorCyan, ColorReset, diff.Name, entityType)
+				p.Cyan, p.Reset, diff.Name, entityType)
 
 			if diff.ExpectedEntity != nil && diff.ActualEntity != nil {
+				if diff.ActualEntity.Sampled() {
+					fmt.Fprintf(w, "    expected: %s (sampled)\n", diff.ExpectedEntity.SampleChecksum)
+					fmt.Fprintf(w, "    actual:   %s (sampled)\n", diff.ActualEntity.SampleChecksum)
+					fmt.Fprintf(w, "    %sonly sampled regions were compared, verify without --sampled to check the whole file%s\n",
+						p.Yellow, p.Reset)
+					continue
+				}
 				fmt.Fprintf(w, "    expected: %s\n", diff.ExpectedEntity.Checksum)
 				fmt.Fprintf(w, "    actual:   %s\n", diff.ActualEntity.Checksum)
+				if change := manifest.ContentTypeChange(diff.ExpectedEntity, diff.ActualEntity); change != "" {
+					fmt.Fprintf(w, "    content:  %s\n", change)
+					if manifest.LikelyBitRot(diff.ExpectedEntity, diff.ActualEntity) {
+						fmt.Fprintf(w, "    %slikely bit-rot/truncation%s, restore the file from a copy\n", p.Red, p.Reset)
+					}
+				}
+				if diff.FirstBadChunk != nil {
+					chunking := diff.ExpectedEntity.Chunking
+					fmt.Fprintf(w, "    %s%d chunk(s) differ%s, the first is chunk %d at offset %s (chunks of %s)\n",
+						p.Yellow, diff.BadChunkCount, p.Reset, *diff.FirstBadChunk,
+						formatBytes(chunking.Offset(*diff.FirstBadChunk)), formatBytes(chunking.ChunkSize))
+				}
+			}
+
+		case manifest.DiffSizeMismatch:
+			fmt.Fprintf(w, "  %s! size mismatch:%s %s (%s -> %s, not hashed)\n",
+				p.Cyan, p.Reset, diff.Name, formatBytes(*diff.ExpectedEntity.Size), formatBytes(*diff.ActualEntity.Size))
+
+		case manifest.DiffSubtreeMismatch:
+			if diff.ExpectedSubtree == nil || diff.ActualSubtree == nil {
+				continue
 			}
+			expected, actual := *diff.ExpectedSubtree, *diff.ActualSubtree
+			fmt.Fprintf(w, "  %s! subtree size changed:%s %s -> %s (%d -> %d files, %d -> %d directories)\n",
+				p.Cyan, p.Reset, formatBytes(expected.Bytes), formatBytes(actual.Bytes),
+				expected.Files, actual.Files, expected.Directories, actual.Directories)
+
+		case manifest.DiffPermissionMismatch:
+			if diff.ExpectedEntity == nil || diff.ActualEntity == nil {
+				continue
+			}
+			expected, actual := *diff.ExpectedEntity, *diff.ActualEntity
+			if manifest.ModeChanged(expected, actual) {
+				fmt.Fprintf(w, "  %s! mode changed:%s %s: %04o -> %04o\n",
+					p.Cyan, p.Reset, diff.Name, *expected.Mode, *actual.Mode)
+			}
+			if manifest.OwnerChanged(expected, actual) {
+				fmt.Fprintf(w, "  %s! owner changed:%s %s: %d:%d -> %d:%d\n",
+					p.Cyan, p.Reset, diff.Name, *expected.UID, *expected.GID, *actual.UID, *actual.GID)
+			}
+
+		case manifest.DiffXattrMismatch:
+			fmt.Fprintf(w, "  %s! extended attributes changed:%s %s\n", p.Cyan, p.Reset, diff.Name)
+
+		case manifest.DiffHardlinkBroken:
+			fmt.Fprintf(w, "  %s! hard link broken:%s %s is no longer linked to %s\n", p.Cyan, p.Reset, diff.Name, diff.LinkedTo)
 		}
 	}
 }
@@ -1,143 +1,493 @@
 package ui
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
 	"github.com/tomekjarosik/bytecheck/pkg/verifier"
 	"io"
+	"sort"
 	"strings"
+	"time"
 )
 
-// PrintVerificationResult prints the verification result with appropriate colors and detailed differences
-func PrintVerificationResult(w io.Writer, result *verifier.Result) {
-	// Print failures with detailed information
-	allValid := true
-	manifestsFound := 0
-	manifestsVerified := 0
-	manifestsSkipped := 0
+// PrintVerificationResult prints the verification result with appropriate colors and detailed differences.
+// Directories are shown relative to the verified root, "<root>" being the root itself, unless fullPaths is set.
+// Directories failing only as a consequence of failed subdirectories are counted instead of listed unless verbose
+// is set, see verifier.Result.Explain.
+func PrintVerificationResult(w io.Writer, result *verifier.Result, fullPaths, verbose bool) {
+	explanations := result.Explain()
+	collapsed := 0
+	// Print failures with detailed information, grouped under one header per directory
 	for _, status := range result.DirectoryStatuses {
-		if status.ManifestStatus.Found {
-			manifestsFound++
+		if !printDirectoryStatus(w, status, explanations[status.RelativePath], fullPaths, verbose) {
+			collapsed++
 		}
-		if status.ManifestStatus.Skipped {
-			manifestsSkipped++
-			continue
-		}
-		if !status.ManifestStatus.Valid {
-			fmt.Fprintf(w, "%s%s fail%s\n", ColorRed, status.Path, ColorReset)
-			PrintEntityDifferences(w, status.Differences)
-			fmt.Fprintln(w) // Empty line after each failed directory
-			allValid = false
-		}
-		if status.ManifestStatus.Valid {
-			manifestsVerified++
+	}
+	printVerificationSummary(w, result, collapsed)
+}
+
+// VerificationPrinter prints failed directories as soon as they are verified, see verifier.WithStatusSink, and the
+// rest of the result once verification is over, like PrintVerificationResult does
+type VerificationPrinter struct {
+	w                  io.Writer
+	fullPaths, verbose bool
+	failed             map[string]bool
+	collapsed          int
+}
+
+// NewVerificationPrinter creates a VerificationPrinter writing to w, see PrintVerificationResult for fullPaths and
+// verbose. w should be an Output when progress is printed to it at the same time.
+func NewVerificationPrinter(w io.Writer, fullPaths, verbose bool) *VerificationPrinter {
+	return &VerificationPrinter{w: w, fullPaths: fullPaths, verbose: verbose, failed: make(map[string]bool)}
+}
+
+// PrintDirectory prints status if the directory failed, or passed differing only in hidden entries. Its subdirectories must have been printed before.
+func (vp *VerificationPrinter) PrintDirectory(status verifier.DirectoryVerificationStatus) {
+	if !status.ManifestStatus.Found || status.ManifestStatus.Valid && !status.ManifestStatus.HiddenOnly {
+		return
+	}
+	if !status.ManifestStatus.Valid {
+		vp.failed[status.RelativePath] = true
+	}
+	// The directory is written at once, after clearing a progress line printed in the meantime
+	var buf bytes.Buffer
+	clearProgressLine(&buf)
+	if !printDirectoryStatus(&Output{Writer: &buf, Palette: paletteOf(vp.w)}, status,
+		verifier.ExplainDirectory(status, vp.failed), vp.fullPaths, vp.verbose) {
+		vp.collapsed++
+		return
+	}
+	_, _ = vp.w.Write(buf.Bytes())
+}
+
+// PrintResult prints what PrintVerificationResult prints after the failed directories
+func (vp *VerificationPrinter) PrintResult(result *verifier.Result) {
+	printVerificationSummary(vp.w, result, vp.collapsed)
+}
+
+// printDirectoryStatus prints status if the directory failed, or passed differing only in hidden entries, and returns false if it was left out,
+// failing only as a consequence of failed subdirectories, see PrintVerificationResult
+func printDirectoryStatus(w io.Writer, status verifier.DirectoryVerificationStatus,
+	explanation verifier.DirectoryExplanation, fullPaths, verbose bool) bool {
+	p := paletteOf(w)
+	if !status.ManifestStatus.Found {
+		return true
+	}
+	if status.ManifestError != nil {
+		fmt.Fprintf(w, "%s%s fail%s (invalid manifest)\n", p.Red, displayPath(status, fullPaths), p.Reset)
+		fmt.Fprintf(w, "  %v\n\n", status.ManifestError)
+		return true
+	}
+	if status.ManifestStatus.Valid {
+		if status.ManifestStatus.HiddenOnly {
+			fmt.Fprintf(w, "%s%s ok%s (%d hidden difference%s ignored)\n", p.Yellow, displayPath(status, fullPaths), p.Reset,
+				len(status.Differences), Pluralize(len(status.Differences), "", "s"))
+			printDirectoryDifferences(w, status)
+			fmt.Fprintln(w)
 		}
+		return true
+	}
+	note := ""
+	switch {
+	case explanation.AllDerived() && !verbose:
+		return false
+	case explanation.AllDerived():
+		note = fmt.Sprintf(", %sderived%s", p.Cyan, p.Reset)
+	case status.ManifestStatus.HiddenOnly:
+		note = fmt.Sprintf(", %sonly hidden entries%s", p.Yellow, p.Reset)
+	case explanation.Benign:
+		note = fmt.Sprintf(", %slikely benign%s", p.Yellow, p.Reset)
+	}
+	fmt.Fprintf(w, "%s%s fail%s (%d difference%s%s)\n", p.Red, displayPath(status, fullPaths), p.Reset,
+		len(status.Differences), Pluralize(len(status.Differences), "", "s"), note)
+	if status.GeneratedBy != "" {
+		fmt.Fprintf(w, "  manifest generated by %s\n", status.GeneratedBy)
+	}
+	printDirectoryDifferences(w, status)
+	fmt.Fprintln(w) // Empty line after each failed directory
+	return true
+}
 
+// printDirectoryDifferences prints the differences of status, preceded by the change of its subtree totals
+func printDirectoryDifferences(w io.Writer, status verifier.DirectoryVerificationStatus) {
+	if status.SubtreeChange != nil {
+		PrintEntityDifferences(w, []manifest.EntityDifference{*status.SubtreeChange})
 	}
+	PrintEntityDifferences(w, status.Differences)
+}
 
-	// Print auditor statuses
-	printAuditorStatuses(w, result.AuditorStatuses)
+// printSigningSummary prints the manifests by how far their signatures can be trusted, the buckets failing the
+// verification in red, see verifier.SigningSummary
+func printSigningSummary(w io.Writer, result *verifier.Result) {
+	p := paletteOf(w)
+	signing := result.Signing
+	unverifiable := fmt.Sprintf("%d signed but not verifiable", signing.Unverifiable)
+	switch {
+	case result.UntrustedViolated():
+		unverifiable = p.Red + unverifiable + p.Reset
+	case signing.Unverifiable > 0:
+		unverifiable = p.Yellow + unverifiable + p.Reset
+	}
+	unsigned := fmt.Sprintf("%d unsigned", signing.Unsigned)
+	if result.UnsignedViolated() {
+		unsigned = p.Red + unsigned + p.Reset
+	}
+	fmt.Fprintf(w, "signatures: %d signed & trusted, %s (trust errors/unsupported), %s\n",
+		signing.Trusted, unverifiable, unsigned)
+}
+
+// printVerificationSummary prints the result after its failed directories, collapsed of them being left out
+func printVerificationSummary(w io.Writer, result *verifier.Result, collapsed int) {
+	p := paletteOf(w)
+	if collapsed > 0 {
+		fmt.Fprintf(w, "%s(%d parent manifest%s changed as a consequence, --verbose lists them)%s\n\n",
+			p.Cyan, collapsed, Pluralize(collapsed, "", "s"), p.Reset)
+	}
+
+	if result.Chain != nil {
+		printChain(w, result.Chain)
+	}
+
+	// Print auditor statuses, an interrupted verification stops before verifying them
+	if result.Interrupted {
+		fmt.Fprintf(w, "\n%sauditors: not verified%s\n", p.Yellow, p.Reset)
+	} else {
+		printAuditorStatuses(w, result.AuditorStatuses, result.Auditors, result.Policy)
+		printMixedAuditorSubjects(w, result.MixedAuditorSubjects, result.SingleAuditorRunViolated())
+	}
+	if result.DetachedSignature != nil {
+		printDetachedSignature(w, result.DetachedSignature)
+	}
 
 	// Print summary
-	if manifestsFound == 0 {
-		fmt.Fprintf(w, "\n%sno manifests found%s\n", ColorYellow, ColorReset)
+	summary := result.Summary()
+	note := ""
+	if result.Interrupted {
+		note = fmt.Sprintf(" %s(interrupted — partial results: %d of unknown directories checked)%s",
+			p.Yellow, summary.Found+summary.Unmanaged, p.Reset)
+	}
+	if summary.Found == 0 {
+		fmt.Fprintf(w, "\n%sno manifests found%s%s\n", p.Yellow, p.Reset, note)
 		return
 	}
 
-	if allValid {
-		fmt.Fprintf(w, "\n%sok%s - verified %d manifest(s) (%d skipped)\n", ColorGreen, ColorReset, manifestsVerified, manifestsSkipped)
-	} else {
-		fmt.Fprintf(w, "\n%sfailed%s - %d/%d manifests valid\n", ColorRed, ColorReset, manifestsVerified, manifestsFound)
+	switch {
+	case result.HasFailures():
+		fmt.Fprintf(w, "\n%sfailed%s - %d/%d manifests valid%s\n", p.Red, p.Reset, summary.Verified, summary.Found, note)
+	case result.PolicyViolated():
+		violations := result.Policy.Violations()
+		fmt.Fprintf(w, "\n%sfailed%s - %d auditor policy violation%s%s\n", p.Red, p.Reset,
+			violations, Pluralize(violations, "", "s"), note)
+	case result.SingleAuditorRunViolated():
+		mixed := len(result.MixedAuditorSubjects)
+		fmt.Fprintf(w, "\n%sfailed%s - %d auditor%s signed the tree in more than one run%s\n", p.Red, p.Reset,
+			mixed, Pluralize(mixed, "", "s"), note)
+	case result.UnsignedViolated():
+		fmt.Fprintf(w, "\n%sfailed%s - %d manifest%s unsigned%s\n", p.Red, p.Reset,
+			result.Signing.Unsigned, Pluralize(result.Signing.Unsigned, " is", "s are"), note)
+	case result.UntrustedViolated():
+		fmt.Fprintf(w, "\n%sfailed%s - %d signed manifest%s no trusted auditor%s\n", p.Red, p.Reset,
+			result.Signing.Unverifiable, Pluralize(result.Signing.Unverifiable, " has", "s have"), note)
+	default:
+		fmt.Fprintf(w, "\n%sok%s - verified %d manifest(s) (%d shallow)%s\n", p.Green, p.Reset,
+			summary.Verified, summary.Shallow, note)
+	}
+	if summary.HiddenOnly > 0 {
+		fmt.Fprintf(w, "%d director%s only in %shidden entries%s\n", summary.HiddenOnly,
+			Pluralize(summary.HiddenOnly, "y differs", "ies differ"), p.Yellow, p.Reset)
+	}
+	if summary.Unmanaged > 0 {
+		fmt.Fprintf(w, "%d director%s %sunmanaged%s, without a manifest\n", summary.Unmanaged,
+			Pluralize(summary.Unmanaged, "y", "ies"), p.Yellow, p.Reset)
+	}
+	if result.Subtree != nil {
+		fmt.Fprintf(w, "tree: %s\n", formatSubtree(result.Subtree))
+	}
+	if len(result.Labels) > 0 {
+		fmt.Fprintf(w, "labels: %s\n", formatLabels(result.Labels))
+	}
+	if len(result.MissingLabels) > 0 {
+		fmt.Fprintf(w, "%smissing required label(s):%s %s\n", p.Red, p.Reset, strings.Join(result.MissingLabels, ", "))
+	}
+	if result.UntrustedLabels {
+		fmt.Fprintf(w, "%suntrusted labels:%s the root manifest is not signed by a trusted auditor\n", p.Red, p.Reset)
+	}
+	// Directories unchanged since the cutoff of --changed-since are shallow too, they are reported apart
+	unchangedDirs, unchangedFiles := 0, int64(0)
+	if result.Stats != nil {
+		unchangedDirs, unchangedFiles = int(result.Stats.DirectoriesUnchanged()), result.Stats.FilesUnchanged()
+	}
+	if fresh := summary.Shallow - unchangedDirs; fresh > 0 {
+		fmt.Fprintf(w, "%d fresh manifest(s) %sverified (shallow)%s, the contents of their files were not hashed again\n",
+			fresh, p.Cyan, p.Reset)
+	}
+	if unchangedDirs > 0 {
+		fmt.Fprintf(w, "%d director%s unchanged since the cutoff %sverified (shallow)%s, only their listing and subdirectory manifests were compared\n",
+			unchangedDirs, Pluralize(unchangedDirs, "y", "ies"), p.Cyan, p.Reset)
+	}
+	if unchangedFiles > 0 {
+		fmt.Fprintf(w, "%d file(s) unchanged since the cutoff %snot hashed (changed-since)%s, their recorded checksums were trusted\n",
+			unchangedFiles, p.Cyan, p.Reset)
+	}
+	if result.Stats != nil && result.Stats.FilesSampled() > 0 {
+		fmt.Fprintf(w, "%d large file(s) %sverified (sampled)%s, only their sampled regions were read\n",
+			result.Stats.FilesSampled(), p.Cyan, p.Reset)
+	}
+	if result.Stats != nil && result.Stats.FilesUnhashed() > 0 {
+		fmt.Fprintf(w, "%d file(s) whose size changed were %snot hashed (fast)%s, verify without --fast to get their checksums\n",
+			result.Stats.FilesUnhashed(), p.Cyan, p.Reset)
+	}
+	if result.Stats != nil && result.Stats.MountpointsSkipped() > 0 {
+		fmt.Fprintf(w, "%d mountpoint(s) on other file systems %sleft out%s\n",
+			result.Stats.MountpointsSkipped(), p.Yellow, p.Reset)
 	}
+	if result.Stats != nil && result.Stats.DirectoriesTooLong() > 0 {
+		fmt.Fprintf(w, "%d directory(s) %sleft out%s because their paths are too long\n",
+			result.Stats.DirectoriesTooLong(), p.Yellow, p.Reset)
+	}
+	if result.RefreshFailed > 0 {
+		fmt.Fprintf(w, "%d of %d manifest timestamp(s) %snot refreshed%s, they will not be reused as fresh\n",
+			result.RefreshFailed, result.Refreshed+result.RefreshFailed, p.Yellow, p.Reset)
+	}
+	if summary.Signed > 0 {
+		fmt.Fprintf(w, "%d of %d manifest(s) signed\n", summary.Signed, summary.Found)
+	}
+	// Auditors of interrupted verifications are not verified, so their manifests cannot be told trusted
+	if !result.Interrupted && (summary.Signed > 0 || result.UnsignedViolated()) {
+		printSigningSummary(w, result)
+	}
+	if summary.Inherited > 0 {
+		fmt.Fprintf(w, "%d manifest(s) audited through a signed ancestor %s(inherited)%s\n",
+			summary.Inherited, p.Cyan, p.Reset)
+	}
+}
+
+// printDetachedSignature prints the principals and key of a detached signature of the root digest, or why it
+// was rejected
+func printDetachedSignature(w io.Writer, detached *verifier.DetachedSignatureResult) {
+	p := paletteOf(w)
+	if detached.Error != nil {
+		fmt.Fprintf(w, "detached signature %s[rejected: %v]%s\n", p.Red, detached.Error, p.Reset)
+		return
+	}
+	fmt.Fprintf(w, "detached signature by %s%s%s %s[valid]%s (%s)\n", p.Cyan, strings.Join(detached.Principals, ","),
+		p.Reset, p.Green, p.Reset, detached.Fingerprint)
 }
 
-// Enhanced printAuditorStatuses with fishy detection
-func printAuditorStatuses(w io.Writer, auditorStatuses map[issuer.Reference]issuer.Status) {
+// printChain prints the status of every ancestor linking a verified subtree to its root, see verifier.ChainResult
+func printChain(w io.Writer, chain *verifier.ChainResult) {
+	p := paletteOf(w)
+	fmt.Fprintf(w, "chain of %s to the root:\n", chain.SubtreePath)
+	for _, link := range chain.Links {
+		name := link.RelativePath
+		if name == "." {
+			name = "<root>"
+		}
+		if link.Error != nil {
+			fmt.Fprintf(w, "  level %d %s %sbroken%s: %v\n", link.Level, name, p.Red, p.Reset, link.Error)
+			continue
+		}
+		note := ""
+		if link.Level == 0 {
+			note = " (signed)"
+		}
+		fmt.Fprintf(w, "  level %d %s %sok%s%s\n", link.Level, name, p.Green, p.Reset, note)
+	}
+	if broken := chain.Broken(); broken != nil {
+		fmt.Fprintf(w, "%schain broken at level %d%s, the subtree is not proven to belong to the signed root\n",
+			p.Red, broken.Level, p.Reset)
+		return
+	}
+	fmt.Fprintf(w, "%schain intact%s, the subtree belongs to the signed root\n", p.Green, p.Reset)
+}
+
+// displayPath returns the path of a directory as shown in verification output
+func displayPath(status verifier.DirectoryVerificationStatus, fullPaths bool) string {
+	if fullPaths || status.RelativePath == "" {
+		return status.Path
+	}
+	if status.RelativePath == "." {
+		return "<root>"
+	}
+	return status.RelativePath
+}
+
+// printAuditorStatuses prints auditors sorted by reference with the number of manifests each signed,
+// followed by a summary line of their statuses and the requirements of the auditor policy left unmet
+func printAuditorStatuses(w io.Writer, auditorStatuses map[issuer.Reference]issuer.Status,
+	auditors map[issuer.Reference]verifier.AuditorSummary, policy *issuer.PolicyResult) {
+	p := paletteOf(w)
+	defer printUnmetRequirements(w, policy)
 	if len(auditorStatuses) == 0 {
-		fmt.Fprintf(w, "\n%sAuditors: none%s\n", ColorYellow, ColorReset)
+		fmt.Fprintf(w, "\n%sAuditors: none%s\n", p.Yellow, p.Reset)
 		return
 	}
 
+	refs := make([]issuer.Reference, 0, len(auditorStatuses))
+	for ref := range auditorStatuses {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+
 	// Track counts for summary
 	trustedCount := 0
 	fishyCount := 0
+	expiredCount := 0
 	unsupportedCount := 0
+	unverifiableCount := 0
 	errorCount := 0
 
-	for ref, status := range auditorStatuses {
+	for _, ref := range refs {
+		status := auditorStatuses[ref]
 		var statusText string
 		var color string
 
-		switch {
-		case !status.Supported:
+		switch status.Category() {
+		case issuer.CategoryUnsupported:
 			statusText = "unsupported"
-			color = ColorYellow
+			color = p.Yellow
 			unsupportedCount++
-		case status.Error != nil:
-			if isFishyError(status.Error) {
-				statusText = fmt.Sprintf("fishy: %s", status.Error)
-				color = ColorYellow
-				fishyCount++
-			} else {
-				statusText = fmt.Sprintf("error: %s", status.Error)
-				color = ColorRed
-				errorCount++
+		case issuer.CategoryUnverifiable:
+			// The trusted source could not be reached, a later run may still trust the auditor
+			statusText = fmt.Sprintf("temporarily unverifiable: %s", status.Error)
+			color = p.Yellow
+			unverifiableCount++
+		case issuer.CategoryFishy:
+			statusText = fmt.Sprintf("fishy: %s", status.Error)
+			color = p.Yellow
+			fishyCount++
+		case issuer.CategoryExpired:
+			// The certificate is outside its validity window, the error tells which side
+			statusText = fmt.Sprintf("expired: %s", status.Error)
+			if errors.Is(status.Error, signing.ErrCertificateNotYetValid) {
+				statusText = fmt.Sprintf("not yet valid: %s", status.Error)
 			}
-		case status.Supported && status.Error == nil:
+			color = p.Red
+			expiredCount++
+		case issuer.CategoryError:
+			statusText = fmt.Sprintf("error: %s", status.Error)
+			color = p.Red
+			errorCount++
+		default:
 			statusText = "trusted"
-			color = ColorGreen
+			if status.Pinned {
+				statusText = "trusted (pinned)"
+			}
+			color = p.Green
 			trustedCount++
-		default:
-			statusText = "unknown"
-			color = ColorYellow
+		}
+		if status.Warning != "" {
+			statusText = fmt.Sprintf("%s, warning: %s", statusText, status.Warning)
+			if color == p.Green {
+				color = p.Yellow
+			}
 		}
 
-		fmt.Fprintf(w, "audited by %s%s%s %s[%s]%s\n",
-			ColorCyan, ref, ColorReset,
-			color, statusText, ColorReset)
-	}
-
-	//// Print auditor summary (same as before)
-	//summaryParts := []string{}
-	//if trustedCount > 0 {
-	//	summaryParts = append(summaryParts, fmt.Sprintf("%s%d trusted%s", ColorGreen, trustedCount, ColorReset))
-	//}
-	//if fishyCount > 0 {
-	//	summaryParts = append(summaryParts, fmt.Sprintf("%s%d fishy%s", ColorYellow, fishyCount, ColorReset))
-	//}
-	//if unsupportedCount > 0 {
-	//	summaryParts = append(summaryParts, fmt.Sprintf("%s%d unsupported%s", ColorYellow, unsupportedCount, ColorReset))
-	//}
-	//if errorCount > 0 {
-	//	summaryParts = append(summaryParts, fmt.Sprintf("%s%d with errors%s", ColorRed, errorCount, ColorReset))
-	//}
-	//
-	//if len(summaryParts) > 0 {
-	//	fmt.Fprintf(w, "auditors: %s\n", strings.Join(summaryParts, ", "))
-	//}
-}
-
-// isFishyError determines if an error represents a "fishy" situation rather than a hard failure
-func isFishyError(err error) bool {
-	if err == nil {
-		return false
+		count := auditors[ref].ManifestCount
+		fmt.Fprintf(w, "audited by %s%s%s %s[%s]%s (%d manifest%s)%s\n",
+			p.Cyan, ref, p.Reset,
+			color, statusText, p.Reset,
+			count, Pluralize(count, "", "s"), policyNote(p, policy, ref))
 	}
 
-	errStr := err.Error()
-	// Consider errors related to key validation as "fishy" rather than complete failures
-	fishyIndicators := []string{
-		"key expired",
-		"not found in trusted source",
-		"validation warning",
-		"fishy",
-		"questionable",
+	summaryParts := []string{}
+	if trustedCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d trusted%s", p.Green, trustedCount, p.Reset))
+	}
+	if fishyCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d fishy%s", p.Yellow, fishyCount, p.Reset))
+	}
+	if unsupportedCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d unsupported%s", p.Yellow, unsupportedCount, p.Reset))
+	}
+	if unverifiableCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d temporarily unverifiable%s", p.Yellow, unverifiableCount, p.Reset))
+	}
+	if expiredCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d expired%s", p.Red, expiredCount, p.Reset))
 	}
+	if errorCount > 0 {
+		summaryParts = append(summaryParts, fmt.Sprintf("%s%d with errors%s", p.Red, errorCount, p.Reset))
+	}
+	fmt.Fprintf(w, "auditors: %s\n", strings.Join(summaryParts, ", "))
+}
+
+// maxRunDirectories is how many directories of a run printMixedAuditorSubjects lists
+const maxRunDirectories = 5
 
-	for _, indicator := range fishyIndicators {
-		if strings.Contains(strings.ToLower(errStr), strings.ToLower(indicator)) {
-			return true
+// printMixedAuditorSubjects warns about the auditors that signed the tree in more than one run, listing the
+// directories of every run, in red when a single run is required
+func printMixedAuditorSubjects(w io.Writer, mixed map[issuer.Reference][]verifier.AuditorSubjectGroup, required bool) {
+	p := paletteOf(w)
+	color := p.Yellow
+	if required {
+		color = p.Red
+	}
+	refs := make([]issuer.Reference, 0, len(mixed))
+	for ref := range mixed {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	for _, ref := range refs {
+		groups := mixed[ref]
+		fmt.Fprintf(w, "%s! %s signed this tree in %d runs%s, directories may have been spliced in from another tree\n",
+			color, ref, len(groups), p.Reset)
+		for i, group := range groups {
+			signed := group.FirstSigned.UTC().Format(time.RFC3339)
+			if last := group.LastSigned.UTC().Format(time.RFC3339); last != signed {
+				signed += " to " + last
+			}
+			directories := make([]string, 0, maxRunDirectories)
+			for _, directory := range group.Directories[:min(len(group.Directories), maxRunDirectories)] {
+				if directory == "." {
+					directory = "<root>"
+				}
+				directories = append(directories, directory)
+			}
+			if more := len(group.Directories) - maxRunDirectories; more > 0 {
+				directories = append(directories, fmt.Sprintf("and %d more", more))
+			}
+			fmt.Fprintf(w, "    run %d, key %s, signed %s: %s\n", i+1, group.SubjectKey, signed, strings.Join(directories, ", "))
 		}
 	}
+}
+
+// policyNote returns the note on the decision of the auditor policy about ref, empty unless it is denied or warned
+func policyNote(p Palette, policy *issuer.PolicyResult, ref issuer.Reference) string {
+	if policy == nil {
+		return ""
+	}
+	decision := policy.Decisions[ref]
+	switch decision.Outcome {
+	case issuer.RuleDeny:
+		return fmt.Sprintf(" %sdenied by policy rule %d%s", p.Red, decision.Rule, p.Reset)
+	case issuer.RuleWarn:
+		return fmt.Sprintf(" %swarned by policy rule %d%s", p.Yellow, decision.Rule, p.Reset)
+	}
+	return ""
+}
 
-	return false
+// printUnmetRequirements prints the require rules of the auditor policy no trusted auditor satisfies
+func printUnmetRequirements(w io.Writer, policy *issuer.PolicyResult) {
+	p := paletteOf(w)
+	if policy == nil {
+		return
+	}
+	for _, unmet := range policy.Unmet {
+		fmt.Fprintf(w, "%spolicy rule %d requires a trusted auditor matching '%s', none found%s\n",
+			p.Red, unmet.Rule, unmet.Match, p.Reset)
+	}
+}
+
+// formatLabels formats labels as comma-separated key=value pairs sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range manifest.SortedLabelKeys(labels) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ", ")
 }
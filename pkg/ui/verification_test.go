@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/verifier"
+)
+
+func TestPrintAuditorStatuses_IsSortedByReference(t *testing.T) {
+	statuses := map[issuer.Reference]issuer.Status{
+		"github:org2/repo": {Supported: true},
+		"custom:alice":     {Supported: false},
+		"github:org1/repo": {Supported: true},
+		"custom:bob":       {Supported: true, Error: errors.New("could not fetch keys")},
+		"corp:team":        {Supported: true, Error: errors.New("key expired")},
+	}
+	auditors := map[issuer.Reference]verifier.AuditorSummary{
+		"github:org2/repo": {ManifestCount: 3},
+		"github:org1/repo": {ManifestCount: 1},
+		"custom:alice":     {ManifestCount: 2},
+	}
+
+	var first bytes.Buffer
+	printAuditorStatuses(NewOutput(&first, ColorAlways), statuses, auditors, nil)
+	// map iteration order is random, repeated runs must print the same output
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		printAuditorStatuses(NewOutput(&buf, ColorAlways), statuses, auditors, nil)
+		assert.Equal(t, first.String(), buf.String())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(first.String(), "\n"), "\n")
+	assert.Equal(t, []string{
+		"audited by " + ColorCyan + "corp:team" + ColorReset + " " + ColorYellow + "[fishy: key expired]" + ColorReset + " (0 manifests)",
+		"audited by " + ColorCyan + "custom:alice" + ColorReset + " " + ColorYellow + "[unsupported]" + ColorReset + " (2 manifests)",
+		"audited by " + ColorCyan + "custom:bob" + ColorReset + " " + ColorRed + "[error: could not fetch keys]" + ColorReset + " (0 manifests)",
+		"audited by " + ColorCyan + "github:org1/repo" + ColorReset + " " + ColorGreen + "[trusted]" + ColorReset + " (1 manifest)",
+		"audited by " + ColorCyan + "github:org2/repo" + ColorReset + " " + ColorGreen + "[trusted]" + ColorReset + " (3 manifests)",
+		"auditors: " + ColorGreen + "2 trusted" + ColorReset + ", " + ColorYellow + "1 fishy" + ColorReset + ", " +
+			ColorYellow + "1 unsupported" + ColorReset + ", " + ColorRed + "1 with errors" + ColorReset,
+	}, lines)
+}
+
+func TestPrintAuditorStatuses_WithoutAuditors(t *testing.T) {
+	var buf bytes.Buffer
+	printAuditorStatuses(NewOutput(&buf, ColorAlways), nil, nil, nil)
+	assert.Equal(t, "\n"+ColorYellow+"Auditors: none"+ColorReset+"\n", buf.String())
+}
+
+func TestPrintAuditorStatuses_TransientError_IsTemporarilyUnverifiable(t *testing.T) {
+	statuses := map[issuer.Reference]issuer.Status{
+		"github:alice": {Supported: true, Error: fmt.Errorf("could not fetch keys for 'github:alice': %w",
+			&issuer.TransientError{Err: errors.New("received status 503 Service Unavailable")})},
+	}
+
+	var buf bytes.Buffer
+	printAuditorStatuses(NewOutput(&buf, ColorAlways), statuses, nil, nil)
+
+	assert.Equal(t, "audited by "+ColorCyan+"github:alice"+ColorReset+" "+ColorYellow+
+		"[temporarily unverifiable: could not fetch keys for 'github:alice': received status 503 Service Unavailable]"+
+		ColorReset+" (0 manifests)\n"+
+		"auditors: "+ColorYellow+"1 temporarily unverifiable"+ColorReset+"\n", buf.String())
+}
+
+func TestPrintAuditorStatuses_WithPolicy_mustNoteDecisionsAndUnmetRequirements(t *testing.T) {
+	statuses := map[issuer.Reference]issuer.Status{
+		"github:evil":     {Supported: true},
+		"github:my-org/a": {Supported: true},
+		"custom:bob":      {Supported: true},
+	}
+	policy := &issuer.PolicyResult{
+		Decisions: map[issuer.Reference]issuer.PolicyDecision{
+			"github:evil":     {Rule: 3, Outcome: issuer.RuleDeny},
+			"github:my-org/a": {Rule: 1, Outcome: issuer.RuleAllow},
+			"custom:bob":      {Rule: 2, Outcome: issuer.RuleWarn},
+		},
+		Unmet: []issuer.UnmetRequirement{{Rule: 4, Match: "email:*@example.com"}},
+	}
+
+	var buf bytes.Buffer
+	printAuditorStatuses(NewOutput(&buf, ColorAlways), statuses, nil, policy)
+	out := buf.String()
+	assert.Contains(t, out, "github:evil"+ColorReset+" "+ColorGreen+"[trusted]"+ColorReset+" (0 manifests) "+
+		ColorRed+"denied by policy rule 3"+ColorReset+"\n")
+	assert.Contains(t, out, "(0 manifests) "+ColorYellow+"warned by policy rule 2"+ColorReset+"\n")
+	assert.Contains(t, out, "github:my-org/a"+ColorReset+" "+ColorGreen+"[trusted]"+ColorReset+" (0 manifests)\n")
+	assert.Contains(t, out, "policy rule 4 requires a trusted auditor matching 'email:*@example.com', none found")
+}
+
+func TestPrintVerificationResult_mustCollapseDerivedFailuresUnlessVerbose(t *testing.T) {
+	dirChanged := manifest.EntityDifference{Name: "a", Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: "a", IsDir: true}, ActualEntity: &manifest.Entity{Name: "a", IsDir: true}}
+	fileChanged := manifest.EntityDifference{Name: "a.txt", Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: "a.txt"}, ActualEntity: &manifest.Entity{Name: "a.txt"}}
+	junk := manifest.EntityDifference{Name: ".DS_Store", Type: manifest.DiffMissingInA,
+		ActualEntity: &manifest.Entity{Name: ".DS_Store"}}
+	found := verifier.ManifestVerificationStatus{Found: true}
+	result := verifier.NewResult([]verifier.DirectoryVerificationStatus{
+		{Path: "/data", RelativePath: ".", ManifestStatus: found, Differences: []manifest.EntityDifference{dirChanged}},
+		{Path: "/data/a", RelativePath: "a", ManifestStatus: found, Differences: []manifest.EntityDifference{fileChanged}},
+		{Path: "/data/b", RelativePath: "b", ManifestStatus: found, Differences: []manifest.EntityDifference{junk}},
+	}, nil, nil)
+
+	var buf bytes.Buffer
+	PrintVerificationResult(NewOutput(&buf, ColorAlways), result, false, false)
+	out := buf.String()
+	assert.NotContains(t, out, "<root> fail")
+	assert.Contains(t, out, ColorRed+"a fail"+ColorReset+" (1 difference)\n")
+	assert.Contains(t, out, ColorRed+"b fail"+ColorReset+" (1 difference, "+ColorYellow+"likely benign"+ColorReset+")\n")
+	assert.Contains(t, out, ColorCyan+"(1 parent manifest changed as a consequence, --verbose lists them)"+ColorReset)
+
+	buf.Reset()
+	PrintVerificationResult(NewOutput(&buf, ColorAlways), result, false, true)
+	out = buf.String()
+	assert.Contains(t, out, ColorRed+"<root> fail"+ColorReset+" (1 difference, "+ColorCyan+"derived"+ColorReset+")\n")
+	assert.NotContains(t, out, "as a consequence")
+}
+
+func TestPrintVerificationResult_mustHintAtHiddenDifferences(t *testing.T) {
+	swapFile := manifest.EntityDifference{Name: ".swp", Type: manifest.DiffMissingInA,
+		ActualEntity: &manifest.Entity{Name: ".swp"}, Hidden: true}
+	result := verifier.NewResult([]verifier.DirectoryVerificationStatus{
+		{Path: "/data/a", RelativePath: "a", Differences: []manifest.EntityDifference{swapFile},
+			ManifestStatus: verifier.ManifestVerificationStatus{Found: true, HiddenOnly: true}},
+		{Path: "/data/b", RelativePath: "b", Differences: []manifest.EntityDifference{swapFile},
+			ManifestStatus: verifier.ManifestVerificationStatus{Found: true, Valid: true, HiddenOnly: true}},
+	}, nil, nil)
+
+	var buf bytes.Buffer
+	PrintVerificationResult(NewOutput(&buf, ColorAlways), result, false, false)
+	out := buf.String()
+	assert.Contains(t, out, ColorRed+"a fail"+ColorReset+" (1 difference, "+ColorYellow+"only hidden entries"+ColorReset+")\n")
+	assert.Contains(t, out, ColorYellow+"b ok"+ColorReset+" (1 hidden difference ignored)\n")
+	assert.Contains(t, out, "  "+ColorYellow+". hidden extra file:"+ColorReset+" .swp\n")
+	assert.Contains(t, out, "2 directories differ only in "+ColorYellow+"hidden entries"+ColorReset+"\n")
+}
+
+func TestPrintEntityDifferences_mustExplainContentTypeChanges(t *testing.T) {
+	expected := &manifest.Entity{Name: "a.gz", Checksum: "aa", ContentType: "application/x-gzip"}
+	zeroed := &manifest.Entity{Name: "a.gz", Checksum: "bb", ContentType: manifest.ContentTypeZeros}
+	rewritten := &manifest.Entity{Name: "a.gz", Checksum: "cc", ContentType: "application/x-gzip"}
+
+	var buf bytes.Buffer
+	PrintEntityDifferences(NewOutput(&buf, ColorAlways), []manifest.EntityDifference{
+		{Name: "a.gz", Type: manifest.DiffChecksumMismatch, ExpectedEntity: expected, ActualEntity: zeroed},
+	})
+	assert.Contains(t, buf.String(), "    content:  was application/x-gzip, now application/octet-stream (all zeros)\n")
+	assert.Contains(t, buf.String(), ColorRed+"likely bit-rot/truncation"+ColorReset)
+
+	buf.Reset()
+	PrintEntityDifferences(NewOutput(&buf, ColorAlways), []manifest.EntityDifference{
+		{Name: "a.gz", Type: manifest.DiffChecksumMismatch, ExpectedEntity: expected, ActualEntity: rewritten},
+	})
+	assert.Contains(t, buf.String(), "    content:  still application/x-gzip\n")
+	assert.NotContains(t, buf.String(), "bit-rot")
+}
+
+func TestVerificationPrinter_mustPrintFailuresAsTheyAreVerified(t *testing.T) {
+	dirChanged := manifest.EntityDifference{Name: "a", Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: "a", IsDir: true}, ActualEntity: &manifest.Entity{Name: "a", IsDir: true}}
+	fileChanged := manifest.EntityDifference{Name: "a.txt", Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: "a.txt"}, ActualEntity: &manifest.Entity{Name: "a.txt"}}
+	found := verifier.ManifestVerificationStatus{Found: true}
+	// Subdirectories are verified before their parents
+	statuses := []verifier.DirectoryVerificationStatus{
+		{Path: "/data/a", RelativePath: "a", ManifestStatus: found, Differences: []manifest.EntityDifference{fileChanged}},
+		{Path: "/data/b", RelativePath: "b", ManifestStatus: verifier.ManifestVerificationStatus{Found: true, Valid: true}},
+		{Path: "/data", RelativePath: ".", ManifestStatus: found, Differences: []manifest.EntityDifference{dirChanged}},
+	}
+
+	var buf bytes.Buffer
+	printer := NewVerificationPrinter(NewOutput(&buf, ColorAlways), false, false)
+	printer.PrintDirectory(statuses[0])
+	assert.Contains(t, buf.String(), ColorRed+"a fail"+ColorReset+" (1 difference)\n")
+	printed := buf.Len()
+	printer.PrintDirectory(statuses[1])
+	printer.PrintDirectory(statuses[2])
+	assert.Equal(t, printed, buf.Len(), "valid and derived directories print nothing")
+
+	result := verifier.NewResult(statuses, nil, nil)
+	printer.PrintResult(result)
+	var expected bytes.Buffer
+	PrintVerificationResult(NewOutput(&expected, ColorAlways), result, false, false)
+	tail := func(out string) string {
+		return out[strings.Index(out, "(1 parent manifest"):]
+	}
+	assert.Equal(t, tail(expected.String()), tail(buf.String()), "the summary is the same")
+}
@@ -0,0 +1,15 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+)
+
+// PrintWatchTotals prints what the runs of a watch processed since it started
+func PrintWatchTotals(w io.Writer, runs int, directories, files, bytes int64) {
+	fmt.Fprintf(w, "since start: %d run%s, %d director%s, %d file%s, %s hashed\n",
+		runs, Pluralize(runs, "", "s"),
+		directories, Pluralize(int(directories), "y", "ies"),
+		files, Pluralize(int(files), "", "s"),
+		formatBytes(bytes))
+}
@@ -0,0 +1,182 @@
+package verifier
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+)
+
+// Colors of a Badge, named like the colors of shields.io
+const (
+	BadgeGreen     = "green"
+	BadgeYellow    = "yellow"
+	BadgeRed       = "red"
+	BadgeLightGrey = "lightgrey"
+)
+
+// BadgeSchemaVersion is the version of the shields.io endpoint schema a Badge follows
+const BadgeSchemaVersion = 1
+
+// badgeFills are the SVG colors of the badge colors
+var badgeFills = map[string]string{
+	BadgeGreen:     "#97ca00",
+	BadgeYellow:    "#dfb317",
+	BadgeRed:       "#e05d44",
+	BadgeLightGrey: "#9f9f9f",
+}
+
+//go:embed badge.svg.tmpl
+var badgeSVGTemplate string
+
+var badgeSVG = template.Must(template.New("badge").Parse(badgeSVGTemplate))
+
+// Badge is a status summary of a verification for static hosting, in the format of the shields.io endpoint
+// badges, e.g. {"schemaVersion":1,"label":"bytecheck","message":"ok (81234 manifests)","color":"green",...}
+type Badge struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Label         string    `json:"label"`
+	Message       string    `json:"message"`
+	Color         string    `json:"color"`
+	Timestamp     time.Time `json:"timestamp"`
+	RootDigest    string    `json:"rootDigest,omitempty"`
+}
+
+// NewBadge summarizes result as a badge of the given time. Failed verifications, see Result.Failure, and trees
+// without manifests are red, interrupted runs, untrusted, fishy or unverifiable auditors and auditors signing
+// in several runs yellow, everything else green.
+func NewBadge(result *Result, timestamp time.Time) Badge {
+	summary := result.Summary()
+	badge := Badge{
+		SchemaVersion: BadgeSchemaVersion,
+		Label:         "bytecheck",
+		Timestamp:     timestamp.UTC(),
+		RootDigest:    result.RootDigest,
+	}
+	manifests := fmt.Sprintf("%d manifest%s", summary.Found, plural(summary.Found))
+	if summary.Invalid > 0 {
+		manifests = fmt.Sprintf("%d of %s", summary.Invalid, manifests)
+	}
+	untrusted, questionable := 0, 0
+	for _, status := range result.AuditorStatuses {
+		switch status.Category() {
+		case issuer.CategoryTrusted:
+		case issuer.CategoryExpired, issuer.CategoryError:
+			untrusted++
+		default:
+			questionable++
+		}
+	}
+	failure := result.Failure()
+	switch {
+	case result.Interrupted && !result.HasFailures():
+		badge.Message, badge.Color = fmt.Sprintf("interrupted (%s)", manifests), BadgeYellow
+	case failure != nil && errors.Is(failure.Kind, ErrManifestNotFound), failure == nil && summary.Found == 0:
+		badge.Message, badge.Color = "no manifests", BadgeRed
+	case failure != nil:
+		badge.Message, badge.Color = fmt.Sprintf("%s (%s)", failure.Short, manifests), BadgeRed
+	case untrusted > 0:
+		badge.Message, badge.Color = fmt.Sprintf("ok, %d untrusted auditor%s (%s)", untrusted, plural(untrusted), manifests), BadgeYellow
+	case questionable > 0:
+		badge.Message, badge.Color = fmt.Sprintf("ok, %d fishy auditor%s (%s)", questionable, plural(questionable), manifests), BadgeYellow
+	case len(result.MixedAuditorSubjects) > 0:
+		badge.Message, badge.Color = fmt.Sprintf("ok, mixed auditor runs (%s)", manifests), BadgeYellow
+	default:
+		badge.Message, badge.Color = fmt.Sprintf("ok (%s)", manifests), BadgeGreen
+	}
+	return badge
+}
+
+// NewErrorBadge summarizes a run that failed with err before completing a verification as a red badge of the
+// given time, e.g. one finding no manifests
+func NewErrorBadge(err error, timestamp time.Time) Badge {
+	badge := Badge{
+		SchemaVersion: BadgeSchemaVersion,
+		Label:         "bytecheck",
+		Message:       "error",
+		Color:         BadgeRed,
+		Timestamp:     timestamp.UTC(),
+	}
+	if errors.Is(err, ErrManifestNotFound) {
+		badge.Message = "no manifests"
+	}
+	return badge
+}
+
+// WriteJSON writes the badge as JSON to path, replacing it atomically
+func (b Badge) WriteJSON(path string) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// WriteSVG renders the badge as an SVG image to path, replacing it atomically
+func (b Badge) WriteSVG(path string) error {
+	data, err := b.SVG()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// SVG renders the badge as a flat SVG image, like the badges of shields.io
+func (b Badge) SVG() ([]byte, error) {
+	fill, ok := badgeFills[b.Color]
+	if !ok {
+		fill = badgeFills[BadgeLightGrey]
+	}
+	// Verdana at 11px averages about 7px per character, with 5px of padding on each side
+	labelWidth := 7*utf8.RuneCountInString(b.Label) + 10
+	messageWidth := 7*utf8.RuneCountInString(b.Message) + 10
+	var buf bytes.Buffer
+	err := badgeSVG.Execute(&buf, map[string]any{
+		"Label":        b.Label,
+		"Message":      b.Message,
+		"Fill":         fill,
+		"LabelWidth":   labelWidth,
+		"MessageWidth": messageWidth,
+		"Width":        labelWidth + messageWidth,
+		"LabelX":       labelWidth / 2,
+		"MessageX":     labelWidth + messageWidth/2,
+	})
+	return buf.Bytes(), err
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it over path, so that readers
+// never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp creates the file readable by its owner alone, the badge is meant to be published
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
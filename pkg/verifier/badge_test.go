@@ -0,0 +1,142 @@
+package verifier
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+)
+
+var badgeTime = time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+
+func validStatuses(n int) []DirectoryVerificationStatus {
+	statuses := make([]DirectoryVerificationStatus, n)
+	for i := range statuses {
+		statuses[i].ManifestStatus = ManifestVerificationStatus{Found: true, Valid: true}
+	}
+	return statuses
+}
+
+func TestBadge_WriteJSON_Fields(t *testing.T) {
+	valid := NewResult(validStatuses(3), nil, nil)
+	valid.RootDigest = "abc123"
+	failed := NewResult(append(validStatuses(2),
+		DirectoryVerificationStatus{Path: "c", ManifestStatus: ManifestVerificationStatus{Found: true}}), nil, nil)
+
+	tests := []struct {
+		name   string
+		result *Result
+		want   map[string]any
+	}{
+		{"ok", valid, map[string]any{"schemaVersion": 1.0, "label": "bytecheck", "message": "ok (3 manifests)",
+			"color": "green", "timestamp": "2026-10-17T03:00:00Z", "rootDigest": "abc123"}},
+		{"failed", failed, map[string]any{"schemaVersion": 1.0, "label": "bytecheck",
+			"message": "failed (1 of 3 manifests)", "color": "red", "timestamp": "2026-10-17T03:00:00Z"}},
+		{"no manifests", NewResult(nil, nil, nil), map[string]any{"schemaVersion": 1.0, "label": "bytecheck",
+			"message": "no manifests", "color": "red", "timestamp": "2026-10-17T03:00:00Z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "status.json")
+			require.NoError(t, NewBadge(tt.result, badgeTime).WriteJSON(path))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal(data, &fields))
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
+
+func TestNewBadge_Auditors(t *testing.T) {
+	fishy := NewResult(validStatuses(1), map[issuer.Reference]issuer.Status{
+		"github:alice": {Supported: true},
+		"corp:bob":     {Supported: false},
+	}, nil)
+	badge := NewBadge(fishy, badgeTime)
+	assert.Equal(t, "ok, 1 fishy auditor (1 manifest)", badge.Message)
+	assert.Equal(t, BadgeYellow, badge.Color)
+
+	untrusted := NewResult(validStatuses(1), map[issuer.Reference]issuer.Status{
+		"github:alice": {Supported: true, Error: errors.New("key not found")},
+	}, nil)
+	badge = NewBadge(untrusted, badgeTime)
+	assert.Equal(t, "ok, 1 untrusted auditor (1 manifest)", badge.Message)
+	assert.Equal(t, BadgeYellow, badge.Color, "untrusted auditors do not fail verification")
+
+	pinned := NewResult(validStatuses(1), map[issuer.Reference]issuer.Status{
+		"github:alice": {Supported: true, Error: issuer.ErrPinnedKeyMismatch},
+	}, nil)
+	badge = NewBadge(pinned, badgeTime)
+	assert.Equal(t, "pinned key mismatch (1 manifest)", badge.Message)
+	assert.Equal(t, BadgeRed, badge.Color)
+}
+
+func TestNewBadge_mustBeRedForEveryFailure(t *testing.T) {
+	missingLabels := NewResult(validStatuses(1), nil, nil)
+	missingLabels.MissingLabels = []string{"pipeline=nightly"}
+	rejected := NewResult(validStatuses(1), nil, nil)
+	rejected.DetachedSignature = &DetachedSignatureResult{Error: errors.New("no allowed signer")}
+	broken := NewResult(validStatuses(1), nil, nil)
+	broken.Chain = &ChainResult{Links: []ChainLink{{Level: 1, ManifestPath: "a", Error: ErrUnsignedRoot}}}
+
+	for name, result := range map[string]*Result{
+		"missing labels":              missingLabels,
+		"detached signature rejected": rejected,
+		"broken chain":                broken,
+	} {
+		require.NotNil(t, result.Failure(), name)
+		badge := NewBadge(result, badgeTime)
+		assert.Equal(t, name+" (1 manifest)", badge.Message)
+		assert.Equal(t, BadgeRed, badge.Color, name)
+	}
+}
+
+func TestNewErrorBadge(t *testing.T) {
+	badge := NewErrorBadge(fmt.Errorf("directory 'a': %w", ErrManifestNotFound), badgeTime)
+	assert.Equal(t, "no manifests", badge.Message)
+	assert.Equal(t, BadgeRed, badge.Color)
+	assert.Equal(t, "error", NewErrorBadge(errors.New("permission denied"), badgeTime).Message)
+}
+
+func TestNewBadge_MixedAuditorSubjects(t *testing.T) {
+	mixed := NewResult(validStatuses(2), nil, nil)
+	mixed.MixedAuditorSubjects = map[issuer.Reference][]AuditorSubjectGroup{
+		"custom:alice": {{SubjectKey: "sha256:01", Directories: []string{"c"}}, {SubjectKey: "sha256:02", Directories: []string{"."}}},
+	}
+	badge := NewBadge(mixed, badgeTime)
+	assert.Equal(t, "ok, mixed auditor runs (2 manifests)", badge.Message)
+	assert.Equal(t, BadgeYellow, badge.Color)
+
+	mixed.singleAuditorRun = true
+	badge = NewBadge(mixed, badgeTime)
+	assert.Equal(t, "mixed auditor runs (2 manifests)", badge.Message)
+	assert.Equal(t, BadgeRed, badge.Color)
+}
+
+func TestBadge_WriteSVG_Renders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.svg")
+	badge := NewBadge(NewResult(validStatuses(2), nil, nil), badgeTime)
+	badge.Message += " <&>"
+	require.NoError(t, badge.WriteSVG(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var svg struct {
+		XMLName xml.Name
+		Title   string `xml:"title"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &svg), "the message is escaped")
+	assert.Equal(t, "svg", svg.XMLName.Local)
+	assert.Equal(t, "bytecheck: ok (2 manifests) <&>", svg.Title)
+	assert.Contains(t, string(data), badgeFills[BadgeGreen])
+}
@@ -0,0 +1,82 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"os"
+	"path/filepath"
+)
+
+// ErrBinaryMismatch is wrapped by the error of AttestBinary when the binary differs from its manifest entity
+var ErrBinaryMismatch = errors.New("binary does not match its manifest")
+
+// BinaryAttestation is the result of a successful AttestBinary
+type BinaryAttestation struct {
+	// Entity is the manifest entity the binary matches
+	Entity manifest.Entity
+	// Issuers hold the issuers of the valid auditor signatures of the manifest, their trust is not checked
+	Issuers []issuer.Issuer
+}
+
+// ExecutablePath returns the path of the running executable with symbolic links resolved, see os.Executable
+func ExecutablePath() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// FindEntity returns the regular file named name listed by m
+func FindEntity(m *manifest.Manifest, name string) (manifest.Entity, error) {
+	for _, entity := range m.Entities {
+		if entity.Name != name {
+			continue
+		}
+		if entity.Kind() != "file" {
+			return manifest.Entity{}, fmt.Errorf("entity '%s' of the manifest is a %s, not a file", name, entity.Kind())
+		}
+		return entity, nil
+	}
+	return manifest.Entity{}, fmt.Errorf("manifest has no entity named '%s'", name)
+}
+
+// AttestBinary checks that the file at binaryPath matches the entity entityName of m, the base name of binaryPath
+// when empty, and that every auditor signature of m is valid. Unsigned manifests are rejected with ErrAuditFailed.
+// The HMAC of m is checked when it is loaded, see manifest.Parse. Valid signatures do not attest the binary by
+// themselves: callers must check the returned Issuers against a trust anchor, e.g. a pinned key or an issuer.Verifier.
+func AttestBinary(ctx context.Context, m *manifest.Manifest, binaryPath, entityName string) (*BinaryAttestation, error) {
+	if entityName == "" {
+		entityName = filepath.Base(binaryPath)
+	}
+	entity, err := FindEntity(m, entityName)
+	if err != nil {
+		return nil, err
+	}
+	if entity.Checksum == "" {
+		return nil, fmt.Errorf("entity '%s' of the manifest records no full checksum", entityName)
+	}
+
+	auditor := NewSimpleManifestAuditor()
+	auditResult := auditor.Verify(m)
+	if !auditResult.IsAudited {
+		return nil, fmt.Errorf("%w: manifest is not signed", ErrAuditFailed)
+	}
+	if auditResult.Error != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuditFailed, auditResult.Error)
+	}
+
+	checksum, err := scanner.FileChecksum(ctx, binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	if !manifest.SecureEqualHex(checksum, entity.Checksum) {
+		return nil, fmt.Errorf("%w: %s has checksum %s, entity '%s' records %s",
+			ErrBinaryMismatch, binaryPath, checksum, entityName, entity.Checksum)
+	}
+	return &BinaryAttestation{Entity: entity, Issuers: auditor.GetIssuers()}, nil
+}
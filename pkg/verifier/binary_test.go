@@ -0,0 +1,113 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// generateBinaryManifest stands a file in for the executable and returns its path and the manifest of its
+// directory, signed by "custom:alice" unless signer is nil
+func generateBinaryManifest(t *testing.T, signer signing.Signer) (string, *manifest.Manifest) {
+	dir := t.TempDir()
+	binaryPath := filepath.Join(dir, "bytecheck")
+	require.NoError(t, os.WriteFile(binaryPath, []byte("\x7fELF binary"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0755))
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), dir))
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	return binaryPath, m
+}
+
+func TestAttestBinary_WithSignedManifest_mustReturnIssuers(t *testing.T) {
+	signer := signing.NewEd25519Signer(seededKey(0), "custom:alice")
+	binaryPath, m := generateBinaryManifest(t, signer)
+
+	attestation, err := AttestBinary(context.Background(), m, binaryPath, "")
+
+	require.NoError(t, err)
+	assert.Equal(t, "bytecheck", attestation.Entity.Name)
+	require.Len(t, attestation.Issuers, 1)
+	assert.Equal(t, issuer.Reference("custom:alice"), attestation.Issuers[0].Reference)
+	publicKey, err := signer.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, publicKey, attestation.Issuers[0].PublicKey)
+}
+
+func TestAttestBinary_WithEntityName_mustMatchRenamedBinary(t *testing.T) {
+	binaryPath, m := generateBinaryManifest(t, signing.NewEd25519Signer(seededKey(0), "custom:alice"))
+	renamed := filepath.Join(t.TempDir(), "installer-copy")
+	data, err := os.ReadFile(binaryPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(renamed, data, 0755))
+
+	_, err = AttestBinary(context.Background(), m, renamed, "")
+	assert.EqualError(t, err, "manifest has no entity named 'installer-copy'")
+
+	_, err = AttestBinary(context.Background(), m, renamed, "bytecheck")
+	assert.NoError(t, err)
+
+	_, err = AttestBinary(context.Background(), m, renamed, "lib")
+	assert.EqualError(t, err, "entity 'lib' of the manifest is a directory, not a file")
+}
+
+func TestAttestBinary_WithModifiedBinary_mustFail(t *testing.T) {
+	binaryPath, m := generateBinaryManifest(t, signing.NewEd25519Signer(seededKey(0), "custom:alice"))
+	require.NoError(t, os.WriteFile(binaryPath, []byte("\x7fELF patched"), 0755))
+
+	_, err := AttestBinary(context.Background(), m, binaryPath, "")
+
+	assert.ErrorIs(t, err, ErrBinaryMismatch)
+}
+
+func TestAttestBinary_WithUnsignedOrForgedManifest_mustFailAudit(t *testing.T) {
+	binaryPath, m := generateBinaryManifest(t, nil)
+	_, err := AttestBinary(context.Background(), m, binaryPath, "")
+	assert.ErrorIs(t, err, ErrAuditFailed)
+	assert.ErrorContains(t, err, "manifest is not signed")
+
+	binaryPath, m = generateBinaryManifest(t, signing.NewEd25519Signer(seededKey(0), "custom:alice"))
+	// Re-hashing the binary into the manifest keeps the HMAC valid, but not the signature
+	require.NoError(t, os.WriteFile(binaryPath, []byte("\x7fELF patched"), 0755))
+	checksum, err := scanner.FileChecksum(context.Background(), binaryPath)
+	require.NoError(t, err)
+	for i := range m.Entities {
+		if m.Entities[i].Name == "bytecheck" {
+			m.Entities[i].Checksum = checksum
+		}
+	}
+	_, err = AttestBinary(context.Background(), m, binaryPath, "")
+	assert.ErrorIs(t, err, ErrAuditFailed)
+}
+
+func TestAttestBinary_WithUpperCasedChecksum_mustFail(t *testing.T) {
+	binaryPath := filepath.Join(t.TempDir(), "bytecheck")
+	require.NoError(t, os.WriteFile(binaryPath, []byte("\x7fELF binary"), 0755))
+	checksum, err := scanner.FileChecksum(context.Background(), binaryPath)
+	require.NoError(t, err)
+	// Checksums are lowercase hex, the manifest is signed as it is so that only the spelling differs
+	m := manifest.New([]manifest.Entity{{Name: "bytecheck", Checksum: strings.ToUpper(checksum)}})
+	manifestKey := seededKey(100)
+	cert, err := signing.IssueCertificate(signing.NewEd25519Signer(seededKey(0), "custom:alice"),
+		manifestKey.Public().(ed25519.PublicKey), 0)
+	require.NoError(t, err)
+	data, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	_, err = m.AddAuditor(cert, ed25519.Sign(manifestKey, data), signing.SignatureAlgorithmEd25519)
+	require.NoError(t, err)
+
+	_, err = AttestBinary(context.Background(), m, binaryPath, "")
+
+	assert.ErrorIs(t, err, ErrBinaryMismatch)
+}
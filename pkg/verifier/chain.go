@@ -0,0 +1,165 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsignedRoot is the error of the root link of a chain whose root manifest carries no auditor section
+var ErrUnsignedRoot = errors.New("root manifest is not signed")
+
+// ChainLink is the status of one ancestor manifest linking a verified subtree to the root of its tree
+type ChainLink struct {
+	// Level counts the directories between the root and the ancestor, 0 for the root itself
+	Level int
+	// RelativePath is the path of the ancestor relative to the root, "." for the root itself
+	RelativePath string
+	// ManifestPath is the path the ancestor manifest was read from
+	ManifestPath string
+	// Error is set when the manifest is missing or invalid, when it does not record the checksum of the
+	// manifest one level down, or for the root, when its signature does not verify
+	Error error
+}
+
+// ChainResult holds the chain of ancestor manifests of a subtree verified by VerifySubtree
+type ChainResult struct {
+	// SubtreePath is the path of the subtree relative to the root
+	SubtreePath string
+	// Links lists the ancestors from the root down to the parent of the subtree
+	Links []ChainLink
+	// RootAudit is the result of auditing the root manifest, the trust in its auditors is in Result.AuditorStatuses
+	RootAudit AuditResult
+}
+
+// Broken returns the first link of the chain with an error, nil when the chain is intact
+func (c *ChainResult) Broken() *ChainLink {
+	if c == nil {
+		return nil
+	}
+	for i := range c.Links {
+		if c.Links[i].Error != nil {
+			return &c.Links[i]
+		}
+	}
+	return nil
+}
+
+// VerifySubtree verifies the tree rooted at subtreePath like Verify and proves that it belongs to a tree whose
+// root manifest is signed. The manifests of the ancestors are read from ancestorsRoot, laid out like the original
+// tree, where the subtree is at relPath. Every ancestor must record the checksum of the manifest one level down,
+// the last one that of the manifest in subtreePath. The chain is reported in Result.Chain; when it is intact and
+// the root is audited, the valid manifests of the subtree are audited through it, see ManifestVerificationStatus.
+func (v *Verifier) VerifySubtree(ctx context.Context, subtreePath, ancestorsRoot, relPath string) (*Result, error) {
+	elems, err := splitSubtreePath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	// The root is audited before the walk, so that the trust in its auditors is verified with the others
+	chain := v.verifyChain(subtreePath, ancestorsRoot, elems)
+	covered := chain.Broken() == nil
+	result, err := v.verify(ctx, subtreePath, v.scanner.Walk, covered)
+	if result == nil {
+		return nil, err
+	}
+	result.Chain = chain
+	if chain.RootAudit.IsAudited && len(chain.Links) > 0 {
+		if result.Auditors == nil {
+			result.Auditors = make(map[issuer.Reference]AuditorSummary)
+		}
+		rootPath := filepath.Dir(chain.Links[0].ManifestPath)
+		for _, auditor := range chain.RootAudit.Auditors {
+			summary := result.Auditors[auditor.Reference]
+			summary.ManifestCount++
+			summary.Directories = append([]string{rootPath}, summary.Directories...)
+			result.Auditors[auditor.Reference] = summary
+		}
+	}
+	return result, err
+}
+
+// splitSubtreePath returns the directory names of relPath, the path of a subtree below the root
+func splitSubtreePath(relPath string) ([]string, error) {
+	cleaned := filepath.Clean(relPath)
+	if relPath == "" || cleaned == "." || filepath.IsAbs(cleaned) || cleaned == ".." ||
+		strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("invalid subtree path '%s', expected a path below the root", relPath)
+	}
+	return strings.Split(filepath.ToSlash(cleaned), "/"), nil
+}
+
+// verifyChain checks the ancestor manifests from the root down to the parent of the subtree at elems.
+// Every link is checked, so that all broken levels are reported, not only the first one.
+func (v *Verifier) verifyChain(subtreePath, ancestorsRoot string, elems []string) *ChainResult {
+	chain := &ChainResult{SubtreePath: filepath.Join(elems...)}
+	// Data of the manifests at every level, the last one being the subtree's own
+	data := make([][]byte, len(elems)+1)
+	errs := make([]error, len(elems)+1)
+	paths := make([]string, len(elems)+1)
+	for level := range elems {
+		paths[level] = filepath.Join(append([]string{ancestorsRoot}, elems[:level]...)...)
+	}
+	paths[len(elems)] = subtreePath
+	for level, dirPath := range paths {
+		manifestPath := filepath.Join(dirPath, v.scanner.ManifestName(dirPath, level == 0))
+		data[level], errs[level] = os.ReadFile(manifestPath)
+		if errors.Is(errs[level], fs.ErrNotExist) {
+			errs[level] = fmt.Errorf("%w: %s", ErrManifestNotFound, manifestPath)
+		}
+		paths[level] = manifestPath
+	}
+
+	for level, name := range elems {
+		link := ChainLink{Level: level, RelativePath: filepath.Join(append([]string{"."}, elems[:level]...)...),
+			ManifestPath: paths[level]}
+		link.Error = errs[level]
+		var m *manifest.Manifest
+		if link.Error == nil {
+			m, link.Error = manifest.Parse(data[level])
+		}
+		if link.Error == nil && level == 0 {
+			chain.RootAudit = v.auditor.Verify(m)
+			switch {
+			case !chain.RootAudit.IsAudited:
+				link.Error = ErrUnsignedRoot
+			case chain.RootAudit.Error != nil:
+				link.Error = fmt.Errorf("root %w: %w", ErrAuditFailed, chain.RootAudit.Error)
+			}
+		}
+		// A missing or unreadable ancestor breaks its own level, not the one of its parent
+		childMissing := errs[level+1] != nil && level+1 < len(elems)
+		if link.Error == nil && !childMissing {
+			link.Error = checkLink(m, name, data[level+1], errs[level+1])
+		}
+		chain.Links = append(chain.Links, link)
+	}
+	return chain
+}
+
+// checkLink checks that m records the directory name with the checksum of its manifest stored as childData
+func checkLink(m *manifest.Manifest, name string, childData []byte, childErr error) error {
+	var entity *manifest.Entity
+	for i := range m.Entities {
+		if m.Entities[i].Name == name {
+			entity = &m.Entities[i]
+			break
+		}
+	}
+	if entity == nil || !entity.IsDir {
+		return fmt.Errorf("does not record directory '%s'", name)
+	}
+	if childErr != nil {
+		return fmt.Errorf("cannot check directory '%s': %w", name, childErr)
+	}
+	if checksum := scanner.ManifestChecksum(childData); !manifest.SecureEqualHex(checksum, entity.Checksum) {
+		return fmt.Errorf("records checksum %s for directory '%s', but its manifest has %s", entity.Checksum, name, checksum)
+	}
+	return nil
+}
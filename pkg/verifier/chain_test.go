@@ -0,0 +1,109 @@
+package verifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// createSignedTree creates a 3-level tree, root/dataset/v3, whose root manifest only is signed
+func createSignedTree(t *testing.T) string {
+	root := createTree(t, map[string]string{
+		"readme.txt":               "content",
+		"dataset/index.txt":        "content",
+		"dataset/v3/data.bin":      "content",
+		"dataset/v3/part/more.bin": "content",
+	})
+	keyPath := filepath.Join(t.TempDir(), "key")
+	_, _, err := signing.GenerateKeyPair(keyPath, keyPath+".pub")
+	require.NoError(t, err)
+	signer, err := signing.NewEd25519SignerFromFile(keyPath, "custom:tester")
+	require.NoError(t, err)
+	require.NoError(t, generator.New(scanner.New(), signer, generator.WithSignRootOnly(true)).Generate(context.Background(), root))
+	return root
+}
+
+func newChainVerifier() *Verifier {
+	return New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier())
+}
+
+func TestVerifier_VerifySubtree_FromLeaf_mustLinkToSignedRoot(t *testing.T) {
+	root := createSignedTree(t)
+
+	result, err := newChainVerifier().VerifySubtree(context.Background(), filepath.Join(root, "dataset", "v3"), root,
+		filepath.Join("dataset", "v3"))
+
+	require.NoError(t, err)
+	require.NotNil(t, result.Chain)
+	assert.Nil(t, result.Chain.Broken())
+	require.Len(t, result.Chain.Links, 2)
+	assert.Equal(t, ".", result.Chain.Links[0].RelativePath)
+	assert.Equal(t, "dataset", result.Chain.Links[1].RelativePath)
+	assert.Equal(t, 1, result.Chain.Links[1].Level)
+	assert.True(t, result.Chain.RootAudit.IsAudited)
+	assert.Equal(t, Summary{Found: 2, Verified: 2, Audited: 2, Inherited: 2}, result.Summary())
+	assert.Contains(t, result.Auditors, issuer.Reference("custom:tester"))
+}
+
+func TestVerifier_VerifySubtree_WithMissingAncestor_mustReportItsLevel(t *testing.T) {
+	root := createSignedTree(t)
+	require.NoError(t, os.Remove(filepath.Join(root, "dataset", manifest.DefaultName)))
+
+	result, err := newChainVerifier().VerifySubtree(context.Background(), filepath.Join(root, "dataset", "v3"), root,
+		filepath.Join("dataset", "v3"))
+
+	require.NoError(t, err)
+	broken := result.Chain.Broken()
+	require.NotNil(t, broken)
+	assert.Equal(t, 1, broken.Level)
+	assert.ErrorContains(t, broken.Error, "not found")
+	assert.NoError(t, result.Chain.Links[0].Error, "the root cannot check a missing manifest")
+	assert.Zero(t, result.Summary().Inherited)
+}
+
+func TestVerifier_VerifySubtree_WithRegeneratedSubtree_mustBreakAtParent(t *testing.T) {
+	root := createSignedTree(t)
+	leaf := filepath.Join(root, "dataset", "v3")
+	require.NoError(t, os.WriteFile(filepath.Join(leaf, "data.bin"), []byte("replaced"), 0644))
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), leaf))
+
+	result, err := newChainVerifier().VerifySubtree(context.Background(), leaf, root, filepath.Join("dataset", "v3"))
+
+	require.NoError(t, err)
+	assert.False(t, result.HasFailures(), "the subtree matches its own manifests")
+	broken := result.Chain.Broken()
+	require.NotNil(t, broken)
+	assert.Equal(t, 1, broken.Level)
+	assert.ErrorContains(t, broken.Error, "for directory 'v3'")
+}
+
+func TestVerifier_VerifySubtree_WithUnsignedRoot_mustBreakAtRoot(t *testing.T) {
+	root := createSignedTree(t)
+	require.NoError(t, generator.New(scanner.New(), nil, generator.WithStripSignatures(true)).Generate(context.Background(), root))
+
+	result, err := newChainVerifier().VerifySubtree(context.Background(), filepath.Join(root, "dataset", "v3"), root,
+		filepath.Join("dataset", "v3"))
+
+	require.NoError(t, err)
+	broken := result.Chain.Broken()
+	require.NotNil(t, broken)
+	assert.Equal(t, 0, broken.Level)
+	assert.ErrorIs(t, broken.Error, ErrUnsignedRoot)
+}
+
+func TestVerifier_VerifySubtree_WithPathOutsideRoot_mustFail(t *testing.T) {
+	root := createSignedTree(t)
+
+	_, err := newChainVerifier().VerifySubtree(context.Background(), root, root, "../other")
+
+	assert.ErrorContains(t, err, "invalid subtree path")
+}
@@ -0,0 +1,50 @@
+package verifier
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"golang.org/x/crypto/ssh"
+)
+
+// DetachedSignatureResult is the outcome of checking a detached signature of the root digest,
+// see CheckDetachedSignature
+type DetachedSignatureResult struct {
+	// Principals are the principals of the allowed signer whose key made the signature, nil when none did
+	Principals []string
+	// Fingerprint is the SHA256 fingerprint of that key, e.g. "SHA256:..."
+	Fingerprint string
+	// Error tells why the signature was rejected, nil when it is valid
+	Error error
+}
+
+// CheckDetachedSignature checks that signature, armored like `ssh-keygen -Y sign` output, signs the recomputed
+// root digest of result and was made by one of signers whose principals match identity, see
+// signing.AllowedSigner.Matches and signing.VerifyDigestSignature. The root digest only describes the tree when
+// every manifest matches its directory and was rehashed, otherwise the signature is rejected unchecked: shallow
+// manifests, see ManifestVerificationStatus.Shallow, were reused without checking their directories.
+func CheckDetachedSignature(result *Result, signature []byte, signers []signing.AllowedSigner, identity string,
+	now time.Time) *DetachedSignatureResult {
+	if result.HasFailures() {
+		return &DetachedSignatureResult{Error: fmt.Errorf("not checked, %d manifest(s) do not match their directories",
+			result.Summary().Invalid)}
+	}
+	if shallow := result.Summary().Shallow; shallow > 0 {
+		return &DetachedSignatureResult{Error: fmt.Errorf("not checked, %d manifest(s) were reused without rehashing"+
+			" their directories", shallow)}
+	}
+	if result.RootDigest == "" {
+		return &DetachedSignatureResult{Error: fmt.Errorf("not checked, the root digest is unknown")}
+	}
+	signers = signing.SignersFor(signers, identity)
+	if len(signers) == 0 {
+		return &DetachedSignatureResult{Error: fmt.Errorf("%w: no allowed signer for identity '%s'",
+			signing.ErrSignerNotAllowed, identity)}
+	}
+	signer, err := signing.VerifyDigestSignature(signature, result.RootDigest, signers, now)
+	if err != nil {
+		return &DetachedSignatureResult{Error: err}
+	}
+	return &DetachedSignatureResult{Principals: signer.Principals, Fingerprint: ssh.FingerprintSHA256(signer.PublicKey)}
+}
@@ -0,0 +1,88 @@
+package verifier
+
+import (
+	"path/filepath"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// JunkPatterns match the names of files that desktop environments create on their own, e.g. when a folder is
+// browsed, see IsJunk
+var JunkPatterns = []string{".DS_Store", "._*", "Thumbs.db", "ehthumbs.db", "desktop.ini", ".directory"}
+
+// IsJunk reports whether name, an entity name, matches one of JunkPatterns
+func IsJunk(name string) bool {
+	for _, pattern := range JunkPatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// DirectoryExplanation tells how the differences of a failed directory relate to the rest of the result
+type DirectoryExplanation struct {
+	// Derived marks the differences, by index in DirectoryVerificationStatus.Differences, that are consequences
+	// of changes in subdirectories: the checksum of a subdirectory that failed itself, and the subtree totals
+	// when the directory has other differences
+	Derived []bool
+	// Benign is set when the differences that are not derived are all extra files matching JunkPatterns
+	Benign bool
+}
+
+// AllDerived reports whether every difference of the directory is a consequence of changes in subdirectories,
+// so that it needs no attention of its own
+func (e DirectoryExplanation) AllDerived() bool {
+	for _, derived := range e.Derived {
+		if !derived {
+			return false
+		}
+	}
+	return len(e.Derived) > 0
+}
+
+// Explain correlates the differences of the failed directories, keyed by relative path. A parent records the
+// checksums of the manifests of its subdirectories, so a changed file fails its directory and every ancestor
+// up to the root. Directories without differences, e.g. with an invalid manifest, are left out.
+func (r *Result) Explain() map[string]DirectoryExplanation {
+	failed := make(map[string]bool, len(r.DirectoryStatuses))
+	for _, status := range r.DirectoryStatuses {
+		if status.ManifestStatus.Found && !status.ManifestStatus.Valid {
+			failed[status.RelativePath] = true
+		}
+	}
+
+	explanations := make(map[string]DirectoryExplanation)
+	for _, status := range r.DirectoryStatuses {
+		if !failed[status.RelativePath] || len(status.Differences) == 0 {
+			continue
+		}
+		explanations[status.RelativePath] = ExplainDirectory(status, failed)
+	}
+	return explanations
+}
+
+// ExplainDirectory correlates the differences of status with failed, the relative paths of the failed directories,
+// see Result.Explain. Subdirectories are verified first, so failures can be explained as they are verified, see
+// WithStatusSink.
+func ExplainDirectory(status DirectoryVerificationStatus, failed map[string]bool) DirectoryExplanation {
+	explanation := DirectoryExplanation{Derived: make([]bool, len(status.Differences))}
+	for i, diff := range status.Differences {
+		if diff.Type == manifest.DiffChecksumMismatch {
+			explanation.Derived[i] = diff.ExpectedEntity != nil && diff.ExpectedEntity.IsDir &&
+				failed[filepath.Join(status.RelativePath, diff.Name)]
+		}
+	}
+
+	explanation.Benign = !explanation.AllDerived()
+	for i, diff := range status.Differences {
+		if explanation.Derived[i] {
+			continue
+		}
+		if diff.Type != manifest.DiffMissingInA || diff.ActualEntity == nil || diff.ActualEntity.IsDir ||
+			!IsJunk(diff.Name) {
+			explanation.Benign = false
+		}
+	}
+	return explanation
+}
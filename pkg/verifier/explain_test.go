@@ -0,0 +1,117 @@
+package verifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// failedStatus returns the status of a directory whose manifest does not match it
+func failedStatus(rel string, differences ...manifest.EntityDifference) DirectoryVerificationStatus {
+	return DirectoryVerificationStatus{Path: "/data/" + rel, RelativePath: rel, Differences: differences,
+		ManifestStatus: ManifestVerificationStatus{Found: true}}
+}
+
+// validStatus returns the status of a directory whose manifest matches it
+func validStatus(rel string) DirectoryVerificationStatus {
+	return DirectoryVerificationStatus{Path: "/data/" + rel, RelativePath: rel,
+		ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true}}
+}
+
+func dirChanged(name string) manifest.EntityDifference {
+	return manifest.EntityDifference{Name: name, Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: name, IsDir: true}, ActualEntity: &manifest.Entity{Name: name, IsDir: true}}
+}
+
+func fileChanged(name string) manifest.EntityDifference {
+	return manifest.EntityDifference{Name: name, Type: manifest.DiffChecksumMismatch,
+		ExpectedEntity: &manifest.Entity{Name: name}, ActualEntity: &manifest.Entity{Name: name}}
+}
+
+func extraFile(name string) manifest.EntityDifference {
+	return manifest.EntityDifference{Name: name, Type: manifest.DiffMissingInA, ActualEntity: &manifest.Entity{Name: name}}
+}
+
+func TestResult_Explain_mustMarkAncestorsOfChangedDirectoriesAsDerived(t *testing.T) {
+	result := NewResult([]DirectoryVerificationStatus{
+		failedStatus(".", dirChanged("a")),
+		failedStatus("a", dirChanged("b")),
+		failedStatus("a/b", fileChanged("b.txt")),
+		validStatus("c"),
+	}, nil, nil)
+
+	explanations := result.Explain()
+
+	assert.Equal(t, map[string]DirectoryExplanation{
+		".":   {Derived: []bool{true}},
+		"a":   {Derived: []bool{true}},
+		"a/b": {Derived: []bool{false}},
+	}, explanations)
+	assert.True(t, explanations["."].AllDerived())
+	assert.False(t, explanations["a/b"].AllDerived())
+}
+
+func TestResult_Explain_WithOwnChanges_mustNotCollapseParent(t *testing.T) {
+	result := NewResult([]DirectoryVerificationStatus{
+		failedStatus(".", dirChanged("a"), fileChanged("root.txt")),
+		failedStatus("a", fileChanged("a.txt")),
+	}, nil, nil)
+
+	explanation := result.Explain()["."]
+
+	assert.Equal(t, []bool{true, false}, explanation.Derived)
+	assert.False(t, explanation.AllDerived())
+	assert.False(t, explanation.Benign)
+}
+
+func TestResult_Explain_WithChangedChecksumOfValidSubdirectory_mustNotBeDerived(t *testing.T) {
+	// The subdirectory matches its manifest, so the parent itself records a different checksum, e.g. tampered
+	result := NewResult([]DirectoryVerificationStatus{
+		failedStatus(".", dirChanged("a")),
+		validStatus("a"),
+	}, nil, nil)
+
+	explanations := result.Explain()
+
+	assert.Equal(t, []bool{false}, explanations["."].Derived)
+}
+
+func TestResult_Explain_WithInvalidManifestInSubdirectory_mustMarkParentAsDerived(t *testing.T) {
+	invalid := failedStatus("a")
+	invalid.ManifestError = manifest.ErrInvalidManifest
+	result := NewResult([]DirectoryVerificationStatus{failedStatus(".", dirChanged("a")), invalid}, nil, nil)
+
+	explanations := result.Explain()
+
+	assert.True(t, explanations["."].AllDerived())
+	assert.NotContains(t, explanations, "a", "directories without differences are left out")
+}
+
+func TestResult_Explain_WithJunkFilesOnly_mustBeBenign(t *testing.T) {
+	result := NewResult([]DirectoryVerificationStatus{
+		failedStatus(".", dirChanged("photos"), dirChanged("docs"), dirChanged("mixed"), dirChanged("dir")),
+		failedStatus("photos", extraFile(".DS_Store"), extraFile("._IMG_0001.jpg")),
+		failedStatus("docs", extraFile("Thumbs.db"), extraFile("desktop.ini")),
+		failedStatus("mixed", extraFile(".DS_Store"), extraFile("notes.txt")),
+		failedStatus("dir", manifest.EntityDifference{Name: ".DS_Store", Type: manifest.DiffMissingInA,
+			ActualEntity: &manifest.Entity{Name: ".DS_Store", IsDir: true}}),
+	}, nil, nil)
+
+	explanations := result.Explain()
+
+	assert.True(t, explanations["photos"].Benign)
+	assert.True(t, explanations["docs"].Benign)
+	assert.False(t, explanations["mixed"].Benign)
+	assert.False(t, explanations["dir"].Benign, "only files are junk")
+	assert.False(t, explanations["."].Benign, "derived directories are collapsed rather than benign")
+}
+
+func TestIsJunk(t *testing.T) {
+	for _, name := range []string{".DS_Store", "._report.pdf", "Thumbs.db", "desktop.ini"} {
+		assert.True(t, IsJunk(name), name)
+	}
+	for _, name := range []string{"DS_Store", "report.pdf", "thumbs.db.bak"} {
+		assert.False(t, IsJunk(name), name)
+	}
+}
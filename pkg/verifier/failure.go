@@ -0,0 +1,82 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrVerificationFailed is the Kind of the failures of trees that do not match their manifests, see Result.Failure
+var ErrVerificationFailed = errors.New("verification failed")
+
+// Failure is the reason a completed verification failed, see Result.Failure
+type Failure struct {
+	// Kind is ErrVerificationFailed, ErrManifestNotFound or ErrAuditFailed for failures of trust
+	Kind error
+	// Err explains the failure
+	Err error
+	// Short summarizes the failure in a few words, e.g. for a status badge
+	Short string
+}
+
+// Failure returns the first reason the verification failed, nil when it passed. The checks and their order are
+// the ones of bytecheck.VerifyReport.Err, so that every summary of a run tells the same. Interrupted
+// verifications are only judged by what they verified until then.
+func (r *Result) Failure() *Failure {
+	fail := func(kind error, short string, err error) *Failure {
+		return &Failure{Kind: kind, Err: err, Short: short}
+	}
+	if broken := r.Chain.Broken(); broken != nil {
+		kind := ErrVerificationFailed
+		if errors.Is(broken.Error, ErrUnsignedRoot) || errors.Is(broken.Error, ErrAuditFailed) {
+			kind = ErrAuditFailed
+		}
+		return fail(kind, "broken chain", fmt.Errorf("chain of manifests broken at level %d (%s): %w",
+			broken.Level, broken.ManifestPath, broken.Error))
+	}
+	if summary := r.Summary(); summary.Found == 0 && summary.Unmanaged > 0 {
+		return fail(ErrManifestNotFound, "no manifests", fmt.Errorf("no manifests found, all %d director(ies) are unmanaged",
+			summary.Unmanaged))
+	}
+	if r.HasFailures() {
+		return fail(ErrVerificationFailed, "failed",
+			fmt.Errorf("%d manifest(s) do not match their directories", r.Summary().Invalid))
+	}
+	if len(r.MissingLabels) > 0 {
+		return fail(ErrVerificationFailed, "missing labels", fmt.Errorf("root manifest lacks required label(s): %s",
+			strings.Join(r.MissingLabels, ", ")))
+	}
+	if r.UntrustedLabels {
+		return fail(ErrAuditFailed, "untrusted labels",
+			fmt.Errorf("required labels are only trusted in a root manifest signed by a trusted auditor"))
+	}
+	if detached := r.DetachedSignature; detached != nil && detached.Error != nil {
+		return fail(ErrAuditFailed, "detached signature rejected",
+			fmt.Errorf("detached signature rejected: %w", detached.Error))
+	}
+	if expired := r.ExpiredAuditors(); len(expired) > 0 {
+		return fail(ErrAuditFailed, fmt.Sprintf("%d expired auditor%s", len(expired), plural(len(expired))),
+			fmt.Errorf("certificate(s) of %d auditor(s) expired or not yet valid", len(expired)))
+	}
+	if mismatches := r.PinMismatches(); len(mismatches) > 0 {
+		return fail(ErrAuditFailed, "pinned key mismatch",
+			fmt.Errorf("key(s) of %d auditor(s) differ from the keys pinned by the trust anchors", len(mismatches)))
+	}
+	if r.SingleAuditorRunViolated() {
+		return fail(ErrAuditFailed, "mixed auditor runs", fmt.Errorf("%d auditor(s) signed the tree in more than one run",
+			len(r.MixedAuditorSubjects)))
+	}
+	if r.UnsignedViolated() {
+		return fail(ErrAuditFailed, fmt.Sprintf("%d unsigned", r.Signing.Unsigned),
+			fmt.Errorf("%d manifest(s) are unsigned", r.Signing.Unsigned))
+	}
+	if r.UntrustedViolated() {
+		return fail(ErrAuditFailed, fmt.Sprintf("%d not trusted", r.Signing.Unverifiable),
+			fmt.Errorf("%d signed manifest(s) have no trusted auditor", r.Signing.Unverifiable))
+	}
+	if r.PolicyViolated() {
+		return fail(ErrAuditFailed, "auditor policy violated",
+			fmt.Errorf("auditor policy violated: %d violation(s)", r.Policy.Violations()))
+	}
+	return nil
+}
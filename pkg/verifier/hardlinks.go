@@ -0,0 +1,69 @@
+package verifier
+
+import (
+	"path/filepath"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// linkChecker tells the files recorded as hard links of the same file which are no longer linked together.
+// Link groups identify inodes, which change when a tree is copied, so only the links recorded in one group
+// are compared with each other: they must all still share a group, whichever it is now.
+type linkChecker struct {
+	// groups holds the first link checked of every recorded group
+	groups map[string]linkMember
+}
+
+// linkMember is a link checked by linkChecker
+type linkMember struct {
+	// current identifies the file of the link now, the links of a group must share it
+	current string
+	// path is relative to the verified root
+	path string
+}
+
+func newLinkChecker() *linkChecker {
+	return &linkChecker{groups: make(map[string]linkMember)}
+}
+
+// check returns a manifest.DiffHardlinkBroken difference for every entity of existing, the manifest of the
+// directory at relativePath, that is no longer linked with the links of its group checked before. Both
+// manifests must track hard links, see manifest.Manifest.Hardlinks. Missing entities are reported by
+// manifest.CompareManifests.
+func (c *linkChecker) check(relativePath string, existing, computed *manifest.Manifest) []manifest.EntityDifference {
+	if !existing.Hardlinks || !computed.Hardlinks {
+		return nil
+	}
+	actual := make(map[string]*manifest.Entity, len(computed.Entities))
+	for i := range computed.Entities {
+		actual[computed.Entities[i].Name] = &computed.Entities[i]
+	}
+	var differences []manifest.EntityDifference
+	for i := range existing.Entities {
+		expected := &existing.Entities[i]
+		entity, ok := actual[expected.Name]
+		if expected.LinkGroup == "" || !ok {
+			continue
+		}
+		member := linkMember{current: entity.LinkGroup, path: filepath.Join(relativePath, expected.Name)}
+		// A file with a single link left is a group of its own
+		if member.current == "" {
+			member.current = "unlinked:" + member.path
+		}
+		first, seen := c.groups[expected.LinkGroup]
+		if !seen {
+			c.groups[expected.LinkGroup] = member
+			continue
+		}
+		if first.current != member.current {
+			differences = append(differences, manifest.EntityDifference{
+				Name:           expected.Name,
+				Type:           manifest.DiffHardlinkBroken,
+				ExpectedEntity: expected,
+				ActualEntity:   entity,
+				LinkedTo:       first.path,
+			})
+		}
+	}
+	return differences
+}
@@ -0,0 +1,52 @@
+package verifier
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func linkedManifest(groups map[string]string) *manifest.Manifest {
+	m := &manifest.Manifest{Hardlinks: true}
+	for name, group := range groups {
+		m.Entities = append(m.Entities, manifest.Entity{Name: name, Checksum: "sum", LinkGroup: group})
+	}
+	return m
+}
+
+func TestLinkChecker_WithCopiedTree_mustCompareGroupsRelationally(t *testing.T) {
+	links := newLinkChecker()
+	// Copies of a tree link the same files together under other inodes
+	assert.Empty(t, links.check("a", linkedManifest(map[string]string{"x": "g1", "y": "g2"}),
+		linkedManifest(map[string]string{"x": "c1", "y": "c2"})))
+	assert.Empty(t, links.check("b", linkedManifest(map[string]string{"x": "g1", "y": "g2"}),
+		linkedManifest(map[string]string{"x": "c1", "y": "c2"})))
+}
+
+func TestLinkChecker_WithBrokenLink_mustReportIt(t *testing.T) {
+	links := newLinkChecker()
+	require.Empty(t, links.check("a", linkedManifest(map[string]string{"x": "g1"}),
+		linkedManifest(map[string]string{"x": "c1"})))
+
+	differences := links.check("b", linkedManifest(map[string]string{"x": "g1", "y": "g1"}),
+		linkedManifest(map[string]string{"x": "c1", "y": ""}))
+	require.Len(t, differences, 1)
+	assert.Equal(t, "y", differences[0].Name)
+	assert.Equal(t, manifest.DiffHardlinkBroken, differences[0].Type)
+	assert.Equal(t, filepath.Join("a", "x"), differences[0].LinkedTo)
+
+	report, ok := newReportDifference("b", differences[0])
+	require.True(t, ok)
+	assert.Equal(t, ReportHardlink, report.Type)
+	assert.Equal(t, filepath.Join("a", "x"), report.LinkedTo)
+}
+
+func TestLinkChecker_WithoutTracking_mustIgnoreGroups(t *testing.T) {
+	links := newLinkChecker()
+	untracked := linkedManifest(map[string]string{"x": "", "y": ""})
+	untracked.Hardlinks = false
+	assert.Empty(t, links.check(".", linkedManifest(map[string]string{"x": "g1", "y": "g1"}), untracked))
+}
@@ -0,0 +1,66 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+// ErrHiddenPolicyMismatch is wrapped by the error of a verification finding a manifest generated with another
+// hidden policy than the scanner's, see scanner.WithHiddenPolicy
+var ErrHiddenPolicyMismatch = errors.New("hidden policy changed since generation")
+
+// hiddenPolicyOf returns the policy the entities of m were listed with, see manifest.Manifest.HiddenPolicy
+func hiddenPolicyOf(m *manifest.Manifest) scanner.HiddenPolicy {
+	if m.HiddenPolicy == "" {
+		return scanner.HiddenInclude
+	}
+	return scanner.HiddenPolicy(m.HiddenPolicy)
+}
+
+// checkHiddenPolicy fails unless m, the manifest of dirPath, was generated with the hidden policy of the scanner.
+// Hidden entries would otherwise all be reported as missing or extra.
+func (v *Verifier) checkHiddenPolicy(dirPath string, m *manifest.Manifest) error {
+	if policy := hiddenPolicyOf(m); policy != v.scanner.GetHiddenPolicy() {
+		return fmt.Errorf("%w: directory '%s' was generated with hidden policy '%s', not '%s'",
+			ErrHiddenPolicyMismatch, dirPath, policy, v.scanner.GetHiddenPolicy())
+	}
+	return nil
+}
+
+// tagHiddenDifferences sets manifest.EntityDifference.Hidden for the differences of the directory at relativePath
+// involving hidden entries, all of them when the directory is below a hidden one, and reports whether the directory
+// differs only in hidden entries. hiddenOnly holds the relative paths of the subdirectories it reported so for:
+// the checksums of their manifests differ only because of hidden entries.
+func tagHiddenDifferences(relativePath string, differences []manifest.EntityDifference, hiddenOnly map[string]bool) bool {
+	below := hiddenPath(relativePath)
+	hidden, others := false, false
+	for i := range differences {
+		diff := &differences[i]
+		switch {
+		case below || manifest.IsHidden(diff.Name):
+			diff.Hidden = true
+			hidden = true
+		case diff.Type == manifest.DiffChecksumMismatch && diff.ExpectedEntity != nil && diff.ExpectedEntity.IsDir &&
+			hiddenOnly[filepath.Join(relativePath, diff.Name)]:
+			hidden = true
+		default:
+			others = true
+		}
+	}
+	return hidden && !others
+}
+
+// hiddenPath reports whether one of the directories of relativePath is hidden
+func hiddenPath(relativePath string) bool {
+	for _, name := range strings.Split(filepath.ToSlash(relativePath), "/") {
+		if manifest.IsHidden(name) {
+			return true
+		}
+	}
+	return false
+}
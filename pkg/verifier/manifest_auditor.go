@@ -1,12 +1,20 @@
 package verifier
 
 import (
+	"encoding/hex"
 	"fmt"
 	"github.com/tomekjarosik/bytecheck/pkg/issuer"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"time"
 )
 
+// DefaultMaxClockSkew is how far in the future auditor timestamps may be before they are reported
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// DefaultExpiryWarning is how soon before expiring auditor certificates are reported, see AuditorResult.ExpiresIn
+const DefaultExpiryWarning = 7 * 24 * time.Hour
+
 type ManifestAuditor interface {
 	Verify(m *manifest.Manifest) AuditResult
 	GetIssuers() []issuer.Issuer
@@ -16,83 +24,219 @@ type ManifestAuditor interface {
 // It also collects all unique issuer references from the certificates it successfully verifies.
 type SimpleManifestAuditor struct {
 	trustedIssuers map[string]issuer.Issuer
+	maxClockSkew   time.Duration
+	expiryWarning  time.Duration
+	now            func() time.Time
+	// unsignedTimestamps holds issuer references with at least one manifest lacking an attributes signature
+	unsignedTimestamps map[string]bool
+}
+
+// AuditorOption configures a SimpleManifestAuditor
+type AuditorOption func(a *SimpleManifestAuditor)
+
+// WithMaxClockSkew sets how far in the future auditor timestamps may be, see AuditorResult.ClockSkew
+func WithMaxClockSkew(skew time.Duration) AuditorOption {
+	return func(a *SimpleManifestAuditor) {
+		a.maxClockSkew = skew
+	}
+}
+
+// WithExpiryWarning sets how soon before expiring certificates are reported, see AuditorResult.ExpiresIn
+func WithExpiryWarning(window time.Duration) AuditorOption {
+	return func(a *SimpleManifestAuditor) {
+		a.expiryWarning = window
+	}
 }
 
 // NewSimpleManifestAuditor creates a new ManifestAuditor.
-func NewSimpleManifestAuditor() *SimpleManifestAuditor {
-	return &SimpleManifestAuditor{
-		trustedIssuers: make(map[string]issuer.Issuer),
+func NewSimpleManifestAuditor(opts ...AuditorOption) *SimpleManifestAuditor {
+	a := &SimpleManifestAuditor{
+		trustedIssuers:     make(map[string]issuer.Issuer),
+		maxClockSkew:       DefaultMaxClockSkew,
+		expiryWarning:      DefaultExpiryWarning,
+		now:                time.Now,
+		unsignedTimestamps: make(map[string]bool),
 	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
 }
 
 // AuditResult holds the results of an audit verification.
+// Error is the first error reported by any of the auditors.
 type AuditResult struct {
 	IsAudited bool
 	Error     error
+	Auditors  []AuditorResult
+}
+
+// AuditorResult holds the verification result of a single auditor section.
+type AuditorResult struct {
+	Reference issuer.Reference
+	Error     error
+	// ClockSkew is how far the signed auditor timestamp lies in the future when that exceeds the allowed skew.
+	// It usually means clock skew on the auditor's machine.
+	ClockSkew time.Duration
+	// ExpiresIn is the time left until the certificate expires when that is within the expiry warning window,
+	// see WithExpiryWarning, zero otherwise
+	ExpiresIn time.Duration
+	// SubjectKey is the fingerprint of the key that signed the manifest, the ephemeral key certified by the issuer
+	// for one generate run, see issuer.Fingerprint. It is empty unless the manifest signature is valid.
+	SubjectKey string
+	// Timestamp is when the auditor signed the manifest, as recorded by it
+	Timestamp time.Time
 }
 
 // GetIssuers returns a slice of all unique issuer references
 // encountered during the verification process so far.
+// An issuer carries signing times only if all its manifests signed their timestamps.
 func (a *SimpleManifestAuditor) GetIssuers() []issuer.Issuer {
 	refs := make([]issuer.Issuer, 0, len(a.trustedIssuers))
-	for _, val := range a.trustedIssuers {
+	for ref, val := range a.trustedIssuers {
+		if a.unsignedTimestamps[ref] {
+			val.FirstSigned, val.LastSigned = time.Time{}, time.Time{}
+		}
 		refs = append(refs, val)
 	}
 	return refs
 }
 
-// Verify audits a given manifest, checking its signature and certificate through a two-step process.
+// Verify audits a given manifest, checking the signature and certificate of every auditor.
 func (a *SimpleManifestAuditor) Verify(m *manifest.Manifest) AuditResult {
-	if m.Auditor == nil {
+	if !m.IsAudited() {
 		return AuditResult{IsAudited: false}
 	}
 
-	auditorCert := m.GetAuditorCertificate()
-	if auditorCert == nil {
-		return AuditResult{IsAudited: true, Error: fmt.Errorf("auditor data present but certificate is missing")}
+	result := AuditResult{IsAudited: true}
+	for i := range m.Auditors {
+		auditorResult := a.verifyAuditor(m, &m.Auditors[i])
+		if auditorResult.Error != nil && result.Error == nil {
+			result.Error = auditorResult.Error
+		}
+		result.Auditors = append(result.Auditors, auditorResult)
 	}
+	return result
+}
 
-	dataToSign := append(auditorCert.PublicKey()[:], []byte(auditorCert.IssuerReference())...)
+// verifyAuditor checks a single auditor's signature and certificate through a two-step process.
+func (a *SimpleManifestAuditor) verifyAuditor(m *manifest.Manifest, auditor *manifest.AuditorData) AuditorResult {
+	result := AuditorResult{Reference: issuer.Reference(auditor.Certificate.IssuerRef), Timestamp: auditor.Timestamp}
+	auditorCert, err := auditor.DecodeCertificate()
+	if err != nil {
+		result.Error = err
+		return result
+	}
 
-	valid, err := signing.VerifySignature(auditorCert.SignatureAlgorithm(), auditorCert.IssuerPublicKey(), dataToSign, auditorCert.Signature())
+	valid, err := signing.VerifyCertificate(auditorCert)
 	if err != nil {
-		return AuditResult{IsAudited: true, Error: fmt.Errorf("failed to verify auditor certificate signature: %w", err)}
+		result.Error = fmt.Errorf("failed to verify auditor certificate signature: %w", err)
+		return result
 	}
 	if !valid {
-		return AuditResult{IsAudited: true, Error: fmt.Errorf("auditor certificate is invalid: signature from issuer does not match")}
+		result.Error = fmt.Errorf("auditor certificate is invalid: signature from issuer does not match")
+		return result
 	}
 	// Since the certificate is valid, remember the issuer's reference for later validation
 	// against a trusted source (e.g., GitHub keys).
+	// The signing times of earlier manifests are kept, see recordSigningTime
+	previous := a.trustedIssuers[auditorCert.IssuerReference()]
 	a.trustedIssuers[auditorCert.IssuerReference()] = issuer.Issuer{
-		Reference: issuer.Reference(auditorCert.IssuerReference()),
-		PublicKey: auditorCert.IssuerPublicKey()}
+		Reference:   issuer.Reference(auditorCert.IssuerReference()),
+		PublicKey:   auditorCert.IssuerPublicKey(),
+		Certificate: auditorCert.IssuerCertificate(),
+		FirstSigned: previous.FirstSigned,
+		LastSigned:  previous.LastSigned}
 
 	// Step 2: Verify the manifest's signature.
 	// This signature must be valid when checked against the certificate's public key.
 	// This proves that the owner of the certificate's private key created the signature
 	// for this manifest's content.
-	manifestSignature := m.GetAuditorManifestSignature()
+	manifestSignature, err := auditor.DecodeManifestSignature()
+	if err != nil {
+		result.Error = err
+		return result
+	}
 	dataToVerify, err := m.DataWithoutAuditor()
 	if err != nil {
-		return AuditResult{
-			IsAudited: true,
-			Error:     fmt.Errorf("failed to prepare manifest data for signature verification: %w", err),
-		}
+		result.Error = fmt.Errorf("failed to prepare manifest data for signature verification: %w", err)
+		return result
 	}
-	valid, err = signing.VerifySignature(signing.SignatureAlgorithmEd25519, auditorCert.PublicKey(), dataToVerify, manifestSignature)
+	valid, err = signing.VerifySignature(auditor.Algorithm, auditorCert.PublicKey(), dataToVerify, manifestSignature)
 	if err != nil {
-		return AuditResult{
-			IsAudited: true,
-			Error:     fmt.Errorf("failed to verify manifest signature: %w", err),
-		}
+		result.Error = fmt.Errorf("failed to verify manifest signature: %w", err)
+		return result
 	}
 	if !valid {
-		return AuditResult{
-			IsAudited: true,
-			Error:     fmt.Errorf("manifest signature is invalid"),
+		result.Error = fmt.Errorf("manifest signature is invalid")
+		return result
+	}
+	result.SubjectKey = issuer.Fingerprint(auditorCert.PublicKey())
+
+	// Step 3: Verify the signature of the timestamp and algorithm, if any. Only a signed timestamp is used as
+	// signing time and checked for clock skew, an unsigned one could have been changed by anyone.
+	signed, err := verifyAttributes(m, auditor, auditorCert)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	if signed {
+		a.recordSigningTime(auditorCert.IssuerReference(), auditor.Timestamp)
+		if skew := auditor.Timestamp.Sub(a.now()); skew > a.maxClockSkew {
+			result.ClockSkew = skew
 		}
+	} else {
+		a.unsignedTimestamps[auditorCert.IssuerReference()] = true
+	}
+
+	// Step 4: Check the validity window of the certificate. One outside of it is rejected, however valid
+	// its signatures, so that a leaked ephemeral key cannot sign manifests forever. Legacy certificates have none.
+	now := a.now()
+	if err := signing.CheckValidity(auditorCert, now, a.maxClockSkew); err != nil {
+		result.Error = fmt.Errorf("auditor %w", err)
+		return result
+	}
+	if _, notAfter := signing.CertificateValidity(auditorCert); !notAfter.IsZero() && notAfter.Sub(now) <= a.expiryWarning {
+		result.ExpiresIn = notAfter.Sub(now)
+	}
+
+	// If all checks pass, the audit of this auditor is successful.
+	return result
+}
+
+// recordSigningTime extends the signing times of the issuer ref by the timestamp of a manifest it signed,
+// see issuer.Issuer.FirstSigned
+func (a *SimpleManifestAuditor) recordSigningTime(ref string, timestamp time.Time) {
+	iss := a.trustedIssuers[ref]
+	if iss.FirstSigned.IsZero() || timestamp.Before(iss.FirstSigned) {
+		iss.FirstSigned = timestamp
 	}
+	if timestamp.After(iss.LastSigned) {
+		iss.LastSigned = timestamp
+	}
+	a.trustedIssuers[ref] = iss
+}
 
-	// If both cryptographic checks pass, the audit is successful.
-	return AuditResult{IsAudited: true}
+// verifyAttributes checks the signature of the timestamp and algorithm of the auditor and reports whether
+// it has one
+func verifyAttributes(m *manifest.Manifest, auditor *manifest.AuditorData, cert signing.Certificate) (bool, error) {
+	if auditor.AttributesSignature == "" {
+		return false, nil
+	}
+	data, err := m.AttributesData(auditor.Timestamp, auditor.Algorithm)
+	if err != nil {
+		return false, fmt.Errorf("failed to prepare auditor attributes for signature verification: %w", err)
+	}
+	signature, err := hex.DecodeString(auditor.AttributesSignature)
+	if err != nil {
+		return false, fmt.Errorf("auditor attributes signature is invalid: %w", err)
+	}
+	valid, err := signing.VerifySignature(auditor.Algorithm, cert.PublicKey(), data, signature)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify auditor attributes signature: %w", err)
+	}
+	if !valid {
+		return false, fmt.Errorf("auditor attributes signature is invalid")
+	}
+	return true, nil
 }
@@ -0,0 +1,233 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// generateSigned generates a signed manifest of a directory with one file
+func generateSigned(t *testing.T) *manifest.Manifest {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644))
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	gen := generator.New(scanner.New(), signing.NewEd25519Signer(privKey, "custom:alice"))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	return m
+}
+
+// seededKey returns a deterministic key, so signatures over it are reproducible
+func seededKey(offset byte) ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = offset + byte(i)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestCertificate_IssuedBySigning_StoredInManifest_VerifiedByAuditor(t *testing.T) {
+	rootSigner := signing.NewEd25519Signer(seededKey(0), "github:alice")
+	manifestKey := seededKey(100)
+	cert, err := signing.IssueCertificate(rootSigner, manifestKey.Public().(ed25519.PublicKey), 0)
+	require.NoError(t, err)
+	// The certificate signature is part of the manifest format, changing the payload breaks existing manifests
+	assert.Equal(t, "57f13c8ee7739a08335d1ea612d785ef2a1e3ef8e02db3173cbc18bc58820c98"+
+		"e7c113ed1a6e1e6bfe4a48e0d5853d1a5e98b73eee3bedab19936e9bdb2f6102", hex.EncodeToString(cert.Signature()))
+
+	m := manifest.New([]manifest.Entity{{Name: "file.txt", Checksum: "c1"}})
+	data, err := m.DataWithoutAuditor()
+	require.NoError(t, err)
+	_, err = m.AddAuditor(cert, ed25519.Sign(manifestKey, data), signing.SignatureAlgorithmEd25519)
+	require.NoError(t, err)
+	manifestPath := filepath.Join(t.TempDir(), manifest.DefaultName)
+	require.NoError(t, m.Save(manifestPath))
+
+	loaded, err := manifest.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	loadedCert := loaded.GetAuditorCertificate()
+	valid, err := signing.VerifyCertificate(loadedCert)
+	require.NoError(t, err)
+	assert.True(t, valid)
+
+	auditor := NewSimpleManifestAuditor()
+	result := auditor.Verify(loaded)
+	require.NoError(t, result.Error)
+	issuers := auditor.GetIssuers()
+	require.Len(t, issuers, 1)
+	assert.Equal(t, issuer.Reference("github:alice"), issuers[0].Reference)
+	rootKey, err := rootSigner.PublicKey()
+	require.NoError(t, err)
+	assert.True(t, issuers[0].PublicKey.Equal(rootKey))
+}
+
+func TestCertificate_WithChangedIssuerReference_IsRejectedByAuditor(t *testing.T) {
+	m := generateSigned(t)
+	m.Auditors[0].Certificate.IssuerRef = "custom:mallory"
+
+	result := NewSimpleManifestAuditor().Verify(m)
+	assert.EqualError(t, result.Error, "auditor certificate is invalid: signature from issuer does not match")
+}
+
+func TestSimpleManifestAuditor_WithMalformedCertificate_Fails(t *testing.T) {
+	m := generateSigned(t)
+	m.Auditors[0].Certificate.PublicKey = "xyz"
+
+	result := NewSimpleManifestAuditor().Verify(m)
+	assert.ErrorIs(t, result.Error, manifest.ErrMalformedAuditor)
+	assert.Equal(t, issuer.Reference("custom:alice"), result.Auditors[0].Reference)
+}
+
+// generateWithCertValidity generates a tree in dir signed with a certificate valid for validity
+func generateWithCertValidity(t *testing.T, dir string, validity time.Duration) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644))
+	_, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signer := signing.NewEd25519Signer(privKey, "custom:alice")
+	gen := generator.New(scanner.New(), signer, generator.WithCertificateValidity(validity))
+	require.NoError(t, gen.Generate(context.Background(), dir))
+}
+
+func TestSimpleManifestAuditor_WithCertificateValidity(t *testing.T) {
+	dir := t.TempDir()
+	generateWithCertValidity(t, dir, 24*time.Hour)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	notBefore := *m.Auditors[0].Certificate.NotBefore
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		expected  error
+		expiresIn time.Duration
+	}{
+		{name: "issued", now: notBefore.Add(time.Hour), expiresIn: 23 * time.Hour},
+		{name: "issued then expired", now: notBefore.Add(25 * time.Hour), expected: signing.ErrCertificateExpired},
+		{name: "issuer clock ahead within skew", now: notBefore.Add(-time.Minute), expiresIn: 24*time.Hour + time.Minute},
+		{name: "issuer clock ahead beyond skew", now: notBefore.Add(-time.Hour), expected: signing.ErrCertificateNotYetValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditor := NewSimpleManifestAuditor()
+			auditor.now = func() time.Time { return tt.now }
+
+			result := auditor.Verify(m)
+			require.Len(t, result.Auditors, 1)
+			if tt.expected != nil {
+				assert.ErrorIs(t, result.Error, tt.expected)
+			} else {
+				assert.NoError(t, result.Error)
+			}
+			assert.Equal(t, tt.expiresIn, result.Auditors[0].ExpiresIn)
+			// The issuer is still reported, so that the expired certificate is shown for it
+			assert.Len(t, auditor.GetIssuers(), 1)
+		})
+	}
+
+	auditor := NewSimpleManifestAuditor(WithExpiryWarning(time.Hour))
+	auditor.now = func() time.Time { return notBefore.Add(time.Hour) }
+	result := auditor.Verify(m)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.Auditors[0].ExpiresIn)
+}
+
+func TestSimpleManifestAuditor_WithLegacyCertificate_NeverExpires(t *testing.T) {
+	dir := t.TempDir()
+	generateWithCertValidity(t, dir, 0)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	assert.Nil(t, m.Auditors[0].Certificate.NotAfter)
+
+	auditor := NewSimpleManifestAuditor()
+	auditor.now = func() time.Time { return time.Now().AddDate(10, 0, 0) }
+	result := auditor.Verify(m)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.Auditors[0].ExpiresIn)
+}
+
+func TestVerifier_Verify_WithExpiredCertificate_mustReportAuditorAsExpired(t *testing.T) {
+	dir := t.TempDir()
+	generateWithCertValidity(t, dir, time.Hour)
+	auditor := NewSimpleManifestAuditor()
+	auditor.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	result, err := New(scanner.New(), auditor, issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+	require.NoError(t, err)
+
+	assert.False(t, result.HasFailures())
+	summary := result.Summary()
+	assert.Equal(t, 1, summary.Signed)
+	assert.Equal(t, 0, summary.Audited)
+	assert.Equal(t, []issuer.Reference{"custom:alice"}, result.ExpiredAuditors())
+	assert.ErrorIs(t, result.AuditorStatuses["custom:alice"].Error, signing.ErrCertificateExpired)
+}
+
+func TestReportCertificateErrors_KeepsUntrustedStatuses(t *testing.T) {
+	expired := fmt.Errorf("auditor %w", signing.ErrCertificateExpired)
+	untrusted := errors.New("key not found in trusted source")
+	statuses := map[issuer.Reference]issuer.Status{
+		"github:trusted":   {Supported: true},
+		"github:untrusted": {Supported: true, Error: untrusted},
+		"github:offline":   {Supported: true, Error: &issuer.TransientError{Err: errors.New("connection refused")}},
+	}
+	reportCertificateErrors(statuses, map[issuer.Reference]error{
+		"github:trusted":   expired,
+		"github:untrusted": expired,
+		"github:offline":   expired,
+	})
+
+	assert.Equal(t, issuer.CategoryExpired, statuses["github:trusted"].Category())
+	assert.Equal(t, untrusted, statuses["github:untrusted"].Error)
+	assert.Equal(t, issuer.CategoryExpired, statuses["github:offline"].Category())
+}
+
+func TestSimpleManifestAuditor_WithUnsignedTimestamp_RecordsNoSigningTime(t *testing.T) {
+	dir := t.TempDir()
+	generateWithCertValidity(t, dir, 0)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Auditors[0].AttributesSignature)
+
+	auditor := NewSimpleManifestAuditor()
+	require.NoError(t, auditor.Verify(m).Error)
+	assert.True(t, auditor.GetIssuers()[0].FirstSigned.Equal(m.Auditors[0].Timestamp))
+
+	// Older versions did not sign the timestamp and algorithm, they cannot be relied on
+	m.Auditors[0].AttributesSignature = ""
+	m.Auditors[0].Timestamp = time.Now().Add(24 * time.Hour)
+	auditor = NewSimpleManifestAuditor()
+	result := auditor.Verify(m)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.Auditors[0].ClockSkew)
+	assert.True(t, auditor.GetIssuers()[0].FirstSigned.IsZero())
+	assert.True(t, auditor.GetIssuers()[0].LastSigned.IsZero())
+}
+
+func TestSimpleManifestAuditor_WithChangedAlgorithm_Fails(t *testing.T) {
+	dir := t.TempDir()
+	generateWithCertValidity(t, dir, 0)
+	m, err := manifest.LoadManifest(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	require.Equal(t, signing.SignatureAlgorithmEd25519, m.Auditors[0].Algorithm)
+
+	// An empty algorithm also means ed25519, the manifest signature still verifies
+	m.Auditors[0].Algorithm = ""
+	result := NewSimpleManifestAuditor().Verify(m)
+	assert.EqualError(t, result.Error, "auditor attributes signature is invalid")
+}
@@ -0,0 +1,73 @@
+package verifier
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// refreshQueueSize bounds the manifests waiting for their timestamp to be refreshed, verification only
+// blocks once the refresher falls that far behind
+const refreshQueueSize = 256
+
+// refresher updates the modification time of verified manifests in the background, see WithRefreshTimestamps.
+// Queued manifests are refreshed in batches sharing one timestamp, a manifest queued twice is refreshed once.
+// Failures are counted and logged, they never fail the verification of a directory.
+type refresher struct {
+	chtimes   func(name string, atime, mtime time.Time) error
+	logger    *slog.Logger
+	queue     chan string
+	done      sync.WaitGroup
+	refreshed int
+	failed    int
+}
+
+// newRefresher starts a refresher, Close must be called to wait for it
+func newRefresher(chtimes func(name string, atime, mtime time.Time) error, logger *slog.Logger) *refresher {
+	r := &refresher{chtimes: chtimes, logger: logger, queue: make(chan string, refreshQueueSize)}
+	r.done.Add(1)
+	go r.run()
+	return r
+}
+
+// Refresh queues the manifest at manifestPath
+func (r *refresher) Refresh(manifestPath string) {
+	r.queue <- manifestPath
+}
+
+// Close waits for the queued manifests to be refreshed and returns how many were refreshed and how many failed
+func (r *refresher) Close() (refreshed, failed int) {
+	close(r.queue)
+	r.done.Wait()
+	return r.refreshed, r.failed
+}
+
+func (r *refresher) run() {
+	defer r.done.Done()
+	for manifestPath := range r.queue {
+		batch := map[string]bool{manifestPath: true}
+		// Coalesce whatever was queued in the meantime
+	drain:
+		for len(batch) < refreshQueueSize {
+			select {
+			case next, ok := <-r.queue:
+				if !ok {
+					break drain
+				}
+				batch[next] = true
+			default:
+				break drain
+			}
+		}
+		now := time.Now()
+		for path := range batch {
+			if err := r.chtimes(path, now, now); err != nil {
+				// Read-only filesystems must remain verifiable, they only lose the freshness shortcut
+				r.logger.Debug("could not refresh manifest timestamp", "path", path, "error", err)
+				r.failed++
+				continue
+			}
+			r.refreshed++
+		}
+	}
+}
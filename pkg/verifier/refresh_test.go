@@ -0,0 +1,84 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+// generateRefreshTree generates a tree of three directories whose manifests are an hour old
+func generateRefreshTree(t *testing.T) string {
+	dir := createTree(t, map[string]string{"a/file.txt": "content", "b/file.txt": "content", "file.txt": "content"})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	old := time.Now().Add(-time.Hour)
+	for _, sub := range []string{"", "a", "b"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, sub, manifest.DefaultName), old, old))
+	}
+	return dir
+}
+
+func manifestModTime(t *testing.T, dir string) time.Time {
+	modTime, err := manifest.GetModTime(filepath.Join(dir, manifest.DefaultName))
+	require.NoError(t, err)
+	return modTime
+}
+
+func TestVerifier_Verify_WithoutRefreshTimestamps_mustNotTouchManifests(t *testing.T) {
+	dir := generateRefreshTree(t)
+	before := manifestModTime(t, dir)
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+
+	require.NoError(t, err)
+	assert.False(t, result.HasFailures())
+	assert.Zero(t, result.Refreshed)
+	assert.Equal(t, before, manifestModTime(t, dir))
+}
+
+func TestVerifier_Verify_WithRefreshTimestamps_mustRefreshValidManifests(t *testing.T) {
+	dir := generateRefreshTree(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b", "file.txt"), []byte("changed"), 0644))
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithRefreshTimestamps(true)).Verify(context.Background(), dir)
+
+	require.NoError(t, err)
+	// The root lists the unchanged manifest of b, so only b is invalid
+	assert.Equal(t, 2, result.Refreshed)
+	assert.Zero(t, result.RefreshFailed)
+	assert.WithinDuration(t, time.Now(), manifestModTime(t, filepath.Join(dir, "a")), time.Minute)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), manifestModTime(t, filepath.Join(dir, "b")), time.Minute)
+}
+
+func TestVerifier_Verify_WithFailingRefresh_mustStayValid(t *testing.T) {
+	dir := generateRefreshTree(t)
+	v := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(), WithRefreshTimestamps(true))
+	var mu sync.Mutex
+	var refreshed []string
+	v.chtimes = func(name string, atime, mtime time.Time) error {
+		mu.Lock()
+		defer mu.Unlock()
+		refreshed = append(refreshed, name)
+		return errors.New("read-only file system")
+	}
+
+	result, err := v.Verify(context.Background(), dir)
+
+	require.NoError(t, err)
+	assert.False(t, result.HasFailures())
+	assert.Equal(t, 3, result.Summary().Verified)
+	assert.Zero(t, result.Refreshed)
+	assert.Equal(t, 3, result.RefreshFailed)
+	assert.Len(t, refreshed, 3)
+}
@@ -0,0 +1,267 @@
+package verifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+// Types of ReportDifference
+const (
+	// ReportMissing is listed in the manifest but not found in the directory
+	ReportMissing = "missing"
+	// ReportExtra is found in the directory but not listed in the manifest
+	ReportExtra = "extra"
+	// ReportChecksum has different content than recorded
+	ReportChecksum = "checksum"
+	// ReportSize has a different size than recorded and was not hashed, see scanner.WithFastVerification
+	ReportSize = "size"
+	// ReportType changed between file, directory and special file
+	ReportType = "type"
+	// ReportPermission has a different mode or owner than recorded
+	ReportPermission = "permission"
+	// ReportXattr has different extended attributes than recorded
+	ReportXattr = "xattr"
+	// ReportHardlink is no longer a hard link of the file it was recorded linked with, see ReportDifference.LinkedTo
+	ReportHardlink = "hardlink"
+	// ReportInvalidManifest means the manifest of the directory is corrupted or not a manifest at all,
+	// see ReportDifference.Reason
+	ReportInvalidManifest = "invalid-manifest"
+)
+
+// ReportDifference is one line of a report, describing an entry that does not match its manifest
+type ReportDifference struct {
+	// Directory is the path of the directory relative to ReportSummary.Root with forward slashes, "." for the root itself
+	Directory string `json:"directory"`
+	// Name is the entry of the directory, empty for ReportInvalidManifest
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// ExpectedChecksum is recorded in the manifest, empty for ReportExtra
+	ExpectedChecksum string `json:"expectedChecksum,omitempty"`
+	// ActualChecksum is computed from the directory, empty for ReportMissing
+	ActualChecksum string `json:"actualChecksum,omitempty"`
+	IsDir          bool   `json:"isDir"`
+	// Sampled is set when only the sample checksums of the file were compared, which the checksums then hold,
+	// see manifest.Entity.SampleChecksum
+	Sampled bool `json:"sampled,omitempty"`
+	// FirstBadChunk and BadChunkCount tell which chunks of a file differ, see manifest.EntityDifference
+	FirstBadChunk *int `json:"firstBadChunk,omitempty"`
+	BadChunkCount int  `json:"badChunkCount,omitempty"`
+	// ExpectedContentType and ActualContentType tell what a file with another checksum was and is now,
+	// they are only set when its manifest records them, see manifest.Entity.ContentType
+	ExpectedContentType string `json:"expectedContentType,omitempty"`
+	ActualContentType   string `json:"actualContentType,omitempty"`
+	// ExpectedSize and ActualSize are only set for ReportSize
+	ExpectedSize *int64 `json:"expectedSize,omitempty"`
+	ActualSize   *int64 `json:"actualSize,omitempty"`
+	// LinkedTo is only set for ReportHardlink, see manifest.EntityDifference.LinkedTo
+	LinkedTo string `json:"linkedTo,omitempty"`
+	// Reason explains a ReportInvalidManifest
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReportSummary is the last line of a report
+type ReportSummary struct {
+	// Root is the verified directory as given to the verifier
+	Root        string `json:"root"`
+	Found       int    `json:"found"`
+	Verified    int    `json:"verified"`
+	Shallow     int    `json:"shallow"`
+	Skipped     int    `json:"skipped"` // Deprecated: the former name of Shallow, kept for existing readers
+	Invalid     int    `json:"invalid"`
+	Differences int    `json:"differences"`
+	// Error is set when verification stopped early, the report then lists the differences found until then
+	Error string `json:"error,omitempty"`
+}
+
+// Report is a report loaded by ParseReport
+type Report struct {
+	Differences []ReportDifference
+	// Summary is nil when the report is incomplete, e.g. because the verification was killed
+	Summary *ReportSummary
+}
+
+// reportLine is the JSON representation of one line of a report, either a difference or the summary
+type reportLine struct {
+	*ReportDifference
+	Summary *ReportSummary `json:"summary,omitempty"`
+}
+
+// ReportWriter writes newline-delimited JSON reports of failed verifications, one ReportDifference
+// per line followed by a line holding the ReportSummary. Differences are written as directories are
+// verified, see WithDirectoryReport, so the report of an interrupted verification holds those found so far.
+// The writer only counts them, failed directories are still retained in Result, see WithMaxRetainedFailures.
+type ReportWriter struct {
+	w           *bufio.Writer
+	file        *os.File
+	root        string
+	differences int
+}
+
+// NewReportWriter returns a ReportWriter for the verification of root writing to w
+func NewReportWriter(w io.Writer, root string) *ReportWriter {
+	return &ReportWriter{w: bufio.NewWriter(w), root: root}
+}
+
+// CreateReport creates or truncates the report file at path, see NewReportWriter.
+// The file is synced to disk and closed by Finish.
+func CreateReport(path string, root string) (*ReportWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+	r := NewReportWriter(file, root)
+	r.file = file
+	return r, nil
+}
+
+// WriteDirectory writes the differences of a verified directory, nothing if it matches its manifest
+func (r *ReportWriter) WriteDirectory(status DirectoryVerificationStatus) error {
+	directory := manifest.PortableName(status.RelativePath)
+	if status.ManifestError != nil {
+		difference := ReportDifference{
+			Directory: directory,
+			Type:      ReportInvalidManifest,
+			Reason:    status.ManifestError.Error(),
+		}
+		if err := r.writeLine(reportLine{ReportDifference: &difference}); err != nil {
+			return err
+		}
+		r.differences++
+	}
+	for _, diff := range status.Differences {
+		difference, ok := newReportDifference(directory, diff)
+		if !ok {
+			continue
+		}
+		if err := r.writeLine(reportLine{ReportDifference: &difference}); err != nil {
+			return err
+		}
+		r.differences++
+	}
+	return nil
+}
+
+// Finish writes the summary of result, or of verifyErr when verification failed and result is nil,
+// then flushes the report, and syncs and closes the file opened by CreateReport
+func (r *ReportWriter) Finish(result *Result, verifyErr error) error {
+	summary := ReportSummary{Root: r.root, Differences: r.differences}
+	if result != nil {
+		s := result.Summary()
+		summary.Found, summary.Verified, summary.Shallow, summary.Invalid = s.Found, s.Verified, s.Shallow, s.Invalid
+		summary.Skipped = s.Shallow
+	}
+	if verifyErr != nil {
+		summary.Error = verifyErr.Error()
+	}
+	err := r.writeLine(reportLine{Summary: &summary})
+	if err == nil {
+		err = r.w.Flush()
+	}
+	if r.file != nil {
+		if err == nil {
+			err = r.file.Sync()
+		}
+		err = errors.Join(err, r.file.Close())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+func (r *ReportWriter) writeLine(line reportLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err := r.w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// newReportDifference converts a difference between an existing manifest and the one computed from
+// its directory. Subtree differences are left out, they are explained by the differences of the entries.
+func newReportDifference(directory string, diff manifest.EntityDifference) (ReportDifference, bool) {
+	difference := ReportDifference{Directory: directory, Name: diff.Name}
+	switch diff.Type {
+	case manifest.DiffMissingInB:
+		difference.Type = ReportMissing
+	case manifest.DiffMissingInA:
+		difference.Type = ReportExtra
+	case manifest.DiffChecksumMismatch:
+		difference.Type = ReportChecksum
+		difference.FirstBadChunk, difference.BadChunkCount = diff.FirstBadChunk, diff.BadChunkCount
+		if manifest.ContentTypeChange(diff.ExpectedEntity, diff.ActualEntity) != "" {
+			difference.ExpectedContentType = diff.ExpectedEntity.ContentType
+			difference.ActualContentType = diff.ActualEntity.ContentType
+		}
+	case manifest.DiffSizeMismatch:
+		difference.Type = ReportSize
+		difference.ExpectedSize, difference.ActualSize = diff.ExpectedEntity.Size, diff.ActualEntity.Size
+	case manifest.DiffTypeMismatch:
+		difference.Type = ReportType
+	case manifest.DiffPermissionMismatch:
+		difference.Type = ReportPermission
+	case manifest.DiffXattrMismatch:
+		difference.Type = ReportXattr
+	case manifest.DiffHardlinkBroken:
+		difference.Type = ReportHardlink
+		difference.LinkedTo = diff.LinkedTo
+	default:
+		return ReportDifference{}, false
+	}
+	if diff.ExpectedEntity != nil {
+		difference.ExpectedChecksum = diff.ExpectedEntity.Checksum
+		difference.IsDir = diff.ExpectedEntity.IsDir
+	}
+	if diff.ActualEntity != nil {
+		difference.ActualChecksum = diff.ActualEntity.Checksum
+		difference.IsDir = diff.ActualEntity.IsDir
+		if diff.ActualEntity.Sampled() {
+			difference.Sampled = true
+			difference.ActualChecksum = diff.ActualEntity.SampleChecksum
+			if diff.ExpectedEntity != nil {
+				difference.ExpectedChecksum = diff.ExpectedEntity.SampleChecksum
+			}
+		}
+	}
+	return difference, true
+}
+
+// ParseReport reads a report written by ReportWriter
+func ParseReport(r io.Reader) (*Report, error) {
+	report := &Report{}
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; lines.Scan(); lineNumber++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		if report.Summary != nil {
+			return nil, fmt.Errorf("invalid report line %d: found after the summary", lineNumber)
+		}
+		var line reportLine
+		if err := json.Unmarshal(lines.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("invalid report line %d: %w", lineNumber, err)
+		}
+		if line.Summary != nil {
+			report.Summary = line.Summary
+			continue
+		}
+		if line.ReportDifference == nil || line.Type == "" {
+			return nil, fmt.Errorf("invalid report line %d: neither a difference nor a summary", lineNumber)
+		}
+		report.Differences = append(report.Differences, *line.ReportDifference)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,80 @@
+package verifier
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+)
+
+func TestReportWriter_ParseReport_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewReportWriter(&buf, "/data")
+	require.NoError(t, w.WriteDirectory(DirectoryVerificationStatus{RelativePath: "a/b", Differences: []manifest.EntityDifference{
+		{Type: manifest.DiffSubtreeMismatch, ExpectedSubtree: &manifest.SubtreeTotals{Files: 1}, ActualSubtree: &manifest.SubtreeTotals{Files: 2}},
+		{Name: "gone.csv", Type: manifest.DiffMissingInB, ExpectedEntity: &manifest.Entity{Name: "gone.csv", Checksum: "aa"}},
+		{Name: "new", Type: manifest.DiffMissingInA, ActualEntity: &manifest.Entity{Name: "new", Checksum: "bb", IsDir: true}},
+		{Name: "data.csv", Type: manifest.DiffChecksumMismatch,
+			ExpectedEntity: &manifest.Entity{Name: "data.csv", Checksum: "cc"}, ActualEntity: &manifest.Entity{Name: "data.csv", Checksum: "dd"}},
+	}}))
+	require.NoError(t, w.WriteDirectory(DirectoryVerificationStatus{RelativePath: "."}))
+	result := NewResult([]DirectoryVerificationStatus{
+		{ManifestStatus: ManifestVerificationStatus{Found: true, Valid: false}},
+		{ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true}},
+	}, nil, nil)
+	require.NoError(t, w.Finish(result, nil))
+
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"))
+	report, err := ParseReport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []ReportDifference{
+		{Directory: "a/b", Name: "gone.csv", Type: ReportMissing, ExpectedChecksum: "aa"},
+		{Directory: "a/b", Name: "new", Type: ReportExtra, ActualChecksum: "bb", IsDir: true},
+		{Directory: "a/b", Name: "data.csv", Type: ReportChecksum, ExpectedChecksum: "cc", ActualChecksum: "dd"},
+	}, report.Differences)
+	assert.Equal(t, &ReportSummary{Root: "/data", Found: 2, Verified: 1, Invalid: 1, Differences: 3}, report.Summary)
+}
+
+func TestCreateReport_FinishWithError_WritesSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.ndjson")
+	w, err := CreateReport(path, "/data")
+	require.NoError(t, err)
+	require.NoError(t, w.WriteDirectory(DirectoryVerificationStatus{RelativePath: "x", Differences: []manifest.EntityDifference{
+		{Name: "f", Type: manifest.DiffTypeMismatch, ExpectedEntity: &manifest.Entity{Name: "f", Checksum: "aa"},
+			ActualEntity: &manifest.Entity{Name: "f", Checksum: "bb", IsDir: true}},
+	}}))
+	require.NoError(t, w.Finish(nil, errors.New("manifest in directory 'y' not found")))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	report, err := ParseReport(file)
+	require.NoError(t, err)
+	require.Len(t, report.Differences, 1)
+	assert.Equal(t, ReportType, report.Differences[0].Type)
+	assert.Equal(t, &ReportSummary{Root: "/data", Differences: 1, Error: "manifest in directory 'y' not found"}, report.Summary)
+}
+
+func TestParseReport_Incomplete_HasNoSummary(t *testing.T) {
+	report, err := ParseReport(strings.NewReader(`{"directory":".","name":"a","type":"missing","expectedChecksum":"aa","isDir":false}` + "\n"))
+	require.NoError(t, err)
+	assert.Len(t, report.Differences, 1)
+	assert.Nil(t, report.Summary)
+}
+
+func TestParseReport_InvalidLines_mustFail(t *testing.T) {
+	for input, message := range map[string]string{
+		"not json\n":                               "invalid report line 1",
+		`{"directory":"."}` + "\n":                 "invalid report line 1: neither a difference nor a summary",
+		`{"summary":{}}` + "\n" + `{"summary":{}}`: "invalid report line 2: found after the summary",
+	} {
+		_, err := ParseReport(strings.NewReader(input))
+		assert.ErrorContains(t, err, message, input)
+	}
+}
@@ -0,0 +1,86 @@
+package verifier
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+)
+
+// SigningSummary counts the manifests of a verification by how far their signatures can be trusted
+type SigningSummary struct {
+	// Trusted counts the signed manifests with at least one auditor whose key is trusted, see issuer.CategoryTrusted
+	Trusted int
+	// Unverifiable counts the signed manifests none of whose auditors is trusted: unsupported, unverifiable,
+	// expired or failing to verify
+	Unverifiable int
+	// Unsigned counts the manifests without auditors, including the ones audited through a signed ancestor,
+	// see ManifestVerificationStatus.Inherited
+	Unsigned int
+}
+
+// signingCounter counts manifests per set of auditors, which are only told trusted once the whole tree is
+// verified, without keeping the statuses of the directories
+type signingCounter struct {
+	// signed holds the number of manifests per sorted auditor references, joined by newlines
+	signed   map[string]int
+	unsigned int
+}
+
+func newSigningCounter() *signingCounter {
+	return &signingCounter{signed: make(map[string]int)}
+}
+
+// add counts the manifest of status, directories without a manifest are left out
+func (c *signingCounter) add(status DirectoryVerificationStatus) {
+	switch {
+	case !status.ManifestStatus.Found:
+	case !status.ManifestStatus.Signed || len(status.Auditors) == 0:
+		c.unsigned++
+	default:
+		refs := make([]string, len(status.Auditors))
+		for i, ref := range status.Auditors {
+			refs[i] = string(ref)
+		}
+		c.signed[strings.Join(refs, "\n")]++
+	}
+}
+
+// summary buckets the signed manifests by the trust statuses of their auditors
+func (c *signingCounter) summary(statuses map[issuer.Reference]issuer.Status) SigningSummary {
+	summary := SigningSummary{Unsigned: c.unsigned}
+	for refs, count := range c.signed {
+		trusted := false
+		for _, ref := range strings.Split(refs, "\n") {
+			if status, ok := statuses[issuer.Reference(ref)]; ok && status.Category() == issuer.CategoryTrusted {
+				trusted = true
+				break
+			}
+		}
+		if trusted {
+			summary.Trusted += count
+		} else {
+			summary.Unverifiable += count
+		}
+	}
+	return summary
+}
+
+// auditorReferences returns the references of the auditors of result, sorted and without duplicates
+func auditorReferences(result AuditResult) []issuer.Reference {
+	var refs []issuer.Reference
+	for _, auditor := range result.Auditors {
+		refs = append(refs, auditor.Reference)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	unique := refs[:0]
+	for i, ref := range refs {
+		if i == 0 || ref != refs[i-1] {
+			unique = append(unique, ref)
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	return unique
+}
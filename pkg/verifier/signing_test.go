@@ -0,0 +1,98 @@
+package verifier
+
+import (
+	"context"
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// generateMixedSignatures generates a tree whose directory "a" is signed by custom:alice, "b" by custom:bob and
+// "c" and the root are unsigned
+func generateMixedSignatures(t *testing.T) string {
+	t.Helper()
+	dir := createTree(t, map[string]string{"a/file.txt": "a", "b/file.txt": "b", "c/file.txt": "c"})
+	signers := map[string]signing.Signer{
+		"a": signing.NewEd25519Signer(seededKey(0), "custom:alice"),
+		"b": signing.NewEd25519Signer(seededKey(1), "custom:bob"),
+		"c": nil,
+	}
+	for name, signer := range signers {
+		require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), filepath.Join(dir, name)))
+	}
+	sc := scanner.New(scanner.WithManifestFreshnessLimit(time.Hour))
+	require.NoError(t, generator.New(sc, nil).Generate(context.Background(), dir))
+	return dir
+}
+
+// trustAlice trusts custom:alice, the other auditors are unsupported
+func trustAlice() issuer.Verifier {
+	anchors := issuer.TrustAnchors{"custom:alice": {seededKey(0).Public().(ed25519.PublicKey)}}
+	return issuer.NewPinnedVerifier(anchors, issuer.NewMultiSourceVerifier())
+}
+
+func TestVerifier_Verify_WithMixedSignatures_mustCountSigningBuckets(t *testing.T) {
+	dir := generateMixedSignatures(t)
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), trustAlice()).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	require.False(t, result.HasFailures())
+	auditors := make(map[string][]issuer.Reference)
+	for _, status := range result.DirectoryStatuses {
+		auditors[status.RelativePath] = status.Auditors
+	}
+	assert.Equal(t, map[string][]issuer.Reference{
+		".": nil,
+		"a": {"custom:alice"},
+		"b": {"custom:bob"},
+		"c": nil,
+	}, auditors)
+	assert.Equal(t, SigningSummary{Trusted: 1, Unverifiable: 1, Unsigned: 2}, result.Signing)
+	assert.False(t, result.UnsignedViolated(), "unsigned manifests are only counted by default")
+	assert.False(t, result.UntrustedViolated())
+
+	// The statuses given to a sink are counted alike
+	result, err = New(scanner.New(), NewSimpleManifestAuditor(), trustAlice(),
+		WithStatusSink(func(DirectoryVerificationStatus) {})).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, SigningSummary{Trusted: 1, Unverifiable: 1, Unsigned: 2}, result.Signing)
+}
+
+func TestVerifier_Verify_WithRequiredSignatures_mustReportViolations(t *testing.T) {
+	dir := generateMixedSignatures(t)
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), trustAlice(), WithRequireSigned(true)).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, result.UnsignedViolated())
+	assert.False(t, result.UntrustedViolated(), "signed manifests need not be trusted")
+
+	result, err = New(scanner.New(), NewSimpleManifestAuditor(), trustAlice(), WithRequireTrusted(true)).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, result.UnsignedViolated(), "trusted manifests must be signed")
+	assert.True(t, result.UntrustedViolated())
+}
+
+func TestSigningCounter_WithCoSignedManifest_mustTrustAnyTrustedAuditor(t *testing.T) {
+	counter := newSigningCounter()
+	signed := ManifestVerificationStatus{Found: true, Valid: true, Signed: true}
+	counter.add(DirectoryVerificationStatus{ManifestStatus: signed, Auditors: []issuer.Reference{"custom:alice", "custom:bob"}})
+	counter.add(DirectoryVerificationStatus{ManifestStatus: signed, Auditors: []issuer.Reference{"custom:bob"}})
+	counter.add(DirectoryVerificationStatus{ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Audited: true, Inherited: true}})
+	counter.add(DirectoryVerificationStatus{})
+
+	summary := counter.summary(map[issuer.Reference]issuer.Status{
+		"custom:alice": {Supported: true},
+		"custom:bob":   {Supported: false},
+	})
+	assert.Equal(t, SigningSummary{Trusted: 1, Unverifiable: 1, Unsigned: 1}, summary)
+}
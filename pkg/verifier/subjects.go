@@ -0,0 +1,84 @@
+package verifier
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+)
+
+// AuditorSubjectGroup lists the directories whose manifests an auditor signed with one subject key. Every
+// generate run signs with an ephemeral subject key of its own, certified by the issuer, so a group is one run.
+type AuditorSubjectGroup struct {
+	// SubjectKey is the fingerprint of the subject key, see issuer.Fingerprint
+	SubjectKey string
+	// FirstSigned and LastSigned are the earliest and latest auditor timestamps of the manifests
+	FirstSigned time.Time
+	LastSigned  time.Time
+	// Directories holds the paths of the directories relative to the verified root, sorted
+	Directories []string
+}
+
+// subjectTracker groups the directories of a tree by the subject keys their auditors signed with
+type subjectTracker struct {
+	groups map[issuer.Reference]map[string]*AuditorSubjectGroup
+}
+
+func newSubjectTracker() *subjectTracker {
+	return &subjectTracker{groups: make(map[issuer.Reference]map[string]*AuditorSubjectGroup)}
+}
+
+// add records that auditor signed the manifest of directory. Auditors whose signature is invalid have no
+// subject key and are left out.
+func (t *subjectTracker) add(directory string, auditor AuditorResult) {
+	if auditor.SubjectKey == "" {
+		return
+	}
+	keys, ok := t.groups[auditor.Reference]
+	if !ok {
+		keys = make(map[string]*AuditorSubjectGroup)
+		t.groups[auditor.Reference] = keys
+	}
+	group, ok := keys[auditor.SubjectKey]
+	if !ok {
+		group = &AuditorSubjectGroup{SubjectKey: auditor.SubjectKey, FirstSigned: auditor.Timestamp, LastSigned: auditor.Timestamp}
+		keys[auditor.SubjectKey] = group
+	}
+	if auditor.Timestamp.Before(group.FirstSigned) {
+		group.FirstSigned = auditor.Timestamp
+	}
+	if auditor.Timestamp.After(group.LastSigned) {
+		group.LastSigned = auditor.Timestamp
+	}
+	// An auditor signing the same manifest twice is counted once
+	if n := len(group.Directories); n == 0 || group.Directories[n-1] != directory {
+		group.Directories = append(group.Directories, directory)
+	}
+}
+
+// mixed returns the groups of the auditors that signed with more than one subject key, ordered by the time they
+// were first signed, nil when every auditor signed in a single run
+func (t *subjectTracker) mixed() map[issuer.Reference][]AuditorSubjectGroup {
+	var mixed map[issuer.Reference][]AuditorSubjectGroup
+	for ref, keys := range t.groups {
+		if len(keys) < 2 {
+			continue
+		}
+		groups := make([]AuditorSubjectGroup, 0, len(keys))
+		for _, group := range keys {
+			sort.Strings(group.Directories)
+			groups = append(groups, *group)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			if !groups[i].FirstSigned.Equal(groups[j].FirstSigned) {
+				return groups[i].FirstSigned.Before(groups[j].FirstSigned)
+			}
+			return groups[i].SubjectKey < groups[j].SubjectKey
+		})
+		if mixed == nil {
+			mixed = make(map[issuer.Reference][]AuditorSubjectGroup)
+		}
+		mixed[ref] = groups
+	}
+	return mixed
+}
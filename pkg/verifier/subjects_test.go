@@ -0,0 +1,77 @@
+package verifier
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+)
+
+// spliceSignedDirectory generates a tree with a directory signed by splicedSigner for another tree, moved in
+// before the tree itself is generated by signer reusing its fresh manifest
+func spliceSignedDirectory(t *testing.T, signer, splicedSigner signing.Signer) string {
+	t.Helper()
+	dir, other := createTree(t, map[string]string{"a/file.txt": "content"}), createTree(t, map[string]string{"c/file.txt": "content"})
+	require.NoError(t, generator.New(scanner.New(), splicedSigner).Generate(context.Background(), other))
+	require.NoError(t, os.Rename(filepath.Join(other, "c"), filepath.Join(dir, "c")))
+
+	sc := scanner.New(scanner.WithManifestFreshnessLimit(time.Hour))
+	require.NoError(t, generator.New(sc, signer).Generate(context.Background(), dir))
+	return dir
+}
+
+func verifySigned(t *testing.T, dir string, opts ...Option) *Result {
+	t.Helper()
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(), opts...).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	require.False(t, result.HasFailures(), "every directory matches its manifest")
+	return result
+}
+
+func TestVerifier_Verify_WithSplicedDirectory_mustReportMixedAuditorSubjects(t *testing.T) {
+	signer := signing.NewEd25519Signer(seededKey(0), "custom:alice")
+	dir := spliceSignedDirectory(t, signer, signer)
+
+	result := verifySigned(t, dir)
+	require.Contains(t, result.MixedAuditorSubjects, issuer.Reference("custom:alice"))
+	groups := result.MixedAuditorSubjects["custom:alice"]
+	require.Len(t, groups, 2)
+	// The spliced directory was signed first, by the run generating the other tree
+	assert.Equal(t, []string{"c"}, groups[0].Directories)
+	assert.Equal(t, []string{".", "a"}, groups[1].Directories)
+	assert.NotEqual(t, groups[0].SubjectKey, groups[1].SubjectKey)
+	assert.True(t, groups[0].FirstSigned.Before(groups[1].FirstSigned))
+	assert.False(t, result.SingleAuditorRunViolated(), "mixed runs are only reported by default")
+
+	result = verifySigned(t, dir, WithRequireSingleAuditorRun(true))
+	assert.True(t, result.SingleAuditorRunViolated())
+}
+
+func TestVerifier_Verify_WithDistinctAuditorsPerSubtree_mustNotMixSubjects(t *testing.T) {
+	dir := spliceSignedDirectory(t, signing.NewEd25519Signer(seededKey(0), "custom:alice"),
+		signing.NewEd25519Signer(seededKey(1), "custom:bob"))
+
+	result := verifySigned(t, dir, WithRequireSingleAuditorRun(true))
+	assert.Len(t, result.Auditors, 2)
+	assert.Nil(t, result.MixedAuditorSubjects)
+	assert.False(t, result.SingleAuditorRunViolated())
+}
+
+func TestVerifier_Verify_WithSingleRun_mustNotMixSubjects(t *testing.T) {
+	dir := createTree(t, map[string]string{"a/file.txt": "content", "b/file.txt": "content", "file.txt": "content"})
+	signer := signing.NewEd25519Signer(seededKey(0), "custom:alice")
+	require.NoError(t, generator.New(scanner.New(), signer).Generate(context.Background(), dir))
+
+	result := verifySigned(t, dir, WithRequireSingleAuditorRun(true))
+	assert.Equal(t, 3, result.Auditors["custom:alice"].ManifestCount)
+	assert.Nil(t, result.MixedAuditorSubjects)
+}
@@ -2,33 +2,280 @@ package verifier
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/tomekjarosik/bytecheck/pkg/issuer"
 	"github.com/tomekjarosik/bytecheck/pkg/manifest"
 	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+	"github.com/tomekjarosik/bytecheck/pkg/signing"
+	"github.com/tomekjarosik/bytecheck/pkg/telemetry"
+	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
+// ErrConfigMismatch is wrapped by the error of a verification finding a directory whose effective config,
+// see scanner.DirConfig, differs from the one its manifest was generated with. The tree no longer matches its
+// manifests, so it wraps ErrVerificationFailed.
+var ErrConfigMismatch = fmt.Errorf("%w: config changed since generation", ErrVerificationFailed)
+
+// ErrManifestNotFound is wrapped by the error of a verification finding a directory without a manifest
+var ErrManifestNotFound = errors.New("manifest not found")
+
+// ManifestNotFoundError is the error of a verification finding a directory without a manifest, it wraps
+// ErrManifestNotFound
+type ManifestNotFoundError struct {
+	Dir string
+	// OtherName names a manifest found in Dir under another name than the configured one, empty if there is none,
+	// see scanner.Scanner.FindManifestName. It is only looked for when no manifest was verified before.
+	OtherName string
+}
+
+func (e *ManifestNotFoundError) Error() string {
+	if e.OtherName != "" {
+		return fmt.Sprintf("%s in directory '%s'; found a manifest named '%s'", ErrManifestNotFound, e.Dir, e.OtherName)
+	}
+	return fmt.Sprintf("%s in directory '%s'", ErrManifestNotFound, e.Dir)
+}
+
+func (e *ManifestNotFoundError) Unwrap() error {
+	return ErrManifestNotFound
+}
+
+// ErrAuditFailed is wrapped by the error of a verification finding a manifest whose signature is invalid
+var ErrAuditFailed = errors.New("manifest audit failed")
+
 type ManifestVerificationStatus struct {
-	Found   bool
-	Skipped bool // because it was cached
+	// Found is false for directories without a manifest, which are only reported as unmanaged,
+	// see WithAllowMissingManifests
+	Found bool
+	// Shallow is set for fresh manifests: their HMAC, signatures and the directory listing were checked,
+	// only the file contents were not hashed again, see scanner.WithFreshListingCheck
+	Shallow bool
 	Valid   bool
-	Signed  bool
-	Audited bool
+	Signed  bool // manifest carries at least one auditor section
+	Audited bool // all auditor signatures were successfully verified
+	// Inherited is set, together with Audited, for unsigned manifests covered by the signed manifest of an ancestor:
+	// every manifest between them is valid, so the ancestor's signature vouches for their checksums
+	Inherited bool
+	// HiddenOnly is set for directories differing only in hidden entries, directly or through subdirectories,
+	// see manifest.EntityDifference.Hidden. They are Valid with WithIgnoreHiddenDifferences.
+	HiddenOnly bool
 }
 
 // DirectoryVerificationStatus DirectoryStatus represent verification status of each manifest thus directory
 type DirectoryVerificationStatus struct {
-	Path           string
+	Path string
+	// RelativePath is Path relative to Result.RootPath, "." for the root itself
+	RelativePath   string
 	ManifestStatus ManifestVerificationStatus
 	Differences    []manifest.EntityDifference
+	// GeneratedBy is the tool recorded in the existing manifest, see manifest.Manifest.GeneratedBy
+	GeneratedBy string
+	// ManifestError is set when the existing manifest is invalid, see manifest.ErrInvalidManifest.
+	// The directory is then reported as invalid without differences.
+	ManifestError error
+	// Auditors holds the references of the auditors that signed the manifest, sorted, see Result.AuditorStatuses
+	Auditors []issuer.Reference
+	// SubtreeChange is set along the Differences when the manifests record different totals of the tree below the
+	// directory, see manifest.CompareSubtrees. It summarizes the differences and is not counted as one.
+	SubtreeChange *manifest.EntityDifference
+}
+
+// Outcome returns the outcome of the verification of the directory recorded in traces, see telemetry.KeyOutcome
+func (s DirectoryVerificationStatus) Outcome() string {
+	switch ms := s.ManifestStatus; {
+	case !ms.Found:
+		return telemetry.OutcomeUnmanaged
+	case !ms.Valid:
+		return telemetry.OutcomeInvalid
+	case ms.Shallow:
+		return telemetry.OutcomeShallow
+	default:
+		return telemetry.OutcomeValid
+	}
+}
+
+// DefaultMaxRetainedFailures is how many failed directories a Result keeps with WithStatusSink
+const DefaultMaxRetainedFailures = 10000
+
+// Summary holds manifest counts of a verification operation
+type Summary struct {
+	Found    int
+	Verified int
+	// Shallow counts the verified manifests whose file contents were not hashed again as they were fresh
+	Shallow int
+	Invalid int
+	Signed  int
+	Audited int
+	// Inherited counts the audited manifests covered by the signature of an ancestor, see ManifestVerificationStatus
+	Inherited int
+	// Unmanaged counts the directories without a manifest, they are neither verified nor invalid
+	Unmanaged int
+	// HiddenOnly counts the manifests whose directories differ only in hidden entries, see
+	// ManifestVerificationStatus.HiddenOnly
+	HiddenOnly int
+}
+
+// add counts a directory with the manifest status ms
+func (s *Summary) add(ms ManifestVerificationStatus) {
+	if !ms.Found {
+		s.Unmanaged++
+		return
+	}
+	s.Found++
+	if ms.Shallow {
+		s.Shallow++
+	}
+	if ms.Valid {
+		s.Verified++
+	} else {
+		s.Invalid++
+	}
+	if ms.Signed {
+		s.Signed++
+	}
+	if ms.Audited {
+		s.Audited++
+	}
+	if ms.Inherited {
+		s.Inherited++
+	}
+	if ms.HiddenOnly {
+		s.HiddenOnly++
+	}
+}
+
+// AuditorSummary lists the manifests signed by one auditor
+type AuditorSummary struct {
+	ManifestCount int
+	// Directories holds the paths of the audited directories, sorted
+	Directories []string
 }
 
 // Result represents the result of a verification operation
 type Result struct {
+	// DirectoryStatuses are sorted by path. With WithStatusSink they hold only the failed directories.
 	DirectoryStatuses []DirectoryVerificationStatus
-	AuditorStatuses   map[issuer.Reference]issuer.Status
-	Stats             *scanner.Stats
+	// DroppedFailures counts the failed directories left out of DirectoryStatuses, see WithMaxRetainedFailures
+	DroppedFailures int
+	// RootPath is the directory the verification started from
+	RootPath        string
+	AuditorStatuses map[issuer.Reference]issuer.Status
+	// Auditors holds the manifests each auditor signed
+	Auditors map[issuer.Reference]AuditorSummary
+	Stats    *scanner.Stats
+	// Signing counts the manifests by how far their signatures can be trusted, see SigningSummary
+	Signing SigningSummary
+	// MixedAuditorSubjects holds the directories of every auditor that signed the tree in more than one generate
+	// run, grouped by run, see AuditorSubjectGroup. A directory spliced in from another tree signed by the same
+	// auditor forms a group of its own, as do the directories updated by later runs. Auditors of distinct
+	// references are never mixed, and trees signed in a single run have none.
+	MixedAuditorSubjects map[issuer.Reference][]AuditorSubjectGroup
+	// RootDigest is the digest of the recomputed root manifest, see manifest.RootDigest
+	RootDigest string
+	// Subtree holds the totals of the recomputed root manifest, nil if unknown, see manifest.Manifest.Subtree
+	Subtree *manifest.SubtreeTotals
+	// Interrupted is set on the partial result returned with the error of a cancelled verification. It holds the
+	// directories verified before the cancellation, auditors are not verified.
+	Interrupted bool
+	// Policy holds the decisions of the auditor policy, nil without one, see WithAuditorPolicy
+	Policy *issuer.PolicyResult
+	// Chain holds the ancestors linking the verified tree to a signed root, nil unless set by VerifySubtree
+	Chain *ChainResult
+	// DetachedSignature holds the check of a detached signature of RootDigest, nil unless one was checked,
+	// see CheckDetachedSignature
+	DetachedSignature *DetachedSignatureResult
+	// Labels are the labels of the root manifest, see manifest.Manifest.Labels
+	Labels map[string]string
+	// MissingLabels lists the labels required by WithRequiredLabels that the root manifest lacks, as "key=value"
+	MissingLabels []string
+	// UntrustedLabels is set when WithRequiredLabels requires labels but no trusted auditor signed the root
+	// manifest, anyone could have written its labels
+	UntrustedLabels bool
+	// Refreshed and RefreshFailed count the manifest timestamps updated and failing to, see WithRefreshTimestamps
+	Refreshed     int
+	RefreshFailed int
+	summary       Summary
+	// singleAuditorRun is set by WithRequireSingleAuditorRun
+	singleAuditorRun bool
+	// requireSigned and requireTrusted are set by WithRequireSigned and WithRequireTrusted
+	requireSigned  bool
+	requireTrusted bool
+}
+
+// NewResult creates a Result and computes its summary from the directory statuses
+func NewResult(directoryStatuses []DirectoryVerificationStatus, auditorStatuses map[issuer.Reference]issuer.Status, stats *scanner.Stats) *Result {
+	summary := Summary{}
+	for _, status := range directoryStatuses {
+		summary.add(status.ManifestStatus)
+	}
+	return &Result{
+		DirectoryStatuses: directoryStatuses,
+		AuditorStatuses:   auditorStatuses,
+		Stats:             stats,
+		summary:           summary,
+	}
+}
+
+// Summary returns manifest counts of the verification
+func (r *Result) Summary() Summary {
+	return r.summary
+}
+
+// HasFailures returns true if any verified manifest does not match its directory
+func (r *Result) HasFailures() bool {
+	return r.summary.Invalid > 0
+}
+
+// ExpiredAuditors returns the auditors with a certificate outside its validity window, sorted,
+// see issuer.CategoryExpired
+func (r *Result) ExpiredAuditors() []issuer.Reference {
+	var refs []issuer.Reference
+	for ref, status := range r.AuditorStatuses {
+		if status.Category() == issuer.CategoryExpired {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs
+}
+
+// PinMismatches returns the auditors whose key differs from the key pinned for them, sorted,
+// see issuer.PinnedVerifier
+func (r *Result) PinMismatches() []issuer.Reference {
+	var refs []issuer.Reference
+	for ref, status := range r.AuditorStatuses {
+		if errors.Is(status.Error, issuer.ErrPinnedKeyMismatch) {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs
+}
+
+// SingleAuditorRunViolated returns true if a single run of every auditor is required, see
+// WithRequireSingleAuditorRun, and an auditor signed the tree in several, see MixedAuditorSubjects
+func (r *Result) SingleAuditorRunViolated() bool {
+	return r.singleAuditorRun && len(r.MixedAuditorSubjects) > 0
+}
+
+// UnsignedViolated returns true if signed manifests are required, see WithRequireSigned, and a manifest is
+// unsigned, see SigningSummary.Unsigned
+func (r *Result) UnsignedViolated() bool {
+	return (r.requireSigned || r.requireTrusted) && r.Signing.Unsigned > 0
+}
+
+// UntrustedViolated returns true if trusted manifests are required, see WithRequireTrusted, and a signed manifest
+// has no trusted auditor, see SigningSummary.Unverifiable
+func (r *Result) UntrustedViolated() bool {
+	return r.requireTrusted && r.Signing.Unverifiable > 0
+}
+
+// PolicyViolated returns true if the auditor policy denies an auditor or a required auditor is missing
+func (r *Result) PolicyViolated() bool {
+	return r.Policy.Failed()
 }
 
 // Verifier handles verification operations
@@ -36,48 +283,322 @@ type Verifier struct {
 	scanner       *scanner.Scanner
 	auditor       ManifestAuditor
 	trustVerifier issuer.Verifier
+	onDirectory   func(status DirectoryVerificationStatus) error
+	sink          func(status DirectoryVerificationStatus)
+	maxRetained   int
+	policy        *issuer.AuditorPolicy
+	labels        map[string]string
+	allowMissing  bool
+	refresh       bool
+	ignoreHidden  bool
+	singleRun     bool
+	requireSigned bool
+	// requireTrusted implies requireSigned
+	requireTrusted bool
+	// chtimes refreshes manifest timestamps, os.Chtimes unless replaced by tests
+	chtimes func(name string, atime, mtime time.Time) error
+}
+
+// Option configures a Verifier
+type Option func(v *Verifier)
+
+// WithDirectoryReport calls fn with the status of every directory as soon as it is verified, before the
+// statuses are sorted into the Result, e.g. ReportWriter.WriteDirectory. An error of fn stops the verification.
+func WithDirectoryReport(fn func(status DirectoryVerificationStatus) error) Option {
+	return func(v *Verifier) {
+		v.onDirectory = fn
+	}
+}
+
+// WithStatusSink calls fn with the status of every directory as soon as it is verified, subdirectories first, and
+// keeps only the failed directories in Result.DirectoryStatuses, see WithMaxRetainedFailures, so that memory does
+// not grow with the size of the tree. The Summary still counts every directory. The statuses given to fn do not
+// tell audits inherited from a signed ancestor, they are only known once the root is verified.
+func WithStatusSink(fn func(status DirectoryVerificationStatus)) Option {
+	return func(v *Verifier) {
+		v.sink = fn
+	}
+}
+
+// WithMaxRetainedFailures sets how many failed directories a Result keeps with WithStatusSink,
+// DefaultMaxRetainedFailures by default. Further ones are only counted in Result.DroppedFailures, 0 keeps them all.
+func WithMaxRetainedFailures(n int) Option {
+	return func(v *Verifier) {
+		v.maxRetained = n
+	}
+}
+
+// WithAuditorPolicy evaluates policy against the auditors once their keys are verified, see Result.Policy
+func WithAuditorPolicy(policy *issuer.AuditorPolicy) Option {
+	return func(v *Verifier) {
+		v.policy = policy
+	}
+}
+
+// WithRequiredLabels requires the root manifest to hold labels, with the same values, see Result.MissingLabels.
+// The root manifest must be signed by a trusted auditor, see Result.UntrustedLabels.
+func WithRequiredLabels(labels map[string]string) Option {
+	return func(v *Verifier) {
+		v.labels = labels
+	}
+}
+
+// WithAllowMissingManifests reports directories without a manifest as unmanaged instead of failing, see
+// Summary.Unmanaged. The scanner must be created with scanner.WithAllowMissingManifests, so that their parents
+// can still be verified.
+func WithAllowMissingManifests(allow bool) Option {
+	return func(v *Verifier) {
+		v.allowMissing = allow
+	}
+}
+
+// WithRefreshTimestamps updates the modification time of the manifests of valid directories, so that a later
+// generate or verify with a freshness limit reuses them, see scanner.WithManifestFreshnessLimit. The timestamps
+// are refreshed in the background and failures, e.g. on read-only filesystems, only show in Result.RefreshFailed.
+func WithRefreshTimestamps(enabled bool) Option {
+	return func(v *Verifier) {
+		v.refresh = enabled
+	}
+}
+
+// WithIgnoreHiddenDifferences reports directories differing only in hidden entries as valid, see
+// ManifestVerificationStatus.HiddenOnly. Differences are only told hidden for manifests generated with
+// scanner.HiddenWarn.
+func WithIgnoreHiddenDifferences(ignore bool) Option {
+	return func(v *Verifier) {
+		v.ignoreHidden = ignore
+	}
+}
+
+// WithRequireSingleAuditorRun makes verification fail when an auditor signed the tree in more than one generate
+// run, instead of only reporting it in Result.MixedAuditorSubjects, see Result.SingleAuditorRunViolated
+func WithRequireSingleAuditorRun(require bool) Option {
+	return func(v *Verifier) {
+		v.singleRun = require
+	}
+}
+
+// WithRequireSigned makes verification fail when a manifest is unsigned, even if a signed ancestor covers it,
+// see Result.UnsignedViolated
+func WithRequireSigned(require bool) Option {
+	return func(v *Verifier) {
+		v.requireSigned = require
+	}
+}
+
+// WithRequireTrusted makes verification fail when a manifest is unsigned or none of its auditors is trusted, see
+// Result.UntrustedViolated. It implies WithRequireSigned.
+func WithRequireTrusted(require bool) Option {
+	return func(v *Verifier) {
+		v.requireTrusted = require
+	}
 }
 
 // New creates a new Verifier instance
-func New(sc *scanner.Scanner, auditor ManifestAuditor, verifier issuer.Verifier) *Verifier {
-	return &Verifier{
+func New(sc *scanner.Scanner, auditor ManifestAuditor, verifier issuer.Verifier, opts ...Option) *Verifier {
+	v := &Verifier{
 		scanner:       sc,
 		auditor:       auditor,
 		trustVerifier: verifier,
+		maxRetained:   DefaultMaxRetainedFailures,
+		chtimes:       os.Chtimes,
+	}
+	for _, o := range opts {
+		o(v)
 	}
+	return v
 }
 
-// Verify recursively verifies manifest files starting from rootPath
+// Verify recursively verifies manifest files starting from rootPath.
+// When ctx is cancelled, it returns the partial result accumulated so far along with the error, see Result.Interrupted.
 func (v *Verifier) Verify(ctx context.Context, rootPath string) (*Result, error) {
+	return v.verify(ctx, rootPath, v.scanner.Walk, false)
+}
+
+// VerifyPath verifies only the manifests affected by changes of changedPaths inside rootPath,
+// see scanner.Scanner.WalkChanged
+func (v *Verifier) VerifyPath(ctx context.Context, rootPath string, changedPaths ...string) (*Result, error) {
+	return v.verify(ctx, rootPath, func(ctx context.Context, root string, walkFn scanner.ScannedDirFunc) error {
+		return v.scanner.WalkChanged(ctx, root, changedPaths, walkFn)
+	}, false)
+}
+
+// verify verifies the manifests of the directories visited by walk.
+// rootCovered tells that the manifest of rootPath is covered by the signature of an ancestor, see VerifySubtree.
+func (v *Verifier) verify(ctx context.Context, rootPath string,
+	walk func(ctx context.Context, root string, walkFn scanner.ScannedDirFunc) error, rootCovered bool) (*Result, error) {
 	directoryStatuses := make([]DirectoryVerificationStatus, 0)
+	// recorded counts the verified directories, including the ones not kept with a status sink
+	recorded := 0
+	// streamed and inheritance count the directories given to the status sink, see WithStatusSink
+	var streamed Summary
+	inheritance := newInheritanceCounter(rootCovered)
+	droppedFailures := 0
+	var rootManifest *manifest.Manifest
+	// rootLabels are the labels of the existing manifest of the last directory, the root once the walk is over,
+	// and rootAuditors the auditors that signed it
+	var rootLabels map[string]string
+	var rootAuditors []issuer.Reference
+	clockSkews := make(map[issuer.Reference]time.Duration)
+	// certificateErrors holds the first certificate outside its validity window per auditor, see signing.CheckValidity
+	certificateErrors := make(map[issuer.Reference]error)
+	// expiringCertificates holds the shortest time left before a certificate expires per auditor
+	expiringCertificates := make(map[issuer.Reference]time.Duration)
+	auditors := make(map[issuer.Reference]AuditorSummary)
+	subjects := newSubjectTracker()
+	// hiddenOnly holds the relative paths of the directories differing only in hidden entries
+	hiddenOnly := make(map[string]bool)
+	links := newLinkChecker()
+	signatures := newSigningCounter()
+	stats := v.scanner.GetStats()
+	record := func(ctx context.Context, status DirectoryVerificationStatus) error {
+		recorded++
+		signatures.add(status)
+		telemetry.Annotate(ctx, telemetry.String(telemetry.KeyOutcome, status.Outcome()))
+		retain := true
+		if v.sink != nil {
+			v.sink(status)
+			streamed.add(status.ManifestStatus)
+			inheritance.add(status)
+			retain = status.ManifestStatus.Found && !status.ManifestStatus.Valid
+			if retain && v.maxRetained > 0 && len(directoryStatuses) >= v.maxRetained {
+				retain = false
+				droppedFailures++
+			}
+		}
+		if retain {
+			directoryStatuses = append(directoryStatuses, status)
+		}
+		switch ms := status.ManifestStatus; {
+		case !ms.Found:
+			// Unmanaged directories are neither valid nor invalid
+		case ms.Shallow:
+			stats.IncreaseManifestsShallow()
+		case ms.Valid:
+			stats.IncreaseManifestsValid()
+		default:
+			stats.IncreaseManifestsInvalid()
+		}
+		if status.ManifestStatus.Audited {
+			stats.IncreaseManifestsAudited()
+		}
+		if v.onDirectory != nil {
+			return v.onDirectory(status)
+		}
+		return nil
+	}
+	// Embedded freshness does not depend on the timestamps, and refreshing would change the parent's fingerprint.
+	// Trees read through an fs.FS, e.g. archives, are never written to.
+	var refresh *refresher
+	if v.refresh && v.scanner.GetFreshnessMode() == scanner.FreshnessModeMtime && v.scanner.GetFS() == nil {
+		refresh = newRefresher(v.chtimes, v.scanner.GetLogger())
+	}
+	// audit verifies the signatures of the manifest of dirPath and records its auditors
+	// Certificates outside their validity window do not stop the verification, their auditors are reported instead
+	audit := func(dirPath string, m *manifest.Manifest) (AuditResult, error) {
+		auditResult := v.auditor.Verify(m)
+		if auditResult.IsAudited && auditResult.Error != nil && !invalidCertificatesOnly(auditResult) {
+			return auditResult, fmt.Errorf("%w for %s: %w", ErrAuditFailed, v.scanner.ManifestPath(dirPath), auditResult.Error)
+		}
+		for _, auditor := range auditResult.Auditors {
+			if auditor.ClockSkew > clockSkews[auditor.Reference] {
+				clockSkews[auditor.Reference] = auditor.ClockSkew
+			}
+			if _, ok := certificateErrors[auditor.Reference]; !ok && auditor.Error != nil {
+				certificateErrors[auditor.Reference] = auditor.Error
+			}
+			if expiresIn, ok := expiringCertificates[auditor.Reference]; auditor.ExpiresIn > 0 && (!ok || auditor.ExpiresIn < expiresIn) {
+				expiringCertificates[auditor.Reference] = auditor.ExpiresIn
+			}
+			summary := auditors[auditor.Reference]
+			// An auditor signing the same manifest twice is counted once
+			if n := len(summary.Directories); n == 0 || summary.Directories[n-1] != dirPath {
+				summary.ManifestCount++
+				summary.Directories = append(summary.Directories, dirPath)
+			}
+			auditors[auditor.Reference] = summary
+			subjects.add(relativePath(rootPath, dirPath), auditor)
+		}
+		return auditResult, nil
+	}
 
-	err := v.scanner.Walk(ctx, rootPath, func(ctx context.Context, dirPath string, computedManifest *manifest.Manifest, cached bool, err error) error {
+	// The root manifest tells the policy of the whole tree, before its hidden directories are reported missing
+	v.scanner.SetRoot(rootPath)
+	if m, loadErr := v.scanner.LoadManifest(rootPath); loadErr == nil && m != nil {
+		if err := v.checkHiddenPolicy(rootPath, m); err != nil {
+			return nil, err
+		}
+	}
+	err := walk(ctx, rootPath, func(ctx context.Context, dirPath string, computedManifest *manifest.Manifest, cached bool, err error) error {
 		if err != nil {
 			return fmt.Errorf("failed to scan directory: %w", err)
 		}
-		dirStatus := DirectoryVerificationStatus{Path: dirPath}
+		// Directories are visited in post-order, so the root comes last
+		rootManifest, rootLabels, rootAuditors = computedManifest, nil, nil
+		dirStatus := DirectoryVerificationStatus{Path: dirPath, RelativePath: relativePath(rootPath, dirPath)}
 		if cached {
+			// The scanner reuses a fresh manifest only once its HMAC and listing are checked, see
+			// scanner.WithFreshListingCheck, which leaves its signatures
+			auditResult, auditErr := audit(dirPath, computedManifest)
+			if auditErr != nil {
+				return auditErr
+			}
+			dirStatus.GeneratedBy = computedManifest.GeneratedBy
+			dirStatus.Auditors = auditorReferences(auditResult)
 			dirStatus.ManifestStatus = ManifestVerificationStatus{
 				Found:   true,
-				Skipped: true,
+				Shallow: true,
+				Valid:   true,
+				Signed:  auditResult.IsAudited,
+				Audited: auditResult.IsAudited && auditResult.Error == nil,
 			}
-			directoryStatuses = append(directoryStatuses, dirStatus)
-			return nil
+			rootLabels, rootAuditors = computedManifest.Labels, dirStatus.Auditors
+			return record(ctx, dirStatus)
 		}
 		// Load existing manifest
-		manifestPath := filepath.Join(dirPath, v.scanner.GetManifestName())
-		existingManifest, loadErr := manifest.LoadManifest(manifestPath)
+		manifestPath := v.scanner.ManifestPath(dirPath)
+		existingManifest, loadErr := v.scanner.LoadManifest(dirPath)
+		if errors.Is(loadErr, manifest.ErrInvalidManifest) {
+			v.scanner.GetLogger().Warn("invalid manifest", "path", manifestPath, "error", loadErr)
+			dirStatus.ManifestStatus = ManifestVerificationStatus{Found: true, Valid: false}
+			dirStatus.ManifestError = loadErr
+			return record(ctx, dirStatus)
+		}
 		if loadErr != nil {
 			return fmt.Errorf("failed to load manifest for %s: %w", manifestPath, loadErr)
 		}
 
+		// The parent of an unmanaged directory reports the checksum it recorded for a deleted manifest
+		if existingManifest == nil && (v.allowMissing ||
+			v.scanner.GetHiddenPolicy() == scanner.HiddenWarn && hiddenPath(dirStatus.RelativePath)) {
+			v.scanner.GetLogger().Debug("unmanaged directory", "path", dirPath)
+			return record(ctx, dirStatus)
+		}
 		if existingManifest == nil {
-			return fmt.Errorf("manifest in directory '%s' not found", dirPath)
+			notFound := &ManifestNotFoundError{Dir: dirPath}
+			if recorded == 0 {
+				// A missing manifest found first may be stored under another name
+				notFound.OtherName, _ = v.scanner.FindManifestName(rootPath, dirPath)
+			}
+			return notFound
 		}
 
-		auditResult := v.auditor.Verify(existingManifest)
-		if auditResult.IsAudited && auditResult.Error != nil {
-			return fmt.Errorf("manifest audit failed for %s: %w", manifestPath, auditResult.Error)
+		dirStatus.GeneratedBy = existingManifest.GeneratedBy
+		rootLabels = existingManifest.Labels
+		auditResult, auditErr := audit(dirPath, existingManifest)
+		if auditErr != nil {
+			return auditErr
+		}
+		dirStatus.Auditors = auditorReferences(auditResult)
+		rootAuditors = dirStatus.Auditors
+
+		// Entries are listed according to the config, so they cannot be compared when it changed
+		if !manifest.SecureEqualHex(existingManifest.ConfigDigest, computedManifest.ConfigDigest) {
+			return fmt.Errorf("%w: directory '%s' was generated with a different %s than the one applying now",
+				ErrConfigMismatch, dirPath, scanner.DirConfigName)
+		}
+		if err := v.checkHiddenPolicy(dirPath, existingManifest); err != nil {
+			return err
 		}
 
 		// Compare manifests using the standalone function
@@ -85,39 +606,236 @@ func (v *Verifier) Verify(ctx context.Context, rootPath string) (*Result, error)
 		if compareErr != nil {
 			return fmt.Errorf("failed to compare manifests for %s: %w", manifestPath, compareErr)
 		}
+		if broken := links.check(dirStatus.RelativePath, existingManifest, computedManifest); len(broken) > 0 {
+			valid, differences = false, append(differences, broken...)
+		}
 		if !valid {
+			v.scanner.GetLogger().Warn("manifest does not match directory", "path", manifestPath, "differences", len(differences))
+			hidden := hiddenPolicyOf(existingManifest) == scanner.HiddenWarn &&
+				tagHiddenDifferences(dirStatus.RelativePath, differences, hiddenOnly)
+			if hidden {
+				hiddenOnly[dirStatus.RelativePath] = true
+			}
 			dirStatus.ManifestStatus = ManifestVerificationStatus{
-				Found:   true,
-				Valid:   false,
-				Signed:  auditResult.IsAudited,
-				Audited: auditResult.IsAudited,
+				Found:      true,
+				Valid:      hidden && v.ignoreHidden,
+				Signed:     auditResult.IsAudited,
+				Audited:    auditResult.IsAudited && auditResult.Error == nil,
+				HiddenOnly: hidden,
 			}
 			dirStatus.Differences = differences
-			directoryStatuses = append(directoryStatuses, dirStatus)
-			return nil
+			dirStatus.SubtreeChange = manifest.CompareSubtrees(existingManifest, computedManifest)
+			return record(ctx, dirStatus)
 		}
 
-		// Touch the manifest to update its timestamp without changing content
-		if touchErr := existingManifest.Touch(manifestPath); touchErr != nil {
-			return fmt.Errorf("failed to touch manifest for %s: %w", manifestPath, touchErr)
+		// Manifests held by an overlay are not the ones in the tree
+		if refresh != nil && !v.scanner.Overlaid(dirPath) {
+			refresh.Refresh(manifestPath)
 		}
 		dirStatus.ManifestStatus = ManifestVerificationStatus{
 			Found:   true,
 			Valid:   true,
 			Signed:  auditResult.IsAudited,
-			Audited: auditResult.IsAudited}
-		directoryStatuses = append(directoryStatuses, dirStatus)
-		return nil
+			Audited: auditResult.IsAudited && auditResult.Error == nil}
+		return record(ctx, dirStatus)
 	})
 
+	var refreshed, refreshFailed int
+	if refresh != nil {
+		refreshed, refreshFailed = refresh.Close()
+	}
+	sort.Slice(directoryStatuses, func(i, j int) bool {
+		return directoryStatuses[i].RelativePath < directoryStatuses[j].RelativePath
+	})
 	if err != nil {
-		return nil, err
+		if ctx.Err() == nil || !errors.Is(err, ctx.Err()) {
+			return nil, err
+		}
+		// Directories are recorded once verified, so the statuses gathered before the cancellation are complete
+		result := NewResult(directoryStatuses, nil, v.scanner.GetStats())
+		if v.sink != nil {
+			result.summary, result.DroppedFailures = streamed, droppedFailures
+		}
+		result.RootPath = rootPath
+		result.Interrupted = true
+		result.Refreshed, result.RefreshFailed = refreshed, refreshFailed
+		return result, err
 	}
-	result := &Result{
-		DirectoryStatuses: directoryStatuses,
-		Stats:             v.scanner.GetStats(),
-		AuditorStatuses:   v.trustVerifier.Verify(v.auditor.GetIssuers()),
+	inheritAudits(directoryStatuses, rootCovered)
+	auditorStatuses := issuer.VerifyContext(ctx, v.trustVerifier, v.auditor.GetIssuers())
+	reportCertificateErrors(auditorStatuses, certificateErrors)
+	reportClockSkews(auditorStatuses, clockSkews)
+	reportExpiringCertificates(auditorStatuses, expiringCertificates)
+	result := NewResult(directoryStatuses, auditorStatuses, v.scanner.GetStats())
+	if v.sink != nil {
+		streamed.Audited += inheritance.inherited
+		streamed.Inherited += inheritance.inherited
+		result.summary, result.DroppedFailures = streamed, droppedFailures
+	}
+	result.RootPath = rootPath
+	if v.policy != nil {
+		result.Policy = v.policy.Evaluate(auditorStatuses)
+	}
+	for _, summary := range auditors {
+		sort.Strings(summary.Directories)
+	}
+	result.Auditors = auditors
+	result.MixedAuditorSubjects, result.singleAuditorRun = subjects.mixed(), v.singleRun
+	result.Signing = signatures.summary(auditorStatuses)
+	result.requireSigned, result.requireTrusted = v.requireSigned, v.requireTrusted
+	result.Refreshed, result.RefreshFailed = refreshed, refreshFailed
+	result.Labels = rootLabels
+	result.MissingLabels = manifest.MissingLabels(rootLabels, v.labels)
+	result.UntrustedLabels = len(v.labels) > 0 && !anyTrusted(rootAuditors, auditorStatuses)
+	if rootManifest != nil {
+		result.Subtree = rootManifest.Subtree
+		if result.RootDigest, err = manifest.RootDigest(rootManifest); err != nil {
+			return nil, fmt.Errorf("failed to compute root digest: %w", err)
+		}
 	}
-
 	return result, nil
 }
+
+// inheritAudits marks valid unsigned manifests as audited when the manifest of their parent is valid and audited,
+// directly or in turn inherited. A parent records the checksums of its child manifests, so the chain of valid
+// manifests down from a signed one is covered by its signature. Shallow manifests break it: the checksums of their
+// files were not checked against the contents.
+// The root inherits the audit when rootCovered is set, as the root of a subtree linked to a signed ancestor.
+func inheritAudits(statuses []DirectoryVerificationStatus, rootCovered bool) {
+	byPath := make(map[string]int, len(statuses))
+	for i, status := range statuses {
+		byPath[status.RelativePath] = i
+	}
+	resolved := make(map[int]bool, len(statuses))
+	var audited func(i int) bool
+	audited = func(i int) bool {
+		ms := &statuses[i].ManifestStatus
+		if ms.Audited || resolved[i] || !ms.Valid || ms.Shallow {
+			return ms.Audited && ms.Valid
+		}
+		resolved[i] = true
+		rel := statuses[i].RelativePath
+		parent, ok := byPath[filepath.Dir(rel)]
+		if (rel == "." && rootCovered) || (ok && rel != "." && audited(parent)) {
+			ms.Audited = true
+			ms.Inherited = true
+		}
+		return ms.Audited
+	}
+	for i := range statuses {
+		audited(i)
+	}
+}
+
+// inheritanceCounter counts the manifests inheritAudits marks as audited without keeping the statuses of the
+// directories, which are added in post-order: only the number of manifests waiting for an audited ancestor is
+// kept per directory not added yet
+type inheritanceCounter struct {
+	rootCovered bool
+	// pending holds, per relative path, the number of valid unsigned manifests below the directory that inherit
+	// its audit if it is audited, directly or in turn inherited
+	pending   map[string]int
+	inherited int
+}
+
+func newInheritanceCounter(rootCovered bool) *inheritanceCounter {
+	return &inheritanceCounter{rootCovered: rootCovered, pending: make(map[string]int)}
+}
+
+// add counts the manifests below the directory of status that inherit its audit,
+// or leaves them waiting for its parent when the directory may inherit one itself
+func (c *inheritanceCounter) add(status DirectoryVerificationStatus) {
+	rel := status.RelativePath
+	waiting := c.pending[rel]
+	delete(c.pending, rel)
+	switch ms := status.ManifestStatus; {
+	case ms.Audited && ms.Valid:
+		c.inherited += waiting
+	case !ms.Valid || ms.Shallow:
+		// The chain of valid manifests is broken, nothing below inherits an audit through this directory
+	case rel == ".":
+		if c.rootCovered {
+			c.inherited += waiting + 1
+		}
+	default:
+		c.pending[filepath.Dir(rel)] += waiting + 1
+	}
+}
+
+// invalidCertificatesOnly reports whether every auditor failing the audit did so only because its certificate
+// is outside its validity window
+func invalidCertificatesOnly(result AuditResult) bool {
+	if !isCertificateValidityError(result.Error) {
+		return false
+	}
+	for _, auditor := range result.Auditors {
+		if auditor.Error != nil && !isCertificateValidityError(auditor.Error) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCertificateValidityError reports whether err comes from a certificate outside its validity window
+func isCertificateValidityError(err error) bool {
+	return errors.Is(err, signing.ErrCertificateExpired) || errors.Is(err, signing.ErrCertificateNotYetValid)
+}
+
+// reportCertificateErrors replaces the statuses of auditors with a certificate outside its validity window by
+// that error, see issuer.CategoryExpired. A status the trusted source rejected is kept, an expired certificate
+// must not hide that the issuer is untrusted, only one it could not be checked against is replaced.
+func reportCertificateErrors(auditorStatuses map[issuer.Reference]issuer.Status, certificateErrors map[issuer.Reference]error) {
+	for ref, err := range certificateErrors {
+		status, ok := auditorStatuses[ref]
+		if !ok || (status.Error != nil && !issuer.IsTransient(status.Error)) {
+			continue
+		}
+		status.Error = err
+		auditorStatuses[ref] = status
+	}
+}
+
+// reportExpiringCertificates marks auditors whose certificates expire soon as fishy,
+// unless their status already carries an error
+func reportExpiringCertificates(auditorStatuses map[issuer.Reference]issuer.Status, expiring map[issuer.Reference]time.Duration) {
+	for ref, expiresIn := range expiring {
+		status, ok := auditorStatuses[ref]
+		if !ok || status.Error != nil {
+			continue
+		}
+		status.Error = fmt.Errorf("auditor certificate expires soon, in %s", expiresIn.Round(time.Second))
+		auditorStatuses[ref] = status
+	}
+}
+
+// reportClockSkews warns about auditors whose signed timestamps lie in the future, see issuer.Status.Warning.
+// Clock skew on the auditor's machine does not make its signatures any less valid.
+func reportClockSkews(auditorStatuses map[issuer.Reference]issuer.Status, clockSkews map[issuer.Reference]time.Duration) {
+	for ref, skew := range clockSkews {
+		status, ok := auditorStatuses[ref]
+		if !ok {
+			continue
+		}
+		status.Warning = fmt.Sprintf("auditor timestamp is %s in the future, check for clock skew", skew.Round(time.Second))
+		auditorStatuses[ref] = status
+	}
+}
+
+// anyTrusted reports whether any of refs is trusted, see issuer.CategoryTrusted
+func anyTrusted(refs []issuer.Reference, auditorStatuses map[issuer.Reference]issuer.Status) bool {
+	for _, ref := range refs {
+		if status, ok := auditorStatuses[ref]; ok && status.Category() == issuer.CategoryTrusted {
+			return true
+		}
+	}
+	return false
+}
+
+// relativePath returns dirPath relative to rootPath, or dirPath itself when it is not below rootPath
+func relativePath(rootPath, dirPath string) string {
+	rel, err := filepath.Rel(rootPath, dirPath)
+	if err != nil {
+		return dirPath
+	}
+	return rel
+}
@@ -0,0 +1,457 @@
+package verifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomekjarosik/bytecheck/pkg/generator"
+	"github.com/tomekjarosik/bytecheck/pkg/issuer"
+	"github.com/tomekjarosik/bytecheck/pkg/manifest"
+	"github.com/tomekjarosik/bytecheck/pkg/scanner"
+)
+
+// createTree creates the files, given by slash separated paths relative to a new temporary directory,
+// together with their parent directories and returns the directory
+func createTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestNewResult_Summary(t *testing.T) {
+	result := NewResult([]DirectoryVerificationStatus{
+		{Path: "a", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Signed: true, Audited: true}},
+		{Path: "b", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true}},
+		{Path: "c", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: false, Signed: true, Audited: true}},
+		{Path: "d", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Shallow: true}},
+	}, nil, nil)
+
+	assert.Equal(t, Summary{Found: 4, Verified: 3, Shallow: 1, Invalid: 1, Signed: 2, Audited: 2}, result.Summary())
+	assert.True(t, result.HasFailures())
+}
+
+func TestNewResult_WithAllValid_HasNoFailures(t *testing.T) {
+	result := NewResult([]DirectoryVerificationStatus{
+		{Path: "a", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true}},
+		{Path: "b", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Shallow: true}},
+	}, nil, nil)
+
+	assert.Equal(t, Summary{Found: 2, Verified: 2, Shallow: 1}, result.Summary())
+	assert.False(t, result.HasFailures())
+}
+
+func TestNewResult_Empty(t *testing.T) {
+	result := NewResult(nil, nil, nil)
+
+	assert.Equal(t, Summary{}, result.Summary())
+	assert.False(t, result.HasFailures())
+}
+
+func TestInheritAudits_FollowsValidManifestsDownFromAuditedOnes(t *testing.T) {
+	valid := ManifestVerificationStatus{Found: true, Valid: true}
+	audited := ManifestVerificationStatus{Found: true, Valid: true, Signed: true, Audited: true}
+	statuses := []DirectoryVerificationStatus{
+		{RelativePath: ".", ManifestStatus: audited},
+		{RelativePath: "-early", ManifestStatus: valid},
+		{RelativePath: "a", ManifestStatus: valid},
+		{RelativePath: "a/b", ManifestStatus: valid},
+		{RelativePath: "c", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: false}},
+		{RelativePath: "c/d", ManifestStatus: valid},
+		{RelativePath: "e", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Shallow: true}},
+		{RelativePath: "e/f", ManifestStatus: valid},
+	}
+
+	inheritAudits(statuses, false)
+
+	inherited := map[string]bool{}
+	for _, status := range statuses {
+		if status.ManifestStatus.Inherited {
+			assert.True(t, status.ManifestStatus.Audited, status.RelativePath)
+			inherited[status.RelativePath] = true
+		}
+	}
+	assert.Equal(t, map[string]bool{"-early": true, "a": true, "a/b": true}, inherited)
+	assert.False(t, statuses[0].ManifestStatus.Inherited, "signed manifests are audited themselves")
+}
+
+func TestVerifier_Verify_Cancelled_mustReturnPartialResult(t *testing.T) {
+	dir := createTree(t, map[string]string{
+		"a/file.txt": "content",
+		"b/file.txt": "content",
+		"c/file.txt": "content",
+		"file.txt":   "content",
+	})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithDirectoryReport(func(status DirectoryVerificationStatus) error {
+			cancel()
+			return nil
+		}))
+	result, err := v.Verify(ctx, dir)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	assert.True(t, result.Interrupted)
+	assert.Equal(t, dir, result.RootPath)
+	require.NotEmpty(t, result.DirectoryStatuses)
+	assert.Less(t, len(result.DirectoryStatuses), 4, "the verification must stop before the root")
+	assert.Equal(t, "a", result.DirectoryStatuses[0].RelativePath)
+	assert.True(t, result.DirectoryStatuses[0].ManifestStatus.Valid)
+	assert.Equal(t, len(result.DirectoryStatuses), result.Summary().Verified)
+	assert.Nil(t, result.AuditorStatuses)
+}
+
+func TestVerifier_Verify_mustCountManifestsInStats(t *testing.T) {
+	dir := createTree(t, map[string]string{"a/file.txt": "content", "b/file.txt": "content", "file.txt": "content"})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b", "file.txt"), []byte("changed"), 0644))
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(result.Summary().Verified), result.Stats.ManifestsValid())
+	assert.Equal(t, int64(1), result.Stats.ManifestsInvalid())
+	assert.Zero(t, result.Stats.ManifestsShallow())
+}
+
+func TestVerifier_Verify_WithTraversalEntityName_mustReportCorruptManifest(t *testing.T) {
+	dir := createTree(t, map[string]string{"a/file.txt": "content", "b/file.txt": "content"})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	// A crafted manifest with a valid HMAC, Encode refuses to write it
+	hostile := manifest.Manifest{Entities: []manifest.Entity{{Name: "../../etc/passwd", Checksum: "00"}}}
+	data, err := json.Marshal(hostile)
+	require.NoError(t, err)
+	mac := hmac.New(sha256.New, manifest.DEFAULT_HMAC_KEY)
+	mac.Write(data)
+	hostile.HMAC = hex.EncodeToString(mac.Sum(nil))
+	data, err = json.Marshal(hostile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", manifest.DefaultName), data, 0644))
+
+	result, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+
+	require.NoError(t, err, "a corrupt manifest must not abort the walk")
+	require.Len(t, result.DirectoryStatuses, 3)
+	corrupt := result.DirectoryStatuses[1]
+	assert.Equal(t, "a", corrupt.RelativePath)
+	require.ErrorIs(t, corrupt.ManifestError, manifest.ErrInvalidManifest)
+	assert.ErrorContains(t, corrupt.ManifestError, `entity "../../etc/passwd"`)
+	assert.True(t, result.DirectoryStatuses[2].ManifestStatus.Valid, "b is verified after a")
+}
+
+func TestVerifier_Verify_WithOtherManifestName_mustReportIt(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content"), 0644))
+	require.NoError(t, generator.New(scanner.New(scanner.WithManifestName("custom.manifest")), nil).
+		Generate(context.Background(), dir))
+
+	_, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+
+	require.ErrorIs(t, err, ErrManifestNotFound)
+	var notFound *ManifestNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "custom.manifest", notFound.OtherName)
+	assert.NotContains(t, err.Error(), "--manifest-name")
+}
+
+func TestVerifier_Verify_WithAllowMissingManifests_mustReportUnmanagedDirectories(t *testing.T) {
+	dir := createTree(t, map[string]string{
+		"file.txt":     "content",
+		"a/file.txt":   "content",
+		"b/file.txt":   "content",
+		"b/c/file.txt": "content",
+	})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b", manifest.DefaultName)))
+	require.NoError(t, os.Remove(filepath.Join(dir, "b", "c", manifest.DefaultName)))
+
+	_, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+	require.ErrorIs(t, err, ErrManifestNotFound)
+
+	// The root records the checksum of the deleted manifest, deleting it must not hide changes below
+	result, err := New(scanner.New(scanner.WithAllowMissingManifests(true)), NewSimpleManifestAuditor(),
+		issuer.NewMultiSourceVerifier(), WithAllowMissingManifests(true)).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Found: 2, Verified: 1, Invalid: 1, Unmanaged: 2}, result.Summary())
+	require.Equal(t, ".", result.DirectoryStatuses[0].RelativePath)
+	require.Len(t, result.DirectoryStatuses[0].Differences, 1)
+	assert.Equal(t, "b", result.DirectoryStatuses[0].Differences[0].Name)
+	assert.Equal(t, manifest.DiffChecksumMismatch, result.DirectoryStatuses[0].Differences[0].Type)
+
+	// The b branch is no longer managed once the root records it as unmanaged
+	saveRootManifest(t, scanner.New(scanner.WithAllowMissingManifests(true)), dir)
+	result, err = New(scanner.New(scanner.WithAllowMissingManifests(true)), NewSimpleManifestAuditor(),
+		issuer.NewMultiSourceVerifier(), WithAllowMissingManifests(true)).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Found: 2, Verified: 2, Unmanaged: 2}, result.Summary())
+	assert.False(t, result.HasFailures())
+	unmanaged := []string{}
+	for _, status := range result.DirectoryStatuses {
+		if !status.ManifestStatus.Found {
+			unmanaged = append(unmanaged, status.RelativePath)
+		}
+	}
+	assert.Equal(t, []string{"b", "b/c"}, unmanaged)
+
+	// Changes of the managed parts are still found
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "file.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0644))
+	result, err = New(scanner.New(scanner.WithAllowMissingManifests(true)), NewSimpleManifestAuditor(),
+		issuer.NewMultiSourceVerifier(), WithAllowMissingManifests(true)).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Found: 2, Invalid: 2, Unmanaged: 2}, result.Summary())
+	for _, status := range result.DirectoryStatuses {
+		if status.RelativePath == "." {
+			require.Len(t, status.Differences, 1, "b must not be reported")
+			assert.Equal(t, "new.txt", status.Differences[0].Name)
+		}
+	}
+}
+
+// saveRootManifest saves the manifest sc computes for dir, leaving the manifests of its subdirectories as they are
+func saveRootManifest(t *testing.T, sc *scanner.Scanner, dir string) {
+	t.Helper()
+	err := sc.Walk(context.Background(), dir, func(ctx context.Context, dirPath string, m *manifest.Manifest, cached bool, err error) error {
+		if err != nil || dirPath != dir {
+			return err
+		}
+		return m.Save(filepath.Join(dirPath, manifest.DefaultName))
+	})
+	require.NoError(t, err)
+}
+
+func TestVerifier_Verify_WithAllowMissingManifests_mustVerifyManagedSubdirectoriesOfUnmanagedRoot(t *testing.T) {
+	dir := createTree(t, map[string]string{
+		"file.txt":         "content",
+		"managed/file.txt": "content",
+		"other/file.txt":   "content",
+	})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), filepath.Join(dir, "managed")))
+
+	result, err := New(scanner.New(scanner.WithAllowMissingManifests(true)), NewSimpleManifestAuditor(),
+		issuer.NewMultiSourceVerifier(), WithAllowMissingManifests(true)).Verify(context.Background(), dir)
+
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Found: 1, Verified: 1, Unmanaged: 2}, result.Summary())
+	assert.Zero(t, result.Stats.ManifestsInvalid())
+}
+
+func TestInheritanceCounter_mustCountLikeInheritAudits(t *testing.T) {
+	valid := ManifestVerificationStatus{Found: true, Valid: true}
+	audited := ManifestVerificationStatus{Found: true, Valid: true, Signed: true, Audited: true}
+	for _, rootCovered := range []bool{false, true} {
+		statuses := []DirectoryVerificationStatus{
+			{RelativePath: ".", ManifestStatus: valid},
+			{RelativePath: "a", ManifestStatus: audited},
+			{RelativePath: "a/b", ManifestStatus: valid},
+			{RelativePath: "a/b/c", ManifestStatus: valid},
+			{RelativePath: "d", ManifestStatus: valid},
+			{RelativePath: "d/e", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: false}},
+			{RelativePath: "d/e/f", ManifestStatus: valid},
+			{RelativePath: "g", ManifestStatus: ManifestVerificationStatus{Found: true, Valid: true, Shallow: true}},
+			{RelativePath: "g/h", ManifestStatus: valid},
+		}
+		counter := newInheritanceCounter(rootCovered)
+		// Directories are verified in post-order, subdirectories before their parents
+		for i := len(statuses) - 1; i >= 0; i-- {
+			counter.add(statuses[i])
+		}
+
+		inheritAudits(statuses, rootCovered)
+		assert.Equal(t, NewResult(statuses, nil, nil).Summary().Inherited, counter.inherited, "rootCovered %v", rootCovered)
+	}
+}
+
+func TestVerifier_Verify_WithStatusSink_mustKeepOnlyFailures(t *testing.T) {
+	dir := createTree(t, map[string]string{
+		"a/file.txt":   "content",
+		"b/file.txt":   "content",
+		"c/file.txt":   "content",
+		"c/d/file.txt": "content",
+		"file.txt":     "content",
+	})
+	require.NoError(t, generator.New(scanner.New(), nil).Generate(context.Background(), dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b", "file.txt"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c", "d", "file.txt"), []byte("changed"), 0644))
+
+	full, err := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+	require.NoError(t, err)
+
+	var streamed []string
+	v := New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithStatusSink(func(status DirectoryVerificationStatus) {
+			streamed = append(streamed, status.RelativePath)
+		}))
+	result, err := v.Verify(context.Background(), dir)
+	require.NoError(t, err)
+
+	assert.Len(t, streamed, 5, "every directory is delivered while verifying")
+	assert.Equal(t, ".", streamed[len(streamed)-1], "the root is verified last")
+	assert.Equal(t, full.Summary(), result.Summary())
+	var failed []string
+	for _, status := range result.DirectoryStatuses {
+		failed = append(failed, status.RelativePath)
+	}
+	assert.Equal(t, []string{"b", "c/d"}, failed)
+	assert.Zero(t, result.DroppedFailures)
+	assert.Equal(t, full.RootDigest, result.RootDigest)
+
+	v = New(scanner.New(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithStatusSink(func(status DirectoryVerificationStatus) {}), WithMaxRetainedFailures(1))
+	result, err = v.Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Len(t, result.DirectoryStatuses, 1)
+	assert.Equal(t, 1, result.DroppedFailures)
+	assert.Equal(t, full.Summary(), result.Summary())
+	assert.True(t, result.HasFailures())
+}
+
+func TestVerifier_Verify_WithHiddenWarn_mustTagHiddenDifferences(t *testing.T) {
+	dir := createTree(t, map[string]string{"data.txt": "content", "sub/file.txt": "content", ".cache/x.tmp": "content"})
+	warn := scanner.WithHiddenPolicy(scanner.HiddenWarn)
+	require.NoError(t, generator.New(scanner.New(warn), nil).Generate(context.Background(), dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".cache", "x.tmp"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", ".swp"), []byte("editor"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".ipynb_checkpoints", "nested"), 0755))
+
+	result, err := New(scanner.New(warn), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, result.HasFailures())
+	var failed []string
+	for _, status := range result.DirectoryStatuses {
+		if !status.ManifestStatus.Found || status.ManifestStatus.Valid {
+			continue
+		}
+		failed = append(failed, status.RelativePath)
+		assert.True(t, status.ManifestStatus.HiddenOnly, status.RelativePath)
+		for _, diff := range status.Differences {
+			assert.True(t, diff.Hidden, "%s: %s", status.RelativePath, diff.Name)
+		}
+	}
+	assert.Equal(t, []string{".", ".cache", "sub"}, failed)
+	assert.Equal(t, 3, result.Summary().HiddenOnly)
+	assert.Equal(t, 2, result.Summary().Unmanaged, "new hidden directories need no manifest")
+
+	result, err = New(scanner.New(warn), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithIgnoreHiddenDifferences(true)).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.False(t, result.HasFailures())
+	assert.Equal(t, 3, result.Summary().HiddenOnly)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.txt"), []byte("changed"), 0644))
+	result, err = New(scanner.New(warn), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier(),
+		WithIgnoreHiddenDifferences(true)).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, result.HasFailures(), "a change of a visible file is never ignored")
+	assert.Equal(t, 2, result.Summary().HiddenOnly)
+}
+
+func TestVerifier_Verify_WithHiddenWarnAndDeletedManifest_mustReportRecordedChecksum(t *testing.T) {
+	dir := createTree(t, map[string]string{"data.txt": "content", ".hid/f.txt": "content"})
+	warn := scanner.WithHiddenPolicy(scanner.HiddenWarn)
+	require.NoError(t, generator.New(scanner.New(warn), nil).Generate(context.Background(), dir))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hid", "f.txt"), []byte("tampered"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, ".hid", manifest.DefaultName)))
+
+	result, err := New(scanner.New(warn), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.True(t, result.HasFailures(), "deleting the manifest must not hide the change")
+	root := result.DirectoryStatuses[0]
+	require.Equal(t, ".", root.RelativePath)
+	require.Len(t, root.Differences, 1)
+	assert.Equal(t, ".hid", root.Differences[0].Name)
+	assert.Equal(t, manifest.DiffChecksumMismatch, root.Differences[0].Type)
+	assert.True(t, root.Differences[0].Hidden)
+}
+
+func TestVerifier_Verify_WithOtherHiddenPolicy_mustFailNamingIt(t *testing.T) {
+	dir := createTree(t, map[string]string{"data.txt": "content", ".cache/x.tmp": "content"})
+	exclude := scanner.WithHiddenPolicy(scanner.HiddenExclude)
+	require.NoError(t, generator.New(scanner.New(exclude), nil).Generate(context.Background(), dir))
+	_, err := os.Stat(filepath.Join(dir, ".cache", manifest.DefaultName))
+	require.ErrorIs(t, err, os.ErrNotExist, "hidden directories are not descended into")
+
+	for _, policy := range []scanner.HiddenPolicy{scanner.HiddenInclude, scanner.HiddenWarn} {
+		_, err = New(scanner.New(scanner.WithHiddenPolicy(policy)), NewSimpleManifestAuditor(),
+			issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+		assert.ErrorIs(t, err, ErrHiddenPolicyMismatch, policy)
+		assert.ErrorContains(t, err, "generated with hidden policy 'exclude', not '"+string(policy)+"'")
+	}
+
+	result, err := New(scanner.New(exclude), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).
+		Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.False(t, result.HasFailures())
+}
+
+// rootManifestName names the root manifest MANIFEST.root and the others with the default name
+func rootManifestName(dirPath string, isRoot bool) string {
+	if isRoot {
+		return "MANIFEST.root"
+	}
+	return manifest.DefaultName
+}
+
+func TestVerifier_Verify_WithManifestNameFunc_mustVerifyDistinctRootManifest(t *testing.T) {
+	dir := createTree(t, map[string]string{"a/file.txt": "content", "file.txt": "content"})
+	newScanner := func() *scanner.Scanner {
+		return scanner.New(scanner.WithManifestNameFunc(rootManifestName))
+	}
+	require.NoError(t, generator.New(newScanner(), nil).Generate(context.Background(), dir))
+	assert.FileExists(t, filepath.Join(dir, "MANIFEST.root"))
+	assert.NoFileExists(t, filepath.Join(dir, manifest.DefaultName))
+	assert.FileExists(t, filepath.Join(dir, "a", manifest.DefaultName))
+	root, err := manifest.LoadManifest(filepath.Join(dir, "MANIFEST.root"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "file.txt"}, []string{root.Entities[0].Name, root.Entities[1].Name},
+		"the root manifest is not an entity of the root")
+
+	result, err := New(newScanner(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Found: 2, Verified: 2}, result.Summary())
+
+	// A root manifest left over under the default name is an ordinary file of the root
+	require.NoError(t, os.WriteFile(filepath.Join(dir, manifest.DefaultName), []byte("{}"), 0644))
+	result, err = New(newScanner(), NewSimpleManifestAuditor(), issuer.NewMultiSourceVerifier()).Verify(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Summary().Invalid)
+}
+
+func TestVerifier_Verify_WithManifestNameCollidingWithDataFile_mustFail(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "MANIFEST.root"), []byte("release notes"), 0644))
+
+	err := generator.New(scanner.New(scanner.WithManifestNameFunc(rootManifestName)), nil).Generate(context.Background(), dir)
+
+	assert.ErrorContains(t, err, "collides with a file that is not a valid manifest")
+	content, readErr := os.ReadFile(filepath.Join(dir, "MANIFEST.root"))
+	require.NoError(t, readErr)
+	assert.Equal(t, "release notes", string(content))
+}
+
+func TestVerifier_Verify_WithManifestNameCollidingWithDirectory_mustFail(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "MANIFEST.root"), 0755))
+
+	err := generator.New(scanner.New(scanner.WithManifestNameFunc(rootManifestName)), nil).Generate(context.Background(), dir)
+
+	assert.ErrorContains(t, err, "manifest name 'MANIFEST.root'")
+	assert.ErrorContains(t, err, "collides with an entry that is not a regular file")
+}
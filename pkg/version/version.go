@@ -0,0 +1,68 @@
+// Package version describes the build of bytecheck. The variables are meant to be set with
+// -ldflags="-X 'github.com/tomekjarosik/bytecheck/pkg/version.Version=$TAG' -X ...Commit=$SHA -X ...Date=$DATE".
+// When they are not set, the values recorded by the Go toolchain are used.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+var (
+	// Version is the release of the binary, e.g. v1.2.3
+	Version string
+	// Commit is the revision the binary was built from
+	Commit string
+	// Date is the time the binary was built, or of the commit when taken from build information
+	Date string
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "" {
+		Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && Commit == "":
+			Commit = setting.Value
+		case setting.Key == "vcs.time" && Date == "":
+			Date = setting.Value
+		}
+	}
+}
+
+// String identifies the build in one line, e.g. "bytecheck v1.2.3 (0123abc)".
+// It is recorded in generated manifests, see manifest.Manifest.GeneratedBy.
+func String() string {
+	v := Version
+	if v == "" {
+		v = "unknown"
+	}
+	if Commit == "" {
+		return "bytecheck " + v
+	}
+	return fmt.Sprintf("bytecheck %s (%s)", v, shortCommit())
+}
+
+// Details describes the build on one line per property, as printed by the version command
+func Details() string {
+	return fmt.Sprintf("version: %s\ncommit:  %s\nbuilt:   %s\n", orUnknown(Version), orUnknown(Commit), orUnknown(Date))
+}
+
+func shortCommit() string {
+	if len(Commit) > 7 {
+		return Commit[:7]
+	}
+	return Commit
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
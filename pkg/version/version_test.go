@@ -0,0 +1,23 @@
+package version
+
+import "testing"
+
+func TestString(t *testing.T) {
+	defer func(v, c, d string) { Version, Commit, Date = v, c, d }(Version, Commit, Date)
+
+	Version, Commit, Date = "v1.2.3", "0123456789abcdef", "2026-01-02T03:04:05Z"
+	if got := String(); got != "bytecheck v1.2.3 (0123456)" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := Details(); got != "version: v1.2.3\ncommit:  0123456789abcdef\nbuilt:   2026-01-02T03:04:05Z\n" {
+		t.Errorf("Details() = %q", got)
+	}
+
+	Version, Commit, Date = "", "", ""
+	if got := String(); got != "bytecheck unknown" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := Details(); got != "version: unknown\ncommit:  unknown\nbuilt:   unknown\n" {
+		t.Errorf("Details() = %q", got)
+	}
+}